@@ -12,6 +12,7 @@ import (
 	"github.com/aliengiraffe/spotdb/pkg/database"
 	"github.com/aliengiraffe/spotdb/pkg/helpers"
 	"github.com/aliengiraffe/spotdb/pkg/mcp"
+	"github.com/aliengiraffe/spotdb/pkg/snapshot"
 	"github.com/aliengiraffe/spotdb/pkg/socket"
 )
 
@@ -20,6 +21,7 @@ var (
 	httpServer *http.Server
 	mcpServer  *http.Server
 	sockServer *socket.Server
+	autoSnap   *snapshot.AutoSnapshotter
 	wg         sync.WaitGroup
 	ctx        context.Context
 	cancel     context.CancelFunc
@@ -30,17 +32,52 @@ func Run(log *slog.Logger) error {
 	// Create a cancelable context for graceful shutdown
 	ctx, cancel = context.WithCancel(context.Background())
 
+	// Fail before anything starts when the configuration is invalid, such as half
+	// configured TLS, reporting every problem at once
+	report := &startupReport{}
+	protocols := helpers.GetHTTPProtocols()
+	checkConfig(report, protocols)
+	if err := report.err(); err != nil {
+		report.log(log)
+		return err
+	}
+
 	// Initialize DuckDB
 	var err error
 	db, err = database.NewDuckDB(ctx)
 	if err != nil {
-		return err
+		report.add("database", "", err)
+		report.log(log)
+		return report.err()
 	}
 
 	log.Info("Database initialized successfully")
 
+	// Check the extensions and the services the database depends on, then log the
+	// readiness summary
+	checkDatabase(helpers.SetLoggerInContext(ctx, log), report, db)
+	report.log(log)
+	if err := report.err(); err != nil {
+		helpers.CloseResources(db, "database connection")
+		db = nil
+		return err
+	}
+
+	// Get socket port from environment or use default
+	socketPort := os.Getenv("SOCKET_PORT")
+	if socketPort == "" {
+		socketPort = "6033"
+	}
+	socketAddr := ":" + socketPort
+
+	// Create the socket server first so the API can report its connections
+	sockServer, err = socket.NewServer(db, socketAddr)
+	if err != nil {
+		return err
+	}
+
 	// Start HTTP server for CSV uploads with API key middleware if needed
-	httpServer = api.NewServer(db, log)
+	httpServer = api.NewServer(db, log, sockServer)
 
 	// Initialize and start MCP server
 	mcpServer = mcp.InitMCP(ctx, db, log)
@@ -49,25 +86,19 @@ func Run(log *slog.Logger) error {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		log.Info("Starting HTTP server on :8080")
-		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Info("Starting HTTP server on :8080", slog.Bool("tls", protocols.TLSEnabled()))
+		var err error
+		if protocols.TLSEnabled() {
+			err = httpServer.ListenAndServeTLS(protocols.TLSCertFile, protocols.TLSKeyFile)
+		} else {
+			err = httpServer.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			log.Error("HTTP server error", slog.Any("error", err))
 		}
 	}()
 
-	// Get socket port from environment or use default
-	socketPort := os.Getenv("SOCKET_PORT")
-	if socketPort == "" {
-		socketPort = "6033"
-	}
-	socketAddr := ":" + socketPort
-
 	// Start socket server
-	sockServer, err = socket.NewServer(db, socketAddr)
-	if err != nil {
-		return err
-	}
-
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
@@ -77,6 +108,9 @@ func Run(log *slog.Logger) error {
 		}
 	}()
 
+	// Start automatic snapshots when an interval and destination are configured
+	startAutoSnapshots(log)
+
 	// Wait a bit to ensure servers are started
 	time.Sleep(100 * time.Millisecond)
 	log.Info("All services started successfully")
@@ -116,6 +150,16 @@ func Shutdown(log *slog.Logger) {
 		sockServer.Stop(log)
 	}
 
+	// Take a final snapshot of any changes since the last automatic one
+	if autoSnap != nil {
+		snapshotCtx, snapshotCancel := context.WithTimeout(
+			helpers.SetLoggerInContext(context.Background(), log), finalSnapshotTimeout)
+		if _, err := autoSnap.SnapshotIfChanged(snapshotCtx); err != nil {
+			log.Error("Final snapshot failed", slog.Any("error", err))
+		}
+		snapshotCancel()
+	}
+
 	// Close database connection
 	if db != nil {
 		helpers.CloseResources(db, "database connection")
@@ -124,3 +168,29 @@ func Shutdown(log *slog.Logger) {
 	// Wait for all goroutines to finish
 	wg.Wait()
 }
+
+// finalSnapshotTimeout bounds the snapshot taken during shutdown
+const finalSnapshotTimeout = 2 * time.Minute
+
+// startAutoSnapshots starts the periodic snapshot worker when ENV_AUTO_SNAPSHOT_INTERVAL
+// and ENV_AUTO_SNAPSHOT_LOCATION are both set
+func startAutoSnapshots(log *slog.Logger) {
+	interval := helpers.GetAutoSnapshotInterval()
+	location := helpers.GetAutoSnapshotLocation()
+	if interval == 0 || location == "" {
+		return
+	}
+
+	var err error
+	autoSnap, err = snapshot.NewAutoSnapshotter(helpers.SetLoggerInContext(ctx, log), db, location, interval, nil)
+	if err != nil {
+		log.Error("Automatic snapshots disabled", slog.Any("error", err))
+		return
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		autoSnap.Run(helpers.SetLoggerInContext(ctx, log))
+	}()
+}
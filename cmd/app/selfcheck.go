@@ -0,0 +1,121 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aliengiraffe/spotdb/pkg/database"
+	"github.com/aliengiraffe/spotdb/pkg/helpers"
+	"github.com/aliengiraffe/spotdb/pkg/snapshot"
+)
+
+// snapshotStoreCheckTimeout bounds the connectivity check of the automatic snapshot store
+const snapshotStoreCheckTimeout = 10 * time.Second
+
+// startupCheck is the outcome of one startup self-check
+type startupCheck struct {
+	name   string
+	detail string
+	err    error
+}
+
+// startupReport collects the startup self-checks so they are logged as a single readiness
+// summary and failures are returned as one error
+type startupReport struct {
+	checks []startupCheck
+}
+
+// add records the outcome of a check, detail describes what was checked
+func (r *startupReport) add(name, detail string, err error) {
+	r.checks = append(r.checks, startupCheck{name: name, detail: detail, err: err})
+}
+
+// err returns the failed checks joined into a single error, nil when all passed
+func (r *startupReport) err() error {
+	var errs []error
+	for _, check := range r.checks {
+		if check.err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", check.name, check.err))
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("startup self-check failed:\n%w", errors.Join(errs...))
+}
+
+// log writes the outcome of every check as one structured log entry
+func (r *startupReport) log(log *slog.Logger) {
+	attrs := make([]any, 0, len(r.checks))
+	for _, check := range r.checks {
+		status := "ok"
+		if check.err != nil {
+			status = "failed: " + check.err.Error()
+		}
+		if check.detail != "" {
+			status += " (" + check.detail + ")"
+		}
+		attrs = append(attrs, slog.String(check.name, status))
+	}
+
+	if r.err() != nil {
+		log.Error("Startup self-check failed", slog.Group("checks", attrs...))
+		return
+	}
+	log.Info("Startup self-check passed", slog.Group("checks", attrs...))
+}
+
+// checkConfig validates the environment configuration before anything starts
+func checkConfig(report *startupReport, protocols helpers.HTTPProtocols) {
+	report.add("config", "environment variables", errors.Join(helpers.ValidateEnvConfig(), protocols.Validate()))
+
+	dir := os.TempDir()
+	report.add("temp_dir", dir, checkWritableDir(dir))
+}
+
+// checkWritableDir reports an error when no file can be created in dir
+func checkWritableDir(dir string) error {
+	file, err := os.CreateTemp(dir, "spotdb_selfcheck_")
+	if err != nil {
+		return fmt.Errorf("not writable: %w", err)
+	}
+	helpers.CloseResources(file, "self-check file")
+	return os.Remove(file.Name())
+}
+
+// checkDatabase verifies that the DuckDB extensions the server relies on are available and,
+// when automatic snapshots are configured, that their storage can be reached
+func checkDatabase(ctx context.Context, report *startupReport, db *database.DuckDB) {
+	required := db.RequiredExtensions()
+	report.add("extensions", strings.Join(required, ", "), db.CheckExtensions(ctx, required...))
+
+	location := helpers.GetAutoSnapshotLocation()
+	if location == "" || helpers.GetAutoSnapshotInterval() == 0 {
+		return
+	}
+	report.add("snapshot_store", location, checkSnapshotStore(ctx, location))
+}
+
+// checkSnapshotStore connects to the storage backend of the snapshot location and looks up
+// its prefix, which fails on unreachable endpoints, missing buckets and bad credentials
+func checkSnapshotStore(ctx context.Context, location string) error {
+	scheme, bucket, prefix, err := snapshot.ParseLocation(location)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, snapshotStoreCheckTimeout)
+	defer cancel()
+
+	store, err := snapshot.NewStore(ctx, scheme)
+	if err != nil {
+		return err
+	}
+	_, err = store.Exists(ctx, bucket, prefix)
+	return err
+}
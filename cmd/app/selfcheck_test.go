@@ -0,0 +1,135 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/aliengiraffe/spotdb/pkg/database"
+	"github.com/aliengiraffe/spotdb/pkg/helpers"
+)
+
+// checkErrors returns the error of every check in the report by name
+func checkErrors(report *startupReport) map[string]error {
+	errs := make(map[string]error, len(report.checks))
+	for _, check := range report.checks {
+		errs[check.name] = check.err
+	}
+	return errs
+}
+
+func TestStartupReport(t *testing.T) {
+	report := &startupReport{}
+	report.add("config", "environment variables", nil)
+	if err := report.err(); err != nil {
+		t.Fatalf("Expected no error when every check passed, got %v", err)
+	}
+
+	var logs bytes.Buffer
+	report.log(slog.New(slog.NewJSONHandler(&logs, nil)))
+	if !strings.Contains(logs.String(), "Startup self-check passed") || !strings.Contains(logs.String(), "ok (environment variables)") {
+		t.Errorf("Expected a passed summary, got %s", logs.String())
+	}
+
+	report.add("temp_dir", "/tmp", errors.New("not writable"))
+	report.add("extensions", "parquet", errors.New("parquet is not available"))
+	err := report.err()
+	if err == nil {
+		t.Fatal("Expected an error when a check failed")
+	}
+	for _, want := range []string{"temp_dir: not writable", "extensions: parquet is not available"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected the error to contain %q, got %v", want, err)
+		}
+	}
+	if strings.Contains(err.Error(), "config") {
+		t.Errorf("Expected passed checks to be left out of the error, got %v", err)
+	}
+
+	logs.Reset()
+	report.log(slog.New(slog.NewJSONHandler(&logs, nil)))
+	if !strings.Contains(logs.String(), "Startup self-check failed") || !strings.Contains(logs.String(), "failed: not writable (/tmp)") {
+		t.Errorf("Expected a failed summary naming the failure, got %s", logs.String())
+	}
+}
+
+func TestCheckConfig(t *testing.T) {
+	tests := []struct {
+		name       string
+		env        map[string]string
+		protocols  helpers.HTTPProtocols
+		wantFailed []string
+	}{
+		{name: "valid", env: map[string]string{"ENV_MAX_FILE_SIZE": "1024"}},
+		{name: "invalid environment variable", env: map[string]string{"ENV_MAX_FILE_SIZE": "0"}, wantFailed: []string{"config"}},
+		{name: "TLS key without certificate", protocols: helpers.HTTPProtocols{TLSKeyFile: "key.pem"}, wantFailed: []string{"config"}},
+		{name: "missing temp dir", env: map[string]string{"TMPDIR": filepath.Join("missing", "dir")}, wantFailed: []string{"temp_dir"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TMPDIR", t.TempDir())
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			report := &startupReport{}
+			checkConfig(report, tt.protocols)
+
+			errs := checkErrors(report)
+			for _, name := range []string{"config", "temp_dir"} {
+				err, ok := errs[name]
+				if !ok {
+					t.Fatalf("Expected a %s check, got %v", name, report.checks)
+				}
+				failed := slices.Contains(tt.wantFailed, name)
+				if (err != nil) != failed {
+					t.Errorf("Check %s error = %v, want failed %v", name, err, failed)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckDatabase(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	t.Setenv("ENV_AUTO_SNAPSHOT_LOCATION", "")
+	t.Setenv("ENV_AUTO_SNAPSHOT_INTERVAL", "")
+
+	ctx := context.Background()
+	db, err := database.NewDuckDB(ctx)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer helpers.CloseResources(db, "database")
+
+	report := &startupReport{}
+	checkDatabase(ctx, report, db)
+	if err := report.err(); err != nil {
+		t.Fatalf("Expected the database checks to pass, got %v", err)
+	}
+	if _, ok := checkErrors(report)["snapshot_store"]; ok {
+		t.Error("Expected no snapshot store check without automatic snapshots")
+	}
+
+	t.Setenv("ENV_AUTO_SNAPSHOT_LOCATION", "ftp://bucket/snapshot.db")
+	t.Setenv("ENV_AUTO_SNAPSHOT_INTERVAL", "1h")
+	report = &startupReport{}
+	checkDatabase(ctx, report, db)
+	if err := checkErrors(report)["snapshot_store"]; err == nil {
+		t.Error("Expected the snapshot store check to fail on an invalid location")
+	}
+}
+
+func TestCheckSnapshotStore(t *testing.T) {
+	for _, location := range []string{"bucket/snapshot.db", "ftp://bucket/snapshot.db", "s3://bucket"} {
+		if err := checkSnapshotStore(context.Background(), location); err == nil {
+			t.Errorf("Expected an error for snapshot location %q", location)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package api
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxActivityQueryLength is the number of bytes of query text shown in the admin activity
+const maxActivityQueryLength = 200
+
+// ConnectionCounter reports the number of open socket connections and their limit
+type ConnectionCounter interface {
+	ActiveConnections() int
+	MaxConnections() int
+}
+
+// handleAdminActivity godoc
+//
+//	@Summary		List in-flight queries
+//	@Description	List the queries currently being executed with their request IDs and start times, the number of open socket connections with their limit, and the number of uploads whose detected encoding differed from the declared one. Only served when ENV_ENABLE_ADMIN_API is true.
+//	@Tags			admin
+//	@Produce		json
+//	@Success		200	{object}	api.ActivityResponse	"Current activity"
+//	@Router			/admin/activity [get]
+func (s *Server) handleAdminActivity() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		now := time.Now()
+		active := s.db.ActiveQueries()
+
+		queries := make([]ActiveQueryInfo, 0, len(active))
+		for _, query := range active {
+			text, truncated := truncateQuery(query.Query, maxActivityQueryLength)
+			queries = append(queries, ActiveQueryInfo{
+				ID:        query.ID,
+				RequestID: query.RequestID,
+				StartedAt: query.StartedAt.UTC(),
+				RunningMs: now.Sub(query.StartedAt).Milliseconds(),
+				Query:     text,
+				Truncated: truncated,
+			})
+		}
+
+		socketConnections, socketMaxConnections := 0, 0
+		if s.connections != nil {
+			socketConnections = s.connections.ActiveConnections()
+			socketMaxConnections = s.connections.MaxConnections()
+		}
+
+		c.JSON(http.StatusOK, ActivityResponse{
+			Status:               "success",
+			Queries:              queries,
+			SocketConnections:    socketConnections,
+			SocketMaxConnections: socketMaxConnections,
+			EncodingMismatches:   s.encodingMismatches.Load(),
+		})
+	}
+}
+
+// maintenanceWindow records why and since when maintenance mode blocks writes
+type maintenanceWindow struct {
+	reason string
+	since  time.Time
+}
+
+// handleAdminMaintenance godoc
+//
+//	@Summary		Toggle maintenance mode
+//	@Description	Turn maintenance mode on or off without a restart. While it is on, uploads, table changes, modifying queries and snapshots are rejected with 503 and error code MAINTENANCE_MODE, reads continue normally. The flag is kept in memory and cleared by a restart. Only served when ENV_ENABLE_ADMIN_API is true.
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		api.MaintenanceRequest	true	"Whether maintenance mode is on and an optional reason"
+//	@Success		200		{object}	api.MaintenanceResponse	"Maintenance mode after the change"
+//	@Failure		400		{object}	api.ErrorResponse		"Invalid request"
+//	@Router			/admin/maintenance [post]
+func (s *Server) handleAdminMaintenance() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		log := getLoggerFromGinContext(c)
+
+		var payload MaintenanceRequest
+		if err := c.ShouldBindJSON(&payload); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Status:  "error",
+				Message: "Invalid maintenance request: " + err.Error(),
+			})
+			return
+		}
+
+		if !*payload.Enabled {
+			if previous := s.maintenance.Swap(nil); previous != nil {
+				log.Info("Maintenance mode cleared", slog.Duration("duration", time.Since(previous.since)))
+			}
+			c.JSON(http.StatusOK, MaintenanceResponse{Status: "success", Enabled: false})
+			return
+		}
+
+		window := &maintenanceWindow{reason: strings.TrimSpace(payload.Reason), since: time.Now().UTC()}
+		// Turning it on again only updates the reason, the window keeps its start time
+		if previous := s.maintenance.Load(); previous != nil {
+			window.since = previous.since
+		}
+		s.maintenance.Store(window)
+		log.Info("Maintenance mode set", slog.String("reason", window.reason))
+
+		c.JSON(http.StatusOK, MaintenanceResponse{
+			Status:  "success",
+			Enabled: true,
+			Reason:  window.reason,
+			Since:   &window.since,
+		})
+	}
+}
+
+// handleRequestLogs godoc
+//
+//	@Summary		Get the logs of a request
+//	@Description	Get the log entries captured for a request by its X-Request-ID, kept for ENV_REQUEST_LOG_TTL after the last entry. Only served when ENV_ENABLE_ADMIN_API is true and captured when ENV_CAPTURE_REQUEST_LOGS is true.
+//	@Tags			admin
+//	@Produce		json
+//	@Param			id	path		string						true	"Request ID"
+//	@Success		200	{object}	api.RequestLogsResponse		"Captured log entries"
+//	@Failure		404	{object}	api.ErrorResponse			"Capture disabled or no logs for the request"
+//	@Router			/requests/{id}/logs [get]
+func (s *Server) handleRequestLogs() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if s.requestLogs == nil {
+			c.JSON(http.StatusNotFound, ErrorResponse{
+				Status:  "error",
+				Message: "Request log capture is disabled, set ENV_CAPTURE_REQUEST_LOGS=true to enable it",
+			})
+			return
+		}
+
+		requestID := c.Param("id")
+		entries, dropped, ok := s.requestLogs.Entries(requestID)
+		if !ok {
+			c.JSON(http.StatusNotFound, ErrorResponse{
+				Status:  "error",
+				Message: fmt.Sprintf("No logs captured for request '%s', they may have expired", requestID),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, RequestLogsResponse{
+			Status:    "success",
+			RequestID: requestID,
+			Entries:   entries,
+			Dropped:   dropped,
+		})
+	}
+}
+
+// truncateQuery shortens the query to at most maxLen bytes without splitting a character
+func truncateQuery(query string, maxLen int) (string, bool) {
+	if len(query) <= maxLen {
+		return query, false
+	}
+
+	cut := maxLen
+	for cut > 0 && !utf8.RuneStart(query[cut]) {
+		cut--
+	}
+	return query[:cut], true
+}
@@ -0,0 +1,206 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// fakeConnectionCounter reports a fixed number of socket connections out of a limit of 10
+type fakeConnectionCounter int
+
+func (f fakeConnectionCounter) ActiveConnections() int {
+	return int(f)
+}
+
+func (f fakeConnectionCounter) MaxConnections() int {
+	return 10
+}
+
+func TestHandleAdminActivity(t *testing.T) {
+	t.Run("disabled by default", func(t *testing.T) {
+		t.Setenv("ENV_ENABLE_ADMIN_API", "")
+		s, _ := newTablesTestServer(t)
+
+		rec := serveJSON(s, http.MethodGet, "/api/v1/admin/activity", nil)
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("Expected status %d, got %d", http.StatusNotFound, rec.Code)
+		}
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		t.Setenv("ENV_ENABLE_ADMIN_API", "true")
+		s, db := newTablesTestServer(t)
+		s.connections = fakeConnectionCounter(3)
+		s.setupRouter(slog.New(slog.NewTextHandler(os.Stderr, nil)))
+
+		rec := serveJSON(s, http.MethodGet, "/api/v1/admin/activity", nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+		}
+
+		var resp ActivityResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+		if resp.Status != "success" || resp.SocketConnections != 3 || resp.SocketMaxConnections != 10 {
+			t.Errorf("Unexpected response: %+v", resp)
+		}
+		if len(resp.Queries) != len(db.ActiveQueries()) {
+			t.Errorf("Expected %d queries, got %d", len(db.ActiveQueries()), len(resp.Queries))
+		}
+	})
+}
+
+func TestHandleRequestLogs(t *testing.T) {
+	t.Setenv("ENV_ENABLE_ADMIN_API", "true")
+
+	t.Run("capture disabled", func(t *testing.T) {
+		t.Setenv("ENV_CAPTURE_REQUEST_LOGS", "")
+		s, _ := newTablesTestServer(t)
+
+		rec := serveJSON(s, http.MethodGet, "/api/v1/requests/import-42/logs", nil)
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("Expected status %d, got %d", http.StatusNotFound, rec.Code)
+		}
+	})
+
+	t.Run("admin API disabled", func(t *testing.T) {
+		t.Setenv("ENV_ENABLE_ADMIN_API", "")
+		t.Setenv("ENV_CAPTURE_REQUEST_LOGS", "true")
+		s, _ := newTablesTestServer(t)
+
+		if s.requestLogs != nil {
+			t.Error("Expected no request logs to be captured without the admin endpoints")
+		}
+	})
+
+	t.Run("capture enabled", func(t *testing.T) {
+		t.Setenv("ENV_CAPTURE_REQUEST_LOGS", "true")
+		s, _ := newTablesTestServer(t)
+
+		body, _ := json.Marshal(map[string]any{"query": "SELECT * FROM sales"})
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/query", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(requestIDHeader, "import-42")
+		rec := httptest.NewRecorder()
+		s.Router().ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+		}
+
+		rec = serveJSON(s, http.MethodGet, "/api/v1/requests/import-42/logs", nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+		}
+
+		var resp RequestLogsResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+		if resp.Status != "success" || resp.RequestID != "import-42" || len(resp.Entries) == 0 {
+			t.Fatalf("Unexpected response: %+v", resp)
+		}
+		for _, entry := range resp.Entries {
+			if entry.Message == "" || entry.Time.IsZero() {
+				t.Errorf("Unexpected entry: %+v", entry)
+			}
+		}
+
+		rec = serveJSON(s, http.MethodGet, "/api/v1/requests/unknown/logs", nil)
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("Expected status %d, got %d", http.StatusNotFound, rec.Code)
+		}
+	})
+}
+
+func TestHandleAdminMaintenance(t *testing.T) {
+	t.Setenv("ENV_ENABLE_ADMIN_API", "true")
+	s, _ := newTablesTestServer(t)
+
+	rec := serveJSON(s, http.MethodPost, "/api/v1/admin/maintenance", map[string]any{"enabled": true, "reason": "migration"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	var resp MaintenanceResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if !resp.Enabled || resp.Reason != "migration" || resp.Since == nil {
+		t.Errorf("Unexpected response: %+v", resp)
+	}
+
+	tests := []struct {
+		name           string
+		method         string
+		url            string
+		body           any
+		expectedStatus int
+	}{
+		{name: "read query", method: http.MethodPost, url: "/api/v1/query", body: map[string]any{"query": "SELECT * FROM sales"}, expectedStatus: http.StatusOK},
+		{name: "list tables", method: http.MethodGet, url: "/api/v1/tables", expectedStatus: http.StatusOK},
+		{name: "modifying query", method: http.MethodPost, url: "/api/v1/query", body: map[string]any{"query": "DELETE FROM sales"}, expectedStatus: http.StatusServiceUnavailable},
+		{name: "create table", method: http.MethodPost, url: "/api/v1/tables", body: map[string]any{"table_name": "north", "query": "SELECT * FROM sales"}, expectedStatus: http.StatusServiceUnavailable},
+		{name: "drop tables", method: http.MethodDelete, url: "/api/v1/tables?prefix=sales&confirm=true", expectedStatus: http.StatusServiceUnavailable},
+		{name: "snapshot", method: http.MethodPost, url: "/api/v1/snapshot", body: map[string]any{"bucket": "backups"}, expectedStatus: http.StatusServiceUnavailable},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := serveJSON(s, tc.method, tc.url, tc.body)
+			if rec.Code != tc.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tc.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if tc.expectedStatus != http.StatusServiceUnavailable {
+				return
+			}
+			var body ErrorResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("Failed to parse response body: %v", err)
+			}
+			if body.Code != "MAINTENANCE_MODE" || !strings.Contains(body.Message, "migration") {
+				t.Errorf("Expected MAINTENANCE_MODE with the reason, got %+v", body)
+			}
+		})
+	}
+
+	if rec := serveJSON(s, http.MethodPost, "/api/v1/admin/maintenance", map[string]any{"enabled": false}); rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d clearing maintenance mode, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	if rec := serveJSON(s, http.MethodPost, "/api/v1/query", map[string]any{"query": "DELETE FROM sales WHERE id = 1"}); rec.Code != http.StatusOK {
+		t.Errorf("Expected writes to succeed after maintenance mode is cleared, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := serveJSON(s, http.MethodPost, "/api/v1/admin/maintenance", map[string]any{}); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d without enabled, got %d", http.StatusBadRequest, rec.Code)
+	}
+}
+
+func TestTruncateQuery(t *testing.T) {
+	tests := []struct {
+		name          string
+		query         string
+		maxLen        int
+		wantQuery     string
+		wantTruncated bool
+	}{
+		{name: "short query", query: "SELECT 1", maxLen: 10, wantQuery: "SELECT 1"},
+		{name: "exact length", query: "SELECT 1", maxLen: 8, wantQuery: "SELECT 1"},
+		{name: "long query", query: "SELECT * FROM sales", maxLen: 8, wantQuery: "SELECT *", wantTruncated: true},
+		{name: "multibyte character", query: "SELECT 'é'", maxLen: 9, wantQuery: "SELECT '", wantTruncated: true},
+		{name: "long multibyte query", query: strings.Repeat("é", 10), maxLen: 5, wantQuery: "éé", wantTruncated: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, truncated := truncateQuery(tc.query, tc.maxLen)
+			if got != tc.wantQuery || truncated != tc.wantTruncated {
+				t.Errorf("truncateQuery() = %q, %v, want %q, %v", got, truncated, tc.wantQuery, tc.wantTruncated)
+			}
+		})
+	}
+}
@@ -0,0 +1,250 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aliengiraffe/spotdb/pkg/helpers"
+	textunicode "golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// MaxCollectedErrors is the number of issues returned by collect_all_errors, issues past
+// the cap are still counted
+const MaxCollectedErrors = 1000
+
+// errorCollector accumulates the distinct issues found while scanning a file
+type errorCollector struct {
+	errors []CSVError
+	seen   map[string]bool
+	count  int
+}
+
+// add records the issue unless the same code was already reported for the line and
+// column, keeping it only while the cap is not reached
+func (c *errorCollector) add(issue CSVError) {
+	key := fmt.Sprintf("%s:%d:%s", issue.Code, issue.Details.Line, issue.Details.Column)
+	if c.seen[key] {
+		return
+	}
+	c.seen[key] = true
+	c.count++
+	if len(c.errors) < MaxCollectedErrors {
+		c.errors = append(c.errors, issue)
+	}
+}
+
+// report returns the collected issues as a validation report
+func (c *errorCollector) report(rowsScanned int) *CSVValidationReport {
+	errs := c.errors
+	if errs == nil {
+		errs = []CSVError{}
+	}
+	return &CSVValidationReport{
+		Status:      "success",
+		Valid:       c.count == 0,
+		RowsScanned: rowsScanned,
+		IssueCount:  c.count,
+		Errors:      errs,
+		Truncated:   c.count > len(c.errors),
+	}
+}
+
+// collectCSVErrors scans the whole uploaded file without importing it and reports every
+// structural, encoding and security issue found, up to MaxCollectedErrors. Failures to
+// open or recognize the file are returned as errors like a regular upload.
+func (s *Server) collectCSVErrors(ctx context.Context, fileHeader *multipart.FileHeader, hasHeader bool, encoding string, skipRows int, ragged RaggedRows) (*CSVValidationReport, []CSVError, error) {
+	log := helpers.GetLoggerFromContext(ctx)
+
+	file, openErrors, err := s.openValidatedUpload(ctx, fileHeader, encoding, skipRows, ragged)
+	if err != nil {
+		return nil, openErrors, err
+	}
+	defer helpers.CloseResources(file, "uploaded file")
+
+	collector := &errorCollector{seen: make(map[string]bool)}
+
+	// A file over the limit could never be imported, so it is not scanned at all
+	if maxSize := helpers.GetMaxFileSize(); fileHeader.Size > maxSize {
+		collector.add(CSVError{
+			Code:    "FILE_SIZE_EXCEEDED",
+			Message: fmt.Sprintf("file too large (max %dGB)", maxSize/(1024*1024*1024)),
+			Details: CSVErrorDetail{
+				Line:       0,
+				Suggestion: suggestionMap["FILE_SIZE_EXCEEDED"],
+			},
+		})
+		return collector.report(0), nil, nil
+	}
+
+	reader := bufio.NewReaderSize(file, MaxSampleSize)
+	if !skipMimeValidation() {
+		// A short sample is expected for small files, read errors surface while scanning
+		sample, _ := reader.Peek(MaxSampleSize)
+		if encodingErr := s.validateEncodingFromData(ctx, sample, encoding); encodingErr != nil {
+			s.recordEncodingMismatch(ctx, fileHeader.Filename, encodingErr)
+			// The rest of the file cannot be read reliably in the wrong encoding
+			collector.add(CSVError{
+				Code:    "INVALID_ENCODING",
+				Message: "invalid encoding: " + encodingErr.Error(),
+				Details: CSVErrorDetail{
+					Line:       0,
+					Suggestion: suggestionMap["INVALID_ENCODING"],
+				},
+			})
+			return collector.report(0), nil, nil
+		}
+	}
+
+	var decoded io.Reader = reader
+	if decoder := transcodingEncoding(encoding); decoder != nil {
+		decoded = transform.NewReader(reader, decoder.NewDecoder())
+	} else if isUTF16EncodingSpecified(strings.ToLower(encoding)) {
+		decoded = transform.NewReader(reader, textunicode.UTF16(textunicode.LittleEndian, textunicode.UseBOM).NewDecoder())
+	}
+
+	rowsScanned, err := scanCSVIssues(decoded, skipRows, ragged, hasHeader, isUTF8EncodingSpecified(strings.ToLower(encoding)), collector)
+	if err != nil {
+		log.Info("Error reading uploaded file", slog.Any("error", err))
+		validationError := CSVError{
+			Code:    "CSV_VALIDATION_ERROR",
+			Message: fmt.Sprintf("Failed to read uploaded file: %v", err),
+			Details: CSVErrorDetail{
+				Line:       0,
+				Suggestion: suggestionMap["CSV_VALIDATION_ERROR"],
+			},
+		}
+		return nil, []CSVError{validationError}, fmt.Errorf("failed to read uploaded file: %w", err)
+	}
+
+	log.Info("Collected CSV validation issues",
+		slog.Int("rows_scanned", rowsScanned),
+		slog.Int("issue_count", collector.count),
+	)
+	return collector.report(rowsScanned), nil, nil
+}
+
+// scanCSVIssues reads every record after skipRows lines and adds the issues found to the
+// collector, returning the number of data rows read. Line numbers are reported relative to
+// the uploaded file. Invalid UTF-8 is only reported when checkUTF8 is set, as transcoded
+// input is always valid.
+func scanCSVIssues(src io.Reader, skipRows int, ragged RaggedRows, hasHeader, checkUTF8 bool, collector *errorCollector) (int, error) {
+	reader := bufio.NewReaderSize(src, MaxSampleSize)
+	for range skipRows {
+		if _, err := reader.ReadString('\n'); err != nil {
+			if errors.Is(err, io.EOF) {
+				return 0, nil
+			}
+			return 0, err
+		}
+	}
+
+	// A short sample is expected for small files, read errors surface again while parsing
+	sample, _ := reader.Peek(MaxSampleSize)
+	delimiter, err := DetectDelimiterFromData(sample)
+	if err != nil {
+		delimiter = ','
+	}
+
+	parser := csv.NewReader(reader)
+	parser.Comma = delimiter
+	// Field counts are compared below so every mismatch is reported with both counts
+	parser.FieldsPerRecord = -1
+
+	var columnMap map[int]string
+	expected, rows := 0, 0
+	for {
+		record, err := parser.Read()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			collector.add(structureError(parseErr.StartLine+skipRows, parseErr.Err.Error()))
+			continue
+		}
+		if err != nil {
+			return rows, err
+		}
+
+		line, _ := parser.FieldPos(0)
+		line += skipRows
+		if expected != 0 || !hasHeader {
+			rows++
+		}
+
+		if expected == 0 {
+			expected = len(record)
+			if ragged.TrimTrailingDelimiter && expected > 1 && record[expected-1] == "" {
+				expected--
+			}
+			if hasHeader {
+				columnMap = make(map[int]string, len(record))
+				for i, name := range record {
+					columnMap[i] = name
+				}
+			}
+		} else if !ragged.accepts(len(record), expected, record[len(record)-1] == "") {
+			collector.add(structureError(line, fmt.Sprintf(ErrInconsistentColumns, line, len(record), expected)))
+		}
+
+		for i, field := range record {
+			fieldLine, _ := parser.FieldPos(i)
+			fieldLine += skipRows
+			column := columnName(columnMap, i)
+
+			if checkUTF8 && !utf8.ValidString(field) {
+				collector.add(CSVError{
+					Code:    "INVALID_ENCODING",
+					Message: "invalid encoding: field is not valid UTF-8",
+					Details: CSVErrorDetail{
+						Line:       fieldLine,
+						Column:     column,
+						FoundValue: strings.ToValidUTF8(field, "�"),
+						Suggestion: suggestionMap["INVALID_ENCODING"],
+					},
+				})
+				continue
+			}
+
+			if isSafe, issue, _ := helpers.CSVRowCheckDetailed([]byte(field), fieldLine, nil); !isSafe {
+				if issue == nil {
+					issue = &helpers.ValidationIssue{Line: fieldLine}
+				}
+				// The field was checked on its own, report it with its column and full value
+				issue.Column = column
+				issue.Value = field
+				collector.add(securityValidationError(issue))
+			}
+		}
+	}
+}
+
+// structureError builds the error reported for a malformed record
+func structureError(line int, message string) CSVError {
+	return CSVError{
+		Code:    "INVALID_CSV_STRUCTURE",
+		Message: "invalid CSV structure: " + message,
+		Details: CSVErrorDetail{
+			Line:       line,
+			Suggestion: suggestionMap["INVALID_CSV_STRUCTURE"],
+		},
+	}
+}
+
+// columnName returns the header name of the column, or its position without a header
+func columnName(columnMap map[int]string, index int) string {
+	if name, ok := columnMap[index]; ok {
+		return name
+	}
+	return fmt.Sprintf("Column %d", index+1)
+}
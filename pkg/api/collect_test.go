@@ -0,0 +1,176 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestUploadCollectAllErrors(t *testing.T) {
+	s, db := newTablesTestServer(t)
+
+	// The sample checked up front is valid, the issues come later in the file
+	var csvData strings.Builder
+	csvData.WriteString("title line\nid,name,note\n")
+	for i := 1; i <= 3000; i++ {
+		fmt.Fprintf(&csvData, "%d,user%d,ok\n", i, i)
+	}
+	csvData.WriteString("3001,bob\n3002,carol,=SUM(A1:A2)\n3003,dave,fine,extra\n3004,erin,ok\n")
+
+	fields := map[string]string{
+		"table_name":         "collected",
+		"has_header":         "true",
+		"skip_rows":          "1",
+		"collect_all_errors": "true",
+	}
+	req := newMultipartRequest(t, "/api/v1/upload", fields, "collected.csv", []byte(csvData.String()))
+	rec := httptest.NewRecorder()
+	s.Router().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d, body: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+
+	var report CSVValidationReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+
+	if report.Valid || report.Truncated {
+		t.Errorf("Expected an invalid, untruncated report, got %+v", report)
+	}
+	if report.RowsScanned != 3004 {
+		t.Errorf("Expected 3004 rows scanned, got %d", report.RowsScanned)
+	}
+
+	expected := []struct {
+		code   string
+		line   int
+		column string
+	}{
+		{"INVALID_CSV_STRUCTURE", 3003, ""},
+		{"SECURITY_VALIDATION_FAILED", 3004, "note"},
+		{"INVALID_CSV_STRUCTURE", 3005, ""},
+	}
+	if report.IssueCount != len(expected) || len(report.Errors) != len(expected) {
+		t.Fatalf("Expected %d issues, got %d: %+v", len(expected), report.IssueCount, report.Errors)
+	}
+	for i, want := range expected {
+		got := report.Errors[i]
+		if got.Code != want.code || got.Details.Line != want.line || got.Details.Column != want.column {
+			t.Errorf("Expected issue %d to be %s on line %d column %q, got %s on line %d column %q",
+				i, want.code, want.line, want.column, got.Code, got.Details.Line, got.Details.Column)
+		}
+	}
+	if report.Errors[1].Details.FoundValue != "=SUM(A1:A2)" {
+		t.Errorf("Expected the formula as found value, got %q", report.Errors[1].Details.FoundValue)
+	}
+
+	// Collecting errors must not import the file
+	result, err := db.ExecuteQuery(context.Background(), "SELECT COUNT(*) AS table_count FROM information_schema.tables WHERE table_name = 'collected'")
+	if err != nil {
+		t.Fatalf("Failed to list tables: %v", err)
+	}
+	if count := result.Results[0]["table_count"]; count != int64(0) {
+		t.Errorf("Expected no table to be created, got %v", count)
+	}
+}
+
+func TestUploadCollectAllErrorsValidFile(t *testing.T) {
+	s, _ := newTablesTestServer(t)
+
+	fields := map[string]string{"has_header": "true", "collect_all_errors": "true"}
+	req := newMultipartRequest(t, "/api/v1/upload", fields, "valid.csv", []byte("id,name\n1,alice\n2,bob\n"))
+	rec := httptest.NewRecorder()
+	s.Router().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d, body: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+
+	var report CSVValidationReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if !report.Valid || report.IssueCount != 0 || len(report.Errors) != 0 || report.RowsScanned != 2 {
+		t.Errorf("Expected a valid report with 2 rows, got %+v", report)
+	}
+}
+
+func TestUploadCollectAllErrorsFileTooLarge(t *testing.T) {
+	t.Setenv("ENV_MAX_FILE_SIZE", "1024")
+	s, _ := newTablesTestServer(t)
+
+	var csvData strings.Builder
+	csvData.WriteString("id,name\n")
+	for i := 1; i <= 200; i++ {
+		fmt.Fprintf(&csvData, "%d,user%d\n", i, i)
+	}
+	csvData.WriteString("201\n")
+
+	fields := map[string]string{"has_header": "true", "collect_all_errors": "true"}
+	req := newMultipartRequest(t, "/api/v1/upload", fields, "large.csv", []byte(csvData.String()))
+	rec := httptest.NewRecorder()
+	s.Router().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d, body: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+
+	var report CSVValidationReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	// The file is not scanned, so the malformed last row is not reported
+	if report.Valid || report.RowsScanned != 0 || len(report.Errors) != 1 || report.Errors[0].Code != "FILE_SIZE_EXCEEDED" {
+		t.Errorf("Expected a single FILE_SIZE_EXCEEDED issue without scanning, got %+v", report)
+	}
+}
+
+func TestUploadCollectAllErrorsShortFile(t *testing.T) {
+	s, _ := newTablesTestServer(t)
+
+	// Too short for the encoding detector to decide, but valid UTF-8
+	fields := map[string]string{"has_header": "false", "collect_all_errors": "true"}
+	req := newMultipartRequest(t, "/api/v1/upload", fields, "short.csv", []byte("~{}"))
+	rec := httptest.NewRecorder()
+	s.Router().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d, body: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+
+	var report CSVValidationReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if !report.Valid || report.IssueCount != 0 || report.RowsScanned != 1 {
+		t.Errorf("Expected a valid report with 1 row, got %+v", report)
+	}
+}
+
+func TestScanCSVIssuesCap(t *testing.T) {
+	var csvData strings.Builder
+	csvData.WriteString("a,b\n")
+	for i := 0; i < MaxCollectedErrors+10; i++ {
+		fmt.Fprintf(&csvData, "%d\n", i)
+	}
+
+	collector := &errorCollector{seen: make(map[string]bool)}
+	rows, err := scanCSVIssues(strings.NewReader(csvData.String()), 0, RaggedRows{}, true, true, collector)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	report := collector.report(rows)
+	if report.IssueCount != MaxCollectedErrors+10 {
+		t.Errorf("Expected %d issues counted, got %d", MaxCollectedErrors+10, report.IssueCount)
+	}
+	if len(report.Errors) != MaxCollectedErrors || !report.Truncated {
+		t.Errorf("Expected %d truncated errors, got %d (truncated %v)", MaxCollectedErrors, len(report.Errors), report.Truncated)
+	}
+}
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+
+	"github.com/aliengiraffe/spotdb/pkg/helpers"
+)
+
+// readCSVHeader reads the header row of the copied CSV file, after the first skipRows lines
+func readCSVHeader(csvPath string, skipRows int) ([]string, error) {
+	file, err := os.Open(csvPath)
+	if err != nil {
+		return nil, err
+	}
+	defer helpers.CloseResources(file, "header file")
+
+	reader := bufio.NewReaderSize(file, helpers.GetBufferSize())
+	if _, err := copyLeadingRows(io.Discard, reader, skipRows, math.MaxInt64); err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, MaxSampleSize)
+	n, err := io.ReadFull(reader, data)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+
+	delimiter, err := DetectDelimiterFromData(data[:n])
+	if err != nil {
+		return nil, err
+	}
+	records, err := sampleCSVRecordsFromData(data[:n], delimiter, 1, true)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("file has no header row")
+	}
+	return records[0], nil
+}
+
+// normalizeColumnName approximates the name DuckDB's normalize_names gives a header column:
+// accents are stripped, whitespace becomes an underscore, other punctuation is dropped and
+// the result is lowercased. Empty names are returned as is, DuckDB numbers them by position.
+func normalizeColumnName(name string) string {
+	var b strings.Builder
+	pendingSpace := false
+	for _, r := range norm.NFD.String(strings.TrimSpace(name)) {
+		switch {
+		case unicode.IsSpace(r):
+			pendingSpace = true
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'):
+			if pendingSpace && b.Len() > 0 {
+				b.WriteByte('_')
+			}
+			pendingSpace = false
+			b.WriteRune(unicode.ToLower(r))
+		}
+	}
+
+	normalized := b.String()
+	if normalized != "" && normalized[0] >= '0' && normalized[0] <= '9' {
+		normalized = "_" + normalized
+	}
+	return normalized
+}
+
+// collidingColumns groups the positions of header columns that normalize to the same name
+func collidingColumns(header []string) [][]int {
+	groups := make(map[string][]int)
+	var order []string
+	for i, name := range header {
+		normalized := normalizeColumnName(name)
+		if normalized == "" {
+			continue
+		}
+		if _, ok := groups[normalized]; !ok {
+			order = append(order, normalized)
+		}
+		groups[normalized] = append(groups[normalized], i)
+	}
+
+	var colliding [][]int
+	for _, normalized := range order {
+		if len(groups[normalized]) > 1 {
+			colliding = append(colliding, groups[normalized])
+		}
+	}
+	return colliding
+}
+
+// quotedColumns lists the names at the given positions as 'a', 'b'
+func quotedColumns(names []string, indexes []int) string {
+	quoted := make([]string, len(indexes))
+	for i, index := range indexes {
+		quoted[i] = fmt.Sprintf("'%s'", names[index])
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// columnNameCollisions returns a COLUMN_NAME_COLLISION warning for every group of header
+// columns that normalize to the same name, listing the originals and the names DuckDB
+// imported them as. imported holds the table's column names in header order.
+func columnNameCollisions(header, imported []string, headerLine int) []CSVError {
+	var collisions []CSVError
+	for _, indexes := range collidingColumns(header) {
+		originals := quotedColumns(header, indexes)
+		collisions = append(collisions, CSVError{
+			Code: "COLUMN_NAME_COLLISION",
+			Message: fmt.Sprintf("Columns %s normalize to the same name and were imported as %s",
+				originals, quotedColumns(imported, indexes)),
+			Details: CSVErrorDetail{
+				Line:       headerLine,
+				Column:     originals,
+				Suggestion: suggestionMap["COLUMN_NAME_COLLISION"],
+			},
+		})
+	}
+	return collisions
+}
+
+// columnCountMismatchError is returned when the table has a different number of columns
+// than the header, so columns may have been merged or dropped while normalizing names
+func columnCountMismatchError(header []string, importedCount, headerLine int) CSVError {
+	message := fmt.Sprintf("Header has %d columns but the table was imported with %d", len(header), importedCount)
+	var groups []string
+	for _, indexes := range collidingColumns(header) {
+		groups = append(groups, quotedColumns(header, indexes))
+	}
+	if len(groups) > 0 {
+		message += fmt.Sprintf(", colliding columns: %s", strings.Join(groups, "; "))
+	}
+	return CSVError{
+		Code:    "COLUMN_NAME_COLLISION",
+		Message: message,
+		Details: CSVErrorDetail{
+			Line:       headerLine,
+			Column:     strings.Join(groups, "; "),
+			Suggestion: suggestionMap["COLUMN_NAME_COLLISION"],
+		},
+	}
+}
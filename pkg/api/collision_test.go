@@ -0,0 +1,50 @@
+package api
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeColumnName(t *testing.T) {
+	tests := map[string]string{
+		"First Name": "first_name",
+		" x ":        "x",
+		"a  b":       "a_b",
+		"a-b":        "ab",
+		"a.b":        "ab",
+		"1st":        "_1st",
+		"Ünï":        "uni",
+		"a__b":       "a__b",
+		"":           "",
+	}
+	for name, want := range tests {
+		if got := normalizeColumnName(name); got != want {
+			t.Errorf("normalizeColumnName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestColumnNameCollisions(t *testing.T) {
+	header := []string{"ID", "a-b", "id", "ab", "name"}
+	imported := []string{"id", "ab", "id_1", "ab_1", "_name"}
+
+	collisions := columnNameCollisions(header, imported, 3)
+	if len(collisions) != 2 {
+		t.Fatalf("expected 2 collisions, got %+v", collisions)
+	}
+	if collisions[0].Details.Column != "'ID', 'id'" || collisions[1].Details.Column != "'a-b', 'ab'" {
+		t.Errorf("unexpected colliding columns: %q and %q", collisions[0].Details.Column, collisions[1].Details.Column)
+	}
+	if collisions[0].Details.Line != 3 {
+		t.Errorf("expected line 3, got %d", collisions[0].Details.Line)
+	}
+
+	if collisions := columnNameCollisions([]string{"a", "b"}, []string{"a", "b"}, 1); len(collisions) != 0 {
+		t.Errorf("expected no collisions, got %+v", collisions)
+	}
+
+	mismatch := columnCountMismatchError(header, 4, 1)
+	if mismatch.Code != "COLUMN_NAME_COLLISION" || !strings.Contains(mismatch.Message, "'ID', 'id'; 'a-b', 'ab'") {
+		t.Errorf("unexpected mismatch error: %+v", mismatch)
+	}
+}
@@ -20,7 +20,8 @@ const (
 	MinSampleLines = 3
 	// MaxSampleSize is the maximum number of bytes to read for structure validation
 	MaxSampleSize = 16 * 1024 // 16KB
-	// MinColumnCount is the minimum number of columns required for a valid CSV
+	// MinColumnCount is the minimum number of columns a delimiter must split lines into
+	// to be detected
 	MinColumnCount = 2
 	// SampleSizeForDelimiter is the number of lines to read when detecting delimiter
 	SampleSizeForDelimiter = 5
@@ -30,6 +31,7 @@ const (
 	ErrFailedResetPosition = "failed to reset file position: %v"
 	ErrNoData              = "file contains no data"
 	ErrInconsistentColumns = "inconsistent column count on line %d: got %d, expected %d"
+	ErrTooFewColumns       = "found %d columns, at least %d required"
 	ErrDelimiterDetection  = "delimiter detection failed: %v"
 	ErrReadSample          = "failed to read file sample: %v"
 	ErrReadingSample       = "error reading sample: %v"
@@ -203,8 +205,10 @@ func calculateEmptyFieldsRatio(records [][]string) float64 {
 	return float64(emptyFields) / float64(totalFields)
 }
 
-// ValidateCSVFileFromData performs validation on CSV data provided as bytes
-func ValidateCSVFileFromData(data []byte) (*CSVValidationResult, error) {
+// ValidateCSVFileFromData performs validation on CSV data provided as bytes, requiring
+// at least minColumns columns and the column count of the first record in every other
+// record, unless ragged tolerates the difference
+func ValidateCSVFileFromData(data []byte, minColumns int, ragged RaggedRows) (*CSVValidationResult, error) {
 	// Initialize the result
 	result, err := initializeValidationResultFromData(data)
 	if err != nil {
@@ -212,7 +216,7 @@ func ValidateCSVFileFromData(data []byte) (*CSVValidationResult, error) {
 	}
 
 	// Sample records for validation from the data
-	records, err := sampleCSVRecordsFromData(data, result.Delimiter, MaxSampleLines)
+	records, err := sampleCSVRecordsFromData(data, result.Delimiter, MaxSampleLines, ragged.strict())
 	if err != nil {
 		result.Valid = false
 		result.ErrorMessage = fmt.Sprintf(ErrCSVFormatValidation, err)
@@ -229,9 +233,19 @@ func ValidateCSVFileFromData(data []byte) (*CSVValidationResult, error) {
 	// Set basic metrics and validate structure
 	result.ColumnCount = len(records[0])
 	result.SampleRows = len(records)
+	// A trailing delimiter on the header is trimmed like on the other records
+	if ragged.TrimTrailingDelimiter && result.ColumnCount > 1 && records[0][result.ColumnCount-1] == "" {
+		result.ColumnCount--
+	}
+
+	if result.ColumnCount < minColumns {
+		result.Valid = false
+		result.ErrorMessage = fmt.Sprintf(ErrTooFewColumns, result.ColumnCount, minColumns)
+		return result, nil
+	}
 
 	// Perform content validation
-	validateCSVContent(records, result)
+	validateCSVContent(records, result, ragged)
 
 	return result, nil
 }
@@ -256,8 +270,9 @@ func initializeValidationResultFromData(data []byte) (*CSVValidationResult, erro
 	return result, nil
 }
 
-// sampleCSVRecordsFromData parses a limited number of CSV records for validation from bytes
-func sampleCSVRecordsFromData(data []byte, delimiter rune, maxLines int) ([][]string, error) {
+// sampleCSVRecordsFromData parses a limited number of CSV records for validation from bytes.
+// With strictFields a record with another field count than the first one is an error.
+func sampleCSVRecordsFromData(data []byte, delimiter rune, maxLines int, strictFields bool) ([][]string, error) {
 	// Limit data size if needed
 	sampleSize := MaxSampleSize
 	if len(data) > sampleSize {
@@ -268,6 +283,10 @@ func sampleCSVRecordsFromData(data []byte, delimiter rune, maxLines int) ([][]st
 	csvReader := csv.NewReader(bytes.NewReader(data))
 	csvReader.Comma = delimiter
 	csvReader.LazyQuotes = false // Strict mode for validation
+	if !strictFields {
+		// Field counts are compared by validateColumnConsistency
+		csvReader.FieldsPerRecord = -1
+	}
 
 	// Read sampled records
 	var records [][]string
@@ -286,9 +305,9 @@ func sampleCSVRecordsFromData(data []byte, delimiter rune, maxLines int) ([][]st
 }
 
 // validateCSVContent performs various validations on the CSV content
-func validateCSVContent(records [][]string, result *CSVValidationResult) {
+func validateCSVContent(records [][]string, result *CSVValidationResult, ragged RaggedRows) {
 	// Verify consistent column count
-	validateColumnConsistency(records, result)
+	validateColumnConsistency(records, result, ragged)
 
 	// Check for quotes in the data
 	result.HasQuotes = hasQuotedFields(records)
@@ -297,10 +316,11 @@ func validateCSVContent(records [][]string, result *CSVValidationResult) {
 	result.HasHeader = detectHeader(records)
 }
 
-// validateColumnConsistency verifies all rows have the same number of columns
-func validateColumnConsistency(records [][]string, result *CSVValidationResult) {
+// validateColumnConsistency verifies all rows have the same number of columns, or a
+// number ragged tolerates
+func validateColumnConsistency(records [][]string, result *CSVValidationResult, ragged RaggedRows) {
 	for i, record := range records {
-		if len(record) != result.ColumnCount {
+		if !ragged.accepts(len(record), result.ColumnCount, record[len(record)-1] == "") {
 			result.Valid = false
 			result.ErrorMessage = fmt.Sprintf(ErrInconsistentColumns,
 				i+1, len(record), result.ColumnCount)
@@ -42,12 +42,12 @@ func TestCopyFileDataSizeExceeded(t *testing.T) {
 	defer func() { helpers.CopyWithMaxSize = originalCopyWithMaxSize }()
 
 	// Replace the function to always return a file size exceeded error
-	helpers.CopyWithMaxSize = func(dst io.Writer, src io.Reader, bufferSize int, maxSize int64, validateBuffer helpers.BufferValidationFunc) (int64, *helpers.ValidationIssue, error) {
-		return 0, nil, helpers.ErrMaxFileSizeExceeded
+	helpers.CopyWithMaxSize = func(dst io.Writer, src io.Reader, bufferSize int, maxSize int64, hasHeader bool, validateBuffer helpers.BufferValidationFunc) (int64, *helpers.ValidationIssue, []string, error) {
+		return 0, nil, nil, helpers.ErrMaxFileSizeExceeded
 	}
 
 	// Call copyFileData
-	errors, err := server.copyFileData(ctx, mockSrc, tempFile, "test.csv", "utf-8")
+	errors, err := server.copyFileData(ctx, mockSrc, tempFile, "test.csv", true, "utf-8", 0, RaggedRows{}, false, false)
 
 	// Check for the expected error
 	if err == nil {
@@ -87,22 +87,39 @@ func (f *fileSizeExceeder) ReadAt(p []byte, off int64) (n int, err error) {
 // TestLooksLikeCSV tests the looksLikeCSV function directly
 func TestLooksLikeCSV(t *testing.T) {
 	tests := []struct {
-		name     string
-		content  []byte
-		fileName string
-		expected bool
+		name       string
+		content    []byte
+		fileName   string
+		minColumns int
+		expected   bool
 	}{
 		{
-			name:     "Valid CSV data",
-			content:  []byte("id,name,value\n1,test1,10.5\n2,test2,20.75\n3,test3,30.0\n"),
-			fileName: "test.csv",
-			expected: true,
+			name:       "Valid CSV data",
+			content:    []byte("id,name,value\n1,test1,10.5\n2,test2,20.75\n3,test3,30.0\n"),
+			fileName:   "test.csv",
+			minColumns: 1,
+			expected:   true,
 		},
 		{
-			name:     "Invalid CSV data",
-			content:  []byte("not a csv file content"),
-			fileName: "notcsv.txt",
-			expected: false,
+			name:       "Single column CSV data",
+			content:    []byte("id\n1001\n1002\n1003\n"),
+			fileName:   "ids.csv",
+			minColumns: 1,
+			expected:   true,
+		},
+		{
+			name:       "Single column CSV data with two columns required",
+			content:    []byte("id\n1001\n1002\n1003\n"),
+			fileName:   "ids.csv",
+			minColumns: 2,
+			expected:   false,
+		},
+		{
+			name:       "Invalid CSV data",
+			content:    []byte("not a csv file content"),
+			fileName:   "notcsv.txt",
+			minColumns: 2,
+			expected:   false,
 		},
 	}
 
@@ -119,7 +136,7 @@ func TestLooksLikeCSV(t *testing.T) {
 
 			// Test the function
 			ctx := context.Background()
-			result, err := looksLikeCSV(ctx, mockFile)
+			result, err := looksLikeCSV(ctx, mockFile, 0, tt.minColumns, RaggedRows{})
 
 			if err != nil {
 				t.Fatalf("looksLikeCSV returned error: %v", err)
@@ -312,7 +312,7 @@ func TestEmptyDataEncoding(t *testing.T) {
 		},
 		{
 			name:          "Empty data with unsupported encoding",
-			encoding:      "latin1",
+			encoding:      "ebcdic",
 			expectSuccess: false,
 		},
 	}
@@ -378,7 +378,7 @@ func TestEncodingWithSpecifiedEncoding(t *testing.T) {
 		},
 		{
 			name:              "Unsupported encoding specified",
-			specifiedEncoding: "latin1",
+			specifiedEncoding: "ebcdic",
 			content: []byte(`id,name,value
 1,"José García",10.5
 2,"Miß Schmidt",20.75
@@ -0,0 +1,41 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// handleDuckDBInfo godoc
+//
+//	@Summary		DuckDB engine information
+//	@Description	Get the version of the embedded DuckDB engine and the current values of the settings that affect query behavior, such as threads and memory_limit
+//	@Tags			database
+//	@Produce		json
+//	@Success		200	{object}	api.DuckDBInfoResponse	"DuckDB version and settings"
+//	@Failure		500	{object}	api.ErrorResponse		"Failed to read DuckDB information"
+//	@Router			/duckdb/info [get]
+func (s *Server) handleDuckDBInfo() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		log := getLoggerFromGinContext(c)
+
+		info, err := s.db.EngineInfo(c.Request.Context())
+		if err != nil {
+			log.Error("Error reading DuckDB information", slog.Any("error", err))
+			c.JSON(http.StatusInternalServerError, ErrorResponse{
+				Status:  "error",
+				Message: "Failed to read DuckDB information: " + err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, DuckDBInfoResponse{
+			Status:   "success",
+			Version:  info.Version,
+			SourceID: info.SourceID,
+			Codename: info.Codename,
+			Settings: info.Settings,
+		})
+	}
+}
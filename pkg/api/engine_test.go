@@ -0,0 +1,30 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestHandleDuckDBInfo(t *testing.T) {
+	s, _ := newTablesTestServer(t)
+
+	rec := serveJSON(s, http.MethodGet, "/api/v1/duckdb/info", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+
+	var resp DuckDBInfoResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if resp.Status != "success" || !strings.HasPrefix(resp.Version, "v") || resp.SourceID == "" {
+		t.Errorf("Unexpected response: %+v", resp)
+	}
+	for _, setting := range []string{"threads", "memory_limit"} {
+		if resp.Settings[setting] == "" {
+			t.Errorf("Expected setting %s in %v", setting, resp.Settings)
+		}
+	}
+}
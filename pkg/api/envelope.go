@@ -0,0 +1,103 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/aliengiraffe/spotdb/pkg/helpers"
+	"github.com/gin-gonic/gin"
+)
+
+// envelopeWriter holds back the body of successful JSON responses so envelopeMiddleware
+// can wrap it once the handler is done. Other responses, such as errors, CSV results and
+// streamed archives, are written through.
+type envelopeWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+// holdsBack reports whether the response being written is wrapped in an envelope
+func (w *envelopeWriter) holdsBack() bool {
+	if w.Status() < http.StatusOK || w.Status() >= http.StatusMultipleChoices {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	return err == nil && mediaType == gin.MIMEJSON
+}
+
+func (w *envelopeWriter) Write(data []byte) (int, error) {
+	if w.holdsBack() {
+		return w.body.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *envelopeWriter) WriteString(s string) (int, error) {
+	if w.holdsBack() {
+		return w.body.WriteString(s)
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+// envelopeMiddleware wraps successful JSON responses in a ResponseEnvelope when
+// ENV_WRAP_RESPONSES is true, so generic clients read every endpoint the same way. The
+// status member of a response moves to the envelope, "success" when it has none. It runs
+// after requestIDMiddleware, whose ID is reported in the meta member.
+func envelopeMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !helpers.IsResponseWrappingEnabled() {
+			c.Next()
+			return
+		}
+
+		writer := &envelopeWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+		c.Writer = writer.ResponseWriter
+
+		if writer.body.Len() == 0 {
+			return
+		}
+
+		envelope := newResponseEnvelope(writer.body.Bytes())
+		envelope.Meta.RequestID = helpers.GetRequestIDFromContext(c.Request.Context())
+		body, err := json.Marshal(envelope)
+		if err != nil {
+			getLoggerFromGinContext(c).Error("Failed to wrap response", slog.Any("error", err))
+			_, _ = c.Writer.Write(writer.body.Bytes())
+			return
+		}
+		// The size of the result grows with the envelope
+		if c.Writer.Header().Get(resultBytesHeader) != "" {
+			c.Header(resultBytesHeader, strconv.Itoa(len(body)))
+		}
+		c.Data(writer.Status(), c.Writer.Header().Get("Content-Type"), body)
+	}
+}
+
+// newResponseEnvelope wraps a JSON response body, moving the status member of an object
+// to the envelope
+func newResponseEnvelope(body []byte) ResponseEnvelope {
+	envelope := ResponseEnvelope{Status: "success", Data: json.RawMessage(body)}
+
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(body, &members); err != nil {
+		return envelope
+	}
+	var status string
+	if err := json.Unmarshal(members["status"], &status); err != nil || status == "" {
+		return envelope
+	}
+	delete(members, "status")
+	data, err := json.Marshal(members)
+	if err != nil {
+		return envelope
+	}
+	envelope.Status = status
+	envelope.Data = data
+	return envelope
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestEnvelopeMiddleware(t *testing.T) {
+	t.Setenv("ENV_WRAP_RESPONSES", "true")
+	s, _ := newTablesTestServer(t)
+
+	tests := []struct {
+		name           string
+		method         string
+		url            string
+		body           any
+		accept         string
+		expectedStatus int
+		wrapped        bool
+		expectedData   string
+	}{
+		{name: "query results", method: http.MethodPost, url: "/api/v1/query", body: QueryRequest{Query: "SELECT id FROM sales ORDER BY id LIMIT 1"}, expectedStatus: http.StatusOK, wrapped: true, expectedData: "results"},
+		{name: "table listing without status", method: http.MethodGet, url: "/api/v1/tables", expectedStatus: http.StatusOK, wrapped: true, expectedData: "tables"},
+		{name: "csv results", method: http.MethodPost, url: "/api/v1/query", body: QueryRequest{Query: "SELECT id FROM sales"}, accept: mimeCSV, expectedStatus: http.StatusOK},
+		{name: "errors keep their shape", method: http.MethodGet, url: "/api/v1/tables/missing/ddl", expectedStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requestJSON, _ := json.Marshal(tt.body)
+			req := httptest.NewRequest(tt.method, tt.url, strings.NewReader(string(requestJSON)))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set(requestIDHeader, "envelope-1")
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rec := httptest.NewRecorder()
+			s.Router().ServeHTTP(rec, req)
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+
+			var envelope ResponseEnvelope
+			isEnvelope := json.Unmarshal(rec.Body.Bytes(), &envelope) == nil && envelope.Data != nil
+			if isEnvelope != tt.wrapped {
+				t.Fatalf("Expected wrapped %v, got body %s", tt.wrapped, rec.Body.String())
+			}
+			if !tt.wrapped {
+				return
+			}
+
+			if envelope.Status != "success" || envelope.Meta.RequestID != "envelope-1" {
+				t.Errorf("Unexpected envelope status or meta: %+v", envelope)
+			}
+			var data map[string]any
+			if err := json.Unmarshal(envelope.Data, &data); err != nil {
+				t.Fatalf("Failed to parse envelope data: %v", err)
+			}
+			if _, ok := data[tt.expectedData]; !ok {
+				t.Errorf("Expected %q in the data, got %v", tt.expectedData, data)
+			}
+			if _, ok := data["status"]; ok {
+				t.Errorf("Expected the status to move to the envelope, got %v", data)
+			}
+			if size := rec.Header().Get(resultBytesHeader); size != "" && size != strconv.Itoa(rec.Body.Len()) {
+				t.Errorf("Expected %s to match the wrapped body size %d, got %s", resultBytesHeader, rec.Body.Len(), size)
+			}
+		})
+	}
+}
+
+func TestEnvelopeMiddlewareDisabled(t *testing.T) {
+	s, _ := newTablesTestServer(t)
+
+	rec := serveJSON(s, http.MethodGet, "/api/v1/tables", nil)
+	var response TablesResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil || len(response.Tables) != 1 {
+		t.Errorf("Expected the usual table listing, got %s", rec.Body.String())
+	}
+	if strings.Contains(rec.Body.String(), `"meta"`) {
+		t.Errorf("Expected no envelope by default, got %s", rec.Body.String())
+	}
+}
@@ -0,0 +1,503 @@
+package api
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/aliengiraffe/spotdb/pkg/database"
+	"github.com/aliengiraffe/spotdb/pkg/helpers"
+	"github.com/aliengiraffe/spotdb/pkg/snapshot"
+	"github.com/gin-gonic/gin"
+)
+
+// exportManifestName is the name of the manifest file inside an export archive
+const exportManifestName = "manifest.json"
+
+// handleExportAll godoc
+//
+//	@Summary		Export all tables
+//	@Description	Download every user table as a zip archive with one CSV file per table and a manifest.json describing their schemas
+//	@Tags			tables
+//	@Produce		application/zip
+//	@Param			excel_compat	query		boolean				false	"Write the CSV files with a UTF-8 BOM and \r\n line endings for Excel"
+//	@Success		200	{file}		binary				"Zip archive of CSV files, with the export time in milliseconds in the X-Query-Duration-Ms trailer"
+//	@Failure		500	{object}	api.ErrorResponse	"Failed to export tables"
+//	@Router			/export/all [get]
+func (s *Server) handleExportAll() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		log := getLoggerFromGinContext(c)
+		start := time.Now()
+
+		tables, err := s.db.ListUserTables(ctx)
+		if err != nil {
+			log.Error("Error listing tables for export", slog.Any("error", err))
+			c.JSON(http.StatusInternalServerError, ErrorResponse{
+				Status:  "error",
+				Message: "Failed to list tables: " + err.Error(),
+			})
+			return
+		}
+
+		hiddenPrefixes := helpers.GetHiddenTablePrefixes()
+		tables = slices.DeleteFunc(tables, func(table database.TableRef) bool {
+			return isHiddenTable(table.Name, hiddenPrefixes)
+		})
+
+		tempDir, err := os.MkdirTemp("", "spotdb_export_")
+		if err != nil {
+			log.Error("Error creating export directory", slog.Any("error", err))
+			c.JSON(http.StatusInternalServerError, ErrorResponse{
+				Status:  "error",
+				Message: "Failed to prepare export: " + err.Error(),
+			})
+			return
+		}
+		defer func() {
+			if err := os.RemoveAll(tempDir); err != nil {
+				log.Error("Failed to remove export directory", slog.Any("error", err))
+			}
+		}()
+
+		excelCompat := c.Query("excel_compat") == "true"
+		log.Info("Exporting all tables", slog.Int("table_count", len(tables)), slog.Bool("excel_compat", excelCompat))
+
+		exportedAt := time.Now().UTC()
+		c.Header("Content-Type", "application/zip")
+		c.Header("Content-Disposition",
+			fmt.Sprintf(`attachment; filename="spotdb-export-%s.zip"`, exportedAt.Format("2006-01-02T15-04-05")))
+		// The duration is only known once the archive is written, so it is sent as a trailer
+		if !helpers.IsQueryDurationHeaderDisabled() {
+			c.Header("Trailer", queryDurationHeader)
+		}
+		c.Status(http.StatusOK)
+
+		// The archive is streamed to the client, so once writing has started errors can
+		// only be logged and the response aborted, leaving a truncated archive
+		archive := zip.NewWriter(c.Writer)
+		if err := s.writeExportArchive(ctx, archive, tables, tempDir, exportedAt, excelCompat); err != nil {
+			log.Error("Error streaming export archive", slog.Any("error", err))
+			_ = c.Error(err)
+			c.Abort()
+			return
+		}
+		setQueryDurationHeader(c, time.Since(start))
+
+		log.Info("Export completed", slog.Int("table_count", len(tables)))
+	}
+}
+
+// writeExportArchive exports each table to a temporary CSV file, copies it into the
+// archive and removes it again, then appends the manifest and closes the archive. With
+// excelCompat the CSV files are written for Excel, see exportTableToArchive.
+func (s *Server) writeExportArchive(ctx context.Context, archive *zip.Writer, tables []database.TableRef, tempDir string, exportedAt time.Time, excelCompat bool) error {
+	manifest := ExportManifest{
+		ExportedAt: exportedAt,
+		Tables:     make([]ExportedTable, 0, len(tables)),
+	}
+	usedFiles := make(map[string]bool, len(tables))
+
+	for i, table := range tables {
+		columns, err := s.db.TableColumns(ctx, table)
+		if err != nil {
+			return err
+		}
+
+		file := exportFileName(table, usedFiles)
+		csvPath := filepath.Join(tempDir, fmt.Sprintf("table_%d.csv", i))
+		rowCount, err := s.exportTableToArchive(ctx, archive, table, file, csvPath, excelCompat)
+		if err != nil {
+			return err
+		}
+
+		exported := ExportedTable{
+			Schema:   table.Schema,
+			Name:     table.Name,
+			File:     file,
+			RowCount: rowCount,
+			Columns:  make([]TableColumn, 0, len(columns)),
+		}
+		for _, column := range columns {
+			exported.Columns = append(exported.Columns, TableColumn{
+				Name:     column.Name,
+				Type:     column.Type,
+				Nullable: column.Nullable,
+			})
+		}
+		manifest.Tables = append(manifest.Tables, exported)
+	}
+
+	writer, err := archive.Create(exportManifestName)
+	if err != nil {
+		return fmt.Errorf("failed to add manifest to archive: %w", err)
+	}
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(manifest); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	return archive.Close()
+}
+
+// exportTableToArchive exports a table to csvPath and copies it into the archive under
+// the given file name, removing the temporary CSV file afterwards. With excelCompat the
+// file starts with a UTF-8 BOM and rows end with \r\n, so Excel reads non-ASCII text as
+// UTF-8 rather than in the system codepage.
+func (s *Server) exportTableToArchive(ctx context.Context, archive *zip.Writer, table database.TableRef, file, csvPath string, excelCompat bool) (int64, error) {
+	defer s.cleanupTempFile(ctx, csvPath)
+
+	rowCount, err := s.db.ExportTableCSV(ctx, table, csvPath, excelCompat)
+	if err != nil {
+		return 0, err
+	}
+
+	src, err := os.Open(csvPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open exported file: %w", err)
+	}
+	defer src.Close()
+
+	writer, err := archive.Create(file)
+	if err != nil {
+		return 0, fmt.Errorf("failed to add %s to archive: %w", file, err)
+	}
+	if excelCompat {
+		if _, err := io.WriteString(writer, utf8BOM); err != nil {
+			return 0, fmt.Errorf("failed to write %s to archive: %w", file, err)
+		}
+	}
+	if _, err := io.Copy(writer, src); err != nil {
+		return 0, fmt.Errorf("failed to write %s to archive: %w", file, err)
+	}
+
+	return rowCount, nil
+}
+
+// exportFileName returns the archive path of a table's CSV file. Names are sanitized so
+// they are safe to extract, with a numeric suffix when two tables sanitize to the same path.
+func exportFileName(table database.TableRef, used map[string]bool) string {
+	base := database.SanitizeTableName(table.Schema) + "/" + database.SanitizeTableName(table.Name)
+
+	file := base + ".csv"
+	for i := 2; used[file]; i++ {
+		file = fmt.Sprintf("%s_%d.csv", base, i)
+	}
+	used[file] = true
+	return file
+}
+
+// handleExportParquet godoc
+//
+//	@Summary		Export query results as Parquet
+//	@Description	Run a SELECT query and upload its result as Parquet files under an s3:// or gs:// prefix, optionally partitioned Hive-style by columns. Every export adds new files, so repeated exports append to the dataset.
+//	@Tags			tables
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		api.ParquetExportRequest	true	"Query, destination prefix and optional partition columns"
+//	@Success		200		{object}	api.ParquetExportResponse	"Files uploaded successfully"
+//	@Header			200		{integer}	X-Query-Duration-Ms			"Time taken to run the query and write the Parquet files, in milliseconds"
+//	@Failure		400		{object}	api.ErrorResponse			"Bad request (invalid prefix, partition columns or not a SELECT query)"
+//	@Failure		403		{object}	api.ErrorResponse			"Read-only API key with error code: READ_ONLY_API_KEY"
+//	@Failure		500		{object}	api.ErrorResponse			"Internal server error"
+//	@Router			/export/parquet [post]
+func (s *Server) handleExportParquet() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		log := getLoggerFromGinContext(c)
+
+		var payload ParquetExportRequest
+		if err := c.ShouldBindJSON(&payload); err != nil {
+			log.Error("Error binding parquet export request", slog.Any("error", err))
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Status:  "error",
+				Message: "Invalid parquet export request: " + err.Error(),
+			})
+			return
+		}
+
+		scheme, bucket, prefix, err := parseExportPrefix(payload.Prefix)
+		if err != nil {
+			log.Info("Rejected parquet export prefix", slog.Any("error", err))
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Status:  "error",
+				Message: "Invalid prefix: " + err.Error(),
+			})
+			return
+		}
+
+		for _, column := range payload.PartitionBy {
+			if strings.TrimSpace(column) == "" {
+				c.JSON(http.StatusBadRequest, ErrorResponse{
+					Status:  "error",
+					Message: "Invalid partition_by: column names cannot be empty",
+				})
+				return
+			}
+		}
+
+		log.Info("Parquet export request received",
+			slog.String("store", scheme),
+			slog.String("bucket", bucket),
+			slog.String("prefix", prefix),
+			slog.Any("partition_by", payload.PartitionBy))
+
+		tempDir, err := os.MkdirTemp("", "spotdb_parquet_")
+		if err != nil {
+			log.Error("Error creating export directory", slog.Any("error", err))
+			c.JSON(http.StatusInternalServerError, ErrorResponse{
+				Status:  "error",
+				Message: "Failed to prepare export: " + err.Error(),
+			})
+			return
+		}
+		defer func() {
+			if err := os.RemoveAll(tempDir); err != nil {
+				log.Error("Failed to remove export directory", slog.Any("error", err))
+			}
+		}()
+
+		start := time.Now()
+		rowCount, err := s.db.ExportQueryParquet(ctx, payload.Query, tempDir, payload.PartitionBy)
+		queryDuration := time.Since(start)
+		if err != nil {
+			log.Error("Error exporting query as parquet", slog.Any("error", err))
+			status := http.StatusInternalServerError
+			if errors.Is(err, database.ErrNotSelectQuery) {
+				status = http.StatusBadRequest
+			}
+			c.JSON(status, ErrorResponse{
+				Status:  "error",
+				Message: "Failed to export query: " + err.Error(),
+			})
+			return
+		}
+
+		files, err := uploadExportDir(ctx, scheme, bucket, prefix, tempDir)
+		if err != nil {
+			log.Error("Error uploading parquet files", slog.Any("error", err))
+			c.JSON(http.StatusInternalServerError, ErrorResponse{
+				Status:  "error",
+				Message: "Failed to upload parquet files: " + err.Error(),
+			})
+			return
+		}
+
+		log.Info("Parquet export completed",
+			slog.Int("file_count", len(files)),
+			slog.Int64("row_count", rowCount))
+
+		setQueryDurationHeader(c, queryDuration)
+		c.JSON(http.StatusOK, ParquetExportResponse{
+			Status:   "success",
+			Prefix:   fmt.Sprintf("%s://%s/%s", scheme, bucket, prefix),
+			Files:    files,
+			RowCount: rowCount,
+		})
+	}
+}
+
+// parseExportPrefix validates an s3://bucket/prefix or gs://bucket/prefix destination and
+// returns its scheme, bucket and prefix without trailing slashes. Empty, "." and ".."
+// path segments are rejected so files always land below the given prefix.
+func parseExportPrefix(location string) (scheme, bucket, prefix string, err error) {
+	scheme, bucket, prefix, err = snapshot.ParseLocation(location)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	prefix = strings.TrimRight(prefix, "/")
+	if prefix == "" {
+		return "", "", "", fmt.Errorf("prefix must not be the bucket root")
+	}
+	for _, segment := range strings.Split(prefix, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return "", "", "", fmt.Errorf("prefix contains an invalid path segment: %q", segment)
+		}
+	}
+
+	return scheme, bucket, prefix, nil
+}
+
+// handleExportTableS3 godoc
+//
+//	@Summary		Export a table to S3
+//	@Description	Write a table to a single S3 object as CSV with a header row or as Parquet, using DuckDB's COPY ... TO with the S3 secret registered from DUCKDB_S3_SECRET, so the data never passes through the client. An existing object at the key is replaced.
+//	@Tags			tables
+//	@Accept			json
+//	@Produce		json
+//	@Param			name	path		string						true	"Table name"
+//	@Param			request	body		api.TableS3ExportRequest	true	"Bucket, key and optional format (csv or parquet)"
+//	@Success		200		{object}	api.TableS3ExportResponse	"Table exported successfully"
+//	@Header			200		{integer}	X-Query-Duration-Ms			"Time taken to write the table to S3, in milliseconds"
+//	@Failure		400		{object}	api.ErrorResponse			"Bad request (invalid bucket, key or format)"
+//	@Failure		403		{object}	api.ErrorResponse			"Read-only or tenant API key"
+//	@Failure		404		{object}	api.ErrorResponse			"Table not found"
+//	@Failure		409		{object}	api.AmbiguousTableResponse	"Table name matches several tables ignoring case, error code: AMBIGUOUS_TABLE_NAME"
+//	@Failure		500		{object}	api.ErrorResponse			"Internal server error"
+//	@Failure		503		{object}	api.ErrorResponse			"No DuckDB S3 secret is configured, error code: S3_NOT_CONFIGURED"
+//	@Router			/tables/{name}/export/s3 [post]
+func (s *Server) handleExportTableS3() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		log := getLoggerFromGinContext(c)
+		tableName, ok := s.resolveTableParam(c)
+		if !ok {
+			return // Error response already sent
+		}
+
+		var payload TableS3ExportRequest
+		if err := c.ShouldBindJSON(&payload); err != nil {
+			log.Info("Error binding S3 export request", slog.Any("error", err))
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Status:  "error",
+				Message: "Invalid S3 export request: " + err.Error(),
+			})
+			return
+		}
+
+		format := strings.ToLower(strings.TrimSpace(payload.Format))
+		if format == "" {
+			format = database.ExportFormatCSV
+		}
+		if format != database.ExportFormatCSV && format != database.ExportFormatParquet {
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Status:  "error",
+				Code:    "INVALID_FORMAT",
+				Message: fmt.Sprintf("Invalid format %q: use %s or %s", payload.Format, database.ExportFormatCSV, database.ExportFormatParquet),
+			})
+			return
+		}
+
+		uri, err := s3ExportURI(payload.Bucket, payload.Key)
+		if err != nil {
+			log.Info("Rejected S3 export destination", slog.Any("error", err))
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Status:  "error",
+				Code:    "INVALID_S3_DESTINATION",
+				Message: "Invalid S3 destination: " + err.Error(),
+			})
+			return
+		}
+
+		if !s.requireTable(c, tableName) {
+			return
+		}
+
+		log.Info("S3 table export request received",
+			slog.String("table", tableName),
+			slog.String("uri", uri),
+			slog.String("format", format))
+
+		start := time.Now()
+		rowCount, err := exportTableS3Func(ctx, s.db, database.TableRef{Schema: database.DefaultSchema, Name: tableName}, uri, format)
+		if errors.Is(err, database.ErrS3NotConfigured) {
+			c.JSON(http.StatusServiceUnavailable, ErrorResponse{
+				Status:  "error",
+				Code:    "S3_NOT_CONFIGURED",
+				Message: "S3 exports are not available: " + err.Error(),
+			})
+			return
+		}
+		if err != nil {
+			log.Error("Error exporting table to S3", slog.Any("error", err))
+			c.JSON(http.StatusInternalServerError, ErrorResponse{
+				Status:  "error",
+				Message: "Failed to export table: " + err.Error(),
+			})
+			return
+		}
+
+		log.Info("S3 table export completed",
+			slog.String("uri", uri),
+			slog.Int64("row_count", rowCount),
+			slog.Duration("duration", time.Since(start)))
+
+		setQueryDurationHeader(c, time.Since(start))
+		c.JSON(http.StatusOK, TableS3ExportResponse{
+			Status:   "success",
+			Table:    tableName,
+			Format:   format,
+			URL:      uri,
+			RowCount: rowCount,
+		})
+	}
+}
+
+// exportTableS3Func is a variable to allow overriding in tests, which cannot reach S3
+var exportTableS3Func = func(ctx context.Context, db *database.DuckDB, table database.TableRef, uri, format string) (int64, error) {
+	return db.ExportTableS3(ctx, table, uri, format)
+}
+
+// s3ExportURI validates the bucket, with an optional s3:// scheme, and the object key of
+// a table export and returns the s3://bucket/key URI. Keys must not start or end with a
+// slash, contain empty, "." or ".." path segments, or control characters.
+func s3ExportURI(bucket, key string) (string, error) {
+	scheme, name, err := snapshot.SplitBucket(bucket, snapshot.SchemeS3)
+	if err != nil {
+		return "", err
+	}
+	if scheme != snapshot.SchemeS3 {
+		return "", fmt.Errorf("only s3 buckets are supported, got %s://", scheme)
+	}
+	if name == "" || strings.Contains(name, "/") {
+		return "", fmt.Errorf("invalid bucket: %q", bucket)
+	}
+
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return "", fmt.Errorf("key contains an invalid path segment: %q", segment)
+		}
+	}
+	if strings.ContainsFunc(key, unicode.IsControl) {
+		return "", fmt.Errorf("key must not contain control characters")
+	}
+
+	return fmt.Sprintf("%s://%s/%s", snapshot.SchemeS3, name, key), nil
+}
+
+// uploadExportDir uploads every file below dir to the storage backend for scheme, keeping
+// the relative paths under prefix, and returns the URIs of the uploaded objects
+func uploadExportDir(ctx context.Context, scheme, bucket, prefix, dir string) ([]string, error) {
+	store, err := snapshot.NewStore(ctx, scheme)
+	if err != nil {
+		return nil, err
+	}
+
+	var uris []string
+	err = filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		uri, err := store.Put(ctx, path, bucket, prefix+"/"+filepath.ToSlash(rel))
+		if err != nil {
+			return err
+		}
+		uris = append(uris, uri)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return uris, nil
+}
@@ -0,0 +1,351 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aliengiraffe/spotdb/pkg/database"
+)
+
+func TestHandleExportAll(t *testing.T) {
+	s, db := newTablesTestServer(t)
+
+	ctx := context.Background()
+	for _, query := range []string{
+		`CREATE SCHEMA tenant_a`,
+		`CREATE TABLE tenant_a."order" (id INTEGER, note TEXT)`,
+		`INSERT INTO tenant_a."order" VALUES (7, 'has, comma')`,
+		`CREATE VIEW sales_view AS SELECT * FROM sales`,
+		`CREATE TABLE tmp_import_123 (id INTEGER)`,
+		`CREATE TABLE _spotdb_imports (id INTEGER)`,
+	} {
+		if _, err := db.ExecuteQuery(ctx, query); err != nil {
+			t.Fatalf("Failed to run %q: %v", query, err)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/export/all", nil)
+	rec := httptest.NewRecorder()
+	s.Router().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d, body: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	if contentType := rec.Header().Get("Content-Type"); contentType != "application/zip" {
+		t.Errorf("Expected application/zip content type, got %q", contentType)
+	}
+	if disposition := rec.Header().Get("Content-Disposition"); !strings.HasPrefix(disposition, "attachment;") {
+		t.Errorf("Expected attachment disposition, got %q", disposition)
+	}
+	// The archive is streamed, so its duration follows the body as a trailer
+	if duration := rec.Result().Trailer.Get(queryDurationHeader); duration == "" {
+		t.Errorf("Expected a %s trailer, got trailers %v", queryDurationHeader, rec.Result().Trailer)
+	} else if ms, err := strconv.ParseInt(duration, 10, 64); err != nil || ms < 0 {
+		t.Errorf("Expected a non-negative number of milliseconds, got %q", duration)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatalf("Failed to read zip archive: %v", err)
+	}
+
+	files := make(map[string]string, len(archive.File))
+	for _, f := range archive.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatalf("Failed to open %s: %v", f.Name, err)
+		}
+		content, err := io.ReadAll(r)
+		_ = r.Close()
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", f.Name, err)
+		}
+		files[f.Name] = string(content)
+	}
+
+	expectedFiles := map[string]string{
+		"main/sales.csv":     "id,region,amount\n1,north,10\n2,south,20\n3,north,30\n",
+		"tenant_a/order.csv": "id,note\n7,\"has, comma\"\n",
+	}
+	for name, expected := range expectedFiles {
+		if files[name] != expected {
+			t.Errorf("Expected %s to contain %q, got %q", name, expected, files[name])
+		}
+	}
+	if len(files) != len(expectedFiles)+1 {
+		t.Errorf("Expected %d files in archive, got %d: %v", len(expectedFiles)+1, len(files), archive.File)
+	}
+
+	var manifest ExportManifest
+	if err := json.Unmarshal([]byte(files["manifest.json"]), &manifest); err != nil {
+		t.Fatalf("Failed to parse manifest: %v", err)
+	}
+	if len(manifest.Tables) != 2 {
+		t.Fatalf("Expected 2 tables in manifest, got %d", len(manifest.Tables))
+	}
+
+	sales := manifest.Tables[0]
+	if sales.Schema != "main" || sales.Name != "sales" || sales.File != "main/sales.csv" || sales.RowCount != 3 {
+		t.Errorf("Unexpected manifest entry for sales: %+v", sales)
+	}
+	if len(sales.Columns) != 3 || sales.Columns[2].Name != "amount" || sales.Columns[2].Type != "INTEGER" {
+		t.Errorf("Unexpected sales columns: %+v", sales.Columns)
+	}
+	if order := manifest.Tables[1]; order.Schema != "tenant_a" || order.Name != "order" || order.RowCount != 1 {
+		t.Errorf("Unexpected manifest entry for order: %+v", order)
+	}
+
+	// Temporary export files must be removed once the archive has been streamed
+	entries, err := os.ReadDir(os.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to read temp dir: %v", err)
+	}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), "spotdb_export_") {
+			t.Errorf("Expected export directory to be cleaned up, found %s", entry.Name())
+		}
+	}
+}
+
+func TestHandleExportAllExcelCompat(t *testing.T) {
+	s, db := newTablesTestServer(t)
+	if _, err := db.ExecuteQuery(context.Background(), `UPDATE sales SET region = 'Zoë' || chr(10) || 'north' WHERE id = 1`); err != nil {
+		t.Fatalf("Failed to update sales: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/export/all?excel_compat=true", nil)
+	rec := httptest.NewRecorder()
+	s.Router().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d, body: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatalf("Failed to read zip archive: %v", err)
+	}
+	r, err := archive.Open("main/sales.csv")
+	if err != nil {
+		t.Fatalf("Failed to open sales.csv: %v", err)
+	}
+	content, err := io.ReadAll(r)
+	_ = r.Close()
+	if err != nil {
+		t.Fatalf("Failed to read sales.csv: %v", err)
+	}
+
+	// Line breaks inside values are kept, only rows end with CRLF
+	expected := "\uFEFFid,region,amount\r\n1,\"Zoë\nnorth\",10\r\n2,south,20\r\n3,north,30\r\n"
+	if string(content) != expected {
+		t.Errorf("Expected sales.csv to contain %q, got %q", expected, content)
+	}
+}
+
+func TestExportFileName(t *testing.T) {
+	used := map[string]bool{}
+
+	tests := []struct {
+		schema   string
+		table    string
+		expected string
+	}{
+		{schema: "main", table: "sales", expected: "main/sales.csv"},
+		{schema: "main", table: "../etc/passwd", expected: "main/___etc_passwd.csv"},
+		{schema: "main", table: "a-b", expected: "main/a_b.csv"},
+		{schema: "main", table: "a_b", expected: "main/a_b_2.csv"},
+	}
+
+	for _, tc := range tests {
+		if got := exportFileName(database.TableRef{Schema: tc.schema, Name: tc.table}, used); got != tc.expected {
+			t.Errorf("exportFileName(%s, %s) = %s, want %s", tc.schema, tc.table, got, tc.expected)
+		}
+	}
+}
+
+func TestHandleExportParquet(t *testing.T) {
+	var uploaded []string
+	gcs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		if !bytes.HasPrefix(body, []byte("PAR1")) {
+			http.Error(w, "not a parquet file", http.StatusBadRequest)
+			return
+		}
+		uploaded = append(uploaded, r.URL.Query().Get("name"))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer gcs.Close()
+
+	t.Setenv("ENV_GCS_ENDPOINT", gcs.URL)
+	t.Setenv("ENV_GCS_ACCESS_TOKEN", "test-token")
+
+	s, _ := newTablesTestServer(t)
+
+	t.Run("partitioned", func(t *testing.T) {
+		uploaded = nil
+		rec := serveJSON(s, http.MethodPost, "/api/v1/export/parquet", ParquetExportRequest{
+			Query:       "SELECT * FROM sales",
+			Prefix:      "gs://lake/sales/",
+			PartitionBy: []string{"region"},
+		})
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+		}
+
+		var resp ParquetExportResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+		if resp.Prefix != "gs://lake/sales" || resp.RowCount != 3 {
+			t.Errorf("Unexpected response: %+v", resp)
+		}
+		if len(resp.Files) == 0 || len(resp.Files) != len(uploaded) {
+			t.Fatalf("Expected every file to be uploaded, got files %v and uploads %v", resp.Files, uploaded)
+		}
+		for i, name := range uploaded {
+			if !strings.HasPrefix(name, "sales/region=") || !strings.HasSuffix(name, ".parquet") {
+				t.Errorf("Unexpected object name %q", name)
+			}
+			if resp.Files[i] != "gs://lake/"+name {
+				t.Errorf("Expected file URI gs://lake/%s, got %q", name, resp.Files[i])
+			}
+		}
+	})
+
+	for _, tc := range []struct {
+		name    string
+		request ParquetExportRequest
+	}{
+		{"bucket root", ParquetExportRequest{Query: "SELECT * FROM sales", Prefix: "gs://lake/"}},
+		{"parent segment", ParquetExportRequest{Query: "SELECT * FROM sales", Prefix: "s3://lake/a/../b"}},
+		{"unsupported scheme", ParquetExportRequest{Query: "SELECT * FROM sales", Prefix: "file:///tmp/out"}},
+		{"empty partition column", ParquetExportRequest{Query: "SELECT * FROM sales", Prefix: "gs://lake/sales", PartitionBy: []string{" "}}},
+		{"not a select", ParquetExportRequest{Query: "DELETE FROM sales", Prefix: "gs://lake/sales"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			uploaded = nil
+			rec := serveJSON(s, http.MethodPost, "/api/v1/export/parquet", tc.request)
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("Expected status %d, got %d: %s", http.StatusBadRequest, rec.Code, rec.Body.String())
+			}
+			if len(uploaded) != 0 {
+				t.Errorf("Expected no uploads, got %v", uploaded)
+			}
+		})
+	}
+}
+
+func TestS3ExportURI(t *testing.T) {
+	tests := []struct {
+		name     string
+		bucket   string
+		key      string
+		expected string
+		wantErr  bool
+	}{
+		{name: "plain bucket", bucket: "lake", key: "sales/2024.parquet", expected: "s3://lake/sales/2024.parquet"},
+		{name: "bucket with scheme", bucket: "s3://lake/", key: "sales.csv", expected: "s3://lake/sales.csv"},
+		{name: "gcs bucket", bucket: "gs://lake", key: "sales.csv", wantErr: true},
+		{name: "bucket with path", bucket: "s3://lake/sales", key: "sales.csv", wantErr: true},
+		{name: "leading slash", bucket: "lake", key: "/sales.csv", wantErr: true},
+		{name: "trailing slash", bucket: "lake", key: "sales/", wantErr: true},
+		{name: "parent segment", bucket: "lake", key: "a/../sales.csv", wantErr: true},
+		{name: "control character", bucket: "lake", key: "sales\n.csv", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := s3ExportURI(tc.bucket, tc.key)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("s3ExportURI(%q, %q) error = %v, wantErr %v", tc.bucket, tc.key, err, tc.wantErr)
+			}
+			if got != tc.expected {
+				t.Errorf("s3ExportURI(%q, %q) = %q, want %q", tc.bucket, tc.key, got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestHandleExportTableS3(t *testing.T) {
+	s, _ := newTablesTestServer(t)
+
+	tests := []struct {
+		name           string
+		table          string
+		request        TableS3ExportRequest
+		expectedStatus int
+		expectedCode   string
+	}{
+		{name: "invalid format", table: "sales", request: TableS3ExportRequest{Bucket: "lake", Key: "sales.json", Format: "json"}, expectedStatus: http.StatusBadRequest, expectedCode: "INVALID_FORMAT"},
+		{name: "invalid key", table: "sales", request: TableS3ExportRequest{Bucket: "lake", Key: "../sales.csv"}, expectedStatus: http.StatusBadRequest, expectedCode: "INVALID_S3_DESTINATION"},
+		{name: "missing key", table: "sales", request: TableS3ExportRequest{Bucket: "lake"}, expectedStatus: http.StatusBadRequest},
+		{name: "missing table", table: "missing", request: TableS3ExportRequest{Bucket: "lake", Key: "missing.csv"}, expectedStatus: http.StatusNotFound},
+		{name: "no S3 secret", table: "sales", request: TableS3ExportRequest{Bucket: "lake", Key: "sales.parquet", Format: "parquet"}, expectedStatus: http.StatusServiceUnavailable, expectedCode: "S3_NOT_CONFIGURED"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := serveJSON(s, http.MethodPost, "/api/v1/tables/"+tc.table+"/export/s3", tc.request)
+			if rec.Code != tc.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tc.expectedStatus, rec.Code, rec.Body.String())
+			}
+
+			var resp ErrorResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+			if resp.Code != tc.expectedCode {
+				t.Errorf("Expected code %q, got %q", tc.expectedCode, resp.Code)
+			}
+		})
+	}
+}
+
+func TestHandleExportTableS3Success(t *testing.T) {
+	s, _ := newTablesTestServer(t)
+
+	orig := exportTableS3Func
+	defer func() { exportTableS3Func = orig }()
+	var exportedURI string
+	exportTableS3Func = func(ctx context.Context, db *database.DuckDB, table database.TableRef, uri, format string) (int64, error) {
+		exportedURI = uri
+		return 3, nil
+	}
+
+	rec := serveJSON(s, http.MethodPost, "/api/v1/tables/sales/export/s3", TableS3ExportRequest{Bucket: "lake", Key: "exports/sales.csv"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	if exportedURI != "s3://lake/exports/sales.csv" {
+		t.Errorf("Expected the table to be exported to s3://lake/exports/sales.csv, got %q", exportedURI)
+	}
+	if duration := rec.Header().Get(queryDurationHeader); duration == "" {
+		t.Errorf("Expected a %s header, got headers %v", queryDurationHeader, rec.Header())
+	}
+
+	var resp TableS3ExportResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if resp.RowCount != 3 || resp.Format != database.ExportFormatCSV {
+		t.Errorf("Expected 3 rows exported as CSV, got %+v", resp)
+	}
+
+	t.Setenv("ENV_DISABLE_QUERY_DURATION_HEADER", "true")
+	rec = serveJSON(s, http.MethodPost, "/api/v1/tables/sales/export/s3", TableS3ExportRequest{Bucket: "lake", Key: "exports/sales.csv"})
+	if duration := rec.Header().Get(queryDurationHeader); duration != "" {
+		t.Errorf("Expected no %s header when disabled, got %q", queryDurationHeader, duration)
+	}
+}
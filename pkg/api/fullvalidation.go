@@ -0,0 +1,117 @@
+package api
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/aliengiraffe/spotdb/pkg/helpers"
+)
+
+// structureCheckWriter checks the structure of every CSV record written through it, so
+// full_validation covers the whole file instead of the sample validated up front. Quoted
+// fields may span lines, and every record must have as many fields as the first one,
+// unless ragged tolerates the difference.
+type structureCheckWriter struct {
+	dst       io.Writer
+	delimiter byte
+	// lineOffset is added to line numbers to report them relative to the uploaded file
+	lineOffset int
+	ragged     RaggedRows
+
+	line         int
+	inQuote      bool
+	fields       int
+	hasContent   bool
+	fieldContent bool
+	recordStart  int
+	expected     int
+
+	// issue describes the first structural problem found
+	issue *helpers.ValidationIssue
+}
+
+// startFullValidation detects the delimiter from the start of the data read from reader
+// and returns a writer checking the records written to dst, with the reader to continue
+// copying from
+func startFullValidation(dst io.Writer, reader io.Reader, lineOffset int, ragged RaggedRows) (*structureCheckWriter, io.Reader) {
+	delimiter, reader := peekDelimiter(reader)
+	return newStructureCheckWriter(dst, delimiter, lineOffset, ragged), reader
+}
+
+// newStructureCheckWriter returns a writer that checks records delimited by delimiter
+// before passing them on to dst
+func newStructureCheckWriter(dst io.Writer, delimiter rune, lineOffset int, ragged RaggedRows) *structureCheckWriter {
+	return &structureCheckWriter{dst: dst, delimiter: byte(delimiter), lineOffset: lineOffset, ragged: ragged}
+}
+
+// Write checks the records in p and writes p to the destination, failing with an
+// "invalid CSV structure" error at the first malformed record
+func (w *structureCheckWriter) Write(p []byte) (int, error) {
+	for _, c := range p {
+		if w.fields == 0 && !w.hasContent {
+			w.recordStart = w.line + 1
+		}
+
+		switch {
+		case c == '"':
+			w.inQuote = !w.inQuote
+			w.hasContent, w.fieldContent = true, true
+		case c == w.delimiter && !w.inQuote:
+			w.fields++
+			w.hasContent, w.fieldContent = true, false
+		case c == '\n':
+			w.line++
+			if !w.inQuote {
+				if err := w.endRecord(); err != nil {
+					return 0, err
+				}
+			}
+		case c != '\r':
+			w.hasContent, w.fieldContent = true, true
+		}
+	}
+
+	return w.dst.Write(p)
+}
+
+// Close checks the last record, which may not end with a newline, and reports quoted
+// fields left open at the end of the file
+func (w *structureCheckWriter) Close() error {
+	if w.inQuote {
+		w.issue = &helpers.ValidationIssue{
+			Pattern: "unterminated quoted field",
+			Line:    w.recordStart + w.lineOffset,
+		}
+		return fmt.Errorf("invalid CSV structure: unterminated quoted field starting on line %d", w.issue.Line)
+	}
+	return w.endRecord()
+}
+
+// endRecord compares the field count of the completed record with the first record's,
+// skipping blank lines
+func (w *structureCheckWriter) endRecord() error {
+	if !w.hasContent {
+		return nil
+	}
+
+	count := w.fields + 1
+	lastEmpty := !w.fieldContent
+	w.fields, w.hasContent, w.fieldContent = 0, false, false
+	if w.expected == 0 {
+		w.expected = count
+		if w.ragged.TrimTrailingDelimiter && count > 1 && lastEmpty {
+			w.expected--
+		}
+		return nil
+	}
+	if w.ragged.accepts(count, w.expected, lastEmpty) {
+		return nil
+	}
+
+	line := w.recordStart + w.lineOffset
+	w.issue = &helpers.ValidationIssue{
+		Pattern: "inconsistent column count",
+		Line:    line,
+	}
+	return fmt.Errorf("invalid CSV structure: "+ErrInconsistentColumns, line, count, w.expected)
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestStructureCheckWriter(t *testing.T) {
+	tests := []struct {
+		name      string
+		delimiter rune
+		data      string
+		ragged    RaggedRows
+		wantError string
+		wantLine  int
+	}{
+		{name: "consistent rows", delimiter: ',', data: "id,city\n1,Paris\n2,Lyon\n"},
+		{name: "no trailing newline", delimiter: ',', data: "id,city\n1,Paris\n2,Lyon"},
+		{name: "blank and CRLF lines", delimiter: ',', data: "id,city\r\n1,Paris\r\n\r\n2,Lyon\r\n"},
+		{name: "quoted delimiter", delimiter: ',', data: "id,city\n1,\"Paris, France\"\n"},
+		{name: "multi-line quoted field", delimiter: ',', data: "id,note\n1,\"first\nsecond\"\n2,ok\n"},
+		{name: "semicolon delimiter", delimiter: ';', data: "id;city\n1;Paris, France\n"},
+		{name: "extra column", delimiter: ',', data: "id,city\n1,Paris\n2,Lyon,extra\n", wantError: "inconsistent column count on line 3: got 3, expected 2", wantLine: 3},
+		{name: "missing column after multi-line field", delimiter: ',', data: "id,note\n1,\"a\nb\"\n2\n", wantError: "inconsistent column count on line 4", wantLine: 4},
+		{name: "trailing delimiter", delimiter: ',', data: "id,city,\n1,Paris,\n2,Lyon\n", ragged: RaggedRows{TrimTrailingDelimiter: true}},
+		{name: "trailing value", delimiter: ',', data: "id,city\n1,Paris,x\n", ragged: RaggedRows{TrimTrailingDelimiter: true}, wantError: "inconsistent column count on line 2: got 3, expected 2", wantLine: 2},
+		{name: "short row padded", delimiter: ',', data: "id,city,zip\n1,Paris\n", ragged: RaggedRows{NullPadding: true}},
+		{name: "short row", delimiter: ',', data: "id,city,zip\n1,Paris\n", wantError: "inconsistent column count on line 2: got 2, expected 3", wantLine: 2},
+		{name: "unterminated quote", delimiter: ',', data: "id,note\n1,ok\n2,\"open\n3,x\n", wantError: "unterminated quoted field starting on line 3", wantLine: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var dst bytes.Buffer
+			w := newStructureCheckWriter(&dst, tt.delimiter, 0, tt.ragged)
+
+			// Write line by line as the upload copy does
+			var err error
+			for _, line := range strings.SplitAfter(tt.data, "\n") {
+				if _, err = w.Write([]byte(line)); err != nil {
+					break
+				}
+			}
+			if err == nil {
+				err = w.Close()
+			}
+
+			if tt.wantError == "" {
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				if dst.String() != tt.data {
+					t.Errorf("Expected data to be written unchanged, got %q", dst.String())
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+				t.Fatalf("Expected error containing %q, got %v", tt.wantError, err)
+			}
+			if w.issue == nil || w.issue.Line != tt.wantLine {
+				t.Errorf("Expected issue on line %d, got %+v", tt.wantLine, w.issue)
+			}
+		})
+	}
+
+	t.Run("line offset", func(t *testing.T) {
+		w := newStructureCheckWriter(&bytes.Buffer{}, ',', 2, RaggedRows{})
+		_, err := w.Write([]byte("id,city\n1\n"))
+		if err == nil || w.issue.Line != 4 {
+			t.Errorf("Expected an issue on line 4, got %v (%+v)", err, w.issue)
+		}
+	})
+}
@@ -1,10 +1,13 @@
 package api
 
 import (
+	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	ratelimit "github.com/JGLTechnologies/gin-rate-limit"
@@ -13,6 +16,41 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// trustedProxiesEnvVar holds a comma-separated list of trusted proxy IPs or CIDRs
+const trustedProxiesEnvVar = "ENV_TRUSTED_PROXIES"
+
+// trustedProxiesFromEnv parses the trusted proxies configured in ENV_TRUSTED_PROXIES
+func trustedProxiesFromEnv() []string {
+	var proxies []string
+	for _, proxy := range strings.Split(os.Getenv(trustedProxiesEnvVar), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
+
+// configureTrustedProxies makes c.ClientIP() resolve the client from X-Forwarded-For or
+// X-Real-IP only when the request comes from a trusted proxy. Without configured
+// proxies, or with an invalid list, the headers are ignored and the peer address is used.
+func configureTrustedProxies(r *gin.Engine, log *slog.Logger) {
+	r.RemoteIPHeaders = []string{"X-Forwarded-For", "X-Real-IP"}
+
+	proxies := trustedProxiesFromEnv()
+	if err := r.SetTrustedProxies(proxies); err != nil {
+		log.Error("Invalid "+trustedProxiesEnvVar+" value, not trusting any proxy",
+			slog.String(trustedProxiesEnvVar, os.Getenv(trustedProxiesEnvVar)),
+			slog.Any("errorMessage", err),
+		)
+		proxies = nil
+		_ = r.SetTrustedProxies(nil)
+	}
+
+	if len(proxies) > 0 {
+		log.Info("Trusted proxies configured", slog.Any("trusted_proxies", proxies))
+	}
+}
+
 // keyFunc extracts the client IP for rate limiting.
 func keyFunc(c *gin.Context) string {
 	return c.ClientIP()
@@ -31,18 +69,29 @@ func errorHandler(c *gin.Context, info ratelimit.Info) {
 	c.String(http.StatusTooManyRequests, "Too many requests. Try again in "+waitTime)
 }
 
-// apiKeyAuthMiddleware validates API key from headers.
+// apiKeyRoleKey is the gin context key holding the helpers.APIKeyRole of the request's key
+const apiKeyRoleKey = "api_key_role"
+
+// apiKeyTenantKey is the gin context key holding the tenant of a tenant API key
+const apiKeyTenantKey = "api_key_tenant"
+
+// apiKeyAuthMiddleware validates the API key from the X-API-Key header or the Basic auth password,
+// and stores the role the key grants, and the tenant of tenant keys, in the context for
+// requireFullAccess and handlers.
 func apiKeyAuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		log := getLoggerFromGinContext(c)
 
-		if !helpers.IsValidAPIKeyFromHeader(&c.Request.Header) {
+		role, ok := helpers.APIKeyRoleFromHeader(&c.Request.Header)
+		if !ok {
 			log.Info("Unauthorized access attempt",
 				slog.String("reason", "invalid or missing API key"),
-				slog.String("remote_addr", c.Request.RemoteAddr),
+				slog.String("remote_addr", c.ClientIP()),
 				slog.String("path", c.Request.URL.Path),
 			)
 
+			// Let clients that only speak Basic auth know they can prompt for credentials
+			c.Header("WWW-Authenticate", `Basic realm="spotdb"`)
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
 				"error":   "Unauthorized",
 				"message": "Invalid or missing API Key",
@@ -50,10 +99,135 @@ func apiKeyAuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		c.Set(apiKeyRoleKey, role)
+		if role == helpers.RoleTenant {
+			c.Set(apiKeyTenantKey, helpers.APIKeyTenantFromHeader(&c.Request.Header))
+		}
+		c.Next()
+	}
+}
+
+// isReadOnlyKey reports whether the request was authenticated with a read-only API key.
+// Tenant keys are read-only too.
+func isReadOnlyKey(c *gin.Context) bool {
+	role, _ := c.Get(apiKeyRoleKey)
+	return role == helpers.RoleReadOnly || role == helpers.RoleTenant
+}
+
+// requestTenant returns the tenant of the request's API key, or "" when it is not a
+// tenant key
+func requestTenant(c *gin.Context) string {
+	return c.GetString(apiKeyTenantKey)
+}
+
+// requireUnscopedAccess rejects requests made with a tenant API key, for routes that read
+// table rows without the row filters of the tenant
+func requireUnscopedAccess() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if requestTenant(c) == "" {
+			c.Next()
+			return
+		}
+		getLoggerFromGinContext(c).Info("Tenant API key rejected",
+			slog.String("remote_addr", c.ClientIP()),
+			slog.String("path", c.Request.URL.Path),
+		)
+		c.AbortWithStatusJSON(http.StatusForbidden, ErrorResponse{
+			Status:  "error",
+			Code:    "TENANT_API_KEY",
+			Message: "This API key can only read data through /query",
+		})
+	}
+}
+
+// rejectReadOnlyKey responds with 403 and READ_ONLY_API_KEY, for requests with a
+// read-only API key to endpoints that modify data
+func rejectReadOnlyKey(c *gin.Context, message string) {
+	getLoggerFromGinContext(c).Info("Read-only API key rejected",
+		slog.String("remote_addr", c.ClientIP()),
+		slog.String("path", c.Request.URL.Path),
+	)
+	c.AbortWithStatusJSON(http.StatusForbidden, ErrorResponse{
+		Status:  "error",
+		Code:    "READ_ONLY_API_KEY",
+		Message: message,
+	})
+}
+
+// requireFullAccess rejects requests made with a read-only API key, for routes that
+// modify data or expose operational details
+func requireFullAccess() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if isReadOnlyKey(c) {
+			rejectReadOnlyKey(c, "This API key can only read data")
+			return
+		}
+		c.Next()
+	}
+}
+
+// rejectReadOnlyMode responds with 403 and READ_ONLY_MODE, for requests that would modify
+// a database opened read-only with DUCKDB_ACCESS_MODE
+func rejectReadOnlyMode(c *gin.Context) {
+	getLoggerFromGinContext(c).Info("Write rejected, database is read-only",
+		slog.String("path", c.Request.URL.Path),
+	)
+	c.AbortWithStatusJSON(http.StatusForbidden, ErrorResponse{
+		Status:  "error",
+		Code:    "READ_ONLY_MODE",
+		Message: "The database is opened read-only and cannot be modified",
+	})
+}
+
+// requireWritableDatabase rejects requests to routes that modify data when the database
+// is opened read-only or maintenance mode is on
+func (s *Server) requireWritableDatabase() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if s.db.IsReadOnly() {
+			rejectReadOnlyMode(c)
+			return
+		}
+		if s.rejectDuringMaintenance(c) {
+			return
+		}
+		c.Next()
+	}
+}
+
+// requireNoMaintenance rejects requests to routes that must not run during maintenance,
+// such as snapshots, which a read-only database can still serve
+func (s *Server) requireNoMaintenance() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if s.rejectDuringMaintenance(c) {
+			return
+		}
 		c.Next()
 	}
 }
 
+// rejectDuringMaintenance responds with 503 and MAINTENANCE_MODE while maintenance mode is
+// on, reporting whether the request was rejected
+func (s *Server) rejectDuringMaintenance(c *gin.Context) bool {
+	window := s.maintenance.Load()
+	if window == nil {
+		return false
+	}
+
+	getLoggerFromGinContext(c).Info("Write rejected, maintenance mode is on",
+		slog.String("path", c.Request.URL.Path),
+	)
+	message := "The server is in maintenance mode and does not accept writes"
+	if window.reason != "" {
+		message += ": " + window.reason
+	}
+	c.AbortWithStatusJSON(http.StatusServiceUnavailable, ErrorResponse{
+		Status:  "error",
+		Code:    "MAINTENANCE_MODE",
+		Message: message,
+	})
+	return true
+}
+
 // rateLimitMiddleware creates a Gin rate limiter.
 func rateLimitMiddleware(log *slog.Logger) gin.HandlerFunc {
 	rpsEnv := os.Getenv("ENV_RATE_LIMIT_RPS")
@@ -82,6 +256,64 @@ func rateLimitMiddleware(log *slog.Logger) gin.HandlerFunc {
 	return ratelimit.RateLimiter(store, &ratelimit.Options{ErrorHandler: errorHandler, KeyFunc: keyFunc})
 }
 
+// bulkDeleteRateLimitMiddleware limits each client to ENV_BULK_DELETE_RATE_LIMIT bulk table
+// deletions per minute, on top of the global rate limit. Unlike the global limiter it
+// applies in every mode, since a bulk deletion is destructive wherever it runs.
+func bulkDeleteRateLimitMiddleware(log *slog.Logger) gin.HandlerFunc {
+	limit := helpers.GetBulkDeleteRateLimit()
+	if limit == 0 {
+		log.Info("Bulk delete rate limiting disabled")
+		return func(c *gin.Context) { c.Next() }
+	}
+
+	store := ratelimit.InMemoryStore(&ratelimit.InMemoryOptions{Rate: time.Minute, Limit: uint(limit)})
+	return ratelimit.RateLimiter(store, &ratelimit.Options{ErrorHandler: errorHandler, KeyFunc: keyFunc})
+}
+
+// queryConcurrencyMiddleware bounds the number of queries running at once to
+// ENV_MAX_CONCURRENT_QUERIES, separately from uploads. A query arriving while every slot
+// is taken waits up to ENV_QUERY_QUEUE_TIMEOUT for one, so brief bursts still succeed, and
+// is rejected with 429 afterwards. Queries are not limited when the setting is 0.
+func queryConcurrencyMiddleware(log *slog.Logger) gin.HandlerFunc {
+	maxQueries := helpers.GetMaxConcurrentQueries()
+	if maxQueries == 0 {
+		return func(c *gin.Context) { c.Next() }
+	}
+
+	timeout := helpers.GetQueryQueueTimeout()
+	log.Info("Concurrent queries limited", slog.Int("max_queries", maxQueries), slog.Duration("queue_timeout", timeout))
+
+	slots := make(chan struct{}, maxQueries)
+	return func(c *gin.Context) {
+		select {
+		case slots <- struct{}{}:
+		default:
+			timer := time.NewTimer(timeout)
+			defer timer.Stop()
+
+			select {
+			case slots <- struct{}{}:
+			case <-timer.C:
+				getLoggerFromGinContext(c).Info("Rejected query, too many concurrent queries",
+					slog.Int("max_queries", maxQueries), slog.Duration("queue_timeout", timeout))
+				c.Header("Retry-After", "1")
+				c.AbortWithStatusJSON(http.StatusTooManyRequests, ErrorResponse{
+					Status:  "error",
+					Code:    "TOO_MANY_QUERIES",
+					Message: fmt.Sprintf("Too many concurrent queries: the server runs at most %d at once, try again shortly", maxQueries),
+				})
+				return
+			case <-c.Request.Context().Done():
+				c.Abort()
+				return
+			}
+		}
+		defer func() { <-slots }()
+
+		c.Next()
+	}
+}
+
 // EndHTTPRequestLoggingGin finalizes request logging after processing.
 func EndHTTPRequestLoggingGin(reqLogger *slog.Logger, c *gin.Context, start time.Time) {
 	statusCode := c.Writer.Status()
@@ -115,6 +347,68 @@ func ginLoggerMiddleware(baseLogger *slog.Logger) gin.HandlerFunc {
 	}
 }
 
+// requestIDHeader carries the request ID, set by the client or generated by the server
+const requestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds the length of a client supplied request ID
+const maxRequestIDLength = 128
+
+// requestIDMiddleware stores the request ID in the request context and echoes it in the
+// response. Client supplied IDs are kept when they are short printable ASCII, otherwise
+// a new ID is generated.
+func requestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(requestIDHeader)
+		if !isValidRequestID(requestID) {
+			requestID = helpers.GenerateID()
+		}
+
+		c.Request = c.Request.WithContext(
+			helpers.SetRequestIDInContext(c.Request.Context(), requestID),
+		)
+		c.Header(requestIDHeader, requestID)
+
+		c.Next()
+	}
+}
+
+// requestLogCaptureMiddleware captures the log entries of the request under its ID. It
+// runs after requestIDMiddleware, which sets the ID.
+func (s *Server) requestLogCaptureMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		logger := s.requestLogs.Logger(helpers.GetLoggerFromContext(ctx), helpers.GetRequestIDFromContext(ctx))
+		c.Request = c.Request.WithContext(helpers.SetLoggerInContext(ctx, logger))
+
+		c.Next()
+	}
+}
+
+// isValidRequestID reports whether a client supplied request ID can be used as is
+func isValidRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range requestID {
+		if r < '!' || r > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// withoutWriteTimeout lifts the server's write timeout for routes that legitimately run
+// or stream for longer, such as imports and exports of large files
+func withoutWriteTimeout() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Test recorders do not support deadlines, which only matters for real connections
+		if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			getLoggerFromGinContext(c).Info("Failed to lift write timeout", slog.Any("error", err))
+		}
+		c.Next()
+	}
+}
+
 // corsMiddleware handles CORS headers for the API.
 func corsMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -125,7 +419,8 @@ func corsMiddleware() gin.HandlerFunc {
 
 		c.Header("Access-Control-Allow-Origin", origin)
 		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS, PATCH")
-		c.Header("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, X-Api-Key")
+		c.Header("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, X-Api-Key, X-Request-ID, If-None-Match, If-Match")
+		c.Header("Access-Control-Expose-Headers", "X-Request-ID, X-Result-Rows, X-Result-Bytes, X-Query-Duration-Ms, ETag")
 		c.Header("Access-Control-Allow-Credentials", "true")
 		c.Header("Access-Control-Max-Age", "86400")
 
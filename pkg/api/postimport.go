@@ -0,0 +1,52 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/aliengiraffe/spotdb/pkg/database"
+	"github.com/aliengiraffe/spotdb/pkg/helpers"
+)
+
+// runPostImportQuery runs the query, restricted to the imported table, reporting failures
+// in the result since the import itself has already succeeded
+func (s *Server) runPostImportQuery(ctx context.Context, table database.TableRef, query string) *PostImportQueryResult {
+	log := helpers.GetLoggerFromContext(ctx)
+
+	start := time.Now()
+	defer recordUploadPhase(ctx, phasePostImportQuery, start)
+
+	fail := func(code, message string, err error) *PostImportQueryResult {
+		log.Info("Post-import query failed", slog.String("code", code), slog.Any("error", err))
+		return &PostImportQueryResult{
+			Status:     "error",
+			Code:       code,
+			Message:    message + ": " + err.Error(),
+			DurationMs: time.Since(start).Milliseconds(),
+		}
+	}
+
+	log.Info("Running post-import query", slog.String("table", table.Name), slog.String("query", query))
+
+	result, err := s.db.ExecuteScopedQuery(ctx, query, table, helpers.GetMaxEstimatedRows())
+	switch {
+	case errors.Is(err, database.ErrEmptyQuery):
+		return fail("EMPTY_QUERY", "Post-import query is empty", err)
+	case errors.Is(err, database.ErrQueryOutOfScope):
+		return fail("QUERY_OUT_OF_SCOPE", "Post-import query rejected, it may only use the imported table", err)
+	case errors.Is(err, database.ErrQueryTooExpensive):
+		return fail("QUERY_TOO_EXPENSIVE", "Post-import query rejected", err)
+	case err != nil:
+		return fail("POST_IMPORT_QUERY_FAILED", "Failed to execute post-import query", err)
+	}
+
+	return &PostImportQueryResult{
+		Status:     "success",
+		RowCount:   len(result.Results),
+		Columns:    s.extractColumnNames(result),
+		Results:    result.Results,
+		DurationMs: result.Duration.Milliseconds(),
+	}
+}
@@ -0,0 +1,153 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/aliengiraffe/spotdb/pkg/database"
+	"github.com/aliengiraffe/spotdb/pkg/helpers"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// PreviewRowLimit is the number of parsed rows returned by the preview endpoint
+const PreviewRowLimit = 10
+
+// handleCSVPreview godoc
+//
+//	@Summary		Preview CSV file
+//	@Description	Parse a CSV file without importing it, returning the inferred schema and the first rows
+//	@Tags			upload
+//	@Accept			multipart/form-data
+//	@Produce		json
+//	@Param			request				formData	api.CSVPreviewRequest	true	"CSV preview request"
+//	@Param			csv_file			formData	file					true	"CSV file to preview"
+//	@Param			csv_file_encoding	formData	string					false	"Encoding of the CSV file (default: utf-8, supported: utf-8, utf-16, iso-8859-1, iso-8859-15, windows-1252)"
+//	@Success		200					{object}	api.CSVPreviewResponse	"Inferred schema and sample rows"
+//	@Failure		400					{object}	api.CSVErrorResponse	"Bad request with possible error codes: INVALID_REQUEST_PARAMETERS, INVALID_FILE_NAME, FILE_OPEN_ERROR, MIME_TYPE_DETECTION_ERROR, CSV_FORMAT_CHECK_ERROR, INVALID_FILE_EXTENSION, INVALID_FILE_FORMAT, CSV_VALIDATION_ERROR, INVALID_CSV_STRUCTURE, INVALID_ENCODING, UNSUPPORTED_ENCODING, SECURITY_VALIDATION_FAILED, INVALID_TYPE_ROW"
+//	@Failure		413					{object}	api.CSVErrorResponse	"File too large with error code: FILE_SIZE_EXCEEDED"
+//	@Failure		422					{object}	api.CSVErrorResponse	"Unprocessable entity with error code: PREVIEW_FAILED"
+//	@Failure		507					{object}	api.CSVErrorResponse	"Insufficient storage with error code: DISK_FULL"
+//	@Router			/upload/preview [post]
+func (s *Server) handleCSVPreview() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		log := helpers.GetLoggerFromContext(ctx)
+
+		var payload CSVPreviewRequest
+		err := parseMultipartForm(c)
+		if err == nil {
+			err = c.ShouldBind(&payload)
+		}
+		if err != nil {
+			log.Info("Error binding CSV preview request", slog.Any("error", err))
+			c.JSON(http.StatusBadRequest, CSVErrorResponse{
+				Errors: []CSVError{{
+					Code:    "INVALID_REQUEST_PARAMETERS",
+					Message: "Invalid request: " + err.Error(),
+					Details: CSVErrorDetail{
+						Line:       0,
+						Suggestion: suggestionMap["INVALID_REQUEST_PARAMETERS"],
+					},
+				}},
+			})
+			return
+		}
+
+		if filenameErr := validateUploadFilename(payload.CSVFile); filenameErr != nil {
+			c.JSON(http.StatusBadRequest, CSVErrorResponse{
+				Errors: []CSVError{*filenameErr},
+			})
+			return
+		}
+
+		if typeRowErr := validateTypeRowOptions(payload.TypeRow, payload.HasHeader, payload.AllVarchar); typeRowErr != nil {
+			c.JSON(http.StatusBadRequest, CSVErrorResponse{
+				Errors: []CSVError{*typeRowErr},
+			})
+			return
+		}
+
+		log.Info("CSV preview request received",
+			slog.String("remote_addr", c.ClientIP()),
+			slog.String("filename", payload.CSVFile.Filename),
+			slog.Int64("content_length", c.Request.ContentLength),
+		)
+
+		// Use a unique temp file name so previews never clash with concurrent uploads
+		tempName := "preview_" + strings.ReplaceAll(uuid.New().String(), "-", "")
+		tempFilePath, validationErrors, err := s.processCsvFileFromHeader(ctx, payload.CSVFile, tempName, payload.HasHeader, payload.FileEncoding, payload.SkipRows, RaggedRows{
+			TrimTrailingDelimiter: payload.TrimTrailingDelimiter,
+			NullPadding:           payload.NullPadding,
+		}, false, false)
+		if err != nil {
+			log.Info("Error processing CSV file for preview", slog.Any("error", err))
+
+			if strings.Contains(err.Error(), "file too large") {
+				c.JSON(http.StatusRequestEntityTooLarge, CSVErrorResponse{
+					Errors: validationErrors,
+				})
+				return
+			}
+			if errors.Is(err, errDiskFull) {
+				c.JSON(http.StatusInsufficientStorage, CSVErrorResponse{
+					Errors: validationErrors,
+				})
+				return
+			}
+
+			c.JSON(http.StatusBadRequest, CSVErrorResponse{
+				Errors: validationErrors,
+			})
+			return
+		}
+		defer s.cleanupTempFile(ctx, tempFilePath)
+
+		options := database.CSVImportOptions{
+			DateFormat:      payload.DateFormat,
+			TimestampFormat: payload.TimestampFormat,
+			SkipRows:        payload.SkipRows,
+			AllVarchar:      payload.AllVarchar,
+			NullPadding:     payload.NullPadding,
+		}
+		if payload.TypeRow {
+			columnTypes, typeRowErr := readTypeRow(tempFilePath, payload.SkipRows)
+			if typeRowErr != nil {
+				log.Info("Invalid type row", slog.String("message", typeRowErr.Message))
+				c.JSON(http.StatusBadRequest, CSVErrorResponse{
+					Errors: []CSVError{*typeRowErr},
+				})
+				return
+			}
+			options.ColumnTypes = columnTypes
+		}
+		preview, err := s.db.PreviewCSV(ctx, tempFilePath, payload.HasHeader, options, PreviewRowLimit)
+		if err != nil {
+			log.Info("Error previewing CSV file", slog.Any("error", err))
+			c.JSON(http.StatusUnprocessableEntity, CSVErrorResponse{
+				Errors: []CSVError{{
+					Code:    "PREVIEW_FAILED",
+					Message: fmt.Sprintf("Failed to parse CSV file: %v", err),
+					Details: CSVErrorDetail{
+						Line:       0,
+						Suggestion: suggestionMap["PREVIEW_FAILED"],
+					},
+				}},
+			})
+			return
+		}
+
+		log.Info("CSV preview completed",
+			slog.Int("column_count", len(preview.Columns)),
+			slog.Int("row_count", len(preview.Rows)),
+		)
+
+		c.JSON(http.StatusOK, CSVPreviewResponse{
+			Columns: preview.Columns,
+			Rows:    preview.Rows,
+		})
+	}
+}
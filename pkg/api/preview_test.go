@@ -0,0 +1,127 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// newMultipartRequest builds a multipart form request with the given fields and CSV file
+func newMultipartRequest(t *testing.T, url string, fields map[string]string, filename string, content []byte) *http.Request {
+	t.Helper()
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for key, value := range fields {
+		if err := writer.WriteField(key, value); err != nil {
+			t.Fatalf("failed to write field %s: %v", key, err)
+		}
+	}
+	if filename != "" {
+		part, err := writer.CreateFormFile("csv_file", filename)
+		if err != nil {
+			t.Fatalf("failed to create form file: %v", err)
+		}
+		if _, err := part.Write(content); err != nil {
+			t.Fatalf("failed to write csv data: %v", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("failed to close multipart writer: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, url, body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
+
+func TestHandleCSVPreview(t *testing.T) {
+	s, db := newTablesTestServer(t)
+
+	var csvData strings.Builder
+	csvData.WriteString("id,username,joined\n")
+	for i := 1; i <= 15; i++ {
+		fmt.Fprintf(&csvData, "%d,user%d,2024-01-%02d\n", i, i, i)
+	}
+
+	req := newMultipartRequest(t, "/api/v1/upload/preview", map[string]string{"has_header": "true"}, "test_preview.csv", []byte(csvData.String()))
+	rec := httptest.NewRecorder()
+	s.Router().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d, body: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+
+	var response CSVPreviewResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+
+	expectedColumns := []map[string]any{
+		{"name": "id", "type": "BIGINT"},
+		{"name": "username", "type": "VARCHAR"},
+		{"name": "joined", "type": "DATE"},
+	}
+	if len(response.Columns) != len(expectedColumns) {
+		t.Fatalf("Expected %d columns, got %d: %v", len(expectedColumns), len(response.Columns), response.Columns)
+	}
+	for i, expected := range expectedColumns {
+		if response.Columns[i]["name"] != expected["name"] || response.Columns[i]["type"] != expected["type"] {
+			t.Errorf("Expected column %v, got %v", expected, response.Columns[i])
+		}
+	}
+
+	if len(response.Rows) != PreviewRowLimit {
+		t.Fatalf("Expected %d rows, got %d", PreviewRowLimit, len(response.Rows))
+	}
+	if response.Rows[0]["username"] != "user1" {
+		t.Errorf("Expected first row username user1, got %v", response.Rows[0]["username"])
+	}
+
+	// Previewing must not create any table
+	result, err := db.ExecuteQuery(context.Background(), "SELECT COUNT(*) AS table_count FROM information_schema.tables WHERE table_schema = 'main'")
+	if err != nil {
+		t.Fatalf("Failed to list tables: %v", err)
+	}
+	if count := result.Results[0]["table_count"]; count != int64(1) {
+		t.Errorf("Expected only the seeded table, got %v tables", count)
+	}
+
+	// The temporary file must be removed
+	entries, err := os.ReadDir(os.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to read temp dir: %v", err)
+	}
+	for _, entry := range entries {
+		if strings.Contains(entry.Name(), "preview_") {
+			t.Errorf("Expected preview temp file to be removed, found %s", entry.Name())
+		}
+	}
+}
+
+func TestHandleCSVPreviewMissingFile(t *testing.T) {
+	s, _ := newTablesTestServer(t)
+
+	req := newMultipartRequest(t, "/api/v1/upload/preview", map[string]string{"has_header": "true"}, "", nil)
+	rec := httptest.NewRecorder()
+	s.Router().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status %d, got %d, body: %s", http.StatusBadRequest, rec.Code, rec.Body.String())
+	}
+
+	var response CSVErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if len(response.Errors) != 1 || response.Errors[0].Code != "INVALID_REQUEST_PARAMETERS" {
+		t.Errorf("Expected INVALID_REQUEST_PARAMETERS error, got %v", response.Errors)
+	}
+}
@@ -0,0 +1,120 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// problemJSONContentType is the media type of RFC 7807 problem details
+const problemJSONContentType = "application/problem+json"
+
+// acceptsProblemJSON reports whether an Accept header lists application/problem+json
+func acceptsProblemJSON(accept string) bool {
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(mediaRange))
+		if err == nil && mediaType == problemJSONContentType && params["q"] != "0" {
+			return true
+		}
+	}
+	return false
+}
+
+// problemWriter holds back the body of error responses so problemJSONMiddleware can
+// render it as problem details once the handler is done. Other responses, including
+// streamed ones, are written through.
+type problemWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *problemWriter) Write(data []byte) (int, error) {
+	if w.Status() >= http.StatusBadRequest {
+		return w.body.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *problemWriter) WriteString(s string) (int, error) {
+	if w.Status() >= http.StatusBadRequest {
+		return w.body.WriteString(s)
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+// problemJSONMiddleware renders error responses as RFC 7807 problem details for requests
+// that accept application/problem+json. The error code of an ErrorResponse, or of the
+// first error of a CSVErrorResponse, is kept in the code member and every CSV error in the
+// errors member. Without the Accept header responses keep their usual format.
+func problemJSONMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !acceptsProblemJSON(c.GetHeader("Accept")) {
+			c.Next()
+			return
+		}
+
+		writer := &problemWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+		c.Writer = writer.ResponseWriter
+
+		// Bodyless errors, such as responses to HEAD requests, are left as they are
+		if writer.body.Len() == 0 {
+			return
+		}
+
+		problem := newProblemDetails(writer.Status(), writer.body.Bytes())
+		problem.Instance = c.Request.URL.Path
+		body, err := json.Marshal(problem)
+		if err != nil {
+			getLoggerFromGinContext(c).Error("Failed to render problem details", slog.Any("error", err))
+			_, _ = c.Writer.Write(writer.body.Bytes())
+			return
+		}
+		// Data keeps the content type set by the handler, so it is replaced first
+		c.Header("Content-Type", problemJSONContentType)
+		c.Data(writer.Status(), problemJSONContentType, body)
+	}
+}
+
+// newProblemDetails builds the problem details of an error response from its body, which
+// is an ErrorResponse, a CSVErrorResponse, another JSON object with a message or plain text
+func newProblemDetails(status int, body []byte) ProblemDetails {
+	problem := ProblemDetails{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+	}
+
+	var response struct {
+		Code    string     `json:"code"`
+		Message string     `json:"message"`
+		Error   string     `json:"error"`
+		Errors  []CSVError `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		problem.Detail = strings.TrimSpace(string(body))
+		return problem
+	}
+
+	problem.Code = response.Code
+	problem.Detail = response.Message
+	if problem.Detail == "" {
+		problem.Detail = response.Error
+	}
+	if len(response.Errors) > 0 {
+		problem.Errors = response.Errors
+		if problem.Code == "" {
+			problem.Code = response.Errors[0].Code
+		}
+		if problem.Detail == "" {
+			problem.Detail = response.Errors[0].Message
+		}
+	}
+	return problem
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAcceptsProblemJSON(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   bool
+	}{
+		{accept: "", want: false},
+		{accept: "application/json", want: false},
+		{accept: "application/problem+json", want: true},
+		{accept: "application/json, Application/Problem+JSON; q=0.9", want: true},
+		{accept: "application/problem+json;q=0", want: false},
+		{accept: "*/*", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := acceptsProblemJSON(tt.accept); got != tt.want {
+			t.Errorf("acceptsProblemJSON(%q) = %v, want %v", tt.accept, got, tt.want)
+		}
+	}
+}
+
+func TestProblemJSONErrors(t *testing.T) {
+	s, _ := newTablesTestServer(t)
+
+	serveProblem := func(req *http.Request) (*httptest.ResponseRecorder, ProblemDetails) {
+		t.Helper()
+		req.Header.Set("Accept", "application/problem+json")
+		rec := httptest.NewRecorder()
+		s.Router().ServeHTTP(rec, req)
+
+		if contentType := rec.Header().Get("Content-Type"); contentType != problemJSONContentType {
+			t.Errorf("Expected %s content type, got %q", problemJSONContentType, contentType)
+		}
+		var problem ProblemDetails
+		if err := json.Unmarshal(rec.Body.Bytes(), &problem); err != nil {
+			t.Fatalf("Failed to parse problem details: %v, body: %s", err, rec.Body.String())
+		}
+		return rec, problem
+	}
+
+	// An ErrorResponse
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/query", strings.NewReader(`{"query": " ; "}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec, problem := serveProblem(req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status %d, got %d, body: %s", http.StatusBadRequest, rec.Code, rec.Body.String())
+	}
+	if problem.Type != "about:blank" || problem.Title != "Bad Request" || problem.Status != http.StatusBadRequest ||
+		problem.Code != "EMPTY_QUERY" || problem.Detail != emptyQueryResponse.Message || problem.Instance != "/api/v1/query" {
+		t.Errorf("Unexpected problem details: %+v", problem)
+	}
+
+	// A CSVErrorResponse
+	req = newMultipartRequest(t, "/api/v1/upload", map[string]string{"table_name": "data"}, "", nil)
+	rec, problem = serveProblem(req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status %d, got %d, body: %s", http.StatusBadRequest, rec.Code, rec.Body.String())
+	}
+	if problem.Status != http.StatusBadRequest || problem.Code != "INVALID_REQUEST_PARAMETERS" ||
+		len(problem.Errors) != 1 || problem.Detail != problem.Errors[0].Message {
+		t.Errorf("Unexpected problem details: %+v", problem)
+	}
+
+	// Successful responses keep their format
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/tables", nil)
+	req.Header.Set("Accept", "application/problem+json")
+	rec = httptest.NewRecorder()
+	s.Router().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"tables"`) {
+		t.Errorf("Expected the usual tables response, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestProblemJSONDefaultFormat(t *testing.T) {
+	s, _ := newTablesTestServer(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/query", strings.NewReader(`{"query": " ; "}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	s.Router().ServeHTTP(rec, req)
+
+	if contentType := rec.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "application/json") {
+		t.Errorf("Expected a JSON content type, got %q", contentType)
+	}
+	var response ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if response.Status != "error" || response.Code != "EMPTY_QUERY" {
+		t.Errorf("Expected the usual error response, got %+v", response)
+	}
+}
@@ -0,0 +1,144 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/aliengiraffe/spotdb/pkg/helpers"
+	"github.com/gin-gonic/gin"
+)
+
+// uploadTempPrefix is the name prefix of the temporary files and directories uploads are
+// written to before they are imported
+const uploadTempPrefix = "upload_"
+
+// multipartTempPrefix is the name prefix of the temporary files mime/multipart writes the
+// parts of a request that do not fit in ENV_MULTIPART_MEMORY to
+const multipartTempPrefix = "multipart-"
+
+// checkDiskQuota reports whether an upload of incoming bytes fits in ENV_MAX_TOTAL_DISK,
+// counting the database, the files of views and the temporary files of the requests in
+// progress. Otherwise it writes a 413 DISK_QUOTA_EXCEEDED response. When the usage cannot
+// be measured the upload is rejected with 503 DISK_QUOTA_CHECK_FAILED, since letting it
+// through could fill the disk the limit protects.
+func (s *Server) checkDiskQuota(c *gin.Context, incoming int64) bool {
+	maxDisk := helpers.GetMaxTotalDisk()
+	if maxDisk == 0 {
+		return true
+	}
+
+	ctx := c.Request.Context()
+	log := getLoggerFromGinContext(c)
+
+	used, err := s.diskUsage(ctx)
+	if err != nil {
+		log.Error("Could not measure disk usage, rejecting the upload", slog.Any("error", err))
+		c.JSON(http.StatusServiceUnavailable, CSVErrorResponse{
+			Errors: []CSVError{{
+				Code:    "DISK_QUOTA_CHECK_FAILED",
+				Message: "Could not measure disk usage to enforce the disk quota: " + err.Error(),
+				Details: CSVErrorDetail{
+					Line:       0,
+					Suggestion: suggestionMap["DISK_QUOTA_CHECK_FAILED"],
+				},
+			}},
+		})
+		return false
+	}
+	if used+incoming <= maxDisk {
+		return true
+	}
+
+	log.Warn("Upload rejected by the disk quota",
+		slog.Int64("used_bytes", used),
+		slog.Int64("incoming_bytes", incoming),
+		slog.Int64("max_bytes", maxDisk))
+	c.JSON(http.StatusRequestEntityTooLarge, CSVErrorResponse{
+		Errors: []CSVError{{
+			Code: "DISK_QUOTA_EXCEEDED",
+			Message: fmt.Sprintf("Upload of %d bytes would exceed the disk quota: %d of %d bytes in use",
+				incoming, used, maxDisk),
+			Details: CSVErrorDetail{
+				Line:       0,
+				Suggestion: suggestionMap["DISK_QUOTA_EXCEEDED"],
+			},
+		}},
+	})
+	return false
+}
+
+// diskUsage returns the bytes taken by the database, including the files DuckDB spills
+// to, the files of views and the temporary upload and multipart files
+func (s *Server) diskUsage(ctx context.Context) (int64, error) {
+	dbSize, err := s.db.DiskSize(ctx)
+	if err != nil {
+		return 0, err
+	}
+	tempSize, err := tempFilesUsage(os.TempDir(), uploadTempPrefix, multipartTempPrefix)
+	if err != nil {
+		return 0, err
+	}
+	viewsSize, err := dirUsage(helpers.GetViewFilesDir())
+	if err != nil {
+		return 0, fmt.Errorf("failed to measure view files: %w", err)
+	}
+	return dbSize + tempSize + viewsSize, nil
+}
+
+// tempFilesUsage returns the size of the regular files under dir whose top-level entry
+// starts with one of prefixes
+func tempFilesUsage(dir string, prefixes ...string) (int64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read temporary directory: %w", err)
+	}
+
+	var total int64
+	for _, entry := range entries {
+		if !slices.ContainsFunc(prefixes, func(prefix string) bool { return strings.HasPrefix(entry.Name(), prefix) }) {
+			continue
+		}
+		size, err := dirUsage(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return 0, fmt.Errorf("failed to measure temporary files: %w", err)
+		}
+		total += size
+	}
+	return total, nil
+}
+
+// dirUsage returns the size of the regular files under path, which may be a single file.
+// Files that disappear while they are counted, as requests finish, are skipped, and a
+// missing path takes no space.
+func dirUsage(path string) (int64, error) {
+	var total int64
+	err := filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		// Streamed uploads go through a named pipe, which takes no space
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		total += info.Size()
+		return nil
+	})
+	return total, err
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestTempFilesUsage(t *testing.T) {
+	dir := t.TempDir()
+	for name, size := range map[string]int{
+		"upload_main_sales.csv":            100,
+		"upload_stream_123/sample.csv":     20,
+		"multipart-4242":                   300,
+		"duckdb_0f7a.db":                   1000,
+		"spotdb_export_456/main/sales.csv": 1000,
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, make([]byte, size), 0o600); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	used, err := tempFilesUsage(dir, uploadTempPrefix, multipartTempPrefix)
+	if err != nil {
+		t.Fatalf("Failed to measure usage: %v", err)
+	}
+	if used != 420 {
+		t.Errorf("Expected 420 bytes of upload and multipart files, got %d", used)
+	}
+
+	if used, err := dirUsage(filepath.Join(dir, "missing")); err != nil || used != 0 {
+		t.Errorf("Expected a missing directory to take no space, got %d and %v", used, err)
+	}
+}
+
+func TestUploadDiskQuota(t *testing.T) {
+	s, _ := newTablesTestServer(t)
+
+	upload := func() *httptest.ResponseRecorder {
+		t.Helper()
+		fields := map[string]string{"table_name": "quota", "has_header": "true"}
+		req := newMultipartRequest(t, "/api/v1/upload", fields, "quota.csv", []byte("id,name\n1,alice\n"))
+		rec := httptest.NewRecorder()
+		s.Router().ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Setenv("ENV_MAX_TOTAL_DISK", "1")
+	rec := upload()
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("Expected status %d, got %d, body: %s", http.StatusRequestEntityTooLarge, rec.Code, rec.Body.String())
+	}
+	var response CSVErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if len(response.Errors) != 1 || response.Errors[0].Code != "DISK_QUOTA_EXCEEDED" {
+		t.Errorf("Expected DISK_QUOTA_EXCEEDED, got %+v", response.Errors)
+	}
+
+	t.Setenv("ENV_MAX_TOTAL_DISK", "1073741824")
+	if rec := upload(); rec.Code != http.StatusOK {
+		t.Errorf("Expected status %d under the quota, got %d, body: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+
+	// The files of views count towards the quota
+	viewsDir := t.TempDir()
+	t.Setenv("ENV_VIEW_FILES_DIR", viewsDir)
+	used, err := s.diskUsage(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to measure disk usage: %v", err)
+	}
+	t.Setenv("ENV_MAX_TOTAL_DISK", strconv.FormatInt(used+64*1024, 10))
+	if err := os.WriteFile(filepath.Join(viewsDir, "events.parquet"), make([]byte, 128*1024), 0o600); err != nil {
+		t.Fatalf("Failed to write view file: %v", err)
+	}
+	if rec := upload(); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected view files to count towards the quota, got %d, body: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestUploadDiskQuotaFailsClosed(t *testing.T) {
+	s, _ := newTablesTestServer(t)
+	t.Setenv("ENV_MAX_TOTAL_DISK", "1073741824")
+	// The temporary directory cannot be read, so the usage cannot be measured
+	t.Setenv("TMPDIR", filepath.Join(t.TempDir(), "missing"))
+
+	fields := map[string]string{"table_name": "quota", "has_header": "true"}
+	req := newMultipartRequest(t, "/api/v1/upload", fields, "quota.csv", []byte("id,name\n1,alice\n"))
+	rec := httptest.NewRecorder()
+	s.Router().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected status %d, got %d, body: %s", http.StatusServiceUnavailable, rec.Code, rec.Body.String())
+	}
+	var response CSVErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if len(response.Errors) != 1 || response.Errors[0].Code != "DISK_QUOTA_CHECK_FAILED" {
+		t.Errorf("Expected DISK_QUOTA_CHECK_FAILED, got %+v", response.Errors)
+	}
+}
@@ -0,0 +1,140 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+// RaggedRows relaxes the column count check for records that do not have as many fields
+// as the first one. The zero value is strict.
+type RaggedRows struct {
+	// TrimTrailingDelimiter tolerates a single extra empty field after the last column,
+	// left by exports that end every line with the delimiter
+	TrimTrailingDelimiter bool
+	// NullPadding tolerates records with fewer fields, whose missing columns are imported
+	// as NULL
+	NullPadding bool
+}
+
+// strict reports whether records must all have the same number of fields
+func (r RaggedRows) strict() bool {
+	return !r.TrimTrailingDelimiter && !r.NullPadding
+}
+
+// accepts reports whether a record of count fields, whose last field is lastEmpty, fits
+// expected columns
+func (r RaggedRows) accepts(count, expected int, lastEmpty bool) bool {
+	switch {
+	case count == expected:
+		return true
+	case count == expected+1:
+		return r.TrimTrailingDelimiter && lastEmpty
+	case count < expected:
+		return r.NullPadding
+	}
+	return false
+}
+
+// peekDelimiter detects the delimiter from the start of the data read from reader and
+// returns it with the reader to continue from
+func peekDelimiter(reader io.Reader) (rune, io.Reader) {
+	buffered := bufio.NewReaderSize(reader, MaxSampleSize)
+	// A short sample is expected for small files, read errors surface again while copying
+	sample, _ := buffered.Peek(MaxSampleSize)
+
+	delimiter, err := DetectDelimiterFromData(sample)
+	if err != nil {
+		delimiter = ','
+	}
+	return delimiter, buffered
+}
+
+// trailingDelimiterWriter drops the delimiter ending a record when it leaves a single
+// empty field after the last column, for trim_trailing_delimiter. The first record sets
+// the column count, after dropping its own trailing delimiter, and the other records are
+// only trimmed when they have one field more. Quoted fields may span lines.
+type trailingDelimiterWriter struct {
+	dst       io.Writer
+	delimiter byte
+
+	record   []byte
+	inQuote  bool
+	fields   int
+	expected int
+}
+
+// startTrailingDelimiterTrim detects the delimiter from the start of the data read from
+// reader and returns a writer trimming the records written to dst, with the reader to
+// continue copying from
+func startTrailingDelimiterTrim(dst io.Writer, reader io.Reader) (*trailingDelimiterWriter, io.Reader) {
+	delimiter, reader := peekDelimiter(reader)
+	return newTrailingDelimiterWriter(dst, delimiter), reader
+}
+
+// newTrailingDelimiterWriter returns a writer that trims records delimited by delimiter
+// before passing them on to dst
+func newTrailingDelimiterWriter(dst io.Writer, delimiter rune) *trailingDelimiterWriter {
+	return &trailingDelimiterWriter{dst: dst, delimiter: byte(delimiter)}
+}
+
+// Write passes the complete records in p on to the destination, holding back the last
+// one until its end is written
+func (w *trailingDelimiterWriter) Write(p []byte) (int, error) {
+	for _, c := range p {
+		w.record = append(w.record, c)
+		switch {
+		case c == '"':
+			w.inQuote = !w.inQuote
+		case c == w.delimiter && !w.inQuote:
+			w.fields++
+		case c == '\n' && !w.inQuote:
+			if err := w.endRecord(); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return len(p), nil
+}
+
+// Close writes the last record, which may not end with a newline
+func (w *trailingDelimiterWriter) Close() error {
+	if len(w.record) == 0 {
+		return nil
+	}
+	return w.endRecord()
+}
+
+// endRecord writes the completed record, without its trailing delimiter when it has one
+// field more than the first record
+func (w *trailingDelimiterWriter) endRecord() error {
+	record := w.record
+	count := w.fields + 1
+	w.record, w.fields = w.record[:0], 0
+
+	content := bytes.TrimRight(record, "\r\n")
+	if len(content) == 0 {
+		_, err := w.dst.Write(record)
+		return err
+	}
+
+	trailing := count > 1 && content[len(content)-1] == w.delimiter
+	if w.expected == 0 {
+		w.expected = count
+		if trailing {
+			w.expected--
+		}
+	} else {
+		trailing = trailing && count == w.expected+1
+	}
+	if !trailing {
+		_, err := w.dst.Write(record)
+		return err
+	}
+
+	if _, err := w.dst.Write(content[:len(content)-1]); err != nil {
+		return err
+	}
+	_, err := w.dst.Write(record[len(content):])
+	return err
+}
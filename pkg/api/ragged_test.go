@@ -0,0 +1,78 @@
+package api
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestTrailingDelimiterWriter(t *testing.T) {
+	tests := []struct {
+		name      string
+		delimiter rune
+		data      string
+		want      string
+	}{
+		{name: "trailing delimiter on every line", delimiter: ',', data: "id,city,\n1,Paris,\n2,Lyon,\n", want: "id,city\n1,Paris\n2,Lyon\n"},
+		{name: "trailing delimiter on some rows", delimiter: ',', data: "id,city\n1,Paris,\n2,Lyon\n", want: "id,city\n1,Paris\n2,Lyon\n"},
+		{name: "empty last column kept", delimiter: ',', data: "id,city\n1,\n2,Lyon\n", want: "id,city\n1,\n2,Lyon\n"},
+		{name: "CRLF and no trailing newline", delimiter: ';', data: "id;city;\r\n1;Paris;\r\n2;Lyon;", want: "id;city\r\n1;Paris\r\n2;Lyon"},
+		{name: "quoted delimiter and newline", delimiter: ',', data: "id,note\n1,\"a,\nb,\",\n", want: "id,note\n1,\"a,\nb,\"\n"},
+		{name: "extra value kept", delimiter: ',', data: "id,city\n1,Paris,x\n", want: "id,city\n1,Paris,x\n"},
+		{name: "blank lines kept", delimiter: ',', data: "id,city,\n\n1,Paris,\n", want: "id,city\n\n1,Paris\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var dst bytes.Buffer
+			w := newTrailingDelimiterWriter(&dst, tt.delimiter)
+
+			// Write in small chunks so records span writes
+			for i := 0; i < len(tt.data); i += 3 {
+				if _, err := w.Write([]byte(tt.data[i:min(i+3, len(tt.data))])); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if dst.String() != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, dst.String())
+			}
+		})
+	}
+}
+
+func TestValidateCSVFileFromDataRaggedRows(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      string
+		ragged    RaggedRows
+		wantValid bool
+	}{
+		{name: "trailing delimiter rejected by default", data: "id,city\n1,Paris,\n2,Lyon,\n"},
+		{name: "trailing delimiter tolerated", data: "id,city\n1,Paris,\n2,Lyon,\n", ragged: RaggedRows{TrimTrailingDelimiter: true}, wantValid: true},
+		{name: "trailing value rejected", data: "id,city\n1,Paris,x\n", ragged: RaggedRows{TrimTrailingDelimiter: true}},
+		{name: "short row rejected by default", data: "id,city,zip\n1,Paris,75001\n2,Lyon\n"},
+		{name: "short row tolerated", data: "id,city,zip\n1,Paris,75001\n2,Lyon\n", ragged: RaggedRows{NullPadding: true}, wantValid: true},
+		{name: "both", data: "id,city,zip,\n1,Paris,75001,\n2,Lyon\n", ragged: RaggedRows{TrimTrailingDelimiter: true, NullPadding: true}, wantValid: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := ValidateCSVFileFromData([]byte(tt.data), 2, tt.ragged)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result.Valid != tt.wantValid {
+				t.Errorf("Expected valid=%v, got %v (%s)", tt.wantValid, result.Valid, result.ErrorMessage)
+			}
+			if !tt.wantValid && result.ErrorMessage == "" {
+				t.Error("Expected an error message")
+			}
+			if tt.wantValid && strings.Contains(result.ErrorMessage, "inconsistent") {
+				t.Errorf("Unexpected error message %q", result.ErrorMessage)
+			}
+		})
+	}
+}
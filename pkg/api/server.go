@@ -1,17 +1,24 @@
 package api
 
 import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
 	"os"
-	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/aliengiraffe/spotdb/pkg/database"
 	"github.com/aliengiraffe/spotdb/pkg/helpers"
+	applog "github.com/aliengiraffe/spotdb/pkg/log"
 	"github.com/aliengiraffe/spotdb/pkg/snapshot"
 	"github.com/gin-gonic/gin"
 	"github.com/gin-gonic/gin/binding"
@@ -20,22 +27,68 @@ import (
 
 // Server represents the HTTP API server
 type Server struct {
-	db     *database.DuckDB
-	router *gin.Engine
+	db          *database.DuckDB
+	connections ConnectionCounter
+	router      *gin.Engine
+	// requestLogs keeps the log entries of each request, nil unless capture is enabled
+	requestLogs *applog.RequestLogStore
+	// encodingMismatches counts uploads whose detected encoding differed from the declared one
+	encodingMismatches atomic.Int64
+	// maintenance blocks writes through the API while set, nil outside maintenance windows
+	maintenance atomic.Pointer[maintenanceWindow]
 }
 
-// NewServer creates a new HTTP API server
-func NewServer(db *database.DuckDB, log *slog.Logger) *http.Server {
+// NewServer creates a new HTTP API server. connections reports the open socket
+// connections in the admin activity endpoint and may be nil.
+func NewServer(db *database.DuckDB, log *slog.Logger, connections ConnectionCounter) *http.Server {
 	app := &Server{
-		db: db,
+		db:          db,
+		connections: connections,
 	}
 
 	app.setupRouter(log)
 
-	return &http.Server{
-		Addr:    ":8080",
-		Handler: app.Router(),
+	// Bound how long slow clients can hold a connection, long-running routes lift the
+	// write timeout with withoutWriteTimeout
+	timeouts := helpers.GetHTTPTimeouts()
+	log.Info("HTTP server timeouts",
+		slog.Duration("read_header", timeouts.ReadHeader),
+		slog.Duration("read", timeouts.Read),
+		slog.Duration("write", timeouts.Write),
+		slog.Duration("idle", timeouts.Idle))
+
+	srv := &http.Server{
+		Addr:              ":8080",
+		Handler:           app.Router(),
+		ReadHeaderTimeout: timeouts.ReadHeader,
+		ReadTimeout:       timeouts.Read,
+		WriteTimeout:      timeouts.Write,
+		IdleTimeout:       timeouts.Idle,
 	}
+	configureProtocols(srv, helpers.GetHTTPProtocols(), log)
+	return srv
+}
+
+// configureProtocols applies the HTTP/2 and keep-alive settings to the server. Over TLS Go
+// negotiates HTTP/2 by itself, cleartext HTTP/2 is only accepted when enabled, so plain
+// HTTP/1.1 serving is unchanged unless configured.
+func configureProtocols(srv *http.Server, protocols helpers.HTTPProtocols, log *slog.Logger) {
+	if protocols.CleartextHTTP2 {
+		srv.Protocols = new(http.Protocols)
+		srv.Protocols.SetHTTP1(true)
+		srv.Protocols.SetHTTP2(true)
+		srv.Protocols.SetUnencryptedHTTP2(true)
+	}
+	if protocols.MaxConcurrentStreams > 0 {
+		srv.HTTP2 = &http.HTTP2Config{MaxConcurrentStreams: protocols.MaxConcurrentStreams}
+	}
+	srv.SetKeepAlivesEnabled(protocols.KeepAlives)
+
+	log.Info("HTTP server protocols",
+		slog.Bool("tls", protocols.TLSEnabled()),
+		slog.Bool("http2", protocols.TLSEnabled() || protocols.CleartextHTTP2),
+		slog.Bool("h2c", protocols.CleartextHTTP2),
+		slog.Bool("keep_alives", protocols.KeepAlives))
 }
 
 // setupRouter configures the HTTP router
@@ -49,6 +102,9 @@ func (s *Server) setupRouter(log *slog.Logger) {
 
 	// Create a new Gin router
 	r := gin.New()
+	r.MaxMultipartMemory = helpers.GetMultipartMemory()
+	// Resolve the real client IP only behind explicitly trusted proxies
+	configureTrustedProxies(r, log)
 	// Configure middlewares
 	s.setupMiddlewares(r, log)
 
@@ -56,7 +112,7 @@ func (s *Server) setupRouter(log *slog.Logger) {
 	s.setupHealthEndpoints(r)
 
 	// Configure API routes
-	s.setupAPIRoutes(r)
+	s.setupAPIRoutes(r, log)
 
 	s.router = r
 }
@@ -71,9 +127,25 @@ func (s *Server) setupMiddlewares(r *gin.Engine, log *slog.Logger) {
 	// of the request processing
 	r.Use(ginLoggerMiddleware(log))
 
+	// Tag the request with an ID so its queries can be identified in the admin activity
+	r.Use(requestIDMiddleware())
+
+	// Keep the log entries of each request for the admin request logs endpoint, which is
+	// only served with the admin endpoints, so nothing is captured without them
+	if helpers.IsRequestLogCaptureEnabled() && helpers.IsAdminAPIEnabled() {
+		s.requestLogs = applog.NewRequestLogStore(helpers.GetRequestLogTTL())
+		r.Use(s.requestLogCaptureMiddleware())
+	}
+
 	// Add CORS middleware early in the chain
 	r.Use(corsMiddleware())
 
+	// Render errors as RFC 7807 problem details for clients that ask for them
+	r.Use(problemJSONMiddleware())
+
+	// Wrap successful JSON responses in a uniform envelope when enabled
+	r.Use(envelopeMiddleware())
+
 	r.Use(gin.Recovery())
 
 	// Set up custom defaults for form-based binding
@@ -121,7 +193,7 @@ func (s *Server) setupHealthEndpoints(r *gin.Engine) {
 
 // @externalDocs.description	OpenAPI
 // @externalDocs.url			https://swagger.io/resources/open-api/
-func (s *Server) setupAPIRoutes(r *gin.Engine) {
+func (s *Server) setupAPIRoutes(r *gin.Engine, log *slog.Logger) {
 	// Serve the web UI at /explorer
 	r.GET("/explorer", func(c *gin.Context) {
 		c.File("./static/index.html")
@@ -131,16 +203,79 @@ func (s *Server) setupAPIRoutes(r *gin.Engine) {
 
 	{
 		// Upload endpoint
-		v1.POST("/upload", s.handleCSVUpload())
+		v1.POST("/upload", requireFullAccess(), s.requireWritableDatabase(), withoutWriteTimeout(), s.handleCSVUpload())
+
+		// Upload preview endpoint
+		v1.POST("/upload/preview", s.handleCSVPreview())
 
 		// Query endpoint
-		v1.POST("/query", s.handleQuery())
+		v1.POST("/query", queryConcurrencyMiddleware(log), s.handleQuery())
+
+		// Query validation endpoint
+		v1.POST("/query/validate", s.handleValidateQuery())
 
 		// Tables endpoint
 		v1.GET("/tables", s.handleListTables())
 
+		// Create table from query endpoint
+		v1.POST("/tables", requireFullAccess(), s.requireWritableDatabase(), s.handleCreateTable())
+
+		// Bulk table deletion by name prefix endpoint
+		v1.DELETE("/tables", requireFullAccess(), s.requireWritableDatabase(), bulkDeleteRateLimitMiddleware(log), s.handleDropTablesByPrefix())
+
+		// Create view over a file endpoint
+		v1.POST("/views", requireFullAccess(), s.requireWritableDatabase(), withoutWriteTimeout(), s.handleCreateView())
+
+		// Materialize a view into a table endpoint
+		v1.POST("/views/:name/materialize", requireFullAccess(), s.requireWritableDatabase(), withoutWriteTimeout(), s.handleMaterializeView())
+
+		// Table existence check endpoint
+		v1.HEAD("/tables/:name", requireUnscopedAccess(), s.handleTableHead())
+
+		// Table DDL endpoint
+		v1.GET("/tables/:name/ddl", s.handleTableDDL())
+
+		// Random table sample endpoint
+		v1.GET("/tables/:name/sample", requireUnscopedAccess(), s.handleTableSample())
+
+		// First and last table rows endpoints
+		v1.GET("/tables/:name/head", requireUnscopedAccess(), s.handleTableHeadRows())
+		v1.GET("/tables/:name/tail", requireUnscopedAccess(), s.handleTableTailRows())
+
+		// Column type refinement endpoint
+		v1.POST("/tables/:name/refine_types", requireUnscopedAccess(), s.handleRefineTypes())
+
+		// Row filter endpoints, scoping the queries of tenant API keys
+		v1.PUT("/tables/:name/row_filter", requireFullAccess(), s.requireWritableDatabase(), s.handleSetRowFilter())
+		v1.DELETE("/tables/:name/row_filter", requireFullAccess(), s.requireWritableDatabase(), s.handleDeleteRowFilter())
+
+		// Distinct column values endpoint
+		v1.GET("/tables/:name/columns/:col/distinct", requireUnscopedAccess(), s.handleDistinctValues())
+
+		// Export all tables endpoint
+		v1.GET("/export/all", requireUnscopedAccess(), withoutWriteTimeout(), s.handleExportAll())
+
+		// Export query results as Parquet files to object storage
+		v1.POST("/export/parquet", requireFullAccess(), withoutWriteTimeout(), s.handleExportParquet())
+
+		// Export a table to an S3 object through DuckDB
+		v1.POST("/tables/:name/export/s3", requireFullAccess(), requireUnscopedAccess(), withoutWriteTimeout(), s.handleExportTableS3())
+
 		// Snapshot endpoint
-		v1.POST("/snapshot", s.handleCreateSnapshot())
+		v1.POST("/snapshot", requireFullAccess(), s.requireNoMaintenance(), withoutWriteTimeout(), s.handleCreateSnapshot())
+
+		// DuckDB engine version and settings endpoint
+		v1.GET("/duckdb/info", s.handleDuckDBInfo())
+	}
+
+	// Admin endpoints expose operational details and are only served when enabled
+	if helpers.IsAdminAPIEnabled() {
+		admin := v1.Group("/admin", requireFullAccess())
+		admin.GET("/activity", s.handleAdminActivity())
+		admin.POST("/maintenance", s.handleAdminMaintenance())
+
+		// Captured log entries of a request
+		v1.GET("/requests/:id/logs", requireFullAccess(), s.handleRequestLogs())
 	}
 }
 
@@ -149,6 +284,18 @@ func (s *Server) Router() http.Handler {
 	return s.router
 }
 
+// isHiddenTable reports whether a table is left out of table listings because its name
+// starts with one of the hidden prefixes. Hidden tables can still be queried by name.
+func isHiddenTable(name string, hiddenPrefixes []string) bool {
+	name = strings.ToLower(name)
+	for _, prefix := range hiddenPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
 // handleListTables godoc
 //
 //	@Summary		List database tables with schema
@@ -175,11 +322,12 @@ func (s *Server) handleListTables() gin.HandlerFunc {
 		}
 
 		var tables []TableInfo
+		hiddenPrefixes := helpers.GetHiddenTablePrefixes()
 
 		// For each table, get its schema
 		for _, row := range tablesResult.Results {
 			tableName, ok := row["table_name"].(string)
-			if !ok {
+			if !ok || isHiddenTable(tableName, hiddenPrefixes) {
 				continue
 			}
 
@@ -225,21 +373,44 @@ func (s *Server) handleListTables() gin.HandlerFunc {
 //	@Description	Run a SQL query against the database
 //	@Tags			query
 //	@Accept			json
-//	@Produce		json
-//	@Param			benchmark	query		boolean					false	"Include benchmark metrics in response"
+//	@Produce		json,text/csv
+//	@Param			benchmark	query		boolean					false	"Include benchmark metrics in response (true or false)"
+//	@Param			count_only	query		boolean					false	"Only return the number of rows of a SELECT query"
+//	@Param			excel_compat	query	boolean					false	"Start CSV results with a UTF-8 BOM and end rows with \r\n for Excel"
+//	@Param			If-None-Match	header	string					false	"ETag of a previous result, answered with 304 when the tables it read are unchanged"
 //	@Param			query		body		api.QueryRequest		true	"SQL query to execute"
-//	@Success		200			{object}	map[string]interface{}	"Query results"
-//	@Failure		400			{object}	api.ErrorResponse		"Bad request (invalid query)"
+//	@Success		200			{object}	map[string]interface{}	"Query results, as CSV with a header row when the Accept header prefers text/csv"
+//	@Header			200			{integer}	X-Result-Rows			"Number of rows in the results"
+//	@Header			200			{integer}	X-Result-Bytes			"Size of the response body in bytes, a trailer for CSV results"
+//	@Header			200			{integer}	X-Query-Duration-Ms		"Execution time of the query in milliseconds"
+//	@Header			200			{string}	ETag					"Version of the result, derived from the versions of the tables read"
+//	@Success		304			{string}	string					"Result not modified since the ETag sent in If-None-Match"
+//	@Failure		400			{object}	api.ErrorResponse		"Bad request (invalid query, EMPTY_QUERY when it holds no statements, QUERY_TOO_LONG, or INVALID_BENCHMARK_PARAM)"
+//	@Failure		403			{object}	api.ErrorResponse		"Modifying statement with a read-only API key or database, or a query a tenant API key may not run, error code: READ_ONLY_API_KEY, READ_ONLY_MODE or TENANT_QUERY_REJECTED"
+//	@Failure		422			{object}	api.ErrorResponse		"Query rejected with error code: QUERY_TOO_EXPENSIVE"
+//	@Failure		429			{object}	api.ErrorResponse		"Too many concurrent queries with error code: TOO_MANY_QUERIES"
 //	@Failure		500			{object}	api.ErrorResponse		"Internal server error"
 //	@Router			/query [post]
 func (s *Server) handleQuery() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		log := getLoggerFromGinContext(c)
 
-		log.Info("Query request received", slog.String("remote_addr", c.Request.RemoteAddr))
+		log.Info("Query request received", slog.String("remote_addr", c.ClientIP()))
+
+		if !s.validateBenchmarkParam(c) {
+			return // Error response already sent
+		}
 
-		// Determine if benchmarks should be included in the response
-		includeBenchmarks := s.shouldIncludeBenchmarks(c)
+		// CSV has no room for benchmarks, so they are only gathered for JSON responses
+		wantsCSV := c.NegotiateFormat(gin.MIMEJSON, mimeCSV) == mimeCSV
+
+		// Determine if benchmarks should be included in the response, unless the server
+		// disables all benchmark work
+		includeBenchmarks := s.shouldIncludeBenchmarks(c) && !wantsCSV
+		benchmarksDisabled := includeBenchmarks && helpers.IsBenchmarkingDisabled()
+		if benchmarksDisabled {
+			includeBenchmarks = false
+		}
 
 		// Parse and validate the query request
 		query, limit, err := s.parseQueryRequest(c)
@@ -247,15 +418,85 @@ func (s *Server) handleQuery() gin.HandlerFunc {
 			return // Error response already sent
 		}
 
+		// Reject enormous queries before they are scanned, explained or prepared
+		if err := database.CheckQueryLength(query, helpers.GetMaxQueryLength()); err != nil {
+			log.Info("Rejected query", slog.Any("error", err))
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Status:  "error",
+				Code:    "QUERY_TOO_LONG",
+				Message: "Query rejected: " + err.Error() + ". Shorten the query or raise ENV_MAX_QUERY_LENGTH.",
+			})
+			return
+		}
+
+		// Read-only API keys may run queries but not modify data through them
+		readOnlyQuery := s.db.IsReadOnlyQuery(c.Request.Context(), query)
+		if isReadOnlyKey(c) && !readOnlyQuery {
+			rejectReadOnlyKey(c, "This API key can only run read-only statements such as SELECT")
+			return
+		}
+		if s.db.IsReadOnly() && !readOnlyQuery {
+			rejectReadOnlyMode(c)
+			return
+		}
+		if !readOnlyQuery && s.rejectDuringMaintenance(c) {
+			return
+		}
+
 		// Apply limit if specified and not already in the query
 		query = s.applyQueryLimit(query, limit)
 
+		// Tenant API keys only read the rows their row filters allow
+		if tenant := requestTenant(c); tenant != "" {
+			if query, err = s.scopeQueryToTenant(c, query, tenant); err != nil {
+				return // Error response already sent
+			}
+		}
+
+		// Reject obviously expensive queries before running them
+		if err := s.checkQueryCost(c, query); err != nil {
+			return // Error response already sent
+		}
+
+		// Excel needs a BOM to read the CSV as UTF-8, which would trip up other consumers
+		excelCompat := wantsCSV && c.Query("excel_compat") == "true"
+
+		// Only count the rows when requested, without fetching them
+		if c.Query("count_only") == "true" {
+			s.executeCountQuery(c, query)
+			return
+		}
+
+		// Benchmarks differ on every run, so only plain results are tagged for caching. The
+		// tag is only sent with a 304 or a successful result, never with an error.
+		var etag string
+		if !includeBenchmarks {
+			if etag = s.db.QueryETag(c.Request.Context(), query); etag != "" {
+				// JSON and CSV are different representations of the result
+				if wantsCSV {
+					etag = strings.TrimSuffix(etag, `"`) + `-` + csvFlavor(excelCompat) + `"`
+				}
+				if etagMatches(c.GetHeader("If-None-Match"), etag) {
+					log.Info("Query result not modified", slog.String("etag", etag))
+					setETagHeader(c, etag)
+					c.Status(http.StatusNotModified)
+					return
+				}
+			}
+		}
+
 		// Log query details
 		log.Info("Executing query", slog.String("query", query))
 		log.Info("Include benchmarks", slog.Bool("includeBenchmarks", includeBenchmarks))
 
+		// Legacy clients may want NULLs as a sentinel string, CSV already renders them as empty fields
+		if !wantsCSV {
+			ctx := database.WithNullRepresentation(c.Request.Context(), helpers.GetNullRepresentation())
+			c.Request = c.Request.WithContext(ctx)
+		}
+
 		// Execute the query
-		result, err := s.executeQuery(c, query)
+		result, err := s.executeQuery(c, query, includeBenchmarks)
 		if err != nil {
 			log.Error("Could not execute query", slog.Any("error", err))
 			// TODO: This is strange, the API should convert the error
@@ -263,10 +504,110 @@ func (s *Server) handleQuery() gin.HandlerFunc {
 		}
 
 		// Build and send the response
-		s.sendQueryResponse(c, result, includeBenchmarks)
+		if wantsCSV {
+			s.sendQueryCSV(c, result, excelCompat, etag)
+			return
+		}
+		s.sendQueryResponse(c, result, includeBenchmarks, benchmarksDisabled, etag)
 	}
 }
 
+// handleValidateQuery godoc
+//
+//	@Summary		Validate a query
+//	@Description	Check a query's syntax and the SQL injection rules without executing it or requiring the tables it reads to exist. Statements that parse but refer to missing tables, columns or functions are valid and reported as warnings.
+//	@Tags			query
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		api.QueryValidateRequest	true	"Query to validate"
+//	@Success		200		{object}	api.QueryValidateResponse	"Validation result, with code EMPTY_QUERY, QUERY_TOO_LONG, SUSPICIOUS_QUERY or SYNTAX_ERROR for an invalid query"
+//	@Failure		400		{object}	api.ErrorResponse			"Invalid request"
+//	@Failure		500		{object}	api.ErrorResponse			"Internal server error"
+//	@Router			/query/validate [post]
+func (s *Server) handleValidateQuery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		log := getLoggerFromGinContext(c)
+
+		var payload QueryValidateRequest
+		if err := c.ShouldBindJSON(&payload); err != nil {
+			log.Info("Error binding query validation request", slog.Any("error", err))
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Status:  "error",
+				Message: "Invalid query validation request: " + err.Error(),
+			})
+			return
+		}
+
+		warnings, err := s.db.ValidateQuery(c.Request.Context(), payload.Query)
+		response := QueryValidateResponse{
+			Status:   "success",
+			Valid:    err == nil,
+			Warnings: warnings,
+		}
+		switch {
+		case err == nil:
+		case errors.Is(err, database.ErrEmptyQuery):
+			response.Code = "EMPTY_QUERY"
+		case errors.Is(err, database.ErrQueryTooLong):
+			response.Code = "QUERY_TOO_LONG"
+		case errors.Is(err, database.ErrSuspiciousQuery):
+			response.Code = "SUSPICIOUS_QUERY"
+		case errors.Is(err, database.ErrQuerySyntax):
+			response.Code = "SYNTAX_ERROR"
+		default:
+			log.Error("Error validating query", slog.Any("error", err))
+			c.JSON(http.StatusInternalServerError, ErrorResponse{
+				Status:  "error",
+				Message: "Failed to validate query: " + err.Error(),
+			})
+			return
+		}
+		if err != nil {
+			response.Error = err.Error()
+		}
+
+		log.Info("Query validated", slog.Bool("valid", response.Valid), slog.String("code", response.Code))
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// setETagHeader tags a query result with its ETag, which varies with the Accept header
+// since JSON and CSV are tagged differently. An empty etag leaves the result untagged.
+func setETagHeader(c *gin.Context, etag string) {
+	if etag == "" {
+		return
+	}
+	c.Header("Vary", "Accept")
+	c.Header("ETag", etag)
+}
+
+// etagMatches reports whether an If-None-Match header lists the entity tag, using the
+// weak comparison required for GET and HEAD conditional requests
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// ifMatchMatches reports whether an If-Match header lists the entity tag, using the strong
+// comparison required for If-Match. A missing resource, with an empty tag, never matches.
+func ifMatchMatches(ifMatch, etag string) bool {
+	if etag == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(ifMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || (candidate == etag && !strings.HasPrefix(etag, "W/")) {
+			return true
+		}
+	}
+	return false
+}
+
 // shouldIncludeBenchmarks determines if benchmark data should be included in the response
 func (s *Server) shouldIncludeBenchmarks(c *gin.Context) bool {
 	// Priority: query parameter > environment variable > default (false)
@@ -286,6 +627,24 @@ func (s *Server) shouldIncludeBenchmarks(c *gin.Context) bool {
 	return includeBenchmarks
 }
 
+// validateBenchmarkParam rejects a benchmark query parameter other than "true" or "false"
+// with ENV_STRICT_BENCHMARK_PARAM, which is otherwise ignored. It reports whether the
+// request may proceed.
+func (s *Server) validateBenchmarkParam(c *gin.Context) bool {
+	value, ok := c.GetQuery("benchmark")
+	if !ok || value == "true" || value == "false" || !helpers.IsStrictBenchmarkParamEnabled() {
+		return true
+	}
+
+	getLoggerFromGinContext(c).Info("Rejected benchmark parameter", slog.String("benchmark", value))
+	c.JSON(http.StatusBadRequest, ErrorResponse{
+		Status:  "error",
+		Code:    "INVALID_BENCHMARK_PARAM",
+		Message: fmt.Sprintf("Invalid benchmark parameter %q: use true or false, or leave it out to follow ENABLE_QUERY_BENCHMARKS", value),
+	})
+	return false
+}
+
 // parseQueryRequest binds and validates the query request
 func (s *Server) parseQueryRequest(c *gin.Context) (string, int, error) {
 	var payload QueryRequest
@@ -313,18 +672,91 @@ func (s *Server) applyQueryLimit(query string, limit int) string {
 	return query
 }
 
+// scopeQueryToTenant rewrites a query to the rows of a tenant with the row filters of the
+// tables it reads. Queries the filters cannot be applied to are rejected with 403.
+func (s *Server) scopeQueryToTenant(c *gin.Context, query, tenant string) (string, error) {
+	log := getLoggerFromGinContext(c)
+
+	scoped, err := s.db.ScopeQueryToTenant(c.Request.Context(), query, tenant)
+	if errors.Is(err, database.ErrTenantQueryRejected) {
+		log.Info("Rejected tenant query", slog.String("tenant", tenant), slog.Any("error", err))
+		c.JSON(http.StatusForbidden, ErrorResponse{
+			Status:  "error",
+			Code:    "TENANT_QUERY_REJECTED",
+			Message: "Query rejected: " + err.Error(),
+		})
+		return "", err
+	}
+	if err != nil {
+		log.Error("Could not apply row filters", slog.Any("error", err))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Status:  "error",
+			Message: queryErrorMessage(c, "Failed to apply row filters", err),
+		})
+		return "", err
+	}
+	return scoped, nil
+}
+
+// queryErrorMessage returns the message of the error response of a failed query. The error
+// is left out for tenant keys, since it may quote the query rewritten with their row filters.
+func queryErrorMessage(c *gin.Context, message string, err error) string {
+	if requestTenant(c) != "" {
+		return message
+	}
+	return message + ": " + err.Error()
+}
+
+// checkQueryCost rejects queries whose estimated cardinality exceeds ENV_MAX_ESTIMATED_ROWS
+func (s *Server) checkQueryCost(c *gin.Context, query string) error {
+	err := s.db.CheckQueryCost(c.Request.Context(), query, helpers.GetMaxEstimatedRows())
+	if err == nil {
+		return nil
+	}
+
+	log := getLoggerFromGinContext(c)
+	if errors.Is(err, database.ErrQueryTooExpensive) {
+		log.Info("Rejected expensive query", slog.Any("error", err))
+		c.JSON(http.StatusUnprocessableEntity, ErrorResponse{
+			Status:  "error",
+			Code:    "QUERY_TOO_EXPENSIVE",
+			Message: "Query rejected: " + err.Error() + ". Add filters or join conditions to reduce the result size.",
+		})
+		return err
+	}
+
+	log.Error("Error checking query cost", slog.Any("error", err))
+	c.JSON(http.StatusInternalServerError, ErrorResponse{
+		Status:  "error",
+		Message: queryErrorMessage(c, "Failed to check query cost", err),
+	})
+	return err
+}
+
 // executeQuery executes the SQL query and handles errors
-func (s *Server) executeQuery(c *gin.Context, query string) (*database.QueryResult, error) {
+// Profiling is only enabled when benchmarks are requested to avoid its overhead
+func (s *Server) executeQuery(c *gin.Context, query string, includeBenchmarks bool) (*database.QueryResult, error) {
 
 	l := getLoggerFromGinContext(c)
 
-	result, err := s.db.ExecuteQuery(c.Request.Context(), query)
+	var result *database.QueryResult
+	var err error
+	if includeBenchmarks {
+		result, err = s.db.ExecuteQueryWithBenchmarks(c.Request.Context(), query)
+	} else {
+		result, err = s.db.ExecuteQuery(c.Request.Context(), query)
+	}
 
+	if errors.Is(err, database.ErrEmptyQuery) {
+		l.Info("Rejected empty query")
+		c.JSON(http.StatusBadRequest, emptyQueryResponse)
+		return nil, err
+	}
 	if err != nil {
 		l.Error("Error executing query", slog.Any("error", err))
 		c.JSON(http.StatusInternalServerError, ErrorResponse{
 			Status:  "error",
-			Message: "Failed to execute query: " + err.Error(),
+			Message: queryErrorMessage(c, "Failed to execute query", err),
 		})
 		return nil, err
 	}
@@ -333,8 +765,58 @@ func (s *Server) executeQuery(c *gin.Context, query string) (*database.QueryResu
 	return result, nil
 }
 
-// sendQueryResponse builds and sends the query response to the client
-func (s *Server) sendQueryResponse(c *gin.Context, result *database.QueryResult, includeBenchmarks bool) {
+// emptyQueryResponse is sent for a query that holds nothing but whitespace, semicolons
+// and comments, which is a problem with the request rather than a failed execution
+var emptyQueryResponse = ErrorResponse{
+	Status:  "error",
+	Code:    "EMPTY_QUERY",
+	Message: "Query is empty: it contains no statements to execute, only whitespace, semicolons or comments.",
+}
+
+// executeCountQuery counts the rows of a SELECT query and sends the count as the response
+func (s *Server) executeCountQuery(c *gin.Context, query string) {
+	log := getLoggerFromGinContext(c)
+	log.Info("Counting query rows", slog.String("query", query))
+
+	start := time.Now()
+	rowCount, err := s.db.CountQueryRows(c.Request.Context(), query)
+	if errors.Is(err, database.ErrEmptyQuery) {
+		log.Info("Rejected empty query")
+		c.JSON(http.StatusBadRequest, emptyQueryResponse)
+		return
+	}
+	if err != nil {
+		log.Error("Error counting query rows", slog.Any("error", err))
+		status := http.StatusInternalServerError
+		if errors.Is(err, database.ErrNotSelectQuery) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, ErrorResponse{
+			Status:  "error",
+			Message: queryErrorMessage(c, "Failed to count query rows", err),
+		})
+		return
+	}
+
+	duration := time.Since(start)
+	setQueryDurationHeader(c, duration)
+	c.JSON(http.StatusOK, QueryCountResponse{
+		Status:     "success",
+		RowCount:   rowCount,
+		DurationMs: duration.Milliseconds(),
+	})
+}
+
+// benchmarksDisabledNote explains in query responses why requested benchmarks are missing
+const benchmarksDisabledNote = "Benchmarks are disabled on this server (ENV_DISABLE_BENCHMARKS)"
+
+// profilingSkippedNote explains in query responses why benchmarks lack DuckDB's profile
+const profilingSkippedNote = "Profiling skipped: another query was profiled within ENV_PROFILING_INTERVAL, only timings are reported"
+
+// sendQueryResponse builds and sends the query response to the client, with a note when
+// benchmarks were requested but are disabled on the server or were not profiled, tagged
+// with etag when it is not empty
+func (s *Server) sendQueryResponse(c *gin.Context, result *database.QueryResult, includeBenchmarks, benchmarksDisabled bool, etag string) {
 	// Extract column names from first result if available
 	columns := s.extractColumnNames(result)
 
@@ -350,9 +832,148 @@ func (s *Server) sendQueryResponse(c *gin.Context, result *database.QueryResult,
 	// Add benchmarks if enabled
 	if includeBenchmarks && result.BenchmarkMetrics != nil {
 		response["benchmark"] = result.BenchmarkMetrics
+		if result.ProfilingSkipped {
+			response["benchmark_note"] = profilingSkippedNote
+		}
+	}
+	if benchmarksDisabled {
+		response["benchmark_note"] = benchmarksDisabledNote
+	}
+
+	// Serialize the response first so its size can be reported in the headers
+	body, err := json.Marshal(response)
+	if err != nil {
+		getLoggerFromGinContext(c).Error("Error serializing query response", slog.Any("error", err))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Status:  "error",
+			Message: "Failed to serialize query results: " + err.Error(),
+		})
+		return
+	}
+
+	c.Header(resultRowsHeader, strconv.Itoa(len(result.Results)))
+	c.Header(resultBytesHeader, strconv.Itoa(len(body)))
+	setQueryDurationHeader(c, result.Duration)
+	setETagHeader(c, etag)
+	c.Data(http.StatusOK, "application/json; charset=utf-8", body)
+}
+
+// mimeCSV is the media type of query results sent as CSV
+const mimeCSV = "text/csv"
+
+// utf8BOM is the byte order mark Excel looks for to read a CSV file as UTF-8
+const utf8BOM = "\uFEFF"
+
+// csvFlavor names the CSV representation of a result in its ETag
+func csvFlavor(excelCompat bool) string {
+	if excelCompat {
+		return "csv-excel"
+	}
+	return "csv"
+}
+
+// sendQueryCSV sends the query results as CSV with a header row, for requests that
+// accept text/csv. Rows are written to the response as they are encoded. With
+// excelCompat the body starts with a UTF-8 BOM and rows end with \r\n. The response is
+// tagged with etag when it is not empty. The size of the body is only known once the
+// rows are written, so it is sent in an X-Result-Bytes trailer.
+func (s *Server) sendQueryCSV(c *gin.Context, result *database.QueryResult, excelCompat bool, etag string) {
+	columns := result.Columns
+	if len(columns) == 0 {
+		columns = s.extractColumnNames(result)
+	}
+
+	c.Header(resultRowsHeader, strconv.Itoa(len(result.Results)))
+	setQueryDurationHeader(c, result.Duration)
+	setETagHeader(c, etag)
+	c.Header("Content-Type", mimeCSV+"; charset=utf-8")
+	c.Header("Trailer", resultBytesHeader)
+	c.Status(http.StatusOK)
+
+	body := &byteCountingWriter{w: c.Writer}
+	writer := csv.NewWriter(body)
+	if excelCompat {
+		writer.UseCRLF = true
+		if _, err := io.WriteString(body, utf8BOM); err != nil {
+			getLoggerFromGinContext(c).Error("Error writing CSV query response", slog.Any("error", err))
+			return
+		}
+	}
+	record := make([]string, len(columns))
+	write := func(record []string) bool {
+		if err := writer.Write(record); err != nil {
+			// The status is already sent, so the client only sees a truncated body
+			getLoggerFromGinContext(c).Error("Error writing CSV query response", slog.Any("error", err))
+			return false
+		}
+		return true
+	}
+
+	if !write(columns) {
+		return
+	}
+	for _, row := range result.Results {
+		for i, column := range columns {
+			record[i] = csvValue(row[column])
+		}
+		if !write(record) {
+			return
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		getLoggerFromGinContext(c).Error("Error writing CSV query response", slog.Any("error", err))
+		return
+	}
+	c.Header(resultBytesHeader, strconv.FormatInt(body.n, 10))
+}
+
+// byteCountingWriter counts the bytes written through it to w
+type byteCountingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *byteCountingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// csvValue formats a result value as a CSV field. NULL is an empty field, timestamps are
+// formatted as in JSON responses and lists and structs as JSON.
+func csvValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case fmt.Stringer:
+		return v.String()
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
 	}
+	return string(encoded)
+}
+
+// Response headers reporting the size of a query result and how long it took
+const (
+	resultRowsHeader    = "X-Result-Rows"
+	resultBytesHeader   = "X-Result-Bytes"
+	queryDurationHeader = "X-Query-Duration-Ms"
+)
 
-	c.JSON(http.StatusOK, response)
+// setQueryDurationHeader reports the execution time of a query in milliseconds, so
+// clients can monitor latency without parsing the body or requesting benchmarks
+func setQueryDurationHeader(c *gin.Context, duration time.Duration) {
+	if helpers.IsQueryDurationHeaderDisabled() {
+		return
+	}
+	c.Header(queryDurationHeader, strconv.FormatInt(duration.Milliseconds(), 10))
 }
 
 // extractColumnNames extracts and sorts column names from query results
@@ -370,20 +991,21 @@ func (s *Server) extractColumnNames(result *database.QueryResult) []string {
 // handleCreateSnapshot godoc
 //
 //	@Summary		Create database snapshot
-//	@Description	Create a snapshot of the current database state and upload to S3
+//	@Description	Create a snapshot of the current database state and upload it to S3 or Google Cloud Storage
 //	@Tags			snapshot
 //	@Accept			json
 //	@Produce		json
-//	@Param			request	body		api.SnapshotRequest		true	"Snapshot request with bucket and key"
+//	@Param			request	body		api.SnapshotRequest		true	"Snapshot request with bucket, key and optional callback_url, S3 metadata, tags and encryption"
 //	@Success		200		{object}	api.SnapshotResponse	"Snapshot created successfully"
 //	@Failure		400		{object}	api.ErrorResponse		"Bad request (invalid parameters)"
+//	@Failure		403		{object}	api.ErrorResponse		"Read-only API key with error code: READ_ONLY_API_KEY"
 //	@Failure		500		{object}	api.ErrorResponse		"Internal server error"
 //	@Router			/snapshot [post]
 func (s *Server) handleCreateSnapshot() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		log := getLoggerFromGinContext(c)
 
-		log.Info("Snapshot creation request received", slog.String("remote_addr", c.Request.RemoteAddr))
+		log.Info("Snapshot creation request received", slog.String("remote_addr", c.ClientIP()))
 
 		// Parse and validate the snapshot request
 		var payload SnapshotRequest
@@ -396,68 +1018,144 @@ func (s *Server) handleCreateSnapshot() gin.HandlerFunc {
 			return
 		}
 
-		// Generate timestamp-based filename
-		timestamp := time.Now().Format("2006-01-02T15-04-05")
-		filename := fmt.Sprintf("snapshot-%s.db", timestamp)
-
-		// Construct full S3 key path
-		fullKey := filepath.Join(payload.Key, filename)
-
-		log.Info("Creating snapshot",
-			slog.String("bucket", payload.Bucket),
-			slog.String("key", fullKey),
-			slog.String("filename", filename))
-
-		// Create temporary file for the snapshot
-		tempDir := os.TempDir()
-		tempSnapshotPath := filepath.Join(tempDir, filename)
+		if payload.CallbackURL != "" {
+			if err := snapshot.ValidateCallbackURL(payload.CallbackURL, helpers.GetSnapshotCallbackAllowedHosts()); err != nil {
+				log.Info("Rejected snapshot callback URL", slog.Any("error", err))
+				c.JSON(http.StatusBadRequest, ErrorResponse{
+					Status:  "error",
+					Message: "Invalid callback_url: " + err.Error(),
+				})
+				return
+			}
+		}
 
-		// Create snapshot
-		if err := s.db.CreateSnapshot(c.Request.Context(), tempSnapshotPath); err != nil {
-			log.Error("Failed to create snapshot", slog.Any("error", err))
-			c.JSON(http.StatusInternalServerError, ErrorResponse{
+		// The bucket may name its storage backend as s3://bucket or gs://bucket
+		scheme, bucket, err := snapshot.SplitBucket(payload.Bucket, helpers.GetSnapshotStoreScheme())
+		if err != nil {
+			log.Info("Rejected snapshot bucket", slog.Any("error", err))
+			c.JSON(http.StatusBadRequest, ErrorResponse{
 				Status:  "error",
-				Message: "Failed to create snapshot: " + err.Error(),
+				Message: "Invalid bucket: " + err.Error(),
 			})
 			return
 		}
 
-		// Ensure cleanup of temp file
-		defer func() {
-			if err := os.Remove(tempSnapshotPath); err != nil {
-				log.Error("Failed to remove temporary snapshot file", slog.Any("error", err))
+		// Object options are validated before the snapshot is taken
+		objectOptions := payload.objectOptions()
+		if !objectOptions.IsZero() {
+			if scheme != snapshot.SchemeS3 {
+				c.JSON(http.StatusBadRequest, ErrorResponse{
+					Status:  "error",
+					Message: "Invalid snapshot request: metadata, tags and server-side encryption are only supported for S3 buckets",
+				})
+				return
+			}
+			defaults, err := snapshot.ObjectOptionsFromEnv()
+			if err != nil {
+				log.Error("Invalid S3 object options", slog.Any("error", err))
+				c.JSON(http.StatusInternalServerError, ErrorResponse{
+					Status:  "error",
+					Message: "Failed to create snapshot: " + err.Error(),
+				})
+				return
+			}
+			// The request is merged with the configured defaults, which together must
+			// stay within the S3 limits, such as 10 tags per object
+			if err := defaults.Merge(objectOptions).Validate(); err != nil {
+				log.Info("Rejected snapshot object options", slog.Any("error", err))
+				c.JSON(http.StatusBadRequest, ErrorResponse{
+					Status:  "error",
+					Message: "Invalid snapshot request: " + err.Error(),
+				})
+				return
 			}
-		}()
-
-		// Create S3 client and upload
-		s3Client, err := snapshot.NewS3Client(c.Request.Context())
-		if err != nil {
-			log.Error("Failed to create S3 client", slog.Any("error", err))
-			c.JSON(http.StatusInternalServerError, ErrorResponse{
-				Status:  "error",
-				Message: "Failed to create S3 client: " + err.Error(),
-			})
-			return
 		}
 
-		// Upload snapshot to S3
-		s3URI, err := s3Client.UploadSnapshot(c.Request.Context(), tempSnapshotPath, payload.Bucket, fullKey)
+		// Generate timestamp-based filename and the full object key path
+		filename, fullKey := snapshot.TimestampedKey(payload.Key, time.Now())
+
+		log.Info("Creating snapshot",
+			slog.String("store", scheme),
+			slog.String("bucket", bucket),
+			slog.String("key", fullKey),
+			slog.String("filename", filename))
+
+		// Report the outcome to the callback URL once the snapshot has finished
+		var snapshotErr error
+		defer func() {
+			s.notifySnapshotCallback(c.Request.Context(), payload, fullKey, snapshotErr)
+		}()
+
+		// Create the snapshot and upload it to the storage backend
+		uri, err := s.createSnapshot(c.Request.Context(), scheme, bucket, fullKey, objectOptions)
 		if err != nil {
-			log.Error("Failed to upload snapshot to S3", slog.Any("error", err))
+			snapshotErr = err
+			log.Error("Failed to create snapshot", slog.Any("error", err))
 			c.JSON(http.StatusInternalServerError, ErrorResponse{
 				Status:  "error",
-				Message: "Failed to upload snapshot to S3: " + err.Error(),
+				Message: "Failed to create snapshot: " + err.Error(),
 			})
 			return
 		}
 
-		log.Info("Snapshot created and uploaded successfully", slog.String("s3URI", s3URI))
+		log.Info("Snapshot created and uploaded successfully", slog.String("uri", uri))
 
 		// Return success response
 		c.JSON(http.StatusOK, SnapshotResponse{
 			Status:      "success",
-			SnapshotURI: s3URI,
+			SnapshotURI: uri,
 			Filename:    filename,
 		})
 	}
 }
+
+// createSnapshot snapshots the database to the storage backend for scheme and returns
+// the URI of the uploaded snapshot. The object options are only set for S3, on top of
+// those configured in the environment.
+func (s *Server) createSnapshot(ctx context.Context, scheme, bucket, key string, objectOptions snapshot.ObjectOptions) (string, error) {
+	store, err := snapshot.NewStore(ctx, scheme)
+	if err != nil {
+		return "", err
+	}
+	if s3Client, ok := store.(*snapshot.S3Client); ok && !objectOptions.IsZero() {
+		store = s3Client.WithObjectOptions(objectOptions)
+	}
+
+	return snapshot.CreateAndUpload(ctx, s.db, store, bucket, key)
+}
+
+// objectOptions returns the S3 object options set in the request
+func (r SnapshotRequest) objectOptions() snapshot.ObjectOptions {
+	return snapshot.ObjectOptions{
+		Metadata:             r.Metadata,
+		Tags:                 r.Tags,
+		ServerSideEncryption: r.ServerSideEncryption,
+		KMSKeyID:             r.SSEKMSKeyID,
+	}
+}
+
+// notifySnapshotCallback posts the snapshot outcome to the request's callback URL, if any.
+// Delivery runs in the background so retries never delay the HTTP response.
+func (s *Server) notifySnapshotCallback(ctx context.Context, payload SnapshotRequest, key string, snapshotErr error) {
+	if payload.CallbackURL == "" {
+		return
+	}
+
+	callback := snapshot.CallbackPayload{
+		Status:    snapshot.CallbackStatusSuccess,
+		Bucket:    payload.Bucket,
+		Key:       key,
+		Timestamp: time.Now().UTC(),
+	}
+	if snapshotErr != nil {
+		callback.Status = snapshot.CallbackStatusError
+		callback.Error = snapshotErr.Error()
+	}
+
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		if err := snapshot.NotifyCallback(ctx, payload.CallbackURL, callback); err != nil {
+			helpers.GetLoggerFromContext(ctx).Error("Failed to deliver snapshot callback", slog.Any("error", err))
+		}
+	}()
+}
@@ -4,13 +4,19 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"io"
 	"log/slog"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"reflect"
+	"slices"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/aliengiraffe/spotdb/pkg/database"
 	"github.com/aliengiraffe/spotdb/pkg/helpers"
@@ -49,13 +55,100 @@ func TestNewServer(t *testing.T) {
 	}
 
 	// Create HTTP server from API server
-	httpSrv := NewServer(db, log)
+	httpSrv := NewServer(db, log, nil)
 	if httpSrv.Addr != ":8080" {
 		t.Errorf("Expected Addr :8080, got %s", httpSrv.Addr)
 	}
 	if httpSrv.Handler == nil {
 		t.Error("HTTP server handler is nil")
 	}
+	if httpSrv.ReadHeaderTimeout != helpers.DefaultHTTPReadHeaderTimeout || httpSrv.WriteTimeout != helpers.DefaultHTTPWriteTimeout {
+		t.Errorf("Expected default timeouts, got read header %s and write %s", httpSrv.ReadHeaderTimeout, httpSrv.WriteTimeout)
+	}
+
+	t.Setenv("ENV_HTTP_WRITE_TIMEOUT", "0")
+	t.Setenv("ENV_HTTP_IDLE_TIMEOUT", "45s")
+	httpSrv = NewServer(db, log, nil)
+	if httpSrv.WriteTimeout != 0 || httpSrv.IdleTimeout != 45*time.Second {
+		t.Errorf("Expected configured timeouts, got write %s and idle %s", httpSrv.WriteTimeout, httpSrv.IdleTimeout)
+	}
+}
+
+func TestNewServerHTTP2Cleartext(t *testing.T) {
+	db, err := database.NewDuckDB(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer helpers.CloseResources(db, "database connection")
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	// get requests the healthcheck with a client speaking only the given protocols
+	get := func(t *testing.T, srv *http.Server, clientProtocols *http.Protocols) (*http.Response, error) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("Failed to listen: %v", err)
+		}
+		go srv.Serve(listener) // nolint:errcheck
+		t.Cleanup(func() { srv.Close() })
+
+		client := &http.Client{Transport: &http.Transport{Protocols: clientProtocols}}
+		return client.Get("http://" + listener.Addr().String() + "/api/v1/healthcheck")
+	}
+	h2cOnly := new(http.Protocols)
+	h2cOnly.SetUnencryptedHTTP2(true)
+
+	t.Run("plain HTTP is unchanged by default", func(t *testing.T) {
+		srv := NewServer(db, log, nil)
+		if srv.Protocols != nil {
+			t.Fatalf("Expected the default protocols, got %v", srv.Protocols)
+		}
+		if _, err := get(t, srv, h2cOnly); err == nil {
+			t.Error("Expected an HTTP/2 request without TLS to fail")
+		}
+	})
+
+	t.Run("h2c when enabled", func(t *testing.T) {
+		t.Setenv("ENV_HTTP2_CLEARTEXT", "true")
+		srv := NewServer(db, log, nil)
+		resp, err := get(t, srv, h2cOnly)
+		if err != nil {
+			t.Fatalf("HTTP/2 request failed: %v", err)
+		}
+		defer helpers.CloseResources(resp.Body, "response body")
+		if resp.StatusCode != http.StatusOK || resp.ProtoMajor != 2 {
+			t.Errorf("Expected 200 over HTTP/2, got %d over %s", resp.StatusCode, resp.Proto)
+		}
+	})
+}
+
+func TestWithoutWriteTimeout(t *testing.T) {
+	router := gin.New()
+	slowHandler := func(c *gin.Context) {
+		time.Sleep(200 * time.Millisecond)
+		c.String(http.StatusOK, "done")
+	}
+	router.GET("/slow", slowHandler)
+	router.GET("/export", withoutWriteTimeout(), slowHandler)
+
+	srv := httptest.NewUnstartedServer(router)
+	srv.Config.WriteTimeout = 50 * time.Millisecond
+	srv.Start()
+	defer srv.Close()
+
+	if resp, err := http.Get(srv.URL + "/slow"); err == nil {
+		resp.Body.Close()
+		t.Fatal("Expected the write timeout to cut off a slow response")
+	}
+
+	resp, err := http.Get(srv.URL + "/export")
+	if err != nil {
+		t.Fatalf("Expected the write timeout to be lifted, got %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "done" {
+		t.Errorf("Expected 200 done, got %d %q", resp.StatusCode, body)
+	}
 }
 
 func TestHandleListTables(t *testing.T) {
@@ -255,6 +348,336 @@ func TestAPIKeyAuthMiddleware_NoKey(t *testing.T) {
 	}
 }
 
+// TestAPIKeyAuthMiddleware_AuthStyles tests that the API key is accepted via X-API-Key or Basic auth
+func TestAPIKeyAuthMiddleware_AuthStyles(t *testing.T) {
+	t.Setenv("API_KEY", "secretkey")
+
+	router := gin.New()
+	router.Use(apiKeyAuthMiddleware())
+	router.GET("/ping", func(c *gin.Context) {
+		c.String(http.StatusOK, "pong")
+	})
+
+	tests := []struct {
+		name           string
+		setAuth        func(req *http.Request)
+		expectedStatus int
+	}{
+		{name: "api key header", setAuth: func(req *http.Request) { req.Header.Set("X-API-Key", "secretkey") }, expectedStatus: http.StatusOK},
+		{name: "basic auth password", setAuth: func(req *http.Request) { req.SetBasicAuth("tooling", "secretkey") }, expectedStatus: http.StatusOK},
+		{name: "wrong api key header", setAuth: func(req *http.Request) { req.Header.Set("X-API-Key", "wrong") }, expectedStatus: http.StatusUnauthorized},
+		{name: "wrong basic auth password", setAuth: func(req *http.Request) { req.SetBasicAuth("tooling", "wrong") }, expectedStatus: http.StatusUnauthorized},
+		{name: "no credentials", setAuth: func(req *http.Request) {}, expectedStatus: http.StatusUnauthorized},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/ping", nil)
+			tc.setAuth(req)
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tc.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tc.expectedStatus, rec.Code)
+			}
+
+			challenge := rec.Header().Get("WWW-Authenticate")
+			if tc.expectedStatus == http.StatusUnauthorized && challenge != `Basic realm="spotdb"` {
+				t.Errorf("Expected Basic WWW-Authenticate challenge, got %q", challenge)
+			}
+			if tc.expectedStatus == http.StatusOK && challenge != "" {
+				t.Errorf("Expected no WWW-Authenticate header on success, got %q", challenge)
+			}
+		})
+	}
+}
+
+// TestReadOnlyMode tests that a database opened read-only rejects writes with READ_ONLY_MODE
+func TestReadOnlyMode(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "replica.db")
+	t.Setenv("SNAPSHOT_LOCATION", "")
+	t.Setenv("DUCKDB_PATH", dbPath)
+	ctx := context.Background()
+
+	writer, err := database.NewDuckDB(ctx)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	if _, err := writer.ExecuteQuery(ctx, "CREATE TABLE sales AS SELECT 1 AS id"); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Failed to close database: %v", err)
+	}
+
+	t.Setenv("DUCKDB_ACCESS_MODE", "read_only")
+	db, err := database.NewDuckDB(ctx)
+	if err != nil {
+		t.Fatalf("Failed to open database read-only: %v", err)
+	}
+	defer helpers.CloseResources(db, "database")
+
+	s := &Server{db: db}
+	s.setupRouter(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	tests := []struct {
+		name           string
+		path           string
+		body           string
+		expectedStatus int
+	}{
+		{name: "select query", path: "/api/v1/query", body: `{"query": "SELECT COUNT(*) FROM sales"}`, expectedStatus: http.StatusOK},
+		{name: "drop query", path: "/api/v1/query", body: `{"query": "DROP TABLE sales"}`, expectedStatus: http.StatusForbidden},
+		{name: "create table", path: "/api/v1/tables", body: `{"name": "copy", "query": "SELECT * FROM sales"}`, expectedStatus: http.StatusForbidden},
+		{name: "upload", path: "/api/v1/upload", expectedStatus: http.StatusForbidden},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tc.path, strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			s.Router().ServeHTTP(rec, req)
+
+			if rec.Code != tc.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tc.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if tc.expectedStatus == http.StatusForbidden && !strings.Contains(rec.Body.String(), "READ_ONLY_MODE") {
+				t.Errorf("Expected READ_ONLY_MODE, got %s", rec.Body.String())
+			}
+		})
+	}
+}
+
+// TestReadOnlyAPIKey tests that read-only keys may read and query but not modify data
+func TestReadOnlyAPIKey(t *testing.T) {
+	t.Setenv("API_KEY", "secretkey")
+	t.Setenv("ENV_READONLY_API_KEYS", "reader")
+	s, _ := newTablesTestServer(t)
+
+	tests := []struct {
+		name           string
+		key            string
+		method         string
+		path           string
+		body           string
+		expectedStatus int
+	}{
+		{name: "list tables", key: "reader", method: http.MethodGet, path: "/api/v1/tables", expectedStatus: http.StatusOK},
+		{name: "select query", key: "reader", method: http.MethodPost, path: "/api/v1/query", body: `{"query": "SELECT COUNT(*) FROM sales"}`, expectedStatus: http.StatusOK},
+		{name: "drop query", key: "reader", method: http.MethodPost, path: "/api/v1/query", body: `{"query": "DROP TABLE sales"}`, expectedStatus: http.StatusForbidden},
+		{name: "mixed query", key: "reader", method: http.MethodPost, path: "/api/v1/query", body: `{"query": "SELECT 1; DELETE FROM sales"}`, expectedStatus: http.StatusForbidden},
+		{name: "insert after a CTE", key: "reader", method: http.MethodPost, path: "/api/v1/query", body: `{"query": "WITH x AS (SELECT 4, 'east', 40) INSERT INTO sales SELECT * FROM x"}`, expectedStatus: http.StatusForbidden},
+		{name: "explain analyze delete", key: "reader", method: http.MethodPost, path: "/api/v1/query", body: `{"query": "EXPLAIN (ANALYZE) DELETE FROM sales"}`, expectedStatus: http.StatusForbidden},
+		{name: "pragma", key: "reader", method: http.MethodPost, path: "/api/v1/query", body: `{"query": "PRAGMA threads=1"}`, expectedStatus: http.StatusForbidden},
+		{name: "create table", key: "reader", method: http.MethodPost, path: "/api/v1/tables", body: `{"name": "copy", "query": "SELECT * FROM sales"}`, expectedStatus: http.StatusForbidden},
+		{name: "upload", key: "reader", method: http.MethodPost, path: "/api/v1/upload", expectedStatus: http.StatusForbidden},
+		{name: "snapshot", key: "reader", method: http.MethodPost, path: "/api/v1/snapshot", body: `{}`, expectedStatus: http.StatusForbidden},
+		{name: "propose types", key: "reader", method: http.MethodPost, path: "/api/v1/tables/sales/refine_types", expectedStatus: http.StatusOK},
+		{name: "apply types", key: "reader", method: http.MethodPost, path: "/api/v1/tables/sales/refine_types", body: `{"apply": true}`, expectedStatus: http.StatusForbidden},
+		{name: "full key query", key: "secretkey", method: http.MethodPost, path: "/api/v1/query", body: `{"query": "DELETE FROM sales WHERE 1 = 0"}`, expectedStatus: http.StatusOK},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("X-API-Key", tc.key)
+			rec := httptest.NewRecorder()
+			s.Router().ServeHTTP(rec, req)
+
+			if rec.Code != tc.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tc.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if tc.expectedStatus == http.StatusForbidden {
+				var body ErrorResponse
+				if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+					t.Fatalf("Failed to parse response body: %v", err)
+				}
+				if body.Code != "READ_ONLY_API_KEY" {
+					t.Errorf("Expected READ_ONLY_API_KEY, got %q", body.Code)
+				}
+			}
+		})
+	}
+}
+
+// TestTenantAPIKey tests that tenant keys only query the rows of their tenant
+func TestTenantAPIKey(t *testing.T) {
+	t.Setenv("API_KEY", "secretkey")
+	t.Setenv("ENV_TENANT_API_KEYS", "north-key=north")
+	s, db := newTablesTestServer(t)
+
+	if err := db.SetRowFilter(context.Background(), "sales", "region = {tenant}"); err != nil {
+		t.Fatalf("Failed to set row filter: %v", err)
+	}
+	if _, err := db.ExecuteQuery(context.Background(), "CREATE VIEW v_sales AS SELECT * FROM sales"); err != nil {
+		t.Fatalf("Failed to create view: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		key            string
+		method         string
+		path           string
+		body           string
+		expectedStatus int
+		expectedCode   string
+		expectedTotal  float64
+	}{
+		{name: "tenant query", key: "north-key", method: http.MethodPost, path: "/api/v1/query", body: `{"query": "SELECT SUM(amount) AS total FROM sales"}`, expectedStatus: http.StatusOK, expectedTotal: 40},
+		{name: "tenant query with cte", key: "north-key", method: http.MethodPost, path: "/api/v1/query", body: `{"query": "WITH s AS (SELECT * FROM sales) SELECT SUM(amount) AS total FROM s"}`, expectedStatus: http.StatusOK, expectedTotal: 40},
+		{name: "full key query", key: "secretkey", method: http.MethodPost, path: "/api/v1/query", body: `{"query": "SELECT SUM(amount) AS total FROM sales"}`, expectedStatus: http.StatusOK, expectedTotal: 60},
+		{name: "qualified table", key: "north-key", method: http.MethodPost, path: "/api/v1/query", body: `{"query": "SELECT SUM(amount) AS total FROM main.sales"}`, expectedStatus: http.StatusForbidden, expectedCode: "TENANT_QUERY_REJECTED"},
+		{name: "row filters table", key: "north-key", method: http.MethodPost, path: "/api/v1/query", body: `{"query": "SELECT * FROM _spotdb_row_filters"}`, expectedStatus: http.StatusForbidden, expectedCode: "TENANT_QUERY_REJECTED"},
+		{name: "view over a filtered table", key: "north-key", method: http.MethodPost, path: "/api/v1/query", body: `{"query": "SELECT SUM(amount) AS total FROM v_sales"}`, expectedStatus: http.StatusForbidden, expectedCode: "TENANT_QUERY_REJECTED"},
+		{name: "information schema", key: "north-key", method: http.MethodPost, path: "/api/v1/query", body: `{"query": "SELECT * FROM information_schema.tables"}`, expectedStatus: http.StatusForbidden, expectedCode: "TENANT_QUERY_REJECTED"},
+		{name: "delete query", key: "north-key", method: http.MethodPost, path: "/api/v1/query", body: `{"query": "DELETE FROM sales"}`, expectedStatus: http.StatusForbidden, expectedCode: "READ_ONLY_API_KEY"},
+		{name: "sample", key: "north-key", method: http.MethodGet, path: "/api/v1/tables/sales/sample?rows=1", expectedStatus: http.StatusForbidden, expectedCode: "TENANT_API_KEY"},
+		{name: "set row filter", key: "north-key", method: http.MethodPut, path: "/api/v1/tables/sales/row_filter", body: `{"predicate": "true"}`, expectedStatus: http.StatusForbidden, expectedCode: "READ_ONLY_API_KEY"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("X-API-Key", tc.key)
+			rec := httptest.NewRecorder()
+			s.Router().ServeHTTP(rec, req)
+
+			if rec.Code != tc.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tc.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if tc.expectedCode != "" {
+				var body ErrorResponse
+				if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+					t.Fatalf("Failed to parse response body: %v", err)
+				}
+				if body.Code != tc.expectedCode {
+					t.Errorf("Expected %s, got %q", tc.expectedCode, body.Code)
+				}
+				return
+			}
+
+			var body struct {
+				Results []map[string]float64 `json:"results"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("Failed to parse response body: %v", err)
+			}
+			if len(body.Results) != 1 || body.Results[0]["total"] != tc.expectedTotal {
+				t.Errorf("Expected total %v, got %v", tc.expectedTotal, body.Results)
+			}
+		})
+	}
+
+	// Errors of tenant queries would otherwise quote the query rewritten with the row filter
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/query", strings.NewReader(`{"query": "SELECT missing_column FROM sales"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", "north-key")
+	rec := httptest.NewRecorder()
+	s.Router().ServeHTTP(rec, req)
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("Expected status 500, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var body ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Failed to parse response body: %v", err)
+	}
+	if strings.Contains(body.Message, ":") {
+		t.Errorf("Expected a generic error message, got %q", body.Message)
+	}
+}
+
+// TestAPIKeyAuthMiddleware_NoKeyConfigured tests that requests pass when API_KEY is not set
+func TestAPIKeyAuthMiddleware_NoKeyConfigured(t *testing.T) {
+	t.Setenv("API_KEY", "")
+
+	router := gin.New()
+	router.Use(apiKeyAuthMiddleware())
+	router.GET("/ping", func(c *gin.Context) {
+		c.String(http.StatusOK, "pong")
+	})
+
+	req := httptest.NewRequest("GET", "/ping", nil)
+	req.SetBasicAuth("anyone", "anything")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+}
+
+// TestRequestIDMiddleware tests that request IDs are echoed or generated
+func TestCORSMiddleware(t *testing.T) {
+	router := gin.New()
+	router.Use(corsMiddleware())
+	router.GET("/ping", func(c *gin.Context) {
+		c.String(http.StatusOK, "pong")
+	})
+
+	req := httptest.NewRequest("GET", "/ping", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if origin := rec.Header().Get("Access-Control-Allow-Origin"); origin != "https://app.example.com" {
+		t.Errorf("Expected the request origin to be allowed, got %q", origin)
+	}
+	exposed := strings.Split(rec.Header().Get("Access-Control-Expose-Headers"), ", ")
+	for _, header := range []string{"X-Request-ID", resultRowsHeader, resultBytesHeader, queryDurationHeader, "ETag"} {
+		if !slices.Contains(exposed, header) {
+			t.Errorf("Expected %s to be exposed to browsers, got %v", header, exposed)
+		}
+	}
+
+	preflight := httptest.NewRequest("OPTIONS", "/ping", nil)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, preflight)
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("Expected status %d for a preflight request, got %d", http.StatusNoContent, rec.Code)
+	}
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	router := gin.New()
+	router.Use(requestIDMiddleware())
+	router.GET("/ping", func(c *gin.Context) {
+		c.String(http.StatusOK, helpers.GetRequestIDFromContext(c.Request.Context()))
+	})
+
+	tests := []struct {
+		name      string
+		requestID string
+		keep      bool
+	}{
+		{name: "client id kept", requestID: "trace-123", keep: true},
+		{name: "missing id generated", requestID: ""},
+		{name: "id with spaces replaced", requestID: "bad id"},
+		{name: "oversized id replaced", requestID: strings.Repeat("a", maxRequestIDLength+1)},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/ping", nil)
+			if tc.requestID != "" {
+				req.Header.Set("X-Request-ID", tc.requestID)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			got := rec.Header().Get("X-Request-ID")
+			if got == "" || got != rec.Body.String() {
+				t.Fatalf("Expected request ID in header and context, got header %q body %q", got, rec.Body.String())
+			}
+			if (got == tc.requestID) != tc.keep {
+				t.Errorf("Unexpected request ID %q for client ID %q", got, tc.requestID)
+			}
+		})
+	}
+}
+
 func TestHandleExplorer(t *testing.T) {
 	// Create a unique directory for each test
 	tempDir := t.TempDir()
@@ -506,6 +929,7 @@ func TestHandleCreateSnapshot_RequestValidation(t *testing.T) {
 
 	tests := []struct {
 		name           string
+		env            map[string]string
 		requestBody    interface{}
 		expectedStatus int
 		expectedError  string
@@ -546,10 +970,59 @@ func TestHandleCreateSnapshot_RequestValidation(t *testing.T) {
 			expectedStatus: http.StatusBadRequest,
 			expectedError:  "Invalid snapshot request",
 		},
+		{
+			name:           "callback host not allowed",
+			requestBody:    map[string]string{"bucket": "my-bucket", "key": "snapshots/test", "callback_url": "http://169.254.169.254/latest"},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "Invalid callback_url",
+		},
+		{
+			name:           "callback scheme not allowed",
+			requestBody:    map[string]string{"bucket": "my-bucket", "key": "snapshots/test", "callback_url": "ftp://hooks.example.com/done"},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "Invalid callback_url",
+		},
+		{
+			name:           "unsupported bucket scheme",
+			requestBody:    map[string]string{"bucket": "azure://container", "key": "snapshots/test"},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "Invalid bucket",
+		},
+		{
+			name:           "invalid KMS key ID",
+			requestBody:    map[string]any{"bucket": "my-bucket", "key": "snapshots/test", "sse_kms_key_id": "my-key"},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "invalid KMS key ID",
+		},
+		{
+			name:           "reserved tag prefix",
+			requestBody:    map[string]any{"bucket": "my-bucket", "key": "snapshots/test", "tags": map[string]string{"aws:owner": "data"}},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "the aws: prefix is reserved",
+		},
+		{
+			name:           "object options for GCS bucket",
+			requestBody:    map[string]any{"bucket": "gs://my-bucket", "key": "snapshots/test", "tags": map[string]string{"team": "data"}},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "only supported for S3 buckets",
+		},
+		{
+			name:           "too many tags with the configured tags",
+			env:            map[string]string{"ENV_S3_OBJECT_TAGS": "t1=a,t2=a,t3=a,t4=a,t5=a,t6=a,t7=a,t8=a"},
+			requestBody:    map[string]any{"bucket": "my-bucket", "key": "snapshots/test", "tags": map[string]string{"team": "data", "owner": "ops", "project": "x", "t1": "b"}},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "exceeding the S3 limit of 10 tags",
+		},
 	}
 
+	t.Setenv("ENV_SNAPSHOT_CALLBACK_ALLOWED_HOSTS", "hooks.example.com")
+
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
+			for name, value := range tc.env {
+				t.Setenv(name, value)
+			}
+
 			var requestJSON []byte
 			var err error
 
@@ -656,6 +1129,45 @@ func TestHandleCreateSnapshot_TimestampFormat(t *testing.T) {
 	// 5. Verify response structure with correct timestamp format
 }
 
+// TestHandleCreateSnapshot_GCS tests uploading a snapshot to a gs:// bucket
+func TestHandleCreateSnapshot_GCS(t *testing.T) {
+	var uploadedPath, uploadedName string
+	var uploadedSize int
+	gcs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		uploadedPath, uploadedName, uploadedSize = r.URL.Path, r.URL.Query().Get("name"), len(body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer gcs.Close()
+
+	t.Setenv("ENV_GCS_ENDPOINT", gcs.URL)
+	t.Setenv("ENV_GCS_ACCESS_TOKEN", "test-token")
+
+	s, _ := newTablesTestServer(t)
+	rec := serveJSON(s, http.MethodPost, "/api/v1/snapshot", SnapshotRequest{
+		Bucket: "gs://my-bucket",
+		Key:    "snapshots",
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+
+	var resp SnapshotResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if resp.SnapshotURI != "gs://my-bucket/snapshots/"+resp.Filename {
+		t.Errorf("Unexpected snapshot URI %q for filename %q", resp.SnapshotURI, resp.Filename)
+	}
+	if uploadedPath != "/upload/storage/v1/b/my-bucket/o" || uploadedName != "snapshots/"+resp.Filename || uploadedSize == 0 {
+		t.Errorf("Unexpected upload to %q named %q with %d bytes", uploadedPath, uploadedName, uploadedSize)
+	}
+}
+
 func TestHealthCheckEndpoint(t *testing.T) {
 	// Use a unique directory for each test
 	tempDir := t.TempDir()
@@ -830,6 +1342,9 @@ func TestHandleQueryWithBenchmarks(t *testing.T) {
 	origEnv := os.Getenv("ENABLE_QUERY_BENCHMARKS")
 	defer os.Setenv("ENABLE_QUERY_BENCHMARKS", origEnv)
 
+	// Profile every query, the subtests run back to back
+	t.Setenv("ENV_PROFILING_INTERVAL", "0")
+
 	// Create a test database
 	db, err := database.NewDuckDB(context.Background())
 	if err != nil {
@@ -858,7 +1373,9 @@ func TestHandleQueryWithBenchmarks(t *testing.T) {
 		name               string
 		envBenchmark       string
 		queryBenchmark     string
+		envDisable         string
 		expectBenchmarkKey bool
+		expectNote         bool
 	}{
 		{
 			name:               "benchmarks via environment variable",
@@ -884,6 +1401,21 @@ func TestHandleQueryWithBenchmarks(t *testing.T) {
 			queryBenchmark:     "false",
 			expectBenchmarkKey: false,
 		},
+		{
+			name:               "benchmarks disabled on the server",
+			envBenchmark:       "",
+			queryBenchmark:     "true",
+			envDisable:         "true",
+			expectBenchmarkKey: false,
+			expectNote:         true,
+		},
+		{
+			name:               "benchmarks not requested on a server disabling them",
+			envBenchmark:       "",
+			queryBenchmark:     "",
+			envDisable:         "true",
+			expectBenchmarkKey: false,
+		},
 	}
 
 	for _, tc := range tests {
@@ -894,6 +1426,7 @@ func TestHandleQueryWithBenchmarks(t *testing.T) {
 			} else {
 				os.Unsetenv("ENABLE_QUERY_BENCHMARKS")
 			}
+			t.Setenv("ENV_DISABLE_BENCHMARKS", tc.envDisable)
 
 			// Create request body
 			requestBody := map[string]interface{}{"query": "SELECT * FROM test_table"}
@@ -933,6 +1466,14 @@ func TestHandleQueryWithBenchmarks(t *testing.T) {
 			if !tc.expectBenchmarkKey && hasBenchmark {
 				t.Error("Did not expect benchmark key in response, but it was present")
 			}
+
+			note, hasNote := response["benchmark_note"]
+			if tc.expectNote && note != benchmarksDisabledNote {
+				t.Errorf("Expected benchmark note %q, got %v", benchmarksDisabledNote, note)
+			}
+			if !tc.expectNote && hasNote {
+				t.Errorf("Did not expect a benchmark note, got %v", note)
+			}
 		})
 	}
 }
@@ -1119,12 +1660,60 @@ func TestHandleListTables_WithTables(t *testing.T) {
 	}
 }
 
-func TestHandleListTables_DatabaseError(t *testing.T) {
-	// Use a unique directory for each test
-	tempDir := t.TempDir()
-	oldTempDir := os.TempDir()
-	if err := os.Setenv("TMPDIR", tempDir); err != nil {
-		t.Fatalf("Failed to set TMPDIR: %v", err)
+func TestHandleListTables_HiddenTables(t *testing.T) {
+	s, db := newTablesTestServer(t)
+
+	ctx := context.Background()
+	for _, query := range []string{
+		`CREATE TABLE _spotdb_imports (id INTEGER)`,
+		`CREATE TABLE audit_log (id INTEGER)`,
+		`INSERT INTO _spotdb_imports VALUES (1)`,
+	} {
+		if _, err := db.ExecuteQuery(ctx, query); err != nil {
+			t.Fatalf("Failed to run %q: %v", query, err)
+		}
+	}
+
+	listTables := func() []string {
+		t.Helper()
+		rec := serveJSON(s, http.MethodGet, "/api/v1/tables", nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d, body: %s", http.StatusOK, rec.Code, rec.Body.String())
+		}
+		var response TablesResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to parse response: %v", err)
+		}
+		var names []string
+		for _, table := range response.Tables {
+			names = append(names, table.Name)
+		}
+		return names
+	}
+
+	t.Setenv("ENV_HIDDEN_TABLE_PREFIXES", "")
+	if names := listTables(); slices.Contains(names, "_spotdb_imports") || !slices.Contains(names, "audit_log") {
+		t.Errorf("Expected _spotdb_imports to be hidden by default, got %v", names)
+	}
+
+	t.Setenv("ENV_HIDDEN_TABLE_PREFIXES", "_spotdb_,AUDIT_")
+	if names := listTables(); slices.Contains(names, "audit_log") || !slices.Contains(names, "sales") {
+		t.Errorf("Expected audit_log to be hidden, got %v", names)
+	}
+
+	// Hidden tables stay queryable by name
+	rec := serveJSON(s, http.MethodPost, "/api/v1/query", QueryRequest{Query: "SELECT id FROM _spotdb_imports"})
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected hidden table to be queryable, got %d, body: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestHandleListTables_DatabaseError(t *testing.T) {
+	// Use a unique directory for each test
+	tempDir := t.TempDir()
+	oldTempDir := os.TempDir()
+	if err := os.Setenv("TMPDIR", tempDir); err != nil {
+		t.Fatalf("Failed to set TMPDIR: %v", err)
 	}
 	defer func() {
 		if err := os.Setenv("TMPDIR", oldTempDir); err != nil {
@@ -1238,3 +1827,648 @@ func TestHandleCreateSnapshot_DatabaseError(t *testing.T) {
 		t.Errorf("Expected error message about creating snapshot, got: %s", response.Message)
 	}
 }
+
+func TestConfigureTrustedProxies(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	tests := []struct {
+		name           string
+		trustedProxies string
+		expectedIP     string
+	}{
+		{
+			name:           "no trusted proxies ignores forwarded header",
+			trustedProxies: "",
+			expectedIP:     "10.0.0.1",
+		},
+		{
+			name:           "trusted proxy CIDR resolves forwarded header",
+			trustedProxies: "10.0.0.0/8, 192.168.0.1",
+			expectedIP:     "203.0.113.7",
+		},
+		{
+			name:           "untrusted proxy ignores forwarded header",
+			trustedProxies: "192.168.0.1",
+			expectedIP:     "10.0.0.1",
+		},
+		{
+			name:           "invalid proxy list trusts nobody",
+			trustedProxies: "not-an-ip",
+			expectedIP:     "10.0.0.1",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("ENV_TRUSTED_PROXIES", tc.trustedProxies)
+
+			r := gin.New()
+			configureTrustedProxies(r, log)
+			r.GET("/ip", func(c *gin.Context) {
+				c.String(http.StatusOK, c.ClientIP())
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/ip", nil)
+			req.RemoteAddr = "10.0.0.1:12345"
+			req.Header.Set("X-Forwarded-For", "203.0.113.7")
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+
+			if rec.Body.String() != tc.expectedIP {
+				t.Errorf("Expected client IP %s, got %s", tc.expectedIP, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandleQuery_CostLimit(t *testing.T) {
+	s, _ := newTablesTestServer(t)
+	t.Setenv("ENV_MAX_ESTIMATED_ROWS", "5")
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedCode   string
+	}{
+		{name: "query within limit", query: "SELECT * FROM sales", expectedStatus: http.StatusOK},
+		{name: "cross join rejected", query: "SELECT * FROM sales a, sales b", expectedStatus: http.StatusUnprocessableEntity, expectedCode: "QUERY_TOO_EXPENSIVE"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := serveJSON(s, http.MethodPost, "/api/v1/query", map[string]any{"query": tc.query})
+			if rec.Code != tc.expectedStatus {
+				t.Fatalf("Expected status %d, got %d, body: %s", tc.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if tc.expectedCode == "" {
+				return
+			}
+
+			var response ErrorResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			if response.Code != tc.expectedCode {
+				t.Errorf("Expected code %s, got %s", tc.expectedCode, response.Code)
+			}
+		})
+	}
+}
+
+func TestHandleQuery_EmptyQuery(t *testing.T) {
+	s, _ := newTablesTestServer(t)
+
+	tests := []struct {
+		name  string
+		path  string
+		query string
+	}{
+		{name: "whitespace", path: "/api/v1/query", query: "   \n\t "},
+		{name: "only semicolons", path: "/api/v1/query", query: " ; ;"},
+		{name: "line comment", path: "/api/v1/query", query: "-- nothing to run"},
+		{name: "batch of comments", path: "/api/v1/query", query: "/* first */;\n-- second\n;/* third */"},
+		{name: "count only", path: "/api/v1/query?count_only=true", query: "-- nothing to count"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := serveJSON(s, http.MethodPost, tc.path, map[string]any{"query": tc.query})
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("Expected status %d, got %d, body: %s", http.StatusBadRequest, rec.Code, rec.Body.String())
+			}
+
+			var response ErrorResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			if response.Code != "EMPTY_QUERY" {
+				t.Errorf("Expected code EMPTY_QUERY, got %s", response.Code)
+			}
+		})
+	}
+}
+
+func TestHandleQuery_CountOnly(t *testing.T) {
+	s, _ := newTablesTestServer(t)
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedCount  int64
+	}{
+		{name: "counts all rows", query: "SELECT * FROM sales", expectedStatus: http.StatusOK, expectedCount: 3},
+		{name: "counts filtered rows", query: "SELECT * FROM sales WHERE region = 'north';", expectedStatus: http.StatusOK, expectedCount: 2},
+		{name: "non select rejected", query: "DELETE FROM sales", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := serveJSON(s, http.MethodPost, "/api/v1/query?count_only=true", map[string]any{"query": tc.query})
+			if rec.Code != tc.expectedStatus {
+				t.Fatalf("Expected status %d, got %d, body: %s", tc.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if tc.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var response map[string]any
+			if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			if _, ok := response["results"]; ok {
+				t.Error("Expected no results in count_only response")
+			}
+			if count, _ := response["row_count"].(float64); int64(count) != tc.expectedCount {
+				t.Errorf("Expected row_count %d, got %v", tc.expectedCount, response["row_count"])
+			}
+		})
+	}
+}
+
+func TestHandleQuery_ResultSizeHeaders(t *testing.T) {
+	s, _ := newTablesTestServer(t)
+
+	tests := []struct {
+		name         string
+		query        string
+		expectedRows string
+	}{
+		{name: "all rows", query: "SELECT * FROM sales", expectedRows: "3"},
+		{name: "filtered rows", query: "SELECT * FROM sales WHERE region = 'south'", expectedRows: "1"},
+		{name: "no rows", query: "SELECT * FROM sales WHERE amount > 100", expectedRows: "0"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := serveJSON(s, http.MethodPost, "/api/v1/query", map[string]any{"query": tc.query})
+			if rec.Code != http.StatusOK {
+				t.Fatalf("Expected status %d, got %d, body: %s", http.StatusOK, rec.Code, rec.Body.String())
+			}
+
+			if rows := rec.Header().Get("X-Result-Rows"); rows != tc.expectedRows {
+				t.Errorf("Expected X-Result-Rows %s, got %q", tc.expectedRows, rows)
+			}
+			if size := rec.Header().Get("X-Result-Bytes"); size != strconv.Itoa(rec.Body.Len()) {
+				t.Errorf("Expected X-Result-Bytes %d, got %q", rec.Body.Len(), size)
+			}
+			if contentType := rec.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "application/json") {
+				t.Errorf("Expected JSON content type, got %q", contentType)
+			}
+		})
+	}
+}
+
+func TestHandleQuery_DurationHeader(t *testing.T) {
+	s, _ := newTablesTestServer(t)
+
+	tests := []struct {
+		name         string
+		url          string
+		accept       string
+		disabled     bool
+		expectHeader bool
+	}{
+		{name: "json results", url: "/api/v1/query", expectHeader: true},
+		{name: "csv results", url: "/api/v1/query", accept: mimeCSV, expectHeader: true},
+		{name: "count only", url: "/api/v1/query?count_only=true", expectHeader: true},
+		{name: "disabled", url: "/api/v1/query", disabled: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.disabled {
+				t.Setenv("ENV_DISABLE_QUERY_DURATION_HEADER", "true")
+			}
+			req := httptest.NewRequest(http.MethodPost, tc.url, strings.NewReader(`{"query": "SELECT * FROM sales"}`))
+			req.Header.Set("Content-Type", "application/json")
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+			rec := httptest.NewRecorder()
+			s.Router().ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("Expected status %d, got %d, body: %s", http.StatusOK, rec.Code, rec.Body.String())
+			}
+
+			duration, ok := rec.Header()["X-Query-Duration-Ms"]
+			if ok != tc.expectHeader {
+				t.Fatalf("Expected X-Query-Duration-Ms present %v, got %v", tc.expectHeader, duration)
+			}
+			if ok {
+				if ms, err := strconv.ParseInt(duration[0], 10, 64); err != nil || ms < 0 {
+					t.Errorf("Expected a non-negative number of milliseconds, got %q", duration[0])
+				}
+			}
+		})
+	}
+}
+
+func TestHandleQuery_BenchmarkParam(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	t.Setenv("ENV_PROFILING_INTERVAL", "1h")
+	s, _ := newTablesTestServer(t)
+
+	tests := []struct {
+		name           string
+		param          string
+		strict         bool
+		expectedStatus int
+		expectedCode   string
+		expectedNote   string
+	}{
+		{name: "invalid value ignored", param: "yes", expectedStatus: http.StatusOK},
+		{name: "invalid value rejected in strict mode", param: "yes", strict: true, expectedStatus: http.StatusBadRequest, expectedCode: "INVALID_BENCHMARK_PARAM"},
+		{name: "empty value rejected in strict mode", param: "", strict: true, expectedStatus: http.StatusBadRequest, expectedCode: "INVALID_BENCHMARK_PARAM"},
+		{name: "false accepted in strict mode", param: "false", strict: true, expectedStatus: http.StatusOK},
+		{name: "first benchmark profiled", param: "true", strict: true, expectedStatus: http.StatusOK},
+		{name: "next benchmark within the interval", param: "true", expectedStatus: http.StatusOK, expectedNote: profilingSkippedNote},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.strict {
+				t.Setenv("ENV_STRICT_BENCHMARK_PARAM", "true")
+			}
+			rec := serveJSON(s, http.MethodPost, "/api/v1/query?benchmark="+tc.param, map[string]any{"query": "SELECT * FROM sales"})
+			if rec.Code != tc.expectedStatus {
+				t.Fatalf("Expected status %d, got %d, body: %s", tc.expectedStatus, rec.Code, rec.Body.String())
+			}
+
+			var response map[string]any
+			if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			if code, _ := response["code"].(string); code != tc.expectedCode {
+				t.Errorf("Expected code %q, got %q", tc.expectedCode, code)
+			}
+			if note, _ := response["benchmark_note"].(string); note != tc.expectedNote {
+				t.Errorf("Expected benchmark note %q, got %q", tc.expectedNote, note)
+			}
+		})
+	}
+}
+
+func TestQueryConcurrencyMiddleware(t *testing.T) {
+	t.Setenv("ENV_MAX_CONCURRENT_QUERIES", "1")
+	t.Setenv("ENV_QUERY_QUEUE_TIMEOUT", "200ms")
+
+	started, release := make(chan struct{}), make(chan struct{})
+	r := gin.New()
+	r.GET("/query", queryConcurrencyMiddleware(slog.New(slog.NewTextHandler(io.Discard, nil))), func(c *gin.Context) {
+		if c.Query("block") == "true" {
+			close(started)
+			<-release
+		}
+		c.Status(http.StatusOK)
+	})
+	serve := func(url string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+		return rec
+	}
+
+	blocked := make(chan int)
+	go func() { blocked <- serve("/query?block=true").Code }()
+	<-started
+
+	rec := serve("/query")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status %d while the only slot is taken, got %d: %s", http.StatusTooManyRequests, rec.Code, rec.Body.String())
+	}
+	var response ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil || response.Code != "TOO_MANY_QUERIES" {
+		t.Errorf("Expected error code TOO_MANY_QUERIES, got %s", rec.Body.String())
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("Expected a Retry-After header")
+	}
+
+	// A query queued within the timeout runs once the slot is freed
+	time.AfterFunc(50*time.Millisecond, func() { close(release) })
+	if rec := serve("/query"); rec.Code != http.StatusOK {
+		t.Errorf("Expected the queued query to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if code := <-blocked; code != http.StatusOK {
+		t.Errorf("Expected the blocking query to succeed, got %d", code)
+	}
+}
+
+func TestHandleQuery_NullRepresentation(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	s, _ := newTablesTestServer(t)
+
+	tests := []struct {
+		name     string
+		repr     string
+		accept   string
+		expected string
+	}{
+		{name: "json null by default", expected: `[{"id":1,"region":null}]`},
+		{name: "sentinel string", repr: "N/A", expected: `[{"id":1,"region":"N/A"}]`},
+		{name: "csv keeps empty fields", repr: "N/A", accept: mimeCSV, expected: "id,region\n1,\n"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("ENV_NULL_REPRESENTATION", tc.repr)
+
+			body, _ := json.Marshal(map[string]any{"query": "SELECT id, NULL AS region FROM sales WHERE id = 1"})
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/query", bytes.NewBuffer(body))
+			req.Header.Set("Content-Type", "application/json")
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+			rec := httptest.NewRecorder()
+			s.Router().ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d, body: %s", rec.Code, rec.Body.String())
+			}
+
+			if tc.accept == mimeCSV {
+				if rec.Body.String() != tc.expected {
+					t.Errorf("Expected CSV %q, got %q", tc.expected, rec.Body.String())
+				}
+				return
+			}
+			var response struct {
+				Results json.RawMessage `json:"results"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			if string(response.Results) != tc.expected {
+				t.Errorf("Expected results %s, got %s", tc.expected, response.Results)
+			}
+		})
+	}
+}
+
+func TestHandleQuery_MaxLength(t *testing.T) {
+	s, _ := newTablesTestServer(t)
+	t.Setenv("ENV_MAX_QUERY_LENGTH", "30")
+
+	if rec := serveJSON(s, http.MethodPost, "/api/v1/query", map[string]any{"query": "SELECT * FROM sales"}); rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d for a short query, got %d, body: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+
+	rec := serveJSON(s, http.MethodPost, "/api/v1/query", map[string]any{"query": "SELECT * FROM sales WHERE id = 1 OR id = 2"})
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status %d, got %d, body: %s", http.StatusBadRequest, rec.Code, rec.Body.String())
+	}
+	var response ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if response.Code != "QUERY_TOO_LONG" {
+		t.Errorf("Expected code QUERY_TOO_LONG, got %s", response.Code)
+	}
+}
+
+func TestHandleQuery_ETag(t *testing.T) {
+	s, db := newTablesTestServer(t)
+
+	query := func(sql, ifNoneMatch string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]any{"query": sql})
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/query", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rec := httptest.NewRecorder()
+		s.Router().ServeHTTP(rec, req)
+		return rec
+	}
+
+	first := query("SELECT * FROM sales", "")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" {
+		t.Fatalf("Expected 200 with an ETag, got %d and %q", first.Code, etag)
+	}
+
+	cached := query("SELECT * FROM sales", etag)
+	if cached.Code != http.StatusNotModified {
+		t.Fatalf("Expected status %d for an unchanged table, got %d", http.StatusNotModified, cached.Code)
+	}
+	if cached.Body.Len() != 0 {
+		t.Errorf("Expected an empty body for 304, got %q", cached.Body.String())
+	}
+	if cached.Header().Get("ETag") != etag {
+		t.Errorf("Expected 304 to repeat ETag %q, got %q", etag, cached.Header().Get("ETag"))
+	}
+
+	failed := query("SELECT CAST(region AS INTEGER) FROM sales", "")
+	if failed.Code != http.StatusInternalServerError {
+		t.Fatalf("Expected status %d for a failing query, got %d", http.StatusInternalServerError, failed.Code)
+	}
+	if failed.Header().Get("ETag") != "" {
+		t.Errorf("Expected no ETag on an error response, got %q", failed.Header().Get("ETag"))
+	}
+
+	if other := query("SELECT region FROM sales", etag); other.Code != http.StatusOK {
+		t.Errorf("Expected a different query not to match the ETag, got %d", other.Code)
+	}
+
+	if _, err := db.ExecuteQuery(context.Background(), "INSERT INTO sales VALUES (4, 'east', 40)"); err != nil {
+		t.Fatalf("Failed to modify table: %v", err)
+	}
+	modified := query("SELECT * FROM sales", etag)
+	if modified.Code != http.StatusOK {
+		t.Fatalf("Expected status %d after the table changed, got %d", http.StatusOK, modified.Code)
+	}
+	if modified.Header().Get("ETag") == etag {
+		t.Error("Expected a new ETag after the table changed")
+	}
+
+	if untagged := query("SELECT 42 AS answer", ""); untagged.Header().Get("ETag") != "" {
+		t.Errorf("Expected no ETag for a query that reads no tables, got %q", untagged.Header().Get("ETag"))
+	}
+}
+
+func TestHandleQuery_CSV(t *testing.T) {
+	s, _ := newTablesTestServer(t)
+
+	query := func(body map[string]any, accept string) *httptest.ResponseRecorder {
+		requestJSON, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/query", bytes.NewBuffer(requestJSON))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", accept)
+		rec := httptest.NewRecorder()
+		s.Router().ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := query(map[string]any{
+		"query": `SELECT id, region || ', "' || id || '"' AS label, NULL AS missing, 'line' || chr(10) || 'break' AS note FROM sales ORDER BY id`,
+		"limit": 2,
+	}, "text/csv")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	if contentType := rec.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/csv") {
+		t.Errorf("Expected a text/csv content type, got %q", contentType)
+	}
+	if rows := rec.Header().Get("X-Result-Rows"); rows != "2" {
+		t.Errorf("Expected 2 result rows, got %q", rows)
+	}
+	// The body is streamed, so its size is sent as a trailer
+	if size := rec.Result().Trailer.Get("X-Result-Bytes"); size != strconv.Itoa(rec.Body.Len()) {
+		t.Errorf("Expected an X-Result-Bytes trailer of %d, got %q", rec.Body.Len(), size)
+	}
+
+	// Columns keep the order of the query, fields with commas, quotes and newlines are quoted
+	expected := "id,label,missing,note\n" +
+		"1,\"north, \"\"1\"\"\",,\"line\nbreak\"\n" +
+		"2,\"south, \"\"2\"\"\",,\"line\nbreak\"\n"
+	if rec.Body.String() != expected {
+		t.Errorf("Unexpected CSV body:\n%s\nexpected:\n%s", rec.Body.String(), expected)
+	}
+
+	// JSON stays the default, and each representation has its own ETag
+	jsonRec := query(map[string]any{"query": "SELECT * FROM sales"}, "")
+	csvRec := query(map[string]any{"query": "SELECT * FROM sales"}, "text/csv")
+	if !strings.HasPrefix(jsonRec.Header().Get("Content-Type"), "application/json") {
+		t.Errorf("Expected JSON without an Accept header, got %q", jsonRec.Header().Get("Content-Type"))
+	}
+	if jsonRec.Header().Get("ETag") == csvRec.Header().Get("ETag") {
+		t.Error("Expected CSV and JSON results to have different ETags")
+	}
+
+	// An empty result still has a header row
+	empty := query(map[string]any{"query": "SELECT id, region FROM sales WHERE id > 100"}, "text/csv")
+	if empty.Body.String() != "id,region\n" {
+		t.Errorf("Expected only a header row, got %q", empty.Body.String())
+	}
+	// Excel compatibility adds a BOM and CRLF row endings, as another representation
+	excelReq := httptest.NewRequest(http.MethodPost, "/api/v1/query?excel_compat=true",
+		strings.NewReader(`{"query": "SELECT region, 'Zoë' AS name FROM sales WHERE id = 1"}`))
+	excelReq.Header.Set("Content-Type", "application/json")
+	excelReq.Header.Set("Accept", "text/csv")
+	excel := httptest.NewRecorder()
+	s.Router().ServeHTTP(excel, excelReq)
+	if excel.Body.String() != "\uFEFFregion,name\r\nnorth,Zoë\r\n" {
+		t.Errorf("Unexpected Excel CSV body: %q", excel.Body.String())
+	}
+	if size := excel.Result().Trailer.Get("X-Result-Bytes"); size != strconv.Itoa(excel.Body.Len()) {
+		t.Errorf("Expected the X-Result-Bytes trailer to count the BOM, %d bytes, got %q", excel.Body.Len(), size)
+	}
+	plain := query(map[string]any{"query": "SELECT region, 'Zoë' AS name FROM sales WHERE id = 1"}, "text/csv")
+	if excel.Header().Get("ETag") == plain.Header().Get("ETag") {
+		t.Error("Expected Excel and plain CSV results to have different ETags")
+	}
+}
+
+func TestEtagMatches(t *testing.T) {
+	tests := []struct {
+		ifNoneMatch string
+		expected    bool
+	}{
+		{ifNoneMatch: `"abc"`, expected: true},
+		{ifNoneMatch: `W/"abc"`, expected: true},
+		{ifNoneMatch: `"xyz", "abc"`, expected: true},
+		{ifNoneMatch: `*`, expected: true},
+		{ifNoneMatch: `"xyz"`, expected: false},
+		{ifNoneMatch: ``, expected: false},
+	}
+
+	for _, tc := range tests {
+		if got := etagMatches(tc.ifNoneMatch, `"abc"`); got != tc.expected {
+			t.Errorf("etagMatches(%q) = %v, expected %v", tc.ifNoneMatch, got, tc.expected)
+		}
+	}
+}
+
+func TestIfMatchMatches(t *testing.T) {
+	tests := []struct {
+		ifMatch  string
+		etag     string
+		expected bool
+	}{
+		{ifMatch: `"abc"`, etag: `"abc"`, expected: true},
+		{ifMatch: `"xyz", "abc"`, etag: `"abc"`, expected: true},
+		{ifMatch: `*`, etag: `"abc"`, expected: true},
+		{ifMatch: `W/"abc"`, etag: `"abc"`, expected: false},
+		{ifMatch: `"xyz"`, etag: `"abc"`, expected: false},
+		{ifMatch: `*`, etag: ``, expected: false},
+	}
+
+	for _, tc := range tests {
+		if got := ifMatchMatches(tc.ifMatch, tc.etag); got != tc.expected {
+			t.Errorf("ifMatchMatches(%q, %q) = %v, expected %v", tc.ifMatch, tc.etag, got, tc.expected)
+		}
+	}
+}
+
+func TestHandleQuery_NullVersusEmptyString(t *testing.T) {
+	s, _ := newTablesTestServer(t)
+
+	rec := serveJSON(s, http.MethodPost, "/api/v1/query", map[string]any{
+		"query": "SELECT * FROM (VALUES (1, NULL), (2, '')) AS t(id, label) ORDER BY id",
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d, body: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+
+	var response struct {
+		Results []map[string]json.RawMessage `json:"results"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if len(response.Results) != 2 {
+		t.Fatalf("Expected 2 rows, got %d", len(response.Results))
+	}
+	if label := string(response.Results[0]["label"]); label != "null" {
+		t.Errorf("Expected NULL to serialize as null, got %s", label)
+	}
+	if label := string(response.Results[1]["label"]); label != `""` {
+		t.Errorf(`Expected empty string to serialize as "", got %s`, label)
+	}
+}
+
+func TestHandleValidateQuery(t *testing.T) {
+	s, _ := newTablesTestServer(t)
+
+	tests := []struct {
+		name         string
+		body         map[string]any
+		status       int
+		valid        bool
+		code         string
+		warningCount int
+	}{
+		{name: "valid query", body: map[string]any{"query": "SELECT region, SUM(amount) FROM sales GROUP BY region"}, status: http.StatusOK, valid: true},
+		{name: "missing table", body: map[string]any{"query": "SELECT * FROM later"}, status: http.StatusOK, valid: true, warningCount: 1},
+		{name: "syntax error", body: map[string]any{"query": "SELECT FROM WHERE"}, status: http.StatusOK, code: "SYNTAX_ERROR"},
+		{name: "injection pattern", body: map[string]any{"query": "SELECT * FROM sales -- comment"}, status: http.StatusOK, code: "SUSPICIOUS_QUERY"},
+		{name: "empty query", body: map[string]any{"query": ";"}, status: http.StatusOK, code: "EMPTY_QUERY"},
+		{name: "missing query", body: map[string]any{}, status: http.StatusBadRequest},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := serveJSON(s, http.MethodPost, "/api/v1/query/validate", tc.body)
+			if rec.Code != tc.status {
+				t.Fatalf("Expected status %d, got %d: %s", tc.status, rec.Code, rec.Body.String())
+			}
+			if tc.status != http.StatusOK {
+				return
+			}
+
+			var response QueryValidateResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			if response.Valid != tc.valid || response.Code != tc.code {
+				t.Errorf("Expected valid=%v code=%q, got %+v", tc.valid, tc.code, response)
+			}
+			if !tc.valid && response.Error == "" {
+				t.Error("Expected the reason for an invalid query")
+			}
+			if len(response.Warnings) != tc.warningCount {
+				t.Errorf("Expected %d warnings, got %v", tc.warningCount, response.Warnings)
+			}
+		})
+	}
+}
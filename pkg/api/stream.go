@@ -0,0 +1,291 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/aliengiraffe/spotdb/pkg/helpers"
+)
+
+// streamSampleSize is how much of a streamed upload is kept to detect its format, as
+// DuckDB cannot sniff a named pipe it reads only once
+const streamSampleSize = 4 * 1024 * 1024
+
+// pipeOpenInterval is how often the pipe is opened for writing until DuckDB opens it
+// for reading
+var pipeOpenInterval = 10 * time.Millisecond
+
+// csvStream is an upload copied into a named pipe that DuckDB imports from, instead of
+// being staged in a temporary file. The upload is validated while it is copied, so the
+// import is only committed once Complete confirms the whole upload was valid.
+type csvStream struct {
+	dir        string
+	pipePath   string
+	samplePath string
+	cancel     context.CancelFunc
+
+	// done is closed when the copy finishes, after copyErrors and copyErr are set
+	done       chan struct{}
+	copyErrors []CSVError
+	copyErr    error
+}
+
+// streamCopyError is returned by Complete when the copy into the pipe failed, carrying
+// the validation errors to report instead of the import error
+type streamCopyError struct {
+	errors []CSVError
+	err    error
+}
+
+func (e *streamCopyError) Error() string { return e.err.Error() }
+
+func (e *streamCopyError) Unwrap() error { return e.err }
+
+// startCsvStream validates an uploaded file and starts copying it into a named pipe,
+// returning once the start of the upload is available to detect its format. Errors
+// found before that are returned right away, later ones are reported by Complete.
+// The caller closes the stream once the import is over.
+func (s *Server) startCsvStream(ctx context.Context, fileHeader *multipart.FileHeader, hasHeader bool, encoding string, skipRows int, ragged RaggedRows, fullValidation, failOnWarning bool) (*csvStream, []CSVError, error) {
+	log := helpers.GetLoggerFromContext(ctx)
+
+	file, validationErrors, err := s.openValidatedUpload(ctx, fileHeader, encoding, skipRows, ragged)
+	if err != nil {
+		return nil, validationErrors, err
+	}
+
+	stream, err := newCSVStream(ctx)
+	if err != nil {
+		helpers.CloseResources(file, "uploaded file")
+		log.Info("Error creating upload pipe", slog.Any("error", err))
+		pipeError := CSVError{
+			Code:    "TEMP_FILE_CREATION_ERROR",
+			Message: fmt.Sprintf("Failed to create upload pipe: %v", err),
+			Details: CSVErrorDetail{
+				Line:       0,
+				Suggestion: suggestionMap["TEMP_FILE_CREATION_ERROR"],
+			},
+		}
+		return nil, []CSVError{pipeError}, err
+	}
+
+	streamCtx, cancel := context.WithCancel(ctx)
+	stream.cancel = cancel
+	pipe := newPipeWriter(streamCtx, stream.pipePath, stream.samplePath)
+
+	go func() {
+		defer close(stream.done)
+		defer helpers.CloseResources(file, "uploaded file")
+
+		stream.copyErrors, stream.copyErr = s.copyFileData(ctx, file, pipe, fileHeader.Filename, hasHeader, encoding, skipRows, ragged, fullValidation, failOnWarning)
+		// copyFileData only closes the destination after a successful copy, and closing
+		// the pipe can still fail while writing the sample
+		if err := pipe.Close(); err != nil && stream.copyErr == nil {
+			stream.copyErrors = []CSVError{{
+				Code:    "FILE_COPY_ERROR",
+				Message: fmt.Sprintf("Error processing file: %v", err),
+				Details: CSVErrorDetail{
+					Line:       0,
+					Suggestion: suggestionMap["FILE_COPY_ERROR"],
+				},
+			}}
+			stream.copyErr = err
+		}
+	}()
+
+	select {
+	case <-pipe.sampleReady:
+		return stream, nil, nil
+	case <-stream.done:
+		if stream.copyErr != nil {
+			stream.Close()
+			return nil, stream.copyErrors, stream.copyErr
+		}
+		return stream, nil, nil
+	}
+}
+
+// newCSVStream creates the named pipe a streamed upload is imported from, next to the
+// file its sample is written to
+func newCSVStream(ctx context.Context) (*csvStream, error) {
+	dir, err := os.MkdirTemp("", "upload_stream_*")
+	if err != nil {
+		return nil, err
+	}
+
+	pipePath := filepath.Join(dir, "upload.csv")
+	if err := syscall.Mkfifo(pipePath, 0o600); err != nil {
+		removeStreamDir(ctx, dir)
+		return nil, fmt.Errorf("failed to create named pipe: %w", err)
+	}
+
+	return &csvStream{
+		dir:        dir,
+		pipePath:   pipePath,
+		samplePath: filepath.Join(dir, "sample.csv"),
+		done:       make(chan struct{}),
+	}, nil
+}
+
+// Complete waits for the copy into the pipe to finish and returns a *streamCopyError if
+// it failed. DuckDB only reaches the end of the pipe once the copy finished, so it does
+// not block once the table was created.
+func (st *csvStream) Complete() error {
+	<-st.done
+	if st.copyErr != nil {
+		return &streamCopyError{errors: st.copyErrors, err: st.copyErr}
+	}
+	return nil
+}
+
+// Close stops a copy still waiting for DuckDB, such as after an import that failed
+// before reading the pipe, and removes the pipe and the sample
+func (st *csvStream) Close() {
+	st.cancel()
+	<-st.done
+	removeStreamDir(context.Background(), st.dir)
+}
+
+// removeStreamDir removes the directory holding a stream's pipe and sample
+func removeStreamDir(ctx context.Context, dir string) {
+	if err := os.RemoveAll(dir); err != nil {
+		helpers.GetLoggerFromContext(ctx).Info("Warning: Failed to remove upload stream directory",
+			slog.String("path", dir),
+			slog.Any("error", err),
+		)
+	}
+}
+
+// pipeWriter writes an upload into a named pipe. The first streamSampleSize bytes are
+// held back and written, up to the last complete line, to the sample file before the
+// pipe is opened, since DuckDB detects the format from the sample before reading the pipe.
+type pipeWriter struct {
+	ctx        context.Context
+	pipePath   string
+	samplePath string
+
+	sample      []byte
+	sampleReady chan struct{}
+	pipe        *os.File
+	closed      bool
+	err         error
+}
+
+// newPipeWriter returns a writer for the named pipe at pipePath that stops waiting for
+// a reader, and for a reader to drain the pipe, when ctx is done
+func newPipeWriter(ctx context.Context, pipePath, samplePath string) *pipeWriter {
+	return &pipeWriter{
+		ctx:         ctx,
+		pipePath:    pipePath,
+		samplePath:  samplePath,
+		sample:      make([]byte, 0, streamSampleSize),
+		sampleReady: make(chan struct{}),
+	}
+}
+
+// Name returns the path of the pipe
+func (w *pipeWriter) Name() string {
+	return w.pipePath
+}
+
+// Write buffers p while the sample is collected and writes it to the pipe afterwards
+func (w *pipeWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	if w.pipe == nil {
+		buffered := min(len(p), streamSampleSize-len(w.sample))
+		w.sample = append(w.sample, p[:buffered]...)
+		if len(w.sample) < streamSampleSize {
+			return len(p), nil
+		}
+		if w.err = w.flushSample(false); w.err != nil {
+			return buffered, w.err
+		}
+		n, err := w.pipe.Write(p[buffered:])
+		w.err = err
+		return buffered + n, err
+	}
+
+	n, err := w.pipe.Write(p)
+	w.err = err
+	return n, err
+}
+
+// Close writes out an upload smaller than the sample and closes the pipe, which DuckDB
+// reads as the end of the upload. Closing it again returns the same error.
+func (w *pipeWriter) Close() error {
+	if !w.closed {
+		w.closed = true
+		if w.pipe == nil && w.err == nil {
+			w.err = w.flushSample(true)
+		}
+		if w.pipe != nil {
+			if err := w.pipe.Close(); err != nil && w.err == nil {
+				w.err = err
+			}
+		}
+	}
+
+	if errors.Is(w.err, os.ErrDeadlineExceeded) || errors.Is(w.err, context.Canceled) {
+		// The import is over, so what was left of the upload is no longer needed
+		return nil
+	}
+	return w.err
+}
+
+// flushSample writes the sample, up to its last complete line unless it holds the whole
+// upload, then opens the pipe and writes everything held back into it
+func (w *pipeWriter) flushSample(whole bool) error {
+	sample := w.sample
+	if !whole {
+		if end := bytes.LastIndexByte(sample, '\n'); end >= 0 {
+			sample = sample[:end+1]
+		}
+	}
+	if err := os.WriteFile(w.samplePath, sample, 0o600); err != nil {
+		return err
+	}
+	close(w.sampleReady)
+
+	pipe, err := openPipeForWriting(w.ctx, w.pipePath)
+	if err != nil {
+		return err
+	}
+	w.pipe = pipe
+	// Unblock writes to a pipe DuckDB stopped reading once the import is over
+	context.AfterFunc(w.ctx, func() {
+		_ = pipe.SetWriteDeadline(time.Now())
+	})
+
+	_, err = pipe.Write(w.sample)
+	w.sample = nil
+	return err
+}
+
+// openPipeForWriting opens the named pipe once a reader has opened it. The pipe is opened
+// without blocking so that waiting stops when ctx is done, for instance when the import
+// failed before DuckDB read the pipe.
+func openPipeForWriting(ctx context.Context, pipePath string) (*os.File, error) {
+	for {
+		pipe, err := os.OpenFile(pipePath, os.O_WRONLY|syscall.O_NONBLOCK, 0)
+		if !errors.Is(err, syscall.ENXIO) {
+			return pipe, err
+		}
+
+		// ENXIO means there is no reader yet
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(pipeOpenInterval):
+		}
+	}
+}
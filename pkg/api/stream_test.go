@@ -0,0 +1,128 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestUploadEndpointStream(t *testing.T) {
+	s, db := newTablesTestServer(t)
+
+	countRows := func(t *testing.T, table string) string {
+		t.Helper()
+		result, err := db.ExecuteQuery(context.Background(), "SELECT COUNT(*) AS n FROM "+table)
+		if err != nil {
+			t.Fatalf("failed to count rows: %v", err)
+		}
+		return fmt.Sprint(result.Results[0]["n"])
+	}
+
+	t.Run("imports a small upload", func(t *testing.T) {
+		fields := map[string]string{"table_name": "streamed_small", "has_header": "true", "stream": "true"}
+		req := newMultipartRequest(t, "/api/v1/upload", fields, "small.csv", []byte("id,name\n1,Ada\n2,Alan\n"))
+		rec := httptest.NewRecorder()
+		s.Router().ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+		}
+		if n := countRows(t, "streamed_small"); n != "2" {
+			t.Errorf("expected 2 rows, got %s", n)
+		}
+	})
+
+	t.Run("imports an upload larger than the sample", func(t *testing.T) {
+		var csvData bytes.Buffer
+		csvData.WriteString("id,name,amount\n")
+		rows := 0
+		for csvData.Len() < 2*streamSampleSize {
+			rows++
+			fmt.Fprintf(&csvData, "%d,name_%d,%d.5\n", rows, rows, rows)
+		}
+
+		fields := map[string]string{"table_name": "streamed_large", "has_header": "true", "stream": "true"}
+		req := newMultipartRequest(t, "/api/v1/upload", fields, "large.csv", csvData.Bytes())
+		rec := httptest.NewRecorder()
+		s.Router().ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+		}
+		if n := countRows(t, "streamed_large"); n != fmt.Sprint(rows) {
+			t.Errorf("expected %d rows, got %s", rows, n)
+		}
+	})
+
+	t.Run("leaves no files behind", func(t *testing.T) {
+		entries, err := os.ReadDir(os.TempDir())
+		if err != nil {
+			t.Fatalf("failed to list the temporary directory: %v", err)
+		}
+		for _, entry := range entries {
+			if strings.HasPrefix(entry.Name(), "upload_") {
+				t.Errorf("expected the upload files to be removed, found %s", entry.Name())
+			}
+		}
+	})
+
+	t.Run("rolls back when validation fails after the sample", func(t *testing.T) {
+		t.Setenv("ENV_FILE_VALIDATION_MODE", "reject_row")
+
+		var csvData bytes.Buffer
+		csvData.WriteString("id,note\n")
+		for i := 1; csvData.Len() < 2*streamSampleSize; i++ {
+			fmt.Fprintf(&csvData, "%d,fine\n", i)
+		}
+		csvData.WriteString("0,=HYPERLINK(\"http://example.com\")\n")
+
+		fields := map[string]string{"table_name": "streamed_strict", "has_header": "true", "stream": "true", "fail_on_warning": "true"}
+		req := newMultipartRequest(t, "/api/v1/upload", fields, "notes.csv", csvData.Bytes())
+		rec := httptest.NewRecorder()
+		s.Router().ServeHTTP(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusBadRequest, rec.Code, rec.Body.String())
+		}
+		if !strings.Contains(rec.Body.String(), "VALIDATION_WARNINGS_PRESENT") {
+			t.Errorf("expected VALIDATION_WARNINGS_PRESENT, got %s", rec.Body.String())
+		}
+		if _, err := db.ExecuteQuery(context.Background(), "SELECT * FROM streamed_strict"); err == nil {
+			t.Error("expected the table not to be created")
+		}
+	})
+
+	t.Run("rejects type_row", func(t *testing.T) {
+		fields := map[string]string{"table_name": "streamed_types", "has_header": "true", "type_row": "true", "stream": "true"}
+		req := newMultipartRequest(t, "/api/v1/upload", fields, "types.csv", []byte("id,name\nINTEGER,VARCHAR\n1,Ada\n"))
+		rec := httptest.NewRecorder()
+		s.Router().ServeHTTP(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusBadRequest, rec.Code, rec.Body.String())
+		}
+		if !strings.Contains(rec.Body.String(), "INVALID_REQUEST_PARAMETERS") {
+			t.Errorf("expected INVALID_REQUEST_PARAMETERS, got %s", rec.Body.String())
+		}
+	})
+}
+
+func TestPipeWriterKeepsSampleToLastCompleteLine(t *testing.T) {
+	dir := t.TempDir()
+	samplePath := dir + "/sample.csv"
+	w := newPipeWriter(context.Background(), dir+"/missing", samplePath)
+	w.sample = append(w.sample, "a,b\n1,2\n3,"...)
+
+	// The pipe does not exist, so opening it fails once the sample is written
+	if err := w.flushSample(false); err == nil {
+		t.Fatal("expected opening a missing pipe to fail")
+	}
+	sample, err := os.ReadFile(samplePath)
+	if err != nil {
+		t.Fatalf("failed to read the sample: %v", err)
+	}
+	if string(sample) != "a,b\n1,2\n" {
+		t.Errorf("expected the sample to end at the last complete line, got %q", sample)
+	}
+}
@@ -0,0 +1,950 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/aliengiraffe/spotdb/pkg/database"
+	"github.com/aliengiraffe/spotdb/pkg/helpers"
+	"github.com/gin-gonic/gin"
+)
+
+// handleCreateTable godoc
+//
+//	@Summary		Create table from query
+//	@Description	Materialize the results of a SELECT query into a new table (CREATE TABLE ... AS)
+//	@Tags			tables
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		api.CreateTableRequest	true	"Table name and SELECT query"
+//	@Success		200		{object}	api.CreateTableResponse	"Table created successfully"
+//	@Failure		400		{object}	api.ErrorResponse		"Bad request (invalid parameters or not a SELECT query)"
+//	@Failure		403		{object}	api.ErrorResponse		"Read-only API key or database with error code: READ_ONLY_API_KEY or READ_ONLY_MODE"
+//	@Failure		422		{object}	api.ErrorResponse		"Table already exists"
+//	@Failure		500		{object}	api.ErrorResponse		"Internal server error"
+//	@Router			/tables [post]
+func (s *Server) handleCreateTable() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		log := getLoggerFromGinContext(c)
+
+		var payload CreateTableRequest
+		if err := c.ShouldBindJSON(&payload); err != nil {
+			log.Error("Error binding create table request", slog.Any("error", err))
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Status:  "error",
+				Message: "Invalid create table request: " + err.Error(),
+			})
+			return
+		}
+
+		if err := database.ValidateTableName(payload.TableName); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Status:  "error",
+				Code:    "INVALID_TABLE_NAME",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		tableName := database.SanitizeTableName(payload.TableName)
+		log.Info("Create table request received",
+			slog.String("table", tableName),
+			slog.Bool("override", payload.Override))
+
+		if !payload.Override {
+			if exists, err := s.checkTableExists(ctx, database.DefaultSchema, tableName); err == nil && exists {
+				c.JSON(http.StatusUnprocessableEntity, ErrorResponse{
+					Status:  "error",
+					Message: fmt.Sprintf("Table '%s' already exists. Use override=true to replace it or choose a different table name.", tableName),
+				})
+				return
+			}
+		}
+
+		if err := s.db.CreateTableFromQuery(ctx, tableName, payload.Query, payload.Override); err != nil {
+			log.Error("Error creating table from query", slog.Any("error", err))
+			status, code := http.StatusInternalServerError, ""
+			switch {
+			case errors.Is(err, database.ErrEmptyQuery):
+				status, code = http.StatusBadRequest, "EMPTY_QUERY"
+			case errors.Is(err, database.ErrQueryTooLong):
+				status, code = http.StatusBadRequest, "QUERY_TOO_LONG"
+			case errors.Is(err, database.ErrSuspiciousQuery):
+				status, code = http.StatusBadRequest, "SUSPICIOUS_QUERY"
+			case errors.Is(err, database.ErrNotSelectQuery):
+				status = http.StatusBadRequest
+			}
+			c.JSON(status, ErrorResponse{
+				Status:  "error",
+				Code:    code,
+				Message: "Failed to create table: " + err.Error(),
+			})
+			return
+		}
+
+		if rowCount, ok := s.sendCreatedTable(ctx, c, tableName); ok {
+			log.Info("Table created from query",
+				slog.String("table", tableName),
+				slog.Int64("row_count", rowCount))
+		}
+	}
+}
+
+// sendCreatedTable responds with the columns and row count of a table created in the
+// default schema, reporting the row count and whether the response was a success
+func (s *Server) sendCreatedTable(ctx context.Context, c *gin.Context, tableName string) (int64, bool) {
+	qualifiedTableName := database.QualifiedTableName(database.DefaultSchema, tableName)
+	columnsResult, _, err := s.getColumnInfo(ctx, c, qualifiedTableName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Status:  "error",
+			Message: "Failed to get table column information: " + err.Error(),
+		})
+		return 0, false
+	}
+
+	rowCount, _, err := s.countRows(ctx, c, qualifiedTableName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Status:  "error",
+			Message: "Failed to count rows in table: " + err.Error(),
+		})
+		return 0, false
+	}
+
+	c.JSON(http.StatusOK, CreateTableResponse{
+		Status:   "success",
+		Table:    tableName,
+		Columns:  columnsResult.Results,
+		RowCount: rowCount,
+	})
+	return rowCount, true
+}
+
+// handleTableDDL godoc
+//
+//	@Summary		Table DDL
+//	@Description	Get the CREATE TABLE statement of a table, to recreate its structure elsewhere
+//	@Tags			tables
+//	@Produce		json
+//	@Param			name	path		string					true	"Table name"
+//	@Success		200		{object}	api.TableDDLResponse	"CREATE TABLE statement"
+//	@Failure		404		{object}	api.ErrorResponse		"Table not found"
+//	@Failure		409		{object}	api.AmbiguousTableResponse	"Table name matches several tables ignoring case, error code: AMBIGUOUS_TABLE_NAME"
+//	@Failure		500		{object}	api.ErrorResponse		"Internal server error"
+//	@Router			/tables/{name}/ddl [get]
+func (s *Server) handleTableDDL() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		log := getLoggerFromGinContext(c)
+		tableName, ok := s.resolveTableParam(c)
+		if !ok {
+			return // Error response already sent
+		}
+
+		ddl, err := s.db.TableDDL(c.Request.Context(), database.TableRef{Schema: database.DefaultSchema, Name: tableName})
+		if errors.Is(err, database.ErrTableNotFound) {
+			c.JSON(http.StatusNotFound, ErrorResponse{
+				Status:  "error",
+				Message: fmt.Sprintf("Table '%s' not found", tableName),
+			})
+			return
+		}
+		if err != nil {
+			log.Error("Error getting table DDL", slog.Any("error", err))
+			c.JSON(http.StatusInternalServerError, ErrorResponse{
+				Status:  "error",
+				Message: "Failed to get table DDL: " + err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, TableDDLResponse{
+			Status: "success",
+			Table:  tableName,
+			DDL:    ddl,
+		})
+	}
+}
+
+// tableRowCountHeader reports the number of rows of a table in HEAD responses
+const tableRowCountHeader = "X-Row-Count"
+
+// handleTableHead godoc
+//
+//	@Summary		Check table existence
+//	@Description	Check that a table exists without fetching its schema or data, e.g. to poll for a table. The row count is returned in the X-Row-Count header and the table version in the ETag header, for If-Match on uploads that replace the table.
+//	@Tags			tables
+//	@Param			name	path	string	true	"Table name"
+//	@Success		200		"Table exists"
+//	@Header			200		{integer}	X-Row-Count	"Number of rows in the table"
+//	@Header			200		{string}	ETag		"Version of the table"
+//	@Failure		404		"Table not found"
+//	@Failure		409		"Table name matches several tables ignoring case"
+//	@Failure		500		"Internal server error"
+//	@Router			/tables/{name} [head]
+func (s *Server) handleTableHead() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		log := getLoggerFromGinContext(c)
+		tableName, ok := s.resolveTableParam(c)
+		if !ok {
+			return // Error response already sent
+		}
+
+		if !s.requireTable(c, tableName) {
+			return
+		}
+
+		rowCount, _, err := s.countRows(ctx, c, database.QualifiedTableName(database.DefaultSchema, tableName))
+		if err != nil {
+			log.Error("Error counting table rows", slog.Any("error", err))
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+
+		c.Header(tableRowCountHeader, strconv.FormatInt(rowCount, 10))
+		if etag, err := s.db.TableETag(ctx, database.DefaultSchema, tableName); err == nil && etag != "" {
+			c.Header("ETag", etag)
+		}
+		c.Status(http.StatusOK)
+	}
+}
+
+// Distinct values limits
+const (
+	// DefaultDistinctLimit is the number of distinct values returned when no limit is given
+	DefaultDistinctLimit = 100
+	// MaxDistinctLimit caps the number of distinct values to prevent huge responses
+	MaxDistinctLimit = 1000
+)
+
+// handleDistinctValues godoc
+//
+//	@Summary		Distinct column values
+//	@Description	Get the distinct values of a table column, e.g. to build filter dropdowns
+//	@Tags			tables
+//	@Produce		json
+//	@Param			name	path		string						true	"Table name"
+//	@Param			col		path		string						true	"Column name"
+//	@Param			limit	query		int							false	"Maximum number of values (default 100, max 1000)"
+//	@Success		200		{object}	api.DistinctValuesResponse	"Distinct values"
+//	@Failure		400		{object}	api.ErrorResponse			"Invalid limit"
+//	@Failure		404		{object}	api.ErrorResponse			"Table or column not found"
+//	@Failure		409		{object}	api.AmbiguousTableResponse	"Table name matches several tables ignoring case, error code: AMBIGUOUS_TABLE_NAME"
+//	@Failure		500		{object}	api.ErrorResponse			"Internal server error"
+//	@Router			/tables/{name}/columns/{col}/distinct [get]
+func (s *Server) handleDistinctValues() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		log := getLoggerFromGinContext(c)
+
+		limit, err := parseDistinctLimit(c.Query("limit"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Status:  "error",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		tableName, ok := s.resolveTableParam(c)
+		if !ok {
+			return // Error response already sent
+		}
+		columnName := c.Param("col")
+
+		columns, ok := s.lookupTableColumns(c, tableName)
+		if !ok {
+			return // Error response already sent
+		}
+
+		if !slices.Contains(columns, columnName) {
+			c.JSON(http.StatusNotFound, ErrorResponse{
+				Status:  "error",
+				Message: fmt.Sprintf("Column '%s' not found in table '%s'", columnName, tableName),
+			})
+			return
+		}
+
+		// Fetch one extra row to detect truncation
+		query := fmt.Sprintf("SELECT DISTINCT %s AS value FROM %s ORDER BY value NULLS LAST LIMIT %d",
+			database.QuoteIdentifier(columnName), database.QualifiedTableName(database.DefaultSchema, tableName), limit+1)
+		result, err := s.db.ExecuteQuery(ctx, query)
+		if err != nil {
+			log.Error("Error getting distinct values", slog.Any("error", err))
+			c.JSON(http.StatusInternalServerError, ErrorResponse{
+				Status:  "error",
+				Message: "Failed to get distinct values: " + err.Error(),
+			})
+			return
+		}
+
+		truncated := len(result.Results) > limit
+		rows := result.Results[:min(len(result.Results), limit)]
+		values := make([]interface{}, 0, len(rows))
+		for _, row := range rows {
+			values = append(values, row["value"])
+		}
+
+		c.JSON(http.StatusOK, DistinctValuesResponse{
+			Status:    "success",
+			Table:     tableName,
+			Column:    columnName,
+			Values:    values,
+			Truncated: truncated,
+		})
+	}
+}
+
+// parseDistinctLimit parses the limit query parameter, applying the default and cap
+func parseDistinctLimit(limitParam string) (int, error) {
+	if limitParam == "" {
+		return DefaultDistinctLimit, nil
+	}
+
+	limit, err := strconv.Atoi(limitParam)
+	if err != nil || limit <= 0 {
+		return 0, fmt.Errorf("invalid limit '%s': must be a positive integer", limitParam)
+	}
+
+	return min(limit, MaxDistinctLimit), nil
+}
+
+// lookupTableColumns returns the column names of a table, sending a 404 response when
+// the table does not exist
+func (s *Server) lookupTableColumns(c *gin.Context, tableName string) ([]string, bool) {
+	ctx := c.Request.Context()
+
+	if !s.requireTable(c, tableName) {
+		return nil, false
+	}
+
+	columnsResult, _, err := s.getColumnInfo(ctx, c, database.QualifiedTableName(database.DefaultSchema, tableName))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Status:  "error",
+			Message: "Failed to get table column information: " + err.Error(),
+		})
+		return nil, false
+	}
+
+	columns := make([]string, 0, len(columnsResult.Results))
+	for _, row := range columnsResult.Results {
+		if name, ok := row["name"].(string); ok {
+			columns = append(columns, name)
+		}
+	}
+
+	return columns, true
+}
+
+// requireTable reports whether the table exists, sending a 404 response when it does not
+func (s *Server) requireTable(c *gin.Context, tableName string) bool {
+	exists, err := s.checkTableExists(c.Request.Context(), database.DefaultSchema, tableName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Status:  "error",
+			Message: "Failed to check table existence: " + err.Error(),
+		})
+		return false
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, ErrorResponse{
+			Status:  "error",
+			Message: fmt.Sprintf("Table '%s' not found", tableName),
+		})
+		return false
+	}
+	return true
+}
+
+// resolveTableParam returns the table named by the name path parameter. With
+// ENV_CASE_INSENSITIVE_TABLES the name is matched against the tables of the default schema
+// ignoring case and their canonical name is returned, answering 404 when no table matches
+// and 409 with the candidates when several do. It reports whether a table was resolved.
+func (s *Server) resolveTableParam(c *gin.Context) (string, bool) {
+	tableName := database.SanitizeTableName(c.Param("name"))
+	if !helpers.IsCaseInsensitiveTableLookupEnabled() {
+		return tableName, true
+	}
+
+	resolved, err := s.db.ResolveTableName(c.Request.Context(), database.DefaultSchema, tableName)
+	var ambiguous *database.AmbiguousTableNameError
+	switch {
+	case err == nil:
+		return resolved, true
+	case errors.Is(err, database.ErrTableNotFound):
+		c.JSON(http.StatusNotFound, ErrorResponse{
+			Status:  "error",
+			Message: fmt.Sprintf("Table '%s' not found", tableName),
+		})
+	case errors.As(err, &ambiguous):
+		c.JSON(http.StatusConflict, AmbiguousTableResponse{
+			Status:     "error",
+			Code:       "AMBIGUOUS_TABLE_NAME",
+			Message:    fmt.Sprintf("Table name '%s' matches several tables ignoring case, use one of the candidates", tableName),
+			Candidates: ambiguous.Candidates,
+		})
+	default:
+		getLoggerFromGinContext(c).Error("Error resolving table name", slog.Any("error", err))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Status:  "error",
+			Message: "Failed to resolve table name: " + err.Error(),
+		})
+	}
+	return "", false
+}
+
+// Table sample limits
+const (
+	// DefaultSampleRows is the number of rows sampled when neither percent nor rows is given
+	DefaultSampleRows = 100
+	// MaxSampleRows caps the number of sampled rows returned to prevent huge responses
+	MaxSampleRows = 10000
+)
+
+// sampleMethods maps the accepted sample methods to DuckDB sampling methods. random picks
+// every row independently, as bernoulli does.
+var sampleMethods = map[string]string{
+	"random":    "bernoulli",
+	"bernoulli": "bernoulli",
+	"system":    "system",
+	"reservoir": "reservoir",
+}
+
+// tableSample describes a USING SAMPLE clause, sampling either a percentage of the rows
+// or a fixed number of rows
+type tableSample struct {
+	Method  string
+	Percent float64
+	Rows    int
+}
+
+// clause returns the sample as the argument of a DuckDB USING SAMPLE clause
+func (t tableSample) clause() string {
+	if t.Rows > 0 {
+		return fmt.Sprintf("%s(%d ROWS)", t.Method, t.Rows)
+	}
+	return fmt.Sprintf("%s(%s PERCENT)", t.Method, strconv.FormatFloat(t.Percent, 'f', -1, 64))
+}
+
+// parseTableSample validates the method, percent and rows query parameters. Without a
+// method, percentages use system sampling and row counts reservoir sampling, as in DuckDB.
+func parseTableSample(methodParam, percentParam, rowsParam string) (tableSample, error) {
+	if percentParam != "" && rowsParam != "" {
+		return tableSample{}, errors.New("percent and rows cannot be combined")
+	}
+
+	method := ""
+	if methodParam != "" {
+		var ok bool
+		if method, ok = sampleMethods[strings.ToLower(methodParam)]; !ok {
+			return tableSample{}, fmt.Errorf("invalid method '%s': must be random, bernoulli, system or reservoir", methodParam)
+		}
+	}
+
+	if percentParam != "" {
+		percent, err := strconv.ParseFloat(percentParam, 64)
+		if err != nil || math.IsNaN(percent) || percent <= 0 || percent > 100 {
+			return tableSample{}, fmt.Errorf("invalid percent '%s': must be greater than 0 and at most 100", percentParam)
+		}
+		if method == "" {
+			method = "system"
+		}
+		return tableSample{Method: method, Percent: percent}, nil
+	}
+
+	rows, err := parseSampleRows(rowsParam)
+	if err != nil {
+		return tableSample{}, err
+	}
+	if method != "" && method != "reservoir" {
+		return tableSample{}, fmt.Errorf("method '%s' samples a percentage of rows, use percent or the reservoir method", methodParam)
+	}
+	return tableSample{Method: "reservoir", Rows: rows}, nil
+}
+
+// parseSampleRows parses the rows query parameter, applying DefaultSampleRows and the
+// MaxSampleRows cap
+func parseSampleRows(rowsParam string) (int, error) {
+	if rowsParam == "" {
+		return DefaultSampleRows, nil
+	}
+	rows, err := strconv.Atoi(rowsParam)
+	if err != nil || rows <= 0 {
+		return 0, fmt.Errorf("invalid rows '%s': must be a positive integer", rowsParam)
+	}
+	return min(rows, MaxSampleRows), nil
+}
+
+// handleTableSample godoc
+//
+//	@Summary		Random table sample
+//	@Description	Get a random sample of a table with DuckDB's USING SAMPLE clause, giving a representative distribution rather than the first rows. Sample either a percentage of the rows or a number of rows; at most 10000 rows are returned.
+//	@Tags			tables
+//	@Produce		json
+//	@Param			name	path		string						true	"Table name"
+//	@Param			method	query		string						false	"Sampling method: random (bernoulli), bernoulli, system or reservoir"
+//	@Param			percent	query		number						false	"Percentage of rows to sample, greater than 0 and at most 100"
+//	@Param			rows	query		int							false	"Number of rows to sample with the reservoir method (default 100, max 10000)"
+//	@Success		200		{object}	api.TableSampleResponse		"Sampled rows"
+//	@Failure		400		{object}	api.ErrorResponse			"Invalid method, percent or rows"
+//	@Failure		404		{object}	api.ErrorResponse			"Table not found"
+//	@Failure		409		{object}	api.AmbiguousTableResponse	"Table name matches several tables ignoring case, error code: AMBIGUOUS_TABLE_NAME"
+//	@Failure		500		{object}	api.ErrorResponse			"Internal server error"
+//	@Router			/tables/{name}/sample [get]
+func (s *Server) handleTableSample() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		log := getLoggerFromGinContext(c)
+
+		sample, err := parseTableSample(c.Query("method"), c.Query("percent"), c.Query("rows"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Status:  "error",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		tableName, ok := s.resolveTableParam(c)
+		if !ok {
+			return // Error response already sent
+		}
+		if !s.requireTable(c, tableName) {
+			return // Error response already sent
+		}
+
+		// Fetch one extra row to detect truncation of large percentage samples
+		query := fmt.Sprintf("SELECT * FROM %s USING SAMPLE %s LIMIT %d",
+			database.QualifiedTableName(database.DefaultSchema, tableName), sample.clause(), MaxSampleRows+1)
+		result, err := s.db.ExecuteQuery(c.Request.Context(), query)
+		if err != nil {
+			log.Error("Error sampling table", slog.Any("error", err))
+			c.JSON(http.StatusInternalServerError, ErrorResponse{
+				Status:  "error",
+				Message: "Failed to sample table: " + err.Error(),
+			})
+			return
+		}
+
+		truncated := len(result.Results) > MaxSampleRows
+		rows := result.Results[:min(len(result.Results), MaxSampleRows)]
+
+		c.JSON(http.StatusOK, TableSampleResponse{
+			Status:    "success",
+			Table:     tableName,
+			Sample:    sample.clause(),
+			RowCount:  len(rows),
+			Results:   rows,
+			Truncated: truncated,
+		})
+	}
+}
+
+// handleRefineTypes godoc
+//
+//	@Summary		Refine column types
+//	@Description	Propose the tightest of INTEGER, BIGINT, DOUBLE, DATE and TIMESTAMP for every VARCHAR column of a table, such as one uploaded with all_varchar, with the number of values that cannot be cast to each type without losing information. With apply the whole table is analyzed and the columns every value fits are altered to the proposed type.
+//	@Tags			tables
+//	@Accept			json
+//	@Produce		json
+//	@Param			name	path		string						true	"Table name"
+//	@Param			request	body		api.RefineTypesRequest		false	"Apply the proposals, or analyze a sample of rows"
+//	@Success		200		{object}	api.RefineTypesResponse		"Proposed, or applied, column types"
+//	@Failure		400		{object}	api.ErrorResponse			"Invalid request"
+//	@Failure		403		{object}	api.ErrorResponse			"Read-only API key or database with error code: READ_ONLY_API_KEY or READ_ONLY_MODE"
+//	@Failure		404		{object}	api.ErrorResponse			"Table not found"
+//	@Failure		500		{object}	api.ErrorResponse			"Internal server error"
+//	@Router			/tables/{name}/refine_types [post]
+func (s *Server) handleRefineTypes() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		log := getLoggerFromGinContext(c)
+
+		// The body is optional, an empty one only proposes types for the whole table
+		var payload RefineTypesRequest
+		if err := c.ShouldBindJSON(&payload); err != nil && !errors.Is(err, io.EOF) {
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Status:  "error",
+				Message: "Invalid refine types request: " + err.Error(),
+			})
+			return
+		}
+
+		// Proposals only read the table, applying them alters it
+		if payload.Apply {
+			if isReadOnlyKey(c) {
+				rejectReadOnlyKey(c, "This API key cannot alter tables, send apply=false to only propose types")
+				return
+			}
+			if s.db.IsReadOnly() {
+				rejectReadOnlyMode(c)
+				return
+			}
+			if s.rejectDuringMaintenance(c) {
+				return
+			}
+		}
+
+		tableName := database.SanitizeTableName(c.Param("name"))
+		if !s.requireTable(c, tableName) {
+			return // Error response already sent
+		}
+
+		table := database.TableRef{Schema: database.DefaultSchema, Name: tableName}
+		refinements, err := s.db.RefineColumnTypes(c.Request.Context(), table, payload.SampleSize, payload.Apply)
+		if err != nil {
+			log.Error("Error refining column types", slog.Any("error", err))
+			c.JSON(http.StatusInternalServerError, ErrorResponse{
+				Status:  "error",
+				Message: "Failed to refine column types: " + err.Error(),
+			})
+			return
+		}
+
+		response := RefineTypesResponse{
+			Status:  "success",
+			Table:   tableName,
+			Applied: payload.Apply,
+			Columns: make([]ColumnRefinement, 0, len(refinements)),
+		}
+		if !payload.Apply {
+			response.SampleSize = payload.SampleSize
+		}
+		for _, refinement := range refinements {
+			response.Columns = append(response.Columns, ColumnRefinement{
+				Column:        refinement.Column,
+				ProposedType:  refinement.ProposedType,
+				NonNullValues: refinement.NonNullValues,
+				Failures:      refinement.Failures,
+				Applied:       refinement.Applied,
+			})
+		}
+
+		log.Info("Refined column types",
+			slog.String("table", tableName),
+			slog.Int("columns", len(response.Columns)),
+			slog.Bool("applied", payload.Apply))
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// handleSetRowFilter godoc
+//
+//	@Summary		Set a table row filter
+//	@Description	Set the predicate that limits the rows of a table tenant API keys can read, replacing any previous one. Queries of tenant keys see the table filtered by the predicate, where {tenant} stands for the tenant of the key as a string literal.
+//	@Tags			tables
+//	@Accept			json
+//	@Produce		json
+//	@Param			name	path		string					true	"Table name"
+//	@Param			request	body		api.RowFilterRequest	true	"Row filter predicate"
+//	@Success		200		{object}	api.RowFilterResponse	"Row filter set"
+//	@Failure		400		{object}	api.ErrorResponse		"Invalid request or predicate, error code: INVALID_ROW_FILTER"
+//	@Failure		403		{object}	api.ErrorResponse		"Read-only API key or database with error code: READ_ONLY_API_KEY or READ_ONLY_MODE"
+//	@Failure		404		{object}	api.ErrorResponse		"Table not found"
+//	@Failure		500		{object}	api.ErrorResponse		"Internal server error"
+//	@Router			/tables/{name}/row_filter [put]
+func (s *Server) handleSetRowFilter() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		log := getLoggerFromGinContext(c)
+
+		var payload RowFilterRequest
+		if err := c.ShouldBindJSON(&payload); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Status:  "error",
+				Message: "Invalid row filter request: " + err.Error(),
+			})
+			return
+		}
+
+		tableName := database.SanitizeTableName(c.Param("name"))
+		err := s.db.SetRowFilter(c.Request.Context(), tableName, payload.Predicate)
+		if errors.Is(err, database.ErrTableNotFound) {
+			c.JSON(http.StatusNotFound, ErrorResponse{
+				Status:  "error",
+				Message: fmt.Sprintf("Table '%s' not found", tableName),
+			})
+			return
+		}
+		if errors.Is(err, database.ErrInvalidRowFilter) {
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Status:  "error",
+				Code:    "INVALID_ROW_FILTER",
+				Message: err.Error(),
+			})
+			return
+		}
+		if err != nil {
+			log.Error("Error setting row filter", slog.Any("error", err))
+			c.JSON(http.StatusInternalServerError, ErrorResponse{
+				Status:  "error",
+				Message: "Failed to set row filter: " + err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, RowFilterResponse{
+			Status:    "success",
+			Table:     tableName,
+			Predicate: strings.TrimSpace(payload.Predicate),
+		})
+	}
+}
+
+// handleDeleteRowFilter godoc
+//
+//	@Summary		Remove a table row filter
+//	@Description	Remove the row filter of a table, so tenant API keys read all of its rows
+//	@Tags			tables
+//	@Produce		json
+//	@Param			name	path		string					true	"Table name"
+//	@Success		200		{object}	api.RowFilterResponse	"Row filter removed"
+//	@Failure		403		{object}	api.ErrorResponse		"Read-only API key or database with error code: READ_ONLY_API_KEY or READ_ONLY_MODE"
+//	@Failure		404		{object}	api.ErrorResponse		"Table has no row filter"
+//	@Failure		500		{object}	api.ErrorResponse		"Internal server error"
+//	@Router			/tables/{name}/row_filter [delete]
+func (s *Server) handleDeleteRowFilter() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		log := getLoggerFromGinContext(c)
+		tableName := database.SanitizeTableName(c.Param("name"))
+
+		deleted, err := s.db.DeleteRowFilter(c.Request.Context(), tableName)
+		if err != nil {
+			log.Error("Error removing row filter", slog.Any("error", err))
+			c.JSON(http.StatusInternalServerError, ErrorResponse{
+				Status:  "error",
+				Message: "Failed to remove row filter: " + err.Error(),
+			})
+			return
+		}
+		if !deleted {
+			c.JSON(http.StatusNotFound, ErrorResponse{
+				Status:  "error",
+				Message: fmt.Sprintf("Table '%s' has no row filter", tableName),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, RowFilterResponse{Status: "success", Table: tableName})
+	}
+}
+
+// handleDropTablesByPrefix godoc
+//
+//	@Summary		Drop tables by name prefix
+//	@Description	Drop every table whose name starts with the sanitized prefix in a single transaction. Hidden and internal tables are never dropped. The request must set confirm=true, and each client can make ENV_BULK_DELETE_RATE_LIMIT of them per minute.
+//	@Tags			tables
+//	@Produce		json
+//	@Param			prefix	query		string						true	"Table name prefix"
+//	@Param			confirm	query		bool						true	"Must be true to drop the tables"
+//	@Success		200		{object}	api.DropTablesResponse		"Dropped tables"
+//	@Failure		400		{object}	api.ErrorResponse			"Missing prefix or confirmation with error code: INVALID_PREFIX or CONFIRMATION_REQUIRED"
+//	@Failure		403		{object}	api.ErrorResponse			"Read-only API key or database with error code: READ_ONLY_API_KEY or READ_ONLY_MODE"
+//	@Failure		429		{string}	string						"Too many requests"
+//	@Failure		500		{object}	api.ErrorResponse			"Internal server error"
+//	@Router			/tables [delete]
+func (s *Server) handleDropTablesByPrefix() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		log := getLoggerFromGinContext(c)
+
+		prefix := strings.TrimSpace(c.Query("prefix"))
+		if prefix == "" {
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Status:  "error",
+				Code:    "INVALID_PREFIX",
+				Message: "A table name prefix is required",
+			})
+			return
+		}
+		// Sanitizing would silently change the match, "test-" would drop every "test_" table,
+		// so a prefix that table name sanitization would rewrite is rejected instead.
+		if database.SanitizeTableName(prefix) != prefix {
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Status:  "error",
+				Code:    "INVALID_PREFIX",
+				Message: fmt.Sprintf("Invalid prefix '%s': it contains characters that are not allowed in table names", prefix),
+			})
+			return
+		}
+		if c.Query("confirm") != "true" {
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Status:  "error",
+				Code:    "CONFIRMATION_REQUIRED",
+				Message: fmt.Sprintf("Set confirm=true to drop every table starting with '%s'", prefix),
+			})
+			return
+		}
+
+		hiddenPrefixes := helpers.GetHiddenTablePrefixes()
+		dropped, err := s.db.DropTablesWithPrefix(c.Request.Context(), prefix, func(name string) bool {
+			return isHiddenTable(name, hiddenPrefixes)
+		})
+		if err != nil {
+			log.Error("Error dropping tables", slog.String("prefix", prefix), slog.Any("error", err))
+			c.JSON(http.StatusInternalServerError, ErrorResponse{
+				Status:  "error",
+				Message: "Failed to drop tables: " + err.Error(),
+			})
+			return
+		}
+		if dropped == nil {
+			dropped = []string{}
+		}
+
+		log.Info("Tables dropped by prefix", slog.String("prefix", prefix), slog.Any("tables", dropped))
+		c.JSON(http.StatusOK, DropTablesResponse{Status: "success", Prefix: prefix, Dropped: dropped})
+	}
+}
+
+// handleTableHeadRows godoc
+//
+//	@Summary		First table rows
+//	@Description	Get the first rows of a table in insertion order, for a quick look at its data
+//	@Tags			tables
+//	@Produce		json
+//	@Param			name	path		string					true	"Table name"
+//	@Param			rows	query		int						false	"Number of rows (default 100, max 10000)"
+//	@Success		200		{object}	api.TableRowsResponse	"First rows"
+//	@Failure		400		{object}	api.ErrorResponse		"Invalid rows"
+//	@Failure		404		{object}	api.ErrorResponse		"Table not found"
+//	@Failure		409		{object}	api.AmbiguousTableResponse	"Table name matches several tables ignoring case, error code: AMBIGUOUS_TABLE_NAME"
+//	@Failure		500		{object}	api.ErrorResponse		"Internal server error"
+//	@Router			/tables/{name}/head [get]
+func (s *Server) handleTableHeadRows() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rows, err := parseSampleRows(c.Query("rows"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Status:  "error",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		tableName, ok := s.resolveTableParam(c)
+		if !ok {
+			return // Error response already sent
+		}
+		if !s.requireTable(c, tableName) {
+			return // Error response already sent
+		}
+
+		query := fmt.Sprintf("SELECT * FROM %s LIMIT %d",
+			database.QualifiedTableName(database.DefaultSchema, tableName), rows)
+		s.sendTableRows(c, tableName, "", query)
+	}
+}
+
+// handleTableTailRows godoc
+//
+//	@Summary		Last table rows
+//	@Description	Get the last rows of a table, e.g. to check that the end of a large import landed. Rows are returned from the last one, by descending rowid or by the descending values of order_by, which views require.
+//	@Tags			tables
+//	@Produce		json
+//	@Param			name		path		string					true	"Table name"
+//	@Param			rows		query		int						false	"Number of rows (default 100, max 10000)"
+//	@Param			order_by	query		string					false	"Column ordering the rows, default rowid"
+//	@Success		200			{object}	api.TableRowsResponse	"Last rows"
+//	@Failure		400			{object}	api.ErrorResponse		"Invalid rows, unknown order_by column or view without order_by"
+//	@Failure		404			{object}	api.ErrorResponse		"Table not found"
+//	@Failure		409			{object}	api.AmbiguousTableResponse	"Table name matches several tables ignoring case, error code: AMBIGUOUS_TABLE_NAME"
+//	@Failure		500			{object}	api.ErrorResponse		"Internal server error"
+//	@Router			/tables/{name}/tail [get]
+func (s *Server) handleTableTailRows() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rows, err := parseSampleRows(c.Query("rows"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Status:  "error",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		tableName, ok := s.resolveTableParam(c)
+		if !ok {
+			return // Error response already sent
+		}
+		columns, ok := s.lookupTableColumns(c, tableName)
+		if !ok {
+			return // Error response already sent
+		}
+
+		orderBy := c.Query("order_by")
+		orderExpr := "rowid"
+		if orderBy != "" {
+			if !slices.Contains(columns, orderBy) {
+				c.JSON(http.StatusBadRequest, ErrorResponse{
+					Status:  "error",
+					Message: fmt.Sprintf("Column '%s' not found in table '%s'", orderBy, tableName),
+				})
+				return
+			}
+			orderExpr = database.QuoteIdentifier(orderBy)
+		} else {
+			isView, err := s.isView(c.Request.Context(), tableName)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, ErrorResponse{
+					Status:  "error",
+					Message: "Failed to check table type: " + err.Error(),
+				})
+				return
+			}
+			// Only tables have a rowid to order by
+			if isView {
+				c.JSON(http.StatusBadRequest, ErrorResponse{
+					Status:  "error",
+					Message: fmt.Sprintf("'%s' is a view, set order_by to a column ordering its rows", tableName),
+				})
+				return
+			}
+			orderBy = "rowid"
+		}
+
+		query := fmt.Sprintf("SELECT * FROM %s ORDER BY %s DESC NULLS LAST LIMIT %d",
+			database.QualifiedTableName(database.DefaultSchema, tableName), orderExpr, rows)
+		s.sendTableRows(c, tableName, orderBy, query)
+	}
+}
+
+// isView reports whether the table of the default schema is a view
+func (s *Server) isView(ctx context.Context, tableName string) (bool, error) {
+	result, err := s.db.ExecuteQuery(ctx, fmt.Sprintf(
+		"SELECT COUNT(*) AS view_count FROM information_schema.tables WHERE table_schema = '%s' AND table_name = '%s' AND table_type = 'VIEW'",
+		database.DefaultSchema, tableName))
+	if err != nil {
+		return false, err
+	}
+	count, _ := result.Results[0]["view_count"].(int64)
+	return count > 0, nil
+}
+
+// sendTableRows runs a query over the rows of a table and sends them as a
+// TableRowsResponse
+func (s *Server) sendTableRows(c *gin.Context, tableName, orderBy, query string) {
+	result, err := s.db.ExecuteQuery(c.Request.Context(), query)
+	if err != nil {
+		getLoggerFromGinContext(c).Error("Error reading table rows", slog.Any("error", err))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Status:  "error",
+			Message: "Failed to read table rows: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, TableRowsResponse{
+		Status:   "success",
+		Table:    tableName,
+		OrderBy:  orderBy,
+		RowCount: len(result.Results),
+		Results:  result.Results,
+	})
+}
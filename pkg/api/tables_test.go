@@ -0,0 +1,739 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/aliengiraffe/spotdb/pkg/database"
+	"github.com/aliengiraffe/spotdb/pkg/helpers"
+)
+
+// newTablesTestServer creates a server backed by a fresh database with a seeded table
+func newTablesTestServer(t *testing.T) (*Server, *database.DuckDB) {
+	t.Helper()
+
+	tempDir := t.TempDir()
+	oldTempDir := os.TempDir()
+	if err := os.Setenv("TMPDIR", tempDir); err != nil {
+		t.Fatalf("Failed to set TMPDIR: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := os.Setenv("TMPDIR", oldTempDir); err != nil {
+			t.Logf("Failed to restore TMPDIR: %v", err)
+		}
+	})
+
+	db, err := database.NewDuckDB(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	t.Cleanup(func() { helpers.CloseResources(db, "database connection") })
+
+	ctx := context.Background()
+	if _, err := db.ExecuteQuery(ctx, "CREATE TABLE sales (id INTEGER, region TEXT, amount INTEGER)"); err != nil {
+		t.Fatalf("Failed to create test table: %v", err)
+	}
+	if _, err := db.ExecuteQuery(ctx, "INSERT INTO sales VALUES (1, 'north', 10), (2, 'south', 20), (3, 'north', 30)"); err != nil {
+		t.Fatalf("Failed to insert test data: %v", err)
+	}
+
+	log := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	s := &Server{db: db}
+	s.setupRouter(log)
+
+	return s, db
+}
+
+// serveJSON sends a JSON request through the server router
+func serveJSON(s *Server, method, url string, body any) *httptest.ResponseRecorder {
+	requestJSON, _ := json.Marshal(body)
+	req := httptest.NewRequest(method, url, bytes.NewBuffer(requestJSON))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	s.Router().ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHandleCreateTable(t *testing.T) {
+	s, _ := newTablesTestServer(t)
+
+	tests := []struct {
+		name           string
+		body           map[string]any
+		expectedStatus int
+		expectedRows   int64
+	}{
+		{
+			name:           "creates table from select",
+			body:           map[string]any{"table_name": "north_sales", "query": "SELECT * FROM sales WHERE region = 'north'"},
+			expectedStatus: http.StatusOK,
+			expectedRows:   2,
+		},
+		{
+			name:           "duplicate table without override",
+			body:           map[string]any{"table_name": "north_sales", "query": "SELECT * FROM sales"},
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "duplicate table with override",
+			body:           map[string]any{"table_name": "north_sales", "query": "SELECT * FROM sales", "override": true},
+			expectedStatus: http.StatusOK,
+			expectedRows:   3,
+		},
+		{
+			name:           "non select query rejected",
+			body:           map[string]any{"table_name": "dropped", "query": "DELETE FROM sales"},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "multiple statements rejected",
+			body:           map[string]any{"table_name": "multi", "query": "SELECT 1; SELECT 2"},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "missing query",
+			body:           map[string]any{"table_name": "missing"},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "suspicious query rejected",
+			body:           map[string]any{"table_name": "injected", "query": "SELECT * FROM sales WHERE id = 1 OR 1=1"},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "comment only query rejected",
+			body:           map[string]any{"table_name": "empty", "query": "-- nothing"},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := serveJSON(s, http.MethodPost, "/api/v1/tables", tc.body)
+			if rec.Code != tc.expectedStatus {
+				t.Fatalf("Expected status %d, got %d, body: %s", tc.expectedStatus, rec.Code, rec.Body.String())
+			}
+
+			if tc.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var response CreateTableResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			if response.RowCount != tc.expectedRows {
+				t.Errorf("Expected %d rows, got %d", tc.expectedRows, response.RowCount)
+			}
+			if len(response.Columns) != 3 {
+				t.Errorf("Expected 3 columns, got %d", len(response.Columns))
+			}
+		})
+	}
+}
+
+func TestHandleCreateTable_SanitizesName(t *testing.T) {
+	s, _ := newTablesTestServer(t)
+
+	rec := serveJSON(s, http.MethodPost, "/api/v1/tables", map[string]any{
+		"table_name": "north sales; DROP",
+		"query":      "SELECT id FROM sales",
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d, body: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+
+	var response CreateTableResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if response.Table != "north_sales__DROP" {
+		t.Errorf("Expected sanitized table name, got %s", response.Table)
+	}
+}
+
+func TestHandleTableDDL(t *testing.T) {
+	s, _ := newTablesTestServer(t)
+
+	t.Run("returns the CREATE TABLE statement", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/tables/sales/ddl", nil)
+		rec := httptest.NewRecorder()
+		s.Router().ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d, body: %s", http.StatusOK, rec.Code, rec.Body.String())
+		}
+
+		var response TableDDLResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to parse response: %v", err)
+		}
+		if response.Table != "sales" {
+			t.Errorf("Expected table sales, got %s", response.Table)
+		}
+		if !strings.HasPrefix(response.DDL, "CREATE TABLE sales(") || !strings.Contains(response.DDL, "region VARCHAR") {
+			t.Errorf("Unexpected DDL: %s", response.DDL)
+		}
+	})
+
+	t.Run("unknown table", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/tables/missing/ddl", nil)
+		rec := httptest.NewRecorder()
+		s.Router().ServeHTTP(rec, req)
+		if rec.Code != http.StatusNotFound {
+			t.Fatalf("Expected status %d, got %d, body: %s", http.StatusNotFound, rec.Code, rec.Body.String())
+		}
+	})
+}
+
+func TestHandleTableHead(t *testing.T) {
+	s, _ := newTablesTestServer(t)
+
+	t.Run("existing table", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodHead, "/api/v1/tables/sales", nil)
+		rec := httptest.NewRecorder()
+		s.Router().ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+		}
+		if rowCount := rec.Header().Get(tableRowCountHeader); rowCount != "3" {
+			t.Errorf("Expected row count header 3, got %q", rowCount)
+		}
+	})
+
+	t.Run("unknown table", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodHead, "/api/v1/tables/missing", nil)
+		rec := httptest.NewRecorder()
+		s.Router().ServeHTTP(rec, req)
+		if rec.Code != http.StatusNotFound {
+			t.Fatalf("Expected status %d, got %d", http.StatusNotFound, rec.Code)
+		}
+		if rowCount := rec.Header().Get(tableRowCountHeader); rowCount != "" {
+			t.Errorf("Expected no row count header, got %q", rowCount)
+		}
+	})
+}
+
+func TestHandleTableSample(t *testing.T) {
+	s, _ := newTablesTestServer(t)
+
+	tests := []struct {
+		name           string
+		url            string
+		expectedStatus int
+		expectedSample string
+		expectedRows   int
+	}{
+		{
+			name:           "default sample",
+			url:            "/api/v1/tables/sales/sample",
+			expectedStatus: http.StatusOK,
+			expectedSample: "reservoir(100 ROWS)",
+			expectedRows:   3,
+		},
+		{
+			name:           "random percentage",
+			url:            "/api/v1/tables/sales/sample?method=random&percent=100",
+			expectedStatus: http.StatusOK,
+			expectedSample: "bernoulli(100 PERCENT)",
+			expectedRows:   3,
+		},
+		{
+			name:           "row count",
+			url:            "/api/v1/tables/sales/sample?rows=2",
+			expectedStatus: http.StatusOK,
+			expectedSample: "reservoir(2 ROWS)",
+			expectedRows:   2,
+		},
+		{
+			name:           "invalid percent",
+			url:            "/api/v1/tables/sales/sample?percent=150",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid method",
+			url:            "/api/v1/tables/sales/sample?method=first&percent=1",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "unknown table",
+			url:            "/api/v1/tables/missing/sample?percent=1",
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.url, nil)
+			rec := httptest.NewRecorder()
+			s.Router().ServeHTTP(rec, req)
+
+			if rec.Code != tc.expectedStatus {
+				t.Fatalf("Expected status %d, got %d, body: %s", tc.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if tc.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var response TableSampleResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			if response.Sample != tc.expectedSample {
+				t.Errorf("Expected sample %s, got %s", tc.expectedSample, response.Sample)
+			}
+			if response.RowCount != tc.expectedRows || len(response.Results) != tc.expectedRows {
+				t.Errorf("Expected %d rows, got %d", tc.expectedRows, len(response.Results))
+			}
+		})
+	}
+}
+
+func TestParseTableSample(t *testing.T) {
+	tests := []struct {
+		method   string
+		percent  string
+		rows     string
+		expected tableSample
+		wantErr  bool
+	}{
+		{expected: tableSample{Method: "reservoir", Rows: DefaultSampleRows}},
+		{percent: "1", expected: tableSample{Method: "system", Percent: 1}},
+		{method: "random", percent: "0.5", expected: tableSample{Method: "bernoulli", Percent: 0.5}},
+		{method: "reservoir", percent: "10", expected: tableSample{Method: "reservoir", Percent: 10}},
+		{rows: "999999", expected: tableSample{Method: "reservoir", Rows: MaxSampleRows}},
+		{percent: "0", wantErr: true},
+		{percent: "NaN", wantErr: true},
+		{rows: "-1", wantErr: true},
+		{percent: "1", rows: "10", wantErr: true},
+		{method: "system", rows: "10", wantErr: true},
+		{method: "first", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		sample, err := parseTableSample(tc.method, tc.percent, tc.rows)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("Expected error for method %q, percent %q, rows %q", tc.method, tc.percent, tc.rows)
+			}
+			continue
+		}
+		if err != nil || sample != tc.expected {
+			t.Errorf("Expected %+v for method %q, percent %q, rows %q, got %+v (err: %v)", tc.expected, tc.method, tc.percent, tc.rows, sample, err)
+		}
+	}
+}
+
+func TestHandleDistinctValues(t *testing.T) {
+	s, _ := newTablesTestServer(t)
+
+	tests := []struct {
+		name              string
+		url               string
+		expectedStatus    int
+		expectedValues    []any
+		expectedTruncated bool
+	}{
+		{
+			name:           "distinct values sorted",
+			url:            "/api/v1/tables/sales/columns/region/distinct",
+			expectedStatus: http.StatusOK,
+			expectedValues: []any{"north", "south"},
+		},
+		{
+			name:              "limit truncates values",
+			url:               "/api/v1/tables/sales/columns/region/distinct?limit=1",
+			expectedStatus:    http.StatusOK,
+			expectedValues:    []any{"north"},
+			expectedTruncated: true,
+		},
+		{
+			name:           "unknown table",
+			url:            "/api/v1/tables/missing/columns/region/distinct",
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "unknown column",
+			url:            "/api/v1/tables/sales/columns/country/distinct",
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "invalid limit",
+			url:            "/api/v1/tables/sales/columns/region/distinct?limit=-5",
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.url, nil)
+			rec := httptest.NewRecorder()
+			s.Router().ServeHTTP(rec, req)
+
+			if rec.Code != tc.expectedStatus {
+				t.Fatalf("Expected status %d, got %d, body: %s", tc.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if tc.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var response DistinctValuesResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			if !reflect.DeepEqual(response.Values, tc.expectedValues) {
+				t.Errorf("Expected values %v, got %v", tc.expectedValues, response.Values)
+			}
+			if response.Truncated != tc.expectedTruncated {
+				t.Errorf("Expected truncated %v, got %v", tc.expectedTruncated, response.Truncated)
+			}
+		})
+	}
+}
+
+func TestParseDistinctLimit(t *testing.T) {
+	tests := []struct {
+		param    string
+		expected int
+		wantErr  bool
+	}{
+		{param: "", expected: DefaultDistinctLimit},
+		{param: "10", expected: 10},
+		{param: "999999", expected: MaxDistinctLimit},
+		{param: "0", wantErr: true},
+		{param: "abc", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		limit, err := parseDistinctLimit(tc.param)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("Expected error for limit %q", tc.param)
+			}
+			continue
+		}
+		if err != nil || limit != tc.expected {
+			t.Errorf("Expected limit %d for %q, got %d (err: %v)", tc.expected, tc.param, limit, err)
+		}
+	}
+}
+
+func TestHandleRefineTypes(t *testing.T) {
+	s, db := newTablesTestServer(t)
+	ctx := context.Background()
+
+	if _, err := db.ExecuteQuery(ctx, "CREATE TABLE loose AS SELECT * FROM (VALUES ('1', '2024-01-02', 'a'), ('2', '2024-01-03', NULL), ('x', '2024-01-04', 'c')) AS t(code, shipped, label)"); err != nil {
+		t.Fatalf("Failed to create test table: %v", err)
+	}
+
+	refine := func(t *testing.T, body any) RefineTypesResponse {
+		t.Helper()
+		rec := serveJSON(s, http.MethodPost, "/api/v1/tables/loose/refine_types", body)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+		}
+		var response RefineTypesResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to parse response: %v", err)
+		}
+		return response
+	}
+
+	proposed := refine(t, map[string]any{})
+	if proposed.Applied || len(proposed.Columns) != 3 {
+		t.Fatalf("Expected proposals for 3 columns, got %+v", proposed)
+	}
+	code, shipped := proposed.Columns[0], proposed.Columns[1]
+	if code.ProposedType != "" || code.Failures["INTEGER"] != 1 || code.Failures["DOUBLE"] != 1 {
+		t.Errorf("Expected no type for code with one failing value, got %+v", code)
+	}
+	if shipped.ProposedType != "DATE" || shipped.NonNullValues != 3 {
+		t.Errorf("Expected DATE for shipped, got %+v", shipped)
+	}
+
+	sampled := refine(t, map[string]any{"sample_size": 2})
+	if sampled.SampleSize != 2 || sampled.Columns[1].NonNullValues != 2 {
+		t.Errorf("Expected 2 sampled rows to be analyzed, got %+v", sampled)
+	}
+
+	applied := refine(t, map[string]any{"apply": true})
+	if !applied.Applied || !applied.Columns[1].Applied || applied.Columns[0].Applied {
+		t.Errorf("Expected only shipped to be altered, got %+v", applied)
+	}
+	result, err := db.ExecuteQuery(ctx, "SELECT data_type FROM information_schema.columns WHERE table_name = 'loose' AND column_name = 'shipped'")
+	if err != nil || result.Results[0]["data_type"] != "DATE" {
+		t.Errorf("Expected shipped to be a DATE column, got %v, %v", result, err)
+	}
+
+	if rec := serveJSON(s, http.MethodPost, "/api/v1/tables/missing/refine_types", map[string]any{}); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for a missing table, got %d", http.StatusNotFound, rec.Code)
+	}
+	if rec := serveJSON(s, http.MethodPost, "/api/v1/tables/loose/refine_types", map[string]any{"sample_size": -1}); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for a negative sample size, got %d", http.StatusBadRequest, rec.Code)
+	}
+}
+
+func TestHandleRowFilter(t *testing.T) {
+	s, db := newTablesTestServer(t)
+
+	tests := []struct {
+		name           string
+		url            string
+		body           RowFilterRequest
+		expectedStatus int
+		expectedCode   string
+	}{
+		{name: "sets filter", url: "/api/v1/tables/sales/row_filter", body: RowFilterRequest{Predicate: "region = {tenant}"}, expectedStatus: http.StatusOK},
+		{name: "unknown column", url: "/api/v1/tables/sales/row_filter", body: RowFilterRequest{Predicate: "tenant_id = {tenant}"}, expectedStatus: http.StatusBadRequest, expectedCode: "INVALID_ROW_FILTER"},
+		{name: "several statements", url: "/api/v1/tables/sales/row_filter", body: RowFilterRequest{Predicate: "true; DROP TABLE sales"}, expectedStatus: http.StatusBadRequest, expectedCode: "INVALID_ROW_FILTER"},
+		{name: "missing predicate", url: "/api/v1/tables/sales/row_filter", expectedStatus: http.StatusBadRequest},
+		{name: "missing table", url: "/api/v1/tables/missing/row_filter", body: RowFilterRequest{Predicate: "true"}, expectedStatus: http.StatusNotFound},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := serveJSON(s, http.MethodPut, tc.url, tc.body)
+			if rec.Code != tc.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tc.expectedStatus, rec.Code, rec.Body.String())
+			}
+			var body ErrorResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("Failed to parse response body: %v", err)
+			}
+			if body.Code != tc.expectedCode {
+				t.Errorf("Expected code %q, got %q", tc.expectedCode, body.Code)
+			}
+		})
+	}
+
+	filters, err := db.RowFilters(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to read row filters: %v", err)
+	}
+	if filters["sales"].Predicate != "region = {tenant}" {
+		t.Errorf("Expected the valid predicate to be kept, got %+v", filters)
+	}
+
+	if rec := serveJSON(s, http.MethodDelete, "/api/v1/tables/sales/row_filter", nil); rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 removing the filter, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := serveJSON(s, http.MethodDelete, "/api/v1/tables/sales/row_filter", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 removing a missing filter, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestHandleCreateTableQuotedName(t *testing.T) {
+	t.Setenv("ENV_TABLE_NAME_SANITIZATION", "quoted")
+	s, _ := newTablesTestServer(t)
+
+	rec := serveJSON(s, http.MethodPost, "/api/v1/tables", map[string]any{"table_name": "north sales-2024", "query": "SELECT * FROM sales WHERE region = 'north'"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = serveJSON(s, http.MethodPost, "/api/v1/query", map[string]any{"query": `SELECT COUNT(*) AS total FROM "north sales-2024"`})
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"total":2`) {
+		t.Errorf("Expected the table to keep its name, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := serveJSON(s, http.MethodGet, "/api/v1/tables/north%20sales-2024/head", nil); rec.Code != http.StatusOK {
+		t.Errorf("Expected the table to be found by its name, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = serveJSON(s, http.MethodPost, "/api/v1/tables", map[string]any{"table_name": "main.sales_copy", "query": "SELECT * FROM sales"})
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "INVALID_TABLE_NAME") {
+		t.Errorf("Expected INVALID_TABLE_NAME for a dotted name, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestHandleDropTablesByPrefix(t *testing.T) {
+	t.Setenv("ENV_BULK_DELETE_RATE_LIMIT", "0")
+	s, db := newTablesTestServer(t)
+	ctx := context.Background()
+
+	for _, query := range []string{
+		"CREATE TABLE test_a (id INTEGER)",
+		"CREATE TABLE test_b (id INTEGER)",
+		"CREATE TABLE _spotdb_test (id INTEGER)",
+	} {
+		if _, err := db.ExecuteQuery(ctx, query); err != nil {
+			t.Fatalf("Failed to run %q: %v", query, err)
+		}
+	}
+
+	tests := []struct {
+		name           string
+		url            string
+		expectedStatus int
+		expectedCode   string
+		expectedTables []string
+	}{
+		{name: "missing prefix", url: "/api/v1/tables?confirm=true", expectedStatus: http.StatusBadRequest, expectedCode: "INVALID_PREFIX"},
+		{name: "missing confirmation", url: "/api/v1/tables?prefix=test_", expectedStatus: http.StatusBadRequest, expectedCode: "CONFIRMATION_REQUIRED"},
+		{name: "drops matching tables", url: "/api/v1/tables?prefix=test_&confirm=true", expectedStatus: http.StatusOK, expectedTables: []string{"test_a", "test_b"}},
+		{name: "prefix with special characters", url: "/api/v1/tables?prefix=test-&confirm=true", expectedStatus: http.StatusBadRequest, expectedCode: "INVALID_PREFIX"},
+		{name: "wildcard prefix", url: "/api/v1/tables?prefix=%2A&confirm=true", expectedStatus: http.StatusBadRequest, expectedCode: "INVALID_PREFIX"},
+		{name: "skips hidden tables", url: "/api/v1/tables?prefix=_spotdb&confirm=true", expectedStatus: http.StatusOK, expectedTables: []string{}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := serveJSON(s, http.MethodDelete, tc.url, nil)
+			if rec.Code != tc.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tc.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if tc.expectedStatus != http.StatusOK {
+				var body ErrorResponse
+				if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+					t.Fatalf("Failed to parse response body: %v", err)
+				}
+				if body.Code != tc.expectedCode {
+					t.Errorf("Expected code %q, got %q", tc.expectedCode, body.Code)
+				}
+				return
+			}
+			var body DropTablesResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("Failed to parse response body: %v", err)
+			}
+			if !slices.Equal(body.Dropped, tc.expectedTables) {
+				t.Errorf("Expected dropped tables %v, got %v", tc.expectedTables, body.Dropped)
+			}
+		})
+	}
+
+	result, err := db.ExecuteQuery(ctx, "SELECT COUNT(*) AS total FROM information_schema.tables WHERE table_name IN ('sales', '_spotdb_test')")
+	if err != nil {
+		t.Fatalf("Failed to count tables: %v", err)
+	}
+	if total := fmt.Sprint(result.Results[0]["total"]); total != "2" {
+		t.Errorf("Expected sales and the hidden table to remain, got %s", total)
+	}
+}
+
+func TestHandleDropTablesByPrefixRateLimit(t *testing.T) {
+	t.Setenv("ENV_BULK_DELETE_RATE_LIMIT", "1")
+	s, _ := newTablesTestServer(t)
+
+	if rec := serveJSON(s, http.MethodDelete, "/api/v1/tables?prefix=test_&confirm=true", nil); rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := serveJSON(s, http.MethodDelete, "/api/v1/tables?prefix=test_&confirm=true", nil); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected status 429 past the limit, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestHandleTableHeadAndTailRows(t *testing.T) {
+	s, db := newTablesTestServer(t)
+	if _, err := db.ExecuteQuery(context.Background(), "CREATE VIEW sales_view AS SELECT * FROM sales"); err != nil {
+		t.Fatalf("Failed to create view: %v", err)
+	}
+
+	tests := []struct {
+		name            string
+		url             string
+		expectedStatus  int
+		expectedOrderBy string
+		expectedIDs     []int32
+	}{
+		{name: "head", url: "/api/v1/tables/sales/head", expectedStatus: http.StatusOK, expectedIDs: []int32{1, 2, 3}},
+		{name: "head rows", url: "/api/v1/tables/sales/head?rows=2", expectedStatus: http.StatusOK, expectedIDs: []int32{1, 2}},
+		{name: "tail", url: "/api/v1/tables/sales/tail?rows=2", expectedStatus: http.StatusOK, expectedOrderBy: "rowid", expectedIDs: []int32{3, 2}},
+		{name: "tail by column", url: "/api/v1/tables/sales/tail?rows=1&order_by=region", expectedStatus: http.StatusOK, expectedOrderBy: "region", expectedIDs: []int32{2}},
+		{name: "view tail by column", url: "/api/v1/tables/sales_view/tail?order_by=amount", expectedStatus: http.StatusOK, expectedOrderBy: "amount", expectedIDs: []int32{3, 2, 1}},
+		{name: "view tail without order", url: "/api/v1/tables/sales_view/tail", expectedStatus: http.StatusBadRequest},
+		{name: "unknown order column", url: "/api/v1/tables/sales/tail?order_by=amount%22%20--", expectedStatus: http.StatusBadRequest},
+		{name: "invalid rows", url: "/api/v1/tables/sales/head?rows=0", expectedStatus: http.StatusBadRequest},
+		{name: "unknown table head", url: "/api/v1/tables/missing/head", expectedStatus: http.StatusNotFound},
+		{name: "unknown table tail", url: "/api/v1/tables/missing/tail", expectedStatus: http.StatusNotFound},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := serveJSON(s, http.MethodGet, tc.url, nil)
+			if rec.Code != tc.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tc.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if tc.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var response struct {
+				TableRowsResponse
+				Results []struct {
+					ID int32 `json:"id"`
+				} `json:"results"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			if response.OrderBy != tc.expectedOrderBy {
+				t.Errorf("Expected order_by %q, got %q", tc.expectedOrderBy, response.OrderBy)
+			}
+			ids := make([]int32, len(response.Results))
+			for i, row := range response.Results {
+				ids[i] = row.ID
+			}
+			if !slices.Equal(ids, tc.expectedIDs) || response.RowCount != len(tc.expectedIDs) {
+				t.Errorf("Expected ids %v, got %v (row_count %d)", tc.expectedIDs, ids, response.RowCount)
+			}
+		})
+	}
+}
+
+func TestCaseInsensitiveTableLookup(t *testing.T) {
+	s, db := newTablesTestServer(t)
+	if _, err := db.ExecuteQuery(context.Background(), `CREATE TABLE "Orders" (id INTEGER)`); err != nil {
+		t.Fatalf("Failed to create test table: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		enabled        bool
+		method         string
+		url            string
+		expectedStatus int
+		expectedTable  string
+	}{
+		{"ddl exact name", false, http.MethodGet, "/api/v1/tables/Orders/ddl", http.StatusOK, "Orders"},
+		{"ddl other case disabled", false, http.MethodGet, "/api/v1/tables/orders/ddl", http.StatusNotFound, ""},
+		{"ddl other case enabled", true, http.MethodGet, "/api/v1/tables/orders/ddl", http.StatusOK, "Orders"},
+		{"ddl unknown table enabled", true, http.MethodGet, "/api/v1/tables/missing/ddl", http.StatusNotFound, ""},
+		{"sample other case enabled", true, http.MethodGet, "/api/v1/tables/ORDERS/sample?rows=1", http.StatusOK, "Orders"},
+		{"head other case enabled", true, http.MethodHead, "/api/v1/tables/orders", http.StatusOK, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.enabled {
+				t.Setenv("ENV_CASE_INSENSITIVE_TABLES", "true")
+			}
+
+			rec := serveJSON(s, tt.method, tt.url, nil)
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if tt.expectedTable == "" {
+				return
+			}
+
+			var response struct {
+				Table string `json:"table"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.Table != tt.expectedTable {
+				t.Errorf("Expected table %q, got %q", tt.expectedTable, response.Table)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"context"
+	"time"
+)
+
+// uploadPhase identifies a phase of an upload reported in UploadTimings
+type uploadPhase int
+
+const (
+	phaseFileValidation uploadPhase = iota
+	phaseEncodingValidation
+	phaseCopy
+	phaseImport
+	phaseAnalyze
+	phaseChecksum
+	phasePostImportQuery
+)
+
+// uploadTimingsKey is the context key of the UploadTimings being recorded for a request
+type uploadTimingsKey struct{}
+
+// withUploadTimings returns a context in which the phases of an upload are recorded to timings
+func withUploadTimings(ctx context.Context, timings *UploadTimings) context.Context {
+	return context.WithValue(ctx, uploadTimingsKey{}, timings)
+}
+
+// recordUploadPhase adds the time elapsed since start to a phase of the upload timings
+// in ctx, doing nothing when the request does not record timings (e.g. previews)
+func recordUploadPhase(ctx context.Context, phase uploadPhase, start time.Time) {
+	timings, ok := ctx.Value(uploadTimingsKey{}).(*UploadTimings)
+	if !ok || timings == nil {
+		return
+	}
+
+	elapsed := durationMs(time.Since(start))
+	switch phase {
+	case phaseFileValidation:
+		timings.FileValidationMs += elapsed
+	case phaseEncodingValidation:
+		timings.EncodingValidationMs += elapsed
+	case phaseCopy:
+		timings.CopyMs += elapsed
+	case phaseImport:
+		timings.ImportMs += elapsed
+	case phaseAnalyze:
+		timings.AnalyzeMs += elapsed
+	case phaseChecksum:
+		timings.ChecksumMs += elapsed
+	case phasePostImportQuery:
+		timings.PostImportQueryMs += elapsed
+	}
+}
+
+// durationMs converts a duration to fractional milliseconds
+func durationMs(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
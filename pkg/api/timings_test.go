@@ -0,0 +1,30 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRecordUploadPhase(t *testing.T) {
+	var timings UploadTimings
+	ctx := withUploadTimings(context.Background(), &timings)
+
+	start := time.Now().Add(-2 * time.Millisecond)
+	recordUploadPhase(ctx, phaseCopy, start)
+	recordUploadPhase(ctx, phaseCopy, start)
+	recordUploadPhase(ctx, phaseImport, start)
+
+	if timings.CopyMs < 4 {
+		t.Errorf("expected copy phases to accumulate to at least 4ms, got %v", timings.CopyMs)
+	}
+	if timings.ImportMs < 2 || timings.ImportMs >= timings.CopyMs {
+		t.Errorf("expected import to take about 2ms, got %v", timings.ImportMs)
+	}
+	if timings.FileValidationMs != 0 || timings.EncodingValidationMs != 0 {
+		t.Errorf("expected unrecorded phases to stay zero, got %+v", timings)
+	}
+
+	// Requests that do not record timings, such as previews, are ignored
+	recordUploadPhase(context.Background(), phaseCopy, start)
+}
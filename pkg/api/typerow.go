@@ -0,0 +1,99 @@
+package api
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/aliengiraffe/spotdb/pkg/database"
+	"github.com/aliengiraffe/spotdb/pkg/helpers"
+)
+
+// readTypeRow reads the header and the type row that follows it from the copied CSV file,
+// after the first skipRows lines, and returns the declared column types. The returned
+// error describes the first missing column name or unrecognized type token.
+func readTypeRow(csvPath string, skipRows int) ([]database.ColumnType, *CSVError) {
+	headerLine := skipRows + 1
+	typeLine := skipRows + 2
+
+	file, err := os.Open(csvPath)
+	if err != nil {
+		return nil, typeRowError(0, "", "", fmt.Sprintf("Failed to read type row: %v", err))
+	}
+	defer helpers.CloseResources(file, "type row file")
+
+	reader := bufio.NewReaderSize(file, helpers.GetBufferSize())
+	if _, err := copyLeadingRows(io.Discard, reader, skipRows, math.MaxInt64); err != nil {
+		return nil, typeRowError(0, "", "", fmt.Sprintf("Failed to read type row: %v", err))
+	}
+
+	data := make([]byte, MaxSampleSize)
+	n, err := io.ReadFull(reader, data)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, typeRowError(0, "", "", fmt.Sprintf("Failed to read type row: %v", err))
+	}
+
+	delimiter, err := DetectDelimiterFromData(data[:n])
+	if err != nil {
+		return nil, typeRowError(headerLine, "", "", "File has no header row")
+	}
+
+	records, err := sampleCSVRecordsFromData(data[:n], delimiter, 2, true)
+	if err != nil {
+		return nil, typeRowError(typeLine, "", "", fmt.Sprintf("Failed to parse type row: %v", err))
+	}
+	if len(records) < 2 {
+		return nil, typeRowError(typeLine, "", "", "File has no type row after the header")
+	}
+
+	header, hints := records[0], records[1]
+	columns := make([]database.ColumnType, len(header))
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return nil, typeRowError(headerLine, fmt.Sprintf("Column %d", i+1), "",
+				fmt.Sprintf("Header column %d has no name", i+1))
+		}
+
+		duckType, ok := database.TypeFromHint(hints[i])
+		if !ok {
+			return nil, typeRowError(typeLine, name, hints[i],
+				fmt.Sprintf("Unknown type '%s' for column '%s' in type row", hints[i], name))
+		}
+		columns[i] = database.ColumnType{Name: name, Type: duckType}
+	}
+
+	return columns, nil
+}
+
+// validateTypeRowOptions checks that type_row is combined with a header and is not
+// combined with all_varchar, whose types it would contradict
+func validateTypeRowOptions(typeRow, hasHeader, allVarchar bool) *CSVError {
+	switch {
+	case !typeRow:
+		return nil
+	case !hasHeader:
+		return typeRowError(0, "", "", "type_row requires has_header")
+	case allVarchar:
+		return typeRowError(0, "", "", "type_row cannot be combined with all_varchar")
+	default:
+		return nil
+	}
+}
+
+// typeRowError builds the INVALID_TYPE_ROW error returned when a type row cannot be used
+func typeRowError(line int, column, value, message string) *CSVError {
+	return &CSVError{
+		Code:    "INVALID_TYPE_ROW",
+		Message: message,
+		Details: CSVErrorDetail{
+			Line:       line,
+			Column:     column,
+			FoundValue: value,
+			Suggestion: suggestionMap["INVALID_TYPE_ROW"],
+		},
+	}
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/aliengiraffe/spotdb/pkg/database"
+)
+
+func TestReadTypeRow(t *testing.T) {
+	tests := []struct {
+		name            string
+		content         string
+		skipRows        int
+		expectedColumns []database.ColumnType
+		expectedLine    int
+		expectedColumn  string
+	}{
+		{
+			name:    "types after header",
+			content: "id,city,joined\nint,string,date\n1,Paris,2024-01-31\n",
+			expectedColumns: []database.ColumnType{
+				{Name: "id", Type: "BIGINT"},
+				{Name: "city", Type: "VARCHAR"},
+				{Name: "joined", Type: "DATE"},
+			},
+		},
+		{
+			name:     "types after skipped banner with semicolons",
+			content:  "Survey export\nid;score\nInteger;Numeric\n1;2.5\n",
+			skipRows: 1,
+			expectedColumns: []database.ColumnType{
+				{Name: "id", Type: "BIGINT"},
+				{Name: "score", Type: "DOUBLE"},
+			},
+		},
+		{
+			name:           "unknown type token",
+			content:        "id,city\nint,geometry\n1,Paris\n",
+			expectedLine:   2,
+			expectedColumn: "city",
+		},
+		{
+			name:           "empty header name",
+			content:        "Survey export\nid,\nint,string\n",
+			skipRows:       1,
+			expectedLine:   2,
+			expectedColumn: "Column 2",
+		},
+		{
+			name:         "missing type row",
+			content:      "id,city\n",
+			expectedLine: 2,
+		},
+		{
+			name:         "type row with fewer columns",
+			content:      "id,city\nint\n1,Paris\n",
+			expectedLine: 2,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			csvPath := filepath.Join(t.TempDir(), "typed.csv")
+			if err := os.WriteFile(csvPath, []byte(tc.content), 0o600); err != nil {
+				t.Fatalf("failed to write CSV file: %v", err)
+			}
+
+			columns, csvErr := readTypeRow(csvPath, tc.skipRows)
+			if tc.expectedColumns != nil {
+				if csvErr != nil {
+					t.Fatalf("unexpected error: %s", csvErr.Message)
+				}
+				if !reflect.DeepEqual(columns, tc.expectedColumns) {
+					t.Errorf("expected columns %v, got %v", tc.expectedColumns, columns)
+				}
+				return
+			}
+
+			if csvErr == nil {
+				t.Fatalf("expected an error, got columns %v", columns)
+			}
+			if csvErr.Code != "INVALID_TYPE_ROW" {
+				t.Errorf("expected code INVALID_TYPE_ROW, got %s", csvErr.Code)
+			}
+			if csvErr.Details.Line != tc.expectedLine {
+				t.Errorf("expected line %d, got %d", tc.expectedLine, csvErr.Details.Line)
+			}
+			if csvErr.Details.Column != tc.expectedColumn {
+				t.Errorf("expected column %q, got %q", tc.expectedColumn, csvErr.Details.Column)
+			}
+		})
+	}
+}
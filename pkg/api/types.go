@@ -1,17 +1,71 @@
 package api
 
 import (
+	"encoding/json"
 	"mime/multipart"
+	"time"
+
+	applog "github.com/aliengiraffe/spotdb/pkg/log"
 )
 
 // CSVRequest represents a request to upload a CSV file
 type CSVRequest struct {
-	TableName    string                `form:"table_name" binding:"required"`
+	TableName    string                `form:"table_name"`
+	Schema       string                `form:"schema"`
 	CSVFile      *multipart.FileHeader `form:"csv_file" binding:"required" swaggerignore:"true"`
 	HasHeader    bool                  `form:"has_header" default:"false"`
 	Override     bool                  `form:"override" default:"false"`
 	Smart        bool                  `form:"smart" default:"true"`
 	FileEncoding string                `form:"csv_file_encoding" default:"utf-8"`
+	// DateFormat and TimestampFormat are strftime-style formats, e.g. %d/%m/%Y
+	DateFormat      string `form:"date_format"`
+	TimestampFormat string `form:"timestamp_format"`
+	// SkipRows is the number of lines before the header (or first row) to ignore
+	SkipRows int `form:"skip_rows" binding:"min=0"`
+	// TypeRow declares that the row after the header holds the column types
+	TypeRow bool `form:"type_row" default:"false"`
+	// AllVarchar reads every column as VARCHAR instead of auto-detecting types
+	AllVarchar bool `form:"all_varchar" default:"false"`
+	// FullValidation validates the structure of every row instead of a sample
+	FullValidation bool `form:"full_validation" default:"false"`
+	// FailOnWarning fails the upload when validation produces any warning
+	FailOnWarning bool `form:"fail_on_warning" default:"false"`
+	// Stream pipes the upload into DuckDB through a named pipe instead of a temporary file
+	Stream bool `form:"stream" default:"false"`
+	// Checksum returns an MD5 checksum of the imported rows to verify them against the source
+	Checksum bool `form:"checksum" default:"false"`
+	// PostImportQuery runs after a successful import, restricted to the imported table
+	PostImportQuery string `form:"post_import_query"`
+	// CollectAllErrors scans the whole file and reports every issue found instead of importing it
+	CollectAllErrors bool `form:"collect_all_errors" default:"false"`
+	// ForceEncoding reads the file in its detected encoding when it differs from FileEncoding
+	ForceEncoding bool `form:"force_encoding" default:"false"`
+	// TrimTrailingDelimiter drops a single empty field after the last column of each row
+	TrimTrailingDelimiter bool `form:"trim_trailing_delimiter" default:"false"`
+	// NullPadding imports rows with fewer columns than the header, missing values as NULL
+	NullPadding bool `form:"null_padding" default:"false"`
+	// Columns lists the imported columns to keep, in order, repeated or comma-separated
+	Columns []string `form:"columns"`
+	// RenameColumns maps imported column names to new names, sent as rename_columns[old]=new
+	RenameColumns map[string]string `form:"-"`
+	// Analyze runs ANALYZE on the new table when true and never when false, unset leaves it
+	// to ENV_AUTO_ANALYZE_THRESHOLD
+	Analyze *bool `form:"analyze"`
+}
+
+// CSVPreviewRequest represents a request to preview how a CSV file will be parsed
+type CSVPreviewRequest struct {
+	CSVFile         *multipart.FileHeader `form:"csv_file" binding:"required" swaggerignore:"true"`
+	HasHeader       bool                  `form:"has_header" default:"false"`
+	FileEncoding    string                `form:"csv_file_encoding" default:"utf-8"`
+	DateFormat      string                `form:"date_format"`
+	TimestampFormat string                `form:"timestamp_format"`
+	SkipRows        int                   `form:"skip_rows" binding:"min=0"`
+	TypeRow         bool                  `form:"type_row" default:"false"`
+	AllVarchar      bool                  `form:"all_varchar" default:"false"`
+	// TrimTrailingDelimiter and NullPadding tolerate ragged rows like on upload
+	TrimTrailingDelimiter bool `form:"trim_trailing_delimiter" default:"false"`
+	NullPadding           bool `form:"null_padding" default:"false"`
 }
 
 // QueryRequest represents a database query request
@@ -20,12 +74,62 @@ type QueryRequest struct {
 	Limit int    `json:"limit,omitempty"`
 }
 
+// QueryValidateRequest represents a request to validate a query without executing it
+type QueryValidateRequest struct {
+	Query string `json:"query" binding:"required"`
+}
+
+// QueryValidateResponse reports whether a query is valid, with the reason when it is not
+// and the errors of statements that parse but cannot be bound
+type QueryValidateResponse struct {
+	Status   string   `json:"status"`
+	Valid    bool     `json:"valid"`
+	Code     string   `json:"code,omitempty"`
+	Error    string   `json:"error,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// QueryCountResponse represents the response of a count_only query
+type QueryCountResponse struct {
+	Status     string `json:"status"`
+	RowCount   int64  `json:"row_count"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
 // ErrorResponse represents a standardized error response
 type ErrorResponse struct {
 	Status  string `json:"status"`
+	Code    string `json:"code,omitempty"`
 	Message string `json:"message"`
 }
 
+// ProblemDetails is an error response in the RFC 7807 format, sent instead of an
+// ErrorResponse or CSVErrorResponse to clients that accept application/problem+json
+type ProblemDetails struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	// Code is the error code of the usual error response
+	Code string `json:"code,omitempty"`
+	// Errors are the errors of a CSVErrorResponse
+	Errors []CSVError `json:"errors,omitempty"`
+}
+
+// ResponseEnvelope is the uniform shape of successful JSON responses when
+// ENV_WRAP_RESPONSES is true. Data is the usual response without its status member.
+type ResponseEnvelope struct {
+	Status string          `json:"status"`
+	Data   json.RawMessage `json:"data" swaggertype:"object"`
+	Meta   EnvelopeMeta    `json:"meta"`
+}
+
+// EnvelopeMeta describes the request a wrapped response answers
+type EnvelopeMeta struct {
+	RequestID string `json:"request_id"`
+}
+
 // CSVErrorDetail contains detailed information about a CSV error
 type CSVErrorDetail struct {
 	Line         int    `json:"line"`
@@ -47,6 +151,18 @@ type CSVErrorResponse struct {
 	Errors []CSVError `json:"errors"`
 }
 
+// CSVValidationReport represents the issues found by a collect_all_errors upload, which
+// scans the file without importing it
+type CSVValidationReport struct {
+	Status      string     `json:"status"`
+	Valid       bool       `json:"valid"`
+	RowsScanned int        `json:"rows_scanned"`
+	IssueCount  int        `json:"issue_count"`
+	Errors      []CSVError `json:"errors"`
+	// Truncated is set when more issues were found than the returned errors hold
+	Truncated bool `json:"truncated"`
+}
+
 // TableColumn represents a single column in a table schema
 type TableColumn struct {
 	Name     string `json:"name"`
@@ -67,16 +183,209 @@ type TablesResponse struct {
 
 // CSVUploadResponse represents the response for a successful CSV upload
 type CSVUploadResponse struct {
+	Schema   string                   `json:"schema"`
 	Table    string                   `json:"table"`
 	Columns  []map[string]interface{} `json:"columns"`
 	RowCount int64                    `json:"row_count"`
 	Import   map[string]interface{}   `json:"import"`
+	Timings  UploadTimings            `json:"timings"`
+	// Checksum is the MD5 checksum of the imported rows, only computed when requested
+	Checksum string `json:"checksum,omitempty"`
+	// PostImportQuery is the result of the requested post_import_query
+	PostImportQuery *PostImportQueryResult `json:"post_import_query,omitempty"`
+}
+
+// PostImportQueryResult represents the result of the query run after an import. The
+// import has succeeded even when the query fails, so failures are reported here with
+// status "error" rather than failing the upload.
+type PostImportQueryResult struct {
+	Status     string           `json:"status"`
+	Code       string           `json:"code,omitempty"`
+	Message    string           `json:"message,omitempty"`
+	RowCount   int              `json:"row_count"`
+	Columns    []string         `json:"columns,omitempty"`
+	Results    []map[string]any `json:"results,omitempty"`
+	DurationMs int64            `json:"duration_ms"`
+}
+
+// UploadTimings breaks down in milliseconds where the time of an upload went
+type UploadTimings struct {
+	// FileValidationMs covers the file extension check and MIME type detection
+	FileValidationMs float64 `json:"file_validation_ms"`
+	// EncodingValidationMs covers the encoding check, which runs as part of the copy
+	EncodingValidationMs float64 `json:"encoding_validation_ms"`
+	// CopyMs covers streaming the file to a temporary file, including row validation
+	CopyMs float64 `json:"copy_ms"`
+	// ImportMs covers DuckDB reading the file, detecting types and creating the table
+	ImportMs float64 `json:"import_ms"`
+	// ChecksumMs covers computing the checksum of the imported rows, when requested
+	ChecksumMs float64 `json:"checksum_ms,omitempty"`
+	// AnalyzeMs covers refreshing the statistics of the new table, when ANALYZE runs
+	AnalyzeMs float64 `json:"analyze_ms,omitempty"`
+	// PostImportQueryMs covers checking and running the post_import_query, when requested
+	PostImportQueryMs float64 `json:"post_import_query_ms,omitempty"`
+	// TotalMs covers the whole request
+	TotalMs float64 `json:"total_ms"`
+}
+
+// CSVPreviewResponse represents the inferred schema and sample rows of a CSV file
+type CSVPreviewResponse struct {
+	Columns []map[string]interface{} `json:"columns"`
+	Rows    []map[string]interface{} `json:"rows"`
+}
+
+// CreateTableRequest represents a request to create a table from a SELECT query
+type CreateTableRequest struct {
+	TableName string `json:"table_name" binding:"required"`
+	Query     string `json:"query" binding:"required"`
+	Override  bool   `json:"override,omitempty"`
+}
+
+// CreateTableResponse represents the response for a successful table creation
+type CreateTableResponse struct {
+	Status   string                   `json:"status"`
+	Table    string                   `json:"table"`
+	Columns  []map[string]interface{} `json:"columns"`
+	RowCount int64                    `json:"row_count"`
+}
+
+// MaterializeViewRequest represents a request to copy the current result of a view into a table
+type MaterializeViewRequest struct {
+	TableName string `json:"table_name" binding:"required"`
+	Override  bool   `json:"override,omitempty"`
+}
+
+// CreateViewRequest represents a request to create a view over an uploaded, S3 or GCS file
+type CreateViewRequest struct {
+	File     *multipart.FileHeader `form:"file" swaggerignore:"true"`
+	ViewName string                `form:"view_name" binding:"required"`
+	Source   string                `form:"source"`
+	Format   string                `form:"format"`
+	Override bool                  `form:"override"`
+}
+
+// CreateViewResponse represents the response for a successful view creation
+type CreateViewResponse struct {
+	Status  string                   `json:"status"`
+	View    string                   `json:"view"`
+	Format  string                   `json:"format"`
+	Source  string                   `json:"source,omitempty"`
+	Columns []map[string]interface{} `json:"columns"`
+}
+
+// ExportManifest describes the contents of an export archive and is written to it as manifest.json
+type ExportManifest struct {
+	ExportedAt time.Time       `json:"exported_at"`
+	Tables     []ExportedTable `json:"tables"`
+}
+
+// ExportedTable describes a single table file within an export archive
+type ExportedTable struct {
+	Schema   string        `json:"schema"`
+	Name     string        `json:"name"`
+	File     string        `json:"file"`
+	RowCount int64         `json:"row_count"`
+	Columns  []TableColumn `json:"columns"`
+}
+
+// DistinctValuesResponse represents the distinct values of a table column
+type DistinctValuesResponse struct {
+	Status    string        `json:"status"`
+	Table     string        `json:"table"`
+	Column    string        `json:"column"`
+	Values    []interface{} `json:"values"`
+	Truncated bool          `json:"truncated"`
+}
+
+// TableSampleResponse represents a random sample of a table. Sample is the USING SAMPLE
+// clause applied, and Truncated is true when more rows were sampled than returned.
+type TableSampleResponse struct {
+	Status    string           `json:"status"`
+	Table     string           `json:"table"`
+	Sample    string           `json:"sample"`
+	RowCount  int              `json:"row_count"`
+	Results   []map[string]any `json:"results"`
+	Truncated bool             `json:"truncated"`
+}
+
+// TableRowsResponse represents the first or last rows of a table. OrderBy is the column
+// the last rows are ordered by, descending.
+type TableRowsResponse struct {
+	Status   string           `json:"status"`
+	Table    string           `json:"table"`
+	OrderBy  string           `json:"order_by,omitempty"`
+	RowCount int              `json:"row_count"`
+	Results  []map[string]any `json:"results"`
+}
+
+// RefineTypesRequest represents a request to propose or apply tighter types for the
+// VARCHAR columns of a table
+type RefineTypesRequest struct {
+	Apply      bool  `json:"apply,omitempty"`
+	SampleSize int64 `json:"sample_size,omitempty" binding:"gte=0"`
+}
+
+// ColumnRefinement reports the type proposed for a VARCHAR column and, for every candidate
+// type, the number of values that cannot be cast to it without losing information
+type ColumnRefinement struct {
+	Column        string           `json:"column"`
+	ProposedType  string           `json:"proposed_type,omitempty"`
+	NonNullValues int64            `json:"non_null_values"`
+	Failures      map[string]int64 `json:"failures"`
+	Applied       bool             `json:"applied"`
+}
+
+// RefineTypesResponse lists the type refinements of a table's VARCHAR columns. SampleSize
+// is the number of sampled rows analyzed, 0 when the whole table was.
+type RefineTypesResponse struct {
+	Status     string             `json:"status"`
+	Table      string             `json:"table"`
+	SampleSize int64              `json:"sample_size"`
+	Applied    bool               `json:"applied"`
+	Columns    []ColumnRefinement `json:"columns"`
+}
+
+// TableDDLResponse represents the CREATE TABLE statement of a table
+type TableDDLResponse struct {
+	Status string `json:"status"`
+	Table  string `json:"table"`
+	DDL    string `json:"ddl"`
+}
+
+// RowFilterRequest represents the row filter predicate to set on a table
+type RowFilterRequest struct {
+	// Predicate is a SQL boolean expression over the columns of the table, where {tenant}
+	// stands for the tenant of the API key as a string literal
+	Predicate string `json:"predicate" binding:"required"`
+}
+
+// RowFilterResponse represents the row filter of a table after it was set or removed
+type RowFilterResponse struct {
+	Status    string `json:"status"`
+	Table     string `json:"table"`
+	Predicate string `json:"predicate,omitempty"`
+}
+
+// DropTablesResponse represents the tables dropped by a bulk deletion by name prefix
+type DropTablesResponse struct {
+	Status  string   `json:"status"`
+	Prefix  string   `json:"prefix"`
+	Dropped []string `json:"dropped"`
 }
 
 // SnapshotRequest represents a request to create a database snapshot
 type SnapshotRequest struct {
-	Bucket string `json:"bucket" binding:"required"`
-	Key    string `json:"key" binding:"required"`
+	Bucket      string `json:"bucket" binding:"required"`
+	Key         string `json:"key" binding:"required"`
+	CallbackURL string `json:"callback_url,omitempty"`
+	// Metadata is stored on the S3 object as x-amz-meta-* user metadata
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// Tags are applied to the S3 object
+	Tags map[string]string `json:"tags,omitempty"`
+	// ServerSideEncryption is AES256 or aws:kms
+	ServerSideEncryption string `json:"server_side_encryption,omitempty"`
+	// SSEKMSKeyID is the KMS key the S3 object is encrypted with, implying aws:kms
+	SSEKMSKeyID string `json:"sse_kms_key_id,omitempty"`
 }
 
 // SnapshotResponse represents the response for a successful snapshot creation
@@ -85,3 +394,98 @@ type SnapshotResponse struct {
 	SnapshotURI string `json:"snapshot_uri"`
 	Filename    string `json:"filename"`
 }
+
+// ParquetExportRequest represents a request to write query results to object storage
+// as Parquet files
+type ParquetExportRequest struct {
+	Query       string   `json:"query" binding:"required"`
+	Prefix      string   `json:"prefix" binding:"required"`
+	PartitionBy []string `json:"partition_by,omitempty"`
+}
+
+// ParquetExportResponse represents the response for a successful Parquet export
+type ParquetExportResponse struct {
+	Status   string   `json:"status"`
+	Prefix   string   `json:"prefix"`
+	Files    []string `json:"files"`
+	RowCount int64    `json:"row_count"`
+}
+
+// AmbiguousTableResponse is returned when a table name matches several tables ignoring case
+type AmbiguousTableResponse struct {
+	Status     string   `json:"status"`
+	Code       string   `json:"code"`
+	Message    string   `json:"message"`
+	Candidates []string `json:"candidates"`
+}
+
+// TableS3ExportRequest represents a request to write a table to an S3 object
+type TableS3ExportRequest struct {
+	Bucket string `json:"bucket" binding:"required"`
+	Key    string `json:"key" binding:"required"`
+	// Format is csv (default) or parquet
+	Format string `json:"format,omitempty"`
+}
+
+// TableS3ExportResponse represents the response for a successful table export to S3
+type TableS3ExportResponse struct {
+	Status   string `json:"status"`
+	Table    string `json:"table"`
+	Format   string `json:"format"`
+	URL      string `json:"url"`
+	RowCount int64  `json:"row_count"`
+}
+
+// DuckDBInfoResponse describes the embedded DuckDB engine and its current settings
+type DuckDBInfoResponse struct {
+	Status   string            `json:"status"`
+	Version  string            `json:"version"`
+	SourceID string            `json:"source_id"`
+	Codename string            `json:"codename,omitempty"`
+	Settings map[string]string `json:"settings"`
+}
+
+// ActiveQueryInfo describes a query that is currently being executed
+type ActiveQueryInfo struct {
+	ID        string    `json:"id"`
+	RequestID string    `json:"request_id"`
+	StartedAt time.Time `json:"started_at"`
+	RunningMs int64     `json:"running_ms"`
+	Query     string    `json:"query"`
+	Truncated bool      `json:"truncated"`
+}
+
+// ActivityResponse lists the in-flight queries and open socket connections. The socket
+// connection limit is 0 when connections are not limited.
+type ActivityResponse struct {
+	Status               string            `json:"status"`
+	Queries              []ActiveQueryInfo `json:"queries"`
+	SocketConnections    int               `json:"socket_connections"`
+	SocketMaxConnections int               `json:"socket_max_connections"`
+	EncodingMismatches   int64             `json:"encoding_mismatches"`
+}
+
+// MaintenanceRequest turns maintenance mode on or off, with an optional reason reported
+// to rejected clients
+type MaintenanceRequest struct {
+	Enabled *bool  `json:"enabled" binding:"required"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// MaintenanceResponse represents the maintenance mode after it was changed. Since is the
+// time maintenance mode was turned on.
+type MaintenanceResponse struct {
+	Status  string     `json:"status"`
+	Enabled bool       `json:"enabled"`
+	Reason  string     `json:"reason,omitempty"`
+	Since   *time.Time `json:"since,omitempty"`
+}
+
+// RequestLogsResponse lists the log entries captured for a request, from oldest to newest.
+// Dropped counts the older entries overwritten once the per-request buffer was full.
+type RequestLogsResponse struct {
+	Status    string                   `json:"status"`
+	RequestID string                   `json:"request_id"`
+	Entries   []applog.RequestLogEntry `json:"entries"`
+	Dropped   int                      `json:"dropped"`
+}
@@ -1,6 +1,8 @@
 package api
 
 import (
+	"bufio"
+	"bytes"
 	"context" // Import context
 	"errors"
 	"fmt"
@@ -10,8 +12,12 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
+	"unicode"
 	"unicode/utf8"
 
 	"mime/multipart"
@@ -21,6 +27,9 @@ import (
 	"github.com/gabriel-vasile/mimetype"
 	"github.com/gin-gonic/gin"
 	"github.com/wlynxg/chardet"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/transform"
 )
 
 // suggestionMap contains default suggestions for CSV error codes.
@@ -38,10 +47,29 @@ var suggestionMap = map[string]string{
 	"FILE_COPY_ERROR":            "Please try again or contact support if the issue persists.",
 	"SMART_IMPORT_FAILED":        "Check the CSV file structure and ensure it contains valid data.",
 	"DIRECT_IMPORT_FAILED":       "Check the CSV file structure and ensure it contains valid data.", "TABLE_INFO_ERROR": "The table may not have been created correctly. Check the CSV file structure.",
-	"ROW_COUNT_ERROR":      "The data may not have been imported correctly. Check the CSV file structure.",
-	"INVALID_ENCODING":     "Please ensure the file is saved with UTF-8 encoding before uploading.",
-	"UNSUPPORTED_ENCODING": "Please ensure the file is saved with a supported encoding (UTF-8 or UTF-16) before uploading.",
-	"DUPLICATE_TABLE_NAME": "Choose a different table name or use the override parameter to replace the existing table.",
+	"ROW_COUNT_ERROR":             "The data may not have been imported correctly. Check the CSV file structure.",
+	"INVALID_ENCODING":            "Please ensure the file is saved with UTF-8 encoding before uploading.",
+	"UNSUPPORTED_ENCODING":        "Please ensure the file is saved with a supported encoding (UTF-8, UTF-16, ISO-8859-1, ISO-8859-15 or Windows-1252) before uploading.",
+	"DUPLICATE_TABLE_NAME":        "Choose a different table name or use the override parameter to replace the existing table.",
+	"INVALID_FILE_NAME":           "Rename the file to a shorter name of printable characters, within ENV_MAX_FILENAME_LENGTH bytes.",
+	"INVALID_TABLE_NAME":          "Provide a table_name or rename the file so it starts with a letter and contains letters, digits or underscores. With ENV_TABLE_NAME_SANITIZATION=quoted, avoid quotes, dots, slashes and control characters.",
+	"INVALID_SCHEMA_NAME":         "Use a schema name that starts with a letter and contains letters, digits or underscores.",
+	"PREVIEW_FAILED":              "Check the delimiter, encoding and header settings, or the date and timestamp formats.",
+	"INVALID_FILE_EXTENSION":      "Rename the file with an allowed extension such as .csv, .tsv or .txt.",
+	"DISK_FULL":                   "The server ran out of disk space for temporary files. Try again later or contact the administrator to free up space in the temporary directory.",
+	"INVALID_TYPE_ROW":            "Set has_header with type_row and declare every column as string, integer, double, boolean, date, time, timestamp or json.",
+	"COLUMN_NAME_COLLISION":       "Give the listed columns header names that stay distinct once lowercased and stripped of spaces and punctuation, or rename them with rename_columns.",
+	"COLUMN_RENAME_ERROR":         "Rename existing columns, as they are named in the imported table, to distinct names of letters, digits or underscores.",
+	"COLUMN_SELECTION_ERROR":      "List each column to keep once, as it is named in the imported table: lowercased with spaces and punctuation replaced by underscores.",
+	"VALIDATION_WARNINGS_PRESENT": "Fix the listed rows, or upload without fail_on_warning to skip or ignore them as the validation mode allows.",
+	"INVALID_VIEW_SOURCE":         "Send either a Parquet or CSV file, or a source URI of the form s3://bucket/key or gs://bucket/key.",
+	"UNSUPPORTED_FILE_FORMAT":     "Set format to parquet or csv, or name the file with a .parquet, .csv, .tsv or .txt extension.",
+	"SOURCE_DOWNLOAD_FAILED":      "Check that the object exists and that the server's credentials can read it.",
+	"VIEW_CREATION_FAILED":        "Check that the file is a readable Parquet or CSV file with a consistent structure.",
+	"TABLE_VERSION_MISMATCH":      "Read the table's current ETag with HEAD /api/v1/tables/{name}, check the changes made since, and upload again with that ETag in If-Match.",
+	"CHECKSUM_ERROR":              "The table was imported but its checksum could not be computed. Query the table to verify it, or upload again with checksum.",
+	"DISK_QUOTA_EXCEEDED":         "Drop tables that are no longer needed or raise ENV_MAX_TOTAL_DISK, then upload again.",
+	"DISK_QUOTA_CHECK_FAILED":     "Disk usage could not be measured, check the server logs and the temporary directory, then upload again.",
 }
 
 const (
@@ -49,6 +77,9 @@ const (
 	ErrValidateFileFormat = "failed to validate file format: %v"
 )
 
+// errDiskFull is returned when the temporary file cannot be written because the disk is full
+var errDiskFull = errors.New("no space left on device for temporary file")
+
 // Size constants
 const (
 	// BytesInMB is the number of bytes in a megabyte, used for logging
@@ -67,12 +98,19 @@ const (
 //	@Produce		json
 //	@Param			request				formData	api.CSVRequest			true	"CSV upload request"
 //	@Param			csv_file			formData	file					true	"CSV file to upload"
-//	@Param			csv_file_encoding	formData	string					false	"Encoding of the CSV file (default: utf-8, supported: utf-8, utf-16)"
-//	@Success		200					{object}	api.CSVUploadResponse	"Upload successful"
-//	@Failure		400					{object}	api.CSVErrorResponse	"Bad request with possible error codes: INVALID_REQUEST_PARAMETERS, FILE_OPEN_ERROR, MIME_TYPE_DETECTION_ERROR, CSV_FORMAT_CHECK_ERROR, INVALID_FILE_FORMAT, CSV_VALIDATION_ERROR, INVALID_CSV_STRUCTURE, INVALID_ENCODING, UNSUPPORTED_ENCODING"
-//	@Failure		413					{object}	api.CSVErrorResponse	"File too large with error code: FILE_SIZE_EXCEEDED"
-//	@Failure		422					{object}	api.CSVErrorResponse	"Unprocessable entity with possible error codes: SECURITY_VALIDATION_FAILED, FILE_COPY_ERROR, TEMP_FILE_CREATION_ERROR, SMART_IMPORT_FAILED, DIRECT_IMPORT_FAILED, TABLE_INFO_ERROR, ROW_COUNT_ERROR"
-//	@Failure		500					{object}	api.CSVErrorResponse	"Internal server error"
+//	@Param			csv_file_encoding	formData	string					false	"Encoding of the CSV file (default: utf-8, supported: utf-8, utf-16, iso-8859-1, iso-8859-15, windows-1252)"
+//	@Param			If-Match			header		string					false	"ETag of the table from HEAD /tables/{name} or a previous upload, the upload fails with 412 when the table changed since"
+//	@Header			200					{string}	ETag					"Version of the imported table, for If-Match on the next upload"
+//	@Success		200					{object}	api.CSVUploadResponse	"Upload successful, a failed post_import_query is reported in post_import_query with status error"
+//	@Success		200					{object}	api.CSVValidationReport	"Issues found in the file when collect_all_errors is set, nothing is imported"
+//	@Failure		400					{object}	api.CSVErrorResponse	"Bad request with possible error codes: INVALID_REQUEST_PARAMETERS, INVALID_FILE_NAME, INVALID_TABLE_NAME, INVALID_SCHEMA_NAME, FILE_OPEN_ERROR, MIME_TYPE_DETECTION_ERROR, CSV_FORMAT_CHECK_ERROR, INVALID_FILE_EXTENSION, INVALID_FILE_FORMAT, CSV_VALIDATION_ERROR, INVALID_CSV_STRUCTURE, INVALID_ENCODING, UNSUPPORTED_ENCODING, INVALID_TYPE_ROW, COLUMN_RENAME_ERROR, COLUMN_SELECTION_ERROR, VALIDATION_WARNINGS_PRESENT"
+//	@Failure		403					{object}	api.ErrorResponse		"Read-only API key or database with error code: READ_ONLY_API_KEY or READ_ONLY_MODE"
+//	@Failure		412					{object}	api.CSVErrorResponse	"Table changed since the ETag sent in If-Match with error code: TABLE_VERSION_MISMATCH"
+//	@Failure		413					{object}	api.CSVErrorResponse	"File too large or disk quota reached with error code: FILE_SIZE_EXCEEDED or DISK_QUOTA_EXCEEDED"
+//	@Failure		422					{object}	api.CSVErrorResponse	"Unprocessable entity with possible error codes: SECURITY_VALIDATION_FAILED, FILE_COPY_ERROR, TEMP_FILE_CREATION_ERROR, SMART_IMPORT_FAILED, DIRECT_IMPORT_FAILED, TABLE_INFO_ERROR, ROW_COUNT_ERROR, COLUMN_NAME_COLLISION"
+//	@Failure		500					{object}	api.CSVErrorResponse	"Internal server error with error code: CHECKSUM_ERROR"
+//	@Failure		503					{object}	api.CSVErrorResponse	"Disk usage could not be measured for the disk quota with error code: DISK_QUOTA_CHECK_FAILED"
+//	@Failure		507					{object}	api.CSVErrorResponse	"Insufficient storage with error code: DISK_FULL"
 //	@Router			/upload [post]
 func (s *Server) handleCSVUpload() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -83,7 +121,22 @@ func (s *Server) handleCSVUpload() gin.HandlerFunc {
 		ctx := c.Request.Context()
 		log := helpers.GetLoggerFromContext(ctx)
 
-		if err := c.ShouldBind(&payload); err != nil {
+		// Record where the time goes so slow uploads can be diagnosed from the response
+		startTime := time.Now()
+		var timings UploadTimings
+		ctx = withUploadTimings(ctx, &timings)
+
+		// Parse the form with the configured memory limit first, binding reuses the parsed form
+		err := parseMultipartForm(c)
+		if err == nil {
+			err = c.ShouldBind(&payload)
+		}
+		if err == nil {
+			// Form binding does not support maps, renames are sent as rename_columns[old]=new
+			payload.RenameColumns = c.PostFormMap("rename_columns")
+			payload.Columns = splitColumnList(payload.Columns)
+		}
+		if err != nil {
 			log.Info("Error binding CSV request", slog.Any("error", err))
 
 			bindError := CSVError{
@@ -101,19 +154,115 @@ func (s *Server) handleCSVUpload() gin.HandlerFunc {
 			return
 		}
 
+		if filenameErr := validateUploadFilename(payload.CSVFile); filenameErr != nil {
+			log.Info("Invalid file name", slog.String("message", filenameErr.Message))
+			c.JSON(http.StatusBadRequest, CSVErrorResponse{
+				Errors: []CSVError{*filenameErr},
+			})
+			return
+		}
+
+		// Default the table name to the sanitized file name when omitted
+		tableName, tableNameErr := resolveTableName(payload)
+		if tableNameErr != nil {
+			log.Info("Invalid table name", slog.String("message", tableNameErr.Message))
+			c.JSON(http.StatusBadRequest, CSVErrorResponse{
+				Errors: []CSVError{*tableNameErr},
+			})
+			return
+		}
+
+		schema, schemaErr := resolveSchemaName(payload.Schema)
+		if schemaErr != nil {
+			log.Info("Invalid schema name", slog.String("message", schemaErr.Message))
+			c.JSON(http.StatusBadRequest, CSVErrorResponse{
+				Errors: []CSVError{*schemaErr},
+			})
+			return
+		}
+
+		if payload.Stream && payload.TypeRow {
+			c.JSON(http.StatusBadRequest, CSVErrorResponse{
+				Errors: []CSVError{{
+					Code:    "INVALID_REQUEST_PARAMETERS",
+					Message: "Invalid request: type_row cannot be combined with stream",
+					Details: CSVErrorDetail{
+						Line:       0,
+						Suggestion: "Upload without stream to read column types from a type row.",
+					},
+				}},
+			})
+			return
+		}
+
+		if typeRowErr := validateTypeRowOptions(payload.TypeRow, payload.HasHeader, payload.AllVarchar); typeRowErr != nil {
+			c.JSON(http.StatusBadRequest, CSVErrorResponse{
+				Errors: []CSVError{*typeRowErr},
+			})
+			return
+		}
+
+		ragged := RaggedRows{
+			TrimTrailingDelimiter: payload.TrimTrailingDelimiter,
+			NullPadding:           payload.NullPadding,
+		}
+
+		// Report every issue in the file without importing it
+		if payload.CollectAllErrors {
+			report, collectErrors, collectErr := s.collectCSVErrors(ctx, payload.CSVFile, payload.HasHeader, payload.FileEncoding, payload.SkipRows, ragged)
+			if collectErr != nil {
+				log.Info("Error collecting CSV validation issues", slog.Any("error", collectErr))
+				c.JSON(copyErrorStatus(collectErr), CSVErrorResponse{
+					Errors: collectErrors,
+				})
+				return
+			}
+			c.JSON(http.StatusOK, report)
+			return
+		}
+
+		// Fail before reading the file when the table already changed, the import checks
+		// again once it holds the write lock
+		ifMatch := c.GetHeader("If-Match")
+		if ifMatch != "" && !s.checkTableIfMatch(c, schema, tableName, ifMatch) {
+			return
+		}
+
+		if !s.checkDiskQuota(c, payload.CSVFile.Size) {
+			return
+		}
+
 		// Extract parameters
-		tableName := payload.TableName
 		hasHeader := payload.HasHeader
 		override := payload.Override
 		smart := payload.Smart
 		csvFile := payload.CSVFile
 		encoding := payload.FileEncoding
+		if payload.ForceEncoding {
+			encoding = s.forcedEncoding(ctx, csvFile, encoding)
+		}
+		importOptions := database.CSVImportOptions{
+			Schema:          schema,
+			DateFormat:      payload.DateFormat,
+			TimestampFormat: payload.TimestampFormat,
+			SkipRows:        payload.SkipRows,
+			AllVarchar:      payload.AllVarchar,
+			NullPadding:     payload.NullPadding,
+			Columns:         payload.Columns,
+			RenameColumns:   payload.RenameColumns,
+		}
+		if ifMatch != "" {
+			importOptions.IfMatch = func(etag string) bool {
+				return ifMatchMatches(ifMatch, etag)
+			}
+		}
 
 		log.Info("CSV upload request received",
-			slog.String("remote_addr", c.Request.RemoteAddr),
+			slog.String("remote_addr", c.ClientIP()),
 			slog.Int64("content_length", c.Request.ContentLength),
 		)
 		log.Info("Processing upload",
+			slog.String("schema", schema),
 			slog.String("table", tableName),
 		)
 		log.Info("CSV has header",
@@ -126,36 +275,55 @@ func (s *Server) handleCSVUpload() gin.HandlerFunc {
 			slog.String("encoding", encoding),
 		)
 
-		// Process the uploaded file using the decoupled function directly
+		// Process the uploaded file using the decoupled function directly, or stream it
+		// into DuckDB through a named pipe when requested
 		// Pass the context here
-		tempFilePath, validationErrors, err := s.processCsvFileFromHeader(ctx, csvFile, tableName, hasHeader, encoding)
+		var tempFilePath string
+		var validationErrors []CSVError
+		var stream *csvStream
+		if payload.Stream {
+			stream, validationErrors, err = s.startCsvStream(ctx, csvFile, hasHeader, encoding, importOptions.SkipRows, ragged, payload.FullValidation, payload.FailOnWarning)
+		} else {
+			tempFilePath, validationErrors, err = s.processCsvFileFromHeader(ctx, csvFile, schema+"_"+tableName, hasHeader, encoding, importOptions.SkipRows, ragged, payload.FullValidation, payload.FailOnWarning)
+		}
 		if err != nil {
 			// Handle any errors that occur during processing
 			log.Info("Error processing CSV file",
 				slog.Any("error", err),
 			)
 
-			// Check for file size exceeded error to return the appropriate status code
-			if strings.Contains(err.Error(), "file too large") {
-				c.JSON(http.StatusRequestEntityTooLarge, CSVErrorResponse{
-					Errors: validationErrors,
-				})
-				return
-			}
-
 			// Return all collected validation errors
-			c.JSON(http.StatusBadRequest, CSVErrorResponse{
+			c.JSON(copyErrorStatus(err), CSVErrorResponse{
 				Errors: validationErrors,
 			})
 			return
 		}
 
 		// If we get here, we have a valid temp file, but may still have non-fatal validation warnings
-		defer s.cleanupTempFile(ctx, tempFilePath) // This function also needs context if it logs
+		if stream != nil {
+			defer stream.Close()
+			tempFilePath = stream.pipePath
+			importOptions.SampleFile = stream.samplePath
+			importOptions.Complete = stream.Complete
+		} else {
+			defer s.cleanupTempFile(ctx, tempFilePath) // This function also needs context if it logs
+		}
+
+		if payload.TypeRow {
+			columnTypes, typeRowErr := readTypeRow(tempFilePath, importOptions.SkipRows)
+			if typeRowErr != nil {
+				log.Info("Invalid type row", slog.String("message", typeRowErr.Message))
+				c.JSON(http.StatusBadRequest, CSVErrorResponse{
+					Errors: []CSVError{*typeRowErr},
+				})
+				return
+			}
+			importOptions.ColumnTypes = columnTypes
+		}
 
 		// Import the CSV data and prepare response
 		// Pass the context here
-		columnsResult, rowCount, importInfo, err := s.importCsvData(ctx, c, tableName, tempFilePath, hasHeader, override)
+		columnsResult, rowCount, importInfo, err := s.importCsvData(ctx, c, tableName, tempFilePath, hasHeader, override, importOptions)
 		if err != nil {
 			// Error has already been written to response by importCsvData
 			return
@@ -165,16 +333,68 @@ func (s *Server) handleCSVUpload() gin.HandlerFunc {
 			slog.String("table", tableName),
 			slog.Int64("row_count", rowCount),
 		)
+
+		// Fresh statistics give the first queries against a large table good plans
+		importInfo["analyzed"] = s.analyzeImportedTable(ctx, database.TableRef{Schema: schema, Name: tableName}, payload.Analyze, rowCount)
+
+		// Hashing reads the whole table, so it only runs when requested
+		var checksum string
+		if payload.Checksum {
+			checksumStart := time.Now()
+			checksum, err = s.db.TableChecksum(ctx, database.TableRef{Schema: schema, Name: tableName})
+			recordUploadPhase(ctx, phaseChecksum, checksumStart)
+			if err != nil {
+				log.Error("Error computing table checksum", slog.Any("error", err))
+				c.JSON(http.StatusInternalServerError, CSVErrorResponse{
+					Errors: []CSVError{{
+						Code:    "CHECKSUM_ERROR",
+						Message: fmt.Sprintf("Failed to compute checksum: %v", err),
+						Details: CSVErrorDetail{
+							Line:       0,
+							Suggestion: suggestionMap["CHECKSUM_ERROR"],
+						},
+					}},
+				})
+				return
+			}
+		}
+
+		// Runs after the checksum, which verifies the rows as imported
+		var postImportQuery *PostImportQueryResult
+		if payload.PostImportQuery != "" {
+			postImportQuery = s.runPostImportQuery(ctx, database.TableRef{Schema: schema, Name: tableName}, payload.PostImportQuery)
+		}
+
 		log.Info("Upload process completed successfully",
 			slog.String("table", tableName),
 		)
 
+		timings.TotalMs = durationMs(time.Since(startTime))
+		log.Info("Upload timings",
+			slog.Float64("file_validation_ms", timings.FileValidationMs),
+			slog.Float64("encoding_validation_ms", timings.EncodingValidationMs),
+			slog.Float64("copy_ms", timings.CopyMs),
+			slog.Float64("import_ms", timings.ImportMs),
+			slog.Float64("analyze_ms", timings.AnalyzeMs),
+			slog.Float64("checksum_ms", timings.ChecksumMs),
+			slog.Float64("post_import_query_ms", timings.PostImportQueryMs),
+			slog.Float64("total_ms", timings.TotalMs),
+		)
+
 		// Build the response with validation and import info
 		response := CSVUploadResponse{
-			Table:    tableName,
-			Columns:  columnsResult.Results,
-			RowCount: rowCount,
-			Import:   importInfo,
+			Schema:          schema,
+			Table:           tableName,
+			Columns:         columnsResult.Results,
+			RowCount:        rowCount,
+			Import:          importInfo,
+			Timings:         timings,
+			Checksum:        checksum,
+			PostImportQuery: postImportQuery,
+		}
+
+		if etag, err := s.db.TableETag(ctx, schema, tableName); err == nil && etag != "" {
+			c.Header("ETag", etag)
 		}
 
 		// Send success response
@@ -182,25 +402,265 @@ func (s *Server) handleCSVUpload() gin.HandlerFunc {
 	}
 }
 
+// analyzeImportedTable runs ANALYZE on an imported table when the request sets analyze,
+// or leaves it unset and the import reached ENV_AUTO_ANALYZE_THRESHOLD rows, reporting
+// whether it ran. A failure is only logged, the rows are imported either way.
+func (s *Server) analyzeImportedTable(ctx context.Context, table database.TableRef, analyze *bool, rowCount int64) bool {
+	log := helpers.GetLoggerFromContext(ctx)
+
+	if analyze == nil {
+		threshold := helpers.GetAutoAnalyzeThreshold()
+		if threshold == 0 || rowCount < int64(threshold) {
+			return false
+		}
+	} else if !*analyze {
+		return false
+	}
+
+	start := time.Now()
+	err := s.db.AnalyzeTable(ctx, table)
+	recordUploadPhase(ctx, phaseAnalyze, start)
+	if err != nil {
+		log.Error("Error analyzing imported table", slog.String("table", table.Name), slog.Any("error", err))
+		return false
+	}
+	return true
+}
+
+// checkTableIfMatch writes a 412 TABLE_VERSION_MISMATCH response and returns false when
+// the table's current entity tag is not listed in the If-Match header
+func (s *Server) checkTableIfMatch(c *gin.Context, schema, tableName, ifMatch string) bool {
+	ctx := c.Request.Context()
+	log := getLoggerFromGinContext(c)
+
+	etag, err := s.db.TableETag(ctx, schema, tableName)
+	if err != nil {
+		log.Error("Error reading table version", slog.Any("error", err))
+		c.JSON(http.StatusInternalServerError, CSVErrorResponse{
+			Errors: []CSVError{{
+				Code:    "TABLE_INFO_ERROR",
+				Message: fmt.Sprintf("Failed to read table version: %v", err),
+				Details: CSVErrorDetail{
+					Line:       0,
+					Suggestion: suggestionMap["TABLE_INFO_ERROR"],
+				},
+			}},
+		})
+		return false
+	}
+	if !ifMatchMatches(ifMatch, etag) {
+		log.Info("Table version does not match If-Match",
+			slog.String("table", tableName),
+			slog.String("if_match", ifMatch),
+			slog.String("etag", etag))
+		c.JSON(http.StatusPreconditionFailed, CSVErrorResponse{
+			Errors: []CSVError{tableVersionMismatchError(tableName)},
+		})
+		return false
+	}
+	return true
+}
+
+// tableVersionMismatchError reports a table modified since the version sent in If-Match
+func tableVersionMismatchError(tableName string) CSVError {
+	return CSVError{
+		Code:    "TABLE_VERSION_MISMATCH",
+		Message: fmt.Sprintf("Table '%s' does not exist or was modified since the version sent in If-Match", tableName),
+		Details: CSVErrorDetail{
+			Line:       0,
+			Suggestion: suggestionMap["TABLE_VERSION_MISMATCH"],
+		},
+	}
+}
+
+// copyErrorStatus returns the status code for an upload that failed validation or could
+// not be copied
+func copyErrorStatus(err error) int {
+	switch {
+	case strings.Contains(err.Error(), "file too large"):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, errDiskFull):
+		return http.StatusInsufficientStorage
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// parseMultipartForm parses a multipart request body keeping at most ENV_MULTIPART_MEMORY
+// bytes in memory and spooling larger parts to temporary files, instead of the 32MB that
+// binding would use. Bodies that are not multipart are left for binding to report.
+func parseMultipartForm(c *gin.Context) error {
+	err := c.Request.ParseMultipartForm(helpers.GetMultipartMemory())
+	if errors.Is(err, http.ErrNotMultipart) {
+		return nil
+	}
+	return err
+}
+
+// resolveTableName returns the requested table name, or derives one from the uploaded
+// file name when table_name is omitted
+func resolveTableName(payload CSVRequest) (string, *CSVError) {
+	if payload.TableName != "" {
+		if err := database.ValidateTableName(payload.TableName); err != nil {
+			return "", &CSVError{
+				Code:    "INVALID_TABLE_NAME",
+				Message: err.Error(),
+				Details: CSVErrorDetail{
+					Line:       0,
+					Suggestion: suggestionMap["INVALID_TABLE_NAME"],
+				},
+			}
+		}
+		return payload.TableName, nil
+	}
+
+	tableName := tableNameFromFilename(payload.CSVFile.Filename)
+	if !isValidDerivedTableName(tableName) {
+		return "", &CSVError{
+			Code:    "INVALID_TABLE_NAME",
+			Message: fmt.Sprintf("Could not derive a valid table name from file name '%s'", payload.CSVFile.Filename),
+			Details: CSVErrorDetail{
+				Line:       0,
+				Suggestion: suggestionMap["INVALID_TABLE_NAME"],
+			},
+		}
+	}
+
+	return tableName, nil
+}
+
+// resolveSchemaName sanitizes the requested schema, defaulting to the main schema
+func resolveSchemaName(schema string) (string, *CSVError) {
+	if schema == "" {
+		return database.DefaultSchema, nil
+	}
+
+	sanitized := database.SanitizeTableName(schema)
+	if database.ValidateTableName(schema) != nil || !isValidDerivedTableName(sanitized) {
+		return "", &CSVError{
+			Code:    "INVALID_SCHEMA_NAME",
+			Message: fmt.Sprintf("Invalid schema name '%s'", schema),
+			Details: CSVErrorDetail{
+				Line:       0,
+				Suggestion: suggestionMap["INVALID_SCHEMA_NAME"],
+			},
+		}
+	}
+
+	return sanitized, nil
+}
+
+// validateUploadFilename reduces the name of an uploaded file to its last path component,
+// so neither slashes nor backslashes from the client reach file paths, logs or error
+// messages, and checks it against ENV_MAX_FILENAME_LENGTH. Names with control characters
+// or invalid UTF-8, and names that are only a path, are rejected.
+func validateUploadFilename(fileHeader *multipart.FileHeader) *CSVError {
+	name := fileHeader.Filename
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+
+	invalid := func(message string) *CSVError {
+		return &CSVError{
+			Code:    "INVALID_FILE_NAME",
+			Message: message,
+			Details: CSVErrorDetail{
+				Line:       0,
+				Suggestion: suggestionMap["INVALID_FILE_NAME"],
+			},
+		}
+	}
+
+	if maxLength := helpers.GetMaxFilenameLength(); len(name) > maxLength {
+		return invalid(fmt.Sprintf("File name is %d bytes long, the maximum is %d", len(name), maxLength))
+	}
+	if name == "" || name == "." || name == ".." {
+		return invalid("File name is empty once its path is removed")
+	}
+	if !utf8.ValidString(name) || strings.ContainsFunc(name, unicode.IsControl) {
+		return invalid(fmt.Sprintf("File name %q contains control characters or invalid UTF-8", name))
+	}
+
+	fileHeader.Filename = name
+	return nil
+}
+
+// tableNameFromFilename strips the extension from the file name and sanitizes the rest
+func tableNameFromFilename(filename string) string {
+	base := filepath.Base(filename)
+	return database.SanitizeTableName(strings.TrimSuffix(base, filepath.Ext(base)))
+}
+
+// isValidDerivedTableName checks that a derived name is usable as an unquoted identifier,
+// or with the quoted sanitization strategy that it holds more than underscores
+func isValidDerivedTableName(tableName string) bool {
+	if strings.Trim(tableName, "_ ") == "" {
+		return false
+	}
+	if helpers.GetTableNameSanitization() == helpers.TableNameSanitizationQuoted {
+		return true
+	}
+	return tableName[0] < '0' || tableName[0] > '9'
+}
+
 // processCsvFileFromHeader is a decoupled version that works with a FileHeader directly
 // Returns the temp file path, any CSV validation errors, and any error
 // Added ctx context.Context
-func (s *Server) processCsvFileFromHeader(ctx context.Context, fileHeader *multipart.FileHeader, tableName string, hasHeader bool, encoding string) (string, []CSVError, error) {
+func (s *Server) processCsvFileFromHeader(ctx context.Context, fileHeader *multipart.FileHeader, tableName string, hasHeader bool, encoding string, skipRows int, ragged RaggedRows, fullValidation, failOnWarning bool) (string, []CSVError, error) {
+	log := helpers.GetLoggerFromContext(ctx) // Retrieve logger
+
+	file, validationErrors, err := s.openValidatedUpload(ctx, fileHeader, encoding, skipRows, ragged)
+	if err != nil {
+		return "", validationErrors, err
+	}
+	defer helpers.CloseResources(file, "uploaded file") // helpers.CloseResources might also benefit from context logger
+
+	// Create temporary file
+	// Pass context
+	tempFilePath, tempFile, err := s.createTempFileForUpload(ctx, tableName)
+	if err != nil {
+		copyError := CSVError{
+			Code:    "TEMP_FILE_CREATION_ERROR",
+			Message: fmt.Sprintf("Failed to create temporary file: %v", err),
+			Details: CSVErrorDetail{
+				Line:       0,
+				Suggestion: suggestionMap["TEMP_FILE_CREATION_ERROR"],
+			},
+		}
+		return "", []CSVError{copyError}, err
+	}
+	// No defer close here since copyFileData will handle closing
+
+	// Copy data to temp file - the validation will happen inside CopyWithMaxSize
+	// Pass context
+	copyErrors, err := s.copyFileData(ctx, file, tempFile, fileHeader.Filename, hasHeader, encoding, skipRows, ragged, fullValidation, failOnWarning)
+	if err != nil {
+		return "", copyErrors, err
+	}
+
+	// Use the logger from context
+	log.Info("Closed temporary file, preparing to import data")
+	return tempFilePath, copyErrors, nil
+}
+
+// openValidatedUpload checks the encoding, extension and MIME type of an uploaded file and
+// opens it for copying. The caller closes the returned file.
+func (s *Server) openValidatedUpload(ctx context.Context, fileHeader *multipart.FileHeader, encoding string, skipRows int, ragged RaggedRows) (multipart.File, []CSVError, error) {
 	log := helpers.GetLoggerFromContext(ctx) // Retrieve logger
 
-	// Check if encoding is supported (only UTF-8 and UTF-16 are allowed)
+	// Check if encoding is supported (UTF-8, UTF-16 and the transcoded encodings)
 	if !isEncodingSupported(encoding) {
 		// Return error for any unsupported encoding
 		validationError := CSVError{
 			Code:    "UNSUPPORTED_ENCODING",
-			Message: fmt.Sprintf("unsupported encoding: %s. Supported encodings are: UTF-8 and UTF-16", encoding),
+			Message: fmt.Sprintf("unsupported encoding: %s. %s", encoding, supportedEncodingsMessage),
 			Details: CSVErrorDetail{
 				Line:       0,
 				Suggestion: suggestionMap["UNSUPPORTED_ENCODING"],
 			},
 		}
-		return "", []CSVError{validationError},
-			fmt.Errorf("unsupported encoding: %s. Supported encodings are: UTF-8 and UTF-16", encoding)
+		return nil, []CSVError{validationError},
+			fmt.Errorf("unsupported encoding: %s. %s", encoding, supportedEncodingsMessage)
 	}
 
 	// Open the file for initial access
@@ -216,9 +676,8 @@ func (s *Server) processCsvFileFromHeader(ctx context.Context, fileHeader *multi
 				Suggestion: suggestionMap["FILE_OPEN_ERROR"],
 			},
 		}
-		return "", []CSVError{validationError}, fmt.Errorf("failed to open uploaded file: %v", err)
+		return nil, []CSVError{validationError}, fmt.Errorf("failed to open uploaded file: %v", err)
 	}
-	defer helpers.CloseResources(file, "uploaded file") // helpers.CloseResources might also benefit from context logger
 
 	// Use the logger from context
 	log.Info("Received file",
@@ -226,47 +685,91 @@ func (s *Server) processCsvFileFromHeader(ctx context.Context, fileHeader *multi
 		slog.Int64("size_bytes", fileHeader.Size),
 	)
 
-	// Validate MIME type for actual file uploads (not test uploads)
-	// This helps prevent processing non-CSV files
-	if !strings.HasPrefix(fileHeader.Filename, "test") && fileHeader.Size > 0 {
-		// Pass context
-		mimeErrors, mimeErr := s.validateMimeType(ctx, fileHeader)
-		if mimeErr != nil {
-			return "", mimeErrors, mimeErr
+	// Validate the extension and MIME type to prevent processing non-CSV files,
+	// unless explicitly disabled outside of release mode
+	validationStart := time.Now()
+	skipMime := skipMimeValidation()
+	if skipMime {
+		log.Info("Skipping file extension and MIME type validation", slog.String("mode", gin.Mode()))
+	} else {
+		if extErrors, extErr := validateFileExtension(ctx, fileHeader.Filename); extErr != nil {
+			helpers.CloseResources(file, "uploaded file")
+			return nil, extErrors, extErr
+		}
+		if fileHeader.Size > 0 {
+			// Pass context
+			mimeErrors, mimeErr := s.validateMimeType(ctx, fileHeader, skipRows, ragged)
+			if mimeErr != nil {
+				helpers.CloseResources(file, "uploaded file")
+				return nil, mimeErrors, mimeErr
+			}
 		}
 	}
+	recordUploadPhase(ctx, phaseFileValidation, validationStart)
 
-	// Create temporary file
-	// Pass context
-	tempFilePath, tempFile, err := s.createTempFileForUpload(ctx, tableName)
-	if err != nil {
-		copyError := CSVError{
-			Code:    "TEMP_FILE_CREATION_ERROR",
-			Message: fmt.Sprintf("Failed to create temporary file: %v", err),
-			Details: CSVErrorDetail{
-				Line:       0,
-				Suggestion: suggestionMap["TEMP_FILE_CREATION_ERROR"],
-			},
-		}
-		return "", []CSVError{copyError}, err
+	return file, nil, nil
+}
+
+// securityValidationError builds the error reported for content that failed the security
+// check, with the line, column and a specific suggestion when the issue is known
+func securityValidationError(validationIssue *helpers.ValidationIssue) CSVError {
+	// Create detailed error with line and column information if available
+	securityError := CSVError{
+		Code:    "SECURITY_VALIDATION_FAILED",
+		Message: "Security validation failed: file contains potentially malicious content",
+		Details: CSVErrorDetail{
+			Line:       0,
+			Suggestion: suggestionMap["SECURITY_VALIDATION_FAILED"],
+		},
 	}
-	// No defer close here since copyFileData will handle closing
 
-	// Copy data to temp file - the validation will happen inside CopyWithMaxSize
-	// Pass context
-	copyErrors, err := s.copyFileData(ctx, file, tempFile, fileHeader.Filename, encoding)
-	if err != nil {
-		return "", copyErrors, err
+	// Use information from validation issue if available
+	if validationIssue != nil {
+		securityError.Details.Line = validationIssue.Line
+		securityError.Details.Column = validationIssue.Column
+		securityError.Details.FoundValue = validationIssue.Value
+
+		// More specific suggestion based on the found pattern
+		if strings.Contains(validationIssue.Pattern, "=") ||
+			strings.Contains(validationIssue.Pattern, "HYPERLINK") ||
+			strings.Contains(validationIssue.Pattern, "IMPORT") {
+			securityError.Details.Suggestion = "Please remove Excel/spreadsheet formulas from the file."
+		} else if strings.Contains(validationIssue.Pattern, "script") ||
+			strings.Contains(validationIssue.Pattern, "javascript") {
+			securityError.Details.Suggestion = "Please remove HTML or JavaScript code from the file."
+		}
 	}
 
-	// Use the logger from context
-	log.Info("Closed temporary file, preparing to import data")
-	return tempFilePath, copyErrors, nil
+	return securityError
 }
 
 // supportedEncodings contains all the encodings that are allowed for CSV files
 var supportedEncodings = []string{"utf-8", "utf8", "utf-16", "utf16"}
 
+// transcodedEncodings maps the non-Unicode encodings that are accepted for CSV files to
+// their decoders. Files in these encodings are transcoded to UTF-8 while they are copied.
+var transcodedEncodings = map[string]encoding.Encoding{
+	"iso-8859-1":   charmap.ISO8859_1,
+	"iso8859-1":    charmap.ISO8859_1,
+	"latin1":       charmap.ISO8859_1,
+	"latin-1":      charmap.ISO8859_1,
+	"iso-8859-15":  charmap.ISO8859_15,
+	"iso8859-15":   charmap.ISO8859_15,
+	"latin9":       charmap.ISO8859_15,
+	"latin-9":      charmap.ISO8859_15,
+	"windows-1252": charmap.Windows1252,
+	"cp1252":       charmap.Windows1252,
+}
+
+// supportedEncodingsMessage lists the accepted encodings in error messages
+const supportedEncodingsMessage = "Supported encodings are: UTF-8, UTF-16, ISO-8859-1 (Latin-1), ISO-8859-15 (Latin-9) and Windows-1252"
+
+// transcodingEncoding returns the decoder for encodings that are transcoded to UTF-8,
+// or nil for UTF-8, UTF-16 and unknown encodings
+func transcodingEncoding(name string) encoding.Encoding {
+	return transcodedEncodings[strings.ToLower(name)]
+}
+
 // isEncodingSupported checks if the given encoding is in the list of supported encodings
 // No logging, no context needed
 func isEncodingSupported(encoding string) bool {
@@ -285,7 +788,7 @@ func isEncodingSupported(encoding string) bool {
 		}
 	}
 
-	return false
+	return transcodingEncoding(encodingLower) != nil
 }
 
 // validateEncodingFromData checks if data has the encoding specified by the user
@@ -301,6 +804,12 @@ func (s *Server) detectDataEncoding(ctx context.Context, data []byte) (string, b
 	result := detector.GetResult()
 
 	if result.Encoding == "" {
+		// The detector gives up on very short inputs and on some escape sequences, data that
+		// is valid UTF-8 is treated as such rather than rejected
+		if utf8.Valid(data) {
+			log.Info("No encoding detected, data is valid UTF-8", slog.Int("bytes", len(data)))
+			return "utf-8", true, false, nil
+		}
 		log.Info("No encoding detected")
 		return "", false, false, fmt.Errorf("could not detect file encoding")
 	}
@@ -329,7 +838,7 @@ func (s *Server) validateUnsupportedEncodingFallback(ctx context.Context, data [
 	}
 
 	log.Info("Unsupported encoding detected", slog.String("encoding", detectedEncoding))
-	return detectedEncoding, false, fmt.Errorf("detected encoding is not supported: %s. Supported encodings are: UTF-8 and UTF-16", detectedEncoding)
+	return detectedEncoding, false, fmt.Errorf("detected encoding is not supported: %s. %s", detectedEncoding, supportedEncodingsMessage)
 }
 
 // validateUTF8UserSpecified validates when user specified UTF-8 or no encoding
@@ -351,28 +860,114 @@ func (s *Server) validateUTF8UserSpecified(ctx context.Context, data []byte, use
 	}
 
 	// Mismatch between specified encoding (UTF-8) and detected encoding
-	log.Info("Encoding mismatch",
-		slog.String("user_specified", userSpecifiedEncoding),
-		slog.String("detected", detectedEncoding),
-	)
-	return fmt.Errorf("file encoding mismatch: you specified %s but detected %s", userSpecifiedEncoding, detectedEncoding)
+	return &encodingMismatchError{declared: userSpecifiedEncoding, detected: detectedEncoding}
 }
 
 // validateUTF16UserSpecified validates when user specified UTF-16
 func (s *Server) validateUTF16UserSpecified(ctx context.Context, userSpecifiedEncoding, detectedEncoding string, isUTF16 bool) error {
-	log := helpers.GetLoggerFromContext(ctx)
-
 	if !isUTF16 {
-		log.Info("Encoding mismatch",
-			slog.String("user_specified", userSpecifiedEncoding),
-			slog.String("detected", detectedEncoding),
-		)
-		return fmt.Errorf("file encoding mismatch: you specified %s but detected %s", userSpecifiedEncoding, detectedEncoding)
+		return &encodingMismatchError{declared: userSpecifiedEncoding, detected: detectedEncoding}
 	}
 
 	return nil
 }
 
+// encodingMismatchError is returned when the file's detected encoding differs from the
+// encoding the client declared
+type encodingMismatchError struct {
+	declared string
+	detected string
+}
+
+func (e *encodingMismatchError) Error() string {
+	return fmt.Sprintf("file encoding mismatch: you specified %s but detected %s", e.declared, e.detected)
+}
+
+// recordEncodingMismatch logs a warning and counts the upload when err is an encoding
+// mismatch, so mislabeled exports can be traced back to the files that carried them
+func (s *Server) recordEncodingMismatch(ctx context.Context, filename string, err error) {
+	var mismatch *encodingMismatchError
+	if !errors.As(err, &mismatch) {
+		return
+	}
+
+	s.encodingMismatches.Add(1)
+	helpers.GetLoggerFromContext(ctx).Warn("Encoding mismatch",
+		slog.String("filename", filename),
+		slog.String("declared", mismatch.declared),
+		slog.String("detected", mismatch.detected),
+	)
+}
+
+// forcedEncoding returns the encoding an upload with force_encoding is read in: the
+// encoding detected from the start of the file when it differs from the declared one and
+// can be read, otherwise the declared encoding. Overrides are logged and counted as
+// encoding mismatches.
+func (s *Server) forcedEncoding(ctx context.Context, fileHeader *multipart.FileHeader, declared string) string {
+	log := helpers.GetLoggerFromContext(ctx)
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		// The upload reports the error when it opens the file again
+		return declared
+	}
+	defer helpers.CloseResources(file, "uploaded file")
+
+	sample := make([]byte, helpers.GetBufferSize())
+	n, err := io.ReadFull(file, sample)
+	switch {
+	case err == nil:
+		// The file goes on, cut the sample after its last complete line so no character is split
+		if i := bytes.LastIndexByte(sample, '\n'); i >= 0 {
+			sample = sample[:i+1]
+		}
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		sample = sample[:n]
+	default:
+		return declared
+	}
+
+	detected, isUTF8, isUTF16, err := s.detectDataEncoding(ctx, sample)
+	if err != nil {
+		return declared
+	}
+	switch {
+	case isUTF8 || utf8.Valid(sample):
+		detected = "utf-8"
+	case isUTF16:
+		detected = "utf-16"
+	case transcodingEncoding(detected) == nil:
+		log.Info("Detected encoding cannot be read, keeping the declared encoding",
+			slog.String("declared", declared),
+			slog.String("detected", detected))
+		return declared
+	}
+
+	if sameEncoding(declared, detected) {
+		return declared
+	}
+	s.recordEncodingMismatch(ctx, fileHeader.Filename, &encodingMismatchError{declared: declared, detected: detected})
+	log.Warn("Overriding declared encoding with force_encoding",
+		slog.String("filename", fileHeader.Filename),
+		slog.String("declared", declared),
+		slog.String("encoding", detected))
+	return detected
+}
+
+// sameEncoding reports whether a declared encoding reads files the same way as a detected
+// utf-8, utf-16 or transcoded encoding
+func sameEncoding(declared, detected string) bool {
+	declared = strings.ToLower(declared)
+	switch detected {
+	case "utf-8":
+		return isUTF8EncodingSpecified(declared)
+	case "utf-16":
+		return isUTF16EncodingSpecified(declared)
+	default:
+		return transcodingEncoding(declared) != nil && transcodingEncoding(declared) == transcodingEncoding(detected)
+	}
+}
+
 // isUTF8EncodingSpecified checks if user specified UTF-8 encoding (including default)
 func isUTF8EncodingSpecified(encoding string) bool {
 	return encoding == "" || encoding == "utf-8" || encoding == "utf8"
@@ -392,7 +987,7 @@ func (s *Server) validateEncodingFromData(ctx context.Context, data []byte, user
 	// Check if user-specified encoding is supported
 	if !isEncodingSupported(userSpecifiedEncoding) {
 		log.Info("Unsupported encoding specified", slog.String("encoding", userSpecifiedEncoding))
-		return fmt.Errorf("unsupported encoding: %s. Supported encodings are: UTF-8 and UTF-16", userSpecifiedEncoding)
+		return fmt.Errorf("unsupported encoding: %s. %s", userSpecifiedEncoding, supportedEncodingsMessage)
 	}
 
 	// If the data is empty, consider it valid
@@ -431,7 +1026,7 @@ func (s *Server) validateEncodingFromData(ctx context.Context, data []byte, user
 // Uses the gabriel-vasile/mimetype library for reliable MIME type detection
 // Returns a slice of CSVError and an error if validation fails
 // Added ctx context.Context
-func (s *Server) validateMimeType(ctx context.Context, fileHeader *multipart.FileHeader) ([]CSVError, error) {
+func (s *Server) validateMimeType(ctx context.Context, fileHeader *multipart.FileHeader, skipRows int, ragged RaggedRows) ([]CSVError, error) {
 	log := helpers.GetLoggerFromContext(ctx) // Retrieve logger
 
 	// Open file for MIME type detection
@@ -479,7 +1074,7 @@ func (s *Server) validateMimeType(ctx context.Context, fileHeader *multipart.Fil
 	// For text-based files, check if content resembles CSV format
 	if strings.HasPrefix(detectedType, "text/") {
 		// Pass context
-		isCSV, err := looksLikeCSV(ctx, file)
+		isCSV, err := looksLikeCSV(ctx, file, skipRows, helpers.GetMinCSVColumns(), ragged)
 		if err != nil {
 			// Use the logger from context
 			log.Info("Error checking CSV format", slog.Any("error", err))
@@ -518,6 +1113,39 @@ func (s *Server) validateMimeType(ctx context.Context, fileHeader *multipart.Fil
 	return []CSVError{validationError}, fmt.Errorf("invalid file format: expected CSV, got %s", detectedType)
 }
 
+// skipMimeValidation reports whether file format validation is disabled through
+// ENV_SKIP_MIME_VALIDATION. The flag is ignored in release mode so production uploads
+// are always validated.
+func skipMimeValidation() bool {
+	return helpers.IsMimeValidationSkipRequested() && gin.Mode() != gin.ReleaseMode
+}
+
+// validateFileExtension checks the uploaded filename against the allowed extensions
+func validateFileExtension(ctx context.Context, filename string) ([]CSVError, error) {
+	log := helpers.GetLoggerFromContext(ctx)
+
+	allowed := helpers.GetAllowedFileExtensions()
+	ext := strings.ToLower(filepath.Ext(filename))
+	if ext != "" && slices.Contains(allowed, ext) {
+		return nil, nil
+	}
+
+	log.Info("Rejected file extension",
+		slog.String("filename", filename),
+		slog.String("extension", ext),
+	)
+	message := fmt.Sprintf("Invalid file extension %q: allowed extensions are %s", ext, strings.Join(allowed, ", "))
+	validationError := CSVError{
+		Code:    "INVALID_FILE_EXTENSION",
+		Message: message,
+		Details: CSVErrorDetail{
+			Line:       0,
+			Suggestion: suggestionMap["INVALID_FILE_EXTENSION"],
+		},
+	}
+	return []CSVError{validationError}, errors.New(message)
+}
+
 // detectFileMimeType detects the MIME type of a file using mimetype library
 // Added ctx context.Context
 func detectFileMimeType(ctx context.Context, file multipart.File) (string, error) {
@@ -546,9 +1174,10 @@ func detectFileMimeType(ctx context.Context, file multipart.File) (string, error
 var detectFileMimeTypeFunc = detectFileMimeType
 
 // looksLikeCSV checks if file content has CSV characteristics
-// Uses the encoding/csv package for validation
+// Uses the encoding/csv package for validation, ignoring the first skipRows lines and
+// requiring at least minColumns columns, with the ragged records ragged tolerates
 // Added ctx context.Context
-func looksLikeCSV(ctx context.Context, file multipart.File) (bool, error) {
+func looksLikeCSV(ctx context.Context, file multipart.File, skipRows, minColumns int, ragged RaggedRows) (bool, error) {
 	log := helpers.GetLoggerFromContext(ctx) // Retrieve logger
 
 	// Reset file position at start
@@ -577,7 +1206,7 @@ func looksLikeCSV(ctx context.Context, file multipart.File) (bool, error) {
 
 	// Use our more robust CSV validation on the data
 	// Note: ValidateCSVFileFromData does not take context, assuming it doesn't log internally
-	result, err := ValidateCSVFileFromData(data[:n])
+	result, err := ValidateCSVFileFromData(skipLeadingLines(data[:n], skipRows), minColumns, ragged)
 	if err != nil {
 		// Use the logger from context
 		log.Info("Error validating CSV structure", slog.Any("error", err))
@@ -585,7 +1214,7 @@ func looksLikeCSV(ctx context.Context, file multipart.File) (bool, error) {
 	}
 
 	// If validation passed, it\'s a valid CSV
-	if result.Valid && result.ColumnCount >= 2 {
+	if result.Valid {
 		return true, nil
 	}
 
@@ -593,6 +1222,32 @@ func looksLikeCSV(ctx context.Context, file multipart.File) (bool, error) {
 	return false, nil
 }
 
+// skipLeadingLines drops the first n lines from data
+func skipLeadingLines(data []byte, n int) []byte {
+	for ; n > 0; n-- {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			return nil
+		}
+		data = data[i+1:]
+	}
+	return data
+}
+
+// splitColumnList flattens column names given as repeated or comma-separated values,
+// dropping blank names
+func splitColumnList(values []string) []string {
+	var columns []string
+	for _, value := range values {
+		for _, column := range strings.Split(value, ",") {
+			if column = strings.TrimSpace(column); column != "" {
+				columns = append(columns, column)
+			}
+		}
+	}
+	return columns
+}
+
 // createTempFileForUpload creates a temporary file for the uploaded CSV
 // Added ctx context.Context
 func (s *Server) createTempFileForUpload(ctx context.Context, tableName string) (string, *os.File, error) {
@@ -616,24 +1271,45 @@ func (s *Server) createTempFileForUpload(ctx context.Context, tableName string)
 	return tempFilePath, tempFile, nil
 }
 
+// uploadDestination is where copyFileData writes an upload: the temporary file it is
+// imported from, or the named pipe of a streamed upload
+type uploadDestination interface {
+	io.WriteCloser
+	Name() string
+}
+
 // copyFileData streams the uploaded file to the temporary file with size validation
+// The first skipRows lines are copied without validation since read_csv skips them, so
+// when hasHeader is set the first line after them is parsed as the header
+// With fullValidation the structure of every record is validated, not only the sample
+// With failOnWarning any validation warning, such as a row skipped in reject_row mode,
+// fails the upload instead of being logged
 // Returns CSV validation errors (if any) and error
 // Added ctx context.Context
-func (s *Server) copyFileData(ctx context.Context, src multipart.File, dst *os.File, filename string, encoding string) ([]CSVError, error) {
+func (s *Server) copyFileData(ctx context.Context, src multipart.File, dst uploadDestination, filename string, hasHeader bool, encoding string, skipRows int, ragged RaggedRows, fullValidation, failOnWarning bool) ([]CSVError, error) {
 	log := helpers.GetLoggerFromContext(ctx) // Retrieve logger
 
 	startTime := time.Now()
+	defer recordUploadPhase(ctx, phaseCopy, startTime)
 
 	// Define a flag to track if we\'ve done encoding and CSV structure validation
 	validatedFileFormat := false
+	skipFormatValidation := skipMimeValidation()
 
 	// Create a wrapper that implements our updated validation function
 	validationWrapper := func(data []byte, lineNumber int, columnMap map[int]string) (bool, *helpers.ValidationIssue, error) {
+		// Report line numbers relative to the uploaded file, including skipped rows
+		if lineNumber > 0 {
+			lineNumber += skipRows
+		}
+
 		// For chunks after the first one, just do security validation
 		if lineNumber > 0 {
 			// This is likely a subsequent chunk in a multiline file
-			// Security validation only
-			return helpers.CSVRowCheckDetailed(data, lineNumber, columnMap)
+			// Security validation only, reporting the issue without an error so the
+			// validation mode decides whether the row rejects the file, is skipped or ignored
+			isSafe, issue, _ := helpers.CSVRowCheckDetailed(data, lineNumber, columnMap)
+			return isSafe, issue, nil
 		}
 
 		// First chunk - do security check first
@@ -642,9 +1318,9 @@ func (s *Server) copyFileData(ctx context.Context, src multipart.File, dst *os.F
 			return false, issue, helpers.ErrInvalidBuffer
 		}
 
-		// If it passes security check but we\'re in a test environment and the file is small,
-		// skip the additional validations
-		if len(data) < 1024 && strings.HasPrefix(filename, "test") {
+		// If it passes security check but format validation was explicitly disabled outside
+		// of release mode, skip the additional validations
+		if skipFormatValidation {
 			return true, nil, nil
 		}
 
@@ -654,13 +1330,17 @@ func (s *Server) copyFileData(ctx context.Context, src multipart.File, dst *os.F
 
 			// Validate encoding directly from data without seeking
 			// Pass context
-			if err := s.validateEncodingFromData(ctx, data, encoding); err != nil {
+			encodingStart := time.Now()
+			err := s.validateEncodingFromData(ctx, data, encoding)
+			recordUploadPhase(ctx, phaseEncodingValidation, encodingStart)
+			if err != nil {
+				s.recordEncodingMismatch(ctx, filename, err)
 				return false, nil, fmt.Errorf("invalid encoding: %w", err)
 			}
 
 			// Validate CSV structure directly from the data
 			// Note: ValidateCSVFileFromData does not take context
-			validationResult, err := ValidateCSVFileFromData(data)
+			validationResult, err := ValidateCSVFileFromData(data, helpers.GetMinCSVColumns(), ragged)
 			if err != nil {
 				return false, nil, fmt.Errorf("CSV validation error: %v", err)
 			}
@@ -690,7 +1370,57 @@ func (s *Server) copyFileData(ctx context.Context, src multipart.File, dst *os.F
 
 	// Stream the file with size validation and content security validation
 	// Pass the wrapped validation function as a callback
-	bytesWritten, validationIssue, err := helpers.CopyWithMaxSize(dst, src, helpers.GetBufferSize(), helpers.GetMaxFileSize(), validationWrapper)
+	maxFileSize := helpers.GetMaxFileSize()
+	var reader io.Reader = src
+	if decoder := transcodingEncoding(encoding); decoder != nil {
+		// DuckDB only reads UTF-8, so the file is decoded while it is copied and the
+		// validation sees the UTF-8 output
+		log.Info("Transcoding file to UTF-8", slog.String("encoding", encoding))
+		reader = transform.NewReader(src, decoder.NewDecoder())
+		encoding = "utf-8"
+	}
+	var skippedBytes int64
+	var err error
+	if skipRows > 0 {
+		buffered := bufio.NewReaderSize(reader, helpers.GetBufferSize())
+		skippedBytes, err = copyLeadingRows(dst, buffered, skipRows, maxFileSize)
+		reader = buffered
+	}
+
+	// With full validation every record written to the temporary file has its structure
+	// checked, not just the sample validated before copying
+	var out io.Writer = dst
+	var structureCheck *structureCheckWriter
+	if fullValidation && err == nil {
+		structureCheck, reader = startFullValidation(dst, reader, skipRows, ragged)
+		out = structureCheck
+	}
+	// Trailing delimiters are dropped before the records are checked and written, so
+	// read_csv sees the columns of the header only
+	var trimmer *trailingDelimiterWriter
+	if ragged.TrimTrailingDelimiter && err == nil {
+		trimmer, reader = startTrailingDelimiterTrim(out, reader)
+		out = trimmer
+	}
+
+	var bytesWritten int64
+	var validationIssue *helpers.ValidationIssue
+	var warnings []string
+	if err == nil {
+		bytesWritten, validationIssue, warnings, err = helpers.CopyWithMaxSize(out, reader, helpers.GetBufferSize(), maxFileSize-skippedBytes, hasHeader, validationWrapper)
+		bytesWritten += skippedBytes
+	}
+	if trimmer != nil && err == nil {
+		err = trimmer.Close()
+	}
+	if structureCheck != nil {
+		if err == nil {
+			err = structureCheck.Close()
+		}
+		if structureCheck.issue != nil {
+			validationIssue = structureCheck.issue
+		}
+	}
 	if err != nil {
 		if err == helpers.ErrMaxFileSizeExceeded {
 			// Use the logger from context
@@ -706,39 +1436,33 @@ func (s *Server) copyFileData(ctx context.Context, src multipart.File, dst *os.F
 			return []CSVError{fileSizeError}, fmt.Errorf("file too large (max %dGB)", helpers.GetMaxFileSize()/(1024*1024*1024))
 		}
 
-		if errors.Is(err, helpers.ErrInvalidBuffer) {
-			// Use the logger from context
-			log.Info("CSV security validation failed",
+		if isDiskFullError(err) {
+			log.Info("Disk full while writing temporary file",
 				slog.String("filename", filename),
+				slog.String("path", dst.Name()),
 				slog.Any("error", err),
 			)
-
-			// Create detailed error with line and column information if available
-			securityError := CSVError{
-				Code:    "SECURITY_VALIDATION_FAILED",
-				Message: "Security validation failed: file contains potentially malicious content",
+			// Free the space taken by the partial file right away rather than after the request
+			removePartialTempFile(ctx, dst)
+			diskFullError := CSVError{
+				Code:    "DISK_FULL",
+				Message: "Not enough disk space to store the uploaded file",
 				Details: CSVErrorDetail{
 					Line:       0,
-					Suggestion: suggestionMap["SECURITY_VALIDATION_FAILED"],
+					Suggestion: suggestionMap["DISK_FULL"],
 				},
 			}
+			return []CSVError{diskFullError}, fmt.Errorf("%w: %v", errDiskFull, err)
+		}
 
-			// Use information from validation issue if available
-			if validationIssue != nil {
-				securityError.Details.Line = validationIssue.Line
-				securityError.Details.Column = validationIssue.Column
-				securityError.Details.FoundValue = validationIssue.Value
-
-				// More specific suggestion based on the found pattern
-				if strings.Contains(validationIssue.Pattern, "=") ||
-					strings.Contains(validationIssue.Pattern, "HYPERLINK") ||
-					strings.Contains(validationIssue.Pattern, "IMPORT") {
-					securityError.Details.Suggestion = "Please remove Excel/spreadsheet formulas from the file."
-				} else if strings.Contains(validationIssue.Pattern, "script") ||
-					strings.Contains(validationIssue.Pattern, "javascript") {
-					securityError.Details.Suggestion = "Please remove HTML or JavaScript code from the file."
-				}
-			}
+		if errors.Is(err, helpers.ErrInvalidBuffer) {
+			// Use the logger from context
+			log.Info("CSV security validation failed",
+				slog.String("filename", filename),
+				slog.Any("error", err),
+			)
+
+			securityError := securityValidationError(validationIssue)
 
 			return []CSVError{securityError}, fmt.Errorf("security validation failed: file contains potentially malicious content")
 		}
@@ -773,6 +1497,26 @@ func (s *Server) copyFileData(ctx context.Context, src multipart.File, dst *os.F
 			return []CSVError{validationError}, err
 		}
 
+		if errors.Is(err, helpers.ErrCellTooLong) {
+			log.Info("CSV cell exceeds maximum length",
+				slog.String("filename", filename),
+				slog.Any("error", err),
+			)
+			validationError := CSVError{
+				Code:    "INVALID_CSV_STRUCTURE",
+				Message: err.Error(),
+				Details: CSVErrorDetail{
+					Line:       0,
+					Suggestion: fmt.Sprintf("Make sure no field is longer than %d bytes, or check for unbalanced quotes.", helpers.GetMaxCellLength()),
+				},
+			}
+			if validationIssue != nil {
+				validationError.Details.Line = validationIssue.Line
+				validationError.Details.Column = validationIssue.Column
+			}
+			return []CSVError{validationError}, err
+		}
+
 		if strings.Contains(err.Error(), "invalid CSV structure") {
 			validationError := CSVError{
 				Code:    "INVALID_CSV_STRUCTURE",
@@ -786,7 +1530,10 @@ func (s *Server) copyFileData(ctx context.Context, src multipart.File, dst *os.F
 			// Parse line number from error message if it\'s the inconsistent columns error
 			if validationIssue != nil && validationIssue.Line > 0 {
 				validationError.Details.Line = validationIssue.Line
-				validationError.Details.Suggestion = "Make sure all rows have the same number of columns."
+				validationError.Details.Suggestion = "Make sure all rows have the same number of columns, or set trim_trailing_delimiter or null_padding for rows ending with an extra delimiter or missing columns."
+				if validationIssue.Pattern == "unterminated quoted field" {
+					validationError.Details.Suggestion = "Make sure every quoted field has a closing quote."
+				}
 			}
 
 			return []CSVError{validationError}, err
@@ -805,6 +1552,14 @@ func (s *Server) copyFileData(ctx context.Context, src multipart.File, dst *os.F
 		return []CSVError{copyError}, fmt.Errorf("internal server error while processing file: %v", err)
 	}
 
+	if failOnWarning && len(warnings) > 0 {
+		log.Info("Validation warnings present, rejecting file",
+			slog.String("filename", filename),
+			slog.Int("warnings", len(warnings)),
+		)
+		return validationWarningErrors(warnings), fmt.Errorf("%d validation warnings present", len(warnings))
+	}
+
 	// Log transfer statistics
 	// Use the logger from context
 	log.Info("Copied total MB", slog.Int64("mb_copied", bytesWritten/BytesInMB))
@@ -822,11 +1577,97 @@ func (s *Server) copyFileData(ctx context.Context, src multipart.File, dst *os.F
 	return nil, nil
 }
 
-// cleanupTempFile removes the temporary file and triggers garbage collection
+// maxWarningErrors caps the number of validation warnings listed in an error response
+const maxWarningErrors = 100
+
+// validationWarningErrors lists validation warnings as VALIDATION_WARNINGS_PRESENT errors,
+// summarizing those beyond maxWarningErrors in a final error
+func validationWarningErrors(warnings []string) []CSVError {
+	listed := warnings[:min(len(warnings), maxWarningErrors)]
+	validationErrors := make([]CSVError, 0, len(listed)+1)
+	for _, warning := range listed {
+		validationErrors = append(validationErrors, CSVError{
+			Code:    "VALIDATION_WARNINGS_PRESENT",
+			Message: warning,
+			Details: CSVErrorDetail{
+				Suggestion: suggestionMap["VALIDATION_WARNINGS_PRESENT"],
+			},
+		})
+	}
+	if omitted := len(warnings) - len(listed); omitted > 0 {
+		validationErrors = append(validationErrors, CSVError{
+			Code:    "VALIDATION_WARNINGS_PRESENT",
+			Message: fmt.Sprintf("%d more validation warnings not listed", omitted),
+			Details: CSVErrorDetail{
+				Suggestion: suggestionMap["VALIDATION_WARNINGS_PRESENT"],
+			},
+		})
+	}
+	return validationErrors
+}
+
+// copyLeadingRows copies the first skipRows lines from src to dst without validation,
+// returning the number of bytes copied
+func copyLeadingRows(dst io.Writer, reader *bufio.Reader, skipRows int, maxSize int64) (int64, error) {
+	var written int64
+	for skipped := 0; skipped < skipRows; {
+		// ReadSlice keeps memory bounded even for huge lines without a newline
+		chunk, err := reader.ReadSlice('\n')
+		if len(chunk) > 0 {
+			n, writeErr := dst.Write(chunk)
+			written += int64(n)
+			if writeErr != nil {
+				return written, writeErr
+			}
+			if written >= maxSize {
+				return written, helpers.ErrMaxFileSizeExceeded
+			}
+		}
+
+		switch {
+		case err == nil:
+			skipped++
+		case errors.Is(err, bufio.ErrBufferFull):
+			// Line continues in the next slice
+		case errors.Is(err, io.EOF):
+			return written, nil
+		default:
+			return written, err
+		}
+	}
+
+	return written, nil
+}
+
+// isDiskFullError reports whether err was caused by the device running out of space
+func isDiskFullError(err error) bool {
+	return errors.Is(err, syscall.ENOSPC) || strings.Contains(err.Error(), "no space left on device")
+}
+
+// removePartialTempFile closes and removes a temporary file whose copy failed
+func removePartialTempFile(ctx context.Context, tempFile uploadDestination) {
+	log := helpers.GetLoggerFromContext(ctx)
+
+	helpers.CloseResources(tempFile, "partial temporary file")
+	if err := os.Remove(tempFile.Name()); err != nil && !os.IsNotExist(err) {
+		log.Info("Warning: Failed to remove partial temporary file",
+			slog.String("path", tempFile.Name()),
+			slog.Any("error", err),
+		)
+	}
+}
+
+// cleanupTempFile removes the temporary file and, for large uploads, triggers garbage collection
 // Added ctx context.Context
 func (s *Server) cleanupTempFile(ctx context.Context, tempFilePath string) {
 	log := helpers.GetLoggerFromContext(ctx) // Retrieve logger
 
+	// Record the file size before removal to decide whether a GC is worth it
+	var fileSize int64
+	if info, err := os.Stat(tempFilePath); err == nil {
+		fileSize = info.Size()
+	}
+
 	// Use the logger from context
 	log.Info("Removing temporary file", slog.String("path", tempFilePath))
 	if err := os.Remove(tempFilePath); err != nil {
@@ -837,10 +1678,51 @@ func (s *Server) cleanupTempFile(ctx context.Context, tempFilePath string) {
 		)
 	}
 
-	// Adding runtime.GC() call helps to reclaim memory after large file operations
-	// Use the logger from context
-	log.Info("Triggering garbage collection to reclaim memory")
+	maybeForceGC(ctx, fileSize)
+}
+
+// gcDebounceInterval is the minimum time between two forced garbage collections
+const gcDebounceInterval = 10 * time.Second
+
+var (
+	// gcMu serializes forced garbage collections across concurrent uploads
+	gcMu sync.Mutex
+	// lastForcedGC records when the last forced garbage collection finished
+	lastForcedGC time.Time
+)
+
+// maybeForceGC triggers a garbage collection to reclaim memory after large file operations.
+// runtime.GC() is a stop-the-world pause, so it is skipped for files below
+// ENV_GC_THRESHOLD_MB and debounced so concurrent uploads don't each trigger one.
+// Returns true if a garbage collection was triggered.
+func maybeForceGC(ctx context.Context, fileSize int64) bool {
+	log := helpers.GetLoggerFromContext(ctx)
+
+	if fileSize < helpers.GetGCThreshold() {
+		return false
+	}
+
+	// Another upload is already collecting, which reclaims our memory as well
+	if !gcMu.TryLock() {
+		log.Info("Skipping garbage collection, already in progress")
+		return false
+	}
+	defer gcMu.Unlock()
+
+	if time.Since(lastForcedGC) < gcDebounceInterval {
+		log.Info("Skipping garbage collection, recently triggered",
+			slog.Time("last_forced_gc", lastForcedGC))
+		return false
+	}
+
+	log.Info("Triggering garbage collection to reclaim memory",
+		slog.Int64("file_size_bytes", fileSize))
+	start := time.Now()
 	runtime.GC()
+	lastForcedGC = time.Now()
+	log.Info("Garbage collection completed", slog.Duration("duration", lastForcedGC.Sub(start)))
+
+	return true
 }
 
 // importCsvData imports the CSV data using the appropriate method
@@ -850,11 +1732,12 @@ func (s *Server) importCsvData(
 	c *gin.Context, // Keep gin context if needed for other purposes
 	tableName, tempFilePath string,
 	hasHeader, override bool,
+	importOptions database.CSVImportOptions,
 ) (*database.QueryResult, int64, map[string]any, error) {
 
 	// Check if table already exists and handle duplicate table scenario
 	if !override {
-		if exists, checkErr := s.checkTableExists(ctx, tableName); checkErr == nil && exists {
+		if exists, checkErr := s.checkTableExists(ctx, importOptions.Schema, tableName); checkErr == nil && exists {
 			// Table already exists and override is false - return helpful error
 			duplicateError := CSVError{
 				Code:    "DUPLICATE_TABLE_NAME",
@@ -879,7 +1762,7 @@ func (s *Server) importCsvData(
 	var importErrors []CSVError
 
 	// Pass context
-	columnsResult, rowCount, importInfo, importErrors, err = s.directImport(ctx, c, tableName, tempFilePath, hasHeader, override)
+	columnsResult, rowCount, importInfo, importErrors, err = s.directImport(ctx, c, tableName, tempFilePath, hasHeader, override, importOptions)
 
 	if err != nil {
 		// Check if this is a duplicate table error that slipped through
@@ -900,8 +1783,20 @@ func (s *Server) importCsvData(
 			return nil, 0, nil, err
 		}
 
+		// Invalid renames are a problem with the request rather than the data, and a
+		// streamed upload can fail validation while it is imported
+		status := http.StatusUnprocessableEntity
+		var copyErr *streamCopyError
+		if errors.Is(err, database.ErrColumnRename) || errors.Is(err, database.ErrColumnSelection) {
+			status = http.StatusBadRequest
+		} else if errors.Is(err, database.ErrTableVersionMismatch) {
+			status = http.StatusPreconditionFailed
+		} else if errors.As(err, &copyErr) {
+			status = copyErrorStatus(copyErr)
+		}
+
 		// Return detailed error response with collected errors
-		c.JSON(http.StatusUnprocessableEntity, CSVErrorResponse{
+		c.JSON(status, CSVErrorResponse{
 			Errors: importErrors,
 		})
 		return nil, 0, nil, err
@@ -917,6 +1812,7 @@ func (s *Server) directImport(
 	c *gin.Context, // Keep gin context if needed
 	tableName, tempFilePath string,
 	hasHeader, override bool,
+	importOptions database.CSVImportOptions,
 ) (*database.QueryResult, int64, map[string]any, []CSVError, error) {
 	log := helpers.GetLoggerFromContext(ctx) // Retrieve logger
 
@@ -925,10 +1821,42 @@ func (s *Server) directImport(
 		slog.String("table", tableName),
 		slog.String("file", tempFilePath),
 	)
-	err := s.db.CreateTableFromCSV(ctx, tableName, tempFilePath, hasHeader, override) // Assuming CreateTableFromCSV does not take context or handles its own logging
+	importStart := time.Now()
+	// Transient failures are retried by the database layer
+	err := s.db.CreateTableFromCSVWithOptions(ctx, tableName, tempFilePath, hasHeader, override, importOptions)
+	recordUploadPhase(ctx, phaseImport, importStart)
 	if err != nil {
 		// Use the logger from context
 		log.Info("Error creating table from CSV with direct import", slog.Any("error", err))
+		var copyErr *streamCopyError
+		if errors.As(err, &copyErr) {
+			return nil, 0, nil, copyErr.errors, err
+		}
+		if errors.Is(err, database.ErrColumnRename) {
+			renameError := CSVError{
+				Code:    "COLUMN_RENAME_ERROR",
+				Message: err.Error(),
+				Details: CSVErrorDetail{
+					Line:       0,
+					Suggestion: suggestionMap["COLUMN_RENAME_ERROR"],
+				},
+			}
+			return nil, 0, nil, []CSVError{renameError}, err
+		}
+		if errors.Is(err, database.ErrColumnSelection) {
+			selectionError := CSVError{
+				Code:    "COLUMN_SELECTION_ERROR",
+				Message: err.Error(),
+				Details: CSVErrorDetail{
+					Line:       0,
+					Suggestion: suggestionMap["COLUMN_SELECTION_ERROR"],
+				},
+			}
+			return nil, 0, nil, []CSVError{selectionError}, err
+		}
+		if errors.Is(err, database.ErrTableVersionMismatch) {
+			return nil, 0, nil, []CSVError{tableVersionMismatchError(tableName)}, err
+		}
 		// Create structured error information
 		importError := CSVError{
 			Code:    "DIRECT_IMPORT_FAILED",
@@ -945,15 +1873,18 @@ func (s *Server) directImport(
 
 	// Get column information
 	// Pass context
-	columnsResult, columnErrors, err := s.getColumnInfo(ctx, c, tableName)
+	qualifiedTableName := database.QualifiedTableName(importOptions.Schema, tableName)
+	columnsResult, columnErrors, err := s.getColumnInfo(ctx, c, qualifiedTableName)
 	if err != nil {
+		s.dropImportedTable(ctx, qualifiedTableName)
 		return nil, 0, nil, columnErrors, err
 	}
 
 	// Count rows
 	// Pass context
-	rowCount, countErrors, err := s.countRows(ctx, c, tableName)
+	rowCount, countErrors, err := s.countRows(ctx, c, qualifiedTableName)
 	if err != nil {
+		s.dropImportedTable(ctx, qualifiedTableName)
 		return nil, 0, nil, countErrors, err
 	}
 
@@ -962,10 +1893,79 @@ func (s *Server) directImport(
 		"import_method": "direct_import",
 	}
 
+	// A type row declares the column names itself, only normalized names can collide.
+	// Selected columns no longer line up with the header.
+	if hasHeader && len(importOptions.ColumnTypes) == 0 && len(importOptions.Columns) == 0 {
+		collisions, collisionErr := s.checkColumnNameCollisions(ctx, tempFilePath, qualifiedTableName, columnsResult, importOptions)
+		if collisionErr != nil {
+			return nil, 0, nil, collisions, collisionErr
+		}
+		if len(collisions) > 0 {
+			importInfo["warnings"] = collisions
+		}
+	}
+
 	return columnsResult, rowCount, importInfo, nil, nil
 }
 
+// checkColumnNameCollisions compares the imported columns with the file's header, returning
+// a COLUMN_NAME_COLLISION warning for each group of header columns that normalize to the
+// same name. When the column counts differ the table is dropped and an error returned.
+func (s *Server) checkColumnNameCollisions(
+	ctx context.Context,
+	tempFilePath, qualifiedTableName string,
+	columnsResult *database.QueryResult,
+	importOptions database.CSVImportOptions,
+) ([]CSVError, error) {
+	log := helpers.GetLoggerFromContext(ctx)
+
+	headerPath := tempFilePath
+	if importOptions.SampleFile != "" {
+		headerPath = importOptions.SampleFile
+	}
+	header, err := readCSVHeader(headerPath, importOptions.SkipRows)
+	if err != nil {
+		// The import succeeded, so an unreadable header only skips the check
+		log.Info("Skipping column name collision check", slog.Any("error", err))
+		return nil, nil
+	}
+
+	imported := make([]string, 0, len(columnsResult.Results))
+	for _, row := range columnsResult.Results {
+		if name, ok := row["name"].(string); ok {
+			imported = append(imported, name)
+		}
+	}
+
+	headerLine := importOptions.SkipRows + 1
+	if len(imported) != len(header) {
+		log.Info("Imported column count does not match the header",
+			slog.Int("header_columns", len(header)),
+			slog.Int("imported_columns", len(imported)),
+		)
+		s.dropImportedTable(ctx, qualifiedTableName)
+		return []CSVError{columnCountMismatchError(header, len(imported), headerLine)},
+			fmt.Errorf("header has %d columns but %d were imported", len(header), len(imported))
+	}
+
+	return columnNameCollisions(header, imported, headerLine), nil
+}
+
+// dropImportedTable drops a table whose import failed after it was created, so no
+// partial table is left behind. qualifiedTableName must already be quoted.
+func (s *Server) dropImportedTable(ctx context.Context, qualifiedTableName string) {
+	log := helpers.GetLoggerFromContext(ctx)
+
+	if _, err := s.db.ExecuteInternalQuery(ctx, fmt.Sprintf("DROP TABLE IF EXISTS %s", qualifiedTableName)); err != nil {
+		log.Error("Error dropping table after failed import",
+			slog.String("table", qualifiedTableName),
+			slog.Any("error", err),
+		)
+	}
+}
+
 // getColumnInfo retrieves column information for the table
+// tableName is embedded as-is, so pass a quoted reference such as database.QualifiedTableName returns
 // Added ctx context.Context
 func (s *Server) getColumnInfo(ctx context.Context, c *gin.Context, tableName string) (*database.QueryResult, []CSVError, error) {
 	log := helpers.GetLoggerFromContext(ctx) // Retrieve logger
@@ -973,7 +1973,7 @@ func (s *Server) getColumnInfo(ctx context.Context, c *gin.Context, tableName st
 	// Use the logger from context
 	log.Info("Retrieving column information", slog.String("table", tableName))
 	query := fmt.Sprintf("PRAGMA table_info(%s)", tableName)
-	columnsResult, err := s.db.ExecuteQuery(ctx, query) // Assuming ExecuteQuery does not take context or handles its own logging
+	columnsResult, err := s.db.ExecuteInternalQuery(ctx, query)
 	if err != nil {
 		// Use the logger from context
 		log.Info("Error getting table info",
@@ -993,14 +1993,19 @@ func (s *Server) getColumnInfo(ctx context.Context, c *gin.Context, tableName st
 	return columnsResult, nil, nil
 }
 
-// checkTableExists checks if a table exists in the database
-func (s *Server) checkTableExists(ctx context.Context, tableName string) (bool, error) {
+// checkTableExists checks if a table exists in the given schema, main when empty
+func (s *Server) checkTableExists(ctx context.Context, schema, tableName string) (bool, error) {
 	log := helpers.GetLoggerFromContext(ctx)
 
-	log.Info("Checking if table exists", slog.String("table", tableName))
-	// Use ExecuteQuery but construct it safely
-	safeQuery := fmt.Sprintf("SELECT COUNT(*) as table_count FROM information_schema.tables WHERE table_schema = 'main' AND table_name = '%s'", tableName)
-	result, err := s.db.ExecuteQuery(ctx, safeQuery)
+	if schema == "" {
+		schema = database.DefaultSchema
+	}
+
+	log.Info("Checking if table exists", slog.String("schema", schema), slog.String("table", tableName))
+	// Sanitized names contain no quotes, so they cannot escape the string literals
+	safeQuery := fmt.Sprintf("SELECT COUNT(*) as table_count FROM information_schema.tables WHERE table_schema = '%s' AND table_name = '%s'",
+		database.SanitizeTableName(schema), tableName)
+	result, err := s.db.ExecuteInternalQuery(ctx, safeQuery)
 	if err != nil {
 		log.Info("Error checking table existence",
 			slog.String("table", tableName),
@@ -1018,6 +2023,7 @@ func (s *Server) checkTableExists(ctx context.Context, tableName string) (bool,
 }
 
 // countRows counts the number of rows in the table
+// tableName is embedded as-is, so pass a quoted reference such as database.QualifiedTableName returns
 // Added ctx context.Context
 func (s *Server) countRows(ctx context.Context, c *gin.Context, tableName string) (int64, []CSVError, error) {
 	log := helpers.GetLoggerFromContext(ctx) // Retrieve logger
@@ -1025,7 +2031,7 @@ func (s *Server) countRows(ctx context.Context, c *gin.Context, tableName string
 	// Use the logger from context
 	log.Info("Counting rows", slog.String("table", tableName))
 	query := fmt.Sprintf("SELECT COUNT(*) as row_count FROM %s", tableName)
-	countResult, err := s.db.ExecuteQuery(ctx, query) // Assuming ExecuteQuery does not take context or handles its own logging
+	countResult, err := s.db.ExecuteInternalQuery(ctx, query)
 	if err != nil {
 		// Use the logger from context
 		log.Info("Error counting rows",
@@ -6,15 +6,22 @@ package api
 import (
 	"bytes"
 	"context"
+	"crypto/md5"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"log/slog"
+	"maps"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"slices"
+	"strings"
 	"testing"
 
 	"github.com/aliengiraffe/spotdb/pkg/database"
+	"github.com/gin-gonic/gin"
 )
 
 // TestUploadEndpointDirect tests the /api/v1/upload endpoint with direct import
@@ -193,8 +200,8 @@ func TestUploadEndpointInvalidMimeType(t *testing.T) {
 	writer.WriteField("override", "false")          // nolint:errcheck
 	writer.WriteField("smart", "false")             // nolint:errcheck
 	writer.WriteField("csv_file_encoding", "utf-8") // nolint:errcheck
-	// File part with non-CSV name and binary data
-	part, err := writer.CreateFormFile("csv_file", "upload.bin")
+	// File part with an allowed extension but binary data
+	part, err := writer.CreateFormFile("csv_file", "upload.csv")
 	if err != nil {
 		t.Fatalf("failed to create form file: %v", err)
 	}
@@ -224,3 +231,951 @@ func TestUploadEndpointInvalidMimeType(t *testing.T) {
 		t.Errorf("unexpected error code: %s", code)
 	}
 }
+
+// TestUploadEndpointSkipRows tests that banner lines before the header are skipped
+func TestUploadEndpointSkipRows(t *testing.T) {
+	s, db := newTablesTestServer(t)
+
+	csvData := []byte("Quarterly sales export\n=== generated by finance ===\nid,amount\n1,10\n2,20\n")
+	tests := []struct {
+		name           string
+		skipRows       string
+		expectedStatus int
+	}{
+		{name: "banner rejected without skip_rows", skipRows: "0", expectedStatus: http.StatusBadRequest},
+		{name: "banner skipped", skipRows: "2", expectedStatus: http.StatusOK},
+		{name: "negative skip_rows", skipRows: "-1", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			fields := map[string]string{
+				"table_name": "banner_sales",
+				"has_header": "true",
+				"override":   "true",
+				"skip_rows":  tc.skipRows,
+			}
+			req := newMultipartRequest(t, "/api/v1/upload", fields, "export.csv", csvData)
+			rec := httptest.NewRecorder()
+			s.Router().ServeHTTP(rec, req)
+
+			if rec.Code != tc.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tc.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if tc.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var resp CSVUploadResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("failed to unmarshal response: %v", err)
+			}
+			if resp.RowCount != 2 {
+				t.Errorf("expected RowCount 2, got %d", resp.RowCount)
+			}
+
+			result, err := db.ExecuteQuery(context.Background(), "SELECT SUM(amount) AS total FROM banner_sales")
+			if err != nil {
+				t.Fatalf("failed to query imported table: %v", err)
+			}
+			if total := fmt.Sprint(result.Results[0]["total"]); total != "30" {
+				t.Errorf("expected total 30, got %s", total)
+			}
+		})
+	}
+}
+
+// TestUploadEndpointLatin1Encoding tests that Latin-1 files are transcoded to UTF-8 on upload
+func TestUploadEndpointLatin1Encoding(t *testing.T) {
+	s, db := newTablesTestServer(t)
+
+	// "José" and "Café" encoded as ISO-8859-1, where é is the single byte 0xE9
+	csvData := []byte("id,city\n1,Jos\xe9\n2,Caf\xe9\n")
+	tests := []struct {
+		name           string
+		encoding       string
+		expectedStatus int
+	}{
+		{name: "latin1 transcoded", encoding: "latin1", expectedStatus: http.StatusOK},
+		{name: "iso-8859-1 transcoded", encoding: "ISO-8859-1", expectedStatus: http.StatusOK},
+		{name: "unknown encoding rejected", encoding: "ebcdic", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			fields := map[string]string{
+				"table_name":        "latin1_people",
+				"has_header":        "true",
+				"override":          "true",
+				"csv_file_encoding": tc.encoding,
+			}
+			req := newMultipartRequest(t, "/api/v1/upload", fields, "people.csv", csvData)
+			rec := httptest.NewRecorder()
+			s.Router().ServeHTTP(rec, req)
+
+			if rec.Code != tc.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tc.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if tc.expectedStatus != http.StatusOK {
+				return
+			}
+
+			result, err := db.ExecuteQuery(context.Background(), "SELECT city FROM latin1_people ORDER BY id")
+			if err != nil {
+				t.Fatalf("failed to query imported table: %v", err)
+			}
+			if len(result.Results) != 2 || result.Results[0]["city"] != "José" || result.Results[1]["city"] != "Café" {
+				t.Errorf("expected cities José and Café, got %v", result.Results)
+			}
+		})
+	}
+}
+
+// TestUploadEndpointForceEncoding tests that force_encoding reads a mislabeled file in its detected encoding
+func TestUploadEndpointForceEncoding(t *testing.T) {
+	s, db := newTablesTestServer(t)
+
+	tests := []struct {
+		name       string
+		encoding   string
+		csvData    []byte
+		mismatches int64
+	}{
+		// Declared UTF-8 but encoded as ISO-8859-1, where é is the single byte 0xE9
+		{name: "latin1 declared as utf-8", encoding: "utf-8", csvData: []byte("id,city\n1,Jos\xe9\n2,Caf\xe9\n"), mismatches: 1},
+		// Declared Latin-1 but encoded as UTF-8, transcoding would double encode é
+		{name: "utf-8 declared as latin1", encoding: "latin1", csvData: []byte("id,city\n1,José\n2,Café\n"), mismatches: 2},
+		{name: "matching encoding", encoding: "utf-8", csvData: []byte("id,city\n1,José\n2,Café\n"), mismatches: 2},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			fields := map[string]string{
+				"table_name":        "forced_people",
+				"has_header":        "true",
+				"override":          "true",
+				"csv_file_encoding": tc.encoding,
+				"force_encoding":    "true",
+			}
+			req := newMultipartRequest(t, "/api/v1/upload", fields, "people.csv", tc.csvData)
+			rec := httptest.NewRecorder()
+			s.Router().ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+			}
+
+			result, err := db.ExecuteQuery(context.Background(), "SELECT city FROM forced_people ORDER BY id")
+			if err != nil {
+				t.Fatalf("failed to query imported table: %v", err)
+			}
+			if len(result.Results) != 2 || result.Results[0]["city"] != "José" || result.Results[1]["city"] != "Café" {
+				t.Errorf("expected cities José and Café, got %v", result.Results)
+			}
+			if got := s.encodingMismatches.Load(); got != tc.mismatches {
+				t.Errorf("expected %d encoding mismatches, got %d", tc.mismatches, got)
+			}
+		})
+	}
+}
+
+func TestUploadEndpointRaggedRows(t *testing.T) {
+	s, db := newTablesTestServer(t)
+
+	tests := []struct {
+		name           string
+		fields         map[string]string
+		csvData        string
+		expectedStatus int
+		expectedRows   string
+	}{
+		{
+			name:           "trailing delimiter rejected by default",
+			fields:         map[string]string{"full_validation": "true"},
+			csvData:        "id,city\n1,Paris,\n2,Lyon\n3,Nice,\n",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "trailing delimiter trimmed",
+			fields:         map[string]string{"full_validation": "true", "trim_trailing_delimiter": "true"},
+			csvData:        "id,city\n1,Paris,\n2,Lyon\n3,Nice,\n",
+			expectedStatus: http.StatusOK,
+			expectedRows:   "1:Paris 2:Lyon 3:Nice",
+		},
+		{
+			name:           "trailing delimiter on the header trimmed",
+			fields:         map[string]string{"trim_trailing_delimiter": "true", "stream": "true"},
+			csvData:        "id,city,\n1,Paris,\n2,Lyon,\n3,Nice,\n",
+			expectedStatus: http.StatusOK,
+			expectedRows:   "1:Paris 2:Lyon 3:Nice",
+		},
+		{
+			name:           "short rows rejected by default",
+			fields:         map[string]string{"full_validation": "true"},
+			csvData:        "id,city\n1,Paris\n2\n3,Nice\n",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "short rows padded",
+			fields:         map[string]string{"full_validation": "true", "null_padding": "true"},
+			csvData:        "id,city\n1,Paris\n2\n3,Nice\n",
+			expectedStatus: http.StatusOK,
+			expectedRows:   "1:Paris 2:<nil> 3:Nice",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			fields := map[string]string{
+				"table_name": "ragged",
+				"has_header": "true",
+				"override":   "true",
+			}
+			maps.Copy(fields, tc.fields)
+			req := newMultipartRequest(t, "/api/v1/upload", fields, "ragged.csv", []byte(tc.csvData))
+			rec := httptest.NewRecorder()
+			s.Router().ServeHTTP(rec, req)
+
+			if rec.Code != tc.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tc.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if tc.expectedStatus != http.StatusOK {
+				return
+			}
+
+			result, err := db.ExecuteQuery(context.Background(), "SELECT * FROM ragged ORDER BY id")
+			if err != nil {
+				t.Fatalf("failed to query imported table: %v", err)
+			}
+			rows := make([]string, len(result.Results))
+			for i, row := range result.Results {
+				if len(row) != 2 {
+					t.Errorf("expected 2 columns, got %v", row)
+				}
+				rows[i] = fmt.Sprintf("%v:%v", row["id"], row["city"])
+			}
+			if got := strings.Join(rows, " "); got != tc.expectedRows {
+				t.Errorf("expected rows %q, got %q", tc.expectedRows, got)
+			}
+		})
+	}
+}
+
+func TestUploadEndpointTypeRow(t *testing.T) {
+	s, db := newTablesTestServer(t)
+
+	tests := []struct {
+		name           string
+		hasHeader      string
+		allVarchar     string
+		csvData        string
+		expectedStatus int
+	}{
+		{name: "type row applied", hasHeader: "true", csvData: "id,zip\nint,string\n1,01234\n2,98765\n", expectedStatus: http.StatusOK},
+		{name: "unknown type rejected", hasHeader: "true", csvData: "id,zip\nint,postcode\n1,01234\n", expectedStatus: http.StatusBadRequest},
+		{name: "requires header", hasHeader: "false", csvData: "id,zip\nint,string\n1,01234\n", expectedStatus: http.StatusBadRequest},
+		{name: "conflicts with all_varchar", hasHeader: "true", allVarchar: "true", csvData: "id,zip\nint,string\n1,01234\n", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			fields := map[string]string{
+				"table_name": "typed_zips",
+				"has_header": tc.hasHeader,
+				"override":   "true",
+				"type_row":   "true",
+			}
+			if tc.allVarchar != "" {
+				fields["all_varchar"] = tc.allVarchar
+			}
+			req := newMultipartRequest(t, "/api/v1/upload", fields, "zips.csv", []byte(tc.csvData))
+			rec := httptest.NewRecorder()
+			s.Router().ServeHTTP(rec, req)
+
+			if rec.Code != tc.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tc.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if tc.expectedStatus != http.StatusOK {
+				if !strings.Contains(rec.Body.String(), "INVALID_TYPE_ROW") {
+					t.Errorf("expected INVALID_TYPE_ROW error, got %s", rec.Body.String())
+				}
+				return
+			}
+
+			result, err := db.ExecuteQuery(context.Background(), "SELECT zip FROM typed_zips ORDER BY id")
+			if err != nil {
+				t.Fatalf("failed to query imported table: %v", err)
+			}
+			if len(result.Results) != 2 || result.Results[0]["zip"] != "01234" {
+				t.Errorf("expected zips read as strings without the type row, got %v", result.Results)
+			}
+		})
+	}
+}
+
+func TestUploadEndpointJSONColumn(t *testing.T) {
+	s, _ := newTablesTestServer(t)
+
+	csvData := "id,payload\nint,json\n1,\"{\"\"city\"\": \"\"Paris\"\", \"\"tags\"\": [1, 2]}\"\n"
+	fields := map[string]string{"table_name": "events", "has_header": "true", "type_row": "true"}
+	req := newMultipartRequest(t, "/api/v1/upload", fields, "events.csv", []byte(csvData))
+	rec := httptest.NewRecorder()
+	s.Router().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+
+	rec = serveJSON(s, http.MethodPost, "/api/v1/query", QueryRequest{Query: "SELECT payload, payload->>'city' AS city FROM events"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	var response struct {
+		Results []struct {
+			Payload struct {
+				City string `json:"city"`
+				Tags []int  `json:"tags"`
+			} `json:"payload"`
+			City string `json:"city"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("expected the JSON column as a nested object: %v: %s", err, rec.Body.String())
+	}
+	if len(response.Results) != 1 || response.Results[0].Payload.City != "Paris" ||
+		len(response.Results[0].Payload.Tags) != 2 || response.Results[0].City != "Paris" {
+		t.Errorf("unexpected results %s", rec.Body.String())
+	}
+}
+
+func TestUploadEndpointAnalyze(t *testing.T) {
+	tests := []struct {
+		name         string
+		threshold    string
+		analyze      string
+		wantAnalyzed bool
+	}{
+		{name: "below the default threshold", wantAnalyzed: false},
+		{name: "threshold reached", threshold: "3", wantAnalyzed: true},
+		{name: "threshold not reached", threshold: "4", wantAnalyzed: false},
+		{name: "disabled threshold", threshold: "0", wantAnalyzed: false},
+		{name: "requested", threshold: "0", analyze: "true", wantAnalyzed: true},
+		{name: "skipped", threshold: "1", analyze: "false", wantAnalyzed: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("ENV_AUTO_ANALYZE_THRESHOLD", tt.threshold)
+			s, _ := newTablesTestServer(t)
+
+			fields := map[string]string{"table_name": "events", "has_header": "true"}
+			if tt.analyze != "" {
+				fields["analyze"] = tt.analyze
+			}
+			req := newMultipartRequest(t, "/api/v1/upload", fields, "events.csv", []byte("id,kind\n1,a\n2,b\n3,c\n"))
+			rec := httptest.NewRecorder()
+			s.Router().ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+			}
+
+			var response CSVUploadResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+				t.Fatalf("failed to parse response: %v", err)
+			}
+			if analyzed, _ := response.Import["analyzed"].(bool); analyzed != tt.wantAnalyzed {
+				t.Errorf("expected analyzed %v, got %v", tt.wantAnalyzed, response.Import["analyzed"])
+			}
+			if (response.Timings.AnalyzeMs > 0) && !tt.wantAnalyzed {
+				t.Errorf("expected no analyze timing, got %v", response.Timings.AnalyzeMs)
+			}
+		})
+	}
+}
+
+func TestUploadEndpointAllVarchar(t *testing.T) {
+	s, db := newTablesTestServer(t)
+
+	fields := map[string]string{
+		"table_name":  "raw_zips",
+		"has_header":  "true",
+		"all_varchar": "true",
+	}
+	req := newMultipartRequest(t, "/api/v1/upload", fields, "zips.csv", []byte("id,zip\n1,01234\n2,98765\n"))
+	rec := httptest.NewRecorder()
+	s.Router().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+
+	result, err := db.ExecuteQuery(context.Background(), "SELECT id, zip FROM raw_zips ORDER BY id")
+	if err != nil {
+		t.Fatalf("failed to query imported table: %v", err)
+	}
+	if len(result.Results) != 2 || result.Results[0]["id"] != "1" || result.Results[0]["zip"] != "01234" {
+		t.Errorf("expected all columns read as strings, got %v", result.Results)
+	}
+}
+
+func TestUploadEndpointTimings(t *testing.T) {
+	s, _ := newTablesTestServer(t)
+
+	fields := map[string]string{"table_name": "timed", "has_header": "true"}
+	req := newMultipartRequest(t, "/api/v1/upload", fields, "timed.csv", []byte("id,city\n1,Paris\n2,Lyon\n"))
+	rec := httptest.NewRecorder()
+	s.Router().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+
+	var response CSVUploadResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	timings := response.Timings
+	if timings.CopyMs <= 0 || timings.ImportMs <= 0 {
+		t.Errorf("expected copy and import timings, got %+v", timings)
+	}
+	if timings.TotalMs < timings.FileValidationMs+timings.CopyMs+timings.ImportMs {
+		t.Errorf("expected the total to cover every phase, got %+v", timings)
+	}
+}
+
+// TestUploadEndpointSchema tests uploading into per-tenant schemas
+func TestUploadEndpointSchema(t *testing.T) {
+	// The seeded main.sales table must not clash with tenant tables of the same name
+	s, db := newTablesTestServer(t)
+
+	tests := []struct {
+		name           string
+		schema         string
+		csvData        string
+		expectedStatus int
+		expectedCode   string
+	}{
+		{name: "upload into tenant_a", schema: "tenant_a", csvData: "id,amount\n1,10\n", expectedStatus: http.StatusOK},
+		{name: "upload into tenant_b", schema: "tenant_b", csvData: "id,amount\n1,10\n2,20\n", expectedStatus: http.StatusOK},
+		{name: "duplicate within schema", schema: "tenant_a", csvData: "id,amount\n1,10\n", expectedStatus: http.StatusUnprocessableEntity, expectedCode: "DUPLICATE_TABLE_NAME"},
+		{name: "invalid schema name", schema: "1tenant", csvData: "id,amount\n1,10\n", expectedStatus: http.StatusBadRequest, expectedCode: "INVALID_SCHEMA_NAME"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			fields := map[string]string{
+				"table_name": "sales",
+				"schema":     tc.schema,
+				"has_header": "true",
+			}
+			req := newMultipartRequest(t, "/api/v1/upload", fields, "test.csv", []byte(tc.csvData))
+			rec := httptest.NewRecorder()
+			s.Router().ServeHTTP(rec, req)
+
+			if rec.Code != tc.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tc.expectedStatus, rec.Code, rec.Body.String())
+			}
+
+			if tc.expectedCode != "" {
+				var resp CSVErrorResponse
+				if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+					t.Fatalf("failed to unmarshal response: %v", err)
+				}
+				if len(resp.Errors) != 1 || resp.Errors[0].Code != tc.expectedCode {
+					t.Errorf("expected %s, got %v", tc.expectedCode, resp.Errors)
+				}
+				return
+			}
+
+			var resp CSVUploadResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("failed to unmarshal response: %v", err)
+			}
+			if resp.Schema != tc.schema {
+				t.Errorf("expected schema %q, got %q", tc.schema, resp.Schema)
+			}
+			if len(resp.Columns) != 2 {
+				t.Errorf("expected 2 columns, got %d", len(resp.Columns))
+			}
+		})
+	}
+
+	counts := map[string]string{"main": "3", "tenant_a": "1", "tenant_b": "2"}
+	for schema, expected := range counts {
+		result, err := db.ExecuteQuery(context.Background(), fmt.Sprintf("SELECT COUNT(*) AS total FROM %s.sales", schema))
+		if err != nil {
+			t.Fatalf("failed to query %s.sales: %v", schema, err)
+		}
+		if total := fmt.Sprint(result.Results[0]["total"]); total != expected {
+			t.Errorf("expected %s rows in %s.sales, got %s", expected, schema, total)
+		}
+	}
+}
+
+func TestUploadEndpointReservedWordTableName(t *testing.T) {
+	s, _ := newTablesTestServer(t)
+
+	for _, tableName := range []string{"order", "select"} {
+		t.Run(tableName, func(t *testing.T) {
+			fields := map[string]string{
+				"table_name": tableName,
+				"schema":     "group",
+				"has_header": "true",
+			}
+			req := newMultipartRequest(t, "/api/v1/upload", fields, "test.csv", []byte("id,amount\n1,10\n2,20\n"))
+			rec := httptest.NewRecorder()
+			s.Router().ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+			}
+
+			var resp CSVUploadResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("failed to unmarshal response: %v", err)
+			}
+			if len(resp.Columns) != 2 {
+				t.Errorf("expected 2 columns, got %d", len(resp.Columns))
+			}
+			if resp.RowCount != 2 {
+				t.Errorf("expected 2 rows, got %d", resp.RowCount)
+			}
+		})
+	}
+
+	rec := serveJSON(s, http.MethodPost, "/api/v1/tables", map[string]any{
+		"table_name": "table",
+		"query":      "SELECT * FROM sales",
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d creating reserved-word table, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+}
+
+// TestUploadEndpointNoTestFilenameBypass tests that files named test* are validated like any other
+func TestUploadEndpointNoTestFilenameBypass(t *testing.T) {
+	binary := []byte{0x00, 0x01, 0x02, 0x03}
+
+	tests := []struct {
+		name         string
+		serverMode   string
+		skipMime     string
+		filename     string
+		content      []byte
+		expectedCode string
+	}{
+		{name: "test.bin rejected in release mode", serverMode: gin.ReleaseMode, filename: "test.bin", content: binary, expectedCode: "INVALID_FILE_EXTENSION"},
+		{name: "test.csv with binary content rejected in release mode", serverMode: gin.ReleaseMode, filename: "test.csv", content: binary, expectedCode: "INVALID_FILE_FORMAT"},
+		{name: "skip flag ignored in release mode", serverMode: gin.ReleaseMode, skipMime: "true", filename: "test.bin", content: binary, expectedCode: "INVALID_FILE_EXTENSION"},
+		{name: "file without extension rejected", serverMode: gin.ReleaseMode, filename: "test", content: []byte("id\n1\n"), expectedCode: "INVALID_FILE_EXTENSION"},
+		{name: "skip flag honored in debug mode", serverMode: gin.DebugMode, skipMime: "true", filename: "test.bin", content: []byte("id,amount\n1,10\n")},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("ENV_SERVER_MODE", tc.serverMode)
+			t.Setenv("ENV_SKIP_MIME_VALIDATION", tc.skipMime)
+			t.Cleanup(func() { gin.SetMode(gin.ReleaseMode) })
+
+			s, _ := newTablesTestServer(t)
+			fields := map[string]string{"table_name": "bypass_check", "has_header": "true", "override": "true"}
+			req := newMultipartRequest(t, "/api/v1/upload", fields, tc.filename, tc.content)
+			rec := httptest.NewRecorder()
+			s.Router().ServeHTTP(rec, req)
+
+			if tc.expectedCode == "" {
+				if rec.Code != http.StatusOK {
+					t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+				}
+				return
+			}
+
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("expected status 400, got %d: %s", rec.Code, rec.Body.String())
+			}
+			var resp CSVErrorResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("failed to unmarshal error response: %v", err)
+			}
+			if len(resp.Errors) == 0 || resp.Errors[0].Code != tc.expectedCode {
+				t.Errorf("expected %s, got %v", tc.expectedCode, resp.Errors)
+			}
+		})
+	}
+}
+
+// TestUploadEndpointAllowedExtensions tests that the allowed extension list is configurable
+func TestUploadEndpointAllowedExtensions(t *testing.T) {
+	t.Setenv("ENV_ALLOWED_FILE_EXTENSIONS", ".psv")
+	s, _ := newTablesTestServer(t)
+
+	for filename, expectedStatus := range map[string]int{"data.psv": http.StatusOK, "data.csv": http.StatusBadRequest} {
+		fields := map[string]string{"table_name": "extensions", "has_header": "true", "override": "true"}
+		req := newMultipartRequest(t, "/api/v1/upload", fields, filename, []byte("id|amount\n1|10\n"))
+		rec := httptest.NewRecorder()
+		s.Router().ServeHTTP(rec, req)
+
+		if rec.Code != expectedStatus {
+			t.Errorf("%s: expected status %d, got %d: %s", filename, expectedStatus, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestUploadEndpointFullValidation(t *testing.T) {
+	s, _ := newTablesTestServer(t)
+
+	// The malformed row lies far beyond the sample validated up front
+	var csvData strings.Builder
+	csvData.WriteString("id,city\n")
+	for i := 1; i <= 5000; i++ {
+		fmt.Fprintf(&csvData, "%d,City %d\n", i, i)
+	}
+	csvData.WriteString("5001,Paris,extra\n")
+
+	fields := map[string]string{
+		"table_name":      "strict_cities",
+		"has_header":      "true",
+		"full_validation": "true",
+	}
+	req := newMultipartRequest(t, "/api/v1/upload", fields, "cities.csv", []byte(csvData.String()))
+	rec := httptest.NewRecorder()
+	s.Router().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusBadRequest, rec.Code, rec.Body.String())
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, "INVALID_CSV_STRUCTURE") || !strings.Contains(body, `"line":5002`) {
+		t.Errorf("expected INVALID_CSV_STRUCTURE on line 5002, got %s", body)
+	}
+}
+
+func TestUploadEndpointFailOnWarning(t *testing.T) {
+	t.Setenv("ENV_FILE_VALIDATION_MODE", "reject_row")
+	s, db := newTablesTestServer(t)
+	csvData := []byte("id,note\n1,fine\n2,=HYPERLINK(\"http://example.com\")\n3,also fine\n")
+
+	t.Run("skips the row without fail_on_warning", func(t *testing.T) {
+		fields := map[string]string{"table_name": "lenient_notes", "has_header": "true"}
+		req := newMultipartRequest(t, "/api/v1/upload", fields, "notes.csv", csvData)
+		rec := httptest.NewRecorder()
+		s.Router().ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+		}
+
+		result, err := db.ExecuteQuery(context.Background(), "SELECT COUNT(*) AS n FROM lenient_notes")
+		if err != nil {
+			t.Fatalf("failed to count rows: %v", err)
+		}
+		if n := fmt.Sprint(result.Results[0]["n"]); n != "2" {
+			t.Errorf("expected the suspicious row to be skipped, got %s rows", n)
+		}
+	})
+
+	t.Run("fails with fail_on_warning", func(t *testing.T) {
+		fields := map[string]string{"table_name": "strict_notes", "has_header": "true", "fail_on_warning": "true"}
+		req := newMultipartRequest(t, "/api/v1/upload", fields, "notes.csv", csvData)
+		rec := httptest.NewRecorder()
+		s.Router().ServeHTTP(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusBadRequest, rec.Code, rec.Body.String())
+		}
+		body := rec.Body.String()
+		if !strings.Contains(body, "VALIDATION_WARNINGS_PRESENT") || !strings.Contains(body, "line 3") {
+			t.Errorf("expected VALIDATION_WARNINGS_PRESENT for line 3, got %s", body)
+		}
+
+		if _, err := db.ExecuteQuery(context.Background(), "SELECT * FROM strict_notes"); err == nil {
+			t.Error("expected the table not to be created")
+		}
+	})
+}
+
+func TestUploadEndpointRenameColumns(t *testing.T) {
+	s, db := newTablesTestServer(t)
+	csvData := []byte("id,First Name,zip\n1,Ada,01234\n")
+
+	t.Run("renames columns", func(t *testing.T) {
+		fields := map[string]string{
+			"table_name":                 "people",
+			"has_header":                 "true",
+			"rename_columns[first_name]": "given_name",
+			"rename_columns[zip]":        "postal_code",
+		}
+		req := newMultipartRequest(t, "/api/v1/upload", fields, "people.csv", csvData)
+		rec := httptest.NewRecorder()
+		s.Router().ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+		}
+
+		if _, err := db.ExecuteQuery(context.Background(), "SELECT given_name, postal_code FROM people"); err != nil {
+			t.Errorf("expected renamed columns: %v", err)
+		}
+	})
+
+	t.Run("conflicting names", func(t *testing.T) {
+		fields := map[string]string{
+			"table_name":         "people_conflict",
+			"has_header":         "true",
+			"rename_columns[id]": "zip",
+		}
+		req := newMultipartRequest(t, "/api/v1/upload", fields, "people.csv", csvData)
+		rec := httptest.NewRecorder()
+		s.Router().ServeHTTP(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusBadRequest, rec.Code, rec.Body.String())
+		}
+		if !strings.Contains(rec.Body.String(), "COLUMN_RENAME_ERROR") {
+			t.Errorf("expected COLUMN_RENAME_ERROR, got %s", rec.Body.String())
+		}
+	})
+}
+
+func TestUploadEndpointSelectColumns(t *testing.T) {
+	s, db := newTablesTestServer(t)
+	csvData := []byte("id,First Name,SSN,zip\n1,Ada,123-45-6789,01234\n")
+
+	t.Run("keeps the listed columns", func(t *testing.T) {
+		fields := map[string]string{
+			"table_name":                 "people",
+			"has_header":                 "true",
+			"columns":                    "id, first_name",
+			"rename_columns[first_name]": "given_name",
+		}
+		req := newMultipartRequest(t, "/api/v1/upload", fields, "people.csv", csvData)
+		rec := httptest.NewRecorder()
+		s.Router().ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+		}
+
+		result, err := db.ExecuteQuery(context.Background(), "SELECT * FROM people")
+		if err != nil {
+			t.Fatalf("failed to query table: %v", err)
+		}
+		if !slices.Equal(result.Columns, []string{"id", "given_name"}) {
+			t.Errorf("expected columns id, given_name, got %v", result.Columns)
+		}
+	})
+
+	t.Run("unknown column", func(t *testing.T) {
+		fields := map[string]string{
+			"table_name": "people_unknown",
+			"has_header": "true",
+			"columns":    "id,email",
+		}
+		req := newMultipartRequest(t, "/api/v1/upload", fields, "people.csv", csvData)
+		rec := httptest.NewRecorder()
+		s.Router().ServeHTTP(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusBadRequest, rec.Code, rec.Body.String())
+		}
+		if !strings.Contains(rec.Body.String(), "COLUMN_SELECTION_ERROR") {
+			t.Errorf("expected COLUMN_SELECTION_ERROR, got %s", rec.Body.String())
+		}
+	})
+}
+
+func TestUploadEndpointColumnNameCollision(t *testing.T) {
+	s, db := newTablesTestServer(t)
+	csvData := []byte("id,First Name,first_name,age\n1,Ada,ada,36\n")
+
+	fields := map[string]string{"table_name": "collided", "has_header": "true"}
+	req := newMultipartRequest(t, "/api/v1/upload", fields, "collided.csv", csvData)
+	rec := httptest.NewRecorder()
+	s.Router().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+
+	var response struct {
+		Import struct {
+			Warnings []CSVError `json:"warnings"`
+		} `json:"import"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	warnings := response.Import.Warnings
+	if len(warnings) != 1 || warnings[0].Code != "COLUMN_NAME_COLLISION" {
+		t.Fatalf("expected one COLUMN_NAME_COLLISION warning, got %+v", warnings)
+	}
+	if warnings[0].Details.Column != "'First Name', 'first_name'" {
+		t.Errorf("expected the colliding originals, got %q", warnings[0].Details.Column)
+	}
+	if !strings.Contains(warnings[0].Message, "'first_name', 'first_name_1'") {
+		t.Errorf("expected the imported names in the message, got %q", warnings[0].Message)
+	}
+
+	if _, err := db.ExecuteQuery(context.Background(), "SELECT first_name, first_name_1 FROM collided"); err != nil {
+		t.Errorf("expected both columns to be imported: %v", err)
+	}
+}
+
+func TestUploadEndpointChecksum(t *testing.T) {
+	s, _ := newTablesTestServer(t)
+	csvData := []byte("id,name,score\n1,Ada,9.5\n2,,7\n")
+
+	upload := func(t *testing.T, fields map[string]string) CSVUploadResponse {
+		t.Helper()
+		req := newMultipartRequest(t, "/api/v1/upload", fields, "scores.csv", csvData)
+		rec := httptest.NewRecorder()
+		s.Router().ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+		}
+
+		var response CSVUploadResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatalf("failed to parse response: %v", err)
+		}
+		return response
+	}
+
+	t.Run("returns the checksum when requested", func(t *testing.T) {
+		response := upload(t, map[string]string{"table_name": "scores", "has_header": "true", "checksum": "true"})
+
+		sum := md5.Sum([]byte("1\tAda\t9.5\n2\t\t7.0"))
+		if want := hex.EncodeToString(sum[:]); response.Checksum != want {
+			t.Errorf("expected checksum %s, got %s", want, response.Checksum)
+		}
+	})
+
+	t.Run("omits the checksum by default", func(t *testing.T) {
+		response := upload(t, map[string]string{"table_name": "scores_plain", "has_header": "true"})
+		if response.Checksum != "" || response.Timings.ChecksumMs != 0 {
+			t.Errorf("expected no checksum, got %q", response.Checksum)
+		}
+	})
+}
+
+func TestUploadEndpointPostImportQuery(t *testing.T) {
+	s, db := newTablesTestServer(t)
+	csvData := []byte("id,person\n1, Ada \n2,\n3,Grace\n")
+
+	upload := func(t *testing.T, table, query string) CSVUploadResponse {
+		t.Helper()
+		fields := map[string]string{"table_name": table, "has_header": "true", "post_import_query": query}
+		req := newMultipartRequest(t, "/api/v1/upload", fields, "people.csv", csvData)
+		rec := httptest.NewRecorder()
+		s.Router().ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+		}
+
+		var response CSVUploadResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatalf("failed to parse response: %v", err)
+		}
+		return response
+	}
+
+	t.Run("runs the query on the imported table", func(t *testing.T) {
+		response := upload(t, "people", "DELETE FROM people WHERE person IS NULL; ALTER TABLE people ADD COLUMN cleaned VARCHAR; "+
+			"UPDATE people SET cleaned = trim(person); SELECT cleaned FROM people ORDER BY id")
+
+		result := response.PostImportQuery
+		if result == nil || result.Status != "success" {
+			t.Fatalf("expected a successful post-import query, got %+v", result)
+		}
+		if result.RowCount != 2 || result.Results[0]["cleaned"] != "Ada" || result.Results[1]["cleaned"] != "Grace" {
+			t.Errorf("unexpected results: %v", result.Results)
+		}
+		if response.RowCount != 3 {
+			t.Errorf("expected the import row count to be reported, got %d", response.RowCount)
+		}
+	})
+
+	t.Run("reports a query outside the table as a partial success", func(t *testing.T) {
+		response := upload(t, "people_scoped", "SELECT * FROM sales")
+
+		result := response.PostImportQuery
+		if result == nil || result.Status != "error" || result.Code != "QUERY_OUT_OF_SCOPE" {
+			t.Fatalf("expected an out of scope error, got %+v", result)
+		}
+
+		// The import itself succeeded
+		count, err := db.ExecuteQuery(context.Background(), "SELECT COUNT(*) AS total FROM people_scoped")
+		if err != nil {
+			t.Fatalf("expected the table to be imported: %v", err)
+		}
+		if total := count.Results[0]["total"]; total != int64(3) {
+			t.Errorf("expected 3 imported rows, got %v", total)
+		}
+	})
+
+	t.Run("reports a failing query", func(t *testing.T) {
+		response := upload(t, "people_failing", "SELECT missing_column FROM people_failing")
+
+		result := response.PostImportQuery
+		if result == nil || result.Status != "error" || result.Code != "POST_IMPORT_QUERY_FAILED" {
+			t.Fatalf("expected a failed query, got %+v", result)
+		}
+	})
+}
+
+func TestUploadEndpointIfMatch(t *testing.T) {
+	s, db := newTablesTestServer(t)
+
+	upload := func(t *testing.T, override bool, ifMatch, csvData string) *httptest.ResponseRecorder {
+		t.Helper()
+		fields := map[string]string{"table_name": "orders", "has_header": "true"}
+		if override {
+			fields["override"] = "true"
+		}
+		req := newMultipartRequest(t, "/api/v1/upload", fields, "orders.csv", []byte(csvData))
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		rec := httptest.NewRecorder()
+		s.Router().ServeHTTP(rec, req)
+		return rec
+	}
+	expectMismatch := func(t *testing.T, rec *httptest.ResponseRecorder) {
+		t.Helper()
+		if rec.Code != http.StatusPreconditionFailed {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusPreconditionFailed, rec.Code, rec.Body.String())
+		}
+		var response CSVErrorResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatalf("failed to parse response: %v", err)
+		}
+		if len(response.Errors) != 1 || response.Errors[0].Code != "TABLE_VERSION_MISMATCH" {
+			t.Errorf("expected TABLE_VERSION_MISMATCH, got %+v", response.Errors)
+		}
+	}
+
+	// A table that does not exist has no version to match
+	expectMismatch(t, upload(t, true, "*", "id\n1\n"))
+
+	rec := upload(t, false, "", "id\n1\n")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	first := rec.Header().Get("ETag")
+	if first == "" {
+		t.Fatal("expected an ETag on the upload response")
+	}
+
+	head := httptest.NewRecorder()
+	s.Router().ServeHTTP(head, httptest.NewRequest(http.MethodHead, "/api/v1/tables/orders", nil))
+	if head.Header().Get("ETag") != first {
+		t.Errorf("expected HEAD to return ETag %q, got %q", first, head.Header().Get("ETag"))
+	}
+
+	rec = upload(t, true, first, "id\n1\n2\n")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	second := rec.Header().Get("ETag")
+	if second == "" || second == first {
+		t.Fatalf("expected a new ETag after replacing the table, got %q", second)
+	}
+
+	// Another client replaced the table since the first version was read
+	expectMismatch(t, upload(t, true, first, "id\n3\n"))
+
+	result, err := db.ExecuteQuery(context.Background(), "SELECT COUNT(*) AS n FROM orders")
+	if err != nil || result.Results[0]["n"] != int64(2) {
+		t.Errorf("expected the table to keep 2 rows, got %v, %v", result, err)
+	}
+}
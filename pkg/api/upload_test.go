@@ -4,14 +4,17 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strings"
+	"syscall"
 	"testing"
 	"time"
 
@@ -31,6 +34,9 @@ func TestUploadIsEncodingSupported(t *testing.T) {
 		{"utf-8", true},
 		{"UTF16", true},
 		{"utf8", true},
+		{"latin1", true},
+		{"ISO-8859-1", true},
+		{"windows-1252", true},
 		{"utf-7", false},
 		{"ascii", false},
 	}
@@ -65,7 +71,7 @@ func TestUploadValidateMimeTypeTextCsvValid(t *testing.T) {
 	fh := req.MultipartForm.File["csv_file"][0]
 	s := &Server{}
 	ctx := context.Background()
-	errs, err := s.validateMimeType(ctx, fh)
+	errs, err := s.validateMimeType(ctx, fh, 0, RaggedRows{})
 	if err != nil {
 		t.Errorf("validateMimeType returned error: %v", err)
 	}
@@ -101,7 +107,7 @@ func TestUploadValidateMimeTypeDetectError(t *testing.T) {
 	}
 	s := &Server{}
 	ctx := context.Background()
-	errs, err := s.validateMimeType(ctx, fh)
+	errs, err := s.validateMimeType(ctx, fh, 0, RaggedRows{})
 	if err == nil {
 		t.Error("expected error for MIME detection failure, got nil")
 	}
@@ -111,7 +117,10 @@ func TestUploadValidateMimeTypeDetectError(t *testing.T) {
 }
 
 // TestUploadValidateMimeTypeTextNotCsv tests text/* MIME type that does not resemble CSV
+// when at least two columns are required
 func TestUploadValidateMimeTypeTextNotCsv(t *testing.T) {
+	t.Setenv("ENV_MIN_CSV_COLUMNS", "2")
+
 	// Create multipart form with .txt and non-CSV content
 	buf := &bytes.Buffer{}
 	writer := multipart.NewWriter(buf)
@@ -132,7 +141,7 @@ func TestUploadValidateMimeTypeTextNotCsv(t *testing.T) {
 	fh := req.MultipartForm.File["csv_file"][0]
 	s := &Server{}
 	ctx := context.Background()
-	errs, err := s.validateMimeType(ctx, fh)
+	errs, err := s.validateMimeType(ctx, fh, 0, RaggedRows{})
 	if err == nil {
 		t.Errorf("expected invalid file format error, got nil")
 	}
@@ -141,11 +150,37 @@ func TestUploadValidateMimeTypeTextNotCsv(t *testing.T) {
 	}
 }
 
+// TestUploadValidateMimeTypeTextSingleColumn tests text/* MIME type with a single column
+// passes with the default minimum column count
+func TestUploadValidateMimeTypeTextSingleColumn(t *testing.T) {
+	buf := &bytes.Buffer{}
+	writer := multipart.NewWriter(buf)
+	part, err := writer.CreateFormFile("csv_file", "ids.txt")
+	if err != nil {
+		t.Fatalf("CreateFormFile failed: %v", err)
+	}
+	if _, err := part.Write([]byte("id\n1001\n1002\n1003\n")); err != nil {
+		t.Fatalf("failed to write data: %v", err)
+	}
+	writer.Close()
+	req := httptest.NewRequest(http.MethodPost, "/", buf)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	if err := req.ParseMultipartForm(int64(len(buf.Bytes()))); err != nil {
+		t.Fatalf("ParseMultipartForm failed: %v", err)
+	}
+	fh := req.MultipartForm.File["csv_file"][0]
+	s := &Server{}
+	errs, err := s.validateMimeType(context.Background(), fh, 0, RaggedRows{})
+	if err != nil || len(errs) != 0 {
+		t.Errorf("expected single column file to pass, got err=%v errs=%v", err, errs)
+	}
+}
+
 // TestUploadProcessCsvFileFromHeaderUnsupportedEncoding tests unsupported encoding path
 func TestUploadProcessCsvFileFromHeaderUnsupportedEncoding(t *testing.T) {
 	s := &Server{}
 	ctx := context.Background()
-	tempPath, errs, err := s.processCsvFileFromHeader(ctx, nil, "table", true, "latin1")
+	tempPath, errs, err := s.processCsvFileFromHeader(ctx, nil, "table", true, "ebcdic", 0, RaggedRows{}, false, false)
 	if err == nil {
 		t.Error("expected error for unsupported encoding, got nil")
 	}
@@ -164,11 +199,11 @@ func TestUploadCopyFileDataErrorMapping(t *testing.T) {
 	orig := helpers.CopyWithMaxSize
 	defer func() { helpers.CopyWithMaxSize = orig }()
 	// CSV validation error
-	helpers.CopyWithMaxSize = func(dst io.Writer, src io.Reader, bufferSize int, maxSize int64, vf helpers.BufferValidationFunc) (int64, *helpers.ValidationIssue, error) {
-		return 0, nil, fmt.Errorf("CSV validation error: parse failed")
+	helpers.CopyWithMaxSize = func(dst io.Writer, src io.Reader, bufferSize int, maxSize int64, hasHeader bool, vf helpers.BufferValidationFunc) (int64, *helpers.ValidationIssue, []string, error) {
+		return 0, nil, nil, fmt.Errorf("CSV validation error: parse failed")
 	}
 	ctx := context.Background()
-	errs, err := s.copyFileData(ctx, nil, nil, "file.csv", "")
+	errs, err := s.copyFileData(ctx, nil, nil, "file.csv", true, "", 0, RaggedRows{}, false, false)
 	if err == nil {
 		t.Error("expected error for CSV validation failure")
 	}
@@ -176,11 +211,11 @@ func TestUploadCopyFileDataErrorMapping(t *testing.T) {
 		t.Errorf("expected CSV_VALIDATION_ERROR, got: %v", errs)
 	}
 	// Invalid CSV structure error with line info
-	helpers.CopyWithMaxSize = func(dst io.Writer, src io.Reader, bufferSize int, maxSize int64, vf helpers.BufferValidationFunc) (int64, *helpers.ValidationIssue, error) {
+	helpers.CopyWithMaxSize = func(dst io.Writer, src io.Reader, bufferSize int, maxSize int64, hasHeader bool, vf helpers.BufferValidationFunc) (int64, *helpers.ValidationIssue, []string, error) {
 		issue := &helpers.ValidationIssue{Line: 5}
-		return 0, issue, fmt.Errorf("invalid CSV structure: inconsistent column count on line 5")
+		return 0, issue, nil, fmt.Errorf("invalid CSV structure: inconsistent column count on line 5")
 	}
-	errs, err = s.copyFileData(ctx, nil, nil, "file.csv", "")
+	errs, err = s.copyFileData(ctx, nil, nil, "file.csv", true, "", 0, RaggedRows{}, false, false)
 	if err == nil {
 		t.Error("expected error for invalid CSV structure")
 	}
@@ -188,10 +223,10 @@ func TestUploadCopyFileDataErrorMapping(t *testing.T) {
 		t.Errorf("expected INVALID_CSV_STRUCTURE line 5, got: %v", errs)
 	}
 	// Generic file copy error
-	helpers.CopyWithMaxSize = func(dst io.Writer, src io.Reader, bufferSize int, maxSize int64, vf helpers.BufferValidationFunc) (int64, *helpers.ValidationIssue, error) {
-		return 0, nil, fmt.Errorf("disk error")
+	helpers.CopyWithMaxSize = func(dst io.Writer, src io.Reader, bufferSize int, maxSize int64, hasHeader bool, vf helpers.BufferValidationFunc) (int64, *helpers.ValidationIssue, []string, error) {
+		return 0, nil, nil, fmt.Errorf("disk error")
 	}
-	errs, err = s.copyFileData(ctx, nil, nil, "file.csv", "")
+	errs, err = s.copyFileData(ctx, nil, nil, "file.csv", true, "", 0, RaggedRows{}, false, false)
 	if err == nil {
 		t.Error("expected error for file copy failure")
 	}
@@ -200,6 +235,54 @@ func TestUploadCopyFileDataErrorMapping(t *testing.T) {
 	}
 }
 
+// TestUploadCopyFileDataFailOnWarning tests that validation warnings only fail the copy with fail_on_warning
+func TestUploadCopyFileDataFailOnWarning(t *testing.T) {
+	s := &Server{}
+	orig := helpers.CopyWithMaxSize
+	defer func() { helpers.CopyWithMaxSize = orig }()
+
+	warnings := make([]string, maxWarningErrors+5)
+	for i := range warnings {
+		warnings[i] = fmt.Sprintf("skipped invalid buffer: line %d, column b", i+2)
+	}
+	helpers.CopyWithMaxSize = func(dst io.Writer, src io.Reader, bufferSize int, maxSize int64, hasHeader bool, vf helpers.BufferValidationFunc) (int64, *helpers.ValidationIssue, []string, error) {
+		return 0, nil, warnings, nil
+	}
+
+	for _, failOnWarning := range []bool{false, true} {
+		dst, err := os.CreateTemp(t.TempDir(), "warnings-*.csv")
+		if err != nil {
+			t.Fatalf("failed to create destination file: %v", err)
+		}
+
+		errs, err := s.copyFileData(context.Background(), nil, dst, "file.csv", true, "", 0, RaggedRows{}, false, failOnWarning)
+		if !failOnWarning {
+			if err != nil || len(errs) != 0 {
+				t.Errorf("expected warnings to be ignored, got %v: %v", err, errs)
+			}
+			continue
+		}
+
+		if err == nil {
+			t.Fatal("expected an error with fail_on_warning")
+		}
+		if len(errs) != maxWarningErrors+1 {
+			t.Fatalf("expected %d errors, got %d", maxWarningErrors+1, len(errs))
+		}
+		for _, e := range errs {
+			if e.Code != "VALIDATION_WARNINGS_PRESENT" {
+				t.Errorf("expected VALIDATION_WARNINGS_PRESENT, got %s", e.Code)
+			}
+		}
+		if errs[0].Message != warnings[0] {
+			t.Errorf("expected the first warning to be listed, got %q", errs[0].Message)
+		}
+		if last := errs[len(errs)-1].Message; last != "5 more validation warnings not listed" {
+			t.Errorf("expected the omitted warnings to be summarized, got %q", last)
+		}
+	}
+}
+
 // TestUploadValidateMimeTypeInvalid tests invalid MIME type detection
 func TestUploadValidateMimeTypeInvalid(t *testing.T) {
 	// Create a multipart form with a binary file
@@ -219,7 +302,7 @@ func TestUploadValidateMimeTypeInvalid(t *testing.T) {
 	fh := req.MultipartForm.File["csv_file"][0]
 	s := &Server{}
 	ctx := context.Background()
-	errs, err := s.validateMimeType(ctx, fh)
+	errs, err := s.validateMimeType(ctx, fh, 0, RaggedRows{})
 	if err == nil {
 		t.Error("expected error for invalid MIME type, got nil")
 	}
@@ -284,7 +367,7 @@ func TestUploadLooksLikeCSV(t *testing.T) {
 	valid.Write([]byte("a,b,c\n1,2,3\n")) // nolint:errcheck
 	valid.Seek(0, io.SeekStart)           // nolint:errcheck
 	ctx := context.Background()
-	isCSV, err := looksLikeCSV(ctx, valid)
+	isCSV, err := looksLikeCSV(ctx, valid, 0, helpers.DefaultMinCSVColumns, RaggedRows{})
 	if err != nil {
 		t.Errorf("looksLikeCSV(valid) error: %v", err)
 	}
@@ -300,7 +383,7 @@ func TestUploadLooksLikeCSV(t *testing.T) {
 	defer os.Remove(invalid.Name())
 	invalid.Write([]byte("just some random text without delimiter")) // nolint:errcheck
 	invalid.Seek(0, io.SeekStart)                                    // nolint:errcheck
-	isCSV2, err := looksLikeCSV(ctx, invalid)
+	isCSV2, err := looksLikeCSV(ctx, invalid, 0, 2, RaggedRows{})
 	if err != nil {
 		t.Errorf("looksLikeCSV(invalid) error: %v", err)
 	}
@@ -352,7 +435,7 @@ func TestUploadCopyFileData(t *testing.T) {
 	// Copy
 	s := &Server{}
 	ctx := context.Background()
-	errs, err := s.copyFileData(ctx, src, dst, "test.csv", "")
+	errs, err := s.copyFileData(ctx, src, dst, "test.csv", true, "", 0, RaggedRows{}, false, false)
 	dst.Close()
 	if err != nil {
 		t.Errorf("copyFileData returned error: %v", err)
@@ -431,7 +514,7 @@ func TestUploadValidateMimeTypeValid(t *testing.T) {
 	fh := req.MultipartForm.File["csv_file"][0]
 	s := &Server{}
 	ctx := context.Background()
-	errs, err := s.validateMimeType(ctx, fh)
+	errs, err := s.validateMimeType(ctx, fh, 0, RaggedRows{})
 	if err != nil {
 		t.Errorf("validateMimeType returned error: %v", err)
 	}
@@ -463,7 +546,7 @@ func TestUploadCopyFileDataSizeExceeded(t *testing.T) {
 	defer os.Remove(dstPath)
 	s := &Server{}
 	ctx := context.Background()
-	errs, err := s.copyFileData(ctx, src, dst, "data.csv", "")
+	errs, err := s.copyFileData(ctx, src, dst, "data.csv", true, "", 0, RaggedRows{}, false, false)
 	dst.Close()
 	if err == nil {
 		t.Error("expected size exceed error, got nil")
@@ -495,7 +578,7 @@ func TestUploadProcessCsvFileFromHeaderSuccess(t *testing.T) {
 	fh := req.MultipartForm.File["csv_file"][0]
 	s := &Server{}
 	ctx := context.Background()
-	tempPath, errs, err := s.processCsvFileFromHeader(ctx, fh, "mytable", true, "utf-8")
+	tempPath, errs, err := s.processCsvFileFromHeader(ctx, fh, "mytable", true, "utf-8", 0, RaggedRows{}, false, false)
 	if err != nil {
 		t.Fatalf("processCsvFileFromHeader returned error: %v", err)
 	}
@@ -531,7 +614,7 @@ func TestUploadProcessCsvFileFromHeaderWithMimeCheck(t *testing.T) {
 	fh := req.MultipartForm.File["csv_file"][0]
 	s := &Server{}
 	ctx := context.Background()
-	tempPath, errs, err := s.processCsvFileFromHeader(ctx, fh, "tbl", false, "utf-8")
+	tempPath, errs, err := s.processCsvFileFromHeader(ctx, fh, "tbl", false, "utf-8", 0, RaggedRows{}, false, false)
 	if err != nil {
 		t.Fatalf("processCsvFileFromHeader returned error: %v", err)
 	}
@@ -555,20 +638,24 @@ func TestUploadValidateEncodingMismatch(t *testing.T) {
 	}
 }
 
-// TestDetectDataEncodingFailure tests encoding detection failure
-func TestDetectDataEncodingFailure(t *testing.T) {
+// TestDetectDataEncodingUndetectedUTF8 tests the fallback to UTF-8 when chardet cannot decide
+func TestDetectDataEncodingUndetectedUTF8(t *testing.T) {
 	s := &Server{}
 	ctx := context.Background()
 
-	// Test with truly empty data - chardet should not be able to detect this
-	emptyData := []byte{}
-
-	_, _, _, err := s.detectDataEncoding(ctx, emptyData)
-	if err == nil {
-		t.Error("expected encoding detection error, got nil")
-	}
-	if !strings.Contains(err.Error(), "could not detect file encoding") {
-		t.Errorf("expected 'could not detect file encoding' error, got: %v", err)
+	// chardet reports no encoding for empty data and for inputs with escape sequences
+	for _, data := range [][]byte{{}, []byte("~{}"), []byte("a\x1b")} {
+		encoding, isUTF8, isUTF16, err := s.detectDataEncoding(ctx, data)
+		if err != nil {
+			t.Errorf("expected %q to be detected as UTF-8, got error: %v", data, err)
+			continue
+		}
+		if encoding != "utf-8" || !isUTF8 || isUTF16 {
+			t.Errorf("expected %q to be detected as UTF-8, got %q (utf8=%v, utf16=%v)", data, encoding, isUTF8, isUTF16)
+		}
+		if err := s.validateEncodingFromData(ctx, data, ""); err != nil {
+			t.Errorf("expected %q to pass encoding validation, got: %v", data, err)
+		}
 	}
 }
 
@@ -632,6 +719,30 @@ func TestValidateUTF16UserSpecifiedMismatch(t *testing.T) {
 	}
 }
 
+// TestRecordEncodingMismatch tests that only encoding mismatches are logged and counted
+func TestRecordEncodingMismatch(t *testing.T) {
+	s := &Server{}
+	var logs bytes.Buffer
+	ctx := helpers.SetLoggerInContext(context.Background(), slog.New(slog.NewJSONHandler(&logs, nil)))
+
+	err := s.validateUTF16UserSpecified(ctx, "utf-16", "utf-8", false)
+	s.recordEncodingMismatch(ctx, "export.csv", fmt.Errorf("invalid encoding: %w", err))
+	s.recordEncodingMismatch(ctx, "export.csv", errors.New("file is not valid UTF-8 encoded"))
+
+	if got := s.encodingMismatches.Load(); got != 1 {
+		t.Errorf("expected 1 encoding mismatch, got %d", got)
+	}
+
+	var entry map[string]any
+	if err := json.Unmarshal(logs.Bytes(), &entry); err != nil {
+		t.Fatalf("expected a single JSON log entry, got %q: %v", logs.String(), err)
+	}
+	if entry["level"] != "WARN" || entry["filename"] != "export.csv" ||
+		entry["declared"] != "utf-16" || entry["detected"] != "utf-8" {
+		t.Errorf("unexpected log entry: %v", entry)
+	}
+}
+
 // TestValidateMimeTypeFileOpenError tests MIME type validation when file open fails
 func TestValidateMimeTypeFileOpenError(t *testing.T) {
 	s := &Server{}
@@ -644,7 +755,7 @@ func TestValidateMimeTypeFileOpenError(t *testing.T) {
 	}
 	// This will cause Open() to fail since there's no actual file
 
-	errs, err := s.validateMimeType(ctx, fh)
+	errs, err := s.validateMimeType(ctx, fh, 0, RaggedRows{})
 	if err == nil {
 		t.Error("expected MIME type detection error, got nil")
 	}
@@ -675,7 +786,7 @@ func TestLooksLikeCSVFileError(t *testing.T) {
 	file.Close()
 
 	// This should fail when trying to read from closed file
-	_, err = looksLikeCSV(ctx, file)
+	_, err = looksLikeCSV(ctx, file, 0, helpers.DefaultMinCSVColumns, RaggedRows{})
 	if err == nil {
 		t.Error("expected file read error, got nil")
 	}
@@ -744,7 +855,7 @@ func TestImportCsvDataFallbackDuplicateDetection(t *testing.T) {
 
 	// Call importCsvData - this should trigger the fallback duplicate detection
 	// because the import will fail with "already exists" error
-	_, _, _, err2 := s.importCsvData(ctx, c, tableName, csvPath, true, false)
+	_, _, _, err2 := s.importCsvData(ctx, c, tableName, csvPath, true, false, database.CSVImportOptions{})
 	if err2 == nil {
 		t.Fatal("expected error, got nil")
 	}
@@ -831,7 +942,7 @@ func TestUploadCopyFileDataSecurityError(t *testing.T) {
 	defer os.Remove(dst.Name())
 	s := &Server{}
 	ctx := context.Background()
-	errs, err := s.copyFileData(ctx, src, dst, "normal.csv", "")
+	errs, err := s.copyFileData(ctx, src, dst, "normal.csv", true, "", 0, RaggedRows{}, false, false)
 	dst.Close()
 	if err == nil {
 		t.Fatal("expected security validation error, got nil")
@@ -854,7 +965,7 @@ func TestImportCsvDataDirectError(t *testing.T) {
 	c, _ := gin.CreateTestContext(w)
 	c.Request = httptest.NewRequest("POST", "/dummy", nil)
 	// Call importCsvData on nonexistent file
-	_, _, _, err2 := s.importCsvData(ctx, c, "no_table", "/no/such/file.csv", true, false)
+	_, _, _, err2 := s.importCsvData(ctx, c, "no_table", "/no/such/file.csv", true, false, database.CSVImportOptions{})
 	if err2 == nil {
 		t.Fatal("expected directImport error, got nil")
 	}
@@ -870,7 +981,6 @@ func TestImportCsvDataDirectError(t *testing.T) {
 	}
 }
 
-
 // TestCheckTableExists tests the checkTableExists function
 func TestCheckTableExists(t *testing.T) {
 	ctx := context.Background()
@@ -894,7 +1004,7 @@ func TestCheckTableExists(t *testing.T) {
 	}()
 
 	// Test that the table exists
-	exists, err := s.checkTableExists(ctx, tableName)
+	exists, err := s.checkTableExists(ctx, database.DefaultSchema, tableName)
 	if err != nil {
 		t.Errorf("checkTableExists returned error: %v", err)
 	}
@@ -903,7 +1013,7 @@ func TestCheckTableExists(t *testing.T) {
 	}
 
 	// Test that a non-existent table does not exist
-	exists2, err := s.checkTableExists(ctx, "non_existent_table")
+	exists2, err := s.checkTableExists(ctx, database.DefaultSchema, "non_existent_table")
 	if err != nil {
 		t.Errorf("checkTableExists returned error for non-existent table: %v", err)
 	}
@@ -912,7 +1022,7 @@ func TestCheckTableExists(t *testing.T) {
 	}
 
 	// Test edge case: empty table name
-	exists3, err := s.checkTableExists(ctx, "")
+	exists3, err := s.checkTableExists(ctx, database.DefaultSchema, "")
 	if err != nil {
 		t.Logf("checkTableExists with empty name returned error (expected): %v", err)
 	}
@@ -921,7 +1031,7 @@ func TestCheckTableExists(t *testing.T) {
 	}
 
 	// Test with special characters in table name (SQL injection protection)
-	exists4, err := s.checkTableExists(ctx, "'; DROP TABLE test_table_exists; --")
+	exists4, err := s.checkTableExists(ctx, database.DefaultSchema, "'; DROP TABLE test_table_exists; --")
 	if err != nil {
 		t.Logf("checkTableExists with SQL injection attempt returned error (expected): %v", err)
 	}
@@ -935,7 +1045,7 @@ func TestCheckTableExistsError(t *testing.T) {
 	s := &Server{db: &database.DuckDB{}} // Uninitialized DB
 	ctx := context.Background()
 
-	exists, err := s.checkTableExists(ctx, "any_table")
+	exists, err := s.checkTableExists(ctx, database.DefaultSchema, "any_table")
 	if err == nil {
 		t.Error("checkTableExists did not return error with closed database")
 	}
@@ -955,7 +1065,7 @@ func TestCheckTableExistsEdgeCases(t *testing.T) {
 
 	// Test case where result.Results[0]["table_count"] is not int64
 	// This would require mocking, but we can test the path by checking a non-existent table
-	exists, err := s.checkTableExists(ctx, "definitely_does_not_exist_12345")
+	exists, err := s.checkTableExists(ctx, database.DefaultSchema, "definitely_does_not_exist_12345")
 	if err != nil {
 		t.Errorf("checkTableExists returned error: %v", err)
 	}
@@ -998,7 +1108,7 @@ func TestImportCsvDataDuplicateTable(t *testing.T) {
 	c.Request = httptest.NewRequest("POST", "/dummy", nil)
 
 	// Try to import with override=false (should fail)
-	_, _, _, err2 := s.importCsvData(ctx, c, tableName, csvPath, true, false)
+	_, _, _, err2 := s.importCsvData(ctx, c, tableName, csvPath, true, false, database.CSVImportOptions{})
 	if err2 == nil {
 		t.Fatal("expected duplicate table error, got nil")
 	}
@@ -1059,7 +1169,7 @@ func TestImportCsvDataDuplicateTableWithOverride(t *testing.T) {
 	c.Request = httptest.NewRequest("POST", "/dummy", nil)
 
 	// Import with override=true (should succeed)
-	result, rowCount, _, err2 := s.importCsvData(ctx, c, tableName, csvPath, true, true)
+	result, rowCount, _, err2 := s.importCsvData(ctx, c, tableName, csvPath, true, true, database.CSVImportOptions{})
 	if err2 != nil {
 		t.Fatalf("importCsvData with override failed: %v", err2)
 	}
@@ -1121,7 +1231,7 @@ func TestImportCsvDataDuplicateErrorFallback(t *testing.T) {
 
 	// Try to import which should trigger the fallback error handling
 	// when directImport fails with "already exists" error
-	_, _, _, err2 := s.importCsvData(ctx, c, tableName, csvPath, true, false)
+	_, _, _, err2 := s.importCsvData(ctx, c, tableName, csvPath, true, false, database.CSVImportOptions{})
 	if err2 == nil {
 		t.Fatal("expected duplicate table error, got nil")
 	}
@@ -1161,7 +1271,7 @@ func TestImportCsvDataCheckTableExistsError(t *testing.T) {
 	c.Request = httptest.NewRequest("POST", "/dummy", nil)
 
 	// Try to import - checkTableExists will fail, so it should proceed to try the import
-	_, _, _, err := s.importCsvData(ctx, c, "check_error_test", csvPath, true, false)
+	_, _, _, err := s.importCsvData(ctx, c, "check_error_test", csvPath, true, false, database.CSVImportOptions{})
 	if err == nil {
 		t.Fatal("expected error, got nil")
 	}
@@ -1205,7 +1315,7 @@ func TestImportCsvDataDuplicateDetection(t *testing.T) {
 	c.Request = httptest.NewRequest("POST", "/dummy", nil)
 
 	// Try to import with override=false (should fail with duplicate)
-	_, _, _, err2 := s.importCsvData(ctx, c, tableName, csvPath, true, false)
+	_, _, _, err2 := s.importCsvData(ctx, c, tableName, csvPath, true, false, database.CSVImportOptions{})
 	if err2 == nil {
 		t.Fatal("expected duplicate table error, got nil")
 	}
@@ -1262,8 +1372,8 @@ func TestUploadFileSizeExceededError(t *testing.T) {
 	// Override helpers.CopyWithMaxSize to simulate file too large error
 	orig := helpers.CopyWithMaxSize
 	defer func() { helpers.CopyWithMaxSize = orig }()
-	helpers.CopyWithMaxSize = func(dst io.Writer, src io.Reader, bufferSize int, maxSize int64, vf helpers.BufferValidationFunc) (int64, *helpers.ValidationIssue, error) {
-		return 0, nil, helpers.ErrMaxFileSizeExceeded
+	helpers.CopyWithMaxSize = func(dst io.Writer, src io.Reader, bufferSize int, maxSize int64, hasHeader bool, vf helpers.BufferValidationFunc) (int64, *helpers.ValidationIssue, []string, error) {
+		return 0, nil, nil, helpers.ErrMaxFileSizeExceeded
 	}
 
 	// Call handleCSVUpload
@@ -1304,7 +1414,7 @@ func TestImportCsvDataCatalogErrorNotDuplicate(t *testing.T) {
 	c.Request = httptest.NewRequest("POST", "/dummy", nil)
 
 	// Try to import non-existent file - should fail but not with duplicate error
-	_, _, _, err2 := s.importCsvData(ctx, c, tableName, csvPath, true, false)
+	_, _, _, err2 := s.importCsvData(ctx, c, tableName, csvPath, true, false, database.CSVImportOptions{})
 	if err2 == nil {
 		t.Fatal("expected error for non-existent CSV file, got nil")
 	}
@@ -1319,3 +1429,477 @@ func TestImportCsvDataCatalogErrorNotDuplicate(t *testing.T) {
 		}
 	}
 }
+
+// TestResolveTableName covers defaulting the table name from the uploaded file name
+func TestResolveTableName(t *testing.T) {
+	tests := []struct {
+		name          string
+		tableName     string
+		filename      string
+		expectedName  string
+		expectedError bool
+	}{
+		{name: "explicit table name wins", tableName: "custom", filename: "sales_2024.csv", expectedName: "custom"},
+		{name: "derived from file name", filename: "sales_2024.csv", expectedName: "sales_2024"},
+		{name: "derived name is sanitized", filename: "Q1 sales-report.v2.csv", expectedName: "Q1_sales_report_v2"},
+		{name: "directory components ignored", filename: "exports/orders.tsv", expectedName: "orders"},
+		{name: "leading digit is invalid", filename: "2024_sales.csv", expectedError: true},
+		{name: "only symbols is invalid", filename: "---.csv", expectedError: true},
+		{name: "empty base name is invalid", filename: ".csv", expectedError: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			payload := CSVRequest{
+				TableName: tc.tableName,
+				CSVFile:   &multipart.FileHeader{Filename: tc.filename},
+			}
+
+			tableName, csvErr := resolveTableName(payload)
+			if tc.expectedError {
+				if csvErr == nil || csvErr.Code != "INVALID_TABLE_NAME" {
+					t.Fatalf("expected INVALID_TABLE_NAME error, got %v", csvErr)
+				}
+				return
+			}
+			if csvErr != nil {
+				t.Fatalf("unexpected error: %v", csvErr)
+			}
+			if tableName != tc.expectedName {
+				t.Errorf("expected table name %q, got %q", tc.expectedName, tableName)
+			}
+		})
+	}
+}
+
+func TestResolveTableNameQuoted(t *testing.T) {
+	t.Setenv("ENV_TABLE_NAME_SANITIZATION", "quoted")
+
+	tests := []struct {
+		name          string
+		tableName     string
+		filename      string
+		expectedName  string
+		expectedError bool
+	}{
+		{name: "explicit name with spaces", tableName: "Q1 sales", filename: "data.csv", expectedName: "Q1 sales"},
+		{name: "explicit name with a quote", tableName: `sales"`, filename: "data.csv", expectedError: true},
+		{name: "derived name keeps hyphens", filename: "Q1 sales-report.v2.csv", expectedName: "Q1 sales-report_v2"},
+		{name: "leading digit is valid", filename: "2024 sales.csv", expectedName: "2024 sales"},
+		{name: "only symbols is invalid", filename: "___.csv", expectedError: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			payload := CSVRequest{
+				TableName: tc.tableName,
+				CSVFile:   &multipart.FileHeader{Filename: tc.filename},
+			}
+
+			tableName, csvErr := resolveTableName(payload)
+			if tc.expectedError {
+				if csvErr == nil || csvErr.Code != "INVALID_TABLE_NAME" {
+					t.Fatalf("expected INVALID_TABLE_NAME error, got %v", csvErr)
+				}
+				return
+			}
+			if csvErr != nil {
+				t.Fatalf("unexpected error: %v", csvErr)
+			}
+			if tableName != tc.expectedName {
+				t.Errorf("expected table name %q, got %q", tc.expectedName, tableName)
+			}
+		})
+	}
+}
+
+func TestUploadQuotedNameMatchingInjectionPatterns(t *testing.T) {
+	t.Setenv("ENV_TABLE_NAME_SANITIZATION", "quoted")
+	s, db := newTablesTestServer(t)
+
+	for _, tc := range []struct {
+		filename     string
+		expectedName string
+	}{
+		{filename: "Exec Summary.csv", expectedName: "Exec Summary"},
+		{filename: "report--2024.csv", expectedName: "report--2024"},
+		{filename: "xp_report.csv", expectedName: "xp_report"},
+	} {
+		t.Run(tc.filename, func(t *testing.T) {
+			req := newMultipartRequest(t, "/api/v1/upload", map[string]string{"has_header": "true"}, tc.filename, []byte("id,name\n1,alice\n2,bob\n"))
+			rec := httptest.NewRecorder()
+			s.Router().ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("Expected status %d, got %d, body: %s", http.StatusOK, rec.Code, rec.Body.String())
+			}
+			var resp CSVUploadResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			if resp.Table != tc.expectedName || resp.RowCount != 2 || len(resp.Columns) != 2 {
+				t.Errorf("Expected table %q with 2 rows and 2 columns, got %+v", tc.expectedName, resp)
+			}
+
+			result, err := db.ExecuteInternalQuery(context.Background(), "SELECT COUNT(*) AS total FROM "+database.QuoteIdentifier(tc.expectedName))
+			if err != nil {
+				t.Fatalf("Failed to query the uploaded table: %v", err)
+			}
+			if total := result.Results[0]["total"]; total != int64(2) {
+				t.Errorf("Expected 2 rows in the uploaded table, got %v", total)
+			}
+		})
+	}
+}
+
+func TestDropImportedTable(t *testing.T) {
+	t.Setenv("ENV_TABLE_NAME_SANITIZATION", "quoted")
+	s, db := newTablesTestServer(t)
+	ctx := context.Background()
+
+	qualifiedTableName := database.QualifiedTableName(database.DefaultSchema, "Exec Summary--draft")
+	if _, err := db.ExecuteInternalQuery(ctx, "CREATE TABLE "+qualifiedTableName+" (id INTEGER)"); err != nil {
+		t.Fatalf("Failed to create test table: %v", err)
+	}
+
+	s.dropImportedTable(ctx, qualifiedTableName)
+
+	exists, err := s.checkTableExists(ctx, database.DefaultSchema, "Exec Summary--draft")
+	if err != nil {
+		t.Fatalf("Failed to check table existence: %v", err)
+	}
+	if exists {
+		t.Error("Expected the imported table to be dropped")
+	}
+}
+
+func TestValidateUploadFilename(t *testing.T) {
+	t.Setenv("ENV_MAX_FILENAME_LENGTH", "16")
+
+	tests := []struct {
+		name          string
+		filename      string
+		expectedName  string
+		expectedError bool
+	}{
+		{name: "plain name", filename: "sales.csv", expectedName: "sales.csv"},
+		{name: "path traversal stripped", filename: "../../etc/sales.csv", expectedName: "sales.csv"},
+		{name: "windows path stripped", filename: `C:\Users\ada\sales.csv`, expectedName: "sales.csv"},
+		{name: "length counts the base name only", filename: "a/very/long/dir/sales.csv", expectedName: "sales.csv"},
+		{name: "too long", filename: "quarterly_sales_2024.csv", expectedError: true},
+		{name: "only a path", filename: "exports/", expectedError: true},
+		{name: "parent directory", filename: "..", expectedError: true},
+		{name: "control characters", filename: "sales\r\n.csv", expectedError: true},
+		{name: "invalid UTF-8", filename: "sales\xff.csv", expectedError: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			fileHeader := &multipart.FileHeader{Filename: tc.filename}
+			csvErr := validateUploadFilename(fileHeader)
+			if tc.expectedError {
+				if csvErr == nil || csvErr.Code != "INVALID_FILE_NAME" {
+					t.Fatalf("expected INVALID_FILE_NAME error, got %v", csvErr)
+				}
+				return
+			}
+			if csvErr != nil {
+				t.Fatalf("unexpected error: %v", csvErr)
+			}
+			if fileHeader.Filename != tc.expectedName {
+				t.Errorf("expected file name %q, got %q", tc.expectedName, fileHeader.Filename)
+			}
+		})
+	}
+}
+
+// TestMaybeForceGC covers the size threshold and debouncing of forced garbage collections
+func TestMaybeForceGC(t *testing.T) {
+	t.Setenv("ENV_GC_THRESHOLD_MB", "1")
+	ctx := context.Background()
+
+	// Reset debounce state so the test does not depend on previous uploads
+	lastForcedGC = time.Time{}
+
+	if maybeForceGC(ctx, 1024) {
+		t.Error("expected no GC for a file below the threshold")
+	}
+	if !maybeForceGC(ctx, 2*1024*1024) {
+		t.Error("expected a GC for a file above the threshold")
+	}
+	if maybeForceGC(ctx, 2*1024*1024) {
+		t.Error("expected a GC right after another one to be debounced")
+	}
+
+	// A GC in progress makes concurrent uploads skip theirs
+	lastForcedGC = time.Time{}
+	gcMu.Lock()
+	if maybeForceGC(ctx, 2*1024*1024) {
+		t.Error("expected no GC while another one is in progress")
+	}
+	gcMu.Unlock()
+}
+
+// BenchmarkCleanupTempFileSmall measures cleanup latency for small uploads,
+// which no longer pay for a forced garbage collection
+func BenchmarkCleanupTempFileSmall(b *testing.B) {
+	s := &Server{}
+	ctx := context.Background()
+	dir := b.TempDir()
+	// Keep some live heap around so the cost of a GC is representative
+	ballast := make([][]byte, 0, 1024)
+	for i := 0; i < 1024; i++ {
+		ballast = append(ballast, make([]byte, 64*1024))
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		path := filepath.Join(dir, fmt.Sprintf("upload_%d.csv", i))
+		if err := os.WriteFile(path, []byte("a,b\n1,2\n"), 0o600); err != nil {
+			b.Fatalf("failed to write temp file: %v", err)
+		}
+		b.StartTimer()
+		s.cleanupTempFile(ctx, path)
+	}
+	b.StopTimer()
+	_ = ballast
+}
+
+// TestCopyFileDataSkipRows tests that skipped rows are copied but not validated
+func TestCopyFileDataSkipRows(t *testing.T) {
+	tests := []struct {
+		name           string
+		content        string
+		hasHeader      bool
+		skipRows       int
+		expectedCode   string
+		expectedLine   int
+		expectedColumn string
+	}{
+		{
+			name:      "formula in skipped banner is ignored",
+			content:   "Exported report\n=CMD('banner')\nid,amount\n1,10\n",
+			hasHeader: true,
+			skipRows:  2,
+		},
+		{
+			name:           "formula after skipped rows reports file line",
+			content:        "Exported report\nGenerated daily\nid,amount\n1,10\n=CMD('malicious'),20\n",
+			hasHeader:      true,
+			skipRows:       2,
+			expectedCode:   "SECURITY_VALIDATION_FAILED",
+			expectedLine:   5,
+			expectedColumn: "id",
+		},
+		{
+			name:           "header after skipped rows names columns",
+			content:        "Exported report\nGenerated daily\nid,formula_col\n1,10\n2,=CMD('malicious')\n",
+			hasHeader:      true,
+			skipRows:       2,
+			expectedCode:   "SECURITY_VALIDATION_FAILED",
+			expectedLine:   5,
+			expectedColumn: "formula_col",
+		},
+		{
+			name:           "first row after skipped rows is data without header",
+			content:        "Exported report\nGenerated daily\n=CMD('malicious'),10\n2,20\n",
+			skipRows:       2,
+			expectedCode:   "SECURITY_VALIDATION_FAILED",
+			expectedLine:   3,
+			expectedColumn: "Column 1",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			srcPath := filepath.Join(t.TempDir(), "skip-src.csv")
+			if err := os.WriteFile(srcPath, []byte(tc.content), 0644); err != nil {
+				t.Fatalf("failed to write source file: %v", err)
+			}
+			src, err := os.Open(srcPath)
+			if err != nil {
+				t.Fatalf("failed to open source file: %v", err)
+			}
+			defer src.Close()
+
+			dstPath := filepath.Join(t.TempDir(), "skip-dst.csv")
+			dst, err := os.Create(dstPath)
+			if err != nil {
+				t.Fatalf("failed to create destination file: %v", err)
+			}
+
+			s := &Server{}
+			errs, err := s.copyFileData(context.Background(), src, dst, "normal.csv", tc.hasHeader, "", tc.skipRows, RaggedRows{}, false, false)
+			dst.Close()
+
+			if tc.expectedCode != "" {
+				if err == nil || len(errs) != 1 || errs[0].Code != tc.expectedCode {
+					t.Fatalf("expected %s, got errs=%v err=%v", tc.expectedCode, errs, err)
+				}
+				if errs[0].Details.Line != tc.expectedLine || errs[0].Details.Column != tc.expectedColumn {
+					t.Errorf("expected line %d column %q, got line %d column %q",
+						tc.expectedLine, tc.expectedColumn, errs[0].Details.Line, errs[0].Details.Column)
+				}
+				return
+			}
+
+			if err != nil || len(errs) != 0 {
+				t.Fatalf("expected no errors, got errs=%v err=%v", errs, err)
+			}
+			out, err := os.ReadFile(dstPath)
+			if err != nil {
+				t.Fatalf("failed to read destination file: %v", err)
+			}
+			if string(out) != tc.content {
+				t.Errorf("copied content mismatch, got %q, want %q", out, tc.content)
+			}
+		})
+	}
+}
+
+// TestCopyFileDataCellTooLong tests that oversized cells are rejected as INVALID_CSV_STRUCTURE
+func TestCopyFileDataCellTooLong(t *testing.T) {
+	t.Setenv("ENV_MAX_CELL_LENGTH", "32")
+
+	srcPath := filepath.Join(t.TempDir(), "long-src.csv")
+	content := "id,notes\n1,fine\n2," + strings.Repeat("x", 64) + "\n"
+	if err := os.WriteFile(srcPath, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write source file: %v", err)
+	}
+	src, err := os.Open(srcPath)
+	if err != nil {
+		t.Fatalf("failed to open source file: %v", err)
+	}
+	defer src.Close()
+
+	dst, err := os.Create(filepath.Join(t.TempDir(), "long-dst.csv"))
+	if err != nil {
+		t.Fatalf("failed to create destination file: %v", err)
+	}
+
+	s := &Server{}
+	errs, err := s.copyFileData(context.Background(), src, dst, "normal.csv", true, "", 0, RaggedRows{}, false, false)
+	dst.Close()
+	if err == nil {
+		t.Fatal("expected cell length error, got nil")
+	}
+	if len(errs) != 1 || errs[0].Code != "INVALID_CSV_STRUCTURE" {
+		t.Fatalf("expected INVALID_CSV_STRUCTURE, got: %v", errs)
+	}
+	if errs[0].Details.Line != 3 || errs[0].Details.Column != "notes" {
+		t.Errorf("expected line 3 column notes, got line %d column %q", errs[0].Details.Line, errs[0].Details.Column)
+	}
+}
+
+func TestCopyFileDataDiskFull(t *testing.T) {
+	// Writes to /dev/full always fail with ENOSPC, like a temporary directory that filled up
+	if _, err := os.Stat("/dev/full"); err != nil {
+		t.Skip("/dev/full is not available")
+	}
+
+	srcPath := filepath.Join(t.TempDir(), "full-src.csv")
+	if err := os.WriteFile(srcPath, []byte("id,city\n1,Paris\n2,Lyon\n"), 0644); err != nil {
+		t.Fatalf("failed to write source file: %v", err)
+	}
+	src, err := os.Open(srcPath)
+	if err != nil {
+		t.Fatalf("failed to open source file: %v", err)
+	}
+	defer src.Close()
+
+	// Open the device through a symlink so removing the partial file only removes the link
+	dstPath := filepath.Join(t.TempDir(), "full-dst.csv")
+	if err := os.Symlink("/dev/full", dstPath); err != nil {
+		t.Skipf("failed to link /dev/full: %v", err)
+	}
+	dst, err := os.OpenFile(dstPath, os.O_WRONLY, 0)
+	if err != nil {
+		t.Skipf("failed to open /dev/full: %v", err)
+	}
+
+	s := &Server{}
+	errs, err := s.copyFileData(context.Background(), src, dst, "normal.csv", true, "", 0, RaggedRows{}, false, false)
+	if !errors.Is(err, errDiskFull) {
+		t.Fatalf("expected disk full error, got %v", err)
+	}
+	if len(errs) != 1 || errs[0].Code != "DISK_FULL" {
+		t.Fatalf("expected DISK_FULL, got: %v", errs)
+	}
+	if _, err := os.Lstat(dstPath); !os.IsNotExist(err) {
+		t.Errorf("expected partial temp file to be removed, got %v", err)
+	}
+}
+
+func TestIsDiskFullError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{name: "ENOSPC", err: &os.PathError{Op: "write", Path: "/tmp/x", Err: syscall.ENOSPC}, expected: true},
+		{name: "message only", err: errors.New("write /tmp/x: no space left on device"), expected: true},
+		{name: "other error", err: errors.New("permission denied"), expected: false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := isDiskFullError(tc.err); got != tc.expected {
+				t.Errorf("isDiskFullError(%v) = %v, expected %v", tc.err, got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestParseMultipartFormMemoryLimit(t *testing.T) {
+	content := []byte("id,city\n" + strings.Repeat("1,Paris\n", 1024))
+
+	tests := []struct {
+		name         string
+		memory       string
+		expectOnDisk bool
+	}{
+		{name: "default keeps small files in memory", memory: "", expectOnDisk: false},
+		{name: "low limit spools to disk", memory: "1024", expectOnDisk: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("ENV_MULTIPART_MEMORY", tc.memory)
+
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = newMultipartRequest(t, "/api/v1/upload", map[string]string{"has_header": "true"}, "cities.csv", content)
+			if err := parseMultipartForm(c); err != nil {
+				t.Fatalf("parseMultipartForm() error = %v", err)
+			}
+			// The HTTP server removes spooled files after a request, tests have to do it
+			t.Cleanup(func() { _ = c.Request.MultipartForm.RemoveAll() })
+
+			var payload CSVRequest
+			if err := c.ShouldBind(&payload); err != nil {
+				t.Fatalf("ShouldBind() error = %v", err)
+			}
+			if !payload.HasHeader {
+				t.Error("expected has_header to be bound from the parsed form")
+			}
+
+			file, err := payload.CSVFile.Open()
+			if err != nil {
+				t.Fatalf("failed to open uploaded file: %v", err)
+			}
+			defer file.Close()
+			if _, onDisk := file.(*os.File); onDisk != tc.expectOnDisk {
+				t.Errorf("expected file on disk %v, got %v", tc.expectOnDisk, onDisk)
+			}
+		})
+	}
+
+	t.Run("non-multipart body is left to binding", func(t *testing.T) {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPost, "/api/v1/upload", strings.NewReader("{}"))
+		c.Request.Header.Set("Content-Type", "application/json")
+		if err := parseMultipartForm(c); err != nil {
+			t.Errorf("expected no error for a JSON body, got %v", err)
+		}
+	})
+}
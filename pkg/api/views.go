@@ -0,0 +1,363 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/aliengiraffe/spotdb/pkg/database"
+	"github.com/aliengiraffe/spotdb/pkg/helpers"
+	"github.com/aliengiraffe/spotdb/pkg/snapshot"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// parquetMagic starts and ends every Parquet file
+var parquetMagic = []byte("PAR1")
+
+// handleCreateView godoc
+//
+//	@Summary		Create a view over a file
+//	@Description	Register an uploaded, S3 or GCS Parquet or CSV file as a view that reads the file in place instead of importing it
+//	@Tags			tables
+//	@Accept			multipart/form-data
+//	@Produce		json
+//	@Param			request	formData	api.CreateViewRequest		true	"View name, source and format"
+//	@Param			file	formData	file						false	"Parquet or CSV file, unless source is set"
+//	@Success		200		{object}	api.CreateViewResponse		"View created successfully"
+//	@Failure		400		{object}	api.CSVErrorResponse		"Bad request with possible error codes: INVALID_REQUEST_PARAMETERS, INVALID_FILE_NAME, INVALID_VIEW_SOURCE, UNSUPPORTED_FILE_FORMAT"
+//	@Failure		403		{object}	api.ErrorResponse			"Read-only API key or database with error code: READ_ONLY_API_KEY or READ_ONLY_MODE"
+//	@Failure		413		{object}	api.CSVErrorResponse		"File too large or disk quota reached with error code: FILE_SIZE_EXCEEDED or DISK_QUOTA_EXCEEDED"
+//	@Failure		422		{object}	api.CSVErrorResponse		"Unprocessable entity with possible error codes: DUPLICATE_TABLE_NAME, INVALID_FILE_FORMAT, INVALID_CSV_STRUCTURE, INVALID_ENCODING, SECURITY_VALIDATION_FAILED, VIEW_CREATION_FAILED"
+//	@Failure		500		{object}	api.CSVErrorResponse		"Internal server error with possible error codes: FILE_COPY_ERROR, SOURCE_DOWNLOAD_FAILED"
+//	@Failure		503		{object}	api.CSVErrorResponse		"Disk usage could not be measured for the disk quota with error code: DISK_QUOTA_CHECK_FAILED"
+//	@Router			/views [post]
+func (s *Server) handleCreateView() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		log := getLoggerFromGinContext(c)
+
+		fail := func(status int, code, message string) {
+			c.JSON(status, CSVErrorResponse{Errors: []CSVError{viewFileError(code, message)}})
+		}
+
+		var payload CreateViewRequest
+		err := parseMultipartForm(c)
+		if err == nil {
+			err = c.ShouldBind(&payload)
+		}
+		if err != nil {
+			log.Info("Error binding create view request", slog.Any("error", err))
+			fail(http.StatusBadRequest, "INVALID_REQUEST_PARAMETERS", "Invalid request: "+err.Error())
+			return
+		}
+
+		if (payload.File == nil) == (payload.Source == "") {
+			fail(http.StatusBadRequest, "INVALID_VIEW_SOURCE", "Send either a file or a source URI")
+			return
+		}
+		sourceName := payload.Source
+		if payload.File != nil {
+			if filenameErr := validateUploadFilename(payload.File); filenameErr != nil {
+				c.JSON(http.StatusBadRequest, CSVErrorResponse{Errors: []CSVError{*filenameErr}})
+				return
+			}
+			sourceName = payload.File.Filename
+		} else if _, _, _, err := snapshot.ParseLocation(payload.Source); err != nil {
+			fail(http.StatusBadRequest, "INVALID_VIEW_SOURCE", "Invalid source: "+err.Error())
+			return
+		}
+
+		format, err := viewFileFormat(payload.Format, sourceName)
+		if err != nil {
+			fail(http.StatusBadRequest, "UNSUPPORTED_FILE_FORMAT", err.Error())
+			return
+		}
+
+		if err := database.ValidateTableName(payload.ViewName); err != nil {
+			fail(http.StatusBadRequest, "INVALID_TABLE_NAME", err.Error())
+			return
+		}
+
+		viewName := database.SanitizeTableName(payload.ViewName)
+		log.Info("Create view request received",
+			slog.String("view", viewName),
+			slog.String("source", sourceName),
+			slog.String("format", format),
+			slog.Bool("override", payload.Override))
+
+		if !payload.Override {
+			if exists, err := s.checkTableExists(ctx, database.DefaultSchema, viewName); err == nil && exists {
+				fail(http.StatusUnprocessableEntity, "DUPLICATE_TABLE_NAME",
+					fmt.Sprintf("Table or view '%s' already exists. Use override=true to replace it or choose a different name.", viewName))
+				return
+			}
+		}
+
+		dir := helpers.GetViewFilesDir()
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			log.Error("Error creating view files directory", slog.Any("error", err))
+			fail(http.StatusInternalServerError, "FILE_COPY_ERROR", "Failed to create view files directory: "+err.Error())
+			return
+		}
+		filePath := filepath.Join(dir, fmt.Sprintf("%s-%s.%s", viewName, uuid.New().String(), format))
+
+		// Keep the file only once the view over it exists
+		created := false
+		defer func() {
+			if !created {
+				if err := os.Remove(filePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+					log.Info("Error removing view file", slog.String("path", filePath), slog.Any("error", err))
+				}
+			}
+		}()
+
+		// The file of a view stays on disk for as long as the view exists. The size of a
+		// source is only known once it is downloaded, so it is checked against the space left.
+		var incoming int64
+		if payload.File != nil {
+			incoming = payload.File.Size
+		}
+		if !s.checkDiskQuota(c, incoming) {
+			return
+		}
+
+		if payload.File != nil {
+			if maxSize := helpers.GetMaxFileSize(); payload.File.Size > maxSize {
+				fail(http.StatusRequestEntityTooLarge, "FILE_SIZE_EXCEEDED", fmt.Sprintf("file too large (max %dGB)", maxSize/(1024*1024*1024)))
+				return
+			}
+			if err := c.SaveUploadedFile(payload.File, filePath); err != nil {
+				log.Error("Error saving view file", slog.Any("error", err))
+				fail(http.StatusInternalServerError, "FILE_COPY_ERROR", "Failed to save file: "+err.Error())
+				return
+			}
+		} else {
+			if err := snapshot.Download(ctx, payload.Source, filePath); err != nil {
+				log.Error("Error downloading view file", slog.Any("error", err))
+				fail(http.StatusInternalServerError, "SOURCE_DOWNLOAD_FAILED", "Failed to download source: "+err.Error())
+				return
+			}
+			if info, err := os.Stat(filePath); err == nil && info.Size() > helpers.GetMaxFileSize() {
+				fail(http.StatusRequestEntityTooLarge, "FILE_SIZE_EXCEEDED", fmt.Sprintf("file too large (max %dGB)", helpers.GetMaxFileSize()/(1024*1024*1024)))
+				return
+			}
+		}
+
+		if validationErrors := validateViewFile(ctx, filePath, format); len(validationErrors) > 0 {
+			c.JSON(http.StatusUnprocessableEntity, CSVErrorResponse{Errors: validationErrors})
+			return
+		}
+
+		if err := s.db.CreateFileView(ctx, viewName, filePath, format, payload.Override); err != nil {
+			log.Info("Error creating view", slog.Any("error", err))
+			fail(http.StatusUnprocessableEntity, "VIEW_CREATION_FAILED", "Failed to create view: "+err.Error())
+			return
+		}
+		created = true
+
+		// Files of the view it replaced are no longer read
+		if payload.Override {
+			removeReplacedViewFiles(ctx, dir, viewName, filePath)
+		}
+
+		columnsResult, _, err := s.getColumnInfo(ctx, c, database.QualifiedTableName(database.DefaultSchema, viewName))
+		if err != nil {
+			fail(http.StatusInternalServerError, "TABLE_INFO_ERROR", "Failed to get view column information: "+err.Error())
+			return
+		}
+
+		log.Info("View created over file", slog.String("view", viewName), slog.String("path", filePath))
+		c.JSON(http.StatusOK, CreateViewResponse{
+			Status:  "success",
+			View:    viewName,
+			Format:  format,
+			Source:  payload.Source,
+			Columns: columnsResult.Results,
+		})
+	}
+}
+
+// viewFileFormat returns the requested format, or the one implied by the file extension
+func viewFileFormat(format, name string) (string, error) {
+	if format == "" {
+		switch strings.ToLower(path.Ext(name)) {
+		case ".parquet":
+			format = database.FileFormatParquet
+		case ".csv", ".tsv", ".txt":
+			format = database.FileFormatCSV
+		}
+	}
+
+	switch format = strings.ToLower(format); format {
+	case database.FileFormatParquet, database.FileFormatCSV:
+		return format, nil
+	default:
+		return "", fmt.Errorf("cannot tell the format of '%s', set format to parquet or csv", name)
+	}
+}
+
+// validateViewFile checks that a Parquet file is one, and runs the upload validations on
+// every row of a CSV file since its values are queried as they are
+func validateViewFile(ctx context.Context, filePath, format string) []CSVError {
+	log := helpers.GetLoggerFromContext(ctx)
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return []CSVError{viewFileError("FILE_COPY_ERROR", "Failed to read file: "+err.Error())}
+	}
+	defer helpers.CloseResources(file, "view file")
+
+	if format == database.FileFormatParquet {
+		if !hasParquetMagic(file) {
+			return []CSVError{viewFileError("INVALID_FILE_FORMAT", "File is not a Parquet file")}
+		}
+		return nil
+	}
+
+	collector := &errorCollector{seen: make(map[string]bool)}
+	if _, err := scanCSVIssues(bufio.NewReaderSize(file, helpers.GetBufferSize()), 0, RaggedRows{}, true, true, collector); err != nil {
+		return []CSVError{viewFileError("CSV_VALIDATION_ERROR", "Failed to read file: "+err.Error())}
+	}
+	if collector.count > 0 {
+		log.Info("View file failed validation", slog.Int("issue_count", collector.count))
+	}
+	return collector.errors
+}
+
+// hasParquetMagic reports whether the file starts and ends with the Parquet magic bytes
+func hasParquetMagic(file *os.File) bool {
+	head := make([]byte, len(parquetMagic))
+	if _, err := io.ReadFull(file, head); err != nil || !bytes.Equal(head, parquetMagic) {
+		return false
+	}
+	tail := make([]byte, len(parquetMagic))
+	if _, err := file.Seek(-int64(len(parquetMagic)), io.SeekEnd); err != nil {
+		return false
+	}
+	_, err := io.ReadFull(file, tail)
+	return err == nil && bytes.Equal(tail, parquetMagic)
+}
+
+// handleMaterializeView godoc
+//
+//	@Summary		Materialize a view into a table
+//	@Description	Copy the current result of a view into a persistent table (CREATE TABLE ... AS SELECT * FROM the view), freezing it against later changes to the file behind the view
+//	@Tags			tables
+//	@Accept			json
+//	@Produce		json
+//	@Param			name	path		string						true	"View name"
+//	@Param			request	body		api.MaterializeViewRequest	true	"Table name and whether to replace an existing table"
+//	@Success		200		{object}	api.CreateTableResponse		"Table created successfully"
+//	@Failure		400		{object}	api.ErrorResponse			"Bad request with possible error code: INVALID_TABLE_NAME"
+//	@Failure		403		{object}	api.ErrorResponse			"Read-only API key or database with error code: READ_ONLY_API_KEY or READ_ONLY_MODE"
+//	@Failure		404		{object}	api.ErrorResponse			"View not found"
+//	@Failure		422		{object}	api.ErrorResponse			"Table already exists with error code: DUPLICATE_TABLE_NAME"
+//	@Failure		500		{object}	api.ErrorResponse			"Internal server error"
+//	@Router			/views/{name}/materialize [post]
+func (s *Server) handleMaterializeView() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		log := getLoggerFromGinContext(c)
+
+		var payload MaterializeViewRequest
+		if err := c.ShouldBindJSON(&payload); err != nil {
+			log.Info("Error binding materialize view request", slog.Any("error", err))
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Status:  "error",
+				Message: "Invalid materialize view request: " + err.Error(),
+			})
+			return
+		}
+		if err := database.ValidateTableName(payload.TableName); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Status:  "error",
+				Code:    "INVALID_TABLE_NAME",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		viewName := database.SanitizeTableName(c.Param("name"))
+		tableName := database.SanitizeTableName(payload.TableName)
+		log.Info("Materialize view request received",
+			slog.String("view", viewName),
+			slog.String("table", tableName),
+			slog.Bool("override", payload.Override))
+
+		if !payload.Override {
+			if exists, err := s.checkTableExists(ctx, database.DefaultSchema, tableName); err == nil && exists {
+				c.JSON(http.StatusUnprocessableEntity, ErrorResponse{
+					Status:  "error",
+					Code:    "DUPLICATE_TABLE_NAME",
+					Message: fmt.Sprintf("Table '%s' already exists. Use override=true to replace it or choose a different table name.", tableName),
+				})
+				return
+			}
+		}
+
+		if err := s.db.MaterializeView(ctx, viewName, tableName, payload.Override); err != nil {
+			log.Error("Error materializing view", slog.Any("error", err))
+			status := http.StatusInternalServerError
+			code := ""
+			switch {
+			case errors.Is(err, database.ErrViewNotFound):
+				status = http.StatusNotFound
+			case errors.Is(err, database.ErrInvalidTableName):
+				status, code = http.StatusBadRequest, "INVALID_TABLE_NAME"
+			}
+			c.JSON(status, ErrorResponse{
+				Status:  "error",
+				Code:    code,
+				Message: "Failed to materialize view: " + err.Error(),
+			})
+			return
+		}
+
+		if rowCount, ok := s.sendCreatedTable(ctx, c, tableName); ok {
+			log.Info("View materialized",
+				slog.String("view", viewName),
+				slog.String("table", tableName),
+				slog.Int64("row_count", rowCount))
+		}
+	}
+}
+
+// viewFileError builds an error about a file registered as a view
+func viewFileError(code, message string) CSVError {
+	return CSVError{
+		Code:    code,
+		Message: message,
+		Details: CSVErrorDetail{
+			Line:       0,
+			Suggestion: suggestionMap[code],
+		},
+	}
+}
+
+// removeReplacedViewFiles removes the files kept for a view other than the one it now reads
+func removeReplacedViewFiles(ctx context.Context, dir, viewName, keep string) {
+	log := helpers.GetLoggerFromContext(ctx)
+
+	matches, err := filepath.Glob(filepath.Join(dir, viewName+"-*"))
+	if err != nil {
+		return
+	}
+	for _, match := range matches {
+		if match == keep {
+			continue
+		}
+		if err := os.Remove(match); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Info("Error removing replaced view file", slog.String("path", match), slog.Any("error", err))
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newViewRequest builds a create view request, attaching content as the file when filename is set
+func newViewRequest(t *testing.T, fields map[string]string, filename string, content []byte) *http.Request {
+	t.Helper()
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for key, value := range fields {
+		if err := writer.WriteField(key, value); err != nil {
+			t.Fatalf("failed to write field %s: %v", key, err)
+		}
+	}
+	if filename != "" {
+		part, err := writer.CreateFormFile("file", filename)
+		if err != nil {
+			t.Fatalf("failed to create form file: %v", err)
+		}
+		if _, err := part.Write(content); err != nil {
+			t.Fatalf("failed to write file data: %v", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("failed to close multipart writer: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/views", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
+
+func TestHandleCreateView(t *testing.T) {
+	s, db := newTablesTestServer(t)
+	viewDir := t.TempDir()
+	t.Setenv("ENV_VIEW_FILES_DIR", viewDir)
+
+	exportDir := t.TempDir()
+	if _, err := db.ExportQueryParquet(context.Background(), "SELECT * FROM sales", exportDir, nil); err != nil {
+		t.Fatalf("Failed to export Parquet file: %v", err)
+	}
+	parquetFiles, _ := filepath.Glob(filepath.Join(exportDir, "*.parquet"))
+	if len(parquetFiles) != 1 {
+		t.Fatalf("Expected one Parquet file, got %v", parquetFiles)
+	}
+	parquetData, err := os.ReadFile(parquetFiles[0])
+	if err != nil {
+		t.Fatalf("Failed to read Parquet file: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		fields         map[string]string
+		filename       string
+		content        []byte
+		expectedStatus int
+		expectedCode   string
+	}{
+		{
+			name:           "parquet file",
+			fields:         map[string]string{"view_name": "sales_view"},
+			filename:       "sales.parquet",
+			content:        parquetData,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "csv file",
+			fields:         map[string]string{"view_name": "people"},
+			filename:       "people.csv",
+			content:        []byte("name,age\nalice,30\nbob,40\n"),
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "existing name",
+			fields:         map[string]string{"view_name": "sales"},
+			filename:       "sales.parquet",
+			content:        parquetData,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedCode:   "DUPLICATE_TABLE_NAME",
+		},
+		{
+			name:           "neither file nor source",
+			fields:         map[string]string{"view_name": "empty"},
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   "INVALID_VIEW_SOURCE",
+		},
+		{
+			name:           "invalid source",
+			fields:         map[string]string{"view_name": "remote", "source": "https://example.com/data.parquet"},
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   "INVALID_VIEW_SOURCE",
+		},
+		{
+			name:           "unknown format",
+			fields:         map[string]string{"view_name": "data"},
+			filename:       "data.json",
+			content:        []byte(`{"a": 1}`),
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   "UNSUPPORTED_FILE_FORMAT",
+		},
+		{
+			name:           "not a parquet file",
+			fields:         map[string]string{"view_name": "fake"},
+			filename:       "fake.parquet",
+			content:        []byte("name,age\nalice,30\n"),
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedCode:   "INVALID_FILE_FORMAT",
+		},
+		{
+			name:           "csv with formula",
+			fields:         map[string]string{"view_name": "formulas"},
+			filename:       "formulas.csv",
+			content:        []byte("name,total\nalice,=SUM(A1:A9)\n"),
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedCode:   "SECURITY_VALIDATION_FAILED",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			s.Router().ServeHTTP(rec, newViewRequest(t, tt.fields, tt.filename, tt.content))
+
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if tt.expectedCode == "" {
+				return
+			}
+			var response CSVErrorResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			if len(response.Errors) == 0 || response.Errors[0].Code != tt.expectedCode {
+				t.Errorf("Expected error code %s, got %v", tt.expectedCode, response.Errors)
+			}
+		})
+	}
+
+	rec := serveJSON(s, http.MethodPost, "/api/v1/query", map[string]any{"query": "SELECT SUM(amount) AS total FROM sales_view"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected querying the view to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// Only the files of the two created views are kept
+	files, _ := filepath.Glob(filepath.Join(viewDir, "*"))
+	if len(files) != 2 {
+		t.Errorf("Expected 2 view files, got %v", files)
+	}
+
+	// Replacing a view removes the file it read before
+	rec = httptest.NewRecorder()
+	s.Router().ServeHTTP(rec, newViewRequest(t, map[string]string{"view_name": "people", "override": "true"},
+		"people.csv", []byte("name,age\ncarol,50\n")))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected override to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+	files, _ = filepath.Glob(filepath.Join(viewDir, "people-*"))
+	if len(files) != 1 {
+		t.Errorf("Expected 1 file for the replaced view, got %v", files)
+	}
+}
+
+func TestHandleMaterializeView(t *testing.T) {
+	s, db := newTablesTestServer(t)
+	if _, err := db.ExecuteQuery(context.Background(), "CREATE VIEW north_sales AS SELECT * FROM sales WHERE region = 'north'"); err != nil {
+		t.Fatalf("Failed to create view: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		url            string
+		body           map[string]any
+		expectedStatus int
+		expectedCode   string
+	}{
+		{name: "materializes view", url: "/api/v1/views/north_sales/materialize", body: map[string]any{"table_name": "north_frozen"}, expectedStatus: http.StatusOK},
+		{name: "existing table", url: "/api/v1/views/north_sales/materialize", body: map[string]any{"table_name": "north_frozen"}, expectedStatus: http.StatusUnprocessableEntity, expectedCode: "DUPLICATE_TABLE_NAME"},
+		{name: "override", url: "/api/v1/views/north_sales/materialize", body: map[string]any{"table_name": "north_frozen", "override": true}, expectedStatus: http.StatusOK},
+		{name: "missing table name", url: "/api/v1/views/north_sales/materialize", body: map[string]any{}, expectedStatus: http.StatusBadRequest},
+		{name: "view itself", url: "/api/v1/views/north_sales/materialize", body: map[string]any{"table_name": "north_sales", "override": true}, expectedStatus: http.StatusBadRequest, expectedCode: "INVALID_TABLE_NAME"},
+		{name: "not a view", url: "/api/v1/views/sales/materialize", body: map[string]any{"table_name": "sales_copy"}, expectedStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serveJSON(s, http.MethodPost, tt.url, tt.body)
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if tt.expectedStatus == http.StatusOK {
+				var response CreateTableResponse
+				if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+					t.Fatalf("Failed to parse response: %v", err)
+				}
+				if response.Table != "north_frozen" || response.RowCount != 2 || len(response.Columns) != 3 {
+					t.Errorf("Unexpected response: %+v", response)
+				}
+				return
+			}
+			var response ErrorResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			if response.Code != tt.expectedCode {
+				t.Errorf("Expected error code %q, got %q", tt.expectedCode, response.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package database
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/aliengiraffe/spotdb/pkg/helpers"
+)
+
+// ActiveQuery describes a query that is currently being executed
+type ActiveQuery struct {
+	ID        string
+	RequestID string
+	Query     string
+	StartedAt time.Time
+}
+
+// trackQuery registers the query as in-flight until the returned function is called
+func (db *DuckDB) trackQuery(ctx context.Context, query string) func() {
+	active := &ActiveQuery{
+		ID:        helpers.GenerateID(),
+		RequestID: helpers.GetRequestIDFromContext(ctx),
+		Query:     query,
+		StartedAt: time.Now(),
+	}
+	db.active.Store(active.ID, active)
+
+	return func() {
+		db.active.Delete(active.ID)
+	}
+}
+
+// ActiveQueries returns the queries currently being executed, oldest first
+func (db *DuckDB) ActiveQueries() []ActiveQuery {
+	queries := []ActiveQuery{}
+	db.active.Range(func(_, value any) bool {
+		queries = append(queries, *value.(*ActiveQuery))
+		return true
+	})
+
+	sort.Slice(queries, func(i, j int) bool {
+		return queries[i].StartedAt.Before(queries[j].StartedAt)
+	})
+	return queries
+}
@@ -0,0 +1,34 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/aliengiraffe/spotdb/pkg/helpers"
+)
+
+// AnalyzeTable refreshes the statistics DuckDB plans queries against a table with. It
+// does not change any rows, so the version of the table is left as it is.
+func (db *DuckDB) AnalyzeTable(ctx context.Context, table TableRef) error {
+	log := helpers.GetLoggerFromContext(ctx)
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.db == nil {
+		return errors.New("database connection is closed")
+	}
+
+	start := time.Now()
+	if _, err := db.db.ExecContext(ctx, "ANALYZE "+QualifiedTableName(table.Schema, table.Name)); err != nil {
+		return fmt.Errorf("failed to analyze %s.%s: %w", table.Schema, table.Name, err)
+	}
+	log.Info("AnalyzeTable: Statistics refreshed",
+		slog.String("schema", table.Schema),
+		slog.String("table", table.Name),
+		slog.Duration("duration", time.Since(start)))
+	return nil
+}
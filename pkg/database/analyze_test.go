@@ -0,0 +1,30 @@
+package database
+
+import (
+	"context"
+	"testing"
+)
+
+func TestAnalyzeTable(t *testing.T) {
+	db := newTestDuckDB(t)
+	ctx := context.Background()
+
+	if _, err := db.ExecuteQuery(ctx, "CREATE TABLE events AS SELECT range AS id FROM range(1000)"); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	etag, err := db.TableETag(ctx, DefaultSchema, "events")
+	if err != nil {
+		t.Fatalf("Failed to get table ETag: %v", err)
+	}
+
+	if err := db.AnalyzeTable(ctx, TableRef{Schema: DefaultSchema, Name: "events"}); err != nil {
+		t.Fatalf("AnalyzeTable failed: %v", err)
+	}
+	if after, _ := db.TableETag(ctx, DefaultSchema, "events"); after != etag {
+		t.Errorf("Expected the table version to be unchanged, got %s then %s", etag, after)
+	}
+
+	if err := db.AnalyzeTable(ctx, TableRef{Schema: DefaultSchema, Name: "missing"}); err == nil {
+		t.Error("Expected an error analyzing a missing table")
+	}
+}
@@ -0,0 +1,39 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// TableChecksum returns a deterministic MD5 checksum of the rows of a table, in insertion
+// order. Every value is cast to VARCHAR with NULL as an empty string, the values of a row
+// are joined with tabs and the rows with newlines, so the same data always yields the
+// same checksum. It reads the whole table and is expensive on large tables.
+func (db *DuckDB) TableChecksum(ctx context.Context, table TableRef) (string, error) {
+	columns, err := db.TableColumns(ctx, table)
+	if err != nil {
+		return "", err
+	}
+	if len(columns) == 0 {
+		return "", fmt.Errorf("%w: %s.%s", ErrTableNotFound, table.Schema, table.Name)
+	}
+
+	values := make([]string, 0, len(columns))
+	for _, column := range columns {
+		values = append(values, fmt.Sprintf("coalesce(CAST(%s AS VARCHAR), '')", QuoteIdentifier(column.Name)))
+	}
+
+	result, err := db.ExecuteQuery(ctx, fmt.Sprintf(
+		"SELECT md5(coalesce(string_agg(concat_ws(chr(9), %s), chr(10) ORDER BY rowid), '')) AS checksum FROM %s",
+		strings.Join(values, ", "), QualifiedTableName(table.Schema, table.Name)))
+	if err != nil {
+		return "", fmt.Errorf("failed to compute checksum of %s.%s: %w", table.Schema, table.Name, err)
+	}
+	if len(result.Results) == 0 {
+		return "", fmt.Errorf("failed to compute checksum of %s.%s: no result", table.Schema, table.Name)
+	}
+
+	checksum, _ := result.Results[0]["checksum"].(string)
+	return checksum, nil
+}
@@ -0,0 +1,47 @@
+package database
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func TestTableChecksum(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDuckDB(t)
+
+	if _, err := db.ExecuteQuery(ctx, "CREATE TABLE accounts (id INTEGER, email VARCHAR, balance DECIMAL(10, 2))"); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	if _, err := db.ExecuteQuery(ctx, "INSERT INTO accounts VALUES (2, 'b@example.com', 10.50), (1, NULL, 3)"); err != nil {
+		t.Fatalf("Failed to insert rows: %v", err)
+	}
+
+	checksum, err := db.TableChecksum(ctx, TableRef{Schema: DefaultSchema, Name: "accounts"})
+	if err != nil {
+		t.Fatalf("Failed to compute checksum: %v", err)
+	}
+
+	// Rows are hashed in insertion order, values tab separated with NULL as empty
+	sum := md5.Sum([]byte("2\tb@example.com\t10.50\n1\t\t3.00"))
+	if want := hex.EncodeToString(sum[:]); checksum != want {
+		t.Errorf("Expected checksum %s, got %s", want, checksum)
+	}
+
+	if _, err := db.ExecuteQuery(ctx, "UPDATE accounts SET balance = 11 WHERE id = 2"); err != nil {
+		t.Fatalf("Failed to update row: %v", err)
+	}
+	changed, err := db.TableChecksum(ctx, TableRef{Schema: DefaultSchema, Name: "accounts"})
+	if err != nil {
+		t.Fatalf("Failed to compute checksum: %v", err)
+	}
+	if changed == checksum {
+		t.Error("Expected the checksum to change with the data")
+	}
+
+	if _, err := db.TableChecksum(ctx, TableRef{Schema: DefaultSchema, Name: "missing"}); !errors.Is(err, ErrTableNotFound) {
+		t.Errorf("Expected ErrTableNotFound for a missing table, got %v", err)
+	}
+}
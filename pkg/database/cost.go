@@ -0,0 +1,137 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/aliengiraffe/spotdb/pkg/helpers"
+)
+
+// ErrQueryTooExpensive is returned when a query's estimated cardinality exceeds the limit
+var ErrQueryTooExpensive = errors.New("query too expensive")
+
+// explainOperator is a single node of the physical plan in DuckDB's JSON EXPLAIN output
+type explainOperator struct {
+	Name      string            `json:"name"`
+	Children  []explainOperator `json:"children"`
+	ExtraInfo map[string]any    `json:"extra_info"`
+}
+
+// productOperators are join operators whose output DuckDB does not always estimate,
+// and which can produce up to the product of their inputs
+var productOperators = map[string]bool{
+	"CROSS_PRODUCT":     true,
+	"BLOCKWISE_NL_JOIN": true,
+	"NESTED_LOOP_JOIN":  true,
+}
+
+// CheckQueryCost runs EXPLAIN on each statement of the query and returns an error
+// wrapping ErrQueryTooExpensive when any operator is estimated to produce more than
+// maxRows rows. A maxRows of 0 or less disables the check. Statements that cannot be
+// explained are skipped, their errors surface when the query is executed.
+func (db *DuckDB) CheckQueryCost(ctx context.Context, query string, maxRows int64) error {
+	if maxRows <= 0 {
+		return nil
+	}
+	if db.db == nil {
+		return errors.New("database connection is closed")
+	}
+
+	log := helpers.GetLoggerFromContext(ctx)
+
+	for _, statement := range splitQueryBySemicolon(query) {
+		statement = strings.TrimSpace(statement)
+		if statement == "" {
+			continue
+		}
+
+		plan, err := db.explainQuery(ctx, statement)
+		if err != nil {
+			log.Info("CheckQueryCost: Skipping statement that cannot be explained", slog.Any("error", err))
+			continue
+		}
+
+		estimatedRows := maxEstimatedRows(plan)
+		log.Info("CheckQueryCost: Estimated query cardinality",
+			slog.Float64("estimated_rows", estimatedRows),
+			slog.Int64("max_rows", maxRows))
+
+		if estimatedRows > float64(maxRows) {
+			return fmt.Errorf("%w: estimated %.0f rows exceeds the limit of %d rows",
+				ErrQueryTooExpensive, estimatedRows, maxRows)
+		}
+	}
+
+	return nil
+}
+
+// explainQuery returns the physical plan of a single statement
+func (db *DuckDB) explainQuery(ctx context.Context, statement string) ([]explainOperator, error) {
+	rows, err := db.db.QueryContext(ctx, "EXPLAIN (FORMAT json) "+statement)
+	if err != nil {
+		return nil, err
+	}
+	defer helpers.CloseResources(rows, "explain rows")
+
+	var plan []explainOperator
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, err
+		}
+		if key != "physical_plan" {
+			continue
+		}
+		if err := json.Unmarshal([]byte(value), &plan); err != nil {
+			return nil, fmt.Errorf("failed to parse query plan: %w", err)
+		}
+	}
+
+	return plan, rows.Err()
+}
+
+// maxEstimatedRows returns the largest estimated cardinality of any operator in the plan,
+// so expensive intermediate results are caught even when the final output is small
+func maxEstimatedRows(plan []explainOperator) float64 {
+	var largest float64
+	for _, op := range plan {
+		largest = max(largest, walkEstimatedRows(op, &largest))
+	}
+	return largest
+}
+
+// walkEstimatedRows returns the estimated output of an operator, recording the largest
+// estimate seen in its subtree
+func walkEstimatedRows(op explainOperator, largest *float64) float64 {
+	childRows := make([]float64, 0, len(op.Children))
+	for _, child := range op.Children {
+		rows := walkEstimatedRows(child, largest)
+		*largest = max(*largest, rows)
+		childRows = append(childRows, rows)
+	}
+
+	if estimate, ok := op.ExtraInfo["Estimated Cardinality"].(string); ok {
+		if rows, err := strconv.ParseFloat(estimate, 64); err == nil {
+			return rows
+		}
+	}
+
+	// Fall back to deriving the estimate from the children
+	var rows float64
+	if productOperators[strings.TrimSpace(op.Name)] && len(childRows) > 0 {
+		rows = 1
+		for _, r := range childRows {
+			rows *= r
+		}
+		return rows
+	}
+	for _, r := range childRows {
+		rows = max(rows, r)
+	}
+	return rows
+}
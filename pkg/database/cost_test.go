@@ -0,0 +1,73 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestCheckQueryCost(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDuckDB(t)
+
+	if _, err := db.ExecuteQuery(ctx, "CREATE TABLE events AS SELECT range AS id FROM range(100000)"); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		query     string
+		maxRows   int64
+		wantErr   bool
+		tooCostly bool
+	}{
+		{name: "filtered scan within limit", query: "SELECT * FROM events WHERE id > 5", maxRows: 1_000_000},
+		{name: "equi join within limit", query: "SELECT * FROM events a JOIN events b ON a.id = b.id", maxRows: 1_000_000},
+		{name: "cross join rejected", query: "SELECT * FROM events a, events b", maxRows: 1_000_000, wantErr: true, tooCostly: true},
+		{name: "aggregated cross join rejected", query: "SELECT COUNT(*) FROM events a CROSS JOIN events b", maxRows: 1_000_000, wantErr: true, tooCostly: true},
+		{name: "second statement rejected", query: "SELECT 1; SELECT * FROM events a, events b", maxRows: 1_000_000, wantErr: true, tooCostly: true},
+		{name: "check disabled", query: "SELECT * FROM events a, events b", maxRows: 0},
+		{name: "unexplainable statement skipped", query: "CREATE TABLE other (id INTEGER)", maxRows: 10},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := db.CheckQueryCost(ctx, tc.query, tc.maxRows)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("CheckQueryCost() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if tc.tooCostly && !errors.Is(err, ErrQueryTooExpensive) {
+				t.Errorf("Expected ErrQueryTooExpensive, got %v", err)
+			}
+		})
+	}
+}
+
+func TestMaxEstimatedRows(t *testing.T) {
+	scan := func(rows string) explainOperator {
+		return explainOperator{Name: "SEQ_SCAN ", ExtraInfo: map[string]any{"Estimated Cardinality": rows}}
+	}
+
+	plan := []explainOperator{
+		{
+			Name: "UNGROUPED_AGGREGATE",
+			Children: []explainOperator{
+				{Name: "CROSS_PRODUCT", Children: []explainOperator{scan("1000"), scan("300")}},
+			},
+		},
+	}
+	if got := maxEstimatedRows(plan); got != 300000 {
+		t.Errorf("Expected 300000 estimated rows, got %.0f", got)
+	}
+
+	plan = []explainOperator{
+		{
+			Name:      "HASH_JOIN",
+			ExtraInfo: map[string]any{"Estimated Cardinality": "50"},
+			Children:  []explainOperator{scan("1000"), scan("300")},
+		},
+	}
+	if got := maxEstimatedRows(plan); got != 1000 {
+		t.Errorf("Expected 1000 estimated rows, got %.0f", got)
+	}
+}
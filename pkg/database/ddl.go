@@ -0,0 +1,27 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrTableNotFound is returned when a table does not exist
+var ErrTableNotFound = errors.New("table not found")
+
+// TableDDL returns the CREATE TABLE statement DuckDB keeps for a table, which recreates
+// its columns, types and constraints but not its data
+func (db *DuckDB) TableDDL(ctx context.Context, table TableRef) (string, error) {
+	result, err := db.ExecuteQuery(ctx, fmt.Sprintf(`SELECT sql FROM duckdb_tables()
+		WHERE database_name = current_database() AND schema_name = %s AND table_name = %s`,
+		quoteLiteral(table.Schema), quoteLiteral(table.Name)))
+	if err != nil {
+		return "", fmt.Errorf("failed to get DDL of %s.%s: %w", table.Schema, table.Name, err)
+	}
+	if len(result.Results) == 0 {
+		return "", fmt.Errorf("%w: %s.%s", ErrTableNotFound, table.Schema, table.Name)
+	}
+
+	ddl, _ := result.Results[0]["sql"].(string)
+	return ddl, nil
+}
@@ -0,0 +1,39 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestTableDDL(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDuckDB(t)
+
+	if _, err := db.ExecuteQuery(ctx, "CREATE TABLE accounts (id INTEGER PRIMARY KEY, email VARCHAR NOT NULL, balance DECIMAL(10, 2))"); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+
+	ddl, err := db.TableDDL(ctx, TableRef{Schema: DefaultSchema, Name: "accounts"})
+	if err != nil {
+		t.Fatalf("Failed to get DDL: %v", err)
+	}
+	for _, want := range []string{"CREATE TABLE accounts", "id INTEGER PRIMARY KEY", "email VARCHAR NOT NULL", "balance DECIMAL(10,2)"} {
+		if !strings.Contains(ddl, want) {
+			t.Errorf("Expected DDL to contain %q, got %s", want, ddl)
+		}
+	}
+
+	// The DDL recreates the table elsewhere
+	if _, err := db.ExecuteQuery(ctx, "DROP TABLE accounts"); err != nil {
+		t.Fatalf("Failed to drop table: %v", err)
+	}
+	if _, err := db.ExecuteQuery(ctx, ddl); err != nil {
+		t.Fatalf("Failed to recreate table from DDL: %v", err)
+	}
+
+	if _, err := db.TableDDL(ctx, TableRef{Schema: DefaultSchema, Name: "missing"}); !errors.Is(err, ErrTableNotFound) {
+		t.Errorf("Expected ErrTableNotFound for a missing table, got %v", err)
+	}
+}
@@ -0,0 +1,100 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+
+	"github.com/aliengiraffe/spotdb/pkg/helpers"
+)
+
+// DropTablesWithPrefix drops the base tables of the default schema whose names start with
+// prefix, compared case-insensitively, in a single transaction. Tables skip reports, the
+// temporary tables of running imports and the row filters table are left alone, and the
+// row filters of the dropped tables are removed with them. It returns the names of the
+// dropped tables in name order.
+func (db *DuckDB) DropTablesWithPrefix(ctx context.Context, prefix string, skip func(name string) bool) ([]string, error) {
+	log := helpers.GetLoggerFromContext(ctx)
+	prefix = strings.ToLower(prefix)
+
+	var dropped []string
+	err := retryTransient(ctx, "drop tables with prefix", helpers.GetWriteBusyRetries(), func() error {
+		db.mu.Lock()
+		defer db.mu.Unlock()
+
+		if db.db == nil {
+			return errors.New("database connection is closed")
+		}
+
+		rows, err := db.db.QueryContext(ctx, `SELECT table_name FROM information_schema.tables
+			WHERE table_catalog = current_database() AND table_schema = ? AND table_type = 'BASE TABLE'`, DefaultSchema)
+		if err != nil {
+			return fmt.Errorf("failed to list tables: %w", err)
+		}
+		var matches []string
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				helpers.CloseResources(rows, "tables")
+				return fmt.Errorf("failed to list tables: %w", err)
+			}
+			lower := strings.ToLower(name)
+			if !strings.HasPrefix(lower, prefix) || strings.HasPrefix(lower, "tmp_import_") ||
+				lower == RowFiltersTable || (skip != nil && skip(name)) {
+				continue
+			}
+			matches = append(matches, name)
+		}
+		helpers.CloseResources(rows, "tables")
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to list tables: %w", err)
+		}
+		if len(matches) == 0 {
+			dropped = nil
+			return nil
+		}
+		sort.Strings(matches)
+
+		filters, err := db.rowFiltersLocked(ctx)
+		if err != nil {
+			return err
+		}
+
+		tx, err := db.db.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		defer func() { _ = tx.Rollback() }()
+
+		for _, name := range matches {
+			if _, err := tx.ExecContext(ctx, "DROP TABLE "+QualifiedTableName(DefaultSchema, name)); err != nil {
+				return fmt.Errorf("failed to drop table %s: %w", name, err)
+			}
+			if _, ok := filters[strings.ToLower(name)]; ok {
+				if _, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE table_name = ?", QuoteIdentifier(RowFiltersTable)),
+					strings.ToLower(name)); err != nil {
+					return fmt.Errorf("failed to delete row filter of %s: %w", name, err)
+				}
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit table drops: %w", err)
+		}
+
+		db.writes.Add(1)
+		for _, name := range matches {
+			db.bumpTableVersionLocked(name)
+		}
+		dropped = matches
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info("DropTablesWithPrefix: Tables dropped", slog.String("prefix", prefix), slog.Int("count", len(dropped)))
+	return dropped, nil
+}
@@ -0,0 +1,61 @@
+package database
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestDropTablesWithPrefix(t *testing.T) {
+	db := newTestDuckDB(t)
+	ctx := context.Background()
+
+	for _, query := range []string{
+		"CREATE TABLE test_orders (id INTEGER, tenant VARCHAR)",
+		"CREATE TABLE Test_Regions (id INTEGER)",
+		"CREATE TABLE test_keep (id INTEGER)",
+		"CREATE TABLE tmp_import_test_1 (id INTEGER)",
+		"CREATE TABLE sales (id INTEGER)",
+		"CREATE VIEW test_view AS SELECT * FROM sales",
+	} {
+		if _, err := db.ExecuteQuery(ctx, query); err != nil {
+			t.Fatalf("Failed to run %q: %v", query, err)
+		}
+	}
+	if err := db.SetRowFilter(ctx, "test_orders", "tenant = {tenant}"); err != nil {
+		t.Fatalf("Failed to set row filter: %v", err)
+	}
+
+	dropped, err := db.DropTablesWithPrefix(ctx, "TEST_", func(name string) bool { return name == "test_keep" })
+	if err != nil {
+		t.Fatalf("DropTablesWithPrefix failed: %v", err)
+	}
+	if want := []string{"Test_Regions", "test_orders"}; !slices.Equal(dropped, want) {
+		t.Errorf("Expected dropped tables %v, got %v", want, dropped)
+	}
+
+	tables, err := db.ListUserTables(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list tables: %v", err)
+	}
+	var names []string
+	for _, table := range tables {
+		names = append(names, table.Name)
+	}
+	if want := []string{RowFiltersTable, "sales", "test_keep"}; !slices.Equal(names, want) {
+		t.Errorf("Expected remaining tables %v, got %v", want, names)
+	}
+
+	filters, err := db.RowFilters(ctx)
+	if err != nil {
+		t.Fatalf("Failed to read row filters: %v", err)
+	}
+	if _, ok := filters["test_orders"]; ok {
+		t.Errorf("Expected the row filter of a dropped table to be removed, got %+v", filters)
+	}
+
+	dropped, err = db.DropTablesWithPrefix(ctx, "missing_", nil)
+	if err != nil || len(dropped) != 0 {
+		t.Errorf("Expected nothing dropped for an unmatched prefix, got %v, %v", dropped, err)
+	}
+}
@@ -11,7 +11,10 @@ import (
 	"regexp"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/aliengiraffe/spotdb/pkg/helpers"
 	"github.com/aliengiraffe/spotdb/pkg/snapshot"
@@ -52,9 +55,26 @@ type BenchmarkMetrics struct {
 type DuckDB struct {
 	db         *sql.DB
 	dbPath     string
-	mu         sync.RWMutex
-	cancelFunc context.CancelFunc
-	cleanupCh  chan string // Channel for cleanup tasks
+	persistent bool // Set for DUCKDB_PATH, keeps the database file when closing
+	readOnly   bool // Set for DUCKDB_ACCESS_MODE=read_only, the file is opened read-only
+	s3Secret   bool // Set when DUCKDB_S3_SECRET registered a DuckDB S3 secret
+	// Set for ENV_DISABLE_BENCHMARKS, skips all benchmark timing and profiling
+	benchmarksDisabled bool
+	mu                 sync.RWMutex
+	cancelFunc         context.CancelFunc
+	cleanupCh          chan string   // Channel for cleanup tasks
+	writes             atomic.Uint64 // Number of successful statements that may have modified data
+	active             sync.Map      // In-flight queries keyed by query ID, see ActiveQueries
+	instanceID         string        // Distinguishes entity tags of different database instances
+
+	// Minimum time between two profiled queries, see ExecuteQueryWithBenchmarks
+	profilingInterval time.Duration
+	lastProfiled      atomic.Int64 // Unix nanoseconds of the last profiled query
+
+	// Table versions keyed by lower-cased table name and the generation bumped by writes
+	// to unknown tables, both guarded by mu. See QueryETag.
+	versions   map[string]uint64
+	generation uint64
 }
 
 // NewDuckDB creates a new database instance
@@ -68,58 +88,117 @@ func NewDuckDBConfig(ctx context.Context) (*DuckDB, error) {
 	log := helpers.GetLoggerFromContext(ctx)
 	tempDir := os.TempDir()
 
+	readOnly, err := readOnlyAccessMode()
+	if err != nil {
+		return nil, err
+	}
+
 	// Check if SNAPSHOT_LOCATION is set
 	snapshotLocation := os.Getenv("SNAPSHOT_LOCATION")
 	var dbPath string
+	var persistent bool
 
 	if snapshotLocation != "" {
 		// Use fixed path for snapshot loading
 		dbPath = filepath.Join(tempDir, "duckdb.db")
 
-		log.Info("SNAPSHOT_LOCATION detected, loading snapshot from S3",
+		log.Info("SNAPSHOT_LOCATION detected, loading snapshot",
 			slog.String("snapshotLocation", snapshotLocation))
 
-		// Load snapshot from S3
-		if err := loadSnapshotFromS3(ctx, snapshotLocation, dbPath); err != nil {
-			log.Error("Failed to load snapshot from S3 - application will not start",
+		// Load snapshot from S3 or GCS
+		if err := loadSnapshot(ctx, snapshotLocation, dbPath); err != nil {
+			log.Error("Failed to load snapshot - application will not start",
 				slog.Any("error", err))
-			return nil, fmt.Errorf("failed to load snapshot from S3: %w", err)
+			return nil, fmt.Errorf("failed to load snapshot: %w", err)
 		}
 
-		log.Info("Snapshot loaded successfully from S3", slog.String("dbPath", dbPath))
+		log.Info("Snapshot loaded successfully", slog.String("dbPath", dbPath))
+	} else if persistentPath := os.Getenv("DUCKDB_PATH"); persistentPath != "" {
+		// Use the configured file so the data survives restarts, opening it if it exists
+		dbPath = persistentPath
+		persistent = true
+
+		if err := os.MkdirAll(filepath.Dir(dbPath), 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create directory for DUCKDB_PATH: %w", err)
+		}
+		_, statErr := os.Stat(dbPath)
+		log.Info("DUCKDB_PATH detected, using persistent database",
+			slog.String("dbPath", dbPath),
+			slog.Bool("existing", statErr == nil))
 	} else {
 		// Use unique database file for each instance to prevent conflicts in tests
 		// This ensures clean state for each test run
 		uniqueID := uuid.New().String()
 		dbPath = filepath.Join(tempDir, fmt.Sprintf("duckdb_%s.db", uniqueID))
+
+		// A new database would stay empty, so read-only needs an existing file
+		if readOnly {
+			return nil, errors.New("DUCKDB_ACCESS_MODE=read_only requires SNAPSHOT_LOCATION or DUCKDB_PATH")
+		}
 	}
 
 	// Create a cancelable context for database operations
 	dbCtx, cancel := context.WithCancel(ctx)
 	_ = dbCtx // Avoid unused variable error
 
-	// Open the database connection
-	db, err := sql.Open("duckdb", dbPath)
+	// Open the database connection, read-only connections can share the file with other processes
+	dsn := dbPath
+	if readOnly {
+		dsn += "?access_mode=READ_ONLY"
+		log.Info("DUCKDB_ACCESS_MODE detected, opening database read-only", slog.String("dbPath", dbPath))
+	}
+	db, err := sql.Open("duckdb", dsn)
 	if err != nil {
 		cancel()
 		return nil, fmt.Errorf("failed to open database connection: %w", err)
 	}
 
-	// Test the connection
+	// Test the connection, which fails when another process holds the file lock
 	if err := db.Ping(); err != nil {
 		helpers.CloseResources(db, "database connection")
 		cancel()
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
+	// Spill out-of-core sorts, joins and aggregations to the configured scratch volume
+	if spillDir := os.Getenv("DUCKDB_TEMP_DIR"); spillDir != "" {
+		if err := setTempDirectory(db, spillDir); err != nil {
+			helpers.CloseResources(db, "database connection")
+			cancel()
+			return nil, err
+		}
+		log.Info("DUCKDB_TEMP_DIR detected, spilling to disk there",
+			slog.String("temp_directory", spillDir))
+	}
+
+	// Authenticate httpfs reads and writes of s3:// paths with a DuckDB secret
+	registered, err := registerS3Secret(db)
+	if err != nil {
+		helpers.CloseResources(db, "database connection")
+		cancel()
+		return nil, err
+	}
+	if registered {
+		log.Info("DUCKDB_S3_SECRET detected, registered DuckDB S3 secret",
+			slog.String("secret", S3SecretName),
+			slog.String("mode", os.Getenv("DUCKDB_S3_SECRET")))
+	}
+
 	// Create cleanup channel for temporary resources
 	cleanupCh := make(chan string, 100)
 
 	duckDB := &DuckDB{
-		db:         db,
-		dbPath:     dbPath,
-		cancelFunc: cancel,
-		cleanupCh:  cleanupCh,
+		db:                 db,
+		dbPath:             dbPath,
+		persistent:         persistent,
+		readOnly:           readOnly,
+		cancelFunc:         cancel,
+		benchmarksDisabled: helpers.IsBenchmarkingDisabled(),
+		s3Secret:           registered,
+		profilingInterval:  helpers.GetProfilingInterval(),
+		cleanupCh:          cleanupCh,
+		instanceID:         uuid.New().String(),
+		versions:           make(map[string]uint64),
 	}
 
 	// Start cleanup worker
@@ -130,8 +209,55 @@ func NewDuckDBConfig(ctx context.Context) (*DuckDB, error) {
 	return duckDB, nil
 }
 
-// sanitizeTableName sanitizes a table name to prevent SQL injection
+// readOnlyAccessMode reports whether DUCKDB_ACCESS_MODE asks for a read-only database,
+// returning an error for values other than read_only and read_write
+func readOnlyAccessMode() (bool, error) {
+	switch mode := strings.ToLower(strings.TrimSpace(os.Getenv("DUCKDB_ACCESS_MODE"))); mode {
+	case "", "read_write":
+		return false, nil
+	case "read_only":
+		return true, nil
+	default:
+		return false, fmt.Errorf("invalid DUCKDB_ACCESS_MODE %q, use read_only or read_write", mode)
+	}
+}
+
+// IsReadOnly reports whether the database was opened read-only with DUCKDB_ACCESS_MODE
+func (db *DuckDB) IsReadOnly() bool {
+	return db.readOnly
+}
+
+// setTempDirectory creates dir if needed and sets it as DuckDB's temp_directory, where
+// queries larger than the memory limit spill to
+func setTempDirectory(db *sql.DB, dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create DuckDB temp directory: %w", err)
+	}
+	// temp_directory is a global setting, so it applies to every pooled connection
+	if _, err := db.Exec(fmt.Sprintf("SET temp_directory = '%s'", strings.ReplaceAll(dir, "'", "''"))); err != nil {
+		return fmt.Errorf("failed to set DuckDB temp directory: %w", err)
+	}
+	return nil
+}
+
+// ErrInvalidTableName is returned for a table name with characters that cannot be kept
+// with the quoted sanitization strategy
+var ErrInvalidTableName = errors.New("invalid table name")
+
+// sanitizeTableName sanitizes a table name to prevent SQL injection. By default only
+// alphanumeric characters and underscores are kept, with ENV_TABLE_NAME_SANITIZATION=quoted
+// every character but the unsafe ones is kept and the name is trimmed, relying on the
+// identifier being quoted wherever it is embedded in SQL.
 func sanitizeTableName(tableName string) string {
+	if helpers.GetTableNameSanitization() == helpers.TableNameSanitizationQuoted {
+		return strings.Map(func(r rune) rune {
+			if isUnsafeIdentifierRune(r) {
+				return '_'
+			}
+			return r
+		}, strings.TrimSpace(tableName))
+	}
+
 	// Only allow alphanumeric characters and underscores
 	return strings.Map(func(r rune) rune {
 		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' {
@@ -141,6 +267,101 @@ func sanitizeTableName(tableName string) string {
 	}, tableName)
 }
 
+// isUnsafeIdentifierRune reports whether a character is never kept in a quoted table name:
+// quotes, control characters including null bytes, invalid UTF-8, dots that would read as
+// schema qualifiers and slashes that would nest export paths
+func isUnsafeIdentifierRune(r rune) bool {
+	switch r {
+	case '"', '\'', '`', '.', '/', '\\', utf8.RuneError:
+		return true
+	}
+	return unicode.IsControl(r)
+}
+
+// SanitizeTableName sanitizes a table name so it can be safely embedded in SQL
+func SanitizeTableName(tableName string) string {
+	return sanitizeTableName(tableName)
+}
+
+// ValidateTableName rejects a table name that the quoted sanitization strategy would
+// change beyond trimming, so new tables are not created under a silently altered name.
+// The strict strategy replaces characters by design and accepts every name.
+func ValidateTableName(tableName string) error {
+	if helpers.GetTableNameSanitization() != helpers.TableNameSanitizationQuoted {
+		return nil
+	}
+	if i := strings.IndexFunc(tableName, isUnsafeIdentifierRune); i >= 0 {
+		return fmt.Errorf("%w: %q contains %q, quotes, dots, slashes and control characters are not allowed",
+			ErrInvalidTableName, tableName, []rune(tableName[i:])[0])
+	}
+	if strings.TrimSpace(tableName) == "" {
+		return fmt.Errorf("%w: name is empty", ErrInvalidTableName)
+	}
+	return nil
+}
+
+// explainPattern matches the EXPLAIN and EXPLAIN ANALYZE prefixes. DuckDB does not serialize
+// EXPLAIN statements, and EXPLAIN ANALYZE runs the statement it explains, so the statement
+// is classified on its own. EXPLAIN with an options list is not matched.
+var explainPattern = regexp.MustCompile(`(?i)^EXPLAIN\s+(ANALY[SZ]E\s+)?`)
+
+// isReadOnlyStatement reports whether a single statement only reads data, as classified by
+// DuckDB's parser: statements that parse as a SELECT, which includes DESCRIBE, SHOW and
+// SUMMARIZE, and EXPLAIN of one. A leading WITH does not make an INSERT, UPDATE or DELETE
+// read-only, and PRAGMA, SET and statements that fail to parse are never read-only.
+func isReadOnlyStatement(ctx context.Context, preparer statementPreparer, statement string) bool {
+	statement = strings.TrimSpace(statement)
+	if prefix := explainPattern.FindString(statement); prefix != "" {
+		statement = statement[len(prefix):]
+	}
+
+	tree, err := serializeStatement(ctx, preparer, statement)
+	if err != nil {
+		helpers.GetLoggerFromContext(ctx).Info("Could not classify statement, treating it as a write", slog.Any("error", err))
+		return false
+	}
+	failed, _ := tree["error"].(bool)
+	return !failed
+}
+
+// IsReadOnlyQuery reports whether every statement of the query only reads data, see
+// isReadOnlyStatement
+func (db *DuckDB) IsReadOnlyQuery(ctx context.Context, query string) bool {
+	if db.db == nil || isEmptyQuery(query) {
+		return false
+	}
+	for _, statement := range splitQueryBySemicolon(query) {
+		if statement = strings.TrimSpace(statement); statement != "" && !isReadOnlyStatement(ctx, db.db, statement) {
+			return false
+		}
+	}
+	return true
+}
+
+// WriteCount returns a counter that increases whenever a statement that may modify data
+// succeeds, so callers can tell whether anything changed between two points in time
+func (db *DuckDB) WriteCount() uint64 {
+	return db.writes.Load()
+}
+
+// DefaultSchema is the schema tables are created in when none is specified
+const DefaultSchema = "main"
+
+// QualifiedTableName returns the sanitized and quoted schema-qualified table name, using
+// DefaultSchema when schema is empty
+func QualifiedTableName(schema, tableName string) string {
+	if schema == "" {
+		schema = DefaultSchema
+	}
+	return QuoteIdentifier(sanitizeTableName(schema)) + "." + QuoteIdentifier(sanitizeTableName(tableName))
+}
+
+// QuoteIdentifier quotes an identifier such as a column name so it can be safely
+// embedded in SQL, escaping any embedded double quotes
+func QuoteIdentifier(identifier string) string {
+	return `"` + strings.ReplaceAll(identifier, `"`, `""`) + `"`
+}
+
 // startCleanupWorker starts a background worker to clean up temporary resources
 func (db *DuckDB) startCleanupWorker(ctx context.Context) {
 
@@ -169,9 +390,13 @@ func (db *DuckDB) startCleanupWorker(ctx context.Context) {
 					if strings.HasPrefix(resource, "tmp_import_") {
 						// Sanitize table name to prevent SQL injection
 						sanitizedResource := sanitizeTableName(resource)
-						db.mu.Lock()
-						_, err := db.db.Exec(fmt.Sprintf("DROP TABLE IF EXISTS %s", sanitizedResource))
-						db.mu.Unlock()
+						err := retryTransient(ctx, "drop temporary table", helpers.GetWriteBusyRetries(), func() error {
+							db.mu.Lock()
+							defer db.mu.Unlock()
+							_, err := db.db.Exec(fmt.Sprintf("DROP TABLE IF EXISTS %s", QuoteIdentifier(sanitizedResource)))
+							db.bumpTableVersionLocked(sanitizedResource)
+							return err
+						})
 						if err != nil {
 							log.Info("Error dropping temporary table",
 								slog.String("table", sanitizedResource),
@@ -188,7 +413,8 @@ func (db *DuckDB) startCleanupWorker(ctx context.Context) {
 	}
 }
 
-// Close closes the database connection and removes the database file
+// Close closes the database connection and removes the database file, unless it is the
+// persistent file configured with DUCKDB_PATH
 func (db *DuckDB) Close() error {
 	db.mu.Lock()
 	defer db.mu.Unlock()
@@ -203,6 +429,10 @@ func (db *DuckDB) Close() error {
 		}
 	}
 
+	if db.persistent {
+		return nil
+	}
+
 	// Remove the database file and WAL file
 	if err := os.Remove(db.dbPath); err != nil && !os.IsNotExist(err) {
 		return fmt.Errorf("failed to remove database file: %w", err)
@@ -223,41 +453,249 @@ type ImportResult struct {
 	SchemaAnalysis map[string]any
 }
 
-// createTableFromCSVDirectly creates a table directly from a CSV file using DuckDB's native functionality
-func (db *DuckDB) createTableFromCSVDirectly(ctx context.Context, tableName, csvPath string, hasHeader bool, override bool) error {
-	db.mu.Lock()
-	defer db.mu.Unlock()
+// CSVImportOptions contains optional settings used when importing a CSV file
+type CSVImportOptions struct {
+	// Schema is the schema the table is created in, DefaultSchema when empty
+	Schema string
+	// DateFormat is passed to read_csv's dateformat option, auto-detected when empty
+	DateFormat string
+	// TimestampFormat is passed to read_csv's timestampformat option, auto-detected when empty
+	TimestampFormat string
+	// SkipRows is passed to read_csv's skip option to ignore leading lines
+	SkipRows int
+	// AllVarchar is passed to read_csv's all_varchar option to read every column as VARCHAR
+	AllVarchar bool
+	// NullPadding is passed to read_csv's null_padding option to read the missing columns
+	// of short rows as NULL
+	NullPadding bool
+	// ColumnTypes declares the name and type of every column, for files whose header is
+	// followed by a type row. Both rows are skipped and types are not auto-detected.
+	ColumnTypes []ColumnType
+	// Columns lists the imported columns to keep, in the order they are created in. Every
+	// column is kept when empty.
+	Columns []string
+	// RenameColumns maps imported column names to the names they are created with
+	RenameColumns map[string]string
+	// SampleFile holds the start of the CSV when it is imported from a stream, such as a
+	// named pipe, that can be read only once. The format is detected from the sample.
+	SampleFile string
+	// Complete is called once the table is created, before the import is committed. An
+	// error rolls the import back, such as a stream whose validation failed after DuckDB
+	// started reading it.
+	Complete func() error
+	// IfMatch is called with the entity tag of the table, "" when it does not exist, before
+	// it is created or replaced. Returning false fails the import with
+	// ErrTableVersionMismatch, so a table modified since the client read it is kept.
+	IfMatch func(etag string) bool
+}
+
+// ColumnType is a column name with the DuckDB type it is read as
+type ColumnType struct {
+	Name string
+	Type string
+}
+
+// typeHints maps the type tokens accepted in a CSV type row to DuckDB types
+var typeHints = map[string]string{
+	"string":    "VARCHAR",
+	"str":       "VARCHAR",
+	"text":      "VARCHAR",
+	"varchar":   "VARCHAR",
+	"char":      "VARCHAR",
+	"int":       "BIGINT",
+	"integer":   "BIGINT",
+	"long":      "BIGINT",
+	"bigint":    "BIGINT",
+	"float":     "DOUBLE",
+	"double":    "DOUBLE",
+	"real":      "DOUBLE",
+	"number":    "DOUBLE",
+	"numeric":   "DOUBLE",
+	"decimal":   "DOUBLE",
+	"bool":      "BOOLEAN",
+	"boolean":   "BOOLEAN",
+	"date":      "DATE",
+	"time":      "TIME",
+	"datetime":  "TIMESTAMP",
+	"timestamp": "TIMESTAMP",
+	// JSON columns hold one JSON document per field, checked on import and queried with
+	// DuckDB's JSON functions and operators such as ->>
+	"json": "JSON",
+}
+
+// TypeFromHint returns the DuckDB type for a type row token, ignoring case and surrounding
+// whitespace, and false when the token is not recognized
+func TypeFromHint(hint string) (string, bool) {
+	duckType, ok := typeHints[strings.ToLower(strings.TrimSpace(hint))]
+	return duckType, ok
+}
+
+// readCSVArgs renders the options as additional read_csv arguments
+func (o CSVImportOptions) readCSVArgs() string {
+	var args strings.Builder
+	if o.DateFormat != "" {
+		args.WriteString(fmt.Sprintf(", dateformat=%s", quoteLiteral(o.DateFormat)))
+	}
+	if o.TimestampFormat != "" {
+		args.WriteString(fmt.Sprintf(", timestampformat=%s", quoteLiteral(o.TimestampFormat)))
+	}
+	if o.SkipRows > 0 {
+		args.WriteString(fmt.Sprintf(", skip=%d", o.SkipRows))
+	}
+	if o.AllVarchar {
+		args.WriteString(", all_varchar=true")
+	}
+	if o.NullPadding {
+		args.WriteString(", null_padding=true")
+	}
+	if len(o.ColumnTypes) > 0 {
+		columns := make([]string, len(o.ColumnTypes))
+		for i, column := range o.ColumnTypes {
+			columns[i] = quoteLiteral(column.Name) + ": " + quoteLiteral(column.Type)
+		}
+		args.WriteString(fmt.Sprintf(", columns={%s}", strings.Join(columns, ", ")))
+	}
+	return args.String()
+}
+
+// quoteLiteral quotes a string literal so it can be safely embedded in SQL
+func quoteLiteral(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
 
+// readCSVSource renders the read_csv table function call used to import a CSV file
+func readCSVSource(csvPath string, hasHeader bool, options CSVImportOptions) string {
+	if len(options.ColumnTypes) > 0 {
+		// Names and types come from the columns argument, so the header and type rows
+		// are skipped like the leading lines
+		hasHeader = false
+		options.SkipRows += 2
+	}
+	return fmt.Sprintf("read_csv(%s, header=%v, auto_detect=true, sample_size=-1, normalize_names=true%s)",
+		quoteLiteral(csvPath), hasHeader, options.readCSVArgs())
+}
+
+// createTableFromCSVDirectly creates a table directly from a CSV file using DuckDB's native functionality
+func (db *DuckDB) createTableFromCSVDirectly(ctx context.Context, tableName, csvPath string, hasHeader bool, override bool, options CSVImportOptions) error {
 	log := helpers.GetLoggerFromContext(ctx)
 
 	log.Info("createTableFromCSVDirectly: Attempting direct import",
 		slog.String("table", tableName),
 		slog.String("path", csvPath))
 
+	// A stream arrives as fast as the client sends it, so it is read into a temporary
+	// table before taking the lock, which then only covers copying it into place
+	source := readCSVSource(csvPath, hasHeader, options)
+	columnsSource := source
+	var conn *sql.Conn
+	if options.SampleFile != "" {
+		// A stream can be read only once, so its columns are read from the sample
+		columnsSource = readCSVSource(options.SampleFile, hasHeader, options)
+		var err error
+		if conn, source, err = db.stageCSVStream(ctx, csvPath, options.SampleFile, hasHeader, options); err != nil {
+			return err
+		}
+		defer db.releaseStagingConn(ctx, conn)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
 	if db.db == nil {
 		return errors.New("database connection is closed")
 	}
 
+	// Checked under the lock so no other write can change the table before it is replaced
+	if options.IfMatch != nil {
+		etag, err := db.tableETagLocked(ctx, options.Schema, tableName)
+		if err != nil {
+			return err
+		}
+		if !options.IfMatch(etag) {
+			return ErrTableVersionMismatch
+		}
+	}
+
+	// Sanitize schema and table names to prevent SQL injection
+	qualifiedTableName := QualifiedTableName(options.Schema, tableName)
+
+	// The selection and renames are resolved first so an invalid one leaves an existing
+	// table untouched
+	selectList := "*"
+	if len(options.Columns) > 0 || len(options.RenameColumns) > 0 {
+		columns, err := db.sourceColumns(ctx, columnsSource)
+		if err != nil {
+			return fmt.Errorf("failed to read CSV columns: %w", err)
+		}
+		if len(options.Columns) > 0 {
+			if columns, err = selectedColumns(columns, options.Columns); err != nil {
+				return err
+			}
+			log.Info("createTableFromCSVDirectly: Selecting columns", slog.Any("columns", columns))
+		}
+		if selectList, err = renamedColumnList(columns, options.RenameColumns); err != nil {
+			return err
+		}
+		if len(options.RenameColumns) > 0 {
+			log.Info("createTableFromCSVDirectly: Renaming columns", slog.Any("rename_columns", options.RenameColumns))
+		}
+	}
+
+	// With a completion check the import runs in a transaction, so a failed check leaves
+	// the catalog as it was, including a table the import would have replaced
+	// The temporary table of a stream is only visible on its staging connection
+	var execer statementExecer = db.db
+	var beginner interface {
+		BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+	} = db.db
+	if conn != nil {
+		execer, beginner = conn, conn
+	}
+	var tx *sql.Tx
+	if options.Complete != nil {
+		var err error
+		if tx, err = beginner.BeginTx(ctx, nil); err != nil {
+			return fmt.Errorf("failed to begin import transaction: %w", err)
+		}
+		defer func() {
+			// Rolling back after a commit is a no-op
+			_ = tx.Rollback()
+		}()
+		execer = tx
+	}
+
+	if options.Schema != "" {
+		_, err := execer.ExecContext(ctx, fmt.Sprintf("CREATE SCHEMA IF NOT EXISTS %s", QuoteIdentifier(sanitizeTableName(options.Schema))))
+		if err != nil {
+			return fmt.Errorf("failed to create schema: %w", err)
+		}
+	}
+
 	if override {
 		// Drop the table if it already exists
-		// Sanitize table name to prevent SQL injection
-		sanitizedTableName := sanitizeTableName(tableName)
-		_, err := db.db.Exec(fmt.Sprintf("DROP TABLE IF EXISTS %s", sanitizedTableName))
+		_, err := execer.ExecContext(ctx, fmt.Sprintf("DROP TABLE IF EXISTS %s", qualifiedTableName))
 		if err != nil {
 			return fmt.Errorf("failed to drop table: %w", err)
 		}
 	}
 
 	// Use DuckDB's native CSV import functionality to create the table directly
-	// Sanitize table name to prevent SQL injection
-	sanitizedTableName := sanitizeTableName(tableName)
-	createTableSQL := fmt.Sprintf(`CREATE TABLE %s AS SELECT * FROM read_csv('%s', header=%v, auto_detect=true, sample_size=-1, normalize_names=true);`,
-		sanitizedTableName, csvPath, hasHeader)
+	createTableSQL := fmt.Sprintf("CREATE TABLE %s AS SELECT %s FROM %s;", qualifiedTableName, selectList, source)
 
-	_, err := db.db.Exec(createTableSQL)
+	_, err := execer.ExecContext(ctx, createTableSQL)
 	if err != nil {
 		return fmt.Errorf("failed to create table from CSV: %w", err)
 	}
+	if tx != nil {
+		if err := options.Complete(); err != nil {
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit import: %w", err)
+		}
+	}
+	db.writes.Add(1)
+	db.bumpTableVersionLocked(sanitizeTableName(tableName))
 
 	return nil
 }
@@ -271,9 +709,156 @@ type SchemaDetectionResult struct {
 // CreateTableFromCSV creates a table from a CSV file
 // This is the original implementation kept for backward compatibility
 func (db *DuckDB) CreateTableFromCSV(ctx context.Context, tableName, csvPath string, hasHeader bool, override bool) error {
+	return db.CreateTableFromCSVWithOptions(ctx, tableName, csvPath, hasHeader, override, CSVImportOptions{})
+}
+
+// CreateTableFromCSVWithOptions creates a table from a CSV file applying the given read_csv options
+func (db *DuckDB) CreateTableFromCSVWithOptions(ctx context.Context, tableName, csvPath string, hasHeader bool, override bool, options CSVImportOptions) error {
 	log := helpers.GetLoggerFromContext(ctx)
 	log.Info("CreateTableFromCSV: Using direct import", slog.String("table", tableName), slog.String("path", csvPath))
-	return db.createTableFromCSVDirectly(ctx, tableName, csvPath, hasHeader, override)
+	if options.SampleFile != "" {
+		// A stream can be read only once
+		return db.createTableFromCSVDirectly(ctx, tableName, csvPath, hasHeader, override, options)
+	}
+	return retryTransient(ctx, "import", helpers.GetImportRetries(), func() error {
+		return db.createTableFromCSVDirectly(ctx, tableName, csvPath, hasHeader, override, options)
+	})
+}
+
+// ErrNotSelectQuery is returned when a query expected to be a single SELECT is not
+var ErrNotSelectQuery = errors.New("query must be a single SELECT statement")
+
+// ErrEmptyQuery is returned when a query holds no statements, such as a query that is
+// only whitespace, semicolons or comments
+var ErrEmptyQuery = errors.New("no valid queries to execute")
+
+// CSVPreview contains the inferred schema and the first rows of a parsed CSV file
+type CSVPreview struct {
+	Columns []map[string]any
+	Rows    []map[string]any
+}
+
+// PreviewCSV parses a CSV file the same way CreateTableFromCSVWithOptions would, returning
+// the inferred schema and up to limit rows without creating a table
+func (db *DuckDB) PreviewCSV(ctx context.Context, csvPath string, hasHeader bool, options CSVImportOptions, limit int) (*CSVPreview, error) {
+	source := readCSVSource(csvPath, hasHeader, options)
+
+	schemaResult, err := db.ExecuteQuery(ctx, "DESCRIBE SELECT * FROM "+source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to infer CSV schema: %w", err)
+	}
+
+	columns := make([]map[string]any, 0, len(schemaResult.Results))
+	for _, row := range schemaResult.Results {
+		columns = append(columns, map[string]any{
+			"name": row["column_name"],
+			"type": row["column_type"],
+		})
+	}
+
+	rowsResult, err := db.ExecuteQuery(ctx, fmt.Sprintf("SELECT * FROM %s LIMIT %d", source, limit))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV rows: %w", err)
+	}
+
+	return &CSVPreview{
+		Columns: columns,
+		Rows:    rowsResult.Results,
+	}, nil
+}
+
+// CreateTableFromQuery materializes the results of a SELECT query into a new table
+// using CREATE TABLE ... AS. When override is true an existing table is replaced.
+func (db *DuckDB) CreateTableFromQuery(ctx context.Context, tableName, query string, override bool) error {
+	log := helpers.GetLoggerFromContext(ctx)
+
+	selectQuery, err := validateSelectQuery(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	createStatement := "CREATE TABLE"
+	if override {
+		createStatement = "CREATE OR REPLACE TABLE"
+	}
+
+	sanitizedTableName := sanitizeTableName(tableName)
+	log.Info("CreateTableFromQuery: Creating table from query",
+		slog.String("table", sanitizedTableName),
+		slog.Bool("override", override))
+
+	return retryTransient(ctx, "create table from query", helpers.GetWriteBusyRetries(), func() error {
+		db.mu.Lock()
+		defer db.mu.Unlock()
+
+		if db.db == nil {
+			return errors.New("database connection is closed")
+		}
+
+		if _, err := db.db.ExecContext(ctx, fmt.Sprintf("%s %s AS %s", createStatement, QuoteIdentifier(sanitizedTableName), selectQuery)); err != nil {
+			return fmt.Errorf("failed to create table from query: %w", err)
+		}
+		db.writes.Add(1)
+		db.bumpTableVersionLocked(sanitizedTableName)
+		return nil
+	})
+}
+
+// CountQueryRows returns the number of rows a SELECT query produces without
+// materializing them, by wrapping it as SELECT COUNT(*) FROM (<query>)
+func (db *DuckDB) CountQueryRows(ctx context.Context, query string) (int64, error) {
+	selectQuery, err := validateSelectQuery(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := db.ExecuteQuery(ctx, fmt.Sprintf("SELECT COUNT(*) AS row_count FROM (%s)", selectQuery))
+	if err != nil {
+		return 0, err
+	}
+
+	if len(result.Results) == 0 {
+		return 0, errors.New("count query returned no rows")
+	}
+	rowCount, ok := result.Results[0]["row_count"].(int64)
+	if !ok {
+		return 0, fmt.Errorf("unexpected row count type %T", result.Results[0]["row_count"])
+	}
+
+	return rowCount, nil
+}
+
+// validateSelectQuery ensures the query is a single SELECT (or WITH ... SELECT) statement
+// and returns it without the trailing semicolon. A rejected query returns an error wrapping
+// ErrEmptyQuery, ErrQueryTooLong, ErrSuspiciousQuery or ErrNotSelectQuery.
+func validateSelectQuery(ctx context.Context, query string) (string, error) {
+	if isEmptyQuery(query) {
+		return "", ErrEmptyQuery
+	}
+	if err := validateQuery(ctx, query); err != nil {
+		if errors.Is(err, ErrQueryTooLong) {
+			return "", err
+		}
+		return "", fmt.Errorf("%w: %w", ErrSuspiciousQuery, err)
+	}
+
+	var statements []string
+	for _, statement := range splitQueryBySemicolon(query) {
+		if statement = strings.TrimSpace(statement); statement != "" {
+			statements = append(statements, statement)
+		}
+	}
+	if len(statements) != 1 {
+		return "", ErrNotSelectQuery
+	}
+
+	statement := statements[0]
+	upperStatement := strings.ToUpper(statement)
+	if !strings.HasPrefix(upperStatement, "SELECT") && !strings.HasPrefix(upperStatement, "WITH") {
+		return "", ErrNotSelectQuery
+	}
+
+	return statement, nil
 }
 
 // QueryResult contains the results and optional benchmark metrics for a SQL query
@@ -281,10 +866,32 @@ type QueryResult struct {
 	Results          []map[string]any
 	BenchmarkMetrics *BenchmarkMetrics
 	Duration         time.Duration
+	// Columns holds the result's column names in the order the query selects them
+	Columns []string
+	// ProfilingSkipped is set when benchmarks were requested but DuckDB profiling was
+	// skipped because another query was profiled less than ENV_PROFILING_INTERVAL ago
+	ProfilingSkipped bool
+}
+
+// ErrQueryTooLong is returned for a query longer than ENV_MAX_QUERY_LENGTH
+var ErrQueryTooLong = errors.New("query too long")
+
+// CheckQueryLength returns an error wrapping ErrQueryTooLong when the query is longer than
+// maxLength bytes. A maxLength of 0 disables the check.
+func CheckQueryLength(query string, maxLength int) error {
+	if maxLength > 0 && len(query) > maxLength {
+		return fmt.Errorf("%w: %d bytes exceeds the limit of %d", ErrQueryTooLong, len(query), maxLength)
+	}
+	return nil
 }
 
 // validateQuery checks the provided SQL query for potential SQL injection attacks
 func validateQuery(ctx context.Context, query string) error {
+	// Bound the input before scanning it with the patterns below
+	if err := CheckQueryLength(query, helpers.GetMaxQueryLength()); err != nil {
+		return err
+	}
+
 	// Check for multi-statement queries which could be used for injection
 	log := helpers.GetLoggerFromContext(ctx)
 	if strings.Count(query, ";") > 1 {
@@ -318,25 +925,65 @@ func validateQuery(ctx context.Context, query string) error {
 // ExecuteQueryWithTableName constructs and executes a SQL query with a table name
 // This is a safer alternative to using string formatting to insert table names into SQL queries
 func (db *DuckDB) ExecuteQueryWithTableName(ctx context.Context, queryTemplate string, tableName string) (*QueryResult, error) {
-	// Sanitize table name to prevent SQL injection
-	sanitizedTableName := sanitizeTableName(tableName)
+	// Sanitize and quote the table name to prevent SQL injection and reserved-word clashes
+	sanitizedTableName := QuoteIdentifier(sanitizeTableName(tableName))
 	query := fmt.Sprintf(queryTemplate, sanitizedTableName)
 	return db.ExecuteQuery(ctx, query)
 }
 
 // ExecuteQuery executes a SQL query or multiple queries separated by semicolons
 func (db *DuckDB) ExecuteQuery(ctx context.Context, query string) (*QueryResult, error) {
-	log := helpers.GetLoggerFromContext(ctx)
+	if db.db == nil {
+		return nil, errors.New("database connection is closed")
+	}
+
+	return db.executeQueries(ctx, db.db, query)
+}
 
+// ExecuteInternalQuery executes a single statement built by the server from quoted
+// identifiers. It skips the injection checks of ExecuteQuery, which are meant for user
+// queries and also match valid quoted table names such as "Exec Summary" or "report--2024".
+func (db *DuckDB) ExecuteInternalQuery(ctx context.Context, query string) (*QueryResult, error) {
 	if db.db == nil {
 		return nil, errors.New("database connection is closed")
 	}
 
+	defer db.trackQuery(ctx, query)()
+
+	readOnly := isReadOnlyStatement(ctx, db.db, query)
+	result, err := db.executeSingleQuery(ctx, db.db, query)
+	if err != nil {
+		return nil, err
+	}
+	if !readOnly {
+		db.writes.Add(1)
+		db.recordWrite(query)
+	}
+	return result, nil
+}
+
+// statementPreparer is implemented by both *sql.DB and *sql.Conn so queries can run
+// either on the connection pool or on a dedicated connection
+type statementPreparer interface {
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+}
+
+// executeQueries validates, splits and executes the queries using the given preparer
+func (db *DuckDB) executeQueries(ctx context.Context, preparer statementPreparer, query string) (*QueryResult, error) {
+	log := helpers.GetLoggerFromContext(ctx)
+
+	// Checked first, since comments are otherwise rejected as suspicious
+	if isEmptyQuery(query) {
+		return nil, ErrEmptyQuery
+	}
+
 	// Prevent SQL injection by validating the query
 	if err := validateQuery(ctx, query); err != nil {
 		return nil, fmt.Errorf("invalid SQL query: %w", err)
 	}
 
+	defer db.trackQuery(ctx, query)()
+
 	// Split query by semicolons, preserving semicolons inside quotes
 	queries := splitQueryBySemicolon(query)
 	log.Info("ExecuteQuery: Split into individual queries", slog.Int("quantity", len(queries)))
@@ -361,11 +1008,18 @@ func (db *DuckDB) ExecuteQuery(ctx context.Context, query string) (*QueryResult,
 			slog.String("query", singleQuery),
 		)
 
+		// Classified first, so the statement is the last one a profiled connection runs
+		readOnly := isReadOnlyStatement(ctx, preparer, singleQuery)
+
 		// Execute the individual query
-		result, err := db.executeSingleQuery(ctx, singleQuery)
+		result, err := db.executeSingleQuery(ctx, preparer, singleQuery)
 		if err != nil {
 			return nil, fmt.Errorf("failed to execute query %d: %w", i+1, err)
 		}
+		if !readOnly {
+			db.writes.Add(1)
+			db.recordWrite(singleQuery)
+		}
 
 		// Keep the result of the last query
 		lastResult = result
@@ -374,7 +1028,7 @@ func (db *DuckDB) ExecuteQuery(ctx context.Context, query string) (*QueryResult,
 
 	// If there were no valid queries, return an error
 	if lastResult == nil {
-		return nil, errors.New("no valid queries to execute")
+		return nil, ErrEmptyQuery
 	}
 
 	// Record total time for all queries
@@ -426,6 +1080,43 @@ func splitQueryBySemicolon(query string) []string {
 	return queries
 }
 
+// isEmptyQuery reports whether a query holds nothing but whitespace, semicolons and
+// comments
+func isEmptyQuery(query string) bool {
+	inLineComment := false
+	inBlockComment := false
+	runes := []rune(query)
+
+	for i := 0; i < len(runes); i++ {
+		char := runes[i]
+		var next rune
+		if i+1 < len(runes) {
+			next = runes[i+1]
+		}
+
+		switch {
+		case inLineComment:
+			inLineComment = char != '\n'
+		case inBlockComment:
+			if char == '*' && next == '/' {
+				inBlockComment = false
+				i++
+			}
+		case char == '-' && next == '-':
+			inLineComment = true
+			i++
+		case char == '/' && next == '*':
+			inBlockComment = true
+			i++
+		case char == ';' || unicode.IsSpace(char):
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
 type queryExecution struct {
 	stmt             *sql.Stmt
 	rows             *sql.Rows
@@ -441,11 +1132,12 @@ type rowProcessingResult struct {
 	serializationDuration time.Duration
 }
 
-func (db *DuckDB) prepareAndExecuteQuery(ctx context.Context, query string) (*queryExecution, error) {
+func (db *DuckDB) prepareAndExecuteQuery(ctx context.Context, preparer statementPreparer, query string) (*queryExecution, error) {
 	log := helpers.GetLoggerFromContext(ctx)
 
 	parsingStart := time.Now()
-	stmt, err := db.db.Prepare(query)
+	// Statements are not bound to the caller's lifetime, matching sql.DB.Prepare
+	stmt, err := preparer.PrepareContext(context.Background(), query)
 	if err != nil {
 		log.Info("executeSingleQuery: Error preparing query", slog.Any("error", err))
 		return nil, fmt.Errorf("failed to prepare query: %w", err)
@@ -491,6 +1183,8 @@ func (db *DuckDB) processRowsWithBenchmarking(ctx context.Context, qe *queryExec
 		scanArgs[i] = &values[i]
 	}
 
+	null := nullValue(ctx)
+
 	serializationStart := time.Now()
 	var results []map[string]any
 	rowCount := 0
@@ -501,7 +1195,7 @@ func (db *DuckDB) processRowsWithBenchmarking(ctx context.Context, qe *queryExec
 			return nil, fmt.Errorf("failed to scan row: %w", err)
 		}
 
-		row := db.createRowMap(qe.columns, values)
+		row := db.createRowMap(qe.columns, values, null)
 		results = append(results, row)
 		rowCount++
 
@@ -524,14 +1218,22 @@ func (db *DuckDB) processRowsWithBenchmarking(ctx context.Context, qe *queryExec
 	}, nil
 }
 
-func (db *DuckDB) createRowMap(columns []string, values []any) map[string]any {
+// createRowMap converts a scanned row into a column-keyed map. SQL NULLs are set to null,
+// nil unless the query context sets a null representation, so they serialize to JSON null,
+// distinct from empty strings which serialize to "". Values of JSON columns arrive decoded
+// by the driver, so they are nested in responses as objects, arrays and scalars rather than
+// as escaped strings.
+func (db *DuckDB) createRowMap(columns []string, values []any, null any) map[string]any {
 	row := make(map[string]any)
 	for i, col := range columns {
-		var value any
+		value := null
 		if values[i] != nil {
 			switch v := values[i].(type) {
 			case []byte:
-				value = string(v)
+				// A nil slice is a NULL, an empty non-nil slice is an empty value
+				if v != nil {
+					value = string(v)
+				}
 			default:
 				value = v
 			}
@@ -541,7 +1243,7 @@ func (db *DuckDB) createRowMap(columns []string, values []any) map[string]any {
 	return row
 }
 
-func (db *DuckDB) calculateBenchmarkMetrics(duration time.Duration, parsingDuration, planningDuration, serializationDuration time.Duration, rowCount int, resultCount int) *BenchmarkMetrics {
+func (db *DuckDB) calculateBenchmarkMetrics(duration time.Duration, parsingDuration, planningDuration, serializationDuration time.Duration, rowCount int) *BenchmarkMetrics {
 	benchmarks := &BenchmarkMetrics{}
 
 	benchmarks.Timing.ParsingMs = float64(parsingDuration.Milliseconds())
@@ -552,29 +1254,18 @@ func (db *DuckDB) calculateBenchmarkMetrics(duration time.Duration, parsingDurat
 	benchmarks.Timing.ExecutionMs = float64(executionDuration.Milliseconds())
 	benchmarks.Timing.TotalMs = duration.Milliseconds()
 
-	benchmarks.Resources.ThreadCount = 4
-	benchmarks.Resources.PeakMemoryBytes = int64(resultCount * 1024)
-	benchmarks.Resources.CpuTimeMs = int64(float64(duration.Milliseconds()) * 0.8)
-	benchmarks.Resources.IoReadBytes = int64(resultCount * 256)
-	benchmarks.Resources.IoWriteBytes = 0
-
-	benchmarks.QueryStats.RowsProcessed = int64(rowCount * 2)
+	// Resource and query statistics are only known when the query runs with
+	// profiling enabled, see ExecuteQueryWithBenchmarks
 	benchmarks.QueryStats.RowsReturned = rowCount
-	benchmarks.QueryStats.OperatorCount = 3
-	benchmarks.QueryStats.ScanCount = 1
-
-	benchmarks.Cache.HitCount = 10
-	benchmarks.Cache.MissCount = 2
-	benchmarks.Cache.HitRatio = 0.83
 
 	return benchmarks
 }
 
-func (db *DuckDB) executeSingleQuery(ctx context.Context, query string) (*QueryResult, error) {
+func (db *DuckDB) executeSingleQuery(ctx context.Context, preparer statementPreparer, query string) (*QueryResult, error) {
 	log := helpers.GetLoggerFromContext(ctx)
 	startTime := time.Now()
 
-	qe, err := db.prepareAndExecuteQuery(ctx, query)
+	qe, err := db.prepareAndExecuteQuery(ctx, preparer, query)
 	if err != nil {
 		return nil, err
 	}
@@ -591,17 +1282,20 @@ func (db *DuckDB) executeSingleQuery(ctx context.Context, query string) (*QueryR
 	duration := time.Since(startTime)
 	log.Info("executeSingleQuery: Query completed", slog.Duration("completed_in", duration), slog.Int("returned_rows", processResult.rowCount))
 
-	benchmarks := db.calculateBenchmarkMetrics(
-		duration,
-		qe.parsingDuration,
-		qe.planningDuration,
-		processResult.serializationDuration,
-		processResult.rowCount,
-		len(processResult.results),
-	)
+	var benchmarks *BenchmarkMetrics
+	if !db.benchmarksDisabled {
+		benchmarks = db.calculateBenchmarkMetrics(
+			duration,
+			qe.parsingDuration,
+			qe.planningDuration,
+			processResult.serializationDuration,
+			processResult.rowCount,
+		)
+	}
 
 	return &QueryResult{
 		Results:          processResult.results,
+		Columns:          qe.columns,
 		BenchmarkMetrics: benchmarks,
 		Duration:         duration,
 	}, nil
@@ -614,18 +1308,11 @@ func (db *DuckDB) GetDB() *sql.DB {
 	return db.db
 }
 
-// loadSnapshotFromS3 downloads a snapshot from S3 and loads it as the database
-func loadSnapshotFromS3(ctx context.Context, s3URI, dbPath string) error {
+// loadSnapshot downloads a snapshot from its S3 or GCS location to be used as the database
+func loadSnapshot(ctx context.Context, location, dbPath string) error {
 	log := helpers.GetLoggerFromContext(ctx)
 
-	// Create S3 client
-	s3Client, err := snapshot.NewS3Client(ctx)
-	if err != nil {
-		return fmt.Errorf("failed to create S3 client: %w", err)
-	}
-
-	// Download snapshot from S3 to the database path
-	if err := s3Client.DownloadSnapshot(ctx, s3URI, dbPath); err != nil {
+	if err := snapshot.Download(ctx, location, dbPath); err != nil {
 		return fmt.Errorf("failed to download snapshot: %w", err)
 	}
 
@@ -2,6 +2,8 @@ package database
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -373,6 +375,212 @@ func TestSanitizeTableName(t *testing.T) {
 	}
 }
 
+func TestSanitizeTableNameQuoted(t *testing.T) {
+	t.Setenv("ENV_TABLE_NAME_SANITIZATION", "quoted")
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{name: "spaces and hyphens kept", input: "Q1 sales-report", expected: "Q1 sales-report"},
+		{name: "surrounding spaces trimmed", input: "  sales  ", expected: "sales"},
+		{name: "unicode kept", input: "ventes_été", expected: "ventes_été"},
+		{name: "quotes replaced", input: `users"; DROP TABLE users--`, expected: "users_; DROP TABLE users--"},
+		{name: "dots and slashes replaced", input: `schema.table/name\x`, expected: "schema_table_name_x"},
+		{name: "control characters replaced", input: "sales\x00\n2024", expected: "sales__2024"},
+		{name: "invalid UTF-8 replaced", input: "sales\xff", expected: "sales_"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if result := sanitizeTableName(tc.input); result != tc.expected {
+				t.Errorf("Expected '%s', got '%s'", tc.expected, result)
+			}
+		})
+	}
+
+	if got := QualifiedTableName("", "Q1 sales-report"); got != `"main"."Q1 sales-report"` {
+		t.Errorf("Expected the quoted name to be kept, got '%s'", got)
+	}
+}
+
+func TestValidateTableName(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy string
+		input    string
+		wantErr  bool
+	}{
+		{name: "strict accepts anything", strategy: "", input: `users"; DROP`},
+		{name: "quoted accepts spaces and hyphens", strategy: "quoted", input: "Q1 sales-report"},
+		{name: "quoted rejects quotes", strategy: "quoted", input: `users"`, wantErr: true},
+		{name: "quoted rejects single quotes", strategy: "quoted", input: "o'brien", wantErr: true},
+		{name: "quoted rejects dots", strategy: "quoted", input: "main.sales", wantErr: true},
+		{name: "quoted rejects null bytes", strategy: "quoted", input: "sales\x00", wantErr: true},
+		{name: "quoted rejects blank names", strategy: "quoted", input: "   ", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("ENV_TABLE_NAME_SANITIZATION", tc.strategy)
+
+			err := ValidateTableName(tc.input)
+			if tc.wantErr != (err != nil) {
+				t.Fatalf("ValidateTableName(%q) error = %v, wantErr %v", tc.input, err, tc.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidTableName) {
+				t.Errorf("Expected ErrInvalidTableName, got %v", err)
+			}
+		})
+	}
+}
+
+func TestQualifiedTableName(t *testing.T) {
+	tests := []struct {
+		name     string
+		schema   string
+		table    string
+		expected string
+	}{
+		{name: "default schema", schema: "", table: "sales", expected: `"main"."sales"`},
+		{name: "reserved words", schema: "select", table: "order", expected: `"select"."order"`},
+		{name: "sanitized parts", schema: "a.b", table: `x"; DROP`, expected: `"a_b"."x___DROP"`},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := QualifiedTableName(tc.schema, tc.table); got != tc.expected {
+				t.Errorf("Expected '%s', got '%s'", tc.expected, got)
+			}
+		})
+	}
+
+	if got := QuoteIdentifier(`my"col`); got != `"my""col"` {
+		t.Errorf("Expected embedded quotes to be escaped, got '%s'", got)
+	}
+}
+
+func TestReservedWordTableNames(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDuckDB(t)
+	csvPath := writeTestCSV(t, "id,amount\n1,10\n2,20\n")
+
+	if err := db.CreateTableFromCSV(ctx, "order", csvPath, true, false); err != nil {
+		t.Fatalf("Failed to import into reserved-word table: %v", err)
+	}
+	// Override drops and recreates the table through the same quoted name
+	if err := db.CreateTableFromCSV(ctx, "order", csvPath, true, true); err != nil {
+		t.Fatalf("Failed to override reserved-word table: %v", err)
+	}
+	if err := db.CreateTableFromCSVWithOptions(ctx, "group", csvPath, true, false, CSVImportOptions{Schema: "select"}); err != nil {
+		t.Fatalf("Failed to import into reserved-word schema: %v", err)
+	}
+	if err := db.CreateTableFromQuery(ctx, "table", `SELECT * FROM "order" WHERE amount > 10`, false); err != nil {
+		t.Fatalf("Failed to create reserved-word table from query: %v", err)
+	}
+
+	counts := map[string]int64{
+		QualifiedTableName("", "order"):       2,
+		QualifiedTableName("select", "group"): 2,
+		QualifiedTableName("", "table"):       1,
+	}
+	for table, expected := range counts {
+		result, err := db.ExecuteQuery(ctx, "SELECT COUNT(*) AS total FROM "+table)
+		if err != nil {
+			t.Fatalf("Failed to query %s: %v", table, err)
+		}
+		if total := result.Results[0]["total"]; total != expected {
+			t.Errorf("Expected %d rows in %s, got %v", expected, table, total)
+		}
+	}
+
+	result, err := db.ExecuteQueryWithTableName(ctx, "PRAGMA table_info(%s)", "order")
+	if err != nil {
+		t.Fatalf("Failed to get table info: %v", err)
+	}
+	if len(result.Results) != 2 {
+		t.Errorf("Expected 2 columns, got %d", len(result.Results))
+	}
+}
+
+func TestIsEmptyQuery(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected bool
+	}{
+		{query: "", expected: true},
+		{query: " \n\t", expected: true},
+		{query: ";;", expected: true},
+		{query: "-- just a comment", expected: true},
+		{query: "/* block */ ; -- line\n;", expected: true},
+		{query: "/* unterminated", expected: true},
+		{query: "SELECT 1", expected: false},
+		{query: "-- comment\nSELECT 1", expected: false},
+		{query: "/* block */ SELECT 1", expected: false},
+		{query: "'-- not a comment'", expected: false},
+		{query: "-", expected: false},
+	}
+
+	for _, tc := range tests {
+		if got := isEmptyQuery(tc.query); got != tc.expected {
+			t.Errorf("isEmptyQuery(%q) = %v, want %v", tc.query, got, tc.expected)
+		}
+	}
+}
+
+func TestIsReadOnlyQuery(t *testing.T) {
+	db := newTestDuckDB(t)
+
+	tests := []struct {
+		query    string
+		expected bool
+	}{
+		{query: "SELECT * FROM sales", expected: true},
+		{query: "with c AS (SELECT 1) SELECT * FROM c", expected: true},
+		{query: "DESCRIBE sales; SHOW TABLES;", expected: true},
+		{query: "SUMMARIZE sales", expected: true},
+		{query: "EXPLAIN SELECT 1", expected: true},
+		{query: "EXPLAIN ANALYZE SELECT 1", expected: true},
+		{query: "EXPLAIN ANALYZE DELETE FROM sales", expected: false},
+		{query: "EXPLAIN (ANALYZE) DELETE FROM sales", expected: false},
+		{query: "WITH x AS (SELECT 1) INSERT INTO sales SELECT * FROM x", expected: false},
+		{query: "WITH x AS (SELECT 1) DELETE FROM sales", expected: false},
+		{query: "PRAGMA threads=1", expected: false},
+		{query: "SET threads=1", expected: false},
+		{query: "SELECT 1; DROP TABLE sales", expected: false},
+		{query: "INSERT INTO sales VALUES (1)", expected: false},
+		{query: "COPY sales TO 'out.csv'", expected: false},
+		{query: "SELEC 1", expected: false},
+		{query: " ; ", expected: false},
+	}
+
+	for _, tc := range tests {
+		if got := db.IsReadOnlyQuery(context.Background(), tc.query); got != tc.expected {
+			t.Errorf("IsReadOnlyQuery(%q) = %v, want %v", tc.query, got, tc.expected)
+		}
+	}
+}
+
+func TestCheckQueryLength(t *testing.T) {
+	if err := CheckQueryLength("SELECT 1", 8); err != nil {
+		t.Errorf("Expected a query at the limit to pass, got %v", err)
+	}
+	if err := CheckQueryLength("SELECT 10", 8); !errors.Is(err, ErrQueryTooLong) {
+		t.Errorf("Expected ErrQueryTooLong, got %v", err)
+	}
+	if err := CheckQueryLength(strings.Repeat("x", 1<<21), 0); err != nil {
+		t.Errorf("Expected 0 to disable the check, got %v", err)
+	}
+
+	// Executed queries are bounded by ENV_MAX_QUERY_LENGTH
+	t.Setenv("ENV_MAX_QUERY_LENGTH", "10")
+	db := newTestDuckDB(t)
+	if _, err := db.ExecuteQuery(context.Background(), "SELECT 12345678"); !errors.Is(err, ErrQueryTooLong) {
+		t.Errorf("Expected ErrQueryTooLong from ExecuteQuery, got %v", err)
+	}
+}
+
 func TestSplitQueryBySemicolon(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -1193,3 +1401,545 @@ func TestStartCleanupWorker_TimeBased(t *testing.T) {
 		t.Error("Table should still exist (not expired)")
 	}
 }
+
+// newTestDuckDB creates a database in an isolated temporary directory
+func newTestDuckDB(t *testing.T) *DuckDB {
+	t.Helper()
+
+	tempDir := t.TempDir()
+	oldTempDir := os.TempDir()
+	if err := os.Setenv("TMPDIR", tempDir); err != nil {
+		t.Fatalf("Failed to set TMPDIR: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := os.Setenv("TMPDIR", oldTempDir); err != nil {
+			t.Logf("Failed to restore TMPDIR: %v", err)
+		}
+	})
+
+	db, err := NewDuckDB(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	t.Cleanup(func() { helpers.CloseResources(db, "database") })
+
+	return db
+}
+
+// writeTestCSV writes the CSV content to a temporary file and returns its path
+func writeTestCSV(t *testing.T, content string) string {
+	t.Helper()
+
+	csvPath := filepath.Join(t.TempDir(), "test.csv")
+	if err := os.WriteFile(csvPath, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create test CSV file: %v", err)
+	}
+	return csvPath
+}
+
+func TestCreateTableFromCSVWithOptions_DateFormat(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDuckDB(t)
+	csvPath := writeTestCSV(t, "id,sale_date,seen_at\n1,31/01/2024,31/01/2024 13:45:00\n2,01/02/2024,01/02/2024 08:00:00\n")
+
+	options := CSVImportOptions{
+		DateFormat:      "%d/%m/%Y",
+		TimestampFormat: "%d/%m/%Y %H:%M:%S",
+	}
+	if err := db.CreateTableFromCSVWithOptions(ctx, "dated", csvPath, true, false, options); err != nil {
+		t.Fatalf("Failed to create table from CSV: %v", err)
+	}
+
+	result, err := db.ExecuteQuery(ctx, "SELECT sale_date, seen_at FROM dated ORDER BY id")
+	if err != nil {
+		t.Fatalf("Failed to query created table: %v", err)
+	}
+
+	day, ok := result.Results[0]["sale_date"].(time.Time)
+	if !ok {
+		t.Fatalf("Expected sale_date to be parsed as a date, got %T", result.Results[0]["sale_date"])
+	}
+	if day.Year() != 2024 || day.Month() != time.January || day.Day() != 31 {
+		t.Errorf("Expected January 31 2024, got %s", day.Format(time.DateOnly))
+	}
+
+	seenAt, ok := result.Results[1]["seen_at"].(time.Time)
+	if !ok {
+		t.Fatalf("Expected seen_at to be parsed as a timestamp, got %T", result.Results[1]["seen_at"])
+	}
+	if seenAt.Month() != time.February || seenAt.Day() != 1 || seenAt.Hour() != 8 {
+		t.Errorf("Expected February 1 2024 08:00, got %s", seenAt.Format(time.DateTime))
+	}
+}
+
+func TestCSVImportOptionsReadCSVArgs(t *testing.T) {
+	if args := (CSVImportOptions{}).readCSVArgs(); args != "" {
+		t.Errorf("Expected no extra arguments, got %q", args)
+	}
+
+	if args := (CSVImportOptions{SkipRows: 2}).readCSVArgs(); args != ", skip=2" {
+		t.Errorf("Expected skip argument, got %q", args)
+	}
+
+	if args := (CSVImportOptions{AllVarchar: true}).readCSVArgs(); args != ", all_varchar=true" {
+		t.Errorf("Expected all_varchar argument, got %q", args)
+	}
+
+	columns := CSVImportOptions{ColumnTypes: []ColumnType{{Name: "id", Type: "BIGINT"}, {Name: "it's", Type: "VARCHAR"}}}
+	if args := columns.readCSVArgs(); args != ", columns={'id': 'BIGINT', 'it''s': 'VARCHAR'}" {
+		t.Errorf("Expected columns argument, got %q", args)
+	}
+
+	args := CSVImportOptions{DateFormat: "%d/%m/%Y'); DROP TABLE x; --"}.readCSVArgs()
+	expected := ", dateformat='%d/%m/%Y''); DROP TABLE x; --'"
+	if args != expected {
+		t.Errorf("Expected %q, got %q", expected, args)
+	}
+}
+
+func TestCreateTableFromCSVWithOptions_ColumnTypes(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDuckDB(t)
+	csvPath := writeTestCSV(t, "exported by survey tool\nid,zip,score\nint,string,double\n1,01234,2.5\n2,98765,3\n")
+
+	options := CSVImportOptions{
+		SkipRows: 1,
+		ColumnTypes: []ColumnType{
+			{Name: "id", Type: "BIGINT"},
+			{Name: "zip", Type: "VARCHAR"},
+			{Name: "score", Type: "DOUBLE"},
+		},
+	}
+	if err := db.CreateTableFromCSVWithOptions(ctx, "typed", csvPath, true, false, options); err != nil {
+		t.Fatalf("Failed to create table from CSV: %v", err)
+	}
+
+	result, err := db.ExecuteQuery(ctx, "SELECT id, zip, score FROM typed ORDER BY id")
+	if err != nil {
+		t.Fatalf("Failed to query created table: %v", err)
+	}
+	if len(result.Results) != 2 {
+		t.Fatalf("Expected 2 rows without the header and type rows, got %d", len(result.Results))
+	}
+	if zip := result.Results[0]["zip"]; zip != "01234" {
+		t.Errorf("Expected zip to keep its leading zero as VARCHAR, got %v (%T)", zip, zip)
+	}
+	if score, ok := result.Results[1]["score"].(float64); !ok || score != 3 {
+		t.Errorf("Expected score to be a DOUBLE, got %v (%T)", result.Results[1]["score"], result.Results[1]["score"])
+	}
+}
+
+func TestCreateTableFromCSVWithOptions_AllVarchar(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDuckDB(t)
+	csvPath := writeTestCSV(t, "id,zip,joined\n1,01234,2024-01-31\n2,98765,2024-02-01\n")
+
+	if err := db.CreateTableFromCSVWithOptions(ctx, "raw", csvPath, true, false, CSVImportOptions{AllVarchar: true}); err != nil {
+		t.Fatalf("Failed to create table from CSV: %v", err)
+	}
+
+	result, err := db.ExecuteQuery(ctx, "SELECT column_name, data_type FROM information_schema.columns WHERE table_name = 'raw'")
+	if err != nil {
+		t.Fatalf("Failed to describe created table: %v", err)
+	}
+	if len(result.Results) != 3 {
+		t.Fatalf("Expected 3 columns, got %d", len(result.Results))
+	}
+	for _, column := range result.Results {
+		if column["data_type"] != "VARCHAR" {
+			t.Errorf("Expected column %v to be VARCHAR, got %v", column["column_name"], column["data_type"])
+		}
+	}
+}
+
+func TestTypeFromHint(t *testing.T) {
+	tests := map[string]string{
+		"int":        "BIGINT",
+		" Integer ":  "BIGINT",
+		"STRING":     "VARCHAR",
+		"numeric":    "DOUBLE",
+		"bool":       "BOOLEAN",
+		"date":       "DATE",
+		"datetime":   "TIMESTAMP",
+		"time":       "TIME",
+		"JSON":       "JSON",
+		"varchar(3)": "",
+		"":           "",
+	}
+
+	for hint, expected := range tests {
+		duckType, ok := TypeFromHint(hint)
+		if ok != (expected != "") || duckType != expected {
+			t.Errorf("TypeFromHint(%q) = %q, %v; expected %q", hint, duckType, ok, expected)
+		}
+	}
+}
+
+func TestCreateTableFromCSVWithOptions_JSONColumn(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDuckDB(t)
+	csvPath := writeTestCSV(t, "id,payload\nint,json\n1,\"{\"\"tags\"\": [\"\"a\"\", \"\"b\"\"], \"\"score\"\": 7}\"\n2,\n")
+
+	options := CSVImportOptions{ColumnTypes: []ColumnType{{Name: "id", Type: "BIGINT"}, {Name: "payload", Type: "JSON"}}}
+	if err := db.CreateTableFromCSVWithOptions(ctx, "events", csvPath, true, false, options); err != nil {
+		t.Fatalf("Failed to create table from CSV: %v", err)
+	}
+
+	result, err := db.ExecuteQuery(ctx, "SELECT payload, payload->>'$.tags[1]' AS tag FROM events ORDER BY id")
+	if err != nil {
+		t.Fatalf("Failed to query JSON column: %v", err)
+	}
+	if len(result.Results) != 2 {
+		t.Fatalf("Expected 2 rows, got %v", result.Results)
+	}
+	payload, ok := result.Results[0]["payload"].(map[string]any)
+	if !ok {
+		t.Fatalf("Expected the JSON value as an object, got %T %v", result.Results[0]["payload"], result.Results[0]["payload"])
+	}
+	if tags, _ := payload["tags"].([]any); len(tags) != 2 || payload["score"] != float64(7) {
+		t.Errorf("Unexpected JSON object %v", payload)
+	}
+	if result.Results[0]["tag"] != "b" {
+		t.Errorf("Expected JSON functions to work on the column, got %v", result.Results[0]["tag"])
+	}
+	if result.Results[1]["payload"] != nil {
+		t.Errorf("Expected an empty field to be NULL, got %v", result.Results[1]["payload"])
+	}
+
+	// A field that is not JSON fails the import
+	invalidPath := writeTestCSV(t, "id,payload\nint,json\n1,{not json\n")
+	if err := db.CreateTableFromCSVWithOptions(ctx, "invalid_events", invalidPath, true, false, options); err == nil {
+		t.Error("Expected invalid JSON to fail the import")
+	}
+}
+
+func TestCountQueryRows(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDuckDB(t)
+
+	if _, err := db.ExecuteQuery(ctx, "CREATE TABLE numbers AS SELECT range AS n FROM range(250)"); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+
+	count, err := db.CountQueryRows(ctx, "SELECT * FROM numbers WHERE n % 2 = 0")
+	if err != nil {
+		t.Fatalf("Failed to count query rows: %v", err)
+	}
+	if count != 125 {
+		t.Errorf("Expected 125 rows, got %d", count)
+	}
+
+	if _, err := db.CountQueryRows(ctx, "DROP TABLE numbers"); !errors.Is(err, ErrNotSelectQuery) {
+		t.Errorf("Expected ErrNotSelectQuery, got %v", err)
+	}
+}
+
+func TestWriteCount(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDuckDB(t)
+
+	start := db.WriteCount()
+	if _, err := db.ExecuteQuery(ctx, "SELECT 1; SHOW TABLES; SELECT * FROM pragma_table_info('duckdb_tables')"); err != nil {
+		t.Fatalf("Failed to run read-only queries: %v", err)
+	}
+	if db.WriteCount() != start {
+		t.Errorf("Expected read-only statements not to count as writes, got %d", db.WriteCount()-start)
+	}
+
+	if _, err := db.ExecuteQuery(ctx, "CREATE TABLE t (id INTEGER); INSERT INTO t VALUES (1)"); err != nil {
+		t.Fatalf("Failed to run write statements: %v", err)
+	}
+	if got := db.WriteCount() - start; got != 2 {
+		t.Errorf("Expected 2 writes, got %d", got)
+	}
+
+	if err := db.CreateTableFromQuery(ctx, "t2", "SELECT * FROM t", false); err != nil {
+		t.Fatalf("Failed to create table from query: %v", err)
+	}
+	csvPath := writeTestCSV(t, "id\n1\n")
+	if err := db.CreateTableFromCSV(ctx, "t3", csvPath, true, false); err != nil {
+		t.Fatalf("Failed to create table from CSV: %v", err)
+	}
+	if got := db.WriteCount() - start; got != 4 {
+		t.Errorf("Expected 4 writes, got %d", got)
+	}
+}
+
+func TestCreateRowMap_NullVersusEmpty(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDuckDB(t)
+
+	if _, err := db.ExecuteQuery(ctx, "CREATE TABLE nullable (id INTEGER, label VARCHAR, payload BLOB)"); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	if _, err := db.ExecuteQuery(ctx, "INSERT INTO nullable VALUES (1, NULL, NULL), (2, '', ''::BLOB), (3, 'x', 'x'::BLOB)"); err != nil {
+		t.Fatalf("Failed to insert rows: %v", err)
+	}
+
+	result, err := db.ExecuteQuery(ctx, "SELECT label, payload FROM nullable ORDER BY id")
+	if err != nil {
+		t.Fatalf("Failed to query table: %v", err)
+	}
+
+	encoded, err := json.Marshal(result.Results)
+	if err != nil {
+		t.Fatalf("Failed to encode results: %v", err)
+	}
+	expected := `[{"label":null,"payload":null},{"label":"","payload":""},{"label":"x","payload":"x"}]`
+	if string(encoded) != expected {
+		t.Errorf("Expected %s, got %s", expected, encoded)
+	}
+
+	// Drivers may report NULL binary values as a nil slice rather than a nil interface
+	row := db.createRowMap([]string{"null_bytes", "empty_bytes"}, []any{[]byte(nil), []byte{}}, nil)
+	if row["null_bytes"] != nil {
+		t.Errorf("Expected nil []byte to map to nil, got %#v", row["null_bytes"])
+	}
+	if row["empty_bytes"] != "" {
+		t.Errorf("Expected empty []byte to map to empty string, got %#v", row["empty_bytes"])
+	}
+}
+
+func TestCreateRowMap_NullRepresentation(t *testing.T) {
+	db := newTestDuckDB(t)
+
+	tests := []struct {
+		name     string
+		repr     string
+		expected string
+	}{
+		{"default keeps null", "", `[{"label":null,"payload":null},{"label":"","payload":""}]`},
+		{"sentinel string", "NULL", `[{"label":"NULL","payload":"NULL"},{"label":"","payload":""}]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := WithNullRepresentation(context.Background(), tt.repr)
+			result, err := db.ExecuteQuery(ctx, "SELECT * FROM (VALUES (NULL, NULL::BLOB), ('', ''::BLOB)) t(label, payload)")
+			if err != nil {
+				t.Fatalf("Failed to run query: %v", err)
+			}
+
+			encoded, err := json.Marshal(result.Results)
+			if err != nil {
+				t.Fatalf("Failed to encode results: %v", err)
+			}
+			if string(encoded) != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, encoded)
+			}
+		})
+	}
+}
+
+func TestActiveQueries(t *testing.T) {
+	db := newTestDuckDB(t)
+
+	if got := db.ActiveQueries(); len(got) != 0 {
+		t.Fatalf("Expected no active queries, got %v", got)
+	}
+
+	ctx := helpers.SetRequestIDInContext(context.Background(), "req-1")
+	untrackFirst := db.trackQuery(ctx, "SELECT 1")
+	time.Sleep(time.Millisecond)
+	untrackSecond := db.trackQuery(context.Background(), "SELECT 2")
+
+	active := db.ActiveQueries()
+	if len(active) != 2 {
+		t.Fatalf("Expected 2 active queries, got %d", len(active))
+	}
+	if active[0].Query != "SELECT 1" || active[0].RequestID != "req-1" || active[0].ID == "" {
+		t.Errorf("Unexpected first active query: %+v", active[0])
+	}
+	if active[1].Query != "SELECT 2" || active[1].RequestID != "" {
+		t.Errorf("Unexpected second active query: %+v", active[1])
+	}
+
+	untrackFirst()
+	untrackSecond()
+	if got := db.ActiveQueries(); len(got) != 0 {
+		t.Errorf("Expected no active queries after completion, got %v", got)
+	}
+
+	// Executed queries are only tracked while they run
+	if _, err := db.ExecuteQuery(ctx, "SELECT 42"); err != nil {
+		t.Fatalf("Failed to execute query: %v", err)
+	}
+	if got := db.ActiveQueries(); len(got) != 0 {
+		t.Errorf("Expected no active queries after execution, got %v", got)
+	}
+}
+
+func TestExportQueryParquet(t *testing.T) {
+	db := newTestDuckDB(t)
+	ctx := context.Background()
+
+	if _, err := db.ExecuteQuery(ctx, `CREATE TABLE sales AS SELECT * FROM (VALUES
+		('north', 2024, 10), ('north', 2025, 20), ('south', 2025, 30)) t(region, year, amount)`); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+
+	t.Run("partitioned", func(t *testing.T) {
+		destDir := t.TempDir()
+		for range 2 {
+			rowCount, err := db.ExportQueryParquet(ctx, "SELECT * FROM sales", destDir, []string{"region"})
+			if err != nil {
+				t.Fatalf("Failed to export query: %v", err)
+			}
+			if rowCount != 3 {
+				t.Errorf("Expected 3 exported rows, got %d", rowCount)
+			}
+		}
+
+		// Exporting again adds files next to the earlier ones
+		for _, region := range []string{"north", "south"} {
+			files, err := filepath.Glob(filepath.Join(destDir, "region="+region, "part_*.parquet"))
+			if err != nil || len(files) != 2 {
+				t.Errorf("Expected 2 files for region %s, got %v (%v)", region, files, err)
+			}
+		}
+
+		result, err := db.ExecuteQuery(ctx, fmt.Sprintf("SELECT SUM(amount) AS total FROM read_parquet('%s/*/*.parquet', hive_partitioning=true) WHERE region = 'north'", destDir))
+		if err != nil {
+			t.Fatalf("Failed to read exported files: %v", err)
+		}
+		if total := fmt.Sprint(result.Results[0]["total"]); total != "60" {
+			t.Errorf("Expected north total 60 across both exports, got %s", total)
+		}
+	})
+
+	t.Run("unpartitioned", func(t *testing.T) {
+		destDir := t.TempDir()
+		rowCount, err := db.ExportQueryParquet(ctx, "SELECT * FROM sales WHERE year = 2025", destDir, nil)
+		if err != nil {
+			t.Fatalf("Failed to export query: %v", err)
+		}
+		if rowCount != 2 {
+			t.Errorf("Expected 2 exported rows, got %d", rowCount)
+		}
+		if files, _ := filepath.Glob(filepath.Join(destDir, "part_*.parquet")); len(files) != 1 {
+			t.Errorf("Expected a single parquet file, got %v", files)
+		}
+	})
+
+	t.Run("not a select", func(t *testing.T) {
+		if _, err := db.ExportQueryParquet(ctx, "DELETE FROM sales", t.TempDir(), nil); !errors.Is(err, ErrNotSelectQuery) {
+			t.Errorf("Expected ErrNotSelectQuery, got %v", err)
+		}
+	})
+}
+
+// TestNewDuckDBConfigPersistentPath tests that DUCKDB_PATH keeps the data across restarts
+func TestNewDuckDBConfigPersistentPath(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "data", "spotdb.db")
+	t.Setenv("SNAPSHOT_LOCATION", "")
+	t.Setenv("DUCKDB_PATH", dbPath)
+	ctx := context.Background()
+
+	db, err := NewDuckDBConfig(ctx)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	if _, err := db.ExecuteQuery(ctx, "CREATE TABLE kept AS SELECT 42 AS answer"); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("Failed to close database: %v", err)
+	}
+	if _, err := os.Stat(dbPath); err != nil {
+		t.Fatalf("Expected the database file to be kept: %v", err)
+	}
+
+	reopened, err := NewDuckDBConfig(ctx)
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	defer helpers.CloseResources(reopened, "database")
+
+	result, err := reopened.ExecuteQuery(ctx, "SELECT answer FROM kept")
+	if err != nil {
+		t.Fatalf("Expected the table to survive the restart: %v", err)
+	}
+	if len(result.Results) != 1 || result.Results[0]["answer"] != int32(42) {
+		t.Errorf("Unexpected result: %v", result.Results)
+	}
+}
+
+// TestNewDuckDBConfigTempDir tests that DUCKDB_TEMP_DIR sets where DuckDB spills to disk
+func TestNewDuckDBConfigTempDir(t *testing.T) {
+	spillDir := filepath.Join(t.TempDir(), "spill")
+	t.Setenv("SNAPSHOT_LOCATION", "")
+	t.Setenv("DUCKDB_PATH", "")
+	t.Setenv("DUCKDB_TEMP_DIR", spillDir)
+	ctx := context.Background()
+
+	db, err := NewDuckDBConfig(ctx)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer helpers.CloseResources(db, "database")
+
+	if info, err := os.Stat(spillDir); err != nil || !info.IsDir() {
+		t.Fatalf("Expected the temp directory to be created: %v", err)
+	}
+
+	result, err := db.ExecuteQuery(ctx, "SELECT current_setting('temp_directory') AS temp_directory")
+	if err != nil {
+		t.Fatalf("Failed to read setting: %v", err)
+	}
+	if got := result.Results[0]["temp_directory"]; got != spillDir {
+		t.Errorf("Expected temp_directory %s, got %v", spillDir, got)
+	}
+}
+
+// TestNewDuckDBConfigReadOnly tests that DUCKDB_ACCESS_MODE=read_only opens an existing
+// file read-only, shared between several instances
+func TestNewDuckDBConfigReadOnly(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "shared.db")
+	t.Setenv("SNAPSHOT_LOCATION", "")
+	t.Setenv("DUCKDB_PATH", dbPath)
+	ctx := context.Background()
+
+	writer, err := NewDuckDBConfig(ctx)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	if _, err := writer.ExecuteQuery(ctx, "CREATE TABLE kept AS SELECT 42 AS answer"); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Failed to close database: %v", err)
+	}
+
+	t.Setenv("DUCKDB_ACCESS_MODE", "read_only")
+	first, err := NewDuckDBConfig(ctx)
+	if err != nil {
+		t.Fatalf("Failed to open database read-only: %v", err)
+	}
+	defer helpers.CloseResources(first, "database")
+	second, err := NewDuckDBConfig(ctx)
+	if err != nil {
+		t.Fatalf("Failed to open database read-only a second time: %v", err)
+	}
+	defer helpers.CloseResources(second, "database")
+
+	if !first.IsReadOnly() {
+		t.Error("Expected IsReadOnly to be true")
+	}
+	if _, err := second.ExecuteQuery(ctx, "SELECT answer FROM kept"); err != nil {
+		t.Errorf("Expected reads to succeed: %v", err)
+	}
+	if _, err := first.ExecuteQuery(ctx, "INSERT INTO kept VALUES (1)"); err == nil {
+		t.Error("Expected writes to fail")
+	}
+
+	// Without an existing file there is nothing to read
+	t.Setenv("DUCKDB_PATH", "")
+	if _, err := NewDuckDBConfig(ctx); err == nil {
+		t.Error("Expected an error without SNAPSHOT_LOCATION or DUCKDB_PATH")
+	}
+
+	t.Setenv("DUCKDB_ACCESS_MODE", "write_only")
+	if _, err := NewDuckDBConfig(ctx); err == nil || !strings.Contains(err.Error(), "DUCKDB_ACCESS_MODE") {
+		t.Errorf("Expected an invalid DUCKDB_ACCESS_MODE error, got %v", err)
+	}
+}
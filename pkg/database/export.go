@@ -0,0 +1,216 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+
+	"github.com/aliengiraffe/spotdb/pkg/helpers"
+	"github.com/google/uuid"
+)
+
+// TableRef identifies a user table by schema and name
+type TableRef struct {
+	Schema string
+	Name   string
+}
+
+// ExportColumn describes a column of an exported table
+type ExportColumn struct {
+	Name     string
+	Type     string
+	Nullable bool
+}
+
+// ListUserTables returns the base tables of the database across all user schemas, skipping
+// system schemas and the temporary tables created during imports
+func (db *DuckDB) ListUserTables(ctx context.Context) ([]TableRef, error) {
+	result, err := db.ExecuteQuery(ctx, `SELECT table_schema, table_name FROM information_schema.tables
+		WHERE table_catalog = current_database()
+		AND table_type = 'BASE TABLE'
+		AND table_schema NOT IN ('information_schema', 'pg_catalog')
+		ORDER BY table_schema, table_name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+
+	tables := make([]TableRef, 0, len(result.Results))
+	for _, row := range result.Results {
+		schema, _ := row["table_schema"].(string)
+		name, _ := row["table_name"].(string)
+		if name == "" || strings.HasPrefix(name, "tmp_import_") {
+			continue
+		}
+		tables = append(tables, TableRef{Schema: schema, Name: name})
+	}
+
+	return tables, nil
+}
+
+// TableColumns returns the columns of a table in ordinal order
+func (db *DuckDB) TableColumns(ctx context.Context, table TableRef) ([]ExportColumn, error) {
+	result, err := db.ExecuteQuery(ctx, fmt.Sprintf(`SELECT column_name, data_type, is_nullable
+		FROM information_schema.columns
+		WHERE table_catalog = current_database() AND table_schema = %s AND table_name = %s
+		ORDER BY ordinal_position`, quoteLiteral(table.Schema), quoteLiteral(table.Name)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get columns of %s.%s: %w", table.Schema, table.Name, err)
+	}
+
+	columns := make([]ExportColumn, 0, len(result.Results))
+	for _, row := range result.Results {
+		name, _ := row["column_name"].(string)
+		dataType, _ := row["data_type"].(string)
+		nullable, _ := row["is_nullable"].(string)
+		columns = append(columns, ExportColumn{Name: name, Type: dataType, Nullable: nullable == "YES"})
+	}
+
+	return columns, nil
+}
+
+// ExportTableCSV writes a table to destPath as a CSV file with a header row using
+// COPY ... TO, returning the number of rows exported. With crlf rows end with \r\n
+// instead of \n, line breaks inside quoted values are kept as they are.
+func (db *DuckDB) ExportTableCSV(ctx context.Context, table TableRef, destPath string, crlf bool) (int64, error) {
+	log := helpers.GetLoggerFromContext(ctx)
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.db == nil {
+		return 0, errors.New("database connection is closed")
+	}
+
+	newLine := ""
+	if crlf {
+		newLine = `, NEW_LINE '\r\n'`
+	}
+	copySQL := fmt.Sprintf("COPY (SELECT * FROM %s.%s) TO %s (HEADER, DELIMITER ','%s)",
+		QuoteIdentifier(table.Schema), QuoteIdentifier(table.Name), quoteLiteral(destPath), newLine)
+	result, err := db.db.ExecContext(ctx, copySQL)
+	if err != nil {
+		return 0, fmt.Errorf("failed to export %s.%s: %w", table.Schema, table.Name, err)
+	}
+
+	rowCount, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read exported row count: %w", err)
+	}
+
+	log.Info("ExportTableCSV: Exported table",
+		slog.String("schema", table.Schema),
+		slog.String("table", table.Name),
+		slog.Int64("row_count", rowCount))
+
+	return rowCount, nil
+}
+
+// Formats of ExportTableS3
+const (
+	ExportFormatCSV     = "csv"
+	ExportFormatParquet = "parquet"
+)
+
+// ErrS3NotConfigured is returned when writing to S3 without a DuckDB S3 secret
+var ErrS3NotConfigured = errors.New("no DuckDB S3 secret is registered, set DUCKDB_S3_SECRET")
+
+// ExportTableS3 writes a table to a single object at the s3:// uri using COPY ... TO
+// through httpfs, authenticated with the secret registered from DUCKDB_S3_SECRET, and
+// returns the number of rows exported. CSV objects start with a header row. It returns
+// ErrS3NotConfigured when no secret is registered.
+func (db *DuckDB) ExportTableS3(ctx context.Context, table TableRef, uri, format string) (int64, error) {
+	log := helpers.GetLoggerFromContext(ctx)
+
+	var options string
+	switch format {
+	case ExportFormatCSV:
+		options = "HEADER, DELIMITER ','"
+	case ExportFormatParquet:
+		options = "FORMAT PARQUET"
+	default:
+		return 0, fmt.Errorf("unsupported export format %q, use %s or %s", format, ExportFormatCSV, ExportFormatParquet)
+	}
+	if !db.s3Secret {
+		return 0, ErrS3NotConfigured
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.db == nil {
+		return 0, errors.New("database connection is closed")
+	}
+
+	copySQL := fmt.Sprintf("COPY (SELECT * FROM %s.%s) TO %s (%s)",
+		QuoteIdentifier(table.Schema), QuoteIdentifier(table.Name), quoteLiteral(uri), options)
+	result, err := db.db.ExecContext(ctx, copySQL)
+	if err != nil {
+		return 0, fmt.Errorf("failed to export %s.%s to %s: %w", table.Schema, table.Name, uri, err)
+	}
+
+	rowCount, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read exported row count: %w", err)
+	}
+
+	log.Info("ExportTableS3: Exported table",
+		slog.String("schema", table.Schema),
+		slog.String("table", table.Name),
+		slog.String("uri", uri),
+		slog.String("format", format),
+		slog.Int64("row_count", rowCount))
+
+	return rowCount, nil
+}
+
+// ExportQueryParquet writes the result of a SELECT query to destDir as Parquet files using
+// COPY ... TO, returning the number of rows exported. With partition columns the files are
+// laid out in Hive-style column=value directories. File names contain a random UUID so
+// repeated exports to the same location add files instead of replacing earlier ones.
+func (db *DuckDB) ExportQueryParquet(ctx context.Context, query, destDir string, partitionBy []string) (int64, error) {
+	log := helpers.GetLoggerFromContext(ctx)
+
+	selectQuery, err := validateSelectQuery(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.db == nil {
+		return 0, errors.New("database connection is closed")
+	}
+
+	var copySQL string
+	if len(partitionBy) == 0 {
+		destPath := filepath.Join(destDir, fmt.Sprintf("part_%s.parquet", uuid.New().String()))
+		copySQL = fmt.Sprintf("COPY (%s) TO %s (FORMAT PARQUET)", selectQuery, quoteLiteral(destPath))
+	} else {
+		columns := make([]string, len(partitionBy))
+		for i, column := range partitionBy {
+			columns[i] = QuoteIdentifier(column)
+		}
+		copySQL = fmt.Sprintf("COPY (%s) TO %s (FORMAT PARQUET, PARTITION_BY (%s), FILENAME_PATTERN 'part_{uuid}', APPEND)",
+			selectQuery, quoteLiteral(destDir), strings.Join(columns, ", "))
+	}
+
+	result, err := db.db.ExecContext(ctx, copySQL)
+	if err != nil {
+		return 0, fmt.Errorf("failed to export query as parquet: %w", err)
+	}
+
+	rowCount, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read exported row count: %w", err)
+	}
+
+	log.Info("ExportQueryParquet: Exported query",
+		slog.Any("partition_by", partitionBy),
+		slog.Int64("row_count", rowCount))
+
+	return rowCount, nil
+}
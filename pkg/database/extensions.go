@@ -0,0 +1,40 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// requiredExtensions are the DuckDB extensions the server relies on: parquet for Parquet
+// views and exports and json for JSON columns
+var requiredExtensions = []string{"parquet", "json"}
+
+// RequiredExtensions returns the DuckDB extensions the server relies on, including httpfs
+// when an S3 secret is registered from DUCKDB_S3_SECRET
+func (db *DuckDB) RequiredExtensions() []string {
+	names := append([]string(nil), requiredExtensions...)
+	if db.s3Secret {
+		names = append(names, "httpfs")
+	}
+	return names
+}
+
+// CheckExtensions loads each extension, without installing missing ones, and returns an
+// error listing every extension that could not be loaded
+func (db *DuckDB) CheckExtensions(ctx context.Context, names ...string) error {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.db == nil {
+		return errors.New("database connection is closed")
+	}
+
+	var errs []error
+	for _, name := range names {
+		if _, err := db.db.ExecContext(ctx, "LOAD "+QuoteIdentifier(name)); err != nil {
+			errs = append(errs, fmt.Errorf("extension %s is not available: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,30 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aliengiraffe/spotdb/pkg/helpers"
+)
+
+func TestCheckExtensions(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+
+	ctx := context.Background()
+	db, err := NewDuckDB(ctx)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer helpers.CloseResources(db, "database")
+
+	if err := db.CheckExtensions(ctx, db.RequiredExtensions()...); err != nil {
+		t.Fatalf("Expected the required extensions to load, got %v", err)
+	}
+
+	err = db.CheckExtensions(ctx, "parquet", "no_such_extension")
+	if err == nil || !strings.Contains(err.Error(), "no_such_extension") || strings.Contains(err.Error(), "parquet") {
+		t.Errorf("Expected an error naming only the missing extension, got %v", err)
+	}
+
+}
@@ -0,0 +1,100 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// engineSettings are the DuckDB settings reported by EngineInfo, those that most often
+// explain why a query behaves or performs differently between environments
+var engineSettings = []string{
+	"TimeZone",
+	"access_mode",
+	"checkpoint_threshold",
+	"default_null_order",
+	"default_order",
+	"enable_external_access",
+	"max_temp_directory_size",
+	"memory_limit",
+	"preserve_insertion_order",
+	"storage_compatibility_version",
+	"temp_directory",
+	"threads",
+}
+
+// EngineInfo describes the embedded DuckDB engine
+type EngineInfo struct {
+	// Version is the DuckDB library version, e.g. v1.4.1
+	Version string
+	// SourceID is the commit DuckDB was built from
+	SourceID string
+	// Codename is the release codename, empty for versions that do not report one
+	Codename string
+	// Settings maps the reported setting names to their current values
+	Settings map[string]string
+}
+
+// EngineInfo returns the version of the embedded DuckDB engine and the current values of
+// the settings that affect query behavior and resource use
+func (db *DuckDB) EngineInfo(ctx context.Context) (*EngineInfo, error) {
+	versionResult, err := db.ExecuteQuery(ctx, "SELECT * FROM pragma_version()")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read DuckDB version: %w", err)
+	}
+	if len(versionResult.Results) == 0 {
+		return nil, fmt.Errorf("failed to read DuckDB version: no result")
+	}
+
+	version := versionResult.Results[0]
+	info := &EngineInfo{Settings: make(map[string]string, len(engineSettings))}
+	info.Version, _ = version["library_version"].(string)
+	info.SourceID, _ = version["source_id"].(string)
+	info.Codename, _ = version["codename"].(string)
+
+	names := make([]string, len(engineSettings))
+	for i, name := range engineSettings {
+		names[i] = quoteLiteral(name)
+	}
+	settingsResult, err := db.ExecuteQuery(ctx, fmt.Sprintf(
+		"SELECT name, value FROM duckdb_settings() WHERE name IN (%s)", strings.Join(names, ", ")))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read DuckDB settings: %w", err)
+	}
+	for _, row := range settingsResult.Results {
+		name, _ := row["name"].(string)
+		value, _ := row["value"].(string)
+		info.Settings[name] = value
+	}
+
+	return info, nil
+}
+
+// DiskSize returns the bytes the database takes on disk: the blocks of the database file
+// reported by PRAGMA database_size, its write-ahead log, which holds recent changes until
+// they are checkpointed into the file, and the files queries larger than memory spill to
+func (db *DuckDB) DiskSize(ctx context.Context) (int64, error) {
+	result, err := db.ExecuteQuery(ctx, `SELECT block_size, total_blocks,
+			(SELECT COALESCE(SUM(size), 0)::BIGINT FROM duckdb_temporary_files()) AS spill_bytes
+		FROM pragma_database_size()
+		WHERE database_name = current_database()`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read database size: %w", err)
+	}
+	if len(result.Results) == 0 {
+		return 0, fmt.Errorf("failed to read database size: no result")
+	}
+
+	blockSize, _ := result.Results[0]["block_size"].(int64)
+	totalBlocks, _ := result.Results[0]["total_blocks"].(int64)
+	spillBytes, _ := result.Results[0]["spill_bytes"].(int64)
+	size := blockSize*totalBlocks + spillBytes
+
+	if info, err := os.Stat(db.dbPath + ".wal"); err == nil {
+		size += info.Size()
+	} else if !os.IsNotExist(err) {
+		return 0, fmt.Errorf("failed to read write-ahead log size: %w", err)
+	}
+	return size, nil
+}
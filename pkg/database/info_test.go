@@ -0,0 +1,65 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestEngineInfo(t *testing.T) {
+	db := newTestDuckDB(t)
+	ctx := context.Background()
+
+	if _, err := db.ExecuteQuery(ctx, "SET threads = 3"); err != nil {
+		t.Fatalf("Failed to set threads: %v", err)
+	}
+
+	info, err := db.EngineInfo(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get engine info: %v", err)
+	}
+	if !strings.HasPrefix(info.Version, "v") || info.SourceID == "" {
+		t.Errorf("Unexpected version %q and source ID %q", info.Version, info.SourceID)
+	}
+	if len(info.Settings) != len(engineSettings) {
+		t.Errorf("Expected %d settings, got %v", len(engineSettings), info.Settings)
+	}
+	if info.Settings["threads"] != "3" {
+		t.Errorf("Expected the current threads setting, got %q", info.Settings["threads"])
+	}
+	if info.Settings["memory_limit"] == "" {
+		t.Error("Expected memory_limit to be reported")
+	}
+}
+
+func TestDiskSize(t *testing.T) {
+	db := newTestDuckDB(t)
+	ctx := context.Background()
+
+	before, err := db.DiskSize(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get disk size: %v", err)
+	}
+
+	if _, err := db.ExecuteQuery(ctx, "CREATE TABLE numbers AS SELECT range AS n FROM range(100000)"); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	afterInsert, err := db.DiskSize(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get disk size: %v", err)
+	}
+	if afterInsert <= before {
+		t.Errorf("Expected the write-ahead log to grow the disk size, got %d before and %d after", before, afterInsert)
+	}
+
+	if _, err := db.ExecuteQuery(ctx, "CHECKPOINT"); err != nil {
+		t.Fatalf("Failed to checkpoint: %v", err)
+	}
+	afterCheckpoint, err := db.DiskSize(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get disk size: %v", err)
+	}
+	if afterCheckpoint <= before {
+		t.Errorf("Expected the database file blocks to be counted, got %d before and %d after checkpoint", before, afterCheckpoint)
+	}
+}
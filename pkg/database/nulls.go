@@ -0,0 +1,24 @@
+package database
+
+import "context"
+
+// nullRepresentationKey is the context key of the value SQL NULLs are rendered as
+type nullRepresentationKey struct{}
+
+// WithNullRepresentation returns a context whose queries render SQL NULLs in their results
+// as repr instead of nil. An empty repr keeps nil.
+func WithNullRepresentation(ctx context.Context, repr string) context.Context {
+	if repr == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, nullRepresentationKey{}, repr)
+}
+
+// nullValue returns the value SQL NULLs are rendered as in the results of queries run with
+// ctx, nil unless set with WithNullRepresentation
+func nullValue(ctx context.Context) any {
+	if repr, ok := ctx.Value(nullRepresentationKey{}).(string); ok {
+		return repr
+	}
+	return nil
+}
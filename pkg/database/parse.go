@@ -0,0 +1,98 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/aliengiraffe/spotdb/pkg/helpers"
+	"github.com/marcboeker/go-duckdb/v2"
+)
+
+// ErrSuspiciousQuery is returned when a query matches one of the SQL injection patterns
+// that ExecuteQuery rejects
+var ErrSuspiciousQuery = errors.New("query rejected by SQL injection rules")
+
+// ErrQuerySyntax is returned when DuckDB cannot parse a statement of a query
+var ErrQuerySyntax = errors.New("query syntax error")
+
+// bindErrorTypes are the DuckDB errors of statements that parse but refer to tables,
+// columns or functions that do not exist, which is expected of queries written before
+// their tables are loaded
+var bindErrorTypes = map[duckdb.ErrorType]bool{
+	duckdb.ErrorTypeCatalog: true,
+	duckdb.ErrorTypeBinder:  true,
+}
+
+// ValidateQuery checks a query without executing it: the injection rules of ExecuteQuery
+// are applied, then every statement is prepared, which parses and binds it. It returns an
+// error wrapping ErrEmptyQuery, ErrQueryTooLong, ErrSuspiciousQuery or ErrQuerySyntax for
+// an invalid query. Statements that parse but cannot be bound, such as a SELECT from a
+// table that does not exist yet, are valid and their errors are returned as warnings.
+func (db *DuckDB) ValidateQuery(ctx context.Context, query string) ([]string, error) {
+	log := helpers.GetLoggerFromContext(ctx)
+
+	if isEmptyQuery(query) {
+		return nil, ErrEmptyQuery
+	}
+	if err := validateQuery(ctx, query); err != nil {
+		if errors.Is(err, ErrQueryTooLong) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %w", ErrSuspiciousQuery, err)
+	}
+	if db.db == nil {
+		return nil, errors.New("database connection is closed")
+	}
+
+	var warnings []string
+	for _, statement := range splitQueryBySemicolon(query) {
+		statement = strings.TrimSpace(statement)
+		if statement == "" {
+			continue
+		}
+
+		stmt, err := db.db.PrepareContext(ctx, statement)
+		if err == nil {
+			helpers.CloseResources(stmt, "validated statement")
+			continue
+		}
+
+		var duckErr *duckdb.Error
+		if errors.As(err, &duckErr) && bindErrorTypes[duckErr.Type] {
+			log.Info("ValidateQuery: Statement parses but cannot be bound", slog.Any("error", err))
+			warnings = append(warnings, err.Error())
+			continue
+		}
+		log.Info("ValidateQuery: Statement is invalid", slog.Any("error", err))
+		return warnings, fmt.Errorf("%w: %w", ErrQuerySyntax, err)
+	}
+
+	return warnings, nil
+}
+
+// serializeStatement returns the parse tree of a statement serialized by DuckDB's
+// json_serialize_sql. The tree has "error" set for statements that fail to parse and for
+// statements other than SELECT, which it cannot serialize.
+func serializeStatement(ctx context.Context, preparer statementPreparer, statement string) (map[string]any, error) {
+	stmt, err := preparer.PrepareContext(ctx, "SELECT json_serialize_sql(?::VARCHAR)::VARCHAR")
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse statement: %w", err)
+	}
+	defer helpers.CloseResources(stmt, "parse statement")
+
+	var serialized sql.NullString
+	if err := stmt.QueryRowContext(ctx, statement).Scan(&serialized); err != nil {
+		return nil, fmt.Errorf("failed to parse statement: %w", err)
+	}
+
+	var tree map[string]any
+	if err := json.Unmarshal([]byte(serialized.String), &tree); err != nil {
+		return nil, fmt.Errorf("failed to parse statement: %w", err)
+	}
+	return tree, nil
+}
@@ -0,0 +1,51 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestValidateQueryWithoutExecuting(t *testing.T) {
+	db := newTestDuckDB(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		name         string
+		query        string
+		expectedErr  error
+		expectedWarn int
+	}{
+		{name: "valid select", query: "SELECT 1 AS one"},
+		{name: "several statements", query: "SELECT 1; SELECT 2"},
+		{name: "missing table", query: "SELECT * FROM not_loaded_yet", expectedWarn: 1},
+		{name: "write to missing table", query: "INSERT INTO not_loaded_yet VALUES (1)", expectedWarn: 1},
+		{name: "syntax error", query: "SELEC 1", expectedErr: ErrQuerySyntax},
+		{name: "incomplete statement", query: "SELECT 1; SELECT a FROM t WHERE", expectedErr: ErrQuerySyntax},
+		{name: "injection pattern", query: "SELECT * FROM t WHERE id = 1 OR 1=1", expectedErr: ErrSuspiciousQuery},
+		{name: "empty", query: " ; ", expectedErr: ErrEmptyQuery},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warnings, err := db.ValidateQuery(ctx, tt.query)
+			if tt.expectedErr == nil && err != nil {
+				t.Fatalf("Expected a valid query, got %v", err)
+			}
+			if tt.expectedErr != nil && !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("Expected %v, got %v", tt.expectedErr, err)
+			}
+			if len(warnings) != tt.expectedWarn {
+				t.Errorf("Expected %d warnings, got %v", tt.expectedWarn, warnings)
+			}
+		})
+	}
+
+	// Validating never executes the statements
+	if _, err := db.ValidateQuery(ctx, "CREATE TABLE validated (id INTEGER)"); err != nil {
+		t.Fatalf("Expected CREATE TABLE to be valid, got %v", err)
+	}
+	if _, err := db.ExecuteQuery(ctx, "SELECT * FROM validated"); err == nil {
+		t.Error("Expected the validated table not to be created")
+	}
+}
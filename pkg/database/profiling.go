@@ -0,0 +1,190 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aliengiraffe/spotdb/pkg/helpers"
+	"github.com/google/uuid"
+)
+
+// queryProfile mirrors the subset of DuckDB's JSON profiling output used for benchmarks
+type queryProfile struct {
+	Planner                float64           `json:"planner"`
+	CPUTime                float64           `json:"cpu_time"`
+	SystemPeakBufferMemory float64           `json:"system_peak_buffer_memory"`
+	TotalBytesRead         float64           `json:"total_bytes_read"`
+	TotalBytesWritten      float64           `json:"total_bytes_written"`
+	CumulativeRowsScanned  float64           `json:"cumulative_rows_scanned"`
+	RowsReturned           float64           `json:"rows_returned"`
+	Children               []profileOperator `json:"children"`
+}
+
+// profileOperator is a single node of the physical plan in DuckDB's JSON profile
+type profileOperator struct {
+	OperatorType string            `json:"operator_type"`
+	Children     []profileOperator `json:"children"`
+}
+
+// ExecuteQueryWithBenchmarks executes a SQL query like ExecuteQuery, but runs it on a
+// dedicated connection with DuckDB profiling enabled so the resource and query
+// statistics of the benchmark metrics reflect the last executed statement.
+// Profiling adds overhead, so it is only meant to be used when benchmarks are requested.
+// With ENV_DISABLE_BENCHMARKS it runs the query like ExecuteQuery, without metrics.
+// At most one query is profiled per ENV_PROFILING_INTERVAL; the others keep the
+// timing-only metrics and are flagged with ProfilingSkipped.
+func (db *DuckDB) ExecuteQueryWithBenchmarks(ctx context.Context, query string) (*QueryResult, error) {
+	log := helpers.GetLoggerFromContext(ctx)
+
+	if db.db == nil {
+		return nil, errors.New("database connection is closed")
+	}
+	if db.benchmarksDisabled {
+		return db.executeQueries(ctx, db.db, query)
+	}
+	if !db.reserveProfiling(time.Now()) {
+		log.Info("Profiling skipped, another query was profiled recently", slog.Duration("interval", db.profilingInterval))
+		result, err := db.executeQueries(ctx, db.db, query)
+		if err != nil {
+			return nil, err
+		}
+		result.ProfilingSkipped = true
+		return result, nil
+	}
+
+	conn, err := db.db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer helpers.CloseResources(conn, "profiling connection")
+
+	profilePath := filepath.Join(os.TempDir(), fmt.Sprintf("profile_%s.json", uuid.New().String()))
+	defer func() {
+		if err := os.Remove(profilePath); err != nil && !os.IsNotExist(err) {
+			log.Info("Failed to remove profiling output", slog.String("path", profilePath), slog.Any("error", err))
+		}
+	}()
+
+	if err := enableProfiling(ctx, conn, profilePath); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if _, err := conn.ExecContext(context.WithoutCancel(ctx), "PRAGMA disable_profiling"); err != nil {
+			log.Info("Failed to disable profiling", slog.Any("error", err))
+		}
+	}()
+
+	result, err := db.executeQueries(ctx, conn, query)
+	if err != nil {
+		return nil, err
+	}
+
+	profile, err := readQueryProfile(profilePath)
+	if err != nil {
+		// The query itself succeeded, so keep the timing-only metrics
+		log.Info("Failed to read query profile", slog.Any("error", err))
+		return result, nil
+	}
+
+	if result.BenchmarkMetrics != nil {
+		applyQueryProfile(result.BenchmarkMetrics, profile)
+		result.BenchmarkMetrics.Resources.ThreadCount = currentThreadCount(ctx, conn)
+	}
+
+	return result, nil
+}
+
+// reserveProfiling reports whether a query may be profiled at now, recording it as the
+// last profiled query when no other one was profiled within the profiling interval
+func (db *DuckDB) reserveProfiling(now time.Time) bool {
+	if db.profilingInterval <= 0 {
+		return true
+	}
+	for {
+		last := db.lastProfiled.Load()
+		if last != 0 && now.Sub(time.Unix(0, last)) < db.profilingInterval {
+			return false
+		}
+		if db.lastProfiled.CompareAndSwap(last, now.UnixNano()) {
+			return true
+		}
+	}
+}
+
+// enableProfiling turns on JSON profiling for the connection, writing to profilePath
+func enableProfiling(ctx context.Context, conn *sql.Conn, profilePath string) error {
+	pragmas := []string{
+		"PRAGMA enable_profiling='json'",
+		fmt.Sprintf("PRAGMA profiling_output='%s'", strings.ReplaceAll(profilePath, "'", "''")),
+	}
+
+	for _, pragma := range pragmas {
+		if _, err := conn.ExecContext(ctx, pragma); err != nil {
+			return fmt.Errorf("failed to enable profiling: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// readQueryProfile reads and parses the JSON profile written by DuckDB
+func readQueryProfile(profilePath string) (*queryProfile, error) {
+	data, err := os.ReadFile(profilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read profiling output: %w", err)
+	}
+
+	var profile queryProfile
+	if err := json.Unmarshal(data, &profile); err != nil {
+		return nil, fmt.Errorf("failed to parse profiling output: %w", err)
+	}
+
+	return &profile, nil
+}
+
+// applyQueryProfile fills the benchmark metrics with the values reported by DuckDB
+func applyQueryProfile(benchmarks *BenchmarkMetrics, profile *queryProfile) {
+	benchmarks.Timing.PlanningMs = profile.Planner * 1000
+
+	benchmarks.Resources.PeakMemoryBytes = int64(profile.SystemPeakBufferMemory)
+	benchmarks.Resources.CpuTimeMs = int64(profile.CPUTime * 1000)
+	benchmarks.Resources.IoReadBytes = int64(profile.TotalBytesRead)
+	benchmarks.Resources.IoWriteBytes = int64(profile.TotalBytesWritten)
+
+	benchmarks.QueryStats.RowsProcessed = int64(profile.CumulativeRowsScanned)
+	benchmarks.QueryStats.RowsReturned = int(profile.RowsReturned)
+	benchmarks.QueryStats.OperatorCount, benchmarks.QueryStats.ScanCount = countOperators(profile.Children)
+}
+
+// countOperators walks the plan tree returning the number of operators and scans
+func countOperators(operators []profileOperator) (int, int) {
+	operatorCount, scanCount := 0, 0
+	for _, op := range operators {
+		operatorCount++
+		if strings.Contains(op.OperatorType, "SCAN") {
+			scanCount++
+		}
+
+		childOperators, childScans := countOperators(op.Children)
+		operatorCount += childOperators
+		scanCount += childScans
+	}
+	return operatorCount, scanCount
+}
+
+// currentThreadCount returns the number of threads DuckDB uses for query execution
+func currentThreadCount(ctx context.Context, conn *sql.Conn) int {
+	var threads int
+	if err := conn.QueryRowContext(ctx, "SELECT current_setting('threads')").Scan(&threads); err != nil {
+		return 0
+	}
+	return threads
+}
@@ -0,0 +1,184 @@
+package database
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aliengiraffe/spotdb/pkg/helpers"
+)
+
+func TestExecuteQueryWithBenchmarks(t *testing.T) {
+	tempDir := t.TempDir()
+	oldTempDir := os.TempDir()
+	if err := os.Setenv("TMPDIR", tempDir); err != nil {
+		t.Fatalf("Failed to set TMPDIR: %v", err)
+	}
+	defer func() {
+		if err := os.Setenv("TMPDIR", oldTempDir); err != nil {
+			t.Logf("Failed to restore TMPDIR: %v", err)
+		}
+	}()
+
+	ctx := context.Background()
+	db, err := NewDuckDB(ctx)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer helpers.CloseResources(db, "database")
+
+	_, err = db.ExecuteQuery(ctx, "CREATE TABLE profiled AS SELECT range AS id FROM range(1000)")
+	if err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+
+	result, err := db.ExecuteQueryWithBenchmarks(ctx, "SELECT COUNT(*) AS total FROM profiled WHERE id > 5")
+	if err != nil {
+		t.Fatalf("Failed to execute profiled query: %v", err)
+	}
+
+	if len(result.Results) != 1 {
+		t.Fatalf("Expected 1 result row, got %d", len(result.Results))
+	}
+
+	metrics := result.BenchmarkMetrics
+	if metrics == nil {
+		t.Fatal("Expected benchmark metrics to be populated")
+	}
+	if metrics.QueryStats.RowsProcessed != 1000 {
+		t.Errorf("Expected 1000 rows processed, got %d", metrics.QueryStats.RowsProcessed)
+	}
+	if metrics.QueryStats.RowsReturned != 1 {
+		t.Errorf("Expected 1 row returned, got %d", metrics.QueryStats.RowsReturned)
+	}
+	if metrics.QueryStats.OperatorCount == 0 {
+		t.Error("Expected operator count to be populated")
+	}
+	if metrics.QueryStats.ScanCount != 1 {
+		t.Errorf("Expected 1 scan, got %d", metrics.QueryStats.ScanCount)
+	}
+	if metrics.Resources.ThreadCount <= 0 {
+		t.Errorf("Expected positive thread count, got %d", metrics.Resources.ThreadCount)
+	}
+
+	// Profiling must not leak into regular queries on the pooled connection
+	if _, err := db.ExecuteQuery(ctx, "SELECT COUNT(*) AS total FROM profiled"); err != nil {
+		t.Fatalf("Failed to execute query: %v", err)
+	}
+
+	// Profiling output should be cleaned up and not written again
+	entries, err := os.ReadDir(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to read temp dir: %v", err)
+	}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), "profile_") {
+			t.Errorf("Expected profiling output to be removed, found %s", entry.Name())
+		}
+	}
+}
+
+func TestExecuteQueryBenchmarksDisabled(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	t.Setenv("ENV_DISABLE_BENCHMARKS", "true")
+
+	ctx := context.Background()
+	db, err := NewDuckDB(ctx)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer helpers.CloseResources(db, "database")
+
+	result, err := db.ExecuteQuery(ctx, "SELECT 1 AS one")
+	if err != nil {
+		t.Fatalf("Failed to execute query: %v", err)
+	}
+	if result.BenchmarkMetrics != nil {
+		t.Errorf("Expected no benchmark metrics, got %+v", result.BenchmarkMetrics)
+	}
+
+	result, err = db.ExecuteQueryWithBenchmarks(ctx, "SELECT 1 AS one")
+	if err != nil {
+		t.Fatalf("Failed to execute query: %v", err)
+	}
+	if len(result.Results) != 1 || result.BenchmarkMetrics != nil {
+		t.Errorf("Expected one row without benchmark metrics, got %v and %+v", result.Results, result.BenchmarkMetrics)
+	}
+}
+
+func TestExecuteQueryProfilingInterval(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	t.Setenv("ENV_PROFILING_INTERVAL", "1h")
+
+	ctx := context.Background()
+	db, err := NewDuckDB(ctx)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer helpers.CloseResources(db, "database")
+
+	query := "SELECT COUNT(*) AS total FROM range(100) WHERE range > 5"
+	first, err := db.ExecuteQueryWithBenchmarks(ctx, query)
+	if err != nil {
+		t.Fatalf("Failed to execute profiled query: %v", err)
+	}
+	if first.ProfilingSkipped || first.BenchmarkMetrics.QueryStats.OperatorCount == 0 {
+		t.Errorf("Expected the first query to be profiled, got skipped %v and %+v", first.ProfilingSkipped, first.BenchmarkMetrics.QueryStats)
+	}
+
+	second, err := db.ExecuteQueryWithBenchmarks(ctx, query)
+	if err != nil {
+		t.Fatalf("Failed to execute query: %v", err)
+	}
+	if !second.ProfilingSkipped || len(second.Results) != 1 || second.BenchmarkMetrics == nil {
+		t.Errorf("Expected the second query to keep timing-only metrics without profiling, got skipped %v and %+v", second.ProfilingSkipped, second.BenchmarkMetrics)
+	}
+}
+
+func TestReserveProfiling(t *testing.T) {
+	start := time.Unix(1_700_000_000, 0)
+
+	tests := []struct {
+		name     string
+		interval time.Duration
+		calls    []time.Duration // Offsets from start
+		want     []bool
+	}{
+		{name: "no interval", interval: 0, calls: []time.Duration{0, 0, time.Millisecond}, want: []bool{true, true, true}},
+		{name: "within the interval", interval: time.Second, calls: []time.Duration{0, 500 * time.Millisecond}, want: []bool{true, false}},
+		{name: "after the interval", interval: time.Second, calls: []time.Duration{0, time.Second, 1500 * time.Millisecond, 2 * time.Second}, want: []bool{true, true, false, true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &DuckDB{profilingInterval: tt.interval}
+			for i, offset := range tt.calls {
+				if got := db.reserveProfiling(start.Add(offset)); got != tt.want[i] {
+					t.Errorf("reserveProfiling(+%s) = %v, want %v", offset, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCountOperators(t *testing.T) {
+	plan := []profileOperator{
+		{
+			OperatorType: "HASH_JOIN",
+			Children: []profileOperator{
+				{OperatorType: "TABLE_SCAN"},
+				{OperatorType: "PROJECTION", Children: []profileOperator{{OperatorType: "TABLE_SCAN"}}},
+			},
+		},
+	}
+
+	operators, scans := countOperators(plan)
+	if operators != 4 {
+		t.Errorf("Expected 4 operators, got %d", operators)
+	}
+	if scans != 2 {
+		t.Errorf("Expected 2 scans, got %d", scans)
+	}
+}
@@ -0,0 +1,165 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/aliengiraffe/spotdb/pkg/helpers"
+)
+
+// refinementCandidate is a type a VARCHAR column may be narrowed to, with the condition a
+// value must meet to be cast to it without losing information
+type refinementCandidate struct {
+	Type string
+	// Lossless is a format string taking the quoted column. TRY_CAST alone is not enough
+	// as it rounds '1.5' to an integer and drops the time of a timestamp cast to a date.
+	Lossless string
+}
+
+// refinementCandidates are tried in order, the first one every value fits is proposed.
+// Numbers with leading zeros such as zip codes or IDs like '007' lose them when cast, so
+// they keep a column VARCHAR.
+var refinementCandidates = []refinementCandidate{
+	{Type: "INTEGER", Lossless: "regexp_full_match(trim(%[1]s), '[+-]?(0|[1-9][0-9]*)') AND TRY_CAST(%[1]s AS INTEGER) IS NOT NULL"},
+	{Type: "BIGINT", Lossless: "regexp_full_match(trim(%[1]s), '[+-]?(0|[1-9][0-9]*)') AND TRY_CAST(%[1]s AS BIGINT) IS NOT NULL"},
+	{Type: "DOUBLE", Lossless: "NOT regexp_matches(trim(%[1]s), '^[+-]?0[0-9]') AND TRY_CAST(%[1]s AS DOUBLE) IS NOT NULL"},
+	{Type: "DATE", Lossless: "TRY_CAST(%[1]s AS DATE) IS NOT NULL AND TRY_CAST(%[1]s AS DATE) = TRY_CAST(%[1]s AS TIMESTAMP)"},
+	{Type: "TIMESTAMP", Lossless: "TRY_CAST(%[1]s AS TIMESTAMP) IS NOT NULL"},
+}
+
+// TypeRefinement reports how the values of a VARCHAR column fit tighter types
+type TypeRefinement struct {
+	Column string
+	// ProposedType is the first candidate type every value fits, empty when none does or
+	// the column holds no values
+	ProposedType string
+	// NonNullValues is the number of values analyzed
+	NonNullValues int64
+	// Failures maps each candidate type to the number of values that cannot be cast to it
+	Failures map[string]int64
+	// Applied is set once the column was altered to the proposed type
+	Applied bool
+}
+
+// RefineColumnTypes analyzes the VARCHAR columns of a table, such as one imported with
+// all_varchar, and proposes for each the tightest of INTEGER, BIGINT, DOUBLE, DATE and
+// TIMESTAMP that all of its values can be cast to. A sampleSize above 0 analyzes a
+// reservoir sample of that many rows instead of the whole table. With apply the whole
+// table is analyzed and the columns with a proposed type are altered to it in a single
+// transaction, so values that stop fitting in the meantime roll every change back.
+func (db *DuckDB) RefineColumnTypes(ctx context.Context, table TableRef, sampleSize int64, apply bool) ([]TypeRefinement, error) {
+	log := helpers.GetLoggerFromContext(ctx)
+
+	if table.Schema == "" {
+		table.Schema = DefaultSchema
+	}
+	columns, err := db.TableColumns(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+
+	var refinements []TypeRefinement
+	var selectList []string
+	for _, column := range columns {
+		if column.Type != "VARCHAR" {
+			continue
+		}
+		quoted := QuoteIdentifier(column.Name)
+		selectList = append(selectList, fmt.Sprintf("COUNT(%s)", quoted))
+		for _, candidate := range refinementCandidates {
+			lossless := fmt.Sprintf(candidate.Lossless, quoted)
+			selectList = append(selectList, fmt.Sprintf("COUNT(%s) FILTER (WHERE NOT COALESCE(%s, false))", quoted, lossless))
+		}
+		refinements = append(refinements, TypeRefinement{Column: column.Name, Failures: make(map[string]int64)})
+	}
+	if len(refinements) == 0 {
+		return refinements, nil
+	}
+
+	if apply {
+		sampleSize = 0
+	}
+	source := QualifiedTableName(table.Schema, table.Name)
+	if sampleSize > 0 {
+		source = fmt.Sprintf("(SELECT * FROM %s USING SAMPLE %d ROWS)", source, sampleSize)
+	}
+
+	counts := make([]int64, len(selectList))
+	dest := make([]any, len(counts))
+	for i := range counts {
+		dest[i] = &counts[i]
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.db == nil {
+		return nil, errors.New("database connection is closed")
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM %s", strings.Join(selectList, ", "), source)
+	if err := db.db.QueryRowContext(ctx, query).Scan(dest...); err != nil {
+		return nil, fmt.Errorf("failed to analyze column types: %w", err)
+	}
+
+	perColumn := len(refinementCandidates) + 1
+	for i := range refinements {
+		refinement := &refinements[i]
+		refinement.NonNullValues = counts[i*perColumn]
+		for j, candidate := range refinementCandidates {
+			failures := counts[i*perColumn+j+1]
+			refinement.Failures[candidate.Type] = failures
+			if refinement.ProposedType == "" && refinement.NonNullValues > 0 && failures == 0 {
+				refinement.ProposedType = candidate.Type
+			}
+		}
+	}
+
+	if !apply {
+		return refinements, nil
+	}
+
+	tx, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin type refinement: %w", err)
+	}
+	defer func() {
+		// Rolling back after a commit is a no-op
+		_ = tx.Rollback()
+	}()
+
+	altered := 0
+	for i := range refinements {
+		refinement := &refinements[i]
+		if refinement.ProposedType == "" {
+			continue
+		}
+		log.Info("RefineColumnTypes: Altering column type",
+			slog.String("table", table.Name),
+			slog.String("column", refinement.Column),
+			slog.String("type", refinement.ProposedType))
+		alter := fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s SET DATA TYPE %s",
+			QualifiedTableName(table.Schema, table.Name), QuoteIdentifier(refinement.Column), refinement.ProposedType)
+		if _, err := tx.ExecContext(ctx, alter); err != nil {
+			return nil, fmt.Errorf("failed to alter column %s to %s: %w", refinement.Column, refinement.ProposedType, err)
+		}
+		altered++
+	}
+	if altered == 0 {
+		return refinements, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit type refinement: %w", err)
+	}
+
+	for i := range refinements {
+		refinements[i].Applied = refinements[i].ProposedType != ""
+	}
+	db.writes.Add(1)
+	db.bumpTableVersionLocked(table.Name)
+
+	return refinements, nil
+}
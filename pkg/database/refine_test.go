@@ -0,0 +1,76 @@
+package database
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRefineColumnTypes(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDuckDB(t)
+
+	csvPath := writeTestCSV(t, "id,big,price,born,seen,score,note,empty,code,zero\n"+
+		"1,3000000000,1.5,2024-01-02,2024-01-02 10:00:00,1.5,abc,,007,0\n"+
+		"2,-4,2,2024-02-03,2024-02-03 11:30:00,7,def,,12,-0.5\n"+
+		"3,5,3.25,2024-03-04,2024-03-04,x,ghi,,042.5,0.25\n")
+	options := CSVImportOptions{AllVarchar: true}
+	if err := db.CreateTableFromCSVWithOptions(ctx, "loose", csvPath, true, false, options); err != nil {
+		t.Fatalf("Failed to import CSV: %v", err)
+	}
+	table := TableRef{Name: "loose"}
+
+	refinements, err := db.RefineColumnTypes(ctx, table, 0, false)
+	if err != nil {
+		t.Fatalf("RefineColumnTypes failed: %v", err)
+	}
+
+	expected := map[string]string{
+		"id":    "INTEGER",
+		"big":   "BIGINT",
+		"price": "DOUBLE",
+		"born":  "DATE",
+		"seen":  "TIMESTAMP",
+		"score": "",
+		"note":  "",
+		"empty": "",
+		"code":  "",
+		"zero":  "DOUBLE",
+	}
+	if len(refinements) != len(expected) {
+		t.Fatalf("Expected %d refinements, got %+v", len(expected), refinements)
+	}
+	for _, refinement := range refinements {
+		if refinement.ProposedType != expected[refinement.Column] {
+			t.Errorf("Column %s: expected %q, got %q (failures %v)",
+				refinement.Column, expected[refinement.Column], refinement.ProposedType, refinement.Failures)
+		}
+		if refinement.Applied {
+			t.Errorf("Column %s: expected nothing to be applied", refinement.Column)
+		}
+	}
+	if refinements[5].Failures["DOUBLE"] != 1 || refinements[5].Failures["INTEGER"] != 2 {
+		t.Errorf("Expected score to fail DOUBLE once and INTEGER twice, got %v", refinements[5].Failures)
+	}
+
+	versionBefore := db.TableVersion("loose")
+	if _, err := db.RefineColumnTypes(ctx, table, 0, true); err != nil {
+		t.Fatalf("RefineColumnTypes(apply) failed: %v", err)
+	}
+	if db.TableVersion("loose") == versionBefore {
+		t.Error("Expected applying refinements to bump the table version")
+	}
+
+	columns, err := db.TableColumns(ctx, TableRef{Schema: DefaultSchema, Name: "loose"})
+	if err != nil {
+		t.Fatalf("Failed to read columns: %v", err)
+	}
+	for _, column := range columns {
+		want := expected[column.Name]
+		if want == "" {
+			want = "VARCHAR"
+		}
+		if column.Type != want {
+			t.Errorf("Column %s: expected type %s after applying, got %s", column.Name, want, column.Type)
+		}
+	}
+}
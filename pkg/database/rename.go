@@ -0,0 +1,76 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/aliengiraffe/spotdb/pkg/helpers"
+)
+
+// ErrColumnRename is returned when the requested column renames cannot be applied
+var ErrColumnRename = errors.New("invalid column rename")
+
+// sourceColumns returns the names of the columns a table source such as a read_csv call
+// produces, without reading any rows
+func (db *DuckDB) sourceColumns(ctx context.Context, source string) ([]string, error) {
+	rows, err := db.db.QueryContext(ctx, "SELECT * FROM "+source+" LIMIT 0")
+	if err != nil {
+		return nil, err
+	}
+	defer helpers.CloseResources(rows, "source column rows")
+
+	return rows.Columns()
+}
+
+// renamedColumnList renders the select list that renames the given columns, keeping the
+// column order. Originals are matched case-insensitively, as DuckDB resolves identifiers,
+// and new names are sanitized like table names. An original that does not exist, an
+// empty new name or two columns ending up with the same name fail with ErrColumnRename.
+func renamedColumnList(columns []string, renames map[string]string) (string, error) {
+	byName := make(map[string]string, len(columns))
+	for _, column := range columns {
+		byName[strings.ToLower(column)] = column
+	}
+
+	newNames := make(map[string]string, len(renames))
+	for _, original := range slices.Sorted(maps.Keys(renames)) {
+		renamed := renames[original]
+		column, ok := byName[strings.ToLower(original)]
+		if !ok {
+			return "", fmt.Errorf("%w: column '%s' does not exist", ErrColumnRename, original)
+		}
+		if _, ok := newNames[column]; ok {
+			return "", fmt.Errorf("%w: column '%s' is renamed more than once", ErrColumnRename, column)
+		}
+		renamed = sanitizeTableName(strings.TrimSpace(renamed))
+		if renamed == "" {
+			return "", fmt.Errorf("%w: new name for column '%s' is empty", ErrColumnRename, original)
+		}
+		newNames[column] = renamed
+	}
+
+	// Report conflicts in column order so the error is deterministic
+	seen := make(map[string]string, len(columns))
+	selectList := make([]string, len(columns))
+	for i, column := range columns {
+		name, renamed := newNames[column]
+		if !renamed {
+			name = column
+		}
+		if previous, ok := seen[strings.ToLower(name)]; ok {
+			return "", fmt.Errorf("%w: columns '%s' and '%s' would both be named '%s'", ErrColumnRename, previous, column, name)
+		}
+		seen[strings.ToLower(name)] = column
+
+		selectList[i] = QuoteIdentifier(column)
+		if renamed {
+			selectList[i] += " AS " + QuoteIdentifier(name)
+		}
+	}
+
+	return strings.Join(selectList, ", "), nil
+}
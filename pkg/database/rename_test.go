@@ -0,0 +1,76 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRenamedColumnList(t *testing.T) {
+	columns := []string{"id", "first_name", "zip"}
+
+	tests := []struct {
+		name      string
+		renames   map[string]string
+		want      string
+		wantError string
+	}{
+		{name: "single rename", renames: map[string]string{"first_name": "given_name"}, want: `"id", "first_name" AS "given_name", "zip"`},
+		{name: "case insensitive original", renames: map[string]string{"ZIP": "postal_code"}, want: `"id", "first_name", "zip" AS "postal_code"`},
+		{name: "new name is sanitized", renames: map[string]string{"zip": " postal code "}, want: `"id", "first_name", "zip" AS "postal_code"`},
+		{name: "swap names", renames: map[string]string{"id": "zip", "zip": "id"}, want: `"id" AS "zip", "first_name", "zip" AS "id"`},
+		{name: "unknown column", renames: map[string]string{"email": "mail"}, wantError: "column 'email' does not exist"},
+		{name: "empty new name", renames: map[string]string{"zip": "  "}, wantError: "new name for column 'zip' is empty"},
+		{name: "renamed twice", renames: map[string]string{"zip": "a", "ZIP": "b"}, wantError: "column 'zip' is renamed more than once"},
+		{name: "clash with existing column", renames: map[string]string{"first_name": "ID"}, wantError: "columns 'id' and 'first_name' would both be named 'ID'"},
+		{name: "clash after sanitization", renames: map[string]string{"id": "the key", "zip": "the-key"}, wantError: "would both be named 'the_key'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := renamedColumnList(columns, tt.renames)
+			if tt.wantError != "" {
+				if !errors.Is(err, ErrColumnRename) || !strings.Contains(err.Error(), tt.wantError) {
+					t.Fatalf("Expected ErrColumnRename containing %q, got %v", tt.wantError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("renamedColumnList() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateTableFromCSVWithOptions_RenameColumns(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDuckDB(t)
+	csvPath := writeTestCSV(t, "id,First Name,zip\n1,Ada,01234\n2,Alan,98765\n")
+
+	options := CSVImportOptions{RenameColumns: map[string]string{"first_name": "given_name", "zip": "postal_code"}}
+	if err := db.CreateTableFromCSVWithOptions(ctx, "people", csvPath, true, false, options); err != nil {
+		t.Fatalf("Failed to create table from CSV: %v", err)
+	}
+
+	result, err := db.ExecuteQuery(ctx, "SELECT id, given_name, postal_code FROM people ORDER BY id")
+	if err != nil {
+		t.Fatalf("Failed to query renamed columns: %v", err)
+	}
+	if len(result.Results) != 2 || result.Results[0]["given_name"] != "Ada" {
+		t.Errorf("Unexpected rows: %v", result.Results)
+	}
+
+	// An invalid rename leaves the existing table in place even with override
+	options = CSVImportOptions{RenameColumns: map[string]string{"email": "mail"}}
+	err = db.CreateTableFromCSVWithOptions(ctx, "people", csvPath, true, true, options)
+	if !errors.Is(err, ErrColumnRename) {
+		t.Fatalf("Expected ErrColumnRename, got %v", err)
+	}
+	if _, err := db.ExecuteQuery(ctx, "SELECT given_name FROM people"); err != nil {
+		t.Errorf("Expected the existing table to be kept: %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ErrAmbiguousTableName is returned when a name matches several tables ignoring case
+var ErrAmbiguousTableName = errors.New("ambiguous table name")
+
+// AmbiguousTableNameError reports the tables a name matches ignoring case, none of them
+// exactly. It wraps ErrAmbiguousTableName.
+type AmbiguousTableNameError struct {
+	Name       string
+	Candidates []string
+}
+
+func (e *AmbiguousTableNameError) Error() string {
+	return fmt.Sprintf("%s: %q matches %s", ErrAmbiguousTableName, e.Name, strings.Join(e.Candidates, ", "))
+}
+
+func (e *AmbiguousTableNameError) Unwrap() error { return ErrAmbiguousTableName }
+
+// ResolveTableName returns the canonical name of the table or view of the schema that name
+// refers to, ignoring case. An exact match always wins. It returns an error wrapping
+// ErrTableNotFound when nothing matches and an *AmbiguousTableNameError when several
+// tables match ignoring case only.
+func (db *DuckDB) ResolveTableName(ctx context.Context, schema, name string) (string, error) {
+	result, err := db.ExecuteQuery(ctx, fmt.Sprintf(`SELECT table_name FROM information_schema.tables
+		WHERE table_catalog = current_database() AND table_schema = %s AND lower(table_name) = lower(%s)
+		ORDER BY table_name`, quoteLiteral(schema), quoteLiteral(name)))
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve table %s.%s: %w", schema, name, err)
+	}
+
+	candidates := make([]string, 0, len(result.Results))
+	for _, row := range result.Results {
+		if candidate, ok := row["table_name"].(string); ok {
+			candidates = append(candidates, candidate)
+		}
+	}
+
+	resolved, err := matchTableName(name, candidates)
+	if errors.Is(err, ErrTableNotFound) {
+		return "", fmt.Errorf("%w: %s.%s", ErrTableNotFound, schema, name)
+	}
+	return resolved, err
+}
+
+// matchTableName picks the table name refers to among the candidates matching it
+// ignoring case
+func matchTableName(name string, candidates []string) (string, error) {
+	switch {
+	case slices.Contains(candidates, name):
+		return name, nil
+	case len(candidates) == 0:
+		return "", ErrTableNotFound
+	case len(candidates) == 1:
+		return candidates[0], nil
+	default:
+		return "", &AmbiguousTableNameError{Name: name, Candidates: candidates}
+	}
+}
@@ -0,0 +1,77 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/aliengiraffe/spotdb/pkg/helpers"
+)
+
+func TestResolveTableName(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+
+	ctx := context.Background()
+	db, err := NewDuckDB(ctx)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer helpers.CloseResources(db, "database")
+
+	if _, err := db.ExecuteQuery(ctx, `CREATE TABLE "Sales" (id INTEGER); CREATE VIEW "Sales_View" AS SELECT * FROM "Sales"`); err != nil {
+		t.Fatalf("Failed to create tables: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		expected string
+		wantErr  error
+	}{
+		{name: "Sales", expected: "Sales"},
+		{name: "sales", expected: "Sales"},
+		{name: "SALES_VIEW", expected: "Sales_View"},
+		{name: "missing", wantErr: ErrTableNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := db.ResolveTableName(ctx, DefaultSchema, tt.name)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ResolveTableName(%q) error = %v, want %v", tt.name, err, tt.wantErr)
+			}
+			if got != tt.expected {
+				t.Errorf("ResolveTableName(%q) = %q, want %q", tt.name, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestMatchTableName(t *testing.T) {
+	tests := []struct {
+		name           string
+		candidates     []string
+		expected       string
+		wantCandidates []string
+		wantErr        error
+	}{
+		{name: "sales", candidates: []string{"Sales"}, expected: "Sales"},
+		{name: "Sales", candidates: []string{"SALES", "Sales"}, expected: "Sales"},
+		{name: "sales", candidates: []string{"SALES", "Sales"}, wantCandidates: []string{"SALES", "Sales"}, wantErr: ErrAmbiguousTableName},
+		{name: "sales", wantErr: ErrTableNotFound},
+	}
+
+	for _, tt := range tests {
+		got, err := matchTableName(tt.name, tt.candidates)
+		if !errors.Is(err, tt.wantErr) {
+			t.Fatalf("matchTableName(%q, %v) error = %v, want %v", tt.name, tt.candidates, err, tt.wantErr)
+		}
+		if got != tt.expected {
+			t.Errorf("matchTableName(%q, %v) = %q, want %q", tt.name, tt.candidates, got, tt.expected)
+		}
+		var ambiguous *AmbiguousTableNameError
+		if errors.As(err, &ambiguous) && !reflect.DeepEqual(ambiguous.Candidates, tt.wantCandidates) {
+			t.Errorf("matchTableName(%q, %v) candidates = %v, want %v", tt.name, tt.candidates, ambiguous.Candidates, tt.wantCandidates)
+		}
+	}
+}
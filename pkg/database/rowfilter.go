@@ -0,0 +1,356 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/aliengiraffe/spotdb/pkg/helpers"
+)
+
+// RowFiltersTable is the internal table the row filter of each table is stored in. Its
+// prefix keeps it out of table listings by default.
+const RowFiltersTable = "_spotdb_row_filters"
+
+// TenantPlaceholder is replaced by the quoted tenant of the API key in row filters
+const TenantPlaceholder = "{tenant}"
+
+// ErrInvalidRowFilter is returned for a row filter predicate that cannot filter its table
+var ErrInvalidRowFilter = errors.New("invalid row filter")
+
+// ErrTenantQueryRejected is returned for a tenant query that could read rows its row
+// filters do not allow
+var ErrTenantQueryRejected = errors.New("query not allowed for a tenant")
+
+// RowFilter is the predicate that limits the rows of a table a tenant can read
+type RowFilter struct {
+	Table string
+	// Predicate is a SQL boolean expression over the columns of the table, where
+	// TenantPlaceholder stands for the tenant as a string literal
+	Predicate string
+}
+
+// tenantPredicate returns the predicate with the tenant substituted as a string literal
+func (f RowFilter) tenantPredicate(tenant string) string {
+	return strings.ReplaceAll(f.Predicate, TenantPlaceholder, quoteLiteral(tenant))
+}
+
+// SetRowFilter stores the row filter of a table in the default schema, replacing any
+// previous one. The predicate is checked against the table before it is stored. It
+// returns ErrTableNotFound for a missing table.
+func (db *DuckDB) SetRowFilter(ctx context.Context, table, predicate string) error {
+	log := helpers.GetLoggerFromContext(ctx)
+
+	columns, err := db.TableColumns(ctx, TableRef{Schema: DefaultSchema, Name: table})
+	if err != nil {
+		return err
+	}
+	if len(columns) == 0 {
+		return fmt.Errorf("%w: %s", ErrTableNotFound, table)
+	}
+
+	filter := RowFilter{Table: table, Predicate: strings.TrimSpace(predicate)}
+	if filter.Predicate == "" {
+		return fmt.Errorf("%w: predicate is empty", ErrInvalidRowFilter)
+	}
+	if strings.Contains(filter.Predicate, ";") {
+		return fmt.Errorf("%w: predicate must be a single expression", ErrInvalidRowFilter)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.db == nil {
+		return errors.New("database connection is closed")
+	}
+
+	// Preparing binds the predicate to the columns of the table without reading any rows
+	check := fmt.Sprintf("SELECT * FROM %s WHERE (%s)", QualifiedTableName(DefaultSchema, table), filter.tenantPredicate(""))
+	stmt, err := db.db.PrepareContext(ctx, check)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidRowFilter, err)
+	}
+	helpers.CloseResources(stmt, "row filter check")
+
+	if _, err := db.db.ExecContext(ctx, fmt.Sprintf(
+		"CREATE TABLE IF NOT EXISTS %s (table_name VARCHAR PRIMARY KEY, predicate VARCHAR NOT NULL)",
+		QuoteIdentifier(RowFiltersTable))); err != nil {
+		return fmt.Errorf("failed to create row filters table: %w", err)
+	}
+	if _, err := db.db.ExecContext(ctx, fmt.Sprintf("INSERT OR REPLACE INTO %s VALUES (?, ?)", QuoteIdentifier(RowFiltersTable)),
+		strings.ToLower(table), filter.Predicate); err != nil {
+		return fmt.Errorf("failed to store row filter: %w", err)
+	}
+	// Tenant results of the table change with its filter
+	db.bumpTableVersionLocked(table)
+
+	log.Info("SetRowFilter: Row filter stored", slog.String("table", table), slog.String("predicate", filter.Predicate))
+	return nil
+}
+
+// DeleteRowFilter removes the row filter of a table and reports whether it had one
+func (db *DuckDB) DeleteRowFilter(ctx context.Context, table string) (bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	filters, err := db.rowFiltersLocked(ctx)
+	if err != nil {
+		return false, err
+	}
+	if _, ok := filters[strings.ToLower(table)]; !ok {
+		return false, nil
+	}
+
+	if _, err := db.db.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE table_name = ?", QuoteIdentifier(RowFiltersTable)),
+		strings.ToLower(table)); err != nil {
+		return false, fmt.Errorf("failed to delete row filter: %w", err)
+	}
+	db.bumpTableVersionLocked(table)
+	return true, nil
+}
+
+// RowFilters returns the row filters by lower-cased table name
+func (db *DuckDB) RowFilters(ctx context.Context) (map[string]RowFilter, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.rowFiltersLocked(ctx)
+}
+
+// rowFiltersLocked reads the row filters, the caller must hold db.mu
+func (db *DuckDB) rowFiltersLocked(ctx context.Context) (map[string]RowFilter, error) {
+	if db.db == nil {
+		return nil, errors.New("database connection is closed")
+	}
+
+	filters := make(map[string]RowFilter)
+	var exists bool
+	err := db.db.QueryRowContext(ctx,
+		"SELECT COUNT(*) > 0 FROM information_schema.tables WHERE table_schema = ? AND table_name = ?",
+		DefaultSchema, RowFiltersTable).Scan(&exists)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check row filters table: %w", err)
+	}
+	if !exists {
+		return filters, nil
+	}
+
+	rows, err := db.db.QueryContext(ctx, fmt.Sprintf("SELECT table_name, predicate FROM %s", QuoteIdentifier(RowFiltersTable)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read row filters: %w", err)
+	}
+	defer helpers.CloseResources(rows, "row filters")
+	for rows.Next() {
+		var filter RowFilter
+		if err := rows.Scan(&filter.Table, &filter.Predicate); err != nil {
+			return nil, fmt.Errorf("failed to read row filters: %w", err)
+		}
+		filters[filter.Table] = filter
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read row filters: %w", err)
+	}
+	return filters, nil
+}
+
+// ScopeQueryToTenant rewrites a query so every table with a row filter only yields the
+// rows of the tenant. Each statement gets a common table expression per filtered table,
+// named like the table, which shadows it for the unqualified references of the statement.
+// Tenants are denied by default: only SELECT statements reading filtered tables and their
+// own common table expressions are allowed. Statements that read a table or view without
+// a row filter, name a filtered table with its schema or catalog or call table functions
+// return an error wrapping ErrTenantQueryRejected.
+func (db *DuckDB) ScopeQueryToTenant(ctx context.Context, query, tenant string) (string, error) {
+	filters, err := db.RowFilters(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	var scoped []string
+	for _, statement := range splitQueryBySemicolon(query) {
+		statement = strings.TrimSpace(statement)
+		if statement == "" {
+			continue
+		}
+		if !isTenantStatement(statement) {
+			return "", fmt.Errorf("%w: only SELECT statements are allowed", ErrTenantQueryRejected)
+		}
+
+		refs, cteNames, err := db.statementTableRefs(ctx, statement)
+		if err != nil {
+			return "", err
+		}
+		// A common table expression named like an unfiltered relation would hand out that
+		// relation wherever the expression is out of scope
+		var relations map[string]bool
+		if len(cteNames) > 0 {
+			if relations, err = db.relationNames(ctx); err != nil {
+				return "", err
+			}
+		}
+
+		var ctes []string
+		seen := make(map[string]bool)
+		for _, ref := range refs {
+			name := strings.ToLower(ref.Name)
+			if ref.Function != "" {
+				return "", fmt.Errorf("%w: table function %s", ErrTenantQueryRejected, ref.Function)
+			}
+			if name == RowFiltersTable {
+				return "", fmt.Errorf("%w: table %s is internal", ErrTenantQueryRejected, ref.Name)
+			}
+			filter, ok := filters[name]
+			if !ok {
+				if !ref.Qualified && cteNames[name] && !relations[name] {
+					continue
+				}
+				return "", fmt.Errorf("%w: %s has no row filter", ErrTenantQueryRejected, ref.Name)
+			}
+			if ref.Qualified {
+				return "", fmt.Errorf("%w: filtered table %s must be referenced without a schema", ErrTenantQueryRejected, ref.Name)
+			}
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			ctes = append(ctes, fmt.Sprintf("%s AS (SELECT * FROM %s WHERE (%s))",
+				QuoteIdentifier(name), QualifiedTableName(DefaultSchema, name), filter.tenantPredicate(tenant)))
+		}
+		scoped = append(scoped, withCTEs(statement, ctes))
+	}
+	return strings.Join(scoped, "; "), nil
+}
+
+// relationNames returns the lower-cased names of the tables and views of every attached
+// database, including the internal views
+func (db *DuckDB) relationNames(ctx context.Context) (map[string]bool, error) {
+	rows, err := db.db.QueryContext(ctx,
+		"SELECT lower(table_name) FROM duckdb_tables() UNION ALL SELECT lower(view_name) FROM duckdb_views()")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list relations: %w", err)
+	}
+	defer helpers.CloseResources(rows, "relation names")
+
+	names := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to list relations: %w", err)
+		}
+		names[name] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list relations: %w", err)
+	}
+	return names, nil
+}
+
+// withCTEs prepends common table expressions to a statement, joining the WITH clause the
+// statement may already start with
+func withCTEs(statement string, ctes []string) string {
+	if len(ctes) == 0 {
+		return statement
+	}
+	definitions := strings.Join(ctes, ", ")
+
+	upper := strings.ToUpper(statement)
+	for _, keyword := range []string{"WITH RECURSIVE", "WITH"} {
+		if strings.HasPrefix(upper, keyword) && len(statement) > len(keyword) && isSQLSpace(statement[len(keyword)]) {
+			return statement[:len(keyword)] + " " + definitions + "," + statement[len(keyword):]
+		}
+	}
+	return "WITH " + definitions + " " + statement
+}
+
+// isSQLSpace reports whether a byte separates SQL keywords
+func isSQLSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\r' || b == '\n'
+}
+
+// tenantStatementPrefixes are the leading keywords of the statements tenants may run.
+// SUMMARIZE and DESCRIBE parse as SELECT statements but are not scoped.
+var tenantStatementPrefixes = []string{"SELECT", "WITH", "FROM", "("}
+
+// isTenantStatement reports whether a statement starts like a query tenants may run
+func isTenantStatement(statement string) bool {
+	upper := strings.ToUpper(statement)
+	for _, prefix := range tenantStatementPrefixes {
+		if strings.HasPrefix(upper, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// tableRef is a table a statement reads, as written in the statement
+type tableRef struct {
+	Name string
+	// Qualified is set when the table is named with its schema or catalog
+	Qualified bool
+	// Function is the name of a table function, in which case Name is empty
+	Function string
+}
+
+// statementTableRefs returns the tables and table functions a SELECT statement reads and
+// the lower-cased names of the common table expressions it defines, from its parse tree.
+// Other statements return an error wrapping ErrTenantQueryRejected.
+func (db *DuckDB) statementTableRefs(ctx context.Context, statement string) ([]tableRef, map[string]bool, error) {
+	if db.db == nil {
+		return nil, nil, errors.New("database connection is closed")
+	}
+
+	tree, err := serializeStatement(ctx, db.db, statement)
+	if err != nil {
+		return nil, nil, err
+	}
+	if failed, _ := tree["error"].(bool); failed {
+		message, _ := tree["error_message"].(string)
+		return nil, nil, fmt.Errorf("%w: %s", ErrTenantQueryRejected, message)
+	}
+
+	var refs []tableRef
+	cteNames := make(map[string]bool)
+	collectTableRefs(tree, &refs, cteNames)
+	return refs, cteNames, nil
+}
+
+// collectTableRefs walks a serialized parse tree and appends its base tables and table
+// functions, and adds the names of its common table expressions to cteNames
+func collectTableRefs(node any, refs *[]tableRef, cteNames map[string]bool) {
+	switch node := node.(type) {
+	case map[string]any:
+		if cteMap, ok := node["cte_map"].(map[string]any); ok {
+			entries, _ := cteMap["map"].([]any)
+			for _, entry := range entries {
+				if entry, ok := entry.(map[string]any); ok {
+					if name, ok := entry["key"].(string); ok {
+						cteNames[strings.ToLower(name)] = true
+					}
+				}
+			}
+		}
+		switch node["type"] {
+		case "BASE_TABLE":
+			name, _ := node["table_name"].(string)
+			schema, _ := node["schema_name"].(string)
+			catalog, _ := node["catalog_name"].(string)
+			*refs = append(*refs, tableRef{Name: name, Qualified: schema != "" || catalog != ""})
+		case "TABLE_FUNCTION":
+			function := "table function"
+			if call, ok := node["function"].(map[string]any); ok {
+				if name, ok := call["function_name"].(string); ok {
+					function = name
+				}
+			}
+			*refs = append(*refs, tableRef{Function: function})
+		}
+		for _, child := range node {
+			collectTableRefs(child, refs, cteNames)
+		}
+	case []any:
+		for _, child := range node {
+			collectTableRefs(child, refs, cteNames)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestScopeQueryToTenant(t *testing.T) {
+	db := newTestDuckDB(t)
+	ctx := context.Background()
+
+	for _, query := range []string{
+		"CREATE TABLE orders (id INTEGER, tenant VARCHAR, amount INTEGER)",
+		"INSERT INTO orders VALUES (1, 'acme', 10), (2, 'acme', 20), (3, 'globex', 30)",
+		"CREATE TABLE regions (id INTEGER, name VARCHAR)",
+		"INSERT INTO regions VALUES (1, 'north')",
+		"CREATE VIEW orders_view AS SELECT * FROM orders",
+	} {
+		if _, err := db.ExecuteQuery(ctx, query); err != nil {
+			t.Fatalf("Failed to run %q: %v", query, err)
+		}
+	}
+
+	if err := db.SetRowFilter(ctx, "orders", "missing_column = {tenant}"); !errors.Is(err, ErrInvalidRowFilter) {
+		t.Errorf("Expected ErrInvalidRowFilter for an unknown column, got %v", err)
+	}
+	if err := db.SetRowFilter(ctx, "orders", "tenant = {tenant}"); err != nil {
+		t.Fatalf("Failed to set row filter: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		query   string
+		want    string
+		wantErr bool
+	}{
+		{name: "filtered table", query: "SELECT SUM(amount) AS total FROM orders", want: "30"},
+		{name: "subquery", query: "SELECT COUNT(*) AS total FROM orders WHERE id IN (SELECT id FROM orders WHERE amount > 15)", want: "1"},
+		{name: "existing WITH clause", query: "WITH big AS (SELECT * FROM orders WHERE amount > 15) SELECT SUM(amount) AS total FROM big", want: "20"},
+		{name: "nested CTE named like the table", query: "SELECT SUM(amount) AS total FROM (WITH orders AS (SELECT * FROM orders) SELECT * FROM orders)", want: "30"},
+		{name: "unfiltered table", query: "SELECT COUNT(*) AS total FROM regions", wantErr: true},
+		{name: "unfiltered table in a subquery", query: "SELECT COUNT(*) AS total FROM orders WHERE id IN (SELECT id FROM regions)", wantErr: true},
+		{name: "view over a filtered table", query: "SELECT SUM(amount) AS total FROM orders_view", wantErr: true},
+		{name: "CTE named like an unfiltered table", query: "SELECT COUNT(*) AS total FROM (WITH regions AS (SELECT 1) SELECT * FROM regions), regions", wantErr: true},
+		{name: "information schema", query: "SELECT COUNT(*) AS total FROM information_schema.tables", wantErr: true},
+		{name: "catalog view", query: "SELECT COUNT(*) AS total FROM duckdb_tables", wantErr: true},
+		{name: "catalog function", query: "SELECT COUNT(*) AS total FROM duckdb_tables()", wantErr: true},
+		{name: "schema-qualified table", query: "SELECT SUM(amount) AS total FROM main.orders", wantErr: true},
+		{name: "catalog-qualified table", query: "SELECT COUNT(*) AS total FROM regions, memory.main.orders", wantErr: true},
+		{name: "row filters table", query: "SELECT COUNT(*) AS total FROM _spotdb_row_filters", wantErr: true},
+		{name: "table function", query: "SELECT COUNT(*) AS total FROM query_table('orders')", wantErr: true},
+		{name: "not a SELECT", query: "SUMMARIZE orders", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scoped, err := db.ScopeQueryToTenant(ctx, tt.query, "acme")
+			if tt.wantErr {
+				if !errors.Is(err, ErrTenantQueryRejected) {
+					t.Errorf("Expected ErrTenantQueryRejected, got %v (query %q)", err, scoped)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to scope query: %v", err)
+			}
+
+			result, err := db.ExecuteQuery(ctx, scoped)
+			if err != nil {
+				t.Fatalf("Failed to run scoped query %q: %v", scoped, err)
+			}
+			if got := fmt.Sprint(result.Results[0]["total"]); got != tt.want {
+				t.Errorf("Expected %s, got %s from %q", tt.want, got, scoped)
+			}
+		})
+	}
+
+	deleted, err := db.DeleteRowFilter(ctx, "orders")
+	if err != nil || !deleted {
+		t.Fatalf("Expected the row filter to be deleted, got %v, %v", deleted, err)
+	}
+	if scoped, err := db.ScopeQueryToTenant(ctx, "SELECT * FROM orders", "acme"); !errors.Is(err, ErrTenantQueryRejected) {
+		t.Errorf("Expected tables without row filters to be rejected, got %q, %v", scoped, err)
+	}
+	scoped, err := db.ScopeQueryToTenant(ctx, "SELECT 1 AS total", "acme")
+	if err != nil || scoped != "SELECT 1 AS total" {
+		t.Errorf("Expected a query reading no tables to be unchanged, got %q, %v", scoped, err)
+	}
+}
@@ -0,0 +1,77 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// S3SecretName is the name of the DuckDB secret registered from DUCKDB_S3_SECRET
+const S3SecretName = "spotdb_s3"
+
+// Modes of DUCKDB_S3_SECRET
+const (
+	// S3SecretConfig registers the keys of AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY
+	S3SecretConfig = "config"
+	// S3SecretCredentialChain lets DuckDB resolve credentials like the AWS SDK does, from
+	// the environment, shared config files, web identity or the instance profile
+	S3SecretCredentialChain = "credential_chain"
+)
+
+// s3SecretStatement returns the CREATE SECRET statement configured with DUCKDB_S3_SECRET,
+// or an empty statement when it is not set. The region comes from AWS_REGION and an
+// S3-compatible endpoint, such as MinIO, from DUCKDB_S3_ENDPOINT. It returns an error for
+// an unknown mode or explicit keys that are missing.
+func s3SecretStatement() (string, error) {
+	mode := strings.ToLower(strings.TrimSpace(os.Getenv("DUCKDB_S3_SECRET")))
+	if mode == "" {
+		return "", nil
+	}
+
+	options := []string{"TYPE s3"}
+	switch mode {
+	case S3SecretConfig:
+		keyID, secret := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")
+		if keyID == "" || secret == "" {
+			return "", errors.New("DUCKDB_S3_SECRET=config requires AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+		}
+		options = append(options, "PROVIDER config", "KEY_ID "+quoteLiteral(keyID), "SECRET "+quoteLiteral(secret))
+		if token := os.Getenv("AWS_SESSION_TOKEN"); token != "" {
+			options = append(options, "SESSION_TOKEN "+quoteLiteral(token))
+		}
+	case S3SecretCredentialChain:
+		options = append(options, "PROVIDER credential_chain")
+	default:
+		return "", fmt.Errorf("invalid DUCKDB_S3_SECRET %q, use %s or %s", mode, S3SecretConfig, S3SecretCredentialChain)
+	}
+
+	if region := os.Getenv("AWS_REGION"); region != "" {
+		options = append(options, "REGION "+quoteLiteral(region))
+	}
+	if endpoint := os.Getenv("DUCKDB_S3_ENDPOINT"); endpoint != "" {
+		// DuckDB expects the host without a scheme, plain http turns SSL off
+		useSSL := !strings.HasPrefix(endpoint, "http://")
+		endpoint = strings.TrimPrefix(strings.TrimPrefix(endpoint, "https://"), "http://")
+		options = append(options, "ENDPOINT "+quoteLiteral(strings.TrimSuffix(endpoint, "/")),
+			"URL_STYLE 'path'", fmt.Sprintf("USE_SSL %v", useSSL))
+	}
+
+	return fmt.Sprintf("CREATE OR REPLACE SECRET %s (%s)", S3SecretName, strings.Join(options, ", ")), nil
+}
+
+// registerS3Secret registers the S3 secret configured with DUCKDB_S3_SECRET, so httpfs reads
+// and writes of s3:// paths authenticate with it. The secret is temporary: it is shared by
+// every pooled connection but never written to disk. It reports whether one was registered.
+func registerS3Secret(db *sql.DB) (bool, error) {
+	statement, err := s3SecretStatement()
+	if err != nil || statement == "" {
+		return false, err
+	}
+	// Creating an S3 secret loads the httpfs extension, installing it when needed
+	if _, err := db.Exec(statement); err != nil {
+		return false, fmt.Errorf("failed to register DuckDB S3 secret: %w", err)
+	}
+	return true, nil
+}
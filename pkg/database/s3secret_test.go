@@ -0,0 +1,87 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestS3SecretStatement(t *testing.T) {
+	tests := []struct {
+		name      string
+		env       map[string]string
+		want      string
+		wantError string
+	}{
+		{name: "not configured", env: map[string]string{}, want: ""},
+		{
+			name: "explicit keys",
+			env: map[string]string{
+				"DUCKDB_S3_SECRET":      "config",
+				"AWS_ACCESS_KEY_ID":     "AKIA",
+				"AWS_SECRET_ACCESS_KEY": "it's secret",
+				"AWS_REGION":            "eu-west-1",
+			},
+			want: "CREATE OR REPLACE SECRET spotdb_s3 (TYPE s3, PROVIDER config, KEY_ID 'AKIA', SECRET 'it''s secret', REGION 'eu-west-1')",
+		},
+		{
+			name: "session token",
+			env: map[string]string{
+				"DUCKDB_S3_SECRET":      "config",
+				"AWS_ACCESS_KEY_ID":     "ASIA",
+				"AWS_SECRET_ACCESS_KEY": "secret",
+				"AWS_SESSION_TOKEN":     "token",
+			},
+			want: "CREATE OR REPLACE SECRET spotdb_s3 (TYPE s3, PROVIDER config, KEY_ID 'ASIA', SECRET 'secret', SESSION_TOKEN 'token')",
+		},
+		{
+			name: "credential chain with endpoint",
+			env: map[string]string{
+				"DUCKDB_S3_SECRET":   "Credential_Chain",
+				"DUCKDB_S3_ENDPOINT": "http://localhost:9000/",
+			},
+			want: "CREATE OR REPLACE SECRET spotdb_s3 (TYPE s3, PROVIDER credential_chain, ENDPOINT 'localhost:9000', URL_STYLE 'path', USE_SSL false)",
+		},
+		{
+			name:      "missing keys",
+			env:       map[string]string{"DUCKDB_S3_SECRET": "config", "AWS_ACCESS_KEY_ID": "AKIA"},
+			wantError: "requires AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY",
+		},
+		{
+			name:      "unknown mode",
+			env:       map[string]string{"DUCKDB_S3_SECRET": "instance"},
+			wantError: "invalid DUCKDB_S3_SECRET",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{"DUCKDB_S3_SECRET", "DUCKDB_S3_ENDPOINT", "AWS_ACCESS_KEY_ID",
+				"AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN", "AWS_REGION"} {
+				t.Setenv(name, tt.env[name])
+			}
+
+			got, err := s3SecretStatement()
+			if tt.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+					t.Fatalf("Expected an error containing %q, got %v", tt.wantError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("s3SecretStatement() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestNewDuckDBConfigInvalidS3Secret tests that an invalid DUCKDB_S3_SECRET stops startup
+func TestNewDuckDBConfigInvalidS3Secret(t *testing.T) {
+	t.Setenv("DUCKDB_S3_SECRET", "instance")
+	if _, err := NewDuckDBConfig(context.Background()); err == nil || !strings.Contains(err.Error(), "DUCKDB_S3_SECRET") {
+		t.Errorf("Expected an invalid DUCKDB_S3_SECRET error, got %v", err)
+	}
+}
@@ -0,0 +1,139 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ErrQueryOutOfScope is returned for a query that reads or modifies anything other than
+// the table it is restricted to
+var ErrQueryOutOfScope = errors.New("query references data outside the table")
+
+// scopedWritePattern matches the write statements allowed on a table, capturing the
+// (possibly schema-qualified) table they modify
+var scopedWritePattern = regexp.MustCompile(`(?is)^\s*(INSERT\s+(?:OR\s+\w+\s+)?INTO|UPDATE|DELETE\s+FROM|ALTER\s+TABLE)\s+((?:"[^"]+"|\w+)(?:\s*\.\s*(?:"[^"]+"|\w+))*)`)
+
+// scopedLeafOperators are the plan leaves that read no data of their own, such as
+// constants, VALUES lists and reads of common table expressions
+var scopedLeafOperators = map[string]bool{
+	"DUMMY_SCAN":       true,
+	"EMPTY_RESULT":     true,
+	"COLUMN_DATA_SCAN": true,
+	"CTE_SCAN":         true,
+	"DELIM_SCAN":       true,
+}
+
+// CheckQueryScope returns an error wrapping ErrQueryOutOfScope unless every statement of
+// the query only reads, updates, deletes from, inserts into or alters the table. Table
+// functions such as read_csv and statements of any other kind are rejected. Tables in
+// other schemas with the same name are not told apart.
+func (db *DuckDB) CheckQueryScope(ctx context.Context, query string, table TableRef) error {
+	if db.db == nil {
+		return errors.New("database connection is closed")
+	}
+	if isEmptyQuery(query) {
+		return ErrEmptyQuery
+	}
+
+	for _, statement := range splitQueryBySemicolon(query) {
+		statement = strings.TrimSpace(statement)
+		if statement == "" {
+			continue
+		}
+
+		match := scopedWritePattern.FindStringSubmatch(statement)
+		if match == nil && !isReadOnlyStatement(ctx, db.db, statement) {
+			return fmt.Errorf("%w: only SELECT, INSERT, UPDATE, DELETE and ALTER TABLE statements are allowed", ErrQueryOutOfScope)
+		}
+		if match != nil {
+			if target := tableFromIdentifier(match[2]); !strings.EqualFold(target, table.Name) {
+				return fmt.Errorf("%w: statement modifies table %s", ErrQueryOutOfScope, target)
+			}
+			// ALTER TABLE reads no data, and its plan does not name the table
+			if strings.HasPrefix(strings.ToUpper(match[1]), "ALTER") {
+				continue
+			}
+		}
+
+		plan, err := db.explainQuery(ctx, statement)
+		if err != nil {
+			return fmt.Errorf("failed to explain statement: %w", err)
+		}
+		for _, op := range plan {
+			if err := checkScannedTables(op, table.Name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ExecuteScopedQuery runs the statements of the query one at a time like ExecuteQuery,
+// checking each with CheckQueryScope and CheckQueryCost right before it runs, so later
+// statements can use columns added by earlier ones. Statements that ran before a failing
+// one are not undone. The result is that of the last statement.
+func (db *DuckDB) ExecuteScopedQuery(ctx context.Context, query string, table TableRef, maxRows int64) (*QueryResult, error) {
+	if db.db == nil {
+		return nil, errors.New("database connection is closed")
+	}
+	if isEmptyQuery(query) {
+		return nil, ErrEmptyQuery
+	}
+
+	start := time.Now()
+	var lastResult *QueryResult
+	for _, statement := range splitQueryBySemicolon(query) {
+		statement = strings.TrimSpace(statement)
+		if statement == "" {
+			continue
+		}
+		if err := db.CheckQueryScope(ctx, statement, table); err != nil {
+			return nil, err
+		}
+		if err := db.CheckQueryCost(ctx, statement, maxRows); err != nil {
+			return nil, err
+		}
+
+		result, err := db.ExecuteQuery(ctx, statement)
+		if err != nil {
+			return nil, err
+		}
+		lastResult = result
+	}
+	if lastResult == nil {
+		return nil, ErrEmptyQuery
+	}
+
+	lastResult.Duration = time.Since(start)
+	return lastResult, nil
+}
+
+// checkScannedTables returns an error when a leaf of the operator's subtree reads from
+// anything other than the table
+func checkScannedTables(op explainOperator, tableName string) error {
+	if len(op.Children) > 0 {
+		for _, child := range op.Children {
+			if err := checkScannedTables(child, tableName); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if scanned, ok := op.ExtraInfo["Table"].(string); ok && scanned != "" {
+		if !strings.EqualFold(scanned, tableName) {
+			return fmt.Errorf("%w: statement reads table %s", ErrQueryOutOfScope, scanned)
+		}
+		return nil
+	}
+
+	name := strings.TrimSpace(op.Name)
+	if !scopedLeafOperators[name] {
+		return fmt.Errorf("%w: statement reads from %s", ErrQueryOutOfScope, strings.ToLower(name))
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestCheckQueryScope(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDuckDB(t)
+
+	if _, err := db.ExecuteQuery(ctx, "CREATE TABLE imported (id INTEGER, name VARCHAR); CREATE TABLE other (id INTEGER)"); err != nil {
+		t.Fatalf("Failed to create tables: %v", err)
+	}
+	table := TableRef{Schema: DefaultSchema, Name: "imported"}
+
+	tests := []struct {
+		name       string
+		query      string
+		outOfScope bool
+	}{
+		{name: "select", query: "SELECT * FROM imported WHERE id > 5"},
+		{name: "quoted and qualified", query: `SELECT COUNT(*) FROM main."imported"`},
+		{name: "subquery on the table", query: "SELECT * FROM imported WHERE id = (SELECT max(id) FROM imported)"},
+		{name: "common table expression", query: "WITH c AS (SELECT * FROM imported) SELECT * FROM c"},
+		{name: "constants", query: "SELECT 1"},
+		{name: "cleaning statements", query: "UPDATE imported SET name = trim(name); DELETE FROM imported WHERE id IS NULL; SELECT * FROM imported"},
+		{name: "insert values", query: "INSERT INTO imported VALUES (1, 'a')"},
+		{name: "alter table", query: "ALTER TABLE imported DROP COLUMN name"},
+		{name: "reads another table", query: "SELECT * FROM imported JOIN other USING (id)", outOfScope: true},
+		{name: "update from another table", query: "UPDATE imported SET name = 'x' WHERE id IN (SELECT id FROM other)", outOfScope: true},
+		{name: "modifies another table", query: "DELETE FROM other", outOfScope: true},
+		{name: "table function", query: "SELECT * FROM read_csv('/etc/hosts')", outOfScope: true},
+		{name: "creates a table", query: "CREATE TABLE copy AS SELECT * FROM imported", outOfScope: true},
+		{name: "drops the table", query: "DROP TABLE imported", outOfScope: true},
+		{name: "copies to a file", query: "COPY imported TO '/tmp/out.csv'", outOfScope: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := db.CheckQueryScope(ctx, tc.query, table)
+			if tc.outOfScope && !errors.Is(err, ErrQueryOutOfScope) {
+				t.Errorf("Expected ErrQueryOutOfScope, got %v", err)
+			}
+			if !tc.outOfScope && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		})
+	}
+
+	if err := db.CheckQueryScope(ctx, "SELECT * FROM missing", table); err == nil || errors.Is(err, ErrQueryOutOfScope) {
+		t.Errorf("Expected an explain error for an unknown table, got %v", err)
+	}
+}
+
+func TestExecuteScopedQuery(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDuckDB(t)
+
+	if _, err := db.ExecuteQuery(ctx, "CREATE TABLE imported AS SELECT range AS id FROM range(3); CREATE TABLE other (id INTEGER)"); err != nil {
+		t.Fatalf("Failed to create tables: %v", err)
+	}
+	table := TableRef{Schema: DefaultSchema, Name: "imported"}
+
+	// Each statement is checked after the previous one ran, so it can use the new column
+	result, err := db.ExecuteScopedQuery(ctx, "ALTER TABLE imported ADD COLUMN doubled BIGINT; UPDATE imported SET doubled = id * 2; SELECT SUM(doubled) AS total FROM imported", table, 1_000_000)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if total := result.Results[0]["total"]; total == nil || fmt.Sprint(total) != "6" {
+		t.Errorf("Expected total 6, got %v", total)
+	}
+
+	if _, err := db.ExecuteScopedQuery(ctx, "SELECT 1; DELETE FROM other", table, 1_000_000); !errors.Is(err, ErrQueryOutOfScope) {
+		t.Errorf("Expected ErrQueryOutOfScope, got %v", err)
+	}
+	if _, err := db.ExecuteScopedQuery(ctx, " ; ", table, 1_000_000); !errors.Is(err, ErrEmptyQuery) {
+		t.Errorf("Expected ErrEmptyQuery, got %v", err)
+	}
+}
@@ -0,0 +1,36 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrColumnSelection is returned when the columns selected for an import cannot be applied
+var ErrColumnSelection = errors.New("invalid column selection")
+
+// selectedColumns returns the columns to keep, in the requested order. Names are matched
+// case-insensitively, as DuckDB resolves identifiers. A column that does not exist or is
+// selected twice fails with ErrColumnSelection.
+func selectedColumns(columns, keep []string) ([]string, error) {
+	byName := make(map[string]string, len(columns))
+	for _, column := range columns {
+		byName[strings.ToLower(column)] = column
+	}
+
+	selected := make([]string, 0, len(keep))
+	seen := make(map[string]bool, len(keep))
+	for _, name := range keep {
+		column, ok := byName[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return nil, fmt.Errorf("%w: column '%s' does not exist, the file has columns %s",
+				ErrColumnSelection, name, strings.Join(columns, ", "))
+		}
+		if seen[column] {
+			return nil, fmt.Errorf("%w: column '%s' is selected more than once", ErrColumnSelection, column)
+		}
+		seen[column] = true
+		selected = append(selected, column)
+	}
+	return selected, nil
+}
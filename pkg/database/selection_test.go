@@ -0,0 +1,80 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSelectedColumns(t *testing.T) {
+	columns := []string{"id", "first_name", "ssn", "zip"}
+
+	tests := []struct {
+		name      string
+		keep      []string
+		want      []string
+		wantError string
+	}{
+		{name: "subset", keep: []string{"id", "zip"}, want: []string{"id", "zip"}},
+		{name: "requested order", keep: []string{"zip", "id"}, want: []string{"zip", "id"}},
+		{name: "case insensitive", keep: []string{"First_Name", " ZIP "}, want: []string{"first_name", "zip"}},
+		{name: "unknown column", keep: []string{"id", "email"}, wantError: "column 'email' does not exist"},
+		{name: "selected twice", keep: []string{"zip", "ZIP"}, wantError: "column 'zip' is selected more than once"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := selectedColumns(columns, tt.keep)
+			if tt.wantError != "" {
+				if !errors.Is(err, ErrColumnSelection) || !strings.Contains(err.Error(), tt.wantError) {
+					t.Fatalf("Expected ErrColumnSelection containing %q, got %v", tt.wantError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("selectedColumns() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateTableFromCSVWithOptions_Columns(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDuckDB(t)
+	csvPath := writeTestCSV(t, "id,First Name,SSN,zip\n1,Ada,123-45-6789,01234\n2,Alan,987-65-4321,98765\n")
+
+	options := CSVImportOptions{
+		Columns:       []string{"zip", "id", "first_name"},
+		RenameColumns: map[string]string{"first_name": "given_name"},
+	}
+	if err := db.CreateTableFromCSVWithOptions(ctx, "people", csvPath, true, false, options); err != nil {
+		t.Fatalf("Failed to create table from CSV: %v", err)
+	}
+
+	columns, err := db.TableColumns(ctx, TableRef{Schema: DefaultSchema, Name: "people"})
+	if err != nil {
+		t.Fatalf("Failed to read columns: %v", err)
+	}
+	names := make([]string, len(columns))
+	for i, column := range columns {
+		names[i] = column.Name
+	}
+	if !slices.Equal(names, []string{"zip", "id", "given_name"}) {
+		t.Errorf("Expected columns zip, id, given_name, got %v", names)
+	}
+
+	// An invalid selection leaves the existing table in place even with override
+	options = CSVImportOptions{Columns: []string{"email"}}
+	err = db.CreateTableFromCSVWithOptions(ctx, "people", csvPath, true, true, options)
+	if !errors.Is(err, ErrColumnSelection) {
+		t.Fatalf("Expected ErrColumnSelection, got %v", err)
+	}
+	if _, err := db.ExecuteQuery(ctx, "SELECT given_name FROM people"); err != nil {
+		t.Errorf("Expected the existing table to be kept: %v", err)
+	}
+}
@@ -0,0 +1,81 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/aliengiraffe/spotdb/pkg/helpers"
+)
+
+// statementExecer is implemented by *sql.DB, *sql.Conn and *sql.Tx so an import can run
+// on the connection pool, on the connection its stream was staged on or in a transaction
+type statementExecer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// streamStagingTable is the temporary table a stream is read into before it is imported
+const streamStagingTable = "spotdb_stream_import"
+
+// stageCSVStream reads the stream at csvPath into a temporary table on a dedicated
+// connection, without holding db.mu, so a slow client does not block other writes for the
+// duration of its upload. It returns the connection, which must be released with
+// releaseStagingConn, and the table to import from, only visible on that connection.
+func (db *DuckDB) stageCSVStream(ctx context.Context, csvPath, samplePath string, hasHeader bool, options CSVImportOptions) (*sql.Conn, string, error) {
+	db.mu.RLock()
+	pool := db.db
+	db.mu.RUnlock()
+	if pool == nil {
+		return nil, "", errors.New("database connection is closed")
+	}
+
+	source, err := db.streamCSVSource(ctx, csvPath, samplePath, hasHeader, options)
+	if err != nil {
+		return nil, "", err
+	}
+
+	conn, err := pool.Conn(ctx)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to open import connection: %w", err)
+	}
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf("CREATE OR REPLACE TEMP TABLE %s AS SELECT * FROM %s", QuoteIdentifier(streamStagingTable), source)); err != nil {
+		db.releaseStagingConn(ctx, conn)
+		return nil, "", fmt.Errorf("failed to create table from CSV: %w", err)
+	}
+	return conn, "temp.main." + QuoteIdentifier(streamStagingTable), nil
+}
+
+// releaseStagingConn drops the temporary table of a staged stream and returns its
+// connection to the pool
+func (db *DuckDB) releaseStagingConn(ctx context.Context, conn *sql.Conn) {
+	if _, err := conn.ExecContext(context.WithoutCancel(ctx), "DROP TABLE IF EXISTS temp.main."+QuoteIdentifier(streamStagingTable)); err != nil {
+		helpers.GetLoggerFromContext(ctx).Info("Error dropping stream staging table", slog.Any("error", err))
+	}
+	helpers.CloseResources(conn, "import connection")
+}
+
+// streamCSVSource renders the read_csv call importing csvPath, a stream such as a named
+// pipe that can be read only once. DuckDB sniffs files while binding a query and reads
+// them again to execute it, so the dialect, column names and types are detected from
+// samplePath, which holds the start of the stream, and passed explicitly instead.
+func (db *DuckDB) streamCSVSource(ctx context.Context, csvPath, samplePath string, hasHeader bool, options CSVImportOptions) (string, error) {
+	// sniff_csv takes the read_csv options and returns the equivalent read_csv call with
+	// every detected option spelled out and auto-detection disabled
+	sniffCall := "sniff_csv" + strings.TrimPrefix(readCSVSource(samplePath, hasHeader, options), "read_csv")
+
+	var prompt string
+	if err := db.db.QueryRowContext(ctx, "SELECT Prompt FROM "+sniffCall).Scan(&prompt); err != nil {
+		return "", fmt.Errorf("failed to detect the CSV format from the start of the stream: %w", err)
+	}
+
+	source := strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(prompt), "FROM "), ";")
+	sampleLiteral := quoteLiteral(samplePath)
+	if !strings.HasPrefix(source, "read_csv("+sampleLiteral) {
+		return "", fmt.Errorf("unexpected CSV format detected from the start of the stream: %s", prompt)
+	}
+
+	return strings.Replace(source, sampleLiteral, quoteLiteral(csvPath), 1), nil
+}
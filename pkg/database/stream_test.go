@@ -0,0 +1,127 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/aliengiraffe/spotdb/pkg/helpers"
+)
+
+func TestCreateTableFromCSVWithOptions_SampleFile(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDuckDB(t)
+	csvPath := writeTestCSV(t, "id;city;joined\n1;Ada;2024-01-02\n2;Alan;2024-03-04\n3;Grace;2024-05-06\n")
+	samplePath := writeTestCSV(t, "id;city;joined\n1;Ada;2024-01-02\n")
+
+	options := CSVImportOptions{SampleFile: samplePath}
+	if err := db.CreateTableFromCSVWithOptions(ctx, "members", csvPath, true, false, options); err != nil {
+		t.Fatalf("Failed to create table from CSV: %v", err)
+	}
+
+	result, err := db.ExecuteQuery(ctx, "SELECT column_name, data_type FROM information_schema.columns WHERE table_name = 'members' ORDER BY ordinal_position")
+	if err != nil {
+		t.Fatalf("Failed to describe table: %v", err)
+	}
+	want := [][2]string{{"id", "BIGINT"}, {"city", "VARCHAR"}, {"joined", "DATE"}}
+	if len(result.Results) != len(want) {
+		t.Fatalf("Expected %d columns, got %d", len(want), len(result.Results))
+	}
+	for i, row := range result.Results {
+		if row["column_name"] != want[i][0] || row["data_type"] != want[i][1] {
+			t.Errorf("Column %d = %v %v, want %s %s", i, row["column_name"], row["data_type"], want[i][0], want[i][1])
+		}
+	}
+
+	count, err := db.ExecuteQuery(ctx, "SELECT COUNT(*) AS n FROM members")
+	if err != nil {
+		t.Fatalf("Failed to count rows: %v", err)
+	}
+	if n := fmt.Sprint(count.Results[0]["n"]); n != "3" {
+		t.Errorf("Expected every row of the file rather than the sample, got %s rows", n)
+	}
+}
+
+func TestCreateTableFromCSVWithOptions_CompleteFails(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDuckDB(t)
+
+	if err := db.CreateTableFromCSVWithOptions(ctx, "orders", writeTestCSV(t, "id\n1\n"), true, false, CSVImportOptions{}); err != nil {
+		t.Fatalf("Failed to create table from CSV: %v", err)
+	}
+
+	errInvalid := errors.New("stream failed validation")
+	options := CSVImportOptions{Complete: func() error { return errInvalid }}
+	err := db.CreateTableFromCSVWithOptions(ctx, "orders", writeTestCSV(t, "id\n2\n3\n"), true, true, options)
+	if !errors.Is(err, errInvalid) {
+		t.Fatalf("Expected the completion error, got %v", err)
+	}
+
+	result, err := db.ExecuteQuery(ctx, "SELECT id FROM orders")
+	if err != nil {
+		t.Fatalf("Expected the existing table to be kept: %v", err)
+	}
+	if len(result.Results) != 1 || fmt.Sprint(result.Results[0]["id"]) != "1" {
+		t.Errorf("Expected the existing rows to be kept, got %v", result.Results)
+	}
+}
+
+func TestCreateTableFromCSVWithOptions_StreamDoesNotBlockWrites(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDuckDB(t)
+	pipePath := filepath.Join(t.TempDir(), "upload.pipe")
+	if err := syscall.Mkfifo(pipePath, 0o600); err != nil {
+		t.Fatalf("Failed to create pipe: %v", err)
+	}
+	samplePath := writeTestCSV(t, "id,city\n1,Paris\n")
+	if _, err := db.ExecuteQuery(ctx, "CREATE TABLE regions (id INTEGER)"); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+
+	imported := make(chan error, 1)
+	go func() {
+		imported <- db.CreateTableFromCSVWithOptions(ctx, "cities", pipePath, true, false, CSVImportOptions{SampleFile: samplePath})
+	}()
+
+	// Opening the pipe blocks until DuckDB reads it
+	pipe, err := os.OpenFile(pipePath, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("Failed to open pipe: %v", err)
+	}
+	if _, err := pipe.WriteString("id,city\n1,Paris\n"); err != nil {
+		t.Fatalf("Failed to write to pipe: %v", err)
+	}
+
+	// The client is still sending, other writes must not wait for it
+	written := make(chan error, 1)
+	go func() { written <- db.SetRowFilter(ctx, "regions", "true") }()
+	select {
+	case err := <-written:
+		if err != nil {
+			t.Errorf("Failed to set row filter: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Expected writes to proceed while a stream is being read")
+	}
+
+	if _, err := pipe.WriteString("2,Rome\n"); err != nil {
+		t.Fatalf("Failed to write to pipe: %v", err)
+	}
+	helpers.CloseResources(pipe, "pipe")
+	if err := <-imported; err != nil {
+		t.Fatalf("Failed to import stream: %v", err)
+	}
+
+	count, err := db.ExecuteQuery(ctx, "SELECT COUNT(*) AS n FROM cities")
+	if err != nil {
+		t.Fatalf("Failed to count rows: %v", err)
+	}
+	if n := fmt.Sprint(count.Results[0]["n"]); n != "2" {
+		t.Errorf("Expected 2 rows, got %s", n)
+	}
+}
@@ -0,0 +1,92 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math/rand/v2"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/aliengiraffe/spotdb/pkg/helpers"
+	"github.com/marcboeker/go-duckdb/v2"
+)
+
+// transientIOMessages are fragments of DuckDB IO errors caused by contention rather than
+// by the file itself, such as another process briefly holding a lock
+var transientIOMessages = []string{
+	"could not set lock",
+	"conflicting lock",
+	"resource temporarily unavailable",
+	"device or resource busy",
+	"interrupted system call",
+}
+
+// transientRetryBaseDelay is the wait before the first retry of a transiently failed
+// write, doubling for every further retry before the jitter is applied. It is a variable
+// so tests can shorten it.
+var transientRetryBaseDelay = 50 * time.Millisecond
+
+// IsTransientError reports whether an error is clearly caused by a temporary condition,
+// lock contention, a transaction conflict or an interrupted or busy IO call, so the
+// operation may succeed when retried. Anything else, including parse errors, missing
+// files and existing tables, is considered permanent.
+func IsTransientError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var duckErr *duckdb.Error
+	if errors.As(err, &duckErr) {
+		switch duckErr.Type {
+		case duckdb.ErrorTypeTransaction:
+			return true
+		case duckdb.ErrorTypeIO:
+			message := strings.ToLower(duckErr.Msg)
+			for _, fragment := range transientIOMessages {
+				if strings.Contains(message, fragment) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	return errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.EBUSY) || errors.Is(err, syscall.EINTR)
+}
+
+// retryTransient runs write, retrying it up to retries times while it fails with a
+// transient error. Each wait is drawn between half and all of an exponentially growing
+// delay, so writes that collided do not retry in lockstep. write must take db.mu itself,
+// the lock is released while waiting so the conflicting write can finish. Permanent
+// errors are returned right away, as is the last error once the retries are used up or
+// the context is done. It is the only retry loop around writes, callers must not retry
+// its errors again.
+func retryTransient(ctx context.Context, operation string, retries int, write func() error) error {
+	log := helpers.GetLoggerFromContext(ctx)
+
+	delay := transientRetryBaseDelay
+	for attempt := 0; ; attempt++ {
+		err := write()
+		if err == nil || attempt >= retries || !IsTransientError(err) {
+			return err
+		}
+
+		wait := delay/2 + rand.N(delay/2+1)
+		log.Info("Write failed with a transient error, retrying",
+			slog.String("operation", operation),
+			slog.Int("attempt", attempt+1),
+			slog.Duration("delay", wait),
+			slog.Any("error", err))
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		delay *= 2
+	}
+}
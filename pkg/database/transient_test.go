@@ -0,0 +1,120 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/marcboeker/go-duckdb/v2"
+)
+
+func TestIsTransientError(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDuckDB(t)
+	csvPath := writeTestCSV(t, "id,city\n1,Paris\n")
+
+	if err := db.CreateTableFromCSV(ctx, "cities", csvPath, true, false); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	duplicateErr := db.CreateTableFromCSV(ctx, "cities", csvPath, true, false)
+	parseErr := db.CreateTableFromCSVWithOptions(ctx, "typed", csvPath, true, false, CSVImportOptions{
+		ColumnTypes: []ColumnType{{Name: "id", Type: "BIGINT"}, {Name: "city", Type: "BIGINT"}},
+	})
+	missingFileErr := db.CreateTableFromCSV(ctx, "missing", csvPath+".gone", true, false)
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil", err: nil, want: false},
+		{name: "duplicate table", err: duplicateErr, want: false},
+		{name: "parse error", err: parseErr, want: false},
+		{name: "missing file", err: missingFileErr, want: false},
+		{name: "transaction conflict", err: fmt.Errorf("failed to create table from CSV: %w",
+			&duckdb.Error{Type: duckdb.ErrorTypeTransaction, Msg: "TransactionContext Error: Catalog write-write conflict"}), want: true},
+		{name: "lock contention", err: &duckdb.Error{Type: duckdb.ErrorTypeIO,
+			Msg: `IO Error: Could not set lock on file "/data/spotdb.db": Conflicting lock is held`}, want: true},
+		{name: "other IO error", err: &duckdb.Error{Type: duckdb.ErrorTypeIO, Msg: "IO Error: No files found"}, want: false},
+		{name: "busy file", err: fmt.Errorf("open: %w", syscall.EBUSY), want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.name != "nil" && tt.err == nil {
+				t.Fatal("Expected the import to fail")
+			}
+			if got := IsTransientError(tt.err); got != tt.want {
+				t.Errorf("IsTransientError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryTransient(t *testing.T) {
+	transientRetryBaseDelay = time.Millisecond
+	t.Cleanup(func() { transientRetryBaseDelay = 50 * time.Millisecond })
+
+	ctx := context.Background()
+	conflictErr := fmt.Errorf("failed to create table from CSV: %w",
+		&duckdb.Error{Type: duckdb.ErrorTypeTransaction, Msg: "TransactionContext Error: Catalog write-write conflict"})
+
+	// failing returns a write that fails with err for the first failures attempts
+	failing := func(failures int, err error) (func() error, *int) {
+		attempts := 0
+		return func() error {
+			attempts++
+			if attempts <= failures {
+				return err
+			}
+			return nil
+		}, &attempts
+	}
+
+	tests := []struct {
+		name         string
+		retries      int
+		failures     int
+		err          error
+		wantErr      bool
+		wantAttempts int
+	}{
+		{name: "succeeds after conflicts", retries: 2, failures: 2, err: conflictErr, wantAttempts: 3},
+		{name: "gives up after the configured retries", retries: 2, failures: 10, err: conflictErr, wantErr: true, wantAttempts: 3},
+		{name: "file lock", retries: 2, failures: 1, err: &duckdb.Error{Type: duckdb.ErrorTypeIO,
+			Msg: `IO Error: Could not set lock on file "/data/spotdb.db": Conflicting lock is held`}, wantAttempts: 2},
+		{name: "zero retries", retries: 0, failures: 1, err: conflictErr, wantErr: true, wantAttempts: 1},
+		{name: "permanent errors are not retried", retries: 2, failures: 1, err: errors.New("table already exists"), wantErr: true, wantAttempts: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			write, attempts := failing(tt.failures, tt.err)
+			err := retryTransient(ctx, "test", tt.retries, write)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("retryTransient() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if *attempts != tt.wantAttempts {
+				t.Errorf("Expected %d attempts, got %d", tt.wantAttempts, *attempts)
+			}
+		})
+	}
+
+	t.Run("stops when the context is done", func(t *testing.T) {
+		transientRetryBaseDelay = time.Hour
+		defer func() { transientRetryBaseDelay = time.Millisecond }()
+
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+		write, attempts := failing(10, conflictErr)
+		if err := retryTransient(cancelled, "test", 2, write); err == nil {
+			t.Fatal("Expected the write to fail")
+		}
+		if *attempts != 1 {
+			t.Errorf("Expected a single attempt, got %d", *attempts)
+		}
+	})
+}
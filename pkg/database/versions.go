@@ -0,0 +1,178 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/aliengiraffe/spotdb/pkg/helpers"
+)
+
+// writeTargetPattern matches the statements whose modified table can be read from the
+// statement itself, capturing the (possibly schema-qualified) table name
+var writeTargetPattern = regexp.MustCompile(`(?is)^\s*(?:INSERT\s+(?:OR\s+\w+\s+)?INTO|UPDATE|DELETE\s+FROM|TRUNCATE(?:\s+TABLE)?|DROP\s+TABLE(?:\s+IF\s+EXISTS)?|CREATE\s+(?:OR\s+REPLACE\s+)?(?:TEMP(?:ORARY)?\s+)?TABLE(?:\s+IF\s+NOT\s+EXISTS)?|COPY)\s+((?:"[^"]+"|\w+)(?:\s*\.\s*(?:"[^"]+"|\w+))*)`)
+
+// TableVersion returns the version of a table, which increases every time the table is
+// created, modified or dropped. Tables in different schemas with the same name share a
+// version, so a change to either invalidates both.
+func (db *DuckDB) TableVersion(table string) uint64 {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.versions[strings.ToLower(table)]
+}
+
+// ErrTableVersionMismatch is returned by an import whose IfMatch check rejected the
+// current entity tag of the table it would replace
+var ErrTableVersionMismatch = errors.New("table was modified since the version the request expected")
+
+// TableETag returns an entity tag for the current version of a table, or "" when the
+// table does not exist. The tag changes every time the table's version does and differs
+// between database instances, so a tag from before a restart never matches.
+func (db *DuckDB) TableETag(ctx context.Context, schema, table string) (string, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.tableETagLocked(ctx, schema, table)
+}
+
+// tableETagLocked returns the entity tag of a table, the caller must hold db.mu
+func (db *DuckDB) tableETagLocked(ctx context.Context, schema, table string) (string, error) {
+	if db.db == nil {
+		return "", errors.New("database connection is closed")
+	}
+	if schema == "" {
+		schema = DefaultSchema
+	}
+
+	var count int64
+	err := db.db.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = ? AND table_name = ?",
+		sanitizeTableName(schema), sanitizeTableName(table)).Scan(&count)
+	if err != nil {
+		return "", fmt.Errorf("failed to check table existence: %w", err)
+	}
+	if count == 0 {
+		return "", nil
+	}
+	return fmt.Sprintf(`"%s-%d"`, db.instanceID, db.versions[strings.ToLower(sanitizeTableName(table))]), nil
+}
+
+// tableFromIdentifier returns the table name of a possibly schema-qualified and quoted
+// SQL identifier such as main."Sales"
+func tableFromIdentifier(identifier string) string {
+	inQuote := false
+	start := 0
+	for i, r := range identifier {
+		switch {
+		case r == '"':
+			inQuote = !inQuote
+		case r == '.' && !inQuote:
+			start = i + 1
+		}
+	}
+
+	name := strings.TrimSpace(identifier[start:])
+	if len(name) >= 2 && strings.HasPrefix(name, `"`) && strings.HasSuffix(name, `"`) {
+		name = strings.ReplaceAll(name[1:len(name)-1], `""`, `"`)
+	}
+	return name
+}
+
+// bumpTableVersionLocked records a modification of a table, the caller must hold db.mu
+func (db *DuckDB) bumpTableVersionLocked(table string) {
+	if db.versions == nil {
+		db.versions = make(map[string]uint64)
+	}
+	db.versions[strings.ToLower(table)]++
+}
+
+// recordWrite bumps the version of the table modified by a successful write statement.
+// When the table cannot be determined from the statement every table is considered
+// modified by bumping the database generation instead.
+func (db *DuckDB) recordWrite(statement string) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if match := writeTargetPattern.FindStringSubmatch(statement); match != nil {
+		db.bumpTableVersionLocked(tableFromIdentifier(match[1]))
+		return
+	}
+	db.generation++
+}
+
+// QueryETag returns an entity tag identifying the result of a read-only query at the
+// current versions of the tables it reads, or "" when the result cannot be cached: the
+// query writes data, cannot be explained, or reads from anything other than tables.
+func (db *DuckDB) QueryETag(ctx context.Context, query string) string {
+	log := helpers.GetLoggerFromContext(ctx)
+
+	if db.db == nil {
+		return ""
+	}
+
+	tables := make(map[string]bool)
+	for _, statement := range splitQueryBySemicolon(query) {
+		statement = strings.TrimSpace(statement)
+		if statement == "" {
+			continue
+		}
+		if !isReadOnlyStatement(ctx, db.db, statement) {
+			return ""
+		}
+
+		plan, err := db.explainQuery(ctx, statement)
+		if err != nil {
+			log.Info("QueryETag: Statement cannot be explained, skipping ETag", slog.Any("error", err))
+			return ""
+		}
+		for _, op := range plan {
+			if !collectScannedTables(op, tables) {
+				return ""
+			}
+		}
+	}
+	if len(tables) == 0 {
+		return ""
+	}
+
+	names := make([]string, 0, len(tables))
+	for table := range tables {
+		names = append(names, table)
+	}
+	slices.Sort(names)
+
+	hash := sha256.New()
+	db.mu.RLock()
+	fmt.Fprintf(hash, "%s\x00%d\x00%s\x00", db.instanceID, db.generation, query)
+	for _, table := range names {
+		fmt.Fprintf(hash, "%s=%d\x00", table, db.versions[table])
+	}
+	db.mu.RUnlock()
+
+	return `"` + hex.EncodeToString(hash.Sum(nil))[:32] + `"`
+}
+
+// collectScannedTables adds the tables scanned by an operator's subtree to tables and
+// reports whether every leaf of the subtree is a table scan
+func collectScannedTables(op explainOperator, tables map[string]bool) bool {
+	if len(op.Children) == 0 {
+		table, ok := op.ExtraInfo["Table"].(string)
+		if !ok || table == "" {
+			return false
+		}
+		tables[strings.ToLower(table)] = true
+		return true
+	}
+
+	for _, child := range op.Children {
+		if !collectScannedTables(child, tables) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,151 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestTableVersions(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDuckDB(t)
+
+	if _, err := db.ExecuteQuery(ctx, "CREATE TABLE orders (id INTEGER); CREATE TABLE customers (id INTEGER)"); err != nil {
+		t.Fatalf("Failed to create tables: %v", err)
+	}
+	if db.TableVersion("orders") != 1 || db.TableVersion("customers") != 1 {
+		t.Fatalf("Expected both tables at version 1, got %d and %d", db.TableVersion("orders"), db.TableVersion("customers"))
+	}
+
+	if _, err := db.ExecuteQuery(ctx, `INSERT INTO main."Orders" VALUES (1)`); err != nil {
+		t.Fatalf("Failed to insert: %v", err)
+	}
+	if _, err := db.ExecuteQuery(ctx, "SELECT * FROM orders"); err != nil {
+		t.Fatalf("Failed to select: %v", err)
+	}
+	if db.TableVersion("ORDERS") != 2 {
+		t.Errorf("Expected orders at version 2 after one insert, got %d", db.TableVersion("orders"))
+	}
+	if db.TableVersion("customers") != 1 {
+		t.Errorf("Expected customers to be unchanged, got version %d", db.TableVersion("customers"))
+	}
+
+	csvPath := writeTestCSV(t, "id\n1\n")
+	if err := db.CreateTableFromCSV(ctx, "customers", csvPath, true, true); err != nil {
+		t.Fatalf("Failed to import CSV: %v", err)
+	}
+	if db.TableVersion("customers") != 2 {
+		t.Errorf("Expected customers at version 2 after an import, got %d", db.TableVersion("customers"))
+	}
+}
+
+func TestQueryETag(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDuckDB(t)
+
+	if _, err := db.ExecuteQuery(ctx, "CREATE TABLE orders (id INTEGER); CREATE TABLE customers (id INTEGER); CREATE VIEW recent AS SELECT * FROM orders"); err != nil {
+		t.Fatalf("Failed to create tables: %v", err)
+	}
+
+	ordersTag := db.QueryETag(ctx, "SELECT * FROM orders")
+	viewTag := db.QueryETag(ctx, "SELECT * FROM recent")
+	customersTag := db.QueryETag(ctx, "SELECT * FROM customers")
+	if ordersTag == "" || viewTag == "" || customersTag == "" {
+		t.Fatalf("Expected ETags for table queries, got %q, %q and %q", ordersTag, viewTag, customersTag)
+	}
+	if ordersTag != db.QueryETag(ctx, "SELECT * FROM orders") {
+		t.Error("Expected a stable ETag while nothing changes")
+	}
+
+	if _, err := db.ExecuteQuery(ctx, "DELETE FROM orders"); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	if db.QueryETag(ctx, "SELECT * FROM orders") == ordersTag {
+		t.Error("Expected the ETag to change after the table was modified")
+	}
+	if db.QueryETag(ctx, "SELECT * FROM recent") == viewTag {
+		t.Error("Expected the ETag of a view to change after its table was modified")
+	}
+	if db.QueryETag(ctx, "SELECT * FROM customers") != customersTag {
+		t.Error("Expected the ETag of an unrelated table to stay the same")
+	}
+
+	// Writes whose table cannot be determined invalidate every ETag
+	if _, err := db.ExecuteQuery(ctx, "ALTER TABLE customers ADD COLUMN email VARCHAR"); err != nil {
+		t.Fatalf("Failed to alter table: %v", err)
+	}
+	if db.QueryETag(ctx, "SELECT * FROM customers") == customersTag {
+		t.Error("Expected the ETag to change after an unattributed write")
+	}
+
+	for _, query := range []string{"SELECT 1", "INSERT INTO orders VALUES (1)", "SELECT * FROM missing_table"} {
+		if tag := db.QueryETag(ctx, query); tag != "" {
+			t.Errorf("Expected no ETag for %q, got %q", query, tag)
+		}
+	}
+}
+
+func TestTableFromIdentifier(t *testing.T) {
+	tests := map[string]string{
+		"orders":               "orders",
+		"main.orders":          "orders",
+		`"main"."Order ""X"""`: `Order "X"`,
+		`"a.b"`:                "a.b",
+		`tenant . "sales"`:     "sales",
+	}
+
+	for identifier, expected := range tests {
+		if got := tableFromIdentifier(identifier); got != expected {
+			t.Errorf("tableFromIdentifier(%q) = %q, expected %q", identifier, got, expected)
+		}
+	}
+}
+
+func TestTableETagIfMatch(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDuckDB(t)
+
+	etag, err := db.TableETag(ctx, "", "orders")
+	if err != nil || etag != "" {
+		t.Fatalf("Expected no ETag for a missing table, got %q, %v", etag, err)
+	}
+
+	csvPath := writeTestCSV(t, "id\n1\n")
+	if err := db.CreateTableFromCSV(ctx, "orders", csvPath, true, false); err != nil {
+		t.Fatalf("Failed to import CSV: %v", err)
+	}
+	first, err := db.TableETag(ctx, "", "orders")
+	if err != nil || first == "" {
+		t.Fatalf("Expected an ETag for an existing table, got %q, %v", first, err)
+	}
+
+	if _, err := db.ExecuteQuery(ctx, "INSERT INTO orders VALUES (2)"); err != nil {
+		t.Fatalf("Failed to insert: %v", err)
+	}
+	second, _ := db.TableETag(ctx, "", "orders")
+	if second == first {
+		t.Fatal("Expected the ETag to change after an insert")
+	}
+
+	var seen string
+	options := CSVImportOptions{IfMatch: func(etag string) bool {
+		seen = etag
+		return etag == first
+	}}
+	err = db.CreateTableFromCSVWithOptions(ctx, "orders", csvPath, true, true, options)
+	if !errors.Is(err, ErrTableVersionMismatch) {
+		t.Fatalf("Expected ErrTableVersionMismatch, got %v", err)
+	}
+	if seen != second {
+		t.Errorf("Expected IfMatch to be called with the current ETag %q, got %q", second, seen)
+	}
+	result, err := db.ExecuteQuery(ctx, "SELECT COUNT(*) AS n FROM orders")
+	if err != nil || result.Results[0]["n"] != int64(2) {
+		t.Errorf("Expected the table to be kept with 2 rows, got %v, %v", result, err)
+	}
+
+	options.IfMatch = func(etag string) bool { return etag == second }
+	if err := db.CreateTableFromCSVWithOptions(ctx, "orders", csvPath, true, true, options); err != nil {
+		t.Fatalf("Expected the import to replace the table, got %v", err)
+	}
+}
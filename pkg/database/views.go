@@ -0,0 +1,119 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/aliengiraffe/spotdb/pkg/helpers"
+)
+
+// File formats a view can read in place
+const (
+	FileFormatParquet = "parquet"
+	FileFormatCSV     = "csv"
+)
+
+// ErrUnsupportedFileFormat is returned for a view over a file that is neither Parquet nor CSV
+var ErrUnsupportedFileFormat = errors.New("unsupported file format, use parquet or csv")
+
+// ErrViewNotFound is returned for a view that does not exist in the default schema
+var ErrViewNotFound = errors.New("view not found")
+
+// CreateFileView creates a view that reads the file with read_parquet or read_csv, so queries
+// run against the file itself instead of an imported copy. The file must stay in place for
+// as long as the view exists. CSV columns are detected and normalized as for imports.
+func (db *DuckDB) CreateFileView(ctx context.Context, viewName, path, format string, override bool) error {
+	log := helpers.GetLoggerFromContext(ctx)
+
+	var source string
+	switch format {
+	case FileFormatParquet:
+		source = fmt.Sprintf("read_parquet(%s)", quoteLiteral(path))
+	case FileFormatCSV:
+		source = fmt.Sprintf("read_csv(%s, auto_detect=true, normalize_names=true)", quoteLiteral(path))
+	default:
+		return ErrUnsupportedFileFormat
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.db == nil {
+		return errors.New("database connection is closed")
+	}
+
+	createStatement := "CREATE VIEW"
+	if override {
+		createStatement = "CREATE OR REPLACE VIEW"
+	}
+
+	sanitizedViewName := sanitizeTableName(viewName)
+	log.Info("CreateFileView: Creating view over file",
+		slog.String("view", sanitizedViewName),
+		slog.String("format", format),
+		slog.String("path", path),
+		slog.Bool("override", override))
+
+	if _, err := db.db.ExecContext(ctx, fmt.Sprintf("%s %s AS SELECT * FROM %s", createStatement, QuoteIdentifier(sanitizedViewName), source)); err != nil {
+		return fmt.Errorf("failed to create view over file: %w", err)
+	}
+	db.writes.Add(1)
+	db.bumpTableVersionLocked(sanitizedViewName)
+
+	return nil
+}
+
+// MaterializeView copies the current result of a view in the default schema into a table
+// with CREATE TABLE ... AS SELECT * FROM the view, replacing an existing table of that
+// name when override is set. Later changes to the file behind the view do not reach the
+// table. It returns ErrViewNotFound for a missing view and ErrInvalidTableName when the
+// table would take the name of the view.
+func (db *DuckDB) MaterializeView(ctx context.Context, viewName, tableName string, override bool) error {
+	log := helpers.GetLoggerFromContext(ctx)
+
+	sanitizedViewName := sanitizeTableName(viewName)
+	sanitizedTableName := sanitizeTableName(tableName)
+	if strings.EqualFold(sanitizedViewName, sanitizedTableName) {
+		return fmt.Errorf("%w: the table cannot replace view '%s'", ErrInvalidTableName, sanitizedViewName)
+	}
+
+	createStatement := "CREATE TABLE"
+	if override {
+		createStatement = "CREATE OR REPLACE TABLE"
+	}
+
+	log.Info("MaterializeView: Creating table from view",
+		slog.String("view", sanitizedViewName),
+		slog.String("table", sanitizedTableName),
+		slog.Bool("override", override))
+
+	return retryTransient(ctx, "materialize view", helpers.GetWriteBusyRetries(), func() error {
+		db.mu.Lock()
+		defer db.mu.Unlock()
+
+		if db.db == nil {
+			return errors.New("database connection is closed")
+		}
+
+		var exists bool
+		if err := db.db.QueryRowContext(ctx,
+			"SELECT COUNT(*) > 0 FROM information_schema.tables WHERE table_schema = ? AND table_name = ? AND table_type = 'VIEW'",
+			DefaultSchema, sanitizedViewName).Scan(&exists); err != nil {
+			return fmt.Errorf("failed to check view existence: %w", err)
+		}
+		if !exists {
+			return fmt.Errorf("%w: %s", ErrViewNotFound, sanitizedViewName)
+		}
+
+		if _, err := db.db.ExecContext(ctx, fmt.Sprintf("%s %s AS SELECT * FROM %s", createStatement,
+			QualifiedTableName(DefaultSchema, sanitizedTableName), QualifiedTableName(DefaultSchema, sanitizedViewName))); err != nil {
+			return fmt.Errorf("failed to materialize view: %w", err)
+		}
+		db.writes.Add(1)
+		db.bumpTableVersionLocked(sanitizedTableName)
+		return nil
+	})
+}
@@ -0,0 +1,105 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCreateFileView(t *testing.T) {
+	db := newTestDuckDB(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	csvPath := filepath.Join(dir, "people.csv")
+	if err := os.WriteFile(csvPath, []byte("Full Name,Age\nalice,30\nbob,40\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write CSV file: %v", err)
+	}
+	if err := db.CreateFileView(ctx, "people", csvPath, FileFormatCSV, false); err != nil {
+		t.Fatalf("CreateFileView(csv) failed: %v", err)
+	}
+
+	result, err := db.ExecuteQuery(ctx, "SELECT full_name FROM people WHERE age > 35")
+	if err != nil {
+		t.Fatalf("Failed to query CSV view: %v", err)
+	}
+	if len(result.Results) != 1 || result.Results[0]["full_name"] != "bob" {
+		t.Errorf("Unexpected CSV view rows: %v", result.Results)
+	}
+
+	parquetPath := filepath.Join(dir, "people.parquet")
+	if _, err := db.db.ExecContext(ctx, "COPY (SELECT * FROM people) TO "+quoteLiteral(parquetPath)+" (FORMAT PARQUET)"); err != nil {
+		t.Fatalf("Failed to write Parquet file: %v", err)
+	}
+
+	if err := db.CreateFileView(ctx, "people", parquetPath, FileFormatParquet, false); err == nil {
+		t.Error("Expected an error creating an existing view without override")
+	}
+	if err := db.CreateFileView(ctx, "people", parquetPath, FileFormatParquet, true); err != nil {
+		t.Fatalf("CreateFileView(parquet, override) failed: %v", err)
+	}
+
+	result, err = db.ExecuteQuery(ctx, "SELECT COUNT(*) AS n FROM people")
+	if err != nil {
+		t.Fatalf("Failed to query Parquet view: %v", err)
+	}
+	if n, ok := result.Results[0]["n"].(int64); !ok || n != 2 {
+		t.Errorf("Expected 2 rows in Parquet view, got %v", result.Results[0]["n"])
+	}
+
+	if err := db.CreateFileView(ctx, "other", csvPath, "json", false); !errors.Is(err, ErrUnsupportedFileFormat) {
+		t.Errorf("Expected ErrUnsupportedFileFormat, got %v", err)
+	}
+}
+
+func TestMaterializeView(t *testing.T) {
+	db := newTestDuckDB(t)
+	ctx := context.Background()
+
+	csvPath := filepath.Join(t.TempDir(), "people.csv")
+	if err := os.WriteFile(csvPath, []byte("name,age\nalice,30\nbob,40\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write CSV file: %v", err)
+	}
+	if err := db.CreateFileView(ctx, "people", csvPath, FileFormatCSV, false); err != nil {
+		t.Fatalf("CreateFileView failed: %v", err)
+	}
+
+	if err := db.MaterializeView(ctx, "people", "people_frozen", false); err != nil {
+		t.Fatalf("MaterializeView failed: %v", err)
+	}
+
+	// The table keeps its rows once the file behind the view changes
+	if err := os.WriteFile(csvPath, []byte("name,age\ncarol,50\n"), 0o644); err != nil {
+		t.Fatalf("Failed to rewrite CSV file: %v", err)
+	}
+	result, err := db.ExecuteQuery(ctx, "SELECT COUNT(*) AS n FROM people_frozen")
+	if err != nil {
+		t.Fatalf("Failed to query materialized table: %v", err)
+	}
+	if n, ok := result.Results[0]["n"].(int64); !ok || n != 2 {
+		t.Errorf("Expected 2 rows in the materialized table, got %v", result.Results[0]["n"])
+	}
+
+	if err := db.MaterializeView(ctx, "people", "people_frozen", false); err == nil {
+		t.Error("Expected an error materializing into an existing table without override")
+	}
+	if err := db.MaterializeView(ctx, "people", "people_frozen", true); err != nil {
+		t.Fatalf("MaterializeView(override) failed: %v", err)
+	}
+	result, err = db.ExecuteQuery(ctx, "SELECT COUNT(*) AS n FROM people_frozen")
+	if err != nil {
+		t.Fatalf("Failed to query materialized table: %v", err)
+	}
+	if n, ok := result.Results[0]["n"].(int64); !ok || n != 1 {
+		t.Errorf("Expected the replaced table to hold the current row, got %v", result.Results[0]["n"])
+	}
+
+	if err := db.MaterializeView(ctx, "people_frozen", "copy", false); !errors.Is(err, ErrViewNotFound) {
+		t.Errorf("Expected ErrViewNotFound for a table, got %v", err)
+	}
+	if err := db.MaterializeView(ctx, "people", "People", true); !errors.Is(err, ErrInvalidTableName) {
+		t.Errorf("Expected ErrInvalidTableName replacing the view itself, got %v", err)
+	}
+}
@@ -3,6 +3,7 @@ package helpers
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"io"
@@ -10,9 +11,12 @@ import (
 	"log/slog"
 	"net/http"
 	"os"
+	"path/filepath"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	gonanoid "github.com/matoous/go-nanoid/v2"
 )
@@ -38,19 +42,127 @@ func CloseResources(resource io.Closer, resourceName string) {
 
 const apiKeyEnvVar = "API_KEY"
 
+const readOnlyAPIKeysEnvVar = "ENV_READONLY_API_KEYS"
+
+const tenantAPIKeysEnvVar = "ENV_TENANT_API_KEYS"
+
 const apiKeyHeader = "X-API-Key"
 
+// APIKeyRole is the access an API key grants
+type APIKeyRole string
+
+const (
+	// RoleFull grants every endpoint, it is the role of API_KEY
+	RoleFull APIKeyRole = "full"
+	// RoleReadOnly only grants reading data, it is the role of ENV_READONLY_API_KEYS
+	RoleReadOnly APIKeyRole = "read_only"
+	// RoleTenant only grants reading the rows of one tenant, it is the role of
+	// ENV_TENANT_API_KEYS
+	RoleTenant APIKeyRole = "tenant"
+)
+
+// GetReadOnlyAPIKeys returns the comma-separated keys of ENV_READONLY_API_KEYS, which
+// only grant reading data
+func GetReadOnlyAPIKeys() []string {
+	var keys []string
+	for _, key := range strings.Split(os.Getenv(readOnlyAPIKeysEnvVar), ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// GetTenantAPIKeys returns the tenant of each key of ENV_TENANT_API_KEYS, which is a
+// comma-separated list of key=tenant pairs. Entries without a key or tenant are ignored.
+func GetTenantAPIKeys() map[string]string {
+	keys := make(map[string]string)
+	for _, entry := range strings.Split(os.Getenv(tenantAPIKeysEnvVar), ",") {
+		key, tenant, ok := strings.Cut(entry, "=")
+		key, tenant = strings.TrimSpace(key), strings.TrimSpace(tenant)
+		if ok && key != "" && tenant != "" {
+			keys[key] = tenant
+		}
+	}
+	return keys
+}
+
+// IsValidAPIKeyFromHeader reports whether the request carries the configured API key, either
+// in the X-API-Key header or as the password of HTTP Basic auth (the username is ignored).
+// When no API key is configured every request is valid. Read-only keys are not accepted.
 func IsValidAPIKeyFromHeader(header *http.Header) bool {
-	expectedKey := os.Getenv(apiKeyEnvVar)
+	role, ok := APIKeyRoleFromHeader(header)
+	return ok && role == RoleFull
+}
 
-	providedKey := header.Get(apiKeyHeader)
+// APIKeyRoleFromHeader returns the role of the key the request carries, like
+// IsValidAPIKeyFromHeader, and false when it carries neither API_KEY nor one of
+// ENV_READONLY_API_KEYS or ENV_TENANT_API_KEYS. When no API key is configured every
+// request has the full role.
+func APIKeyRoleFromHeader(header *http.Header) (APIKeyRole, bool) {
+	expectedKey := os.Getenv(apiKeyEnvVar)
 
 	// No configured API key, so it passes for all requests
 	if expectedKey == "" {
-		return true
+		return RoleFull, true
+	}
+
+	providedKey := providedAPIKey(header)
+	// Return a role only if both keys are non-empty and match.
+	if providedKey == "" {
+		return "", false
 	}
-	// Return true only if both keys are non-empty and match.
-	return providedKey == expectedKey
+	if providedKey == expectedKey {
+		return RoleFull, true
+	}
+	for _, key := range GetReadOnlyAPIKeys() {
+		if providedKey == key {
+			return RoleReadOnly, true
+		}
+	}
+	if _, ok := GetTenantAPIKeys()[providedKey]; ok {
+		return RoleTenant, true
+	}
+	return "", false
+}
+
+// APIKeyTenantFromHeader returns the tenant of the ENV_TENANT_API_KEYS key the request
+// carries, or "" for any other key. Tenant keys only take effect when API_KEY is set.
+func APIKeyTenantFromHeader(header *http.Header) string {
+	if os.Getenv(apiKeyEnvVar) == "" {
+		return ""
+	}
+	providedKey := providedAPIKey(header)
+	if providedKey == "" {
+		return ""
+	}
+	return GetTenantAPIKeys()[providedKey]
+}
+
+// providedAPIKey returns the key of the X-API-Key header or the Basic auth password
+func providedAPIKey(header *http.Header) string {
+	if providedKey := header.Get(apiKeyHeader); providedKey != "" {
+		return providedKey
+	}
+	password, _ := basicAuthPassword(header)
+	return password
+}
+
+// basicAuthPassword extracts the password from an HTTP Basic Authorization header
+func basicAuthPassword(header *http.Header) (string, bool) {
+	auth := header.Get("Authorization")
+	const prefix = "Basic "
+	if len(auth) < len(prefix) || !strings.EqualFold(auth[:len(prefix)], prefix) {
+		return "", false
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(auth[len(prefix):]))
+	if err != nil {
+		return "", false
+	}
+
+	_, password, ok := strings.Cut(string(decoded), ":")
+	return password, ok
 }
 
 // ValidationIssue contains details about a validation issue
@@ -79,6 +191,9 @@ const DefaultValidationMode = ValidationModeRejectFile
 // ErrInvalidBuffer is returned when the buffer fails validation
 var ErrInvalidBuffer = errors.New("buffer validation failed")
 
+// ErrCellTooLong is returned when a CSV field exceeds the maximum cell length
+var ErrCellTooLong = errors.New("cell exceeds maximum length")
+
 // ProcessingContext holds all data needed for processing
 type ProcessingContext struct {
 	// I/O
@@ -93,6 +208,7 @@ type ProcessingContext struct {
 	ValidationWarnings []string
 
 	// CSV processing data
+	MaxCellLength   int // Maximum length of a single field in bytes
 	HasHeader       bool
 	ColumnMap       map[int]string   // Maps column index to column name
 	CurrentLine     int              // Current line number (1-based)
@@ -110,6 +226,8 @@ var CopyWithMaxSize = CopyWithMaxSizeImpl
 // while enforcing a maximum file size limit. If maxSize is <= 0, it reads the limit
 // from the ENV_MAX_FILE_SIZE environment variable (defaults to 1GB if not set or invalid).
 // If validateBuffer is not nil, it will be called to validate each buffer before writing to dst.
+// When hasHeader is true the first line is parsed as the header to name columns in validation
+// issues and is not validated itself; otherwise every line is validated as data.
 //
 // The behavior of validation depends on the ENV_FILE_VALIDATION_MODE environment variable:
 // - "reject_row": Skip invalid rows/buffers but continue processing (uses line-by-line processing)
@@ -118,7 +236,10 @@ var CopyWithMaxSize = CopyWithMaxSizeImpl
 //
 // Line-by-line processing is used when ValidationModeRejectRow is specified,
 // ensuring that individual rows can be validated and skipped if needed.
-func CopyWithMaxSizeImpl(dst io.Writer, src io.Reader, bufferSize int, maxSize int64, validateBuffer BufferValidationFunc) (written int64, validationIssue *ValidationIssue, err error) {
+//
+// The warnings collected for rows skipped or ignored in the "reject_row" and "ignore"
+// modes are returned so callers can decide whether they are acceptable.
+func CopyWithMaxSizeImpl(dst io.Writer, src io.Reader, bufferSize int, maxSize int64, hasHeader bool, validateBuffer BufferValidationFunc) (written int64, validationIssue *ValidationIssue, warnings []string, err error) {
 	// If maxSize is <= 0, use the default or environment value
 	if maxSize <= 0 {
 		maxSize = GetMaxFileSize()
@@ -133,7 +254,8 @@ func CopyWithMaxSizeImpl(dst io.Writer, src io.Reader, bufferSize int, maxSize i
 		Validator:          validateBuffer,
 		ValidationMode:     GetValidationMode(),
 		ValidationWarnings: []string{},
-		HasHeader:          true, // Default to assuming headers
+		MaxCellLength:      GetMaxCellLength(),
+		HasHeader:          hasHeader,
 		ColumnMap:          make(map[int]string),
 		CurrentLine:        0, // Will be incremented for each line
 		Written:            &written,
@@ -143,7 +265,7 @@ func CopyWithMaxSizeImpl(dst io.Writer, src io.Reader, bufferSize int, maxSize i
 	// Process all data from source
 	err = processSourceData(ctx)
 	if err != nil {
-		return written, ctx.ValidationIssue, err
+		return written, ctx.ValidationIssue, ctx.ValidationWarnings, err
 	}
 
 	// Log summary of warnings if any
@@ -151,7 +273,7 @@ func CopyWithMaxSizeImpl(dst io.Writer, src io.Reader, bufferSize int, maxSize i
 		log.Printf("Completed with %d validation warnings", len(ctx.ValidationWarnings))
 	}
 
-	return written, ctx.ValidationIssue, nil
+	return written, ctx.ValidationIssue, ctx.ValidationWarnings, nil
 }
 
 // processSourceData reads from source and processes data line by line
@@ -212,6 +334,9 @@ func processCompleteLines(ctx *ProcessingContext) error {
 			// No more complete lines, return success
 			return nil
 		}
+		if err != nil {
+			return err
+		}
 
 		// Process the complete line
 		if err := validateAndWrite(line, ctx); err != nil {
@@ -221,12 +346,20 @@ func processCompleteLines(ctx *ProcessingContext) error {
 }
 
 // readNextLine attempts to read the next complete line from the buffer
-// Returns the line and an error (io.EOF if no complete line was found)
+// Returns the line and an error (io.EOF if no complete line was found, wrapping
+// ErrCellTooLong once the incomplete line holds an oversized field)
 func readNextLine(ctx *ProcessingContext) ([]byte, error) {
 	line, err := ctx.LineBuffer.ReadBytes('\n')
 	if err == io.EOF {
 		// Put back the incomplete line for the next read
 		ctx.LineBuffer.Write(line)
+
+		// Stop before a huge field is buffered whole waiting for the end of its line
+		if ctx.MaxCellLength > 0 && len(line) > ctx.MaxCellLength {
+			if fieldIndex, tooLong := findOversizedField(line, ctx.MaxCellLength); tooLong {
+				return nil, cellTooLongError(fieldIndex, ctx.CurrentLine+1, ctx)
+			}
+		}
 	}
 	return line, err
 }
@@ -241,6 +374,11 @@ func validateAndWrite(line []byte, ctx *ProcessingContext) error {
 	// Increment line number
 	ctx.CurrentLine++
 
+	// Reject oversized fields before parsing them or running regex validation
+	if err := checkCellLengths(line, ctx); err != nil {
+		return err
+	}
+
 	// Parse the CSV line to extract column headers if this is the first line
 	if ctx.CurrentLine == 1 && ctx.HasHeader {
 		parseHeaderLine(line, ctx)
@@ -263,18 +401,74 @@ func validateAndWrite(line []byte, ctx *ProcessingContext) error {
 	return writeDataFromContext(line, ctx)
 }
 
+// checkCellLengths returns an error wrapping ErrCellTooLong if any field of the line
+// is longer than the context's maximum cell length
+func checkCellLengths(line []byte, ctx *ProcessingContext) error {
+	// A line shorter than the limit cannot contain an oversized field
+	if ctx.MaxCellLength <= 0 || len(line) <= ctx.MaxCellLength {
+		return nil
+	}
+
+	fieldIndex, tooLong := findOversizedField(line, ctx.MaxCellLength)
+	if !tooLong {
+		return nil
+	}
+	return cellTooLongError(fieldIndex, ctx.CurrentLine, ctx)
+}
+
+// cellTooLongError records the oversized field as the validation issue and returns an
+// error wrapping ErrCellTooLong
+func cellTooLongError(fieldIndex, lineNumber int, ctx *ProcessingContext) error {
+	ctx.ValidationIssue = &ValidationIssue{
+		Pattern: "max cell length",
+		Line:    lineNumber,
+		Column:  getColumnName(fieldIndex, ctx.ColumnMap),
+	}
+	return fmt.Errorf("invalid CSV structure: field %d on line %d: %w of %d bytes",
+		fieldIndex+1, lineNumber, ErrCellTooLong, ctx.MaxCellLength)
+}
+
+// findOversizedField returns the index of the first field longer than maxLength,
+// scanning the line without allocating the fields
+func findOversizedField(line []byte, maxLength int) (int, bool) {
+	delimiter := detectDelimiter(line)
+	line = bytes.TrimRight(line, "\r\n")
+
+	inQuote := false
+	fieldIndex := 0
+	fieldStart := 0
+	for i, c := range line {
+		if c == '"' {
+			inQuote = !inQuote
+		} else if !inQuote && c == delimiter {
+			if i-fieldStart > maxLength {
+				return fieldIndex, true
+			}
+			fieldIndex++
+			fieldStart = i + 1
+		}
+	}
+
+	return fieldIndex, len(line)-fieldStart > maxLength
+}
+
+// detectDelimiter returns the delimiter used by a CSV line, defaulting to comma
+func detectDelimiter(line []byte) byte {
+	if bytes.Contains(line, []byte{'\t'}) {
+		return '\t'
+	} else if bytes.Contains(line, []byte{';'}) {
+		return ';'
+	}
+	return ','
+}
+
 // splitCSVLine splits a CSV line into fields considering quotes and delimiters.
 // It trims trailing newline and carriage return characters.
 func splitCSVLine(line []byte) []string {
 	var fields []string
 
 	// Detect delimiter - default to comma
-	delimiter := ','
-	if bytes.Contains(line, []byte{'\t'}) {
-		delimiter = '\t'
-	} else if bytes.Contains(line, []byte{';'}) {
-		delimiter = ';'
-	}
+	delimiter := detectDelimiter(line)
 
 	// Split by delimiter, accounting for quoted fields
 	inQuote := false
@@ -282,7 +476,7 @@ func splitCSVLine(line []byte) []string {
 	for i, c := range line {
 		if c == '"' {
 			inQuote = !inQuote
-		} else if !inQuote && c == byte(delimiter) {
+		} else if !inQuote && c == delimiter {
 			fields = append(fields, string(line[fieldStart:i]))
 			fieldStart = i + 1
 		}
@@ -516,6 +710,725 @@ func GetBufferSize() int {
 	return bufferSize
 }
 
+// DefaultMultipartMemory is the number of bytes of a multipart form kept in memory (32MB),
+// matching the net/http and gin default
+const DefaultMultipartMemory int64 = 32 << 20
+
+// GetMultipartMemory returns how many bytes of a multipart upload are kept in memory
+// before the rest is spooled to temporary files, from the ENV_MULTIPART_MEMORY
+// environment variable or the default value (32MB)
+func GetMultipartMemory() int64 {
+	memoryStr := os.Getenv("ENV_MULTIPART_MEMORY")
+	if memoryStr == "" {
+		return DefaultMultipartMemory
+	}
+
+	memory, err := strconv.ParseInt(memoryStr, 10, 64)
+	if err != nil {
+		log.Printf("Invalid ENV_MULTIPART_MEMORY value: %v, using default: %d bytes", err, DefaultMultipartMemory)
+		return DefaultMultipartMemory
+	}
+
+	if memory <= 0 {
+		log.Printf("ENV_MULTIPART_MEMORY must be positive, using default: %d bytes", DefaultMultipartMemory)
+		return DefaultMultipartMemory
+	}
+
+	return memory
+}
+
+// DefaultMaxCellLength is the maximum length of a single CSV field in bytes (1MB)
+const DefaultMaxCellLength int = 1024 * 1024
+
+// GetMaxCellLength returns the maximum length of a single CSV field in bytes from the
+// ENV_MAX_CELL_LENGTH environment variable or the default value (1MB)
+func GetMaxCellLength() int {
+	maxLengthStr := os.Getenv("ENV_MAX_CELL_LENGTH")
+	if maxLengthStr == "" {
+		return DefaultMaxCellLength
+	}
+
+	maxLength, err := strconv.Atoi(maxLengthStr)
+	if err != nil {
+		log.Printf("Invalid ENV_MAX_CELL_LENGTH value: %v, using default: %d bytes", err, DefaultMaxCellLength)
+		return DefaultMaxCellLength
+	}
+
+	if maxLength <= 0 {
+		log.Printf("ENV_MAX_CELL_LENGTH must be positive, using default: %d bytes", DefaultMaxCellLength)
+		return DefaultMaxCellLength
+	}
+
+	return maxLength
+}
+
+// DefaultMaxFilenameLength is the maximum length of an uploaded file name in bytes
+const DefaultMaxFilenameLength int = 255
+
+// GetMaxFilenameLength returns the maximum length in bytes of the name of an uploaded
+// file from the ENV_MAX_FILENAME_LENGTH environment variable or the default value (255)
+func GetMaxFilenameLength() int {
+	maxLengthStr := os.Getenv("ENV_MAX_FILENAME_LENGTH")
+	if maxLengthStr == "" {
+		return DefaultMaxFilenameLength
+	}
+
+	maxLength, err := strconv.Atoi(maxLengthStr)
+	if err != nil {
+		log.Printf("Invalid ENV_MAX_FILENAME_LENGTH value: %v, using default: %d bytes", err, DefaultMaxFilenameLength)
+		return DefaultMaxFilenameLength
+	}
+
+	if maxLength <= 0 {
+		log.Printf("ENV_MAX_FILENAME_LENGTH must be positive, using default: %d bytes", DefaultMaxFilenameLength)
+		return DefaultMaxFilenameLength
+	}
+
+	return maxLength
+}
+
+// DefaultMaxEstimatedRows is the default ceiling on a query's estimated cardinality
+const DefaultMaxEstimatedRows int64 = 1_000_000_000
+
+// GetMaxEstimatedRows returns the maximum number of rows any operator of a query may be
+// estimated to produce from the ENV_MAX_ESTIMATED_ROWS environment variable or the
+// default value (1 billion). A value of 0 disables the check.
+func GetMaxEstimatedRows() int64 {
+	maxRowsStr := os.Getenv("ENV_MAX_ESTIMATED_ROWS")
+	if maxRowsStr == "" {
+		return DefaultMaxEstimatedRows
+	}
+
+	maxRows, err := strconv.ParseInt(maxRowsStr, 10, 64)
+	if err != nil {
+		log.Printf("Invalid ENV_MAX_ESTIMATED_ROWS value: %v, using default: %d", err, DefaultMaxEstimatedRows)
+		return DefaultMaxEstimatedRows
+	}
+
+	if maxRows < 0 {
+		log.Printf("ENV_MAX_ESTIMATED_ROWS must not be negative, using default: %d", DefaultMaxEstimatedRows)
+		return DefaultMaxEstimatedRows
+	}
+
+	return maxRows
+}
+
+// GetViewFilesDir returns the directory files registered as views are kept in, from the
+// ENV_VIEW_FILES_DIR environment variable or spotdb_views in the system temp directory
+func GetViewFilesDir() string {
+	if dir := os.Getenv("ENV_VIEW_FILES_DIR"); dir != "" {
+		return dir
+	}
+	return filepath.Join(os.TempDir(), "spotdb_views")
+}
+
+// DefaultMaxQueryLength is the default maximum length of a query in bytes (1MB)
+const DefaultMaxQueryLength = 1 << 20
+
+// GetMaxQueryLength returns the maximum length of a query in bytes from the
+// ENV_MAX_QUERY_LENGTH environment variable or the default value (1MB). A value of 0
+// disables the check.
+func GetMaxQueryLength() int {
+	maxLengthStr := os.Getenv("ENV_MAX_QUERY_LENGTH")
+	if maxLengthStr == "" {
+		return DefaultMaxQueryLength
+	}
+
+	maxLength, err := strconv.Atoi(maxLengthStr)
+	if err != nil {
+		log.Printf("Invalid ENV_MAX_QUERY_LENGTH value: %v, using default: %d", err, DefaultMaxQueryLength)
+		return DefaultMaxQueryLength
+	}
+
+	if maxLength < 0 {
+		log.Printf("ENV_MAX_QUERY_LENGTH must not be negative, using default: %d", DefaultMaxQueryLength)
+		return DefaultMaxQueryLength
+	}
+
+	return maxLength
+}
+
+// GetMaxTotalDisk returns the bytes the database and the temporary upload files may take
+// on disk together from the ENV_MAX_TOTAL_DISK environment variable. The default of 0
+// disables the limit.
+func GetMaxTotalDisk() int64 {
+	maxDiskStr := os.Getenv("ENV_MAX_TOTAL_DISK")
+	if maxDiskStr == "" {
+		return 0
+	}
+
+	maxDisk, err := strconv.ParseInt(maxDiskStr, 10, 64)
+	if err != nil {
+		log.Printf("Invalid ENV_MAX_TOTAL_DISK value: %v, disabling the disk limit", err)
+		return 0
+	}
+
+	if maxDisk < 0 {
+		log.Printf("ENV_MAX_TOTAL_DISK must not be negative, disabling the disk limit")
+		return 0
+	}
+
+	return maxDisk
+}
+
+// DefaultSocketMaxConns is the default number of concurrent socket connections
+const DefaultSocketMaxConns int = 100
+
+// GetSocketMaxConns returns the maximum number of concurrent socket connections from the
+// ENV_SOCKET_MAX_CONNS environment variable or the default value (100). A value of 0
+// removes the limit.
+func GetSocketMaxConns() int {
+	maxConnsStr := os.Getenv("ENV_SOCKET_MAX_CONNS")
+	if maxConnsStr == "" {
+		return DefaultSocketMaxConns
+	}
+
+	maxConns, err := strconv.Atoi(maxConnsStr)
+	if err != nil {
+		log.Printf("Invalid ENV_SOCKET_MAX_CONNS value: %v, using default: %d", err, DefaultSocketMaxConns)
+		return DefaultSocketMaxConns
+	}
+
+	if maxConns < 0 {
+		log.Printf("ENV_SOCKET_MAX_CONNS must not be negative, using default: %d", DefaultSocketMaxConns)
+		return DefaultSocketMaxConns
+	}
+
+	return maxConns
+}
+
+// GetMaxConcurrentQueries returns the maximum number of queries the HTTP API runs at
+// once from the ENV_MAX_CONCURRENT_QUERIES environment variable. Returns 0, leaving the
+// number of queries unlimited, when unset, invalid or negative.
+func GetMaxConcurrentQueries() int {
+	maxQueriesStr := os.Getenv("ENV_MAX_CONCURRENT_QUERIES")
+	if maxQueriesStr == "" {
+		return 0
+	}
+
+	maxQueries, err := strconv.Atoi(maxQueriesStr)
+	if err != nil {
+		log.Printf("Invalid ENV_MAX_CONCURRENT_QUERIES value: %v, not limiting concurrent queries", err)
+		return 0
+	}
+
+	if maxQueries < 0 {
+		log.Printf("ENV_MAX_CONCURRENT_QUERIES must not be negative, not limiting concurrent queries")
+		return 0
+	}
+
+	return maxQueries
+}
+
+// DefaultQueryQueueTimeout is how long a query waits for a free slot when
+// ENV_MAX_CONCURRENT_QUERIES queries are already running
+const DefaultQueryQueueTimeout = 2 * time.Second
+
+// GetQueryQueueTimeout returns how long a query waits for a free slot before it is
+// rejected, from the ENV_QUERY_QUEUE_TIMEOUT environment variable as a Go duration or the
+// default value (2s). 0 rejects excess queries without waiting.
+func GetQueryQueueTimeout() time.Duration {
+	return getTimeout("ENV_QUERY_QUEUE_TIMEOUT", DefaultQueryQueueTimeout)
+}
+
+// DefaultImportRetries is the default number of times a transiently failed import is retried
+const DefaultImportRetries int = 2
+
+// GetImportRetries returns how many times an import that failed with a transient error,
+// such as lock contention, is retried, from the ENV_IMPORT_RETRIES environment variable
+// or the default value (2). A value of 0 disables retries.
+func GetImportRetries() int {
+	retriesStr := os.Getenv("ENV_IMPORT_RETRIES")
+	if retriesStr == "" {
+		return DefaultImportRetries
+	}
+
+	retries, err := strconv.Atoi(retriesStr)
+	if err != nil {
+		log.Printf("Invalid ENV_IMPORT_RETRIES value: %v, using default: %d", err, DefaultImportRetries)
+		return DefaultImportRetries
+	}
+
+	if retries < 0 {
+		log.Printf("ENV_IMPORT_RETRIES must not be negative, using default: %d", DefaultImportRetries)
+		return DefaultImportRetries
+	}
+
+	return retries
+}
+
+// DefaultWriteBusyRetries is the default number of times a write that hit a lock conflict
+// is retried
+const DefaultWriteBusyRetries int = 3
+
+// GetWriteBusyRetries returns how many times a write to the database other than a CSV
+// import, which GetImportRetries covers, that failed with a lock conflict is retried, from the ENV_WRITE_BUSY_RETRIES environment variable or the
+// default value (3). A value of 0 disables retries.
+func GetWriteBusyRetries() int {
+	retriesStr := os.Getenv("ENV_WRITE_BUSY_RETRIES")
+	if retriesStr == "" {
+		return DefaultWriteBusyRetries
+	}
+
+	retries, err := strconv.Atoi(retriesStr)
+	if err != nil {
+		log.Printf("Invalid ENV_WRITE_BUSY_RETRIES value: %v, using default: %d", err, DefaultWriteBusyRetries)
+		return DefaultWriteBusyRetries
+	}
+
+	if retries < 0 {
+		log.Printf("ENV_WRITE_BUSY_RETRIES must not be negative, using default: %d", DefaultWriteBusyRetries)
+		return DefaultWriteBusyRetries
+	}
+
+	return retries
+}
+
+// DefaultBulkDeleteRateLimit is the default number of bulk table deletions a client can
+// make per minute
+const DefaultBulkDeleteRateLimit int = 5
+
+// GetBulkDeleteRateLimit returns how many bulk table deletions each client can make per
+// minute, from the ENV_BULK_DELETE_RATE_LIMIT environment variable or the default value
+// (5). A value of 0 disables the limit.
+func GetBulkDeleteRateLimit() int {
+	limitStr := os.Getenv("ENV_BULK_DELETE_RATE_LIMIT")
+	if limitStr == "" {
+		return DefaultBulkDeleteRateLimit
+	}
+
+	limit, err := strconv.Atoi(limitStr)
+	if err != nil {
+		log.Printf("Invalid ENV_BULK_DELETE_RATE_LIMIT value: %v, using default: %d", err, DefaultBulkDeleteRateLimit)
+		return DefaultBulkDeleteRateLimit
+	}
+
+	if limit < 0 {
+		log.Printf("ENV_BULK_DELETE_RATE_LIMIT must not be negative, using default: %d", DefaultBulkDeleteRateLimit)
+		return DefaultBulkDeleteRateLimit
+	}
+
+	return limit
+}
+
+// DefaultAutoAnalyzeThreshold is the default number of imported rows from which the
+// statistics of the new table are refreshed with ANALYZE
+const DefaultAutoAnalyzeThreshold int = 1_000_000
+
+// GetAutoAnalyzeThreshold returns the number of rows an import must reach for ANALYZE to
+// run on the new table, from the ENV_AUTO_ANALYZE_THRESHOLD environment variable or the
+// default value (1000000). A value of 0 disables the automatic ANALYZE.
+func GetAutoAnalyzeThreshold() int {
+	thresholdStr := os.Getenv("ENV_AUTO_ANALYZE_THRESHOLD")
+	if thresholdStr == "" {
+		return DefaultAutoAnalyzeThreshold
+	}
+
+	threshold, err := strconv.Atoi(thresholdStr)
+	if err != nil {
+		log.Printf("Invalid ENV_AUTO_ANALYZE_THRESHOLD value: %v, using default: %d", err, DefaultAutoAnalyzeThreshold)
+		return DefaultAutoAnalyzeThreshold
+	}
+
+	if threshold < 0 {
+		log.Printf("ENV_AUTO_ANALYZE_THRESHOLD must not be negative, using default: %d", DefaultAutoAnalyzeThreshold)
+		return DefaultAutoAnalyzeThreshold
+	}
+
+	return threshold
+}
+
+// DefaultMCPMaxRows is the default number of rows included in an MCP query result
+const DefaultMCPMaxRows int = 100
+
+// GetMCPMaxRows returns how many rows of a query result are returned to MCP clients
+// before the result is truncated, from the ENV_MCP_MAX_ROWS environment variable or the
+// default value (100). A value of 0 removes the limit.
+func GetMCPMaxRows() int {
+	maxRowsStr := os.Getenv("ENV_MCP_MAX_ROWS")
+	if maxRowsStr == "" {
+		return DefaultMCPMaxRows
+	}
+
+	maxRows, err := strconv.Atoi(maxRowsStr)
+	if err != nil {
+		log.Printf("Invalid ENV_MCP_MAX_ROWS value: %v, using default: %d", err, DefaultMCPMaxRows)
+		return DefaultMCPMaxRows
+	}
+
+	if maxRows < 0 {
+		log.Printf("ENV_MCP_MAX_ROWS must not be negative, using default: %d", DefaultMCPMaxRows)
+		return DefaultMCPMaxRows
+	}
+
+	return maxRows
+}
+
+// DefaultMCPMaxBytes is the default size in bytes of an MCP query result (32KB)
+const DefaultMCPMaxBytes int = 32 * 1024
+
+// GetMCPMaxBytes returns the size in bytes a query result returned to MCP clients may
+// reach before it is truncated, from the ENV_MCP_MAX_BYTES environment variable or the
+// default value (32KB). A value of 0 removes the limit.
+func GetMCPMaxBytes() int {
+	maxBytesStr := os.Getenv("ENV_MCP_MAX_BYTES")
+	if maxBytesStr == "" {
+		return DefaultMCPMaxBytes
+	}
+
+	maxBytes, err := strconv.Atoi(maxBytesStr)
+	if err != nil {
+		log.Printf("Invalid ENV_MCP_MAX_BYTES value: %v, using default: %d bytes", err, DefaultMCPMaxBytes)
+		return DefaultMCPMaxBytes
+	}
+
+	if maxBytes < 0 {
+		log.Printf("ENV_MCP_MAX_BYTES must not be negative, using default: %d bytes", DefaultMCPMaxBytes)
+		return DefaultMCPMaxBytes
+	}
+
+	return maxBytes
+}
+
+// DefaultMinCSVColumns is the default number of columns a file needs to be accepted as CSV
+const DefaultMinCSVColumns int = 1
+
+// GetMinCSVColumns returns the number of columns an uploaded file needs to be accepted as
+// CSV, from the ENV_MIN_CSV_COLUMNS environment variable or the default value (1)
+func GetMinCSVColumns() int {
+	minColumnsStr := os.Getenv("ENV_MIN_CSV_COLUMNS")
+	if minColumnsStr == "" {
+		return DefaultMinCSVColumns
+	}
+
+	minColumns, err := strconv.Atoi(minColumnsStr)
+	if err != nil {
+		log.Printf("Invalid ENV_MIN_CSV_COLUMNS value: %v, using default: %d", err, DefaultMinCSVColumns)
+		return DefaultMinCSVColumns
+	}
+
+	if minColumns < 1 {
+		log.Printf("ENV_MIN_CSV_COLUMNS must be at least 1, using default: %d", DefaultMinCSVColumns)
+		return DefaultMinCSVColumns
+	}
+
+	return minColumns
+}
+
+// DefaultGCThresholdMB is the upload size in MB above which a garbage collection is forced
+const DefaultGCThresholdMB int64 = 100
+
+// GetGCThreshold returns the upload size in bytes above which a garbage collection is
+// forced after cleanup, from the ENV_GC_THRESHOLD_MB environment variable or the
+// default value (100MB)
+func GetGCThreshold() int64 {
+	thresholdStr := os.Getenv("ENV_GC_THRESHOLD_MB")
+	if thresholdStr == "" {
+		return DefaultGCThresholdMB * 1024 * 1024
+	}
+
+	threshold, err := strconv.ParseInt(thresholdStr, 10, 64)
+	if err != nil {
+		log.Printf("Invalid ENV_GC_THRESHOLD_MB value: %v, using default: %d MB", err, DefaultGCThresholdMB)
+		return DefaultGCThresholdMB * 1024 * 1024
+	}
+
+	if threshold < 0 {
+		log.Printf("ENV_GC_THRESHOLD_MB must not be negative, using default: %d MB", DefaultGCThresholdMB)
+		return DefaultGCThresholdMB * 1024 * 1024
+	}
+
+	return threshold * 1024 * 1024
+}
+
+// GetAutoSnapshotInterval returns how often the database is snapshotted automatically, from
+// the ENV_AUTO_SNAPSHOT_INTERVAL environment variable as a Go duration (e.g. "15m").
+// Returns 0, disabling automatic snapshots, when unset or invalid.
+func GetAutoSnapshotInterval() time.Duration {
+	intervalStr := os.Getenv("ENV_AUTO_SNAPSHOT_INTERVAL")
+	if intervalStr == "" {
+		return 0
+	}
+
+	interval, err := time.ParseDuration(intervalStr)
+	if err != nil {
+		log.Printf("Invalid ENV_AUTO_SNAPSHOT_INTERVAL value: %v, automatic snapshots disabled", err)
+		return 0
+	}
+
+	if interval <= 0 {
+		log.Printf("ENV_AUTO_SNAPSHOT_INTERVAL must be positive, automatic snapshots disabled")
+		return 0
+	}
+
+	return interval
+}
+
+// Default timeouts of the HTTP API server
+const (
+	DefaultHTTPReadHeaderTimeout = 10 * time.Second
+	DefaultHTTPReadTimeout       = 15 * time.Minute
+	DefaultHTTPWriteTimeout      = 5 * time.Minute
+	DefaultHTTPIdleTimeout       = 2 * time.Minute
+)
+
+// HTTPTimeouts holds the timeouts of the HTTP API server, a zero duration disables one
+type HTTPTimeouts struct {
+	ReadHeader time.Duration
+	Read       time.Duration
+	Write      time.Duration
+	Idle       time.Duration
+}
+
+// GetHTTPTimeouts returns the HTTP API server timeouts from the ENV_HTTP_READ_HEADER_TIMEOUT,
+// ENV_HTTP_READ_TIMEOUT, ENV_HTTP_WRITE_TIMEOUT and ENV_HTTP_IDLE_TIMEOUT environment
+// variables as Go durations (e.g. "30s"), where "0" disables a timeout
+func GetHTTPTimeouts() HTTPTimeouts {
+	return HTTPTimeouts{
+		ReadHeader: getTimeout("ENV_HTTP_READ_HEADER_TIMEOUT", DefaultHTTPReadHeaderTimeout),
+		Read:       getTimeout("ENV_HTTP_READ_TIMEOUT", DefaultHTTPReadTimeout),
+		Write:      getTimeout("ENV_HTTP_WRITE_TIMEOUT", DefaultHTTPWriteTimeout),
+		Idle:       getTimeout("ENV_HTTP_IDLE_TIMEOUT", DefaultHTTPIdleTimeout),
+	}
+}
+
+// HTTPProtocols holds the protocol settings of the HTTP API server
+type HTTPProtocols struct {
+	// TLSCertFile and TLSKeyFile serve the API over TLS, negotiating HTTP/2 with clients
+	// that support it
+	TLSCertFile string
+	TLSKeyFile  string
+	// CleartextHTTP2 also accepts HTTP/2 without TLS (h2c) from clients with prior knowledge
+	CleartextHTTP2 bool
+	// KeepAlives keeps HTTP/1.1 connections open between requests
+	KeepAlives bool
+	// MaxConcurrentStreams caps the requests in flight on one HTTP/2 connection, 0 keeps
+	// the Go default
+	MaxConcurrentStreams int
+}
+
+// TLSEnabled reports whether both a certificate and a key are configured
+func (p HTTPProtocols) TLSEnabled() bool {
+	return p.TLSCertFile != "" && p.TLSKeyFile != ""
+}
+
+// Validate returns an error when only one of the certificate and the key is configured,
+// which would otherwise serve plain HTTP where TLS was intended
+func (p HTTPProtocols) Validate() error {
+	if (p.TLSCertFile == "") != (p.TLSKeyFile == "") {
+		return errors.New("ENV_TLS_CERT_FILE and ENV_TLS_KEY_FILE must be set together")
+	}
+	return nil
+}
+
+// GetHTTPProtocols returns the HTTP API server protocol settings from the
+// ENV_TLS_CERT_FILE, ENV_TLS_KEY_FILE, ENV_HTTP2_CLEARTEXT ("true" enables h2c),
+// ENV_HTTP_KEEP_ALIVES ("false" disables keep-alives) and ENV_HTTP2_MAX_CONCURRENT_STREAMS
+// environment variables
+func GetHTTPProtocols() HTTPProtocols {
+	protocols := HTTPProtocols{
+		TLSCertFile:    os.Getenv("ENV_TLS_CERT_FILE"),
+		TLSKeyFile:     os.Getenv("ENV_TLS_KEY_FILE"),
+		CleartextHTTP2: os.Getenv("ENV_HTTP2_CLEARTEXT") == "true",
+		KeepAlives:     os.Getenv("ENV_HTTP_KEEP_ALIVES") != "false",
+	}
+
+	if streamsStr := os.Getenv("ENV_HTTP2_MAX_CONCURRENT_STREAMS"); streamsStr != "" {
+		streams, err := strconv.Atoi(streamsStr)
+		if err != nil || streams < 0 {
+			log.Printf("Invalid ENV_HTTP2_MAX_CONCURRENT_STREAMS value: %q, using the Go default", streamsStr)
+		} else {
+			protocols.MaxConcurrentStreams = streams
+		}
+	}
+
+	return protocols
+}
+
+// getTimeout reads a timeout from an environment variable, falling back to defaultValue
+// when it is unset or invalid
+func getTimeout(name string, defaultValue time.Duration) time.Duration {
+	timeoutStr := os.Getenv(name)
+	if timeoutStr == "" {
+		return defaultValue
+	}
+
+	timeout, err := time.ParseDuration(timeoutStr)
+	if err != nil {
+		log.Printf("Invalid %s value: %v, using default: %s", name, err, defaultValue)
+		return defaultValue
+	}
+
+	if timeout < 0 {
+		log.Printf("%s must not be negative, using default: %s", name, defaultValue)
+		return defaultValue
+	}
+
+	return timeout
+}
+
+// GetAutoSnapshotLocation returns the S3 URI (s3://bucket/prefix) automatic snapshots are
+// uploaded under, from the ENV_AUTO_SNAPSHOT_LOCATION environment variable
+func GetAutoSnapshotLocation() string {
+	return os.Getenv("ENV_AUTO_SNAPSHOT_LOCATION")
+}
+
+// GetNullRepresentation returns the string SQL NULLs are rendered as in JSON query results,
+// from the ENV_NULL_REPRESENTATION environment variable. Empty (default) keeps JSON null.
+func GetNullRepresentation() string {
+	return os.Getenv("ENV_NULL_REPRESENTATION")
+}
+
+// DefaultAllowedFileExtensions are the file extensions accepted for uploads by default
+var DefaultAllowedFileExtensions = []string{".csv", ".tsv", ".txt"}
+
+// GetAllowedFileExtensions returns the lower-cased file extensions accepted for uploads, from
+// the comma-separated ENV_ALLOWED_FILE_EXTENSIONS environment variable (e.g. ".csv,.psv")
+// or DefaultAllowedFileExtensions. A missing leading dot is added.
+func GetAllowedFileExtensions() []string {
+	extensionsStr := os.Getenv("ENV_ALLOWED_FILE_EXTENSIONS")
+	if extensionsStr == "" {
+		return DefaultAllowedFileExtensions
+	}
+
+	var extensions []string
+	for _, ext := range strings.Split(extensionsStr, ",") {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if ext == "" {
+			continue
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		extensions = append(extensions, ext)
+	}
+
+	if len(extensions) == 0 {
+		log.Printf("Invalid ENV_ALLOWED_FILE_EXTENSIONS value: %q, using default: %v", extensionsStr, DefaultAllowedFileExtensions)
+		return DefaultAllowedFileExtensions
+	}
+	return extensions
+}
+
+// DefaultHiddenTablePrefixes are the name prefixes of internal tables left out of table
+// listings by default
+var DefaultHiddenTablePrefixes = []string{"_spotdb_"}
+
+// GetHiddenTablePrefixes returns the lower-cased name prefixes of tables left out of the
+// tables listing and the export of all tables, from the comma-separated
+// ENV_HIDDEN_TABLE_PREFIXES environment variable or DefaultHiddenTablePrefixes
+func GetHiddenTablePrefixes() []string {
+	prefixesStr := os.Getenv("ENV_HIDDEN_TABLE_PREFIXES")
+	if prefixesStr == "" {
+		return DefaultHiddenTablePrefixes
+	}
+
+	var prefixes []string
+	for _, prefix := range strings.Split(prefixesStr, ",") {
+		if prefix = strings.ToLower(strings.TrimSpace(prefix)); prefix != "" {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+
+	if len(prefixes) == 0 {
+		log.Printf("Invalid ENV_HIDDEN_TABLE_PREFIXES value: %q, using default: %v", prefixesStr, DefaultHiddenTablePrefixes)
+		return DefaultHiddenTablePrefixes
+	}
+	return prefixes
+}
+
+// IsMimeValidationSkipRequested reports whether ENV_SKIP_MIME_VALIDATION is set to "true".
+// Callers must only honor it outside of release mode.
+func IsMimeValidationSkipRequested() bool {
+	return os.Getenv("ENV_SKIP_MIME_VALIDATION") == "true"
+}
+
+// GetSnapshotStoreScheme returns the storage backend for snapshot requests whose bucket
+// has no s3:// or gs:// prefix, from the ENV_SNAPSHOT_STORE environment variable.
+// Valid values are "s3" (default) and "gs".
+func GetSnapshotStoreScheme() string {
+	scheme := os.Getenv("ENV_SNAPSHOT_STORE")
+	switch scheme {
+	case "":
+		return "s3"
+	case "s3", "gs":
+		return scheme
+	default:
+		log.Printf("Invalid ENV_SNAPSHOT_STORE value: %q, using default: s3", scheme)
+		return "s3"
+	}
+}
+
+// IsAdminAPIEnabled reports whether the admin endpoints under /api/v1/admin are served,
+// as set by the ENV_ENABLE_ADMIN_API environment variable
+func IsAdminAPIEnabled() bool {
+	return os.Getenv("ENV_ENABLE_ADMIN_API") == "true"
+}
+
+// IsResponseWrappingEnabled reports whether successful JSON responses are wrapped in a
+// uniform status, data and meta envelope, as set by the ENV_WRAP_RESPONSES environment variable
+func IsResponseWrappingEnabled() bool {
+	return os.Getenv("ENV_WRAP_RESPONSES") == "true"
+}
+
+// IsRequestLogCaptureEnabled reports whether the log entries of each request are kept for
+// the admin request logs endpoint, as set by the ENV_CAPTURE_REQUEST_LOGS environment variable
+func IsRequestLogCaptureEnabled() bool {
+	return os.Getenv("ENV_CAPTURE_REQUEST_LOGS") == "true"
+}
+
+// IsBenchmarkingDisabled reports whether all benchmark work is skipped, even when a query
+// requests benchmarks, as set by the ENV_DISABLE_BENCHMARKS environment variable
+func IsBenchmarkingDisabled() bool {
+	return os.Getenv("ENV_DISABLE_BENCHMARKS") == "true"
+}
+
+// IsCaseInsensitiveTableLookupEnabled reports whether the table endpoints match the table
+// name of the path against the existing tables ignoring case, as set by the
+// ENV_CASE_INSENSITIVE_TABLES environment variable
+func IsCaseInsensitiveTableLookupEnabled() bool {
+	return os.Getenv("ENV_CASE_INSENSITIVE_TABLES") == "true"
+}
+
+// IsStrictBenchmarkParamEnabled reports whether a benchmark query parameter other than
+// "true" or "false" is rejected instead of ignored, as set by the
+// ENV_STRICT_BENCHMARK_PARAM environment variable
+func IsStrictBenchmarkParamEnabled() bool {
+	return os.Getenv("ENV_STRICT_BENCHMARK_PARAM") == "true"
+}
+
+// DefaultProfilingInterval is the minimum time between two queries profiled by DuckDB
+const DefaultProfilingInterval = time.Second
+
+// GetProfilingInterval returns the minimum time between two queries run with DuckDB
+// profiling for benchmarks, from the ENV_PROFILING_INTERVAL environment variable as a Go
+// duration or the default value (1s). 0 profiles every query requesting benchmarks.
+func GetProfilingInterval() time.Duration {
+	return getTimeout("ENV_PROFILING_INTERVAL", DefaultProfilingInterval)
+}
+
+// IsQueryDurationHeaderDisabled reports whether query responses leave out the
+// X-Query-Duration-Ms header, as set by the ENV_DISABLE_QUERY_DURATION_HEADER environment
+// variable
+func IsQueryDurationHeaderDisabled() bool {
+	return os.Getenv("ENV_DISABLE_QUERY_DURATION_HEADER") == "true"
+}
+
+// DefaultRequestLogTTL is how long the captured log entries of a request are kept
+const DefaultRequestLogTTL = 5 * time.Minute
+
+// GetRequestLogTTL returns how long the captured log entries of a request are kept after
+// its last entry, from the ENV_REQUEST_LOG_TTL environment variable as a Go duration or
+// the default value (5m)
+func GetRequestLogTTL() time.Duration {
+	ttl := getTimeout("ENV_REQUEST_LOG_TTL", DefaultRequestLogTTL)
+	if ttl == 0 {
+		log.Printf("ENV_REQUEST_LOG_TTL must be positive, using default: %s", DefaultRequestLogTTL)
+		return DefaultRequestLogTTL
+	}
+	return ttl
+}
+
 // GetValidationMode returns the validation mode from the ENV_FILE_VALIDATION_MODE environment variable
 // Valid values are:
 // - "reject_row": Skip invalid rows/buffers but continue processing
@@ -536,6 +1449,97 @@ func GetValidationMode() string {
 	}
 }
 
+// Table name sanitization strategies
+const (
+	TableNameSanitizationStrict = "strict" // Replace everything but ASCII letters, digits and underscores
+	TableNameSanitizationQuoted = "quoted" // Keep other characters and rely on quoted identifiers
+)
+
+// GetTableNameSanitization returns the table name sanitization strategy from the
+// ENV_TABLE_NAME_SANITIZATION environment variable, TableNameSanitizationStrict by default
+func GetTableNameSanitization() string {
+	strategy := os.Getenv("ENV_TABLE_NAME_SANITIZATION")
+	if strategy == "" {
+		return TableNameSanitizationStrict
+	}
+
+	switch strategy {
+	case TableNameSanitizationStrict, TableNameSanitizationQuoted:
+		return strategy
+	default:
+		log.Printf("Invalid ENV_TABLE_NAME_SANITIZATION value: %s, using default: %s", strategy, TableNameSanitizationStrict)
+		return TableNameSanitizationStrict
+	}
+}
+
+// GetSnapshotCallbackAllowedHosts returns the hosts snapshot callbacks may be sent to, from the
+// comma-separated ENV_SNAPSHOT_CALLBACK_ALLOWED_HOSTS environment variable.
+// Entries are lower-cased host names, optionally with a port. An empty list disables callbacks.
+func GetSnapshotCallbackAllowedHosts() []string {
+	hostsStr := os.Getenv("ENV_SNAPSHOT_CALLBACK_ALLOWED_HOSTS")
+	if hostsStr == "" {
+		return nil
+	}
+
+	var hosts []string
+	for _, host := range strings.Split(hostsStr, ",") {
+		host = strings.ToLower(strings.TrimSpace(host))
+		if host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+// GetS3ObjectMetadata returns the user metadata added to every object uploaded to S3,
+// from the ENV_S3_OBJECT_METADATA environment variable as comma-separated key=value pairs
+func GetS3ObjectMetadata() (map[string]string, error) {
+	return parseKeyValueList("ENV_S3_OBJECT_METADATA")
+}
+
+// GetS3ObjectTags returns the tags applied to every object uploaded to S3, from the
+// ENV_S3_OBJECT_TAGS environment variable as comma-separated key=value pairs
+func GetS3ObjectTags() (map[string]string, error) {
+	return parseKeyValueList("ENV_S3_OBJECT_TAGS")
+}
+
+// GetS3ServerSideEncryption returns the server-side encryption of objects uploaded to S3,
+// AES256 or aws:kms, from the ENV_S3_SSE environment variable. Empty leaves it to the
+// bucket's default encryption.
+func GetS3ServerSideEncryption() string {
+	return strings.TrimSpace(os.Getenv("ENV_S3_SSE"))
+}
+
+// GetS3SSEKMSKeyID returns the KMS key objects uploaded to S3 are encrypted with, from
+// the ENV_S3_SSE_KMS_KEY_ID environment variable
+func GetS3SSEKMSKeyID() string {
+	return strings.TrimSpace(os.Getenv("ENV_S3_SSE_KMS_KEY_ID"))
+}
+
+// parseKeyValueList parses an environment variable holding comma-separated key=value
+// pairs. Unlike most settings an invalid value is an error rather than ignored, since
+// these are typically required by bucket policies.
+func parseKeyValueList(envVar string) (map[string]string, error) {
+	listStr := os.Getenv(envVar)
+	if strings.TrimSpace(listStr) == "" {
+		return nil, nil
+	}
+
+	values := make(map[string]string)
+	for _, pair := range strings.Split(listStr, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		key, value, found := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !found || key == "" {
+			return nil, fmt.Errorf("invalid %s entry %q: must be key=value", envVar, pair)
+		}
+		values[key] = strings.TrimSpace(value)
+	}
+	return values, nil
+}
+
 // Precompiled patterns for performance
 var compiledPatterns map[string]*regexp.Regexp
 
@@ -788,6 +1792,22 @@ func SetLoggerInContext(ctx context.Context, logger *slog.Logger) context.Contex
 	return context.WithValue(ctx, myLoggerKey, logger)
 }
 
+var requestIDKey ContextKey = ContextKey("request id")
+
+// GetRequestIDFromContext returns the ID of the request the context belongs to, or ""
+func GetRequestIDFromContext(ctx context.Context) string {
+	if requestID, ok := ctx.Value(requestIDKey).(string); ok {
+		return requestID
+	}
+	return ""
+}
+
+// SetRequestIDInContext returns a new context containing the provided request ID.
+// Consumers can retrieve it via GetRequestIDFromContext.
+func SetRequestIDInContext(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey, requestID)
+}
+
 func GetHostname() string {
 	name, err := os.Hostname()
 
@@ -814,3 +1834,89 @@ func GenerateID() string {
 func GetServerMode() string {
 	return os.Getenv("ENV_SERVER_MODE")
 }
+
+// intEnvVars are the environment variables holding non-negative integers
+var intEnvVars = []string{
+	"ENV_AUTO_ANALYZE_THRESHOLD",
+	"ENV_BULK_DELETE_RATE_LIMIT",
+	"ENV_GC_THRESHOLD_MB",
+	"ENV_HTTP2_MAX_CONCURRENT_STREAMS",
+	"ENV_IMPORT_RETRIES",
+	"ENV_MAX_CONCURRENT_QUERIES",
+	"ENV_MAX_ESTIMATED_ROWS",
+	"ENV_MAX_QUERY_LENGTH",
+	"ENV_MAX_TOTAL_DISK",
+	"ENV_MCP_MAX_BYTES",
+	"ENV_MCP_MAX_ROWS",
+	"ENV_RATE_LIMIT_RPS",
+	"ENV_SOCKET_MAX_CONNS",
+	"ENV_WRITE_BUSY_RETRIES",
+}
+
+// positiveIntEnvVars are the environment variables holding positive integers, their
+// getters fall back to the default on 0
+var positiveIntEnvVars = []string{
+	"ENV_BUFFER_SIZE",
+	"ENV_MAX_CELL_LENGTH",
+	"ENV_MAX_FILENAME_LENGTH",
+	"ENV_MAX_FILE_SIZE",
+	"ENV_MIN_CSV_COLUMNS",
+	"ENV_MULTIPART_MEMORY",
+}
+
+// durationEnvVars are the environment variables holding non-negative Go durations
+var durationEnvVars = []string{
+	"ENV_AUTO_SNAPSHOT_INTERVAL",
+	"ENV_HTTP_IDLE_TIMEOUT",
+	"ENV_HTTP_READ_HEADER_TIMEOUT",
+	"ENV_HTTP_READ_TIMEOUT",
+	"ENV_HTTP_WRITE_TIMEOUT",
+	"ENV_PROFILING_INTERVAL",
+	"ENV_QUERY_QUEUE_TIMEOUT",
+	"ENV_REQUEST_LOG_TTL",
+}
+
+// enumEnvVars are the environment variables restricted to a set of values
+var enumEnvVars = map[string][]string{
+	"ENV_FILE_VALIDATION_MODE":    {ValidationModeRejectRow, ValidationModeRejectFile, ValidationModeIgnore},
+	"ENV_SERVER_MODE":             {"debug", "release", "test"},
+	"ENV_SNAPSHOT_STORE":          {"s3", "gs"},
+	"ENV_TABLE_NAME_SANITIZATION": {TableNameSanitizationStrict, TableNameSanitizationQuoted},
+}
+
+// ValidateEnvConfig checks the numeric, duration and enumerated environment variables that
+// are set. The getters fall back to their defaults on invalid values, which hides typos,
+// so this reports every invalid value at once, joined into a single error.
+func ValidateEnvConfig() error {
+	var errs []error
+	for _, name := range intEnvVars {
+		if value := os.Getenv(name); value != "" {
+			if n, err := strconv.ParseInt(value, 10, 64); err != nil || n < 0 {
+				errs = append(errs, fmt.Errorf("%s=%q: must be a non-negative integer", name, value))
+			}
+		}
+	}
+	for _, name := range positiveIntEnvVars {
+		if value := os.Getenv(name); value != "" {
+			if n, err := strconv.ParseInt(value, 10, 64); err != nil || n <= 0 {
+				errs = append(errs, fmt.Errorf("%s=%q: must be a positive integer", name, value))
+			}
+		}
+	}
+	for _, name := range durationEnvVars {
+		if value := os.Getenv(name); value != "" {
+			if d, err := time.ParseDuration(value); err != nil || d < 0 {
+				errs = append(errs, fmt.Errorf("%s=%q: must be a non-negative duration such as 30s or 5m", name, value))
+			}
+		}
+	}
+	for name, allowed := range enumEnvVars {
+		if value := os.Getenv(name); value != "" && !slices.Contains(allowed, value) {
+			errs = append(errs, fmt.Errorf("%s=%q: must be one of %s", name, value, strings.Join(allowed, ", ")))
+		}
+	}
+
+	// Map iteration order is random, keep the report stable
+	slices.SortFunc(errs, func(a, b error) int { return strings.Compare(a.Error(), b.Error()) })
+	return errors.Join(errs...)
+}
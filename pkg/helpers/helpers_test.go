@@ -3,15 +3,20 @@ package helpers
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"io"
 	"log"
 	"log/slog"
+	"maps"
 	"net/http"
 	"os"
+	"reflect"
+	"slices"
 	"strings"
 	"testing"
+	"time"
 )
 
 func init() {
@@ -51,6 +56,95 @@ func TestIsValidAPIKeyFromHeader(t *testing.T) {
 	}
 }
 
+// TestIsValidAPIKeyFromHeader_BasicAuth verifies the API key is accepted as the Basic auth password
+func TestIsValidAPIKeyFromHeader_BasicAuth(t *testing.T) {
+	basic := func(credentials string) string {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(credentials))
+	}
+
+	tests := []struct {
+		name          string
+		authorization string
+		apiKey        string
+		want          bool
+	}{
+		{name: "matching password", authorization: basic("any-user:secret"), want: true},
+		{name: "empty username", authorization: basic(":secret"), want: true},
+		{name: "lowercase scheme", authorization: "basic " + base64.StdEncoding.EncodeToString([]byte("u:secret")), want: true},
+		{name: "wrong password", authorization: basic("user:wrong"), want: false},
+		{name: "key as username only", authorization: basic("secret:"), want: false},
+		{name: "missing colon", authorization: basic("secret"), want: false},
+		{name: "invalid base64", authorization: "Basic not-base64!", want: false},
+		{name: "bearer scheme", authorization: "Bearer secret", want: false},
+		{name: "wrong X-API-Key is not rescued by Basic auth", authorization: basic("user:secret"), apiKey: "wrong", want: false},
+	}
+
+	testEnvVar(t, apiKeyEnvVar, "secret")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			header.Set("Authorization", tt.authorization)
+			if tt.apiKey != "" {
+				header.Set(apiKeyHeader, tt.apiKey)
+			}
+			if got := IsValidAPIKeyFromHeader(&header); got != tt.want {
+				t.Errorf("IsValidAPIKeyFromHeader() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestAPIKeyRoleFromHeader verifies that read-only keys are told apart from API_KEY
+func TestAPIKeyRoleFromHeader(t *testing.T) {
+	testEnvVar(t, apiKeyEnvVar, "secret")
+	testEnvVar(t, readOnlyAPIKeysEnvVar, "reader-one, reader-two,")
+	testEnvVar(t, tenantAPIKeysEnvVar, "acme-key=acme, globex-key = globex,broken,=nobody")
+
+	tests := []struct {
+		name     string
+		key      string
+		wantRole APIKeyRole
+		wantOK   bool
+	}{
+		{name: "full key", key: "secret", wantRole: RoleFull, wantOK: true},
+		{name: "first read-only key", key: "reader-one", wantRole: RoleReadOnly, wantOK: true},
+		{name: "second read-only key", key: "reader-two", wantRole: RoleReadOnly, wantOK: true},
+		{name: "tenant key", key: "acme-key", wantRole: RoleTenant, wantOK: true},
+		{name: "unknown key", key: "reader-three", wantOK: false},
+		{name: "no key", wantOK: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.key != "" {
+				header.Set(apiKeyHeader, tt.key)
+			}
+			role, ok := APIKeyRoleFromHeader(&header)
+			if role != tt.wantRole || ok != tt.wantOK {
+				t.Errorf("APIKeyRoleFromHeader() = %q, %v, want %q, %v", role, ok, tt.wantRole, tt.wantOK)
+			}
+		})
+	}
+
+	// Read-only keys are not valid where only API_KEY is accepted
+	header := http.Header{}
+	header.Set(apiKeyHeader, "reader-one")
+	if IsValidAPIKeyFromHeader(&header) {
+		t.Error("Expected a read-only key to be rejected by IsValidAPIKeyFromHeader")
+	}
+
+	if tenant := APIKeyTenantFromHeader(&header); tenant != "" {
+		t.Errorf("Expected no tenant for a read-only key, got %q", tenant)
+	}
+	header.Set(apiKeyHeader, "globex-key")
+	if tenant := APIKeyTenantFromHeader(&header); tenant != "globex" {
+		t.Errorf("Expected tenant globex, got %q", tenant)
+	}
+	if keys := GetTenantAPIKeys(); len(keys) != 2 {
+		t.Errorf("Expected 2 tenant keys, got %v", keys)
+	}
+}
+
 // Test constants to avoid string duplication
 const (
 	// Test error messages
@@ -264,7 +358,7 @@ func TestCopyWithMaxSize(t *testing.T) {
 			tt.setupEnv(t)
 
 			src, dst := setupCopyTest(tt.input)
-			gotWritten, _, err := CopyWithMaxSize(dst, src, tt.bufferSize, tt.maxSize, tt.validator)
+			gotWritten, _, _, err := CopyWithMaxSize(dst, src, tt.bufferSize, tt.maxSize, true, tt.validator)
 
 			verifyError(t, err, tt.wantErr)
 
@@ -310,6 +404,627 @@ func TestGetMaxFileSize(t *testing.T) {
 	}
 }
 
+func TestGetGCThreshold(t *testing.T) {
+	defaultThreshold := DefaultGCThresholdMB * 1024 * 1024
+	tests := []struct {
+		name     string
+		envValue string
+		want     int64
+	}{
+		{name: "Default value", envValue: "", want: defaultThreshold},
+		{name: "Custom value", envValue: "10", want: 10 * 1024 * 1024},
+		{name: "Zero value", envValue: "0", want: 0},
+		{name: "Invalid value", envValue: "not-a-number", want: defaultThreshold},
+		{name: "Negative value", envValue: "-1", want: defaultThreshold},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testEnvVar(t, "ENV_GC_THRESHOLD_MB", tt.envValue)
+
+			if got := GetGCThreshold(); got != tt.want {
+				t.Errorf("GetGCThreshold() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetMaxCellLength(t *testing.T) {
+	tests := []struct {
+		name     string
+		envValue string
+		want     int
+	}{
+		{name: "Default value", envValue: "", want: DefaultMaxCellLength},
+		{name: "Custom value", envValue: "512", want: 512},
+		{name: "Invalid value", envValue: "not-a-number", want: DefaultMaxCellLength},
+		{name: "Zero value", envValue: "0", want: DefaultMaxCellLength},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testEnvVar(t, "ENV_MAX_CELL_LENGTH", tt.envValue)
+
+			if got := GetMaxCellLength(); got != tt.want {
+				t.Errorf("GetMaxCellLength() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetMaxFilenameLength(t *testing.T) {
+	tests := []struct {
+		name     string
+		envValue string
+		want     int
+	}{
+		{name: "Default value", envValue: "", want: DefaultMaxFilenameLength},
+		{name: "Custom value", envValue: "64", want: 64},
+		{name: "Invalid value", envValue: "long", want: DefaultMaxFilenameLength},
+		{name: "Zero value", envValue: "0", want: DefaultMaxFilenameLength},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testEnvVar(t, "ENV_MAX_FILENAME_LENGTH", tt.envValue)
+
+			if got := GetMaxFilenameLength(); got != tt.want {
+				t.Errorf("GetMaxFilenameLength() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetMultipartMemory(t *testing.T) {
+	tests := []struct {
+		name     string
+		envValue string
+		want     int64
+	}{
+		{name: "Default value", envValue: "", want: DefaultMultipartMemory},
+		{name: "Custom value", envValue: "1048576", want: 1048576},
+		{name: "Invalid value", envValue: "4MB", want: DefaultMultipartMemory},
+		{name: "Zero value", envValue: "0", want: DefaultMultipartMemory},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testEnvVar(t, "ENV_MULTIPART_MEMORY", tt.envValue)
+
+			if got := GetMultipartMemory(); got != tt.want {
+				t.Errorf("GetMultipartMemory() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetHTTPTimeouts(t *testing.T) {
+	tests := []struct {
+		name     string
+		envValue string
+		want     time.Duration
+	}{
+		{name: "Default value", envValue: "", want: DefaultHTTPWriteTimeout},
+		{name: "Custom value", envValue: "90s", want: 90 * time.Second},
+		{name: "Disabled", envValue: "0", want: 0},
+		{name: "Invalid value", envValue: "soon", want: DefaultHTTPWriteTimeout},
+		{name: "Negative value", envValue: "-1s", want: DefaultHTTPWriteTimeout},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testEnvVar(t, "ENV_HTTP_WRITE_TIMEOUT", tt.envValue)
+
+			timeouts := GetHTTPTimeouts()
+			if timeouts.Write != tt.want {
+				t.Errorf("GetHTTPTimeouts().Write = %v, want %v", timeouts.Write, tt.want)
+			}
+			if timeouts.ReadHeader != DefaultHTTPReadHeaderTimeout {
+				t.Errorf("GetHTTPTimeouts().ReadHeader = %v, want %v", timeouts.ReadHeader, DefaultHTTPReadHeaderTimeout)
+			}
+		})
+	}
+}
+
+func TestGetHTTPProtocols(t *testing.T) {
+	testEnvVar(t, "ENV_TLS_CERT_FILE", "")
+	testEnvVar(t, "ENV_TLS_KEY_FILE", "")
+	testEnvVar(t, "ENV_HTTP2_CLEARTEXT", "")
+	testEnvVar(t, "ENV_HTTP_KEEP_ALIVES", "")
+	testEnvVar(t, "ENV_HTTP2_MAX_CONCURRENT_STREAMS", "")
+
+	protocols := GetHTTPProtocols()
+	if protocols.TLSEnabled() || protocols.CleartextHTTP2 || !protocols.KeepAlives || protocols.MaxConcurrentStreams != 0 {
+		t.Errorf("Expected plain HTTP/1.1 with keep-alives by default, got %+v", protocols)
+	}
+	if err := protocols.Validate(); err != nil {
+		t.Errorf("Expected the defaults to be valid, got %v", err)
+	}
+
+	testEnvVar(t, "ENV_TLS_CERT_FILE", "/etc/spotdb/cert.pem")
+	if err := GetHTTPProtocols().Validate(); err == nil {
+		t.Error("Expected an error for a certificate without a key")
+	}
+
+	testEnvVar(t, "ENV_TLS_KEY_FILE", "/etc/spotdb/key.pem")
+	testEnvVar(t, "ENV_HTTP2_CLEARTEXT", "true")
+	testEnvVar(t, "ENV_HTTP_KEEP_ALIVES", "false")
+	testEnvVar(t, "ENV_HTTP2_MAX_CONCURRENT_STREAMS", "500")
+	protocols = GetHTTPProtocols()
+	if !protocols.TLSEnabled() || !protocols.CleartextHTTP2 || protocols.KeepAlives || protocols.MaxConcurrentStreams != 500 {
+		t.Errorf("Expected the configured protocols, got %+v", protocols)
+	}
+	if err := protocols.Validate(); err != nil {
+		t.Errorf("Expected a complete TLS configuration to be valid, got %v", err)
+	}
+
+	testEnvVar(t, "ENV_HTTP2_MAX_CONCURRENT_STREAMS", "-1")
+	if streams := GetHTTPProtocols().MaxConcurrentStreams; streams != 0 {
+		t.Errorf("Expected an invalid stream limit to keep the default, got %d", streams)
+	}
+}
+
+func TestCopyWithMaxSizeCellLength(t *testing.T) {
+	testEnvVar(t, "ENV_MAX_CELL_LENGTH", "16")
+
+	validatorCalled := false
+	validator := func(data []byte, lineNumber int, columnMap map[int]string) (bool, *ValidationIssue, error) {
+		validatorCalled = true
+		return true, nil, nil
+	}
+
+	tests := []struct {
+		name       string
+		input      string
+		wantErr    bool
+		wantLine   int
+		wantColumn string
+	}{
+		{name: "Cells within limit", input: "id,name\n1,short value\n"},
+		{name: "Long line with short cells", input: "id,a,b,c\n1,0123456789,0123456789,0123456789\n"},
+		{name: "Oversized cell", input: "id,name\n1,ok\n2," + strings.Repeat("x", 17) + "\n", wantErr: true, wantLine: 3, wantColumn: "name"},
+		{name: "Oversized quoted cell with delimiters", input: "id,name\n1,\"" + strings.Repeat("a,", 10) + "\"\n", wantErr: true, wantLine: 2, wantColumn: "name"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			validatorCalled = false
+			_, issue, _, err := CopyWithMaxSize(&bytes.Buffer{}, strings.NewReader(tt.input), 8, DefaultMaxFileSize, true, validator)
+
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("CopyWithMaxSize() unexpected error = %v", err)
+				}
+				return
+			}
+
+			if !errors.Is(err, ErrCellTooLong) {
+				t.Fatalf("CopyWithMaxSize() error = %v, want ErrCellTooLong", err)
+			}
+			if issue == nil || issue.Line != tt.wantLine || issue.Column != tt.wantColumn {
+				t.Errorf("CopyWithMaxSize() issue = %+v, want line %d column %q", issue, tt.wantLine, tt.wantColumn)
+			}
+			if tt.wantLine == 2 && validatorCalled {
+				t.Error("validator should not run on a row with an oversized cell")
+			}
+		})
+	}
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
+
+func TestCopyWithMaxSizeCellLengthStopsEarly(t *testing.T) {
+	testEnvVar(t, "ENV_MAX_CELL_LENGTH", "16")
+
+	// A single cell that never ends its line must be rejected without buffering it whole
+	source := &countingReader{r: io.MultiReader(strings.NewReader("id,name\n1,"), strings.NewReader(strings.Repeat("x", 1024*1024)))}
+	_, issue, _, err := CopyWithMaxSize(&bytes.Buffer{}, source, 8, DefaultMaxFileSize, true, nil)
+	if !errors.Is(err, ErrCellTooLong) {
+		t.Fatalf("CopyWithMaxSize() error = %v, want ErrCellTooLong", err)
+	}
+	if issue == nil || issue.Line != 2 || issue.Column != "name" {
+		t.Errorf("CopyWithMaxSize() issue = %+v, want line 2 column \"name\"", issue)
+	}
+	if source.n > 64 {
+		t.Errorf("Expected the copy to stop shortly after the limit, read %d bytes", source.n)
+	}
+}
+
+func TestGetMaxEstimatedRows(t *testing.T) {
+	tests := []struct {
+		name     string
+		envValue string
+		want     int64
+	}{
+		{name: "Default value", envValue: "", want: DefaultMaxEstimatedRows},
+		{name: "Custom value", envValue: "5000", want: 5000},
+		{name: "Zero disables", envValue: "0", want: 0},
+		{name: "Invalid value", envValue: "lots", want: DefaultMaxEstimatedRows},
+		{name: "Negative value", envValue: "-1", want: DefaultMaxEstimatedRows},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testEnvVar(t, "ENV_MAX_ESTIMATED_ROWS", tt.envValue)
+
+			if got := GetMaxEstimatedRows(); got != tt.want {
+				t.Errorf("GetMaxEstimatedRows() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetMaxQueryLength(t *testing.T) {
+	tests := []struct {
+		name     string
+		envValue string
+		want     int
+	}{
+		{name: "Default value", envValue: "", want: DefaultMaxQueryLength},
+		{name: "Custom value", envValue: "4096", want: 4096},
+		{name: "Zero disables", envValue: "0", want: 0},
+		{name: "Invalid value", envValue: "long", want: DefaultMaxQueryLength},
+		{name: "Negative value", envValue: "-1", want: DefaultMaxQueryLength},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testEnvVar(t, "ENV_MAX_QUERY_LENGTH", tt.envValue)
+
+			if got := GetMaxQueryLength(); got != tt.want {
+				t.Errorf("GetMaxQueryLength() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetMaxTotalDisk(t *testing.T) {
+	tests := []struct {
+		name     string
+		envValue string
+		want     int64
+	}{
+		{name: "Default value", envValue: "", want: 0},
+		{name: "Custom value", envValue: "10737418240", want: 10737418240},
+		{name: "Invalid value", envValue: "10GB", want: 0},
+		{name: "Negative value", envValue: "-1", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testEnvVar(t, "ENV_MAX_TOTAL_DISK", tt.envValue)
+
+			if got := GetMaxTotalDisk(); got != tt.want {
+				t.Errorf("GetMaxTotalDisk() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetSocketMaxConns(t *testing.T) {
+	tests := []struct {
+		name     string
+		envValue string
+		want     int
+	}{
+		{name: "Default value", envValue: "", want: DefaultSocketMaxConns},
+		{name: "Custom value", envValue: "8", want: 8},
+		{name: "Zero removes the limit", envValue: "0", want: 0},
+		{name: "Invalid value", envValue: "many", want: DefaultSocketMaxConns},
+		{name: "Negative value", envValue: "-1", want: DefaultSocketMaxConns},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testEnvVar(t, "ENV_SOCKET_MAX_CONNS", tt.envValue)
+
+			if got := GetSocketMaxConns(); got != tt.want {
+				t.Errorf("GetSocketMaxConns() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetImportRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		envValue string
+		want     int
+	}{
+		{name: "Default value", envValue: "", want: DefaultImportRetries},
+		{name: "Custom value", envValue: "5", want: 5},
+		{name: "Zero disables retries", envValue: "0", want: 0},
+		{name: "Invalid value", envValue: "often", want: DefaultImportRetries},
+		{name: "Negative value", envValue: "-2", want: DefaultImportRetries},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testEnvVar(t, "ENV_IMPORT_RETRIES", tt.envValue)
+
+			if got := GetImportRetries(); got != tt.want {
+				t.Errorf("GetImportRetries() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetWriteBusyRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		envValue string
+		want     int
+	}{
+		{name: "Default value", envValue: "", want: DefaultWriteBusyRetries},
+		{name: "Custom value", envValue: "6", want: 6},
+		{name: "Zero disables retries", envValue: "0", want: 0},
+		{name: "Invalid value", envValue: "sometimes", want: DefaultWriteBusyRetries},
+		{name: "Negative value", envValue: "-1", want: DefaultWriteBusyRetries},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testEnvVar(t, "ENV_WRITE_BUSY_RETRIES", tt.envValue)
+
+			if got := GetWriteBusyRetries(); got != tt.want {
+				t.Errorf("GetWriteBusyRetries() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetBulkDeleteRateLimit(t *testing.T) {
+	tests := []struct {
+		name     string
+		envValue string
+		want     int
+	}{
+		{name: "Default value", envValue: "", want: DefaultBulkDeleteRateLimit},
+		{name: "Custom value", envValue: "2", want: 2},
+		{name: "Zero disables the limit", envValue: "0", want: 0},
+		{name: "Invalid value", envValue: "plenty", want: DefaultBulkDeleteRateLimit},
+		{name: "Negative value", envValue: "-3", want: DefaultBulkDeleteRateLimit},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testEnvVar(t, "ENV_BULK_DELETE_RATE_LIMIT", tt.envValue)
+
+			if got := GetBulkDeleteRateLimit(); got != tt.want {
+				t.Errorf("GetBulkDeleteRateLimit() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetAutoAnalyzeThreshold(t *testing.T) {
+	tests := []struct {
+		name     string
+		envValue string
+		want     int
+	}{
+		{name: "Default value", envValue: "", want: DefaultAutoAnalyzeThreshold},
+		{name: "Custom value", envValue: "50000", want: 50000},
+		{name: "Zero disables analyze", envValue: "0", want: 0},
+		{name: "Invalid value", envValue: "big", want: DefaultAutoAnalyzeThreshold},
+		{name: "Negative value", envValue: "-10", want: DefaultAutoAnalyzeThreshold},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testEnvVar(t, "ENV_AUTO_ANALYZE_THRESHOLD", tt.envValue)
+
+			if got := GetAutoAnalyzeThreshold(); got != tt.want {
+				t.Errorf("GetAutoAnalyzeThreshold() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetMCPMaxRows(t *testing.T) {
+	tests := []struct {
+		name     string
+		envValue string
+		want     int
+	}{
+		{name: "Default value", envValue: "", want: DefaultMCPMaxRows},
+		{name: "Custom value", envValue: "20", want: 20},
+		{name: "Zero removes the limit", envValue: "0", want: 0},
+		{name: "Invalid value", envValue: "many", want: DefaultMCPMaxRows},
+		{name: "Negative value", envValue: "-1", want: DefaultMCPMaxRows},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testEnvVar(t, "ENV_MCP_MAX_ROWS", tt.envValue)
+
+			if got := GetMCPMaxRows(); got != tt.want {
+				t.Errorf("GetMCPMaxRows() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetRequestLogTTL(t *testing.T) {
+	tests := []struct {
+		name     string
+		envValue string
+		want     time.Duration
+	}{
+		{name: "Default value", envValue: "", want: DefaultRequestLogTTL},
+		{name: "Custom value", envValue: "90s", want: 90 * time.Second},
+		{name: "Zero value", envValue: "0", want: DefaultRequestLogTTL},
+		{name: "Invalid value", envValue: "soon", want: DefaultRequestLogTTL},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testEnvVar(t, "ENV_REQUEST_LOG_TTL", tt.envValue)
+
+			if got := GetRequestLogTTL(); got != tt.want {
+				t.Errorf("GetRequestLogTTL() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetProfilingInterval(t *testing.T) {
+	tests := []struct {
+		name     string
+		envValue string
+		want     time.Duration
+	}{
+		{name: "Default value", envValue: "", want: DefaultProfilingInterval},
+		{name: "Custom value", envValue: "250ms", want: 250 * time.Millisecond},
+		{name: "Zero value", envValue: "0", want: 0},
+		{name: "Negative value", envValue: "-1s", want: DefaultProfilingInterval},
+		{name: "Invalid value", envValue: "often", want: DefaultProfilingInterval},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testEnvVar(t, "ENV_PROFILING_INTERVAL", tt.envValue)
+
+			if got := GetProfilingInterval(); got != tt.want {
+				t.Errorf("GetProfilingInterval() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetMaxConcurrentQueries(t *testing.T) {
+	tests := []struct {
+		name     string
+		envValue string
+		want     int
+	}{
+		{name: "Default value", envValue: "", want: 0},
+		{name: "Custom value", envValue: "8", want: 8},
+		{name: "Negative value", envValue: "-1", want: 0},
+		{name: "Invalid value", envValue: "many", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testEnvVar(t, "ENV_MAX_CONCURRENT_QUERIES", tt.envValue)
+
+			if got := GetMaxConcurrentQueries(); got != tt.want {
+				t.Errorf("GetMaxConcurrentQueries() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetQueryQueueTimeout(t *testing.T) {
+	tests := []struct {
+		name     string
+		envValue string
+		want     time.Duration
+	}{
+		{name: "Default value", envValue: "", want: DefaultQueryQueueTimeout},
+		{name: "Custom value", envValue: "500ms", want: 500 * time.Millisecond},
+		{name: "Zero value", envValue: "0", want: 0},
+		{name: "Invalid value", envValue: "briefly", want: DefaultQueryQueueTimeout},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testEnvVar(t, "ENV_QUERY_QUEUE_TIMEOUT", tt.envValue)
+
+			if got := GetQueryQueueTimeout(); got != tt.want {
+				t.Errorf("GetQueryQueueTimeout() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetMinCSVColumns(t *testing.T) {
+	tests := []struct {
+		name     string
+		envValue string
+		want     int
+	}{
+		{name: "Default value", envValue: "", want: DefaultMinCSVColumns},
+		{name: "Custom value", envValue: "2", want: 2},
+		{name: "Invalid value", envValue: "two", want: DefaultMinCSVColumns},
+		{name: "Zero value", envValue: "0", want: DefaultMinCSVColumns},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testEnvVar(t, "ENV_MIN_CSV_COLUMNS", tt.envValue)
+
+			if got := GetMinCSVColumns(); got != tt.want {
+				t.Errorf("GetMinCSVColumns() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetMCPMaxBytes(t *testing.T) {
+	tests := []struct {
+		name     string
+		envValue string
+		want     int
+	}{
+		{name: "Default value", envValue: "", want: DefaultMCPMaxBytes},
+		{name: "Custom value", envValue: "4096", want: 4096},
+		{name: "Zero removes the limit", envValue: "0", want: 0},
+		{name: "Invalid value", envValue: "4KB", want: DefaultMCPMaxBytes},
+		{name: "Negative value", envValue: "-1", want: DefaultMCPMaxBytes},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testEnvVar(t, "ENV_MCP_MAX_BYTES", tt.envValue)
+
+			if got := GetMCPMaxBytes(); got != tt.want {
+				t.Errorf("GetMCPMaxBytes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetS3ObjectTags(t *testing.T) {
+	tests := []struct {
+		name     string
+		envValue string
+		want     map[string]string
+		wantErr  bool
+	}{
+		{name: "Unset", envValue: "", want: nil},
+		{name: "Pairs", envValue: "team=data, env = prod,", want: map[string]string{"team": "data", "env": "prod"}},
+		{name: "Empty value", envValue: "reviewed=", want: map[string]string{"reviewed": ""}},
+		{name: "Value with equals sign", envValue: "query=a=b", want: map[string]string{"query": "a=b"}},
+		{name: "Missing value", envValue: "team", wantErr: true},
+		{name: "Missing key", envValue: "=data", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testEnvVar(t, "ENV_S3_OBJECT_TAGS", tt.envValue)
+
+			got, err := GetS3ObjectTags()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetS3ObjectTags() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetS3ObjectTags() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestGetValidationMode(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -334,6 +1049,121 @@ func TestGetValidationMode(t *testing.T) {
 	}
 }
 
+func TestGetTableNameSanitization(t *testing.T) {
+	tests := []struct {
+		name     string
+		envValue string
+		want     string
+	}{
+		{name: "Default value", envValue: "", want: TableNameSanitizationStrict},
+		{name: "Strict", envValue: TableNameSanitizationStrict, want: TableNameSanitizationStrict},
+		{name: "Quoted", envValue: TableNameSanitizationQuoted, want: TableNameSanitizationQuoted},
+		{name: "Invalid value", envValue: "loose", want: TableNameSanitizationStrict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testEnvVar(t, "ENV_TABLE_NAME_SANITIZATION", tt.envValue)
+
+			if got := GetTableNameSanitization(); got != tt.want {
+				t.Errorf("GetTableNameSanitization() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetSnapshotCallbackAllowedHosts(t *testing.T) {
+	tests := []struct {
+		name     string
+		envValue string
+		want     []string
+	}{
+		{name: "Default value", envValue: "", want: nil},
+		{name: "Single host", envValue: "hooks.example.com", want: []string{"hooks.example.com"}},
+		{name: "Multiple hosts with spaces", envValue: " Hooks.example.com , internal:8443,, ", want: []string{"hooks.example.com", "internal:8443"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testEnvVar(t, "ENV_SNAPSHOT_CALLBACK_ALLOWED_HOSTS", tt.envValue)
+
+			if got := GetSnapshotCallbackAllowedHosts(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetSnapshotCallbackAllowedHosts() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetAutoSnapshotInterval(t *testing.T) {
+	tests := []struct {
+		name     string
+		envValue string
+		want     time.Duration
+	}{
+		{name: "Default value", envValue: "", want: 0},
+		{name: "Valid duration", envValue: "15m", want: 15 * time.Minute},
+		{name: "Invalid duration", envValue: "soon", want: 0},
+		{name: "Plain number without unit", envValue: "60", want: 0},
+		{name: "Negative duration", envValue: "-1h", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testEnvVar(t, "ENV_AUTO_SNAPSHOT_INTERVAL", tt.envValue)
+
+			if got := GetAutoSnapshotInterval(); got != tt.want {
+				t.Errorf("GetAutoSnapshotInterval() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetAllowedFileExtensions(t *testing.T) {
+	tests := []struct {
+		name     string
+		envValue string
+		want     []string
+	}{
+		{name: "Default value", envValue: "", want: DefaultAllowedFileExtensions},
+		{name: "Custom list", envValue: ".csv,.psv", want: []string{".csv", ".psv"}},
+		{name: "Normalized entries", envValue: " CSV , .TSV ,", want: []string{".csv", ".tsv"}},
+		{name: "Only separators", envValue: " , ", want: DefaultAllowedFileExtensions},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testEnvVar(t, "ENV_ALLOWED_FILE_EXTENSIONS", tt.envValue)
+
+			if got := GetAllowedFileExtensions(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetAllowedFileExtensions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetHiddenTablePrefixes(t *testing.T) {
+	tests := []struct {
+		name     string
+		envValue string
+		want     []string
+	}{
+		{name: "Default value", envValue: "", want: DefaultHiddenTablePrefixes},
+		{name: "Custom list", envValue: "_spotdb_,audit_", want: []string{"_spotdb_", "audit_"}},
+		{name: "Normalized entries", envValue: " Staging_ ,, ", want: []string{"staging_"}},
+		{name: "Only separators", envValue: " , ", want: DefaultHiddenTablePrefixes},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testEnvVar(t, "ENV_HIDDEN_TABLE_PREFIXES", tt.envValue)
+
+			if got := GetHiddenTablePrefixes(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetHiddenTablePrefixes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 // Mock types for testing edge cases
 // These mock implementations are used to test various error handling paths
 // in the CopyWithMaxSize function
@@ -426,7 +1256,7 @@ func TestCopyWithMaxSizeEdgeCases(t *testing.T) {
 			var validator BufferValidationFunc
 			// No need to handle test case #3 as we're skipping it
 
-			_, _, err := CopyWithMaxSize(dst, src, 4, DefaultMaxFileSize, validator)
+			_, _, _, err := CopyWithMaxSize(dst, src, 4, DefaultMaxFileSize, true, validator)
 
 			if err == nil {
 				t.Errorf("CopyWithMaxSize() error = nil, %s", tt.errorMsg)
@@ -710,6 +1540,51 @@ func TestValidateContent(t *testing.T) {
 	})
 }
 
+// TestCopyWithMaxSizeWarnings tests that warnings for skipped and ignored rows are returned
+func TestCopyWithMaxSizeWarnings(t *testing.T) {
+	flagBadRows := func(data []byte, lineNumber int, columnMap map[int]string) (bool, *ValidationIssue, error) {
+		if strings.Contains(string(data), "bad") {
+			return false, &ValidationIssue{Pattern: "bad", Line: lineNumber, Column: "b"}, nil
+		}
+		return true, nil, nil
+	}
+
+	tests := []struct {
+		mode         string
+		wantOutput   string
+		wantWarnings int
+	}{
+		{mode: ValidationModeRejectRow, wantOutput: "a,b\n1,ok\n", wantWarnings: 2},
+		{mode: ValidationModeIgnore, wantOutput: "a,b\n1,bad\n1,ok\n2,bad\n", wantWarnings: 2},
+		{mode: ValidationModeRejectFile, wantWarnings: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			testEnvVar(t, "ENV_FILE_VALIDATION_MODE", tt.mode)
+			dst := &bytes.Buffer{}
+			src := strings.NewReader("a,b\n1,bad\n1,ok\n2,bad\n")
+
+			_, _, warnings, err := CopyWithMaxSize(dst, src, 8, DefaultMaxFileSize, true, flagBadRows)
+			if tt.mode == ValidationModeRejectFile {
+				if !errors.Is(err, ErrInvalidBuffer) {
+					t.Fatalf("CopyWithMaxSize() error = %v, want ErrInvalidBuffer", err)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("CopyWithMaxSize() unexpected error = %v", err)
+				}
+				if dst.String() != tt.wantOutput {
+					t.Errorf("CopyWithMaxSize() output = %q, want %q", dst.String(), tt.wantOutput)
+				}
+			}
+			if len(warnings) != tt.wantWarnings {
+				t.Errorf("CopyWithMaxSize() warnings = %v, want %d", warnings, tt.wantWarnings)
+			}
+		})
+	}
+}
+
 // TestShouldSkipWriting tests the shouldSkipWriting function
 func TestShouldSkipWriting(t *testing.T) {
 	// Test with nil validator
@@ -1289,3 +2164,47 @@ func TestGetColumnName(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateEnvConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr []string
+	}{
+		{name: "Defaults", env: map[string]string{}},
+		{name: "Valid values", env: map[string]string{"ENV_MAX_FILE_SIZE": "1024", "ENV_REQUEST_LOG_TTL": "90s", "ENV_SERVER_MODE": "debug"}},
+		{name: "Invalid integer", env: map[string]string{"ENV_MAX_FILE_SIZE": "10MB"}, wantErr: []string{"ENV_MAX_FILE_SIZE"}},
+		{name: "Negative integer", env: map[string]string{"ENV_SOCKET_MAX_CONNS": "-1"}, wantErr: []string{"ENV_SOCKET_MAX_CONNS"}},
+		{name: "Zero where disabled", env: map[string]string{"ENV_SOCKET_MAX_CONNS": "0", "ENV_MAX_CONCURRENT_QUERIES": "0"}},
+		{
+			name:    "Zero where positive required",
+			env:     map[string]string{"ENV_MAX_FILE_SIZE": "0", "ENV_MAX_FILENAME_LENGTH": "0", "ENV_MIN_CSV_COLUMNS": "-2"},
+			wantErr: []string{"ENV_MAX_FILENAME_LENGTH", "ENV_MAX_FILE_SIZE", "ENV_MIN_CSV_COLUMNS"},
+		},
+		{name: "Invalid duration", env: map[string]string{"ENV_HTTP_READ_TIMEOUT": "30"}, wantErr: []string{"ENV_HTTP_READ_TIMEOUT"}},
+		{name: "Invalid choice", env: map[string]string{"ENV_FILE_VALIDATION_MODE": "strict"}, wantErr: []string{"ENV_FILE_VALIDATION_MODE"}},
+		{
+			name:    "Every invalid value is reported",
+			env:     map[string]string{"ENV_BUFFER_SIZE": "big", "ENV_SNAPSHOT_STORE": "azure", "ENV_PROFILING_INTERVAL": "-1s"},
+			wantErr: []string{"ENV_BUFFER_SIZE", "ENV_PROFILING_INTERVAL", "ENV_SNAPSHOT_STORE"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range slices.Concat(intEnvVars, positiveIntEnvVars, durationEnvVars, slices.Collect(maps.Keys(enumEnvVars))) {
+				testEnvVar(t, name, tt.env[name])
+			}
+
+			err := ValidateEnvConfig()
+			if (err != nil) != (len(tt.wantErr) > 0) {
+				t.Fatalf("ValidateEnvConfig() error = %v, want errors for %v", err, tt.wantErr)
+			}
+			for _, name := range tt.wantErr {
+				if !strings.Contains(err.Error(), name) {
+					t.Errorf("ValidateEnvConfig() error = %v, want it to name %s", err, name)
+				}
+			}
+		})
+	}
+}
@@ -1,8 +1,12 @@
 package log
 
 import (
+	"io"
+	stdlog "log"
 	"log/slog"
 	"net/http"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/aliengiraffe/spotdb/pkg/helpers"
@@ -10,6 +14,7 @@ import (
 	prettyconsole "github.com/thessem/zap-prettyconsole"
 	"go.uber.org/zap"
 	"go.uber.org/zap/exp/zapslog"
+	"go.uber.org/zap/zapcore"
 )
 
 // StartRequestLogging initializes and returns a logger for the request with static fields.
@@ -171,9 +176,47 @@ func getDuration(start time.Time) (time.Duration, int64) {
 	return duration, duration.Milliseconds()
 }
 
+// Log output formats selectable through the ENV_LOG_FORMAT environment variable
+const (
+	LogFormatJSON = "json"
+	LogFormatText = "text"
+)
+
 // GetLogger returns an slog.Logger, colorizing log levels in non-release environments
 // according to the ENV_SERVER_MODE environment variable.
+//
+// ENV_LOG_FORMAT selects a plain slog handler instead: "json" for machine-parseable
+// output or "text" for key=value output. ENV_LOG_LEVEL (debug, info, warn, error)
+// sets the minimum level for any format.
 func GetLogger(serviceName string) *slog.Logger {
+	level, levelSet := getLogLevel()
+
+	if handler := newSlogHandler(os.Stdout, getLogFormat(), level); handler != nil {
+		return slog.New(handler)
+	}
+
+	return newZapLogger(level, levelSet)
+}
+
+// newSlogHandler returns a JSON or text handler writing to w, or nil for any other format
+func newSlogHandler(w io.Writer, format string, level slog.Level) slog.Handler {
+	options := &slog.HandlerOptions{
+		AddSource: true,
+		Level:     level,
+	}
+
+	switch format {
+	case LogFormatJSON:
+		return slog.NewJSONHandler(w, options)
+	case LogFormatText:
+		return slog.NewTextHandler(w, options)
+	default:
+		return nil
+	}
+}
+
+// newZapLogger builds the default zap-backed logger, overriding its level when set
+func newZapLogger(level slog.Level, levelSet bool) *slog.Logger {
 	var l *zap.Logger
 	// Determine environment from ENV_SERVER_MODE (empty default if unset)
 	environment := helpers.GetServerMode()
@@ -194,11 +237,56 @@ func GetLogger(serviceName string) *slog.Logger {
 		config = prettyconsole.NewConfig()
 	}
 
+	if levelSet {
+		config.Level = zap.NewAtomicLevelAt(zapLevel(level))
+	}
+
 	l, _ = config.Build(zap.AddCaller())
 
 	// Include call site (file and line number) in log output
 	slogHandler := zapslog.NewHandler(l.Core(), zapslog.WithCaller(true))
 
 	return slog.New(slogHandler)
+}
+
+// getLogFormat returns the normalized ENV_LOG_FORMAT value, empty for the default format
+func getLogFormat() string {
+	format := strings.ToLower(strings.TrimSpace(os.Getenv("ENV_LOG_FORMAT")))
+	switch format {
+	case "", LogFormatJSON, LogFormatText:
+		return format
+	default:
+		stdlog.Printf("Invalid ENV_LOG_FORMAT value: %s, using default format", format)
+		return ""
+	}
+}
+
+// getLogLevel parses ENV_LOG_LEVEL, reporting whether a valid level was configured
+func getLogLevel() (slog.Level, bool) {
+	levelStr := strings.TrimSpace(os.Getenv("ENV_LOG_LEVEL"))
+	if levelStr == "" {
+		return slog.LevelInfo, false
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(levelStr)); err != nil {
+		stdlog.Printf("Invalid ENV_LOG_LEVEL value: %s, using default: %s", levelStr, slog.LevelInfo)
+		return slog.LevelInfo, false
+	}
 
+	return level, true
+}
+
+// zapLevel maps an slog level to the equivalent zap level
+func zapLevel(level slog.Level) zapcore.Level {
+	switch {
+	case level < slog.LevelInfo:
+		return zapcore.DebugLevel
+	case level < slog.LevelWarn:
+		return zapcore.InfoLevel
+	case level < slog.LevelError:
+		return zapcore.WarnLevel
+	default:
+		return zapcore.ErrorLevel
+	}
 }
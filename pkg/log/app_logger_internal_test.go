@@ -0,0 +1,97 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func TestNewSlogHandler(t *testing.T) {
+	var buf bytes.Buffer
+	l := slog.New(newSlogHandler(&buf, LogFormatJSON, slog.LevelInfo))
+	l.Debug("hidden")
+	l.Info("visible", slog.String("table", "sales"))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("expected a single log line, got %d: %s", len(lines), buf.String())
+	}
+
+	var entry map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatalf("expected JSON output, got %s: %v", lines[0], err)
+	}
+	for _, key := range []string{"time", "level", "msg", "source", "table"} {
+		if _, ok := entry[key]; !ok {
+			t.Errorf("missing %q field in %s", key, lines[0])
+		}
+	}
+
+	buf.Reset()
+	l = slog.New(newSlogHandler(&buf, LogFormatText, slog.LevelDebug))
+	l.Debug("shown")
+	if !strings.Contains(buf.String(), "level=DEBUG") || !strings.Contains(buf.String(), "msg=shown") {
+		t.Errorf("unexpected text output: %s", buf.String())
+	}
+
+	if newSlogHandler(&buf, "", slog.LevelInfo) != nil {
+		t.Error("expected no handler for the default format")
+	}
+}
+
+func TestGetLogLevel(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected slog.Level
+		set      bool
+	}{
+		{value: "", expected: slog.LevelInfo, set: false},
+		{value: "debug", expected: slog.LevelDebug, set: true},
+		{value: "WARN", expected: slog.LevelWarn, set: true},
+		{value: "error", expected: slog.LevelError, set: true},
+		{value: "verbose", expected: slog.LevelInfo, set: false},
+	}
+
+	for _, tc := range tests {
+		t.Setenv("ENV_LOG_LEVEL", tc.value)
+		level, set := getLogLevel()
+		if level != tc.expected || set != tc.set {
+			t.Errorf("ENV_LOG_LEVEL=%q: expected (%v, %v), got (%v, %v)", tc.value, tc.expected, tc.set, level, set)
+		}
+	}
+}
+
+func TestGetLogFormat(t *testing.T) {
+	tests := map[string]string{
+		"":      "",
+		"JSON":  LogFormatJSON,
+		"text":  LogFormatText,
+		"plain": "",
+	}
+
+	for value, expected := range tests {
+		t.Setenv("ENV_LOG_FORMAT", value)
+		if format := getLogFormat(); format != expected {
+			t.Errorf("ENV_LOG_FORMAT=%q: expected %q, got %q", value, expected, format)
+		}
+	}
+}
+
+func TestZapLevel(t *testing.T) {
+	tests := map[slog.Level]zapcore.Level{
+		slog.LevelDebug: zapcore.DebugLevel,
+		slog.LevelInfo:  zapcore.InfoLevel,
+		slog.LevelWarn:  zapcore.WarnLevel,
+		slog.LevelError: zapcore.ErrorLevel,
+	}
+
+	for level, expected := range tests {
+		if got := zapLevel(level); got != expected {
+			t.Errorf("zapLevel(%v): expected %v, got %v", level, expected, got)
+		}
+	}
+}
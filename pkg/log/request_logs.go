@@ -0,0 +1,237 @@
+package log
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+	"sync"
+	"time"
+)
+
+// Limits of the request log capture, bounding the memory it uses
+const (
+	// MaxRequestLogEntries is the number of entries kept per request, older entries are
+	// overwritten once the buffer is full
+	MaxRequestLogEntries = 1000
+	// MaxCapturedRequests is the number of requests whose logs are kept at once, the
+	// oldest request is dropped when a new one starts
+	MaxCapturedRequests = 1000
+)
+
+// RequestLogEntry is a log record captured for a request
+type RequestLogEntry struct {
+	Time    time.Time      `json:"time"`
+	Level   string         `json:"level"`
+	Message string         `json:"message"`
+	Attrs   map[string]any `json:"attrs,omitempty"`
+}
+
+// requestLog is the ring buffer holding the entries of one request
+type requestLog struct {
+	entries   []RequestLogEntry
+	next      int
+	dropped   int
+	updatedAt time.Time
+}
+
+// add appends an entry, overwriting the oldest one when the buffer is full
+func (r *requestLog) add(entry RequestLogEntry, maxEntries int) {
+	if len(r.entries) < maxEntries {
+		r.entries = append(r.entries, entry)
+	} else {
+		r.entries[r.next] = entry
+		r.next = (r.next + 1) % maxEntries
+		r.dropped++
+	}
+}
+
+// snapshot returns a copy of the entries from oldest to newest
+func (r *requestLog) snapshot() []RequestLogEntry {
+	entries := make([]RequestLogEntry, 0, len(r.entries))
+	entries = append(entries, r.entries[r.next:]...)
+	return append(entries, r.entries[:r.next]...)
+}
+
+// RequestLogStore keeps the log entries of recent requests by request ID, so the full
+// log trail of a request can be retrieved without searching the aggregate log. The
+// entries of a request expire ttl after it last logged.
+type RequestLogStore struct {
+	mu          sync.Mutex
+	ttl         time.Duration
+	maxEntries  int
+	maxRequests int
+	requests    map[string]*requestLog
+	// order holds the request IDs from oldest to newest, to drop the oldest request
+	order []string
+	now   func() time.Time
+}
+
+// NewRequestLogStore creates a store keeping the logs of each request for ttl
+func NewRequestLogStore(ttl time.Duration) *RequestLogStore {
+	return &RequestLogStore{
+		ttl:         ttl,
+		maxEntries:  MaxRequestLogEntries,
+		maxRequests: MaxCapturedRequests,
+		requests:    make(map[string]*requestLog),
+		now:         time.Now,
+	}
+}
+
+// Logger returns a logger that writes through logger and also captures every entry for
+// the request
+func (s *RequestLogStore) Logger(logger *slog.Logger, requestID string) *slog.Logger {
+	return slog.New(&captureHandler{next: logger.Handler(), store: s, requestID: requestID})
+}
+
+// Entries returns the entries captured for the request, from oldest to newest, and the
+// number of older entries overwritten. It reports false for unknown or expired requests.
+func (s *RequestLogStore) Entries(requestID string) ([]RequestLogEntry, int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	captured, ok := s.requests[requestID]
+	if !ok || s.expired(captured) {
+		return nil, 0, false
+	}
+	return captured.snapshot(), captured.dropped, true
+}
+
+// add stores an entry for the request, registering the request on its first entry
+func (s *RequestLogStore) add(requestID string, entry RequestLogEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	captured, ok := s.requests[requestID]
+	if ok && s.expired(captured) {
+		s.remove(requestID)
+		ok = false
+	}
+	if !ok {
+		s.prune()
+		captured = &requestLog{}
+		s.requests[requestID] = captured
+		s.order = append(s.order, requestID)
+	}
+	captured.add(entry, s.maxEntries)
+	captured.updatedAt = s.now()
+}
+
+// prune drops expired requests at the front of the order, and the oldest requests while
+// no room is left for a new one
+func (s *RequestLogStore) prune() {
+	for len(s.order) > 0 {
+		oldest := s.order[0]
+		if len(s.order) < s.maxRequests && !s.expired(s.requests[oldest]) {
+			return
+		}
+		delete(s.requests, oldest)
+		s.order = s.order[1:]
+	}
+}
+
+// remove drops the request from the store
+func (s *RequestLogStore) remove(requestID string) {
+	delete(s.requests, requestID)
+	for i, id := range s.order {
+		if id == requestID {
+			s.order = append(s.order[:i], s.order[i+1:]...)
+			return
+		}
+	}
+}
+
+// expired reports whether the request last logged more than the TTL ago
+func (s *RequestLogStore) expired(captured *requestLog) bool {
+	return s.now().Sub(captured.updatedAt) > s.ttl
+}
+
+// captureHandler passes records to the next handler and captures them for a request
+type captureHandler struct {
+	next      slog.Handler
+	store     *RequestLogStore
+	requestID string
+	// attrs are the attributes added with WithAttrs, keyed with their group prefix
+	attrs  map[string]any
+	prefix string
+}
+
+// Enabled follows the next handler, so only the entries written to the log are captured
+func (h *captureHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+// Handle captures the record and passes it to the next handler
+func (h *captureHandler) Handle(ctx context.Context, record slog.Record) error {
+	attrs := make(map[string]any, len(h.attrs)+record.NumAttrs())
+	maps.Copy(attrs, h.attrs)
+	record.Attrs(func(attr slog.Attr) bool {
+		addAttr(attrs, h.prefix, attr)
+		return true
+	})
+	if len(attrs) == 0 {
+		attrs = nil
+	}
+
+	entryTime := record.Time
+	if entryTime.IsZero() {
+		entryTime = h.store.now()
+	}
+	h.store.add(h.requestID, RequestLogEntry{
+		Time:    entryTime.UTC(),
+		Level:   record.Level.String(),
+		Message: record.Message,
+		Attrs:   attrs,
+	})
+
+	return h.next.Handle(ctx, record)
+}
+
+// WithAttrs returns a handler capturing the attributes with every record
+func (h *captureHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := *h
+	clone.next = h.next.WithAttrs(attrs)
+	clone.attrs = make(map[string]any, len(h.attrs)+len(attrs))
+	maps.Copy(clone.attrs, h.attrs)
+	for _, attr := range attrs {
+		addAttr(clone.attrs, h.prefix, attr)
+	}
+	return &clone
+}
+
+// WithGroup returns a handler capturing later attributes under the group
+func (h *captureHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	clone := *h
+	clone.next = h.next.WithGroup(name)
+	clone.prefix = h.prefix + name + "."
+	return &clone
+}
+
+// addAttr adds the attribute to attrs, flattening groups into dotted keys
+func addAttr(attrs map[string]any, prefix string, attr slog.Attr) {
+	value := attr.Value.Resolve()
+	switch value.Kind() {
+	case slog.KindGroup:
+		groupPrefix := prefix
+		if attr.Key != "" {
+			groupPrefix += attr.Key + "."
+		}
+		for _, groupAttr := range value.Group() {
+			addAttr(attrs, groupPrefix, groupAttr)
+		}
+	case slog.KindDuration:
+		attrs[prefix+attr.Key] = value.Duration().String()
+	case slog.KindAny:
+		if err, ok := value.Any().(error); ok {
+			attrs[prefix+attr.Key] = err.Error()
+			return
+		}
+		attrs[prefix+attr.Key] = value.Any()
+	default:
+		if attr.Key != "" {
+			attrs[prefix+attr.Key] = value.Any()
+		}
+	}
+}
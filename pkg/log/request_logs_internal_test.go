@@ -0,0 +1,101 @@
+package log
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+// discardLogger returns a logger with entries enabled from the info level that writes nowhere
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func TestRequestLogStore_CapturesEntries(t *testing.T) {
+	buf := &bytes.Buffer{}
+	store := NewRequestLogStore(time.Minute)
+	logger := store.Logger(slog.New(slog.NewJSONHandler(buf, nil)), "req-1").
+		With(slog.String("table", "sales")).
+		WithGroup("extra_data")
+
+	logger.Info("Import started", slog.Group("file", slog.Int64("bytes", 42)))
+	logger.Error("Import failed", slog.Any("error", errors.New("disk full")), slog.Duration("elapsed", 2*time.Second))
+	logger.Debug("Not enabled")
+
+	entries, dropped, ok := store.Entries("req-1")
+	if !ok {
+		t.Fatal("Expected entries for req-1")
+	}
+	if dropped != 0 || len(entries) != 2 {
+		t.Fatalf("Expected 2 entries and none dropped, got %d and %d dropped", len(entries), dropped)
+	}
+	if entries[0].Message != "Import started" || entries[0].Level != "INFO" {
+		t.Errorf("Unexpected first entry: %+v", entries[0])
+	}
+	if entries[0].Attrs["table"] != "sales" || entries[0].Attrs["extra_data.file.bytes"] != int64(42) {
+		t.Errorf("Unexpected attributes: %v", entries[0].Attrs)
+	}
+	if entries[1].Attrs["extra_data.error"] != "disk full" || entries[1].Attrs["extra_data.elapsed"] != "2s" {
+		t.Errorf("Unexpected attributes: %v", entries[1].Attrs)
+	}
+	if !strings.Contains(buf.String(), "Import failed") {
+		t.Errorf("Expected entries to be passed to the next handler, got: %s", buf.String())
+	}
+
+	if _, _, ok := store.Entries("req-2"); ok {
+		t.Error("Expected no entries for an unknown request")
+	}
+}
+
+func TestRequestLogStore_RingBuffer(t *testing.T) {
+	store := NewRequestLogStore(time.Minute)
+	store.maxEntries = 3
+	logger := store.Logger(discardLogger(), "req-1")
+
+	for _, message := range []string{"one", "two", "three", "four", "five"} {
+		logger.Info(message)
+	}
+
+	entries, dropped, _ := store.Entries("req-1")
+	var messages []string
+	for _, entry := range entries {
+		messages = append(messages, entry.Message)
+	}
+	if strings.Join(messages, ",") != "three,four,five" || dropped != 2 {
+		t.Errorf("Expected the last 3 entries with 2 dropped, got %v with %d dropped", messages, dropped)
+	}
+}
+
+func TestRequestLogStore_Expiry(t *testing.T) {
+	now := time.Now()
+	store := NewRequestLogStore(time.Minute)
+	store.now = func() time.Time { return now }
+	store.maxRequests = 2
+
+	store.Logger(discardLogger(), "req-1").Info("first")
+	if _, _, ok := store.Entries("req-1"); !ok {
+		t.Fatal("Expected entries for req-1")
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, _, ok := store.Entries("req-1"); ok {
+		t.Error("Expected the entries of req-1 to expire")
+	}
+
+	store.Logger(discardLogger(), "req-2").Info("second")
+	store.Logger(discardLogger(), "req-3").Info("third")
+	store.Logger(discardLogger(), "req-4").Info("fourth")
+	if len(store.requests) != 2 {
+		t.Errorf("Expected 2 requests kept, got %d", len(store.requests))
+	}
+	if _, _, ok := store.Entries("req-2"); ok {
+		t.Error("Expected the oldest request to be dropped")
+	}
+	if _, _, ok := store.Entries("req-4"); !ok {
+		t.Error("Expected entries for req-4")
+	}
+}
@@ -57,6 +57,12 @@ func (s *A10eServer) ExecuteQuery(ctx context.Context, query string) (string, er
 		return s.describeTable(ctx, tableName)
 	}
 
+	// Reject obviously expensive queries before running them
+	if err := s.db.CheckQueryCost(ctx, query, helpers.GetMaxEstimatedRows()); err != nil {
+		log.Info("Query rejected by cost check", slog.Any("error", err))
+		return "", fmt.Errorf("query execution error: %w", err)
+	}
+
 	// For SELECT queries, return formatted results
 	if strings.HasPrefix(queryUpper, "SELECT") {
 		return s.executeSelectQuery(ctx, query)
@@ -203,10 +209,17 @@ func (s *A10eServer) executeSelectQuery(ctx context.Context, query string) (stri
 	resultStr.WriteString(headerRow.String())
 	resultStr.WriteString(separatorRow.String())
 
-	// Add data rows
+	// Add data rows until the MCP response limits are reached, so a huge result does not
+	// overflow the agent's context
+	maxRows := helpers.GetMCPMaxRows()
+	maxBytes := helpers.GetMCPMaxBytes()
 	rowCount := 0
+	truncated := false
 	for _, row := range result.Results {
-		rowCount++
+		if maxRows > 0 && rowCount >= maxRows {
+			truncated = true
+			break
+		}
 
 		// Convert each value to string and add to result
 		var rowStr strings.Builder
@@ -234,17 +247,26 @@ func (s *A10eServer) executeSelectQuery(ctx context.Context, query string) (stri
 			rowStr.WriteString(fmt.Sprintf("| %-15s ", valStr))
 		}
 		rowStr.WriteString("|\n")
-		resultStr.WriteString(rowStr.String())
 
-		// Limit to 100 rows for display
-		if rowCount >= 100 {
-			resultStr.WriteString("... (more rows)\n")
+		// Leave room for the closing separator and the truncation note
+		if maxBytes > 0 && resultStr.Len()+rowStr.Len()+separatorRow.Len()+truncationNoteSize > maxBytes {
+			truncated = true
 			break
 		}
+		resultStr.WriteString(rowStr.String())
+		rowCount++
 	}
 
 	resultStr.WriteString(separatorRow.String())
 
+	if truncated {
+		resultStr.WriteString(fmt.Sprintf(
+			"Result truncated: showing %d of %d rows because it exceeds the MCP response limit (%s). "+
+				"Refine the query with filters, aggregations or a LIMIT to see the remaining rows.\n",
+			rowCount, len(result.Results), describeMCPLimits(maxRows, maxBytes)))
+		return resultStr.String(), nil
+	}
+
 	// Add row count summary
 	switch rowCount {
 	case 0:
@@ -258,6 +280,21 @@ func (s *A10eServer) executeSelectQuery(ctx context.Context, query string) (stri
 	return resultStr.String(), nil
 }
 
+// truncationNoteSize is the room kept for the note added to a truncated result
+const truncationNoteSize = 256
+
+// describeMCPLimits describes the MCP response limits in effect for the truncation note
+func describeMCPLimits(maxRows, maxBytes int) string {
+	var limits []string
+	if maxRows > 0 {
+		limits = append(limits, fmt.Sprintf("%d rows", maxRows))
+	}
+	if maxBytes > 0 {
+		limits = append(limits, fmt.Sprintf("%d bytes", maxBytes))
+	}
+	return strings.Join(limits, ", ")
+}
+
 // SynthesizeMemo creates a formatted memo from insights
 func (s *A10eServer) SynthesizeMemo() string {
 	if len(s.insights) == 0 {
@@ -216,6 +216,57 @@ func TestExecuteSelectQuery(t *testing.T) {
 
 }
 
+func TestExecuteSelectQueryLimits(t *testing.T) {
+	server, db := setupTestServer(t)
+	ctx := context.Background()
+
+	if _, err := db.ExecuteQuery(ctx, "CREATE TABLE numbers AS SELECT range AS id, 'value_' || range AS label FROM range(500)"); err != nil {
+		t.Fatalf("Failed to create test table: %v", err)
+	}
+	dataRow := regexp.MustCompile(`(?m)^\| .*value_`)
+
+	tests := []struct {
+		name         string
+		maxRows      string
+		maxBytes     string
+		wantRows     int
+		wantTruncate bool
+	}{
+		{name: "default row limit", wantRows: 100, wantTruncate: true},
+		{name: "custom row limit", maxRows: "10", wantRows: 10, wantTruncate: true},
+		{name: "byte limit", maxRows: "0", maxBytes: "2048", wantTruncate: true},
+		{name: "no limits", maxRows: "0", maxBytes: "0", wantRows: 500},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("ENV_MCP_MAX_ROWS", tt.maxRows)
+			t.Setenv("ENV_MCP_MAX_BYTES", tt.maxBytes)
+
+			result, err := server.executeSelectQuery(ctx, "SELECT * FROM numbers ORDER BY id")
+			if err != nil {
+				t.Fatalf("Failed to execute select query: %v", err)
+			}
+
+			rows := len(dataRow.FindAllString(result, -1))
+			if tt.wantRows > 0 && rows != tt.wantRows {
+				t.Errorf("Expected %d rows, got %d", tt.wantRows, rows)
+			}
+			if tt.maxBytes != "" && tt.maxBytes != "0" && len(result) > 2048 {
+				t.Errorf("Expected at most 2048 bytes, got %d", len(result))
+			}
+
+			truncated := strings.Contains(result, "Result truncated")
+			if truncated != tt.wantTruncate {
+				t.Fatalf("Expected truncated=%v, got result:\n%s", tt.wantTruncate, result)
+			}
+			if truncated && !strings.Contains(result, "of 500 rows") {
+				t.Errorf("Expected the note to report the total row count, got:\n%s", result)
+			}
+		})
+	}
+}
+
 func TestSynthesizeMemo(t *testing.T) {
 	server, _ := setupTestServer(t)
 
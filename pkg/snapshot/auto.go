@@ -0,0 +1,151 @@
+package snapshot
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/aliengiraffe/spotdb/pkg/helpers"
+)
+
+// Creator is implemented by databases that can write a snapshot of their state to a file
+type Creator interface {
+	CreateSnapshot(ctx context.Context, destPath string) error
+}
+
+// Source is a database that can be snapshotted and reports whether it changed since
+type Source interface {
+	Creator
+	WriteCount() uint64
+}
+
+// TimestampedKey returns the snapshot filename for t and its object key under prefix
+func TimestampedKey(prefix string, t time.Time) (filename, key string) {
+	filename = fmt.Sprintf("snapshot-%s.db", t.Format("2006-01-02T15-04-05"))
+	return filename, path.Join(prefix, filename)
+}
+
+// CreateAndUpload writes a snapshot of the database to a temporary file, stores it in
+// bucket under key and removes the temporary file, returning the object URI
+func CreateAndUpload(ctx context.Context, creator Creator, store Store, bucket, key string) (string, error) {
+	log := helpers.GetLoggerFromContext(ctx)
+
+	tempFile, err := os.CreateTemp("", "snapshot-*.db")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary snapshot file: %w", err)
+	}
+	tempPath := tempFile.Name()
+	helpers.CloseResources(tempFile, "temporary snapshot file")
+	defer func() {
+		if err := os.Remove(tempPath); err != nil && !os.IsNotExist(err) {
+			log.Error("Failed to remove temporary snapshot file", slog.Any("error", err))
+		}
+	}()
+
+	if err := creator.CreateSnapshot(ctx, tempPath); err != nil {
+		return "", err
+	}
+
+	return store.Put(ctx, tempPath, bucket, key)
+}
+
+// AutoSnapshotter periodically snapshots a database to a snapshot store, skipping
+// intervals in which nothing was written
+type AutoSnapshotter struct {
+	source   Source
+	store    Store
+	bucket   string
+	prefix   string
+	interval time.Duration
+
+	mu         sync.Mutex
+	lastWrites uint64
+}
+
+// NewAutoSnapshotter creates an AutoSnapshotter uploading to the location given as
+// s3://bucket/prefix or gs://bucket/prefix. When store is nil the backend for the
+// location's scheme is used. Changes made before it is created do not trigger a snapshot.
+func NewAutoSnapshotter(ctx context.Context, source Source, location string, interval time.Duration, store Store) (*AutoSnapshotter, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("invalid snapshot interval: %s", interval)
+	}
+
+	scheme, bucket, prefix, err := ParseLocation(location)
+	if err != nil {
+		return nil, err
+	}
+
+	if store == nil {
+		if store, err = NewStore(ctx, scheme); err != nil {
+			return nil, err
+		}
+	}
+
+	return &AutoSnapshotter{
+		source:     source,
+		store:      store,
+		bucket:     bucket,
+		prefix:     prefix,
+		interval:   interval,
+		lastWrites: source.WriteCount(),
+	}, nil
+}
+
+// Run snapshots the database every interval until the context is canceled
+func (a *AutoSnapshotter) Run(ctx context.Context) {
+	log := helpers.GetLoggerFromContext(ctx)
+
+	log.Info("Automatic snapshots enabled",
+		slog.String("bucket", a.bucket),
+		slog.String("prefix", a.prefix),
+		slog.Duration("interval", a.interval))
+
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// Errors are logged by SnapshotIfChanged, the next tick retries
+			_, _ = a.SnapshotIfChanged(ctx)
+		}
+	}
+}
+
+// SnapshotIfChanged uploads a snapshot when the database was written to since the last
+// successful snapshot, returning the object URI or "" when the snapshot was skipped
+func (a *AutoSnapshotter) SnapshotIfChanged(ctx context.Context) (string, error) {
+	log := helpers.GetLoggerFromContext(ctx)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	writes := a.source.WriteCount()
+	if writes == a.lastWrites {
+		log.Info("Skipping automatic snapshot, no writes since the last one")
+		return "", nil
+	}
+
+	_, key := TimestampedKey(a.prefix, time.Now())
+	uri, err := CreateAndUpload(ctx, a.source, a.store, a.bucket, key)
+	if err != nil {
+		log.Error("Automatic snapshot failed",
+			slog.String("bucket", a.bucket),
+			slog.String("key", key),
+			slog.Any("error", err))
+		return "", err
+	}
+
+	// Writes made while the snapshot was taken may be missing from it, so only the
+	// count observed beforehand is marked as saved
+	a.lastWrites = writes
+	log.Info("Automatic snapshot uploaded", slog.String("uri", uri))
+
+	return uri, nil
+}
@@ -0,0 +1,165 @@
+package snapshot
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSource is an in-memory Source whose write count is set by the test
+type fakeSource struct {
+	writes    atomic.Uint64
+	createErr error
+}
+
+func (f *fakeSource) WriteCount() uint64 {
+	return f.writes.Load()
+}
+
+func (f *fakeSource) CreateSnapshot(ctx context.Context, destPath string) error {
+	if f.createErr != nil {
+		return f.createErr
+	}
+	return os.WriteFile(destPath, []byte("snapshot"), 0o600)
+}
+
+// putFunc is a Store that uploads with the function and supports nothing else
+type putFunc func(ctx context.Context, localPath, bucket, key string) (string, error)
+
+func (f putFunc) Put(ctx context.Context, localPath, bucket, key string) (string, error) {
+	return f(ctx, localPath, bucket, key)
+}
+
+func (f putFunc) Get(ctx context.Context, bucket, key, localPath string) error {
+	return errors.New("not supported")
+}
+
+func (f putFunc) Exists(ctx context.Context, bucket, key string) (bool, error) {
+	return false, errors.New("not supported")
+}
+
+// recordingUpload returns a Store that records the uploaded keys
+func recordingUpload(keys *[]string, uploadErr *error) Store {
+	return putFunc(func(ctx context.Context, localPath, bucket, key string) (string, error) {
+		content, err := os.ReadFile(localPath)
+		if err != nil {
+			return "", err
+		}
+		if string(content) != "snapshot" {
+			return "", errors.New("unexpected snapshot content")
+		}
+		if *uploadErr != nil {
+			return "", *uploadErr
+		}
+		*keys = append(*keys, key)
+		return "s3://" + bucket + "/" + key, nil
+	})
+}
+
+func TestTimestampedKey(t *testing.T) {
+	filename, key := TimestampedKey("backups/auto", time.Date(2025, 10, 2, 14, 30, 45, 0, time.UTC))
+	assert.Equal(t, "snapshot-2025-10-02T14-30-45.db", filename)
+	assert.Equal(t, "backups/auto/snapshot-2025-10-02T14-30-45.db", key)
+}
+
+func TestNewAutoSnapshotter_Errors(t *testing.T) {
+	source := &fakeSource{}
+
+	_, err := NewAutoSnapshotter(context.Background(), source, "s3://bucket/prefix", 0, nil)
+	assert.Error(t, err)
+
+	_, err = NewAutoSnapshotter(context.Background(), source, "bucket/prefix", time.Minute, nil)
+	assert.Error(t, err)
+
+	_, err = NewAutoSnapshotter(context.Background(), source, "azure://bucket/prefix", time.Minute, nil)
+	assert.Error(t, err)
+}
+
+func TestAutoSnapshotter_SnapshotIfChanged(t *testing.T) {
+	ctx := context.Background()
+	source := &fakeSource{}
+	source.writes.Store(5)
+
+	var keys []string
+	var uploadErr error
+	auto, err := NewAutoSnapshotter(ctx, source, "s3://my-bucket/auto", time.Hour, recordingUpload(&keys, &uploadErr))
+	require.NoError(t, err)
+
+	// Writes made before the snapshotter started are not pending
+	uri, err := auto.SnapshotIfChanged(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, uri)
+	assert.Empty(t, keys)
+
+	source.writes.Add(1)
+	uri, err = auto.SnapshotIfChanged(ctx)
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.Regexp(t, `^auto/snapshot-.*\.db$`, keys[0])
+	assert.Equal(t, "s3://my-bucket/"+keys[0], uri)
+
+	// Nothing written since the last snapshot
+	uri, err = auto.SnapshotIfChanged(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, uri)
+	assert.Len(t, keys, 1)
+
+	// A failed upload leaves the changes pending for the next attempt
+	source.writes.Add(1)
+	uploadErr = errors.New("network down")
+	_, err = auto.SnapshotIfChanged(ctx)
+	assert.Error(t, err)
+
+	uploadErr = nil
+	_, err = auto.SnapshotIfChanged(ctx)
+	require.NoError(t, err)
+	assert.Len(t, keys, 2)
+
+	// A failed snapshot is reported without uploading
+	source.writes.Add(1)
+	source.createErr = errors.New("database connection is closed")
+	_, err = auto.SnapshotIfChanged(ctx)
+	assert.Error(t, err)
+	assert.Len(t, keys, 2)
+}
+
+func TestAutoSnapshotter_Run(t *testing.T) {
+	source := &fakeSource{}
+
+	uploaded := make(chan string, 10)
+	upload := putFunc(func(ctx context.Context, localPath, bucket, key string) (string, error) {
+		uploaded <- key
+		return "s3://" + bucket + "/" + key, nil
+	})
+
+	auto, err := NewAutoSnapshotter(context.Background(), source, "s3://my-bucket/auto", 10*time.Millisecond, upload)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		auto.Run(ctx)
+		close(done)
+	}()
+
+	source.writes.Add(1)
+	select {
+	case <-uploaded:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected a snapshot to be uploaded after a write")
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected Run to return after the context is canceled")
+	}
+	assert.Empty(t, uploaded, "Expected a single snapshot for a single write")
+}
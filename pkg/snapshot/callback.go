@@ -0,0 +1,138 @@
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aliengiraffe/spotdb/pkg/helpers"
+)
+
+const (
+	// CallbackStatusSuccess is reported when the snapshot was uploaded to S3
+	CallbackStatusSuccess = "success"
+	// CallbackStatusError is reported when the snapshot could not be created or uploaded
+	CallbackStatusError = "error"
+
+	// callbackMaxAttempts is the number of times a callback is sent before giving up
+	callbackMaxAttempts = 3
+	// callbackTimeout bounds a single callback request
+	callbackTimeout = 10 * time.Second
+)
+
+// ErrCallbackURLNotAllowed is returned when a callback URL is not on the allowlist
+var ErrCallbackURLNotAllowed = errors.New("callback URL not allowed")
+
+// callbackBackoff is the delay before the first retry, doubled on each further attempt
+var callbackBackoff = time.Second
+
+// callbackClient refuses redirects so an allowed host cannot bounce the request elsewhere
+var callbackClient = &http.Client{
+	Timeout: callbackTimeout,
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// CallbackPayload is the JSON body posted to a snapshot callback URL
+type CallbackPayload struct {
+	Status    string    `json:"status"`
+	Bucket    string    `json:"bucket"`
+	Key       string    `json:"key"`
+	Timestamp time.Time `json:"timestamp"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// ValidateCallbackURL checks that a callback URL uses http(s) and that its host is one of
+// allowedHosts. An entry without a port matches the host on any port. With no allowed
+// hosts every callback URL is rejected.
+func ValidateCallbackURL(rawURL string, allowedHosts []string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrCallbackURLNotAllowed, err)
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%w: scheme must be http or https", ErrCallbackURLNotAllowed)
+	}
+	if u.User != nil {
+		return fmt.Errorf("%w: credentials in the URL are not supported", ErrCallbackURLNotAllowed)
+	}
+
+	host := strings.ToLower(u.Hostname())
+	if host == "" {
+		return fmt.Errorf("%w: missing host", ErrCallbackURLNotAllowed)
+	}
+
+	if !slices.Contains(allowedHosts, host) && !slices.Contains(allowedHosts, strings.ToLower(u.Host)) {
+		return fmt.Errorf("%w: host %q is not in the allowlist", ErrCallbackURLNotAllowed, u.Host)
+	}
+
+	return nil
+}
+
+// NotifyCallback posts the payload to the callback URL, retrying with exponential backoff
+// when the request fails or the endpoint does not answer with a 2xx status
+func NotifyCallback(ctx context.Context, callbackURL string, payload CallbackPayload) error {
+	log := helpers.GetLoggerFromContext(ctx)
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode callback payload: %w", err)
+	}
+
+	delay := callbackBackoff
+	for attempt := 1; ; attempt++ {
+		err = postCallback(ctx, callbackURL, body)
+		if err == nil {
+			log.Info("Snapshot callback delivered",
+				slog.String("callback_url", callbackURL),
+				slog.Int("attempt", attempt))
+			return nil
+		}
+
+		log.Warn("Snapshot callback attempt failed",
+			slog.String("callback_url", callbackURL),
+			slog.Int("attempt", attempt),
+			slog.Any("error", err))
+
+		if attempt == callbackMaxAttempts {
+			return fmt.Errorf("callback failed after %d attempts: %w", attempt, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// postCallback sends a single callback request
+func postCallback(ctx context.Context, callbackURL string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, callbackURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := callbackClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer helpers.CloseResources(resp.Body, "callback response body")
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return nil
+}
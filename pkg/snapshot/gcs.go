@@ -0,0 +1,260 @@
+package snapshot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aliengiraffe/spotdb/pkg/helpers"
+)
+
+// Environment variables configuring the Google Cloud Storage backend
+const (
+	gcsEndpointEnvVar     = "ENV_GCS_ENDPOINT"
+	gcsAccessTokenEnvVar  = "ENV_GCS_ACCESS_TOKEN"
+	gceMetadataHostEnvVar = "GCE_METADATA_HOST"
+)
+
+const (
+	defaultGCSEndpoint     = "https://storage.googleapis.com"
+	defaultGCEMetadataHost = "metadata.google.internal"
+
+	// gcsTokenExpiryMargin renews metadata server tokens before they expire
+	gcsTokenExpiryMargin = time.Minute
+)
+
+// GCSStore stores snapshots in Google Cloud Storage using its JSON API. Requests are
+// authorized with ENV_GCS_ACCESS_TOKEN when set, otherwise with a token for the
+// instance's service account from the GCE metadata server.
+type GCSStore struct {
+	endpoint     string
+	metadataHost string
+	staticToken  string
+	client       *http.Client
+
+	mu          sync.Mutex
+	token       string
+	tokenExpiry time.Time
+}
+
+// NewGCSStore creates a Google Cloud Storage backend configured from the environment
+func NewGCSStore(ctx context.Context) (*GCSStore, error) {
+	endpoint := strings.TrimSuffix(os.Getenv(gcsEndpointEnvVar), "/")
+	if endpoint == "" {
+		endpoint = defaultGCSEndpoint
+	}
+	if parsed, err := url.Parse(endpoint); err != nil || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid %s value: %q", gcsEndpointEnvVar, endpoint)
+	}
+
+	metadataHost := os.Getenv(gceMetadataHostEnvVar)
+	if metadataHost == "" {
+		metadataHost = defaultGCEMetadataHost
+	}
+
+	helpers.GetLoggerFromContext(ctx).Info("GCS client initialized successfully", slog.String("endpoint", endpoint))
+
+	return &GCSStore{
+		endpoint:     endpoint,
+		metadataHost: metadataHost,
+		staticToken:  os.Getenv(gcsAccessTokenEnvVar),
+		client:       &http.Client{Timeout: 30 * time.Minute},
+	}, nil
+}
+
+// Put uploads a local snapshot file to GCS and returns its gs:// URI
+func (g *GCSStore) Put(ctx context.Context, localPath, bucket, key string) (string, error) {
+	log := helpers.GetLoggerFromContext(ctx)
+
+	log.Info("Uploading snapshot to GCS",
+		slog.String("bucket", bucket),
+		slog.String("key", key),
+		slog.String("localPath", localPath))
+
+	file, err := os.Open(localPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open local file: %w", err)
+	}
+	defer file.Close()
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return "", fmt.Errorf("failed to get file info: %w", err)
+	}
+
+	uploadURL := fmt.Sprintf("%s/upload/storage/v1/b/%s/o?uploadType=media&name=%s",
+		g.endpoint, url.PathEscape(bucket), url.QueryEscape(key))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, uploadURL, file)
+	if err != nil {
+		return "", fmt.Errorf("failed to create GCS upload request: %w", err)
+	}
+	req.ContentLength = fileInfo.Size()
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	resp, err := g.do(ctx, req)
+	if err != nil {
+		return "", fmt.Errorf("failed to upload snapshot to GCS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to upload snapshot to GCS: %w", gcsError(resp))
+	}
+
+	gsURI := fmt.Sprintf("gs://%s/%s", bucket, key)
+	log.Info("Snapshot uploaded successfully",
+		slog.String("bucket", bucket),
+		slog.String("key", key),
+		slog.Int64("bytes", fileInfo.Size()),
+		slog.String("gsURI", gsURI))
+
+	return gsURI, nil
+}
+
+// Get downloads the object at bucket and key from GCS to a local path
+func (g *GCSStore) Get(ctx context.Context, bucket, key, localPath string) error {
+	log := helpers.GetLoggerFromContext(ctx)
+
+	log.Info("Downloading snapshot from GCS",
+		slog.String("bucket", bucket),
+		slog.String("key", key),
+		slog.String("localPath", localPath))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, g.objectURL(bucket, key)+"?alt=media", nil)
+	if err != nil {
+		return fmt.Errorf("failed to create GCS download request: %w", err)
+	}
+
+	resp, err := g.do(ctx, req)
+	if err != nil {
+		return fmt.Errorf("failed to download snapshot from GCS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to download snapshot from GCS: %w", gcsError(resp))
+	}
+
+	file, err := os.Create(localPath)
+	if err != nil {
+		return fmt.Errorf("failed to create local file: %w", err)
+	}
+	defer file.Close()
+
+	numBytes, err := io.Copy(file, resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to download snapshot from GCS: %w", err)
+	}
+
+	log.Info("Snapshot downloaded successfully",
+		slog.String("bucket", bucket),
+		slog.String("key", key),
+		slog.Int64("bytes", numBytes))
+
+	return nil
+}
+
+// Exists reports whether an object exists in GCS at bucket and key
+func (g *GCSStore) Exists(ctx context.Context, bucket, key string) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, g.objectURL(bucket, key), nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to create GCS request: %w", err)
+	}
+
+	resp, err := g.do(ctx, req)
+	if err != nil {
+		return false, fmt.Errorf("failed to check snapshot in GCS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("failed to check snapshot in GCS: %w", gcsError(resp))
+	}
+}
+
+// objectURL returns the JSON API URL of an object's metadata
+func (g *GCSStore) objectURL(bucket, key string) string {
+	return fmt.Sprintf("%s/storage/v1/b/%s/o/%s", g.endpoint, url.PathEscape(bucket), url.PathEscape(key))
+}
+
+// do authorizes and sends a request to the GCS API
+func (g *GCSStore) do(ctx context.Context, req *http.Request) (*http.Response, error) {
+	token, err := g.accessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	return g.client.Do(req)
+}
+
+// accessToken returns the configured token, or a cached token for the instance's service
+// account that is renewed from the metadata server shortly before it expires
+func (g *GCSStore) accessToken(ctx context.Context) (string, error) {
+	if g.staticToken != "" {
+		return g.staticToken, nil
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.token != "" && time.Now().Before(g.tokenExpiry) {
+		return g.token, nil
+	}
+
+	tokenURL := fmt.Sprintf("http://%s/computeMetadata/v1/instance/service-accounts/default/token", g.metadataHost)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, tokenURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create metadata token request: %w", err)
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get GCS access token from the metadata server (set %s outside GCP): %w",
+			gcsAccessTokenEnvVar, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to get GCS access token from the metadata server: %w", gcsError(resp))
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("failed to decode metadata token response: %w", err)
+	}
+	if token.AccessToken == "" {
+		return "", fmt.Errorf("metadata server returned an empty access token")
+	}
+
+	g.token = token.AccessToken
+	g.tokenExpiry = time.Now().Add(time.Duration(token.ExpiresIn)*time.Second - gcsTokenExpiryMargin)
+	return g.token, nil
+}
+
+// gcsError describes an unsuccessful GCS API response, including the start of its body
+func gcsError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	message := strings.TrimSpace(string(body))
+	if message == "" {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return fmt.Errorf("unexpected status %s: %s", resp.Status, message)
+}
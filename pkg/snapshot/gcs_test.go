@@ -0,0 +1,163 @@
+package snapshot
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeGCS is an in-memory implementation of the GCS JSON API endpoints used by GCSStore
+type fakeGCS struct {
+	token string
+
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func newFakeGCS(t *testing.T, token string) *httptest.Server {
+	t.Helper()
+
+	fake := &fakeGCS{token: token, objects: make(map[string][]byte)}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func (f *fakeGCS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer "+f.token {
+		http.Error(w, `{"error":{"message":"unauthorized"}}`, http.StatusUnauthorized)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/upload/storage/v1/b/"):
+		bucket := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/upload/storage/v1/b/"), "/o")
+		body, _ := io.ReadAll(r.Body)
+		f.objects[bucket+"/"+r.URL.Query().Get("name")] = body
+		w.WriteHeader(http.StatusOK)
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/storage/v1/b/"):
+		bucket, object, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/storage/v1/b/"), "/o/")
+		content, ok := f.objects[bucket+"/"+object]
+		if !ok {
+			http.Error(w, `{"error":{"message":"not found"}}`, http.StatusNotFound)
+			return
+		}
+		if r.URL.Query().Get("alt") == "media" {
+			_, _ = w.Write(content)
+			return
+		}
+		_, _ = w.Write([]byte(`{"name":"` + object + `"}`))
+	default:
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+	}
+}
+
+func TestGCSStore_PutGetExists(t *testing.T) {
+	server := newFakeGCS(t, "test-token")
+	t.Setenv(gcsEndpointEnvVar, server.URL)
+	t.Setenv(gcsAccessTokenEnvVar, "test-token")
+
+	ctx := context.Background()
+	store, err := NewGCSStore(ctx)
+	require.NoError(t, err)
+
+	localPath := filepath.Join(t.TempDir(), "snapshot.db")
+	require.NoError(t, os.WriteFile(localPath, []byte("snapshot data"), 0o600))
+
+	exists, err := store.Exists(ctx, "my-bucket", "snapshots/snapshot.db")
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	uri, err := store.Put(ctx, localPath, "my-bucket", "snapshots/snapshot.db")
+	require.NoError(t, err)
+	assert.Equal(t, "gs://my-bucket/snapshots/snapshot.db", uri)
+
+	exists, err = store.Exists(ctx, "my-bucket", "snapshots/snapshot.db")
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	downloadPath := filepath.Join(t.TempDir(), "downloaded.db")
+	require.NoError(t, store.Get(ctx, "my-bucket", "snapshots/snapshot.db", downloadPath))
+	content, err := os.ReadFile(downloadPath)
+	require.NoError(t, err)
+	assert.Equal(t, "snapshot data", string(content))
+
+	err = store.Get(ctx, "my-bucket", "snapshots/missing.db", downloadPath)
+	assert.ErrorContains(t, err, "404")
+}
+
+func TestGCSStore_Unauthorized(t *testing.T) {
+	server := newFakeGCS(t, "test-token")
+	t.Setenv(gcsEndpointEnvVar, server.URL)
+	t.Setenv(gcsAccessTokenEnvVar, "wrong-token")
+
+	store, err := NewGCSStore(context.Background())
+	require.NoError(t, err)
+
+	_, err = store.Exists(context.Background(), "my-bucket", "snapshot.db")
+	assert.ErrorContains(t, err, "unauthorized")
+}
+
+func TestGCSStore_MetadataToken(t *testing.T) {
+	server := newFakeGCS(t, "metadata-token")
+
+	var tokenRequests int
+	metadata := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			http.Error(w, "missing metadata flavor", http.StatusForbidden)
+			return
+		}
+		tokenRequests++
+		_, _ = w.Write([]byte(`{"access_token":"metadata-token","expires_in":3600,"token_type":"Bearer"}`))
+	}))
+	t.Cleanup(metadata.Close)
+
+	t.Setenv(gcsEndpointEnvVar, server.URL)
+	t.Setenv(gcsAccessTokenEnvVar, "")
+	t.Setenv(gceMetadataHostEnvVar, strings.TrimPrefix(metadata.URL, "http://"))
+
+	store, err := NewGCSStore(context.Background())
+	require.NoError(t, err)
+
+	for range 2 {
+		exists, err := store.Exists(context.Background(), "my-bucket", "snapshot.db")
+		require.NoError(t, err)
+		assert.False(t, exists)
+	}
+	assert.Equal(t, 1, tokenRequests, "Expected the metadata token to be cached")
+}
+
+func TestDownload_GCS(t *testing.T) {
+	server := newFakeGCS(t, "test-token")
+	t.Setenv(gcsEndpointEnvVar, server.URL)
+	t.Setenv(gcsAccessTokenEnvVar, "test-token")
+
+	ctx := context.Background()
+	store, err := NewGCSStore(ctx)
+	require.NoError(t, err)
+
+	localPath := filepath.Join(t.TempDir(), "snapshot.db")
+	require.NoError(t, os.WriteFile(localPath, []byte("snapshot data"), 0o600))
+	_, err = store.Put(ctx, localPath, "my-bucket", "base.db")
+	require.NoError(t, err)
+
+	downloadPath := filepath.Join(t.TempDir(), "duckdb.db")
+	require.NoError(t, Download(ctx, "gs://my-bucket/base.db", downloadPath))
+	content, err := os.ReadFile(downloadPath)
+	require.NoError(t, err)
+	assert.Equal(t, "snapshot data", string(content))
+
+	assert.Error(t, Download(ctx, "azure://container/base.db", downloadPath))
+}
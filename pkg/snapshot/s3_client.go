@@ -2,14 +2,17 @@ package snapshot
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"net/http"
 	"os"
 	"strings"
 
 	"github.com/aliengiraffe/spotdb/pkg/helpers"
 	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
@@ -19,12 +22,21 @@ import (
 type S3Client struct {
 	client   *s3.Client
 	uploader *manager.Uploader
+	// objectOptions are applied to every uploaded object
+	objectOptions ObjectOptions
 }
 
-// NewS3Client creates a new S3 client using default AWS configuration from environment
+// NewS3Client creates a new S3 client using default AWS configuration from environment.
+// Uploaded objects get the metadata, tags and encryption from ObjectOptionsFromEnv.
 func NewS3Client(ctx context.Context) (*S3Client, error) {
 	log := helpers.GetLoggerFromContext(ctx)
 
+	objectOptions, err := ObjectOptionsFromEnv()
+	if err != nil {
+		log.Error("Invalid S3 object options", slog.Any("error", err))
+		return nil, err
+	}
+
 	// Load AWS configuration from environment variables
 	cfg, err := config.LoadDefaultConfig(ctx)
 	if err != nil {
@@ -38,11 +50,20 @@ func NewS3Client(ctx context.Context) (*S3Client, error) {
 	log.Info("S3 client initialized successfully")
 
 	return &S3Client{
-		client:   client,
-		uploader: uploader,
+		client:        client,
+		uploader:      uploader,
+		objectOptions: objectOptions,
 	}, nil
 }
 
+// WithObjectOptions returns a client that uploads objects with overrides applied on top
+// of the client's object options
+func (c *S3Client) WithObjectOptions(overrides ObjectOptions) *S3Client {
+	clone := *c
+	clone.objectOptions = c.objectOptions.Merge(overrides)
+	return &clone
+}
+
 // ParseS3URI parses an S3 URI (s3://bucket/key/path) into bucket and key components
 func ParseS3URI(s3URI string) (bucket, key string, err error) {
 	if !strings.HasPrefix(s3URI, "s3://") {
@@ -70,13 +91,18 @@ func ParseS3URI(s3URI string) (bucket, key string, err error) {
 
 // DownloadSnapshot downloads a snapshot file from S3 to a local path
 func (c *S3Client) DownloadSnapshot(ctx context.Context, s3URI, localPath string) error {
-	log := helpers.GetLoggerFromContext(ctx)
-
 	bucket, key, err := ParseS3URI(s3URI)
 	if err != nil {
 		return err
 	}
 
+	return c.Get(ctx, bucket, key, localPath)
+}
+
+// Get downloads the object at bucket and key from S3 to a local path
+func (c *S3Client) Get(ctx context.Context, bucket, key, localPath string) error {
+	log := helpers.GetLoggerFromContext(ctx)
+
 	log.Info("Downloading snapshot from S3",
 		slog.String("bucket", bucket),
 		slog.String("key", key),
@@ -110,6 +136,28 @@ func (c *S3Client) DownloadSnapshot(ctx context.Context, s3URI, localPath string
 	return nil
 }
 
+// Put uploads a local snapshot file to S3 and returns its S3 URI
+func (c *S3Client) Put(ctx context.Context, localPath, bucket, key string) (string, error) {
+	return c.UploadSnapshot(ctx, localPath, bucket, key)
+}
+
+// Exists reports whether an object exists in S3 at bucket and key
+func (c *S3Client) Exists(ctx context.Context, bucket, key string) (bool, error) {
+	_, err := c.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err == nil {
+		return true, nil
+	}
+
+	var responseErr *awshttp.ResponseError
+	if errors.As(err, &responseErr) && responseErr.HTTPStatusCode() == http.StatusNotFound {
+		return false, nil
+	}
+	return false, fmt.Errorf("failed to check snapshot in S3: %w", err)
+}
+
 // UploadSnapshot uploads a local snapshot file to S3
 func (c *S3Client) UploadSnapshot(ctx context.Context, localPath, bucket, key string) (string, error) {
 	log := helpers.GetLoggerFromContext(ctx)
@@ -134,12 +182,14 @@ func (c *S3Client) UploadSnapshot(ctx context.Context, localPath, bucket, key st
 		return "", fmt.Errorf("failed to get file info: %w", err)
 	}
 
-	// Upload the file to S3
-	result, err := c.uploader.Upload(ctx, &s3.PutObjectInput{
+	// Upload the file to S3 with the configured metadata, tags and encryption
+	input := &s3.PutObjectInput{
 		Bucket: aws.String(bucket),
 		Key:    aws.String(key),
 		Body:   file,
-	})
+	}
+	c.objectOptions.apply(input)
+	result, err := c.uploader.Upload(ctx, input)
 
 	if err != nil {
 		log.Error("Failed to upload snapshot to S3", slog.Any("error", err))
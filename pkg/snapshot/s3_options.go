@@ -0,0 +1,186 @@
+package snapshot
+
+import (
+	"fmt"
+	"maps"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/aliengiraffe/spotdb/pkg/helpers"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Server-side encryption algorithms accepted for S3 objects
+const (
+	SSEAlgorithmAES256 = string(types.ServerSideEncryptionAes256)
+	SSEAlgorithmKMS    = string(types.ServerSideEncryptionAwsKms)
+)
+
+// S3 limits on object metadata and tags
+const (
+	maxS3MetadataBytes  = 2 * 1024
+	maxS3Tags           = 10
+	maxS3TagKeyLength   = 128
+	maxS3TagValueLength = 256
+)
+
+var (
+	// kmsKeyIDPattern matches a KMS key ID, a multi-Region key ID or an alias name
+	kmsKeyIDPattern = regexp.MustCompile(`^([0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}|mrk-[0-9a-f]{32}|alias/[A-Za-z0-9/_-]{1,250})$`)
+	// kmsKeyARNPattern matches the ARN of a KMS key or alias, capturing the resource
+	kmsKeyARNPattern = regexp.MustCompile(`^arn:aws[a-z-]*:kms:[a-z0-9-]+:[0-9]{12}:(key/.+|alias/.+)$`)
+	// metadataKeyPattern matches the characters allowed in an HTTP header name
+	metadataKeyPattern = regexp.MustCompile("^[A-Za-z0-9!#$%&'*+.^_`|~-]+$")
+)
+
+// ObjectOptions are the metadata, tags and server-side encryption settings applied to
+// objects uploaded to S3, so they satisfy bucket policies that require them
+type ObjectOptions struct {
+	// Metadata is stored as x-amz-meta-* user metadata
+	Metadata map[string]string
+	// Tags are applied as S3 object tags
+	Tags map[string]string
+	// ServerSideEncryption is AES256 or aws:kms, implied to be aws:kms by KMSKeyID
+	ServerSideEncryption string
+	// KMSKeyID is the KMS key, given as key ID, key ARN, alias name or alias ARN, used
+	// to encrypt objects with SSE-KMS
+	KMSKeyID string
+}
+
+// ObjectOptionsFromEnv returns the object options applied to every S3 upload, configured
+// with ENV_S3_OBJECT_METADATA, ENV_S3_OBJECT_TAGS, ENV_S3_SSE and ENV_S3_SSE_KMS_KEY_ID
+func ObjectOptionsFromEnv() (ObjectOptions, error) {
+	metadata, err := helpers.GetS3ObjectMetadata()
+	if err != nil {
+		return ObjectOptions{}, err
+	}
+	tags, err := helpers.GetS3ObjectTags()
+	if err != nil {
+		return ObjectOptions{}, err
+	}
+
+	options := ObjectOptions{
+		Metadata:             metadata,
+		Tags:                 tags,
+		ServerSideEncryption: helpers.GetS3ServerSideEncryption(),
+		KMSKeyID:             helpers.GetS3SSEKMSKeyID(),
+	}
+	if err := options.Validate(); err != nil {
+		return ObjectOptions{}, fmt.Errorf("invalid S3 object options in environment: %w", err)
+	}
+	return options, nil
+}
+
+// IsZero reports whether no option is set
+func (o ObjectOptions) IsZero() bool {
+	return len(o.Metadata) == 0 && len(o.Tags) == 0 && o.ServerSideEncryption == "" && o.KMSKeyID == ""
+}
+
+// Merge returns the options with overrides applied on top. Metadata and tags are merged
+// key by key, and the encryption settings of overrides replace these when set.
+func (o ObjectOptions) Merge(overrides ObjectOptions) ObjectOptions {
+	merged := ObjectOptions{
+		Metadata:             mergeStringMaps(o.Metadata, overrides.Metadata),
+		Tags:                 mergeStringMaps(o.Tags, overrides.Tags),
+		ServerSideEncryption: o.ServerSideEncryption,
+		KMSKeyID:             o.KMSKeyID,
+	}
+	if overrides.ServerSideEncryption != "" || overrides.KMSKeyID != "" {
+		merged.ServerSideEncryption = overrides.ServerSideEncryption
+		merged.KMSKeyID = overrides.KMSKeyID
+	}
+	return merged
+}
+
+// mergeStringMaps returns the entries of base with those of overrides on top, or nil
+// when both are empty
+func mergeStringMaps(base, overrides map[string]string) map[string]string {
+	if len(base) == 0 && len(overrides) == 0 {
+		return nil
+	}
+	merged := make(map[string]string, len(base)+len(overrides))
+	maps.Copy(merged, base)
+	maps.Copy(merged, overrides)
+	return merged
+}
+
+// Validate checks the options against the limits and formats S3 and KMS accept, so an
+// invalid request fails before the snapshot is created
+func (o ObjectOptions) Validate() error {
+	metadataSize := 0
+	for key, value := range o.Metadata {
+		if !metadataKeyPattern.MatchString(key) {
+			return fmt.Errorf("invalid metadata key %q: must be a valid HTTP header name", key)
+		}
+		metadataSize += len(key) + len(value)
+	}
+	if metadataSize > maxS3MetadataBytes {
+		return fmt.Errorf("metadata is %d bytes, exceeding the S3 limit of %d bytes", metadataSize, maxS3MetadataBytes)
+	}
+
+	if len(o.Tags) > maxS3Tags {
+		return fmt.Errorf("%d tags given, exceeding the S3 limit of %d tags per object", len(o.Tags), maxS3Tags)
+	}
+	for key, value := range o.Tags {
+		if key == "" || len(key) > maxS3TagKeyLength {
+			return fmt.Errorf("invalid tag key %q: must be 1 to %d characters", key, maxS3TagKeyLength)
+		}
+		if strings.HasPrefix(strings.ToLower(key), "aws:") {
+			return fmt.Errorf("invalid tag key %q: the aws: prefix is reserved", key)
+		}
+		if len(value) > maxS3TagValueLength {
+			return fmt.Errorf("invalid value for tag %q: must be at most %d characters", key, maxS3TagValueLength)
+		}
+	}
+
+	switch o.ServerSideEncryption {
+	case "", SSEAlgorithmKMS:
+	case SSEAlgorithmAES256:
+		if o.KMSKeyID != "" {
+			return fmt.Errorf("a KMS key ID requires %s server-side encryption, not %s", SSEAlgorithmKMS, SSEAlgorithmAES256)
+		}
+	default:
+		return fmt.Errorf("unsupported server-side encryption %q: must be %s or %s", o.ServerSideEncryption, SSEAlgorithmAES256, SSEAlgorithmKMS)
+	}
+
+	if o.KMSKeyID != "" && !isValidKMSKeyID(o.KMSKeyID) {
+		return fmt.Errorf("invalid KMS key ID %q: must be a key ID, key ARN, alias name (alias/...) or alias ARN", o.KMSKeyID)
+	}
+
+	return nil
+}
+
+// isValidKMSKeyID reports whether id has one of the formats KMS accepts to identify a key
+func isValidKMSKeyID(id string) bool {
+	if kmsKeyIDPattern.MatchString(id) {
+		return true
+	}
+	match := kmsKeyARNPattern.FindStringSubmatch(id)
+	return match != nil && kmsKeyIDPattern.MatchString(strings.TrimPrefix(match[1], "key/"))
+}
+
+// apply sets the options on an upload
+func (o ObjectOptions) apply(input *s3.PutObjectInput) {
+	if len(o.Metadata) > 0 {
+		input.Metadata = o.Metadata
+	}
+
+	if len(o.Tags) > 0 {
+		tagging := url.Values{}
+		for _, key := range slices.Sorted(maps.Keys(o.Tags)) {
+			tagging.Set(key, o.Tags[key])
+		}
+		input.Tagging = aws.String(tagging.Encode())
+	}
+
+	if o.KMSKeyID != "" {
+		input.ServerSideEncryption = types.ServerSideEncryptionAwsKms
+		input.SSEKMSKeyId = aws.String(o.KMSKeyID)
+	} else if o.ServerSideEncryption != "" {
+		input.ServerSideEncryption = types.ServerSideEncryption(o.ServerSideEncryption)
+	}
+}
@@ -0,0 +1,145 @@
+package snapshot
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestObjectOptions_Validate(t *testing.T) {
+	tests := []struct {
+		name     string
+		options  ObjectOptions
+		errorMsg string
+	}{
+		{name: "empty", options: ObjectOptions{}},
+		{name: "key ID", options: ObjectOptions{KMSKeyID: "1234abcd-12ab-34cd-56ef-1234567890ab"}},
+		{name: "multi-Region key ID", options: ObjectOptions{KMSKeyID: "mrk-1234abcd12ab34cd56ef1234567890ab"}},
+		{name: "key ARN", options: ObjectOptions{KMSKeyID: "arn:aws:kms:us-east-1:111122223333:key/1234abcd-12ab-34cd-56ef-1234567890ab"}},
+		{name: "alias name", options: ObjectOptions{KMSKeyID: "alias/snapshots"}},
+		{name: "alias ARN", options: ObjectOptions{KMSKeyID: "arn:aws-us-gov:kms:us-gov-west-1:111122223333:alias/snapshots"}},
+		{name: "key ID with explicit aws:kms", options: ObjectOptions{ServerSideEncryption: SSEAlgorithmKMS, KMSKeyID: "alias/snapshots"}},
+		{name: "AES256", options: ObjectOptions{ServerSideEncryption: SSEAlgorithmAES256}},
+		{name: "metadata and tags", options: ObjectOptions{Metadata: map[string]string{"owner": "data-team"}, Tags: map[string]string{"classification": "internal", "reviewed": ""}}},
+		{name: "malformed key ID", options: ObjectOptions{KMSKeyID: "my-key"}, errorMsg: "invalid KMS key ID"},
+		{name: "key ARN with malformed key ID", options: ObjectOptions{KMSKeyID: "arn:aws:kms:us-east-1:111122223333:key/my-key"}, errorMsg: "invalid KMS key ID"},
+		{name: "ARN of another service", options: ObjectOptions{KMSKeyID: "arn:aws:s3:::my-bucket"}, errorMsg: "invalid KMS key ID"},
+		{name: "key ID with AES256", options: ObjectOptions{ServerSideEncryption: SSEAlgorithmAES256, KMSKeyID: "alias/snapshots"}, errorMsg: "requires aws:kms"},
+		{name: "unknown encryption", options: ObjectOptions{ServerSideEncryption: "aws:kms:dsse-x"}, errorMsg: "unsupported server-side encryption"},
+		{name: "invalid metadata key", options: ObjectOptions{Metadata: map[string]string{"owner team": "data"}}, errorMsg: "invalid metadata key"},
+		{name: "metadata too large", options: ObjectOptions{Metadata: map[string]string{"note": strings.Repeat("x", 2048)}}, errorMsg: "exceeding the S3 limit"},
+		{name: "too many tags", options: ObjectOptions{Tags: map[string]string{"a": "", "b": "", "c": "", "d": "", "e": "", "f": "", "g": "", "h": "", "i": "", "j": "", "k": ""}}, errorMsg: "exceeding the S3 limit of 10 tags"},
+		{name: "reserved tag prefix", options: ObjectOptions{Tags: map[string]string{"AWS:owner": "data"}}, errorMsg: "reserved"},
+		{name: "tag value too long", options: ObjectOptions{Tags: map[string]string{"note": strings.Repeat("x", 257)}}, errorMsg: "at most 256 characters"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.options.Validate()
+			if tt.errorMsg == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.errorMsg)
+		})
+	}
+}
+
+func TestObjectOptions_Merge(t *testing.T) {
+	defaults := ObjectOptions{
+		Metadata:             map[string]string{"owner": "platform"},
+		Tags:                 map[string]string{"env": "prod", "team": "platform"},
+		ServerSideEncryption: SSEAlgorithmAES256,
+	}
+
+	merged := defaults.Merge(ObjectOptions{
+		Tags:     map[string]string{"team": "data"},
+		KMSKeyID: "alias/snapshots",
+	})
+
+	assert.Equal(t, map[string]string{"owner": "platform"}, merged.Metadata)
+	assert.Equal(t, map[string]string{"env": "prod", "team": "data"}, merged.Tags)
+	assert.Equal(t, "", merged.ServerSideEncryption, "a KMS key replaces the default encryption")
+	assert.Equal(t, "alias/snapshots", merged.KMSKeyID)
+	assert.Equal(t, map[string]string{"env": "prod", "team": "platform"}, defaults.Tags, "the defaults are not modified")
+
+	assert.Equal(t, defaults, defaults.Merge(ObjectOptions{}))
+}
+
+func TestObjectOptionsFromEnv(t *testing.T) {
+	t.Setenv("ENV_S3_OBJECT_METADATA", "owner=data-team")
+	t.Setenv("ENV_S3_OBJECT_TAGS", "classification=internal,retention=90d")
+	t.Setenv("ENV_S3_SSE", "")
+	t.Setenv("ENV_S3_SSE_KMS_KEY_ID", "alias/snapshots")
+
+	options, err := ObjectOptionsFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, ObjectOptions{
+		Metadata: map[string]string{"owner": "data-team"},
+		Tags:     map[string]string{"classification": "internal", "retention": "90d"},
+		KMSKeyID: "alias/snapshots",
+	}, options)
+
+	t.Setenv("ENV_S3_SSE_KMS_KEY_ID", "my-key")
+	_, err = ObjectOptionsFromEnv()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid KMS key ID")
+}
+
+func TestS3Client_UploadSnapshot_ObjectOptions(t *testing.T) {
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		header = r.Header.Clone()
+		w.Header().Set("ETag", `"etag"`)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := s3.New(s3.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(server.URL),
+		UsePathStyle: true,
+		Credentials: aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "test", SecretAccessKey: "test"}, nil
+		}),
+	})
+	s3Client := &S3Client{
+		client:        client,
+		uploader:      manager.NewUploader(client),
+		objectOptions: ObjectOptions{Tags: map[string]string{"env": "prod"}, ServerSideEncryption: SSEAlgorithmAES256},
+	}
+
+	localPath := filepath.Join(t.TempDir(), "snapshot.db")
+	require.NoError(t, os.WriteFile(localPath, []byte("snapshot"), 0o600))
+
+	uploader := s3Client.WithObjectOptions(ObjectOptions{
+		Metadata: map[string]string{"owner": "data-team"},
+		Tags:     map[string]string{"classification": "internal use"},
+		KMSKeyID: "alias/snapshots",
+	})
+	uri, err := uploader.UploadSnapshot(context.Background(), localPath, "my-bucket", "snapshots/snapshot.db")
+	require.NoError(t, err)
+	assert.Equal(t, "s3://my-bucket/snapshots/snapshot.db", uri)
+
+	tags, err := url.ParseQuery(header.Get("X-Amz-Tagging"))
+	require.NoError(t, err)
+	assert.Equal(t, url.Values{"classification": {"internal use"}, "env": {"prod"}}, tags)
+	assert.Equal(t, "data-team", header.Get("X-Amz-Meta-Owner"))
+	assert.Equal(t, "aws:kms", header.Get("X-Amz-Server-Side-Encryption"))
+	assert.Equal(t, "alias/snapshots", header.Get("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id"))
+	assert.Equal(t, ObjectOptions{Tags: map[string]string{"env": "prod"}, ServerSideEncryption: SSEAlgorithmAES256}, s3Client.objectOptions, "the original client keeps its options")
+}
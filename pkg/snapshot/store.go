@@ -0,0 +1,86 @@
+package snapshot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Location schemes of the supported snapshot storage backends
+const (
+	SchemeS3  = "s3"
+	SchemeGCS = "gs"
+)
+
+// Store is a snapshot storage backend holding snapshot files as objects in buckets
+type Store interface {
+	// Put uploads the local file to bucket under key and returns the object URI
+	Put(ctx context.Context, localPath, bucket, key string) (string, error)
+	// Get downloads the object at bucket and key to the local path
+	Get(ctx context.Context, bucket, key, localPath string) error
+	// Exists reports whether an object exists at bucket and key
+	Exists(ctx context.Context, bucket, key string) (bool, error)
+}
+
+// NewStore creates the storage backend for a location scheme, configured from the environment
+func NewStore(ctx context.Context, scheme string) (Store, error) {
+	switch scheme {
+	case SchemeS3:
+		return NewS3Client(ctx)
+	case SchemeGCS:
+		return NewGCSStore(ctx)
+	default:
+		return nil, fmt.Errorf("unsupported snapshot storage scheme: %q", scheme)
+	}
+}
+
+// ParseLocation parses a snapshot location (s3://bucket/key or gs://bucket/key) into its
+// scheme, bucket and key components
+func ParseLocation(uri string) (scheme, bucket, key string, err error) {
+	scheme, path, found := strings.Cut(uri, "://")
+	if !found || (scheme != SchemeS3 && scheme != SchemeGCS) {
+		return "", "", "", fmt.Errorf("invalid snapshot location: must start with s3:// or gs://")
+	}
+
+	bucket, key, found = strings.Cut(path, "/")
+	if !found || bucket == "" || key == "" {
+		return "", "", "", fmt.Errorf("invalid snapshot location: must contain bucket and key (%s://bucket/key)", scheme)
+	}
+
+	return scheme, bucket, key, nil
+}
+
+// SplitBucket separates an optional s3:// or gs:// scheme from a bucket name, returning
+// defaultScheme for plain bucket names
+func SplitBucket(bucket, defaultScheme string) (scheme, name string, err error) {
+	scheme, name, found := strings.Cut(bucket, "://")
+	if !found {
+		return defaultScheme, bucket, nil
+	}
+
+	if scheme != SchemeS3 && scheme != SchemeGCS {
+		return "", "", fmt.Errorf("unsupported bucket scheme: %q, must be s3 or gs", scheme)
+	}
+	name = strings.TrimSuffix(name, "/")
+	if name == "" || strings.Contains(name, "/") {
+		return "", "", fmt.Errorf("invalid bucket: %q", bucket)
+	}
+
+	return scheme, name, nil
+}
+
+// Download fetches the snapshot at the given location to the local path using the
+// storage backend for its scheme
+func Download(ctx context.Context, uri, localPath string) error {
+	scheme, bucket, key, err := ParseLocation(uri)
+	if err != nil {
+		return err
+	}
+
+	store, err := NewStore(ctx, scheme)
+	if err != nil {
+		return err
+	}
+
+	return store.Get(ctx, bucket, key, localPath)
+}
@@ -0,0 +1,83 @@
+package snapshot
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLocation(t *testing.T) {
+	tests := []struct {
+		name       string
+		uri        string
+		wantScheme string
+		wantBucket string
+		wantKey    string
+		wantErr    bool
+	}{
+		{name: "s3 location", uri: "s3://my-bucket/snapshots/db.db", wantScheme: SchemeS3, wantBucket: "my-bucket", wantKey: "snapshots/db.db"},
+		{name: "gcs location", uri: "gs://my-bucket/snapshots/db.db", wantScheme: SchemeGCS, wantBucket: "my-bucket", wantKey: "snapshots/db.db"},
+		{name: "unsupported scheme", uri: "azure://container/db.db", wantErr: true},
+		{name: "no scheme", uri: "my-bucket/db.db", wantErr: true},
+		{name: "missing key", uri: "gs://my-bucket", wantErr: true},
+		{name: "empty key", uri: "gs://my-bucket/", wantErr: true},
+		{name: "empty bucket", uri: "s3:///db.db", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheme, bucket, key, err := ParseLocation(tt.uri)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantScheme, scheme)
+			assert.Equal(t, tt.wantBucket, bucket)
+			assert.Equal(t, tt.wantKey, key)
+		})
+	}
+}
+
+func TestSplitBucket(t *testing.T) {
+	tests := []struct {
+		name          string
+		bucket        string
+		defaultScheme string
+		wantScheme    string
+		wantName      string
+		wantErr       bool
+	}{
+		{name: "plain bucket uses default", bucket: "my-bucket", defaultScheme: SchemeS3, wantScheme: SchemeS3, wantName: "my-bucket"},
+		{name: "plain bucket with gcs default", bucket: "my-bucket", defaultScheme: SchemeGCS, wantScheme: SchemeGCS, wantName: "my-bucket"},
+		{name: "gcs prefix overrides default", bucket: "gs://my-bucket", defaultScheme: SchemeS3, wantScheme: SchemeGCS, wantName: "my-bucket"},
+		{name: "trailing slash", bucket: "s3://my-bucket/", defaultScheme: SchemeGCS, wantScheme: SchemeS3, wantName: "my-bucket"},
+		{name: "unsupported scheme", bucket: "azure://container", defaultScheme: SchemeS3, wantErr: true},
+		{name: "path in bucket", bucket: "gs://my-bucket/path", defaultScheme: SchemeS3, wantErr: true},
+		{name: "empty bucket", bucket: "gs://", defaultScheme: SchemeS3, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheme, name, err := SplitBucket(tt.bucket, tt.defaultScheme)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantScheme, scheme)
+			assert.Equal(t, tt.wantName, name)
+		})
+	}
+}
+
+func TestNewStore(t *testing.T) {
+	store, err := NewStore(context.Background(), SchemeGCS)
+	require.NoError(t, err)
+	assert.IsType(t, &GCSStore{}, store)
+
+	_, err = NewStore(context.Background(), "azure")
+	assert.Error(t, err)
+}
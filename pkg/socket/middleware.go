@@ -35,6 +35,8 @@ func loggingMiddleware(baseLogger *slog.Logger) func(http.Handler) http.Handler
 			// Generate a unique connection ID
 			connectionID := helpers.GenerateID()
 			ctx := context.WithValue(r.Context(), connIDKey, connectionID)
+			// Queries run over the connection are reported under its ID in the admin activity
+			ctx = helpers.SetRequestIDInContext(ctx, connectionID)
 			r = r.WithContext(helpers.SetLoggerInContext(ctx, baseLogger))
 			next.ServeHTTP(w, r)
 		})
@@ -27,6 +27,8 @@ type Server struct {
 	mu            sync.Mutex
 	wg            sync.WaitGroup
 	authHandler   func(http.Handler) http.Handler
+	// slots bounds the number of concurrent WebSocket connections, nil when unlimited
+	slots chan struct{}
 }
 
 // WSEvent represents a client request over the socket
@@ -56,6 +58,10 @@ func NewServer(db *database.DuckDB, address string) (*Server, error) {
 		},
 	}
 
+	if maxConns := helpers.GetSocketMaxConns(); maxConns > 0 {
+		s.slots = make(chan struct{}, maxConns)
+	}
+
 	s.SetAuthHandler(apiKeyMiddleware)
 	return s, nil
 }
@@ -116,6 +122,55 @@ func (s *Server) Start(ctx context.Context, log *slog.Logger) error {
 	return nil
 }
 
+// ActiveConnections returns the number of open TCP and WebSocket connections
+func (s *Server) ActiveConnections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.connections) + len(s.wsConnections)
+}
+
+// MaxConnections returns the maximum number of concurrent WebSocket connections, or 0
+// when the number is not limited
+func (s *Server) MaxConnections() int {
+	return cap(s.slots)
+}
+
+// acquireSlot reserves a connection slot, reporting false when the server is saturated
+func (s *Server) acquireSlot() bool {
+	if s.slots == nil {
+		return true
+	}
+
+	select {
+	case s.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// releaseSlot frees a slot reserved by acquireSlot
+func (s *Server) releaseSlot() {
+	if s.slots != nil {
+		<-s.slots
+	}
+}
+
+// rejectConnection tells a client that the server is saturated with an error response
+// followed by a "try again later" close frame, then closes the connection
+func rejectConnection(conn *websocket.Conn, maxConns int) {
+	defer helpers.CloseResources(conn, "WebSocket connection")
+
+	message := fmt.Sprintf("too many connections: the server accepts at most %d concurrent connections", maxConns)
+	deadline := time.Now().Add(time.Second)
+	_ = conn.SetWriteDeadline(deadline)
+	if err := conn.WriteJSON(Response{Status: "error", Error: message}); err != nil {
+		return
+	}
+	_ = conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "too many connections"), deadline)
+}
+
 // Stop stops the socket server
 func (s *Server) Stop(log *slog.Logger) {
 	// Use a mutex to ensure thread safety
@@ -177,6 +232,15 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	remoteAddr := conn.RemoteAddr().String()
 	extraLogger = extraLogger.With(slog.String("remote_address", remoteAddr))
 
+	// The upgrade happens first so a saturated server can still answer with an error frame
+	if !s.acquireSlot() {
+		extraLogger.Info("Rejected WebSocket connection",
+			slog.String("reason", "too many connections"),
+			slog.Int("max_connections", s.MaxConnections()))
+		rejectConnection(conn, s.MaxConnections())
+		return
+	}
+
 	extraLogger.Info("WebSocket connection established")
 
 	// Add connection to map
@@ -194,6 +258,9 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 			delete(s.wsConnections, conn)
 			s.mu.Unlock()
 		}()
+		// Released before the connection is unregistered, so a closed connection no
+		// longer counted as active never holds a slot
+		defer s.releaseSlot()
 
 		requestCount := 0
 
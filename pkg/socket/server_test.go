@@ -343,6 +343,11 @@ func TestWebSocketHandler(t *testing.T) {
 		t.Errorf("Expected 2 results, got %d", len(resp.Results))
 	}
 
+	// The connection is registered once the first response was sent
+	if got := server.ActiveConnections(); got != 1 {
+		t.Errorf("Expected 1 active connection, got %d", got)
+	}
+
 	// Send an invalid request
 	invalidReq := WSEvent{
 		Type:  "query",
@@ -464,3 +469,80 @@ func TestResponseJSONMarshaling(t *testing.T) {
 		t.Errorf("Expected %d results, got %d", len(resp.Results), len(respUnmarshaled.Results))
 	}
 }
+
+func TestWebSocketConnectionLimit(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	t.Setenv("ENV_SOCKET_MAX_CONNS", "1")
+
+	db, err := database.NewDuckDB(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer helpers.CloseResources(db, "database connection")
+
+	server, err := NewServer(db, "localhost:0")
+	if err != nil {
+		t.Fatalf("Failed to create socket server: %v", err)
+	}
+	if got := server.MaxConnections(); got != 1 {
+		t.Fatalf("Expected a limit of 1 connection, got %d", got)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(server.handleWebSocket))
+	defer srv.Close()
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	query := func(conn *websocket.Conn) Response {
+		t.Helper()
+		if err := conn.WriteJSON(WSEvent{Type: "query", Query: "SELECT 1 AS one"}); err != nil {
+			t.Fatalf("Failed to send query: %v", err)
+		}
+		var resp Response
+		if err := conn.ReadJSON(&resp); err != nil {
+			t.Fatalf("Failed to read response: %v", err)
+		}
+		return resp
+	}
+
+	first, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	if resp := query(first); resp.Status != "success" {
+		t.Fatalf("Expected first connection to succeed, got %+v", resp)
+	}
+
+	// A second connection gets an error frame and is closed
+	second, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer helpers.CloseResources(second, "WebSocket connection")
+
+	var rejected Response
+	if err := second.ReadJSON(&rejected); err != nil {
+		t.Fatalf("Failed to read rejection: %v", err)
+	}
+	if rejected.Status != "error" || !strings.Contains(rejected.Error, "too many connections") {
+		t.Errorf("Unexpected rejection: %+v", rejected)
+	}
+	if _, _, err := second.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseTryAgainLater) {
+		t.Errorf("Expected a try again later close frame, got %v", err)
+	}
+
+	// Closing the first connection frees its slot
+	helpers.CloseResources(first, "WebSocket connection")
+	deadline := time.Now().Add(2 * time.Second)
+	for server.ActiveConnections() > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	third, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer helpers.CloseResources(third, "WebSocket connection")
+	if resp := query(third); resp.Status != "success" {
+		t.Errorf("Expected connection to succeed after a slot was freed, got %+v", resp)
+	}
+}